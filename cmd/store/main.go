@@ -2,69 +2,315 @@ package main
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"log"
+	"math"
 	"merch_store/internal/app"
 	"merch_store/internal/config"
+	"merch_store/internal/demo"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/crypto"
+	"merch_store/internal/pkg/featureflag"
 	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/metrics"
+	"merch_store/internal/pkg/ratelimit"
+	"merch_store/internal/pkg/worker"
+	"merch_store/internal/preflight"
+	"merch_store/internal/selftest"
 	"merch_store/internal/service"
 	"merch_store/internal/storage"
-	"net/http"
+	"merch_store/internal/webui"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
+// leaderElectionKey names the leadership of the instances sharing the database, whose leader runs the singleton
+// workers: the scheduled transfers, the monthly accrual, and the invariant checker.
+const leaderElectionKey = "merch_store/background-jobs"
+
 func main() {
 	var l *logger.Logger
 	var err error
 	if l, err = logger.CreateLogger(config.LogLevel); err != nil {
 		log.Fatal("Failed to create logger:", err)
 	}
+	l.SetRequestLogPolicy(requestLogPolicy())
+	auth.SetSecret(config.JWTSecret)
+	auth.SetIssuerAndAudience(config.JWTIssuer, config.JWTAudience)
+	auth.SetVerifiedTokenCacheSize(config.VerifiedTokenCacheSize)
 
-	storage, err := storage.NewPostgreSQL(config.DatabaseURI, l)
+	balanceIsolation, err := storage.ParseIsolationLevel(config.DBBalanceIsolation)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer storage.Close()
 
-	app := app.NewApp(storage, l)
-	service := service.NewService(app, config.ServerRunAddress, l)
+	registrationMode, err := app.ParseRegistrationMode(config.RegistrationMode)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	const readHeaderTimeout = 5 * time.Second
-	server := &http.Server{Addr: config.ServerRunAddress, Handler: service.NewRouter(), ReadHeaderTimeout: readHeaderTimeout}
+	trustedProxies, err := ratelimit.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	serverCtx, serverStopCtx := context.WithCancel(context.Background())
+	registrationAllowlist, err := ratelimit.ParseNetworks(config.RegistrationCooldownAllowlist)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	go func() {
-		<-sig
+	activityCipher, err := crypto.ParseKeys(config.EncryptionKeys)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		const shutdownTimeout = 30 * time.Second
-		shutdownCtx, cancel := context.WithTimeout(serverCtx, shutdownTimeout)
-		defer cancel()
+	flags := featureflag.New(config.FeatureFlagsFile, config.FeatureFlagsReloadInterval, l)
+	if err := flags.Reload(); err != nil {
+		log.Fatal(err)
+	}
 
-		go func() {
-			<-shutdownCtx.Done()
-			if errors.Is(shutdownCtx.Err(), context.DeadlineExceeded) {
-				log.Fatal("graceful shutdown timed out.. forcing exit.")
-			}
-		}()
+	// The replica is opened first, as the primary storage shadows the storage package.
+	var replica *storage.PostgreSQL
+	if config.DatabaseReplicaURI != "" {
+		replica, err = storage.Open(config.DBDriver, config.DatabaseReplicaURI, l)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer replica.Close()
+		replica.SetDeadlineFloor(config.DBDeadlineFloor)
+		replica.SetCipher(activityCipher)
+	}
+
+	storage, err := storage.Open(config.DBDriver, config.DatabaseURI, l)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+	storage.SetBalanceIsolation(balanceIsolation)
+	storage.SetMaxCoinBalance(config.MaxCoinBalance)
+	storage.SetDeadlineFloor(config.DBDeadlineFloor)
+	storage.SetLeaderKeepAlive(config.LeaderElectionInterval)
+	storage.SetCipher(activityCipher)
 
-		err := server.Shutdown(shutdownCtx)
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		const selftestTimeout = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), selftestTimeout)
+		report := selftest.Run(ctx, storage, l)
+		cancel()
+		report.WriteTo(os.Stdout)
+		if !report.Passed() {
+			storage.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "demo-seed" {
+		const seedTimeout = 5 * time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), seedTimeout)
+		result, err := demo.Seed(ctx, storage, demo.DefaultConfig(), l)
+		cancel()
 		if err != nil {
+			storage.Close()
 			log.Fatal(err)
 		}
-		serverStopCtx()
-	}()
+		if result.AlreadySeeded {
+			fmt.Printf("demo data already seeded (user %s exists)\n", demo.MarkerUsername)
+			return
+		}
+		fmt.Printf("seeded %d demo users (password %q), %d transfers, %d purchases\n",
+			len(result.Users), demo.Password, result.Transfers, result.Purchases)
+		return
+	}
+
+	if config.AppEnv == preflight.ProductionEnv {
+		const preflightTimeout = 10 * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		report := preflight.Run(ctx, preflight.Config{
+			JWTSecret:         config.JWTSecret,
+			RegistrationMode:  registrationMode,
+			EncryptionEnabled: activityCipher.Enabled(),
+		}, storage)
+		cancel()
+		report.Log(l)
+		if report.Fatal() {
+			storage.Close()
+			log.Fatal("Preflight checks failed, refusing to start in production")
+		}
+	}
+
+	var purchaseQueue *app.PurchaseQueue
+	if len(config.FlashSaleItems) > 0 {
+		purchaseQueue = app.NewPurchaseQueue(storage, config.FlashSaleItems, config.FlashSaleQueueSize, config.FlashSaleQueueTTL, l)
+	}
+
+	var monthlyAccrual *app.MonthlyAccrual
+	if config.AccrualAmount > 0 {
+		monthlyAccrual = app.NewMonthlyAccrual(storage, config.AccrualAmount, config.AccrualCheckInterval, clock.Real{}, l)
+	}
+
+	scheduledTransfers := app.NewScheduledTransferWorker(storage, config.ScheduledTransferInterval, clock.Real{}, l)
+
+	var invariantChecker *app.InvariantChecker
+	if config.InvariantCheckInterval > 0 {
+		invariantChecker = app.NewInvariantChecker(storage, config.InvariantCheckInterval, clock.Real{}, l)
+	}
 
-	err = server.ListenAndServe()
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		defer storage.Close()
+	var transferArchiver *app.TransferArchiver
+	if config.TransferArchiveAge > 0 {
+		transferArchiver = app.NewTransferArchiver(storage, config.TransferArchiveAge, config.TransferArchiveInterval, clock.Real{}, l)
+	}
+
+	failedPurchases := app.NewFailedPurchaseRecorder(storage, config.FailedPurchaseBufferSize, l)
+	activity := app.NewActivityRecorder(storage, config.ActivityBufferSize, l)
+
+	events := app.NewEventBroker()
+
+	app := app.NewApp(storage, l)
+	app.SetEventBroker(events)
+	app.SetFailedPurchaseRecorder(failedPurchases)
+	app.SetActivityRecorder(activity)
+	app.SetRegistrationMode(registrationMode)
+	app.SetRegistrationCooldown(config.RegistrationCooldown, registrationAllowlist)
+	app.SetFeatureFlags(flags)
+	app.SetPurchaseDebounce(config.PurchaseDebounceWindow)
+	app.SetTransferConfirmation(config.TransferConfirmationThreshold)
+	app.SetShowRecipientBalance(config.PrivacyShowRecipientBalance)
+	app.SetTermsVersion(config.TermsVersion)
+	app.SetInfoHistoryLimit(config.InfoHistoryThreshold, config.InfoHistoryLimit)
+	if replica != nil {
+		app.SetReadReplica(replica, config.ReadYourWritesWindow)
+	}
+	if purchaseQueue != nil {
+		app.SetPurchaseQueue(purchaseQueue)
+	}
+	if monthlyAccrual != nil {
+		app.SetMonthlyAccrual(monthlyAccrual)
+	}
+	if config.ValidateUserOnRequest {
+		app.SetUserValidation(config.ValidateUserCacheTTL)
+	}
+	if config.SessionLimit > 0 {
+		app.SetSessionLimit(config.SessionLimit)
+		metrics.RegisterActiveTokens(func() float64 {
+			const countTimeout = 5 * time.Second
+			ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+			defer cancel()
+			count, err := app.CountActiveSessions(ctx)
+			if err != nil {
+				return math.NaN()
+			}
+			return float64(count)
+		})
+	}
+
+	const shutdownTimeout = 30 * time.Second
+	serverConfig := service.ServerConfig{ReadHeaderTimeout: 5 * time.Second, ShutdownTimeout: shutdownTimeout}
+	service := service.NewService(app, config.ServerRunAddress, l)
+	service.SetTrustedProxies(trustedProxies)
+	if config.AdminAPISecret != "" {
+		service.SetAdminRequestVerifier(auth.NewRequestVerifier([]byte(config.AdminAPISecret), auth.SignatureWindow, clock.Real{}))
+	}
+	if config.AuthRateLimit > 0 {
+		service.SetAuthRateLimiter(ratelimit.NewIPLimiter(config.AuthRateLimit, config.AuthRateBurst, trustedProxies, clock.Real{}))
+	}
+	if config.WebUIEnabled {
+		service.SetWebUI(webui.Handler())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	workers := worker.NewManager(l, shutdownTimeout)
+	if config.LeaderElectionInterval > 0 {
+		workers.SetElector(storage.Elector(leaderElectionKey), config.LeaderElectionInterval)
+	}
+	workers.Register("http-server", worker.Func(func(ctx context.Context) error {
+		return service.ListenAndServe(ctx, serverConfig)
+	}))
+	workers.Register("failed-purchases", failedPurchases)
+	workers.Register("api-activity", activity)
+	workers.RegisterSingleton("scheduled-transfers", scheduledTransfers)
+	workers.Register("feature-flags", flags)
+	if purchaseQueue != nil {
+		workers.Register("purchase-queue", purchaseQueue)
+	}
+	if monthlyAccrual != nil {
+		workers.RegisterSingleton("monthly-accrual", monthlyAccrual)
+	}
+	if invariantChecker != nil {
+		workers.RegisterSingleton("invariant-checker", invariantChecker)
+	}
+	if transferArchiver != nil {
+		workers.RegisterSingleton("transfer-archiver", transferArchiver)
+	}
+	workers.Start(ctx)
+
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-workers.Done():
+			break wait
+		case <-hangup:
+			reloadConfig(l, flags)
+		}
+	}
+
+	// Turn new requests away before the workers, the HTTP server among them, and the storage are stopped.
+	service.BeginShutdown()
+	if err := workers.Stop(); err != nil {
+		storage.Close()
 		log.Fatal(err)
 	}
+}
+
+// requestLogPolicy returns the request log policy configured by the LOG_* settings.
+func requestLogPolicy() logger.RequestLogPolicy {
+	return logger.RequestLogPolicy{
+		SkipPrefixes:      config.LogSkipPaths,
+		SuccessSampleRate: config.LogSuccessSampleRate,
+		SlowThreshold:     config.LogSlowRequestThreshold,
+	}
+}
 
-	<-serverCtx.Done()
+// reloadConfig rereads the configuration on SIGHUP and applies the settings that can change at runtime:
+// the log level, the request log policy, and the feature flag file. Changes of the other settings are
+// logged as warnings and take effect after a restart.
+func reloadConfig(l *logger.Logger, flags *featureflag.Flags) {
+	changes, err := config.Reload()
+	if err != nil {
+		l.Sugar().Errorf("Failed to reload the configuration, keeping the current one: %s", err)
+		return
+	}
+	if len(changes) == 0 {
+		l.Info("Reloaded the configuration, nothing changed")
+		return
+	}
+
+	for _, change := range changes {
+		if change.RestartRequired {
+			l.Sugar().Warnf("Ignoring reloaded setting: %s", change)
+			continue
+		}
+		l.Sugar().Infof("Reloaded setting %s", change)
+	}
+
+	if err := l.SetLevel(config.LogLevel); err != nil {
+		l.Sugar().Errorf("Failed to apply LOG_LEVEL %q: %s", config.LogLevel, err)
+	}
+	l.SetRequestLogPolicy(requestLogPolicy())
+	if config.FeatureFlagsFile != flags.Path() {
+		if err := flags.SetPath(config.FeatureFlagsFile); err != nil {
+			l.Sugar().Errorf("Failed to switch to feature flag file %q, keeping %q: %s", config.FeatureFlagsFile, flags.Path(), err)
+		}
+	}
 }
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// accrualPeriodLayout is the format of accrual periods in requests and responses.
+const accrualPeriodLayout = "2006-01"
+
+// Predefined errors for monthly coin accrual.
+var (
+	// ErrAccrualDisabled indicates that monthly accrual is not configured.
+	ErrAccrualDisabled = errors.New("app: monthly accrual is disabled")
+	// ErrInvalidAccrualPeriod indicates that the requested period is not a valid YYYY-MM month.
+	ErrInvalidAccrualPeriod = errors.New("app: invalid accrual period")
+)
+
+// MonthlyAccrual credits a fixed amount of coins to every active user once per calendar month (UTC).
+// As a worker it checks every interval whether the current month has been accrued; the storage layer
+// guarantees that each month is accrued exactly once, even when several replicas run the worker.
+type MonthlyAccrual struct {
+	db       storage.Storage
+	log      *logger.Logger
+	clock    clock.Clock
+	amount   int
+	interval time.Duration
+
+	lastPeriod time.Time // Last period known to be accrued, touched only by Run.
+}
+
+// NewMonthlyAccrual creates a MonthlyAccrual crediting amount coins and checking the schedule every interval.
+func NewMonthlyAccrual(db storage.Storage, amount int, interval time.Duration, c clock.Clock, l *logger.Logger) *MonthlyAccrual {
+	return &MonthlyAccrual{db: db, log: l, clock: c, amount: amount, interval: interval}
+}
+
+// AccrualPeriod returns the month containing t, as the first day of the month in UTC.
+func AccrualPeriod(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Accrue credits the coins for the period and returns the number of users credited.
+// It returns storage.ErrAccrualAlreadyDone when the period has already been accrued.
+func (accrual *MonthlyAccrual) Accrue(ctx context.Context, period time.Time) (*models.AccrualResponse, error) {
+	period = AccrualPeriod(period)
+	credited, err := accrual.db.AccrueMonthlyCoins(ctx, period, accrual.amount)
+	if err != nil {
+		return nil, err
+	}
+
+	accrual.log.Sugar().Infof("Accrued %d coins to %d users for %s", accrual.amount, credited, period.Format(accrualPeriodLayout))
+	return &models.AccrualResponse{Period: period.Format(accrualPeriodLayout), Amount: accrual.amount, UsersCredited: credited}, nil
+}
+
+// Run accrues the current month on start and whenever a new month begins, until ctx is canceled.
+// It implements worker.Worker.
+func (accrual *MonthlyAccrual) Run(ctx context.Context) error {
+	ticker := time.NewTicker(accrual.interval)
+	defer ticker.Stop()
+
+	for {
+		accrual.accrueCurrent(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// accrueCurrent accrues the current month unless it is already known to be accrued.
+func (accrual *MonthlyAccrual) accrueCurrent(ctx context.Context) {
+	period := AccrualPeriod(accrual.clock.Now())
+	if period.Equal(accrual.lastPeriod) {
+		return
+	}
+
+	_, err := accrual.Accrue(ctx, period)
+	if err != nil && !errors.Is(err, storage.ErrAccrualAlreadyDone) {
+		accrual.log.Sugar().Errorf("Monthly accrual for %s failed: %s", period.Format(accrualPeriodLayout), err)
+		return
+	}
+
+	accrual.lastPeriod = period
+}
+
+// SetMonthlyAccrual enables the manual accrual trigger for the given accrual.
+func (app *App) SetMonthlyAccrual(accrual *MonthlyAccrual) {
+	app.accrual = accrual
+}
+
+// ProcessAccrual runs the monthly accrual for the given YYYY-MM period, or the current month when period is empty.
+// It is meant for administrators to recover missed runs.
+func (app *App) ProcessAccrual(ctx context.Context, period string) (*models.AccrualResponse, error) {
+	if app.accrual == nil {
+		return nil, ErrAccrualDisabled
+	}
+
+	month := app.Now()
+	if period != "" {
+		parsed, err := time.Parse(accrualPeriodLayout, period)
+		if err != nil {
+			return nil, ErrInvalidAccrualPeriod
+		}
+		month = parsed
+	}
+
+	return app.accrual.Accrue(ctx, month)
+}
+
+// IsAdmin reports whether the user has administrator rights.
+func (app *App) IsAdmin(ctx context.Context, userID int32) (bool, error) {
+	return app.db.IsUserAdmin(ctx, userID)
+}
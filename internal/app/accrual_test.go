@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestMonthlyAccrual_OncePerMonth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	fakeClock := clock.NewFake(time.Date(2025, 1, 31, 23, 0, 0, 0, time.UTC))
+	accrual := NewMonthlyAccrual(mockDB, 100, time.Hour, fakeClock, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	january := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	february := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mockDB.EXPECT().AccrueMonthlyCoins(ctx, january, 100).Return(0, storage.ErrAccrualAlreadyDone)
+	accrual.accrueCurrent(ctx)
+
+	fakeClock.Advance(30 * time.Minute)
+	accrual.accrueCurrent(ctx)
+
+	fakeClock.Advance(time.Hour)
+	mockDB.EXPECT().AccrueMonthlyCoins(ctx, february, 100).Return(3, nil)
+	accrual.accrueCurrent(ctx)
+	accrual.accrueCurrent(ctx)
+}
+
+func TestMonthlyAccrual_RetriesFailedMonth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	fakeClock := clock.NewFake(time.Date(2025, 3, 1, 0, 5, 0, 0, time.UTC))
+	accrual := NewMonthlyAccrual(mockDB, 100, time.Hour, fakeClock, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	gomock.InOrder(
+		mockDB.EXPECT().AccrueMonthlyCoins(ctx, march, 100).Return(0, context.DeadlineExceeded),
+		mockDB.EXPECT().AccrueMonthlyCoins(ctx, march, 100).Return(5, nil),
+	)
+	accrual.accrueCurrent(ctx)
+	accrual.accrueCurrent(ctx)
+	accrual.accrueCurrent(ctx)
+}
+
+func TestProcessAccrual(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	fakeClock := clock.NewFake(time.Date(2025, 5, 17, 10, 0, 0, 0, time.UTC))
+	app := NewApp(mockDB, l)
+	app.SetClock(fakeClock)
+	ctx := context.Background()
+
+	_, err := app.ProcessAccrual(ctx, "")
+	assert.ErrorIs(t, err, ErrAccrualDisabled)
+
+	app.SetMonthlyAccrual(NewMonthlyAccrual(mockDB, 100, time.Hour, fakeClock, l))
+
+	mockDB.EXPECT().AccrueMonthlyCoins(ctx, time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), 100).Return(7, nil)
+	accrual, err := app.ProcessAccrual(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-05", accrual.Period)
+	assert.Equal(t, 7, accrual.UsersCredited)
+
+	mockDB.EXPECT().AccrueMonthlyCoins(ctx, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), 100).Return(0, storage.ErrAccrualAlreadyDone)
+	_, err = app.ProcessAccrual(ctx, "2025-04")
+	assert.ErrorIs(t, err, storage.ErrAccrualAlreadyDone)
+
+	_, err = app.ProcessAccrual(ctx, "April")
+	assert.ErrorIs(t, err, ErrInvalidAccrualPeriod)
+}
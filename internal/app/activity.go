@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// Settings of the API activity of users.
+const (
+	DefaultActivityPageSize = 50
+	MaxActivityPageSize     = 200
+	activityWriteLimit      = 5 * time.Second // Timeout of writing a single request.
+
+	// activityCursorList binds activity cursors to the activity list, so that transfer cursors are rejected.
+	activityCursorList = "activity"
+)
+
+// ActivityRecorder writes the API requests of users to storage in the background,
+// so that recording them neither delays nor affects the responses.
+// Requests are buffered in memory; when the buffer is full new requests are dropped and logged.
+type ActivityRecorder struct {
+	db      storage.Storage
+	log     *logger.Logger
+	entries chan models.APIActivity
+}
+
+// NewActivityRecorder creates an ActivityRecorder buffering up to capacity requests.
+func NewActivityRecorder(db storage.Storage, capacity int, l *logger.Logger) *ActivityRecorder {
+	return &ActivityRecorder{db: db, log: l, entries: make(chan models.APIActivity, capacity)}
+}
+
+// Record queues a request for writing without blocking the caller.
+func (recorder *ActivityRecorder) Record(activity models.APIActivity) {
+	select {
+	case recorder.entries <- activity:
+	default:
+		recorder.log.Sugar().Warnf("API activity buffer is full, dropping %s of user %d", activity.Action, activity.UserID)
+	}
+}
+
+// Run writes queued requests until ctx is canceled, then writes the ones still buffered.
+// It implements worker.Worker.
+func (recorder *ActivityRecorder) Run(ctx context.Context) error {
+	for {
+		select {
+		case activity := <-recorder.entries:
+			recorder.write(ctx, activity)
+		case <-ctx.Done():
+			recorder.flush()
+			return ctx.Err()
+		}
+	}
+}
+
+// flush writes the requests buffered at shutdown.
+func (recorder *ActivityRecorder) flush() {
+	for {
+		select {
+		case activity := <-recorder.entries:
+			recorder.write(context.Background(), activity)
+		default:
+			return
+		}
+	}
+}
+
+// write stores a single request, logging rather than returning errors: the activity log must not stop the worker.
+func (recorder *ActivityRecorder) write(ctx context.Context, activity models.APIActivity) {
+	ctx, cancel := context.WithTimeout(ctx, activityWriteLimit)
+	defer cancel()
+
+	if err := recorder.db.RecordAPIActivity(ctx, activity); err != nil {
+		recorder.log.Sugar().Errorf("Failed to record %s of user %d: %s", activity.Action, activity.UserID, err)
+	}
+}
+
+// SetActivityRecorder enables recording of the API requests of users.
+func (app *App) SetActivityRecorder(recorder *ActivityRecorder) {
+	app.activity = recorder
+}
+
+// RecordActivity passes an API request of a user to the recorder, timestamped now; it does nothing when
+// recording is disabled.
+func (app *App) RecordActivity(activity models.APIActivity) {
+	if app.activity == nil {
+		return
+	}
+
+	activity.CreatedAt = app.Now()
+	app.activity.Record(activity)
+}
+
+// ProcessUserActivity returns a page of the user's API requests between the inclusive YYYY-MM-DD dates from and to
+// (UTC), defaulting as for ProcessFailedPurchaseStats, newest first. The limit is clamped to MaxActivityPageSize and
+// defaults to DefaultActivityPageSize when zero. An empty cursor selects the first page; the returned NextCursor
+// selects the following one and is accepted only for the same user.
+func (app *App) ProcessUserActivity(ctx context.Context, userID int32, from string, to string, limit int, cursor string) (*models.UserActivityResponse, error) {
+	fromDate, toDate, err := app.parseStatsRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	limit = clampPageLimit(limit, DefaultActivityPageSize, MaxActivityPageSize)
+
+	filter := models.ActivityFilter{From: fromDate, To: toDate.AddDate(0, 0, 1), Limit: limit + 1}
+	if cursor != "" {
+		after, err := decodePageCursor(cursor, userID, activityCursorList)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	activity, err := app.db.GetUserActivity(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.UserActivityResponse{
+		From:     fromDate.Format(statsDateLayout),
+		To:       toDate.Format(statsDateLayout),
+		Activity: activity,
+		PageMeta: models.PageMeta{Limit: limit},
+	}
+	if len(activity) > limit {
+		response.Activity = activity[:limit]
+		last := response.Activity[limit-1]
+		response.NextCursor, err = encodePageCursor(userID, activityCursorList, models.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessUserActivity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(time.Date(2025, 3, 31, 18, 0, 0, 0, time.UTC)))
+	ctx := context.Background()
+
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+	page := []models.APIActivity{
+		{ID: 3, UserID: 1, Action: "GET /api/info", Path: "/api/info", Status: 200, IP: "203.0.113.7", CreatedAt: now},
+		{ID: 2, UserID: 1, Action: "GET /api/buy/{item}", Path: "/api/buy/cup", Status: 400, IP: "203.0.113.7", CreatedAt: now.Add(-time.Second)},
+		{ID: 1, UserID: 1, Action: "GET /api/info", Path: "/api/info", Status: 200, IP: "203.0.113.7", CreatedAt: now.Add(-2 * time.Second)},
+	}
+	from, to := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	mockDB.EXPECT().GetUserActivity(ctx, int32(1), models.ActivityFilter{From: from, To: to, Limit: 3}).Return(page, nil)
+	first, err := app.ProcessUserActivity(ctx, 1, "", "", 2, "")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-03-02", first.From)
+	assert.Equal(t, "2025-03-31", first.To)
+	assert.Equal(t, page[:2], first.Activity)
+	require.NotEmpty(t, first.NextCursor)
+
+	after := &models.PageCursor{CreatedAt: page[1].CreatedAt, ID: page[1].ID}
+	mockDB.EXPECT().GetUserActivity(ctx, int32(1), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, userID int32, filter models.ActivityFilter) ([]models.APIActivity, error) {
+			require.NotNil(t, filter.After)
+			assert.True(t, after.CreatedAt.Equal(filter.After.CreatedAt))
+			assert.Equal(t, after.ID, filter.After.ID)
+			return page[2:], nil
+		})
+	second, err := app.ProcessUserActivity(ctx, 1, "", "", 2, first.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, page[2:], second.Activity)
+	assert.Empty(t, second.NextCursor)
+
+	_, err = app.ProcessUserActivity(ctx, 2, "", "", 2, first.NextCursor)
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor must not be usable by another user")
+
+	transferCursor, err := encodePageCursor(1, "all", *after)
+	require.NoError(t, err)
+	_, err = app.ProcessUserActivity(ctx, 1, "", "", 2, transferCursor)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	mockDB.EXPECT().GetUserActivity(ctx, int32(1), models.ActivityFilter{
+		From: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC), Limit: MaxActivityPageSize + 1,
+	}).Return([]models.APIActivity{}, nil)
+	_, err = app.ProcessUserActivity(ctx, 1, "2025-01-10", "2025-01-10", 1000, "")
+	require.NoError(t, err)
+
+	_, err = app.ProcessUserActivity(ctx, 1, "2025-02-01", "2025-01-01", 0, "")
+	assert.ErrorIs(t, err, ErrInvalidDateRange)
+}
+
+func TestActivityRecorder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 4, 2, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, l)
+	app.SetClock(clock.NewFake(now))
+
+	app.RecordActivity(models.APIActivity{UserID: 1, Action: "GET /api/info"})
+
+	recorder := NewActivityRecorder(mockDB, 1, l)
+	app.SetActivityRecorder(recorder)
+	app.RecordActivity(models.APIActivity{UserID: 1, Action: "GET /api/info", Path: "/api/info", Status: 200})
+	app.RecordActivity(models.APIActivity{UserID: 2, Action: "GET /api/info", Path: "/api/info", Status: 200})
+
+	mockDB.EXPECT().RecordAPIActivity(gomock.Any(), models.APIActivity{UserID: 1, Action: "GET /api/info", Path: "/api/info", Status: 200, CreatedAt: now}).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, recorder.Run(ctx), context.Canceled)
+	assert.Empty(t, recorder.entries, "activity beyond the buffer is dropped and buffered activity flushed on stop")
+}
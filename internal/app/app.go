@@ -9,8 +9,14 @@ import (
 	"errors"
 	"merch_store/internal/models"
 	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/featureflag"
 	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/metrics"
 	"merch_store/internal/storage"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Predefined errors for missing required parameters in requests.
@@ -19,23 +25,81 @@ var (
 	ErrMissingUsernameOrPassword = errors.New("app: missing username or password")
 	// ErrMissingUsernameOrAmount indicates that either the recipient username or amount is not provided.
 	ErrMissingUsernameOrAmount = errors.New("app: missing user or amount")
+	// ErrMissingRecipient indicates that the recipient of a gift is not provided.
+	ErrMissingRecipient = errors.New("app: missing recipient")
 )
 
+// defaultCoins is the balance of a newly registered user.
+const defaultCoins = 1000
+
 // App encapsulates the application logic and dependencies required to process requests.
 // It interacts with the storage layer and uses a logger for error and activity logging.
 type App struct {
-	db  storage.Storage // Database storage layer for persistent data operations.
-	log *logger.Logger  // Logger for logging application events and errors.
+	db    storage.Storage // Database storage layer for persistent data operations.
+	log   *logger.Logger  // Logger for logging application events and errors.
+	queue *PurchaseQueue  // Optional queue serializing purchases of flash-sale items.
+
+	activeUsers *activeUserCache // Optional cache of users confirmed to be active, set when user validation is enabled.
+	clock       clock.Clock      // Source of the current time for time-window logic.
+	accrual     *MonthlyAccrual  // Optional monthly coin accrual, triggered manually by administrators.
+
+	failedPurchases *FailedPurchaseRecorder // Optional recorder of failed purchases for analytics.
+	activity        *ActivityRecorder       // Optional recorder of the API requests of users.
+	sessionLimit    int                     // Maximum number of active sessions per user; zero disables session tracking.
+
+	registrationMode RegistrationMode // How unknown usernames are handled on sign-in.
+
+	flags *featureflag.Flags // Feature flags evaluated per request; nil evaluates every flag to its default.
+
+	personalTokens personalTokenCache // Recently resolved personal access tokens.
+	economyStats   economyStatsCache  // Recently computed economy statistics.
+
+	purchaseDebounce *purchaseDebouncer // Optional rejection of repeated purchases of the same item, set by SetPurchaseDebounce.
+
+	registrationCooldown *registrationCooldown // Optional rejection of registrations in quick succession from a client address, set by SetRegistrationCooldown.
+
+	transferConfirmations *transferConfirmations // Optional confirmation of large transfers, set by SetTransferConfirmation.
+	showRecipientBalance  bool                   // Whether transfer previews disclose the balance of the recipient.
+	termsVersion          int                    // Current version of the terms of service; zero requires no acceptance.
+
+	infoHistoryThreshold int // Number of transfers beyond which ProcessInfo truncates the history; zero never truncates.
+	infoHistoryLimit     int // Number of most recent transfers per direction returned in a truncated history.
+
+	events *EventBroker // Optional event stream of committed purchases and transfers, set by SetEventBroker.
+
+	replica       storage.Storage // Optional storage of a read replica, set by SetReadReplica.
+	recentWriters *recentWriters  // Users whose reads go to the primary for now, set with the replica.
 }
 
 // NewApp creates and returns a new instance of App with the provided storage and logger dependencies.
 func NewApp(db storage.Storage, log *logger.Logger) *App {
-	return &App{db: db, log: log}
+	return &App{db: db, log: log, clock: clock.Real{}, registrationMode: RegistrationOpen}
+}
+
+// SetClock replaces the source of the current time, allowing tests to control time windows.
+func (app *App) SetClock(c clock.Clock) {
+	app.clock = c
+}
+
+// Now returns the current time of the app's clock in UTC.
+func (app *App) Now() time.Time {
+	return app.clock.Now().UTC()
+}
+
+// SetPurchaseQueue enables queued purchases for the items handled by the given queue.
+func (app *App) SetPurchaseQueue(queue *PurchaseQueue) {
+	app.queue = queue
 }
 
 // ProcessAuth handles user authentication by verifying credentials and generating a token.
-// If the user does not exist, it creates a new user with a default coin balance.
+// If the user does not exist, it creates a new user with a default coin balance as allowed by the registration mode:
+// always when registration is open, never when it is closed, and only with a valid invite code when it is invite-only.
+// Open registrations may additionally be throttled per client address (see SetRegistrationCooldown).
+// When session tracking is enabled, the token is registered as a new session of the user.
+// Successful sign-ins and wrong passwords are counted in the authentication metrics. Usernames differing only in
+// whitespace name the same user (see models.NormalizeUsername); a username of whitespace only counts as missing.
 func (app *App) ProcessAuth(ctx context.Context, req models.AuthRequest) (string, error) {
+	req.Username = models.NormalizeUsername(req.Username)
 	if req.Username == "" || req.Password == "" {
 		return "", ErrMissingUsernameOrPassword
 	}
@@ -46,58 +110,260 @@ func (app *App) ProcessAuth(ctx context.Context, req models.AuthRequest) (string
 	}
 
 	user, err := app.db.CheckUser(ctx, user)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		metrics.AuthOutcomes.Inc(metrics.AuthOutcomeBadPassword)
+	}
 	if err != nil {
 		return "", err
 	}
 
+	outcome := metrics.AuthOutcomeLogin
 	if user.ID == 0 {
-		user.Coins = 1000
-		user, err = app.db.CreateUser(ctx, user)
+		user.Coins = defaultCoins
+		user, err = app.registerUser(ctx, user, req.InviteCode, req.ClientIP)
 		if err != nil {
 			return "", err
 		}
+		outcome = metrics.AuthOutcomeRegistration
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	token, err := auth.IssueVersionedToken(user.ID, user.TokenVersion)
 	if err != nil {
 		return "", err
 	}
 
-	return token, nil
+	if err = app.registerSession(ctx, user.ID, token, req.UserAgent); err != nil {
+		return "", err
+	}
+
+	metrics.AuthOutcomes.Inc(outcome)
+	metrics.TokensIssued.Inc()
+	return token.Token, nil
 }
 
 // ProcessBuy processes the purchase of an item for a given user by delegating to the storage layer.
-func (app *App) ProcessBuy(ctx context.Context, userID int32, itemName string) error {
-	err := app.db.BuyItem(ctx, userID, itemName)
+// Purchases failing for lack of funds or an unknown item are recorded asynchronously for analytics.
+// Under storage.WithDryRun the purchase is validated and rolled back, and nothing is recorded.
+// With purchase debouncing enabled, repeating a purchase of the same item within the window fails with
+// ErrDuplicatePurchase unless the context is marked by WithDuplicateConfirmed; failed purchases do not count.
+// Committed purchases are published to the event stream of the user.
+// It returns ErrTermsNotAccepted when the user has not accepted the current terms of service.
+func (app *App) ProcessBuy(ctx context.Context, userID int32, itemName string) (*models.PurchaseResult, error) {
+	purchase, err := app.buy(ctx, userID, itemName, func(ctx context.Context) (*models.PurchaseResult, error) {
+		return app.db.BuyItem(ctx, userID, itemName)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !purchase.DryRun {
+		app.publishPurchase(userID, purchase)
+	}
+	return purchase, nil
+}
+
+// buy runs a purchase of the item by the user with the checks, the debouncing, and the failure analytics shared by
+// all purchases, as described on ProcessBuy. The purchase itself is made by purchase; committed purchases are left
+// to the caller to publish.
+func (app *App) buy(ctx context.Context, userID int32, itemName string, purchase func(ctx context.Context) (*models.PurchaseResult, error)) (*models.PurchaseResult, error) {
+	if err := app.ensureTermsAccepted(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	debounced := app.purchaseDebounce != nil && !storage.IsDryRun(ctx)
+	now := app.Now()
+	if debounced && !app.purchaseDebounce.claim(userID, itemName, now, isDuplicateConfirmed(ctx)) {
+		return nil, ErrDuplicatePurchase
+	}
+
+	result, err := purchase(ctx)
+	if err != nil {
+		if debounced {
+			app.purchaseDebounce.release(userID, itemName, now)
+		}
+		if !storage.IsDryRun(ctx) {
+			app.recordFailedPurchase(userID, itemName, err)
+		}
+		return nil, err
+	}
+
+	result.DryRun = storage.IsDryRun(ctx)
+	if result.DryRun {
+		// The purchase was rolled back, so its receipt number was never issued.
+		result.ReceiptNumber = ""
+	} else {
+		app.recordWrite(userID)
+	}
+	return result, nil
+}
+
+// ProcessItemByID returns the item with the ID, so that purchases addressed by item ID can be made by name
+// like any other. It returns storage.ErrItemNotFound when there is no such item.
+func (app *App) ProcessItemByID(ctx context.Context, itemID int) (*models.Item, error) {
+	return app.db.GetItemByID(ctx, itemID)
+}
+
+// IsQueuedItem reports whether purchases of the item must go through the flash-sale queue.
+// Queueing is controlled per user by the featureflag.PurchaseQueue flag.
+func (app *App) IsQueuedItem(ctx context.Context, itemName string) bool {
+	return app.queue != nil && app.queue.IsQueued(itemName) && app.flags.IsEnabled(ctx, featureflag.PurchaseQueue)
+}
+
+// ProcessQueuedBuy places the purchase of a flash-sale item into its queue.
+// It returns a ticket the user polls to learn the outcome of the purchase, or ErrTermsNotAccepted when the user
+// has not accepted the current terms of service.
+func (app *App) ProcessQueuedBuy(ctx context.Context, userID int32, itemName string) (*models.QueueTicket, error) {
+	if app.queue == nil {
+		return nil, ErrItemNotQueued
+	}
+	if err := app.ensureTermsAccepted(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return app.queue.Enqueue(userID, itemName)
+}
+
+// ProcessBuyStatus returns the state of a queued purchase owned by the user.
+func (app *App) ProcessBuyStatus(userID int32, token string) (*QueuedPurchase, error) {
+	if app.queue == nil {
+		return nil, ErrQueueTicketNotFound
+	}
+
+	return app.queue.Status(userID, token)
+}
+
+// ProcessGift handles the purchase of an item by a user as a gift for another user.
+// It validates the request and then processes the purchase via the storage layer.
+// It returns ErrTermsNotAccepted when the user has not accepted the current terms of service.
+func (app *App) ProcessGift(ctx context.Context, userID int32, itemName string, req models.GiftRequest) error {
+	if req.ToUser == "" {
+		return ErrMissingRecipient
+	}
+	if err := app.ensureTermsAccepted(ctx, userID); err != nil {
+		return err
+	}
+
+	err := app.db.GiftItem(ctx, userID, itemName, req)
 	if err != nil {
 		return err
 	}
 
+	app.recordWrite(userID)
 	return nil
 }
 
 // ProcessSendCoin handles the coin transfer from one user to another.
-// It validates the request and then processes the coin transfer via the storage layer.
-func (app *App) ProcessSendCoin(ctx context.Context, userID int32, req models.SendCoinRequest) error {
+// It validates the request, processes the coin transfer via the storage layer, and returns the ID of the transfer.
+// Under storage.WithDryRun the transfer is validated and rolled back. Committed transfers are published to
+// the event streams of the sender and the recipient. It returns ErrTermsNotAccepted when the user has not accepted
+// the current terms of service.
+func (app *App) ProcessSendCoin(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.SendCoinResponse, error) {
 	if req.ToUser == "" || req.Amount == 0 {
-		return ErrMissingUsernameOrAmount
+		return nil, ErrMissingUsernameOrAmount
+	}
+
+	if err := app.ensureTermsAccepted(ctx, userID); err != nil {
+		return nil, err
 	}
 
-	err := app.db.TransferCoins(ctx, userID, req)
+	transfer, err := app.db.TransferCoins(ctx, userID, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	if storage.IsDryRun(ctx) {
+		return &models.SendCoinResponse{DryRun: true}, nil
+	}
+
+	app.recordWrite(userID)
+	app.publishTransfer(ctx, userID, req, transfer.TransferID)
+
+	return &models.SendCoinResponse{TransferID: transfer.TransferID, RemainingCoins: transfer.RemainingCoins}, nil
+}
+
+// SetInfoHistoryLimit makes ProcessInfo return only the limit most recent sent and received transfers of users
+// with more than threshold transfers in total, so that a long history neither times out nor loads the database.
+// A zero threshold disables truncation.
+func (app *App) SetInfoHistoryLimit(threshold, limit int) {
+	app.infoHistoryThreshold = threshold
+	app.infoHistoryLimit = limit
 }
 
 // ProcessInfo retrieves detailed information about a user's account.
 // It queries the storage layer for information such as coin balance and other user-specific details.
+// When the history is longer than set by SetInfoHistoryLimit, only its most recent transfers are returned and
+// the response is flagged as truncated (see storage.GetInfoWithHistoryLimit).
+// The inventory and both transfer lists of the returned response are never nil.
 func (app *App) ProcessInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
-	infoResponse, err := app.db.GetInfo(ctx, userID)
+	infoResponse, err := app.getInfo(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return infoResponse, nil
+	return withEmptyInfoSections(infoResponse), nil
+}
+
+// getInfo loads the information of ProcessInfo, counting the history first when truncation is enabled.
+func (app *App) getInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
+	db := app.reader(userID)
+	if app.infoHistoryThreshold <= 0 {
+		return db.GetInfo(ctx, userID)
+	}
+
+	sent, received, err := db.CountCoinHistory(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sent+received <= int64(app.infoHistoryThreshold) {
+		return db.GetInfo(ctx, userID)
+	}
+
+	return db.GetInfoWithHistoryLimit(ctx, userID, app.infoHistoryLimit)
+}
+
+// ProcessPartialInfo retrieves the same information as ProcessInfo, but returns whatever could be loaded when
+// sections other than the balance fail, naming the missing ones in Warnings (see storage.GetPartialInfo).
+// It fails only when the balance cannot be loaded.
+func (app *App) ProcessPartialInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
+	infoResponse, err := app.reader(userID).GetPartialInfo(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return withEmptyInfoSections(infoResponse), nil
+}
+
+// withEmptyInfoSections replaces the nil inventory and transfer lists of the response with empty ones.
+func withEmptyInfoSections(infoResponse *models.InfoResponse) *models.InfoResponse {
+	if infoResponse.Inventory == nil {
+		infoResponse.Inventory = []models.InventoryItem{}
+	}
+	if infoResponse.CoinHistory.Received == nil {
+		infoResponse.CoinHistory.Received = []models.TransactionDetail{}
+	}
+	if infoResponse.CoinHistory.Sent == nil {
+		infoResponse.CoinHistory.Sent = []models.TransactionDetail{}
+	}
+
+	return infoResponse
+}
+
+// ProcessCoinHistory passes every coin transfer of the user to fn, newest first, without loading the whole history.
+func (app *App) ProcessCoinHistory(ctx context.Context, userID int32, fn func(models.TransactionDetail) error) error {
+	return app.reader(userID).StreamCoinHistory(ctx, userID, fn)
+}
+
+// ProcessCatalog retrieves the public merch catalog with item names and prices.
+func (app *App) ProcessCatalog(ctx context.Context) ([]models.CatalogItem, error) {
+	return app.db.GetMerchCatalog(ctx)
+}
+
+// ProcessCatalogWithAffordability retrieves the merch catalog with the affordability of each item for the user.
+func (app *App) ProcessCatalogWithAffordability(ctx context.Context, userID int32) ([]models.AffordableCatalogItem, error) {
+	return app.reader(userID).GetCatalogWithAffordability(ctx, userID)
+}
+
+// ProcessCatalogLastModified returns when the merch catalog last changed.
+func (app *App) ProcessCatalogLastModified(ctx context.Context) (time.Time, error) {
+	return app.db.GetCatalogLastModified(ctx)
 }
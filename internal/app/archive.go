@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// transferArchiveBatchSize is the number of transfers moved to the archive by one transaction of the TransferArchiver.
+const transferArchiveBatchSize = 1000
+
+// TransferArchiver periodically moves the transfers older than its age to the archive (see
+// storage.PostgreSQL.ArchiveTransfers), so that history scans only read the recent ones.
+type TransferArchiver struct {
+	db       storage.Storage
+	log      *logger.Logger
+	clock    clock.Clock
+	age      time.Duration
+	interval time.Duration
+}
+
+// NewTransferArchiver creates a TransferArchiver archiving the transfers older than age every interval.
+func NewTransferArchiver(db storage.Storage, age time.Duration, interval time.Duration, c clock.Clock, l *logger.Logger) *TransferArchiver {
+	return &TransferArchiver{db: db, log: l, clock: c, age: age, interval: interval}
+}
+
+// Run archives the old transfers on start and then every interval, until ctx is canceled.
+// It implements worker.Worker.
+func (archiver *TransferArchiver) Run(ctx context.Context) error {
+	ticker := time.NewTicker(archiver.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := archiver.Archive(ctx); err != nil && ctx.Err() == nil {
+			archiver.log.Sugar().Errorf("Failed to archive old transfers: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Archive moves the transfers older than the archiver's age to the archive in batches of transferArchiveBatchSize,
+// until a batch comes out short, and returns how many it moved. The age is measured from the start of the run, so
+// transfers aging meanwhile wait for the next one. On error the batches already moved stay archived.
+func (archiver *TransferArchiver) Archive(ctx context.Context) (int64, error) {
+	before := archiver.clock.Now().Add(-archiver.age)
+
+	var total int64
+	for {
+		moved, err := archiver.db.ArchiveTransfers(ctx, before, transferArchiveBatchSize)
+		total += moved
+		if err != nil {
+			return total, err
+		}
+		if moved < transferArchiveBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		archiver.log.Sugar().Infof("Archived %d transfers created before %s", total, before.UTC().Format(time.RFC3339))
+	}
+	return total, nil
+}
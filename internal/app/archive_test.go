@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestTransferArchiver_Archive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	const age = 365 * 24 * time.Hour
+	archiver := NewTransferArchiver(mockDB, age, time.Hour, clock.NewFake(now), &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+	before := now.Add(-age)
+
+	t.Run("Batches until a short one", func(t *testing.T) {
+		gomock.InOrder(
+			mockDB.EXPECT().ArchiveTransfers(ctx, before, transferArchiveBatchSize).Return(int64(transferArchiveBatchSize), nil),
+			mockDB.EXPECT().ArchiveTransfers(ctx, before, transferArchiveBatchSize).Return(int64(transferArchiveBatchSize), nil),
+			mockDB.EXPECT().ArchiveTransfers(ctx, before, transferArchiveBatchSize).Return(int64(7), nil),
+		)
+		moved, err := archiver.Archive(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2*transferArchiveBatchSize+7), moved)
+	})
+
+	t.Run("Nothing to archive", func(t *testing.T) {
+		mockDB.EXPECT().ArchiveTransfers(ctx, before, transferArchiveBatchSize).Return(int64(0), nil)
+		moved, err := archiver.Archive(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, moved)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		failure := errors.New("connection refused")
+		gomock.InOrder(
+			mockDB.EXPECT().ArchiveTransfers(ctx, before, transferArchiveBatchSize).Return(int64(transferArchiveBatchSize), nil),
+			mockDB.EXPECT().ArchiveTransfers(ctx, before, transferArchiveBatchSize).Return(int64(0), failure),
+		)
+		moved, err := archiver.Archive(ctx)
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, int64(transferArchiveBatchSize), moved, "the batches moved before the error must be reported")
+	})
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/security"
+)
+
+// MaxBulkUsers is the largest number of users that can be provisioned in one request.
+const MaxBulkUsers = 200
+
+// Predefined errors for bulk user provisioning.
+var (
+	// ErrInvalidBulkSize indicates that the request provisions no users or more than MaxBulkUsers.
+	ErrInvalidBulkSize = errors.New("app: invalid number of users to provision")
+	// ErrInvalidBulkUser indicates that a requested user has an empty username or a negative balance.
+	ErrInvalidBulkUser = errors.New("app: invalid user to provision")
+)
+
+// ProcessBulkUsers creates the requested users in one transaction with generated passwords,
+// returned in the response and not retrievable later. Usernames that already exist are skipped,
+// as are repetitions of a username within the request, and reported with their own status.
+func (app *App) ProcessBulkUsers(ctx context.Context, req models.BulkUsersRequest) (*models.BulkUsersResponse, error) {
+	if len(req.Users) == 0 || len(req.Users) > MaxBulkUsers {
+		return nil, ErrInvalidBulkSize
+	}
+
+	response := &models.BulkUsersResponse{Users: make([]models.BulkUserResult, len(req.Users))}
+	users := make([]models.User, 0, len(req.Users))
+	seen := make(map[string]bool, len(req.Users))
+	for i, requested := range req.Users {
+		requested.Username = models.NormalizeUsername(requested.Username)
+		if requested.Username == "" || (requested.Coins != nil && *requested.Coins < 0) {
+			return nil, ErrInvalidBulkUser
+		}
+
+		response.Users[i] = models.BulkUserResult{Username: requested.Username, Status: models.BulkUserExists}
+		if seen[requested.Username] {
+			response.Users[i].Status = models.BulkUserDuplicate
+			continue
+		}
+		seen[requested.Username] = true
+
+		password, err := security.GeneratePassword()
+		if err != nil {
+			return nil, err
+		}
+		user := models.User{Username: requested.Username, Password: password, Coins: defaultCoins}
+		if requested.Coins != nil {
+			user.Coins = *requested.Coins
+		}
+		users = append(users, user)
+	}
+
+	created, err := app.db.CreateUsersBulk(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords := make(map[string]string, len(created))
+	for _, user := range created {
+		passwords[user.Username] = user.Password
+	}
+	for i := range response.Users {
+		result := &response.Users[i]
+		if password, ok := passwords[result.Username]; ok && result.Status == models.BulkUserExists {
+			result.Status = models.BulkUserCreated
+			result.Password = password
+		}
+	}
+
+	return response, nil
+}
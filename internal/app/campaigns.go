@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"merch_store/internal/models"
+)
+
+// Limits of gifting campaigns.
+const (
+	maxCampaignNameLength = 100
+	maxCampaignMultiplier = 10
+)
+
+// Predefined errors for gifting campaigns.
+var (
+	// ErrInvalidCampaignName indicates that the campaign name is empty or longer than 100 characters.
+	ErrInvalidCampaignName = errors.New("app: campaign name must be between 1 and 100 characters")
+	// ErrInvalidCampaignMultiplier indicates that the multiplier is not above 1 and at most 10 with two decimal places.
+	ErrInvalidCampaignMultiplier = errors.New("app: campaign multiplier must be above 1 and at most 10, with at most two decimal places")
+	// ErrInvalidCampaignBudget indicates that the campaign budget is zero.
+	ErrInvalidCampaignBudget = errors.New("app: campaign budget must be positive")
+	// ErrInvalidCampaignWindow indicates that the start or the end is not an RFC 3339 timestamp or the end is not after the start.
+	ErrInvalidCampaignWindow = errors.New("app: campaign startsAt and endsAt must be RFC 3339 times, endsAt after startsAt")
+)
+
+// ProcessCreateCampaign validates and creates a gifting campaign with its whole budget remaining.
+func (app *App) ProcessCreateCampaign(ctx context.Context, req models.CampaignRequest) (*models.Campaign, error) {
+	campaign, err := parseCampaignRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.db.CreateCampaign(ctx, *campaign)
+}
+
+// ProcessCampaigns lists the gifting campaigns, the latest to start first.
+func (app *App) ProcessCampaigns(ctx context.Context) (*models.CampaignsResponse, error) {
+	campaigns, err := app.db.GetCampaigns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CampaignsResponse{Campaigns: campaigns}, nil
+}
+
+// ProcessCampaign returns the gifting campaign with the given ID, or storage.ErrCampaignNotFound.
+func (app *App) ProcessCampaign(ctx context.Context, campaignID int64) (*models.Campaign, error) {
+	return app.db.GetCampaign(ctx, campaignID)
+}
+
+// ProcessUpdateCampaign validates the request and replaces the settings of the campaign with it, keeping the bonuses
+// already paid. A campaign is ended early by moving its end to now. It returns storage.ErrCampaignNotFound for an
+// unknown campaign and storage.ErrCampaignBudgetSpent when the new budget does not cover the bonuses already paid.
+func (app *App) ProcessUpdateCampaign(ctx context.Context, campaignID int64, req models.CampaignRequest) (*models.Campaign, error) {
+	campaign, err := parseCampaignRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	campaign.ID = campaignID
+
+	return app.db.UpdateCampaign(ctx, *campaign)
+}
+
+// ProcessDeleteCampaign deletes a campaign that has not paid any bonus. It returns storage.ErrCampaignNotFound for an
+// unknown campaign and storage.ErrCampaignInUse for a campaign that has.
+func (app *App) ProcessDeleteCampaign(ctx context.Context, campaignID int64) error {
+	return app.db.DeleteCampaign(ctx, campaignID)
+}
+
+// parseCampaignRequest validates the request and returns the campaign it describes.
+func parseCampaignRequest(req models.CampaignRequest) (*models.Campaign, error) {
+	if req.Name == "" || len([]rune(req.Name)) > maxCampaignNameLength {
+		return nil, ErrInvalidCampaignName
+	}
+
+	percent := math.Round(req.Multiplier * 100)
+	if percent <= 100 || percent > maxCampaignMultiplier*100 || math.Abs(req.Multiplier*100-percent) > 1e-6 {
+		return nil, ErrInvalidCampaignMultiplier
+	}
+
+	if req.Budget <= 0 {
+		return nil, ErrInvalidCampaignBudget
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+	if err != nil {
+		return nil, ErrInvalidCampaignWindow
+	}
+	endsAt, err := time.Parse(time.RFC3339, req.EndsAt)
+	if err != nil || !endsAt.After(startsAt) {
+		return nil, ErrInvalidCampaignWindow
+	}
+
+	return &models.Campaign{
+		Name:       req.Name,
+		Multiplier: percent / 100,
+		Budget:     int64(req.Budget),
+		StartsAt:   startsAt.UTC(),
+		EndsAt:     endsAt.UTC(),
+	}, nil
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessCreateCampaign(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	valid := models.CampaignRequest{Name: "Kudos week", Multiplier: 2, Budget: 10000, StartsAt: "2025-06-02T09:00:00+03:00", EndsAt: "2025-06-09T09:00:00+03:00"}
+
+	t.Run("Valid", func(t *testing.T) {
+		req := valid
+		req.Multiplier = 1.25
+		expected := models.Campaign{
+			Name: "Kudos week", Multiplier: 1.25, Budget: 10000,
+			StartsAt: time.Date(2025, 6, 2, 6, 0, 0, 0, time.UTC), EndsAt: time.Date(2025, 6, 9, 6, 0, 0, 0, time.UTC),
+		}
+		created := expected
+		created.ID, created.RemainingBudget = 1, 10000
+		mockDB.EXPECT().CreateCampaign(ctx, expected).Return(&created, nil)
+
+		campaign, err := app.ProcessCreateCampaign(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, &created, campaign)
+	})
+
+	testCases := []struct {
+		name   string
+		modify func(req *models.CampaignRequest)
+		err    error
+	}{
+		{name: "Empty name", modify: func(req *models.CampaignRequest) { req.Name = "" }, err: ErrInvalidCampaignName},
+		{name: "Long name", modify: func(req *models.CampaignRequest) { req.Name = strings.Repeat("к", 101) }, err: ErrInvalidCampaignName},
+		{name: "No bonus", modify: func(req *models.CampaignRequest) { req.Multiplier = 1 }, err: ErrInvalidCampaignMultiplier},
+		{name: "Multiplier too high", modify: func(req *models.CampaignRequest) { req.Multiplier = 10.5 }, err: ErrInvalidCampaignMultiplier},
+		{name: "Three decimal places", modify: func(req *models.CampaignRequest) { req.Multiplier = 1.125 }, err: ErrInvalidCampaignMultiplier},
+		{name: "Zero budget", modify: func(req *models.CampaignRequest) { req.Budget = 0 }, err: ErrInvalidCampaignBudget},
+		{name: "Malformed start", modify: func(req *models.CampaignRequest) { req.StartsAt = "tomorrow" }, err: ErrInvalidCampaignWindow},
+		{name: "End before start", modify: func(req *models.CampaignRequest) { req.StartsAt, req.EndsAt = req.EndsAt, req.StartsAt }, err: ErrInvalidCampaignWindow},
+		{name: "Empty window", modify: func(req *models.CampaignRequest) { req.EndsAt = req.StartsAt }, err: ErrInvalidCampaignWindow},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := valid
+			tc.modify(&req)
+
+			_, err := app.ProcessCreateCampaign(ctx, req)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"merch_store/internal/models"
+)
+
+// ErrUnknownCategory indicates that no item of the catalog is in the requested category.
+var ErrUnknownCategory = errors.New("app: unknown category")
+
+// ProcessCatalogCategory retrieves the items of the merch catalog in category, in catalog order. It returns
+// ErrUnknownCategory when no item is in the category; uncategorized items are only listed by ProcessCatalog.
+func (app *App) ProcessCatalogCategory(ctx context.Context, category string) ([]models.CatalogItem, error) {
+	catalog, err := app.db.GetMerchCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.CatalogItem, 0, len(catalog))
+	for _, item := range catalog {
+		if item.Category == category {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil, ErrUnknownCategory
+	}
+
+	return items, nil
+}
+
+// ProcessSetMerchCategory assigns the item to the category of the request, or leaves it uncategorized when the
+// category is empty. It returns storage.ErrItemNotFound when there is no such item.
+func (app *App) ProcessSetMerchCategory(ctx context.Context, itemName string, req models.MerchCategoryRequest) (*models.MerchCategory, error) {
+	return app.db.SetMerchCategory(ctx, itemName, req.Category)
+}
+
+// GroupInventoryByCategory groups the inventory entries by category, the categories sorted by name and
+// the uncategorized items last. Entries keep their order within a group.
+func GroupInventoryByCategory(inventory []models.InventoryItem) []models.InventoryCategory {
+	groups := []models.InventoryCategory{}
+	index := make(map[string]int)
+	for _, item := range inventory {
+		i, ok := index[item.Category]
+		if !ok {
+			i = len(groups)
+			index[item.Category] = i
+			groups = append(groups, models.InventoryCategory{Category: item.Category})
+		}
+		groups[i].Items = append(groups[i].Items, item)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].Category == "") != (groups[j].Category == "") {
+			return groups[j].Category == ""
+		}
+		return groups[i].Category < groups[j].Category
+	})
+	return groups
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"merch_store/internal/models"
+)
+
+// maxDelegationLifetime bounds how far ahead a spending delegation may expire.
+const maxDelegationLifetime = 365 * 24 * time.Hour
+
+// Predefined errors for spending delegations.
+var (
+	// ErrMissingGrantee indicates that the user to delegate spending to is not provided.
+	ErrMissingGrantee = errors.New("app: missing grantee")
+	// ErrInvalidDelegationAllowance indicates that the allowance of a delegation is not a positive number of coins.
+	ErrInvalidDelegationAllowance = errors.New("app: invalid delegation allowance")
+	// ErrInvalidDelegationExpiry indicates that the expiry is not an RFC 3339 timestamp in the future within a year.
+	ErrInvalidDelegationExpiry = errors.New("app: invalid delegation expiry")
+)
+
+// ProcessCreateDelegation authorizes req.Grantee to spend up to req.Allowance coins of the user on purchases until
+// req.ExpiresAt. It replaces an active delegation of the user to the same grantee, if any.
+func (app *App) ProcessCreateDelegation(ctx context.Context, userID int32, req models.DelegationRequest) (*models.Delegation, error) {
+	if req.Grantee == "" {
+		return nil, ErrMissingGrantee
+	}
+	if req.Allowance <= 0 {
+		return nil, ErrInvalidDelegationAllowance
+	}
+
+	now := app.Now()
+	expiresAt, err := time.Parse(time.RFC3339, req.ExpiresAt)
+	if err != nil || !expiresAt.After(now) || expiresAt.Sub(now) > maxDelegationLifetime {
+		return nil, ErrInvalidDelegationExpiry
+	}
+
+	return app.db.CreateDelegation(ctx, userID, models.Delegation{
+		Grantee:   req.Grantee,
+		Allowance: int(req.Allowance),
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: now,
+	})
+}
+
+// ProcessDelegations lists the delegations the user granted and received that have not been revoked, newest first.
+func (app *App) ProcessDelegations(ctx context.Context, userID int32) (*models.DelegationsResponse, error) {
+	return app.db.GetDelegations(ctx, userID)
+}
+
+// ProcessRevokeDelegation revokes a delegation granted by the user. Only the grantor may revoke a delegation.
+func (app *App) ProcessRevokeDelegation(ctx context.Context, userID int32, delegationID int64) error {
+	return app.db.RevokeDelegation(ctx, userID, delegationID, app.Now())
+}
+
+// ProcessBuyOnBehalf processes the purchase of an item by the user, paid for by grantor under a delegation
+// (see storage.PostgreSQL.BuyItemOnBehalf). The purchase goes through the checks of ProcessBuy, which apply to
+// the buyer, and committed purchases are published to the event stream of the grantor, who receives the item.
+func (app *App) ProcessBuyOnBehalf(ctx context.Context, userID int32, grantor string, itemName string) (*models.PurchaseResult, error) {
+	purchase, err := app.buy(ctx, userID, itemName, func(ctx context.Context) (*models.PurchaseResult, error) {
+		return app.db.BuyItemOnBehalf(ctx, userID, grantor, itemName, app.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !purchase.DryRun {
+		app.publishPurchase(purchase.GrantorID, &models.PurchaseResult{
+			Item:           purchase.Item,
+			Price:          purchase.Price,
+			OriginalPrice:  purchase.OriginalPrice,
+			PromotionID:    purchase.PromotionID,
+			Quantity:       purchase.Quantity,
+			RemainingCoins: purchase.GrantorCoins,
+			ReceiptNumber:  purchase.ReceiptNumber,
+		})
+	}
+	return purchase, nil
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessCreateDelegation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+
+	testCases := []struct {
+		name    string
+		req     models.DelegationRequest
+		wantErr error
+	}{
+		{name: "Missing grantee", req: models.DelegationRequest{Allowance: 100, ExpiresAt: "2025-06-02T12:00:00Z"}, wantErr: ErrMissingGrantee},
+		{name: "Zero allowance", req: models.DelegationRequest{Grantee: "bob", ExpiresAt: "2025-06-02T12:00:00Z"}, wantErr: ErrInvalidDelegationAllowance},
+		{name: "Missing expiry", req: models.DelegationRequest{Grantee: "bob", Allowance: 100}, wantErr: ErrInvalidDelegationExpiry},
+		{name: "Expiry in the past", req: models.DelegationRequest{Grantee: "bob", Allowance: 100, ExpiresAt: "2025-06-01T12:00:00Z"}, wantErr: ErrInvalidDelegationExpiry},
+		{name: "Expiry too far", req: models.DelegationRequest{Grantee: "bob", Allowance: 100, ExpiresAt: "2026-06-02T12:00:00Z"}, wantErr: ErrInvalidDelegationExpiry},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := app.ProcessCreateDelegation(ctx, 1, tc.req)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+
+	t.Run("Created", func(t *testing.T) {
+		want := models.Delegation{Grantee: "bob", Allowance: 100, ExpiresAt: time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC), CreatedAt: now}
+		mockDB.EXPECT().CreateDelegation(ctx, int32(1), want).Return(&want, nil)
+
+		delegation, err := app.ProcessCreateDelegation(ctx, 1, models.DelegationRequest{Grantee: "bob", Allowance: 100, ExpiresAt: "2025-06-02T12:00:00+03:00"})
+		require.NoError(t, err)
+		assert.Equal(t, time.UTC, delegation.ExpiresAt.Location(), "expiry times are kept in UTC")
+	})
+}
+
+func TestProcessBuyOnBehalf_Debounce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetPurchaseDebounce(time.Minute)
+	ctx := context.Background()
+
+	mockDB.EXPECT().BuyItemOnBehalf(ctx, int32(2), "alice", "cup", gomock.Any()).Return(nil, storage.ErrDelegationAllowanceExceeded)
+	_, err := app.ProcessBuyOnBehalf(ctx, 2, "alice", "cup")
+	require.ErrorIs(t, err, storage.ErrDelegationAllowanceExceeded)
+
+	mockDB.EXPECT().BuyItemOnBehalf(ctx, int32(2), "alice", "cup", gomock.Any()).Return(&models.PurchaseResult{Item: "cup", GrantorID: 1}, nil)
+	_, err = app.ProcessBuyOnBehalf(ctx, 2, "alice", "cup")
+	require.NoError(t, err, "a refused purchase must not count as a duplicate")
+
+	_, err = app.ProcessBuyOnBehalf(ctx, 2, "alice", "cup")
+	assert.ErrorIs(t, err, ErrDuplicatePurchase)
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"merch_store/internal/models"
+)
+
+// Settings of the economy dashboard.
+const (
+	// EconomyStatsCacheTTL is how long computed economy statistics are served before they are computed again.
+	EconomyStatsCacheTTL = 5 * time.Minute
+	// maxEconomyRangeDays bounds the number of days of the economy statistics, which has one entry per day.
+	maxEconomyRangeDays = 366
+)
+
+// ErrEconomyRangeTooLong indicates that the economy statistics are requested for more than maxEconomyRangeDays days.
+var ErrEconomyRangeTooLong = errors.New("app: economy statistics range too long")
+
+// economyStatsEntry is the economy statistics of a date range together with when they expire.
+type economyStatsEntry struct {
+	stats     *models.EconomyStats
+	expiresAt time.Time
+}
+
+// economyStatsCache keeps the economy statistics of recently requested date ranges, which take full scans of
+// users, transfers, and purchases to compute. Expired entries are removed whenever an entry is stored.
+type economyStatsCache struct {
+	mu      sync.Mutex
+	entries map[[2]time.Time]economyStatsEntry
+}
+
+// get returns the statistics of the range cached before now, if any.
+func (cache *economyStatsCache) get(from time.Time, to time.Time, now time.Time) (*models.EconomyStats, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[[2]time.Time{from, to}]
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+// put caches the statistics of the range for EconomyStatsCacheTTL after now.
+func (cache *economyStatsCache) put(from time.Time, to time.Time, stats *models.EconomyStats, now time.Time) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.entries == nil {
+		cache.entries = make(map[[2]time.Time]economyStatsEntry)
+	}
+	for key, entry := range cache.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(cache.entries, key)
+		}
+	}
+	cache.entries[[2]time.Time{from, to}] = economyStatsEntry{stats: stats, expiresAt: now.Add(EconomyStatsCacheTTL)}
+}
+
+// ProcessEconomyStats returns the health of the coin economy with the daily volumes between the inclusive
+// YYYY-MM-DD dates from and to (UTC), defaulting as for ProcessFailedPurchaseStats. The statistics of a range are
+// computed at most once per EconomyStatsCacheTTL; GeneratedAt tells when they were. It returns ErrInvalidDateRange
+// for malformed ranges and ErrEconomyRangeTooLong for ranges of more than a year.
+func (app *App) ProcessEconomyStats(ctx context.Context, from string, to string) (*models.EconomyStats, error) {
+	fromDate, toDate, err := app.parseStatsRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if toDate.Sub(fromDate) >= maxEconomyRangeDays*24*time.Hour {
+		return nil, ErrEconomyRangeTooLong
+	}
+
+	now := app.Now()
+	if stats, ok := app.economyStats.get(fromDate, toDate, now); ok {
+		return stats, nil
+	}
+
+	stats, err := app.db.GetEconomyStats(ctx, fromDate, toDate.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	stats.From = fromDate.Format(statsDateLayout)
+	stats.To = toDate.Format(statsDateLayout)
+	stats.GeneratedAt = now.UTC()
+
+	app.economyStats.put(fromDate, toDate, stats, now)
+	return stats, nil
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessEconomyStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(fakeClock)
+	ctx := context.Background()
+
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC)
+	computed := func() *models.EconomyStats {
+		return &models.EconomyStats{Users: 2, CoinsInCirculation: 1500, Gini: 0.1667, Days: []models.EconomyDay{{Date: "2025-06-01", Transfers: 1, TransferVolume: 100}}}
+	}
+
+	mockDB.EXPECT().GetEconomyStats(ctx, from, to).Return(computed(), nil)
+	stats, err := app.ProcessEconomyStats(ctx, "2025-06-01", "2025-06-02")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-06-01", stats.From)
+	assert.Equal(t, "2025-06-02", stats.To)
+	assert.Equal(t, now, stats.GeneratedAt)
+
+	fakeClock.Advance(EconomyStatsCacheTTL - time.Second)
+	cached, err := app.ProcessEconomyStats(ctx, "2025-06-01", "2025-06-02")
+	require.NoError(t, err)
+	assert.Equal(t, stats, cached, "statistics must be served from the cache within its TTL")
+
+	fakeClock.Advance(time.Second)
+	mockDB.EXPECT().GetEconomyStats(ctx, from, to).Return(computed(), nil)
+	refreshed, err := app.ProcessEconomyStats(ctx, "2025-06-01", "2025-06-02")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(EconomyStatsCacheTTL), refreshed.GeneratedAt)
+
+	_, err = app.ProcessEconomyStats(ctx, "2025-06-02", "2025-06-01")
+	assert.ErrorIs(t, err, ErrInvalidDateRange)
+	_, err = app.ProcessEconomyStats(ctx, "2024-06-01", "2025-06-02")
+	assert.ErrorIs(t, err, ErrEconomyRangeTooLong)
+
+	mockDB.EXPECT().GetEconomyStats(ctx, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)).Return(computed(), nil)
+	_, err = app.ProcessEconomyStats(ctx, "2024-06-01", "2025-06-01")
+	assert.NoError(t, err, "a range of 366 dates must be accepted")
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"merch_store/internal/models"
+)
+
+// eventBufferSize is the number of events buffered per subscription. A subscriber falling this far behind
+// is disconnected rather than allowed to slow down publishers.
+const eventBufferSize = 16
+
+var (
+	// ErrEventsDisabled indicates that the event stream is not enabled.
+	ErrEventsDisabled = errors.New("app: event stream is disabled")
+	// ErrInvalidEventType indicates that an event filter names an unknown event type.
+	ErrInvalidEventType = errors.New("app: invalid event type")
+)
+
+// EventBroker delivers events to the subscriptions of their user within this process.
+// Publishing never blocks: a subscription whose buffer is full is closed, so that its client reconnects
+// and reloads its state instead of silently missing events.
+type EventBroker struct {
+	mu            sync.Mutex
+	subscriptions map[int32]map[*eventSubscription]struct{}
+}
+
+// eventSubscription is a subscription of a user to the event types in types, or to all types when it is empty.
+type eventSubscription struct {
+	types  []string
+	events chan models.Event
+}
+
+// NewEventBroker creates an EventBroker without subscriptions.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscriptions: make(map[int32]map[*eventSubscription]struct{})}
+}
+
+// Subscribe subscribes to the events of the user with one of the types, or of any type when types is empty.
+// Events arrive on the returned channel in the order they were published. The channel is closed by cancel,
+// which must be called once the subscriber is done, or when the subscriber falls behind.
+func (broker *EventBroker) Subscribe(userID int32, types []string) (<-chan models.Event, func()) {
+	subscription := &eventSubscription{types: types, events: make(chan models.Event, eventBufferSize)}
+
+	broker.mu.Lock()
+	if broker.subscriptions[userID] == nil {
+		broker.subscriptions[userID] = make(map[*eventSubscription]struct{})
+	}
+	broker.subscriptions[userID][subscription] = struct{}{}
+	broker.mu.Unlock()
+
+	cancel := func() {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		broker.remove(userID, subscription)
+	}
+	return subscription.events, cancel
+}
+
+// Publish delivers the event to the subscriptions of the user accepting its type.
+func (broker *EventBroker) Publish(userID int32, event models.Event) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for subscription := range broker.subscriptions[userID] {
+		if len(subscription.types) > 0 && !slices.Contains(subscription.types, event.Type) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			broker.remove(userID, subscription)
+		}
+	}
+}
+
+// HasSubscribers reports whether the user has any subscriptions.
+func (broker *EventBroker) HasSubscribers(userID int32) bool {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	return len(broker.subscriptions[userID]) > 0
+}
+
+// remove closes the subscription unless it has already been removed. It must be called with mu held.
+func (broker *EventBroker) remove(userID int32, subscription *eventSubscription) {
+	if _, ok := broker.subscriptions[userID][subscription]; !ok {
+		return
+	}
+	delete(broker.subscriptions[userID], subscription)
+	if len(broker.subscriptions[userID]) == 0 {
+		delete(broker.subscriptions, userID)
+	}
+	close(subscription.events)
+}
+
+// ParseEventTypes parses a comma-separated list of event types. An empty list selects all types.
+// It returns ErrInvalidEventType when the list names an unknown type.
+func ParseEventTypes(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var types []string
+	for _, eventType := range strings.Split(value, ",") {
+		eventType = strings.TrimSpace(eventType)
+		if !slices.Contains(models.EventTypes, eventType) {
+			return nil, ErrInvalidEventType
+		}
+		if !slices.Contains(types, eventType) {
+			types = append(types, eventType)
+		}
+	}
+	return types, nil
+}
+
+// SetEventBroker enables the event stream: committed purchases and transfers are published to broker.
+func (app *App) SetEventBroker(broker *EventBroker) {
+	app.events = broker
+}
+
+// SubscribeEvents subscribes to the events of the user with one of the types, or of any type when types is empty
+// (see EventBroker.Subscribe). It returns ErrEventsDisabled when no event broker is set.
+func (app *App) SubscribeEvents(userID int32, types []string) (<-chan models.Event, func(), error) {
+	if app.events == nil {
+		return nil, nil, ErrEventsDisabled
+	}
+
+	events, cancel := app.events.Subscribe(userID, types)
+	return events, cancel, nil
+}
+
+// publishPurchase publishes purchase_completed and balance_changed for a committed purchase of the user.
+func (app *App) publishPurchase(userID int32, purchase *models.PurchaseResult) {
+	if app.events == nil {
+		return
+	}
+
+	app.events.Publish(userID, models.Event{Type: models.EventPurchaseCompleted, Data: models.EventPurchaseCompletedV1{
+		Item:          purchase.Item,
+		Price:         purchase.Price,
+		Quantity:      purchase.Quantity,
+		ReceiptNumber: purchase.ReceiptNumber,
+	}})
+	app.events.Publish(userID, models.Event{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: purchase.RemainingCoins}})
+}
+
+// publishTransfer publishes balance_changed to the sender and coins_received and balance_changed to the recipient
+// of a committed transfer. The users and their balances are only looked up when one of them has subscriptions.
+// The transfer has already been committed, so lookup errors are logged rather than returned.
+func (app *App) publishTransfer(ctx context.Context, userID int32, req models.SendCoinRequest, transferID int64) {
+	if app.events == nil {
+		return
+	}
+
+	recipient, err := app.db.GetUserID(ctx, nil, req.ToUser)
+	if err != nil {
+		app.log.Sugar().Warnf("Failed to publish the events of transfer %d: %s", transferID, err)
+		return
+	}
+	senderSubscribed := app.events.HasSubscribers(userID)
+	recipientSubscribed := app.events.HasSubscribers(recipient.ID)
+	if !senderSubscribed && !recipientSubscribed {
+		return
+	}
+
+	sender, err := app.db.GetUserInfo(ctx, nil, userID)
+	if err != nil {
+		app.log.Sugar().Warnf("Failed to publish the events of transfer %d: %s", transferID, err)
+		return
+	}
+	if senderSubscribed {
+		app.events.Publish(userID, models.Event{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: sender.Coins}})
+	}
+
+	if recipientSubscribed {
+		recipientInfo, err := app.db.GetUserInfo(ctx, nil, recipient.ID)
+		if err != nil {
+			app.log.Sugar().Warnf("Failed to publish the events of transfer %d: %s", transferID, err)
+			return
+		}
+		app.events.Publish(recipient.ID, models.Event{Type: models.EventCoinsReceived, Data: models.EventCoinsReceivedV1{
+			TransferID: transferID,
+			FromUser:   sender.Username,
+			Amount:     int(req.Amount),
+		}})
+		app.events.Publish(recipient.ID, models.Event{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: recipientInfo.Coins}})
+	}
+}
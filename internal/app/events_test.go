@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+// receiveAll returns the events buffered on the channel without waiting for more.
+func receiveAll(events <-chan models.Event) []models.Event {
+	var received []models.Event
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return received
+			}
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
+
+func TestEventBroker(t *testing.T) {
+	broker := NewEventBroker()
+	purchases, cancelPurchases := broker.Subscribe(1, []string{models.EventPurchaseCompleted, models.EventCoinsReceived})
+	all, cancelAll := broker.Subscribe(1, nil)
+	other, cancelOther := broker.Subscribe(2, nil)
+	defer cancelOther()
+
+	published := []models.Event{
+		{Type: models.EventPurchaseCompleted, Data: models.EventPurchaseCompletedV1{Item: "cup"}},
+		{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: 980}},
+		{Type: models.EventCoinsReceived, Data: models.EventCoinsReceivedV1{TransferID: 7, FromUser: "bob", Amount: 20}},
+		{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: 1000}},
+	}
+	for _, event := range published {
+		broker.Publish(1, event)
+	}
+
+	assert.Equal(t, []models.Event{published[0], published[2]}, receiveAll(purchases), "only matching events, in order")
+	assert.Equal(t, published, receiveAll(all))
+	assert.Empty(t, receiveAll(other), "events must not reach other users")
+
+	cancelPurchases()
+	cancelAll()
+	cancelAll()
+	assert.False(t, broker.HasSubscribers(1))
+	assert.True(t, broker.HasSubscribers(2))
+
+	t.Run("Slow subscriber", func(t *testing.T) {
+		events, cancel := broker.Subscribe(3, nil)
+		defer cancel()
+		for i := 0; i <= eventBufferSize; i++ {
+			broker.Publish(3, models.Event{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: int64(i)}})
+		}
+
+		assert.Len(t, receiveAll(events), eventBufferSize)
+		_, open := <-events
+		assert.False(t, open, "a subscriber falling behind must be disconnected")
+		assert.False(t, broker.HasSubscribers(3))
+	})
+}
+
+func TestParseEventTypes(t *testing.T) {
+	types, err := ParseEventTypes("")
+	require.NoError(t, err)
+	assert.Nil(t, types)
+
+	types, err = ParseEventTypes("purchase_completed, coins_received,purchase_completed")
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.EventPurchaseCompleted, models.EventCoinsReceived}, types)
+
+	for _, value := range []string{"purchase", "purchase_completed,", "PURCHASE_COMPLETED"} {
+		_, err = ParseEventTypes(value)
+		assert.ErrorIs(t, err, ErrInvalidEventType, value)
+	}
+}
+
+func TestEventPublishing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	broker := NewEventBroker()
+	app.SetEventBroker(broker)
+	ctx := context.Background()
+
+	buyer, cancel := broker.Subscribe(1, nil)
+	defer cancel()
+	recipient, cancel := broker.Subscribe(2, []string{models.EventCoinsReceived})
+	defer cancel()
+
+	t.Run("Purchase", func(t *testing.T) {
+		purchase := &models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 980, ReceiptNumber: "R-2025-000123"}
+		mockDB.EXPECT().BuyItem(ctx, int32(1), "cup").Return(purchase, nil)
+		_, err := app.ProcessBuy(ctx, 1, "cup")
+		require.NoError(t, err)
+
+		assert.Equal(t, []models.Event{
+			{Type: models.EventPurchaseCompleted, Data: models.EventPurchaseCompletedV1{Item: "cup", Price: 20, Quantity: 1, ReceiptNumber: "R-2025-000123"}},
+			{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: 980}},
+		}, receiveAll(buyer))
+	})
+
+	t.Run("Purchase on behalf", func(t *testing.T) {
+		remaining := 80
+		purchase := &models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 1000, ReceiptNumber: "R-2025-000124",
+			OnBehalfOf: "alice", RemainingAllowance: &remaining, GrantorID: 1, GrantorCoins: 960}
+		mockDB.EXPECT().BuyItemOnBehalf(ctx, int32(2), "alice", "cup", gomock.Any()).Return(purchase, nil)
+		_, err := app.ProcessBuyOnBehalf(ctx, 2, "alice", "cup")
+		require.NoError(t, err)
+
+		assert.Equal(t, []models.Event{
+			{Type: models.EventPurchaseCompleted, Data: models.EventPurchaseCompletedV1{Item: "cup", Price: 20, Quantity: 1, ReceiptNumber: "R-2025-000124"}},
+			{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: 960}},
+		}, receiveAll(buyer), "the grantor is charged and receives the item")
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		dryRun := storage.WithDryRun(ctx)
+		mockDB.EXPECT().BuyItem(dryRun, int32(1), "cup").Return(&models.PurchaseResult{Item: "cup"}, nil)
+		_, err := app.ProcessBuy(dryRun, 1, "cup")
+		require.NoError(t, err)
+		assert.Empty(t, receiveAll(buyer), "a rolled back purchase must not be published")
+	})
+
+	t.Run("Transfer", func(t *testing.T) {
+		req := models.SendCoinRequest{ToUser: "bob", Amount: 100}
+		mockDB.EXPECT().TransferCoins(ctx, int32(1), req).Return(&models.TransferResult{TransferID: 7}, nil)
+		mockDB.EXPECT().GetUserID(ctx, nil, "bob").Return(&models.User{ID: 2, Username: "bob"}, nil)
+		mockDB.EXPECT().GetUserInfo(ctx, nil, int32(1)).Return(&models.User{ID: 1, Username: "alice", Coins: 880}, nil)
+		mockDB.EXPECT().GetUserInfo(ctx, nil, int32(2)).Return(&models.User{ID: 2, Username: "bob", Coins: 1100}, nil)
+		_, err := app.ProcessSendCoin(ctx, 1, req)
+		require.NoError(t, err)
+
+		assert.Equal(t, []models.Event{{Type: models.EventBalanceChanged, Data: models.EventBalanceChangedV1{Coins: 880}}}, receiveAll(buyer))
+		assert.Equal(t, []models.Event{
+			{Type: models.EventCoinsReceived, Data: models.EventCoinsReceivedV1{TransferID: 7, FromUser: "alice", Amount: 100}},
+		}, receiveAll(recipient))
+	})
+
+	t.Run("Transfer without subscribers", func(t *testing.T) {
+		req := models.SendCoinRequest{ToUser: "carol", Amount: 100}
+		mockDB.EXPECT().TransferCoins(ctx, int32(3), req).Return(&models.TransferResult{TransferID: 8}, nil)
+		mockDB.EXPECT().GetUserID(ctx, nil, "carol").Return(&models.User{ID: 4, Username: "carol"}, nil)
+		_, err := app.ProcessSendCoin(ctx, 3, req)
+		require.NoError(t, err, "balances must not be looked up when nobody listens")
+	})
+}
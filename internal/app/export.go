@@ -0,0 +1,27 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// DataExportInterval is how often a user may export their data.
+const DataExportInterval = time.Hour
+
+// ReserveAccountExport records a data export of the user, allowing at most one per DataExportInterval.
+// When the previous export was too recent, it returns storage.ErrDataExportTooSoon and how long to wait until the next one.
+// The export is counted once reserved, even if streaming it fails later.
+func (app *App) ReserveAccountExport(ctx context.Context, userID int32) (time.Duration, error) {
+	now := app.Now()
+	allowedAt, err := app.db.ReserveDataExport(ctx, userID, now, DataExportInterval)
+	if err != nil {
+		return allowedAt.Sub(now), err
+	}
+	return 0, nil
+}
+
+// ProcessAccountExport passes everything stored about the user to fn, section by section in the order
+// of storage.ExportSections, without loading the whole history.
+func (app *App) ProcessAccountExport(ctx context.Context, userID int32, fn func(section string, record any) error) error {
+	return app.db.StreamUserExport(ctx, userID, fn)
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// Settings of failed purchase analytics.
+const (
+	statsDateLayout          = "2006-01-02"
+	defaultStatsRangeDays    = 30
+	failedPurchaseWriteLimit = 5 * time.Second // Timeout of writing a single failed purchase.
+)
+
+// ErrInvalidDateRange indicates that the requested statistics range is not a valid pair of YYYY-MM-DD dates.
+var ErrInvalidDateRange = errors.New("app: invalid date range")
+
+// FailedPurchaseRecorder writes failed purchase attempts to storage in the background,
+// so that recording them neither delays nor affects the response to the user.
+// Attempts are buffered in memory; when the buffer is full new attempts are dropped and logged.
+type FailedPurchaseRecorder struct {
+	db      storage.Storage
+	log     *logger.Logger
+	entries chan models.FailedPurchase
+}
+
+// NewFailedPurchaseRecorder creates a FailedPurchaseRecorder buffering up to capacity attempts.
+func NewFailedPurchaseRecorder(db storage.Storage, capacity int, l *logger.Logger) *FailedPurchaseRecorder {
+	return &FailedPurchaseRecorder{db: db, log: l, entries: make(chan models.FailedPurchase, capacity)}
+}
+
+// Record queues a failed purchase for writing without blocking the caller.
+func (recorder *FailedPurchaseRecorder) Record(purchase models.FailedPurchase) {
+	select {
+	case recorder.entries <- purchase:
+	default:
+		recorder.log.Sugar().Warnf("Failed purchase buffer is full, dropping attempt of user %d to buy %s", purchase.UserID,
+			logger.Truncate(purchase.ItemName, logger.MaxLoggedItemNameLength))
+	}
+}
+
+// Run writes queued failed purchases until ctx is canceled, then writes the ones still buffered.
+// It implements worker.Worker.
+func (recorder *FailedPurchaseRecorder) Run(ctx context.Context) error {
+	for {
+		select {
+		case purchase := <-recorder.entries:
+			recorder.write(ctx, purchase)
+		case <-ctx.Done():
+			recorder.flush()
+			return ctx.Err()
+		}
+	}
+}
+
+// flush writes the failed purchases buffered at shutdown.
+func (recorder *FailedPurchaseRecorder) flush() {
+	for {
+		select {
+		case purchase := <-recorder.entries:
+			recorder.write(context.Background(), purchase)
+		default:
+			return
+		}
+	}
+}
+
+// write stores a single failed purchase, logging rather than returning errors: analytics must not stop the worker.
+func (recorder *FailedPurchaseRecorder) write(ctx context.Context, purchase models.FailedPurchase) {
+	ctx, cancel := context.WithTimeout(ctx, failedPurchaseWriteLimit)
+	defer cancel()
+
+	if err := recorder.db.RecordFailedPurchase(ctx, purchase); err != nil {
+		recorder.log.Sugar().Errorf("Failed to record failed purchase of %s by user %d: %s",
+			logger.Truncate(purchase.ItemName, logger.MaxLoggedItemNameLength), purchase.UserID, err)
+	}
+}
+
+// SetFailedPurchaseRecorder enables recording of failed purchases for analytics.
+func (app *App) SetFailedPurchaseRecorder(recorder *FailedPurchaseRecorder) {
+	app.failedPurchases = recorder
+}
+
+// recordFailedPurchase passes the purchase to the recorder when its error signals unmet demand:
+// the user could not afford the item or the item does not exist.
+func (app *App) recordFailedPurchase(userID int32, itemName string, err error) {
+	if app.failedPurchases == nil {
+		return
+	}
+
+	var reason string
+	switch {
+	case errors.Is(err, storage.ErrInsufficientFunds):
+		reason = storage.FailedPurchaseReasonInsufficientFunds
+	case errors.Is(err, storage.ErrItemNotFound):
+		reason = storage.FailedPurchaseReasonItemNotFound
+	default:
+		return
+	}
+
+	app.failedPurchases.Record(models.FailedPurchase{UserID: userID, ItemName: itemName, Reason: reason, CreatedAt: app.Now()})
+}
+
+// ProcessFailedPurchaseStats aggregates failed purchases by item and reason between the inclusive
+// YYYY-MM-DD dates from and to (UTC). An empty to means today; an empty from means 30 days up to to.
+func (app *App) ProcessFailedPurchaseStats(ctx context.Context, from string, to string) (*models.FailedPurchaseStatsResponse, error) {
+	fromDate, toDate, err := app.parseStatsRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := app.db.GetFailedPurchaseStats(ctx, fromDate, toDate.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.FailedPurchaseStatsResponse{From: fromDate.Format(statsDateLayout), To: toDate.Format(statsDateLayout), Stats: stats}, nil
+}
+
+// parseStatsRange parses the inclusive YYYY-MM-DD dates from and to (UTC) of a statistics range. An empty to
+// means today; an empty from means defaultStatsRangeDays up to to. It returns ErrInvalidDateRange for malformed
+// dates and when from is after to.
+func (app *App) parseStatsRange(from string, to string) (time.Time, time.Time, error) {
+	now := app.Now()
+	toDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if to != "" {
+		parsed, err := time.Parse(statsDateLayout, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidDateRange
+		}
+		toDate = parsed
+	}
+
+	fromDate := toDate.AddDate(0, 0, 1-defaultStatsRangeDays)
+	if from != "" {
+		parsed, err := time.Parse(statsDateLayout, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidDateRange
+		}
+		fromDate = parsed
+	}
+
+	if fromDate.After(toDate) {
+		return time.Time{}, time.Time{}, ErrInvalidDateRange
+	}
+
+	return fromDate, toDate, nil
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessBuy_RecordsFailedPurchases(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 4, 2, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, l)
+	app.SetClock(clock.NewFake(now))
+	recorder := NewFailedPurchaseRecorder(mockDB, 10, l)
+	app.SetFailedPurchaseRecorder(recorder)
+	ctx := context.Background()
+
+	itemNotFound := fmt.Errorf("%w: %w", storage.ErrItemNotFound, sql.ErrNoRows)
+	mockDB.EXPECT().BuyItem(ctx, int32(1), "pink-hoody").Return(nil, storage.ErrInsufficientFunds)
+	mockDB.EXPECT().BuyItem(ctx, int32(1), "unicorn").Return(nil, itemNotFound)
+	mockDB.EXPECT().BuyItem(ctx, int32(1), "t-shirt").Return(nil, context.DeadlineExceeded)
+	mockDB.EXPECT().BuyItem(ctx, int32(1), "cup").Return(&models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 980}, nil)
+
+	_, err := app.ProcessBuy(ctx, 1, "pink-hoody")
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+	_, err = app.ProcessBuy(ctx, 1, "unicorn")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "the user-facing error must not change")
+	_, err = app.ProcessBuy(ctx, 1, "t-shirt")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = app.ProcessBuy(ctx, 1, "cup")
+	assert.NoError(t, err)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "pink-hoody").Return(nil, storage.ErrInsufficientFunds)
+	_, err = app.ProcessBuy(storage.WithDryRun(ctx), 1, "pink-hoody")
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+
+	require.Len(t, recorder.entries, 2, "only unmet demand of real purchases is recorded")
+
+	written := make(chan models.FailedPurchase, 2)
+	mockDB.EXPECT().RecordFailedPurchase(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(func(_ context.Context, purchase models.FailedPurchase) error {
+		written <- purchase
+		return nil
+	})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- recorder.Run(runCtx) }()
+
+	assert.Equal(t, models.FailedPurchase{UserID: 1, ItemName: "pink-hoody", Reason: storage.FailedPurchaseReasonInsufficientFunds, CreatedAt: now}, <-written)
+	assert.Equal(t, models.FailedPurchase{UserID: 1, ItemName: "unicorn", Reason: storage.FailedPurchaseReasonItemNotFound, CreatedAt: now}, <-written)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestFailedPurchaseRecorder_DropsWhenFullAndFlushesOnStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	recorder := NewFailedPurchaseRecorder(mockDB, 1, &logger.Logger{Logger: zap.NewNop()})
+
+	recorder.Record(models.FailedPurchase{UserID: 1, ItemName: "cup", Reason: storage.FailedPurchaseReasonInsufficientFunds})
+	recorder.Record(models.FailedPurchase{UserID: 2, ItemName: "cup", Reason: storage.FailedPurchaseReasonInsufficientFunds})
+
+	mockDB.EXPECT().RecordFailedPurchase(gomock.Any(), models.FailedPurchase{UserID: 1, ItemName: "cup", Reason: storage.FailedPurchaseReasonInsufficientFunds}).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, recorder.Run(ctx), context.Canceled)
+	assert.Empty(t, recorder.entries)
+}
+
+func TestProcessFailedPurchaseStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(time.Date(2025, 3, 31, 18, 0, 0, 0, time.UTC)))
+	ctx := context.Background()
+
+	mockDB.EXPECT().GetFailedPurchaseStats(ctx, time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)).Return([]models.FailedPurchaseStat{}, nil)
+	stats, err := app.ProcessFailedPurchaseStats(ctx, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-03-02", stats.From)
+	assert.Equal(t, "2025-03-31", stats.To)
+
+	mockDB.EXPECT().GetFailedPurchaseStats(ctx, time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC)).Return([]models.FailedPurchaseStat{}, nil)
+	_, err = app.ProcessFailedPurchaseStats(ctx, "2025-01-10", "2025-01-10")
+	require.NoError(t, err)
+
+	_, err = app.ProcessFailedPurchaseStats(ctx, "2025-02-01", "2025-01-01")
+	assert.ErrorIs(t, err, ErrInvalidDateRange)
+	_, err = app.ProcessFailedPurchaseStats(ctx, "yesterday", "")
+	assert.ErrorIs(t, err, ErrInvalidDateRange)
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/featureflag"
+)
+
+// SetFeatureFlags sets the feature flags evaluated for requests.
+func (app *App) SetFeatureFlags(flags *featureflag.Flags) {
+	app.flags = flags
+}
+
+// IsFeatureEnabled reports whether the flag is on for the request.
+func (app *App) IsFeatureEnabled(ctx context.Context, flag string) bool {
+	return app.flags.IsEnabled(ctx, flag)
+}
+
+// ProcessFeatureFlags returns the effective state of every feature flag, sorted by name.
+func (app *App) ProcessFeatureFlags() *models.FeatureFlagsResponse {
+	states := app.flags.States()
+	flags := make([]models.FeatureFlag, 0, len(states))
+	for _, state := range states {
+		flags = append(flags, models.FeatureFlag{Name: state.Name, Enabled: state.Enabled, Percentage: state.Percentage, Source: state.Source})
+	}
+
+	return &models.FeatureFlagsResponse{Flags: flags}
+}
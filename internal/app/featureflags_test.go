@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/featureflag"
+	"merch_store/internal/pkg/logger"
+)
+
+func TestIsQueuedItem_FeatureFlag(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	app := NewApp(nil, l)
+	app.SetPurchaseQueue(NewPurchaseQueue(nil, []string{"pink-hoody"}, 1, time.Minute, l))
+	ctx := auth.WithUserID(context.Background(), 1)
+
+	assert.True(t, app.IsQueuedItem(ctx, "pink-hoody"), "queueing must be on by default")
+	assert.False(t, app.IsQueuedItem(ctx, "pen"))
+
+	path := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"purchase_queue": false}`), 0o600))
+	flags := featureflag.New(path, time.Minute, l)
+	require.NoError(t, flags.Reload())
+	app.SetFeatureFlags(flags)
+
+	assert.False(t, app.IsQueuedItem(ctx, "pink-hoody"), "the flag must switch queueing off")
+	assert.Contains(t, app.ProcessFeatureFlags().Flags, models.FeatureFlag{
+		Name: featureflag.PurchaseQueue, Enabled: false, Percentage: 100, Source: featureflag.SourceFile,
+	})
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"merch_store/internal/models"
+)
+
+// IdempotencyKeyTTL is how long the response to a request carrying an idempotency key is replayed to repeats of it.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyReused indicates that the user has already used the idempotency key for a different request.
+var ErrIdempotencyKeyReused = errors.New("app: idempotency key reused for a different request")
+
+// errUnsuccessfulResponse rolls back the transaction of ProcessIdempotent when the request does not succeed.
+var errUnsuccessfulResponse = errors.New("app: unsuccessful response")
+
+// ProcessIdempotent serves the request identified by fingerprint at most once per idempotency key of the user within
+// IdempotencyKeyTTL. The key is claimed, the request served, and a successful (2xx) response stored in one transaction,
+// which serve joins through its context, so the response is stored if and only if the changes it reports are made.
+// Repeats of the request get the stored response back, with replayed set, and never call serve. A response that is not
+// successful rolls the transaction back and is not stored, so the request can be retried with the same key.
+// It returns ErrIdempotencyKeyReused when the key was used for a request with a different fingerprint.
+func (app *App) ProcessIdempotent(ctx context.Context, userID int32, key string, fingerprint string, serve func(ctx context.Context) models.IdempotentResponse) (response *models.IdempotentResponse, replayed bool, err error) {
+	err = app.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := app.Now()
+		stored, err := app.db.ClaimIdempotencyKey(ctx, userID, key, fingerprint, now, now.Add(-IdempotencyKeyTTL))
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			if stored.Fingerprint != fingerprint {
+				return ErrIdempotencyKeyReused
+			}
+			response, replayed = stored, true
+			return nil
+		}
+
+		served := serve(ctx)
+		served.Fingerprint = fingerprint
+		response, replayed = &served, false
+		if served.StatusCode < 200 || served.StatusCode > 299 {
+			return errUnsuccessfulResponse
+		}
+		return app.db.SaveIdempotentResponse(ctx, userID, key, served)
+	})
+	if errors.Is(err, errUnsuccessfulResponse) {
+		return response, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return response, replayed, nil
+}
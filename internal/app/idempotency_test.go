@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessIdempotent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+
+	var committed bool
+	mockDB.EXPECT().WithinTransaction(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+		err := fn(ctx)
+		committed = err == nil
+		return err
+	}).AnyTimes()
+	claim := func(stored *models.IdempotentResponse, err error) {
+		mockDB.EXPECT().ClaimIdempotencyKey(ctx, int32(1), "key", "buy cup", now, now.Add(-IdempotencyKeyTTL)).Return(stored, err)
+	}
+	served := 0
+	serve := func(statusCode int) func(ctx context.Context) models.IdempotentResponse {
+		return func(ctx context.Context) models.IdempotentResponse {
+			served++
+			return models.IdempotentResponse{StatusCode: statusCode, Body: []byte(`{"item":"cup"}`)}
+		}
+	}
+
+	t.Run("First request", func(t *testing.T) {
+		claim(nil, nil)
+		stored := models.IdempotentResponse{Fingerprint: "buy cup", StatusCode: http.StatusOK, Body: []byte(`{"item":"cup"}`)}
+		mockDB.EXPECT().SaveIdempotentResponse(ctx, int32(1), "key", stored).Return(nil)
+
+		response, replayed, err := app.ProcessIdempotent(ctx, 1, "key", "buy cup", serve(http.StatusOK))
+		require.NoError(t, err)
+		assert.False(t, replayed)
+		assert.Equal(t, &stored, response)
+		assert.Equal(t, 1, served)
+		assert.True(t, committed)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		stored := &models.IdempotentResponse{Fingerprint: "buy cup", StatusCode: http.StatusOK, Body: []byte(`{"item":"cup"}`)}
+		claim(stored, nil)
+
+		response, replayed, err := app.ProcessIdempotent(ctx, 1, "key", "buy cup", serve(http.StatusOK))
+		require.NoError(t, err)
+		assert.True(t, replayed)
+		assert.Equal(t, stored, response)
+		assert.Equal(t, 1, served, "a replayed request must not be served again")
+	})
+
+	t.Run("Key reused", func(t *testing.T) {
+		claim(&models.IdempotentResponse{Fingerprint: "buy pen", StatusCode: http.StatusOK}, nil)
+
+		_, _, err := app.ProcessIdempotent(ctx, 1, "key", "buy cup", serve(http.StatusOK))
+		assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+		assert.Equal(t, 1, served)
+	})
+
+	t.Run("Unsuccessful response", func(t *testing.T) {
+		claim(nil, nil)
+
+		response, replayed, err := app.ProcessIdempotent(ctx, 1, "key", "buy cup", serve(http.StatusBadRequest))
+		require.NoError(t, err)
+		assert.False(t, replayed)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.False(t, committed, "the claim must be rolled back so that the request can be retried")
+	})
+
+	t.Run("Storage error", func(t *testing.T) {
+		failure := errors.New("connection reset")
+		claim(nil, failure)
+
+		_, _, err := app.ProcessIdempotent(ctx, 1, "key", "buy cup", serve(http.StatusOK))
+		assert.ErrorIs(t, err, failure)
+	})
+}
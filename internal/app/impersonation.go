@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/storage"
+)
+
+// ErrImpersonationNotAllowed indicates that the administrator asked to impersonate themselves.
+var ErrImpersonationNotAllowed = errors.New("app: cannot impersonate yourself")
+
+// ProcessImpersonate issues the administrator adminID an impersonation token of the user userID, valid for
+// auth.ImpersonationTTL. The token belongs to the administrator's session sessionID and ends with it.
+// It returns storage.ErrUserNotFound when the user does not exist or is no longer active.
+func (app *App) ProcessImpersonate(ctx context.Context, adminID int32, userID int32, sessionID string) (*models.ImpersonationResponse, error) {
+	if userID == adminID {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	active, err := app.db.IsUserActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, storage.ErrUserNotFound
+	}
+
+	token, err := auth.IssueImpersonationToken(userID, adminID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	app.log.Sugar().Infof("Administrator %d started impersonating user %d until %s", adminID, userID, token.ExpiresAt.Format(time.RFC3339))
+	return &models.ImpersonationResponse{Token: token.Token, UserID: userID, ExpiresAt: token.ExpiresAt}, nil
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessInfo_HistoryLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetInfoHistoryLimit(1000, 50)
+	ctx := context.Background()
+
+	t.Run("Just below the threshold", func(t *testing.T) {
+		mockDB.EXPECT().CountCoinHistory(ctx, int32(1)).Return(int64(600), int64(399), nil)
+		mockDB.EXPECT().GetInfo(ctx, int32(1)).Return(&models.InfoResponse{Coins: 100}, nil)
+
+		info, err := app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+		assert.False(t, info.Truncated)
+		assert.Equal(t, []models.TransactionDetail{}, info.CoinHistory.Sent)
+	})
+
+	t.Run("At the threshold", func(t *testing.T) {
+		mockDB.EXPECT().CountCoinHistory(ctx, int32(1)).Return(int64(600), int64(400), nil)
+		mockDB.EXPECT().GetInfo(ctx, int32(1)).Return(&models.InfoResponse{Coins: 100}, nil)
+
+		info, err := app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+		assert.False(t, info.Truncated)
+	})
+
+	t.Run("Above the threshold", func(t *testing.T) {
+		truncated := &models.InfoResponse{
+			Coins:         100,
+			CoinHistory:   models.CoinHistory{Sent: make([]models.TransactionDetail, 50)},
+			Truncated:     true,
+			TotalSent:     600,
+			TotalReceived: 401,
+		}
+		mockDB.EXPECT().CountCoinHistory(ctx, int32(1)).Return(int64(600), int64(401), nil)
+		mockDB.EXPECT().GetInfoWithHistoryLimit(ctx, int32(1), 50).Return(truncated, nil)
+
+		info, err := app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, info.Truncated)
+		assert.Equal(t, int64(600), info.TotalSent)
+		assert.Equal(t, int64(401), info.TotalReceived)
+		assert.Len(t, info.CoinHistory.Sent, 50)
+		assert.Equal(t, []models.TransactionDetail{}, info.CoinHistory.Received)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+		mockDB.EXPECT().GetInfo(ctx, int32(1)).Return(&models.InfoResponse{Coins: 100}, nil)
+
+		_, err := app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+	})
+}
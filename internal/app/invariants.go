@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/metrics"
+	"merch_store/internal/storage"
+)
+
+// maxLoggedViolations bounds the number of violations logged individually by one run of the InvariantChecker.
+const maxLoggedViolations = 20
+
+// InvariantChecker periodically checks the invariants of the coin economy, logging the violations it finds
+// and counting them in metrics.InvariantViolations, so that corrupted balances raise an alert.
+type InvariantChecker struct {
+	db       storage.Storage
+	log      *logger.Logger
+	clock    clock.Clock
+	interval time.Duration
+}
+
+// NewInvariantChecker creates an InvariantChecker checking the invariants every interval.
+func NewInvariantChecker(db storage.Storage, interval time.Duration, c clock.Clock, l *logger.Logger) *InvariantChecker {
+	return &InvariantChecker{db: db, log: l, clock: c, interval: interval}
+}
+
+// Run checks the invariants on start and then every interval, until ctx is canceled.
+// It implements worker.Worker.
+func (checker *InvariantChecker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(checker.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := checker.Check(ctx); err != nil && ctx.Err() == nil {
+			checker.log.Sugar().Errorf("Failed to check coin economy invariants: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the invariants once and returns the report. Every violation is counted in
+// metrics.InvariantViolations; the first maxLoggedViolations of them are logged as errors, followed by their total.
+func (checker *InvariantChecker) Check(ctx context.Context) (*models.InvariantReport, error) {
+	report, err := checkInvariants(ctx, checker.db, checker.clock)
+	if err != nil {
+		return nil, err
+	}
+	metrics.InvariantChecks.Inc()
+
+	for i, violation := range report.Violations {
+		metrics.InvariantViolations.Inc(violation.Invariant)
+		if i < maxLoggedViolations {
+			checker.log.Sugar().Errorf("Coin economy invariant %s violated by %s row %d: expected %d, found %d: %s",
+				violation.Invariant, violation.Table, violation.RowID, violation.Expected, violation.Actual, violation.Detail)
+		}
+	}
+	if len(report.Violations) > 0 {
+		checker.log.Sugar().Errorf("Found %d violations of coin economy invariants; balances total %d coins, the ledger %d",
+			len(report.Violations), report.TotalBalances, report.TotalLedger)
+	}
+
+	return report, nil
+}
+
+// ProcessInvariants checks the invariants of the coin economy and returns the report of their violations.
+func (app *App) ProcessInvariants(ctx context.Context) (*models.InvariantReport, error) {
+	return checkInvariants(ctx, app.db, app.clock)
+}
+
+// checkInvariants checks the invariants in the storage and stamps the report with the current time.
+func checkInvariants(ctx context.Context, db storage.Storage, c clock.Clock) (*models.InvariantReport, error) {
+	checkedAt := c.Now().UTC()
+	report, err := db.CheckInvariants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.CheckedAt = checkedAt
+
+	return report, nil
+}
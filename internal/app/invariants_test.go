@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/metrics"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestInvariantChecker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	checker := NewInvariantChecker(mockDB, time.Hour, clock.NewFake(now), &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	t.Run("Violations", func(t *testing.T) {
+		checks := metrics.InvariantChecks.Value()
+		ledger := metrics.InvariantViolations.Value(models.InvariantLedgerBalance)
+		transfer := metrics.InvariantViolations.Value(models.InvariantTransferBalance)
+
+		mockDB.EXPECT().CheckInvariants(ctx).Return(&models.InvariantReport{
+			TotalBalances: 1007,
+			TotalLedger:   1000,
+			Violations: []models.InvariantViolation{
+				{Invariant: models.InvariantLedgerBalance, Table: "content.users", RowID: 1, Expected: 1000, Actual: 1007},
+				{Invariant: models.InvariantTransferBalance, Table: "content.coin_transfers", RowID: 2, Expected: 1},
+			},
+		}, nil)
+		report, err := checker.Check(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, now, report.CheckedAt)
+		assert.Len(t, report.Violations, 2)
+
+		assert.Equal(t, checks+1, metrics.InvariantChecks.Value())
+		assert.Equal(t, ledger+1, metrics.InvariantViolations.Value(models.InvariantLedgerBalance))
+		assert.Equal(t, transfer+1, metrics.InvariantViolations.Value(models.InvariantTransferBalance))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		checks := metrics.InvariantChecks.Value()
+		failure := errors.New("connection refused")
+
+		mockDB.EXPECT().CheckInvariants(ctx).Return(nil, failure)
+		_, err := checker.Check(ctx)
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, checks, metrics.InvariantChecks.Value(), "failed checks must not be counted as completed")
+	})
+}
+
+func TestInvariantViolationsMetricLabels(t *testing.T) {
+	for _, invariant := range []string{models.InvariantNegativeBalance, models.InvariantLedgerBalance, models.InvariantTransferBalance, models.InvariantPurchaseTotal} {
+		before := metrics.InvariantViolations.Value(invariant)
+		metrics.InvariantViolations.Inc(invariant)
+		assert.Equal(t, before+1, metrics.InvariantViolations.Value(invariant), "invariant %s must have a series", invariant)
+	}
+}
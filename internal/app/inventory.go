@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"merch_store/internal/models"
+)
+
+// ErrInvalidQuantity indicates that the number of units to consume is not positive.
+var ErrInvalidQuantity = errors.New("app: quantity must be positive")
+
+// ProcessConsume marks units of an item owned by the user as handed out and returns the updated inventory entry.
+// Consuming more units than are pending pickup fails with storage.ErrInsufficientItems.
+func (app *App) ProcessConsume(ctx context.Context, userID int32, itemName string, req models.ConsumeRequest) (*models.InventoryItem, error) {
+	if req.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	item, err := app.db.ConsumeItem(ctx, userID, itemName, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	app.recordWrite(userID)
+	return item, nil
+}
+
+// ProcessReconcileInventory reports the entries of the materialized inventory counts that drifted from the purchases
+// they summarize and, when repair is set, overwrites them with the quantities aggregated from the purchases.
+// Drift is logged as a warning, as it means that an operation changed purchases without updating the counts.
+func (app *App) ProcessReconcileInventory(ctx context.Context, repair bool) (*models.InventoryReconciliationResponse, error) {
+	drift, err := app.db.ReconcileInventoryCounts(ctx, repair)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(drift) > 0 {
+		app.log.Sugar().Warnf("Inventory counts drifted for %d entries, repaired: %t", len(drift), repair)
+	}
+	if drift == nil {
+		drift = []models.InventoryDrift{}
+	}
+
+	return &models.InventoryReconciliationResponse{Drift: drift, Repaired: repair && len(drift) > 0}, nil
+}
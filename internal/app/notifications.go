@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// Page size limits of the notifications list.
+const (
+	DefaultNotificationsPageSize = 50
+	MaxNotificationsPageSize     = 200
+)
+
+// ErrUnknownNotificationCategory indicates that a muted category is not one of storage.NotificationCategories.
+var ErrUnknownNotificationCategory = errors.New("app: unknown notification category")
+
+// ProcessNotifications returns a page of the user's notifications, newest first, along with the number of unread
+// ones. With unreadOnly, the notifications already read are left out. The limit is clamped to
+// MaxNotificationsPageSize and defaults to DefaultNotificationsPageSize when zero. An empty cursor selects the
+// first page; the returned NextCursor selects the following one and is only valid with the same unreadOnly.
+func (app *App) ProcessNotifications(ctx context.Context, userID int32, unreadOnly bool, limit int, cursor string) (*models.NotificationsResponse, error) {
+	list := "notifications"
+	if unreadOnly {
+		list = "unread notifications"
+	}
+
+	limit = clampPageLimit(limit, DefaultNotificationsPageSize, MaxNotificationsPageSize)
+
+	filter := models.NotificationsFilter{UnreadOnly: unreadOnly, Limit: limit + 1}
+	if cursor != "" {
+		after, err := decodePageCursor(cursor, userID, list)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	notifications, err := app.db.GetNotifications(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := app.db.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.NotificationsResponse{Notifications: notifications, UnreadCount: unread, PageMeta: models.PageMeta{Limit: limit}}
+	if len(notifications) > limit {
+		response.Notifications = notifications[:limit]
+		last := response.Notifications[limit-1]
+		response.NextCursor, err = encodePageCursor(userID, list, models.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// ProcessUnreadNotificationsCount returns the number of notifications the user has not read.
+func (app *App) ProcessUnreadNotificationsCount(ctx context.Context, userID int32) (int64, error) {
+	return app.db.CountUnreadNotifications(ctx, userID)
+}
+
+// ProcessReadNotification marks the user's notification as read and returns it. Marking it again succeeds and
+// keeps the time it was first read. It returns storage.ErrNotificationNotFound when the user has no such
+// notification.
+func (app *App) ProcessReadNotification(ctx context.Context, userID int32, notificationID int64) (*models.Notification, error) {
+	return app.db.MarkNotificationRead(ctx, userID, notificationID, app.Now())
+}
+
+// ProcessReadAllNotifications marks every unread notification of the user as read.
+func (app *App) ProcessReadAllNotifications(ctx context.Context, userID int32) (*models.ReadAllNotificationsResponse, error) {
+	marked, err := app.db.MarkAllNotificationsRead(ctx, userID, app.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ReadAllNotificationsResponse{Marked: marked}, nil
+}
+
+// ProcessNotificationPreferences returns the notification categories the user has muted.
+func (app *App) ProcessNotificationPreferences(ctx context.Context, userID int32) (*models.NotificationPreferences, error) {
+	muted, err := app.db.GetMutedNotificationCategories(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.NotificationPreferences{Muted: muted}, nil
+}
+
+// ProcessSetNotificationPreferences replaces the notification categories the user has muted with those of req,
+// sorted and without duplicates, and returns them. An empty list unmutes every category. It returns
+// ErrUnknownNotificationCategory, changing nothing, when a category is not one of storage.NotificationCategories.
+func (app *App) ProcessSetNotificationPreferences(ctx context.Context, userID int32, req models.NotificationPreferences) (*models.NotificationPreferences, error) {
+	muted := make([]string, 0, len(req.Muted))
+	for _, category := range req.Muted {
+		if !slices.Contains(storage.NotificationCategories, category) {
+			return nil, ErrUnknownNotificationCategory
+		}
+		if !slices.Contains(muted, category) {
+			muted = append(muted, category)
+		}
+	}
+	sort.Strings(muted)
+
+	if err := app.db.SetMutedNotificationCategories(ctx, userID, muted); err != nil {
+		return nil, err
+	}
+
+	return &models.NotificationPreferences{Muted: muted}, nil
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessNotifications_Cursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Microsecond)
+	page := []models.Notification{
+		{ID: 2, Category: storage.NotificationCoinsReceived, CreatedAt: now},
+		{ID: 1, Category: storage.NotificationCoinsReceived, CreatedAt: now.Add(-time.Second)},
+	}
+	mockDB.EXPECT().GetNotifications(ctx, int32(1), models.NotificationsFilter{UnreadOnly: true, Limit: 2}).Return(page, nil)
+	mockDB.EXPECT().CountUnreadNotifications(ctx, int32(1)).Return(int64(2), nil)
+
+	response, err := app.ProcessNotifications(ctx, 1, true, 1, "")
+	require.NoError(t, err)
+	require.Len(t, response.Notifications, 1)
+	assert.Equal(t, int64(2), response.UnreadCount)
+	require.NotEmpty(t, response.NextCursor)
+
+	_, err = app.ProcessNotifications(ctx, 1, false, 1, response.NextCursor)
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor of the unread notifications must not page through all of them")
+	_, err = app.ProcessNotifications(ctx, 2, true, 1, response.NextCursor)
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor must not page through the notifications of another user")
+}
+
+func TestProcessSetNotificationPreferences(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	t.Run("Unknown category", func(t *testing.T) {
+		_, err := app.ProcessSetNotificationPreferences(ctx, 1, models.NotificationPreferences{
+			Muted: []string{storage.NotificationGiftReceived, "weather"},
+		})
+		assert.ErrorIs(t, err, ErrUnknownNotificationCategory, "nothing may be muted when a category is unknown")
+	})
+
+	t.Run("Unmute everything", func(t *testing.T) {
+		mockDB.EXPECT().SetMutedNotificationCategories(ctx, int32(1), []string{}).Return(nil)
+
+		preferences, err := app.ProcessSetNotificationPreferences(ctx, 1, models.NotificationPreferences{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, preferences.Muted)
+	})
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+)
+
+// ErrInvalidCursor indicates that the pagination cursor is malformed, tampered with, or issued for another query.
+var ErrInvalidCursor = errors.New("app: invalid cursor")
+
+// cursorKey signs pagination cursors so that clients cannot forge them.
+var cursorKey = []byte(auth.SECRETKEY)
+
+// pageCursorPayload is the signed content of a pagination cursor.
+// The cursor is bound to the user and the list it was issued for, such as a transfer direction.
+type pageCursorPayload struct {
+	UserID    int32  `json:"u"`
+	List      string `json:"d"`
+	CreatedAt int64  `json:"t"` // Creation time of the last returned entry, in microseconds since the Unix epoch.
+	ID        int64  `json:"i"`
+}
+
+// clampPageLimit returns the page size of a list for a requested limit: defaultLimit when it is zero or negative,
+// and at most maxLimit.
+func clampPageLimit(limit int, defaultLimit int, maxLimit int) int {
+	if limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// encodePageCursor builds an opaque cursor: the base64 payload and its base64 HMAC joined by a dot.
+func encodePageCursor(userID int32, list string, position models.PageCursor) (string, error) {
+	payload, err := json.Marshal(pageCursorPayload{
+		UserID:    userID,
+		List:      list,
+		CreatedAt: position.CreatedAt.UnixMicro(),
+		ID:        position.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload)), nil
+}
+
+// decodePageCursor verifies the cursor signature and that the cursor was issued for the same user and list.
+func decodePageCursor(cursor string, userID int32, list string) (*models.PageCursor, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if !hmac.Equal(signature, signCursor(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var decoded pageCursorPayload
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if decoded.UserID != userID || decoded.List != list {
+		return nil, ErrInvalidCursor
+	}
+
+	return &models.PageCursor{CreatedAt: time.UnixMicro(decoded.CreatedAt), ID: decoded.ID}, nil
+}
+
+// signCursor returns the HMAC-SHA256 of a cursor payload.
+func signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+)
+
+func TestClampPageLimit(t *testing.T) {
+	assert.Equal(t, 50, clampPageLimit(0, 50, 200), "a missing limit gets the default")
+	assert.Equal(t, 50, clampPageLimit(-5, 50, 200))
+	assert.Equal(t, 1, clampPageLimit(1, 50, 200))
+	assert.Equal(t, 200, clampPageLimit(200, 50, 200))
+	assert.Equal(t, 200, clampPageLimit(1000, 50, 200), "limits over the maximum are clamped, not rejected")
+}
+
+func TestPageCursor_RoundTrip(t *testing.T) {
+	position := models.PageCursor{CreatedAt: time.UnixMicro(1_700_000_000_123_456), ID: 42}
+
+	cursor, err := encodePageCursor(1, "sent", position)
+	require.NoError(t, err)
+
+	decoded, err := decodePageCursor(cursor, 1, "sent")
+	require.NoError(t, err)
+	assert.True(t, position.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, position.ID, decoded.ID)
+}
+
+func TestPageCursor_Invalid(t *testing.T) {
+	cursor, err := encodePageCursor(1, "all", models.PageCursor{CreatedAt: time.Now(), ID: 7})
+	require.NoError(t, err)
+	forged, err := encodePageCursor(1, "all", models.PageCursor{CreatedAt: time.Now(), ID: 8})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		cursor    string
+		userID    int32
+		direction string
+	}{
+		{name: "Not base64", cursor: "!!!.!!!", userID: 1, direction: "all"},
+		{name: "Missing signature", cursor: cursor[:len(cursor)/2], userID: 1, direction: "all"},
+		{name: "Tampered payload", cursor: forged[:len(forged)-43] + cursor[len(cursor)-43:], userID: 1, direction: "all"},
+		{name: "Other user", cursor: cursor, userID: 2, direction: "all"},
+		{name: "Other direction", cursor: cursor, userID: 1, direction: "sent"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodePageCursor(tc.cursor, tc.userID, tc.direction)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/storage"
+)
+
+// Limits of personal access tokens.
+const (
+	maxPersonalTokenNameLength = 100
+	maxPersonalTokenLifetime   = 365 * 24 * time.Hour
+)
+
+// personalTokenCacheTTL is how long a resolved personal access token is reused without a database lookup.
+// A token revoked through another instance keeps working on this one for at most this long.
+const personalTokenCacheTTL = 30 * time.Second
+
+// maxPersonalTokensCached bounds the number of tokens remembered by personalTokenCache.
+const maxPersonalTokensCached = 10000
+
+// Predefined errors for personal access tokens.
+var (
+	// ErrInvalidTokenName indicates that the token name is empty or longer than 100 characters.
+	ErrInvalidTokenName = errors.New("app: token name must be between 1 and 100 characters")
+	// ErrInvalidTokenScopes indicates that no scope or an unknown scope was requested.
+	ErrInvalidTokenScopes = errors.New("app: token scopes must be a non-empty list of sendCoin and info")
+	// ErrInvalidTokenExpiry indicates that the expiry is not an RFC 3339 timestamp in the future within a year.
+	ErrInvalidTokenExpiry = errors.New("app: invalid token expiry")
+)
+
+// personalTokenCache remembers recently resolved personal access tokens by hash, so that a bot sending
+// requests in a loop does not hit the database on every call. Only valid tokens are cached.
+type personalTokenCache struct {
+	mu      sync.Mutex
+	entries map[string]personalTokenCacheEntry
+}
+
+// personalTokenCacheEntry is a resolved token together with the end of its caching.
+type personalTokenCacheEntry struct {
+	token       *models.PersonalToken
+	cachedUntil time.Time
+}
+
+// get returns the cached token stored under hash, unless its caching or the token itself has expired.
+func (cache *personalTokenCache) get(hash string, now time.Time) (*models.PersonalToken, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.cachedUntil) || entry.token.ExpiresAt != nil && !now.Before(*entry.token.ExpiresAt) {
+		delete(cache.entries, hash)
+		return nil, false
+	}
+	return entry.token, true
+}
+
+// put caches the token resolved from hash.
+func (cache *personalTokenCache) put(hash string, token *models.PersonalToken, now time.Time) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.entries == nil || len(cache.entries) >= maxPersonalTokensCached {
+		cache.entries = make(map[string]personalTokenCacheEntry)
+	}
+	cache.entries[hash] = personalTokenCacheEntry{token: token, cachedUntil: now.Add(personalTokenCacheTTL)}
+}
+
+// forget drops the token with the ID from the cache.
+func (cache *personalTokenCache) forget(tokenID int64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for hash, entry := range cache.entries {
+		if entry.token.ID == tokenID {
+			delete(cache.entries, hash)
+		}
+	}
+}
+
+// ProcessCreatePersonalToken creates a personal access token of the user limited to the requested scopes.
+// The returned token holds the secret, which is stored only as a hash and cannot be retrieved again.
+func (app *App) ProcessCreatePersonalToken(ctx context.Context, userID int32, req models.PersonalTokenRequest) (*models.CreatedPersonalToken, error) {
+	if req.Name == "" || len([]rune(req.Name)) > maxPersonalTokenNameLength {
+		return nil, ErrInvalidTokenName
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, ErrInvalidTokenScopes
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !slices.Contains(auth.Scopes, scope) {
+			return nil, ErrInvalidTokenScopes
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	now := app.Now()
+	token := models.PersonalToken{UserID: userID, Name: req.Name, Scopes: scopes, CreatedAt: now.UTC()}
+	if req.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil || !expiresAt.After(now) || expiresAt.Sub(now) > maxPersonalTokenLifetime {
+			return nil, ErrInvalidTokenExpiry
+		}
+		expiresAt = expiresAt.UTC()
+		token.ExpiresAt = &expiresAt
+	}
+
+	generated, err := auth.GeneratePersonalToken()
+	if err != nil {
+		return nil, err
+	}
+	token.Prefix = generated.Prefix
+
+	created, err := app.db.CreatePersonalToken(ctx, token, generated.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedPersonalToken{PersonalToken: *created, Token: generated.Token}, nil
+}
+
+// ProcessPersonalTokens lists the user's personal access tokens that have not been revoked, newest first.
+func (app *App) ProcessPersonalTokens(ctx context.Context, userID int32) (*models.PersonalTokensResponse, error) {
+	tokens, err := app.db.GetPersonalTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		tokens = []models.PersonalToken{}
+	}
+
+	return &models.PersonalTokensResponse{Tokens: tokens}, nil
+}
+
+// ProcessRevokePersonalToken revokes the user's personal access token. It stops working at once on this instance.
+func (app *App) ProcessRevokePersonalToken(ctx context.Context, userID int32, tokenID int64) error {
+	if err := app.db.RevokePersonalToken(ctx, userID, tokenID, app.Now()); err != nil {
+		return err
+	}
+
+	app.personalTokens.forget(tokenID)
+	return nil
+}
+
+// ResolvePersonalToken returns the owner and the scopes of a personal access token, or auth.ErrPersonalTokenInvalid
+// when the token is unknown, revoked, or expired. Valid tokens are cached briefly. It implements auth.PersonalTokenResolver.
+func (app *App) ResolvePersonalToken(ctx context.Context, secret string) (int32, []string, error) {
+	hash := auth.HashPersonalToken(secret)
+	now := app.Now()
+
+	if token, ok := app.personalTokens.get(hash, now); ok {
+		return token.UserID, token.Scopes, nil
+	}
+
+	token, err := app.db.GetPersonalTokenByHash(ctx, hash, now)
+	if errors.Is(err, storage.ErrPersonalTokenNotFound) {
+		return 0, nil, auth.ErrPersonalTokenInvalid
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	app.personalTokens.put(hash, token, now)
+	return token.UserID, token.Scopes, nil
+}
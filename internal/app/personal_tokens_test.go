@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessCreatePersonalToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  models.PersonalTokenRequest
+		err  error
+	}{
+		{name: "missing name", req: models.PersonalTokenRequest{Scopes: []string{auth.ScopeInfo}}, err: ErrInvalidTokenName},
+		{name: "missing scopes", req: models.PersonalTokenRequest{Name: "bot"}, err: ErrInvalidTokenScopes},
+		{name: "unknown scope", req: models.PersonalTokenRequest{Name: "bot", Scopes: []string{auth.ScopeInfo, "buy"}}, err: ErrInvalidTokenScopes},
+		{name: "past expiry", req: models.PersonalTokenRequest{Name: "bot", Scopes: []string{auth.ScopeInfo}, ExpiresAt: "2025-06-01T11:00:00Z"}, err: ErrInvalidTokenExpiry},
+		{name: "expiry too far", req: models.PersonalTokenRequest{Name: "bot", Scopes: []string{auth.ScopeInfo}, ExpiresAt: "2026-06-02T12:00:00Z"}, err: ErrInvalidTokenExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.ProcessCreatePersonalToken(ctx, 1, tt.req)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	var storedHash string
+	mockDB.EXPECT().CreatePersonalToken(ctx, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, token models.PersonalToken, hash string) (*models.PersonalToken, error) {
+			storedHash = hash
+			token.ID = 3
+			return &token, nil
+		})
+
+	created, err := app.ProcessCreatePersonalToken(ctx, 1, models.PersonalTokenRequest{
+		Name:      "birthday bot",
+		Scopes:    []string{auth.ScopeSendCoin, auth.ScopeSendCoin},
+		ExpiresAt: "2025-12-01T15:00:00+03:00",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), created.ID)
+	assert.Equal(t, int32(1), created.UserID)
+	assert.Equal(t, []string{auth.ScopeSendCoin}, created.Scopes, "duplicate scopes must be dropped")
+	assert.Equal(t, time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC), *created.ExpiresAt)
+	assert.Equal(t, auth.HashPersonalToken(created.Token), storedHash, "only the hash of the token may be stored")
+	assert.Equal(t, created.Token[:len(created.Prefix)], created.Prefix)
+}
+
+func TestResolvePersonalToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(fakeClock)
+	ctx := context.Background()
+
+	const secret = "pat_secret"
+	hash := auth.HashPersonalToken(secret)
+	expiresAt := now.Add(time.Minute)
+	token := &models.PersonalToken{ID: 3, UserID: 1, Scopes: []string{auth.ScopeInfo}, ExpiresAt: &expiresAt}
+
+	mockDB.EXPECT().GetPersonalTokenByHash(ctx, hash, now).Return(token, nil)
+	for i := 0; i < 3; i++ {
+		userID, scopes, err := app.ResolvePersonalToken(ctx, secret)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), userID)
+		assert.Equal(t, []string{auth.ScopeInfo}, scopes)
+	}
+
+	fakeClock.Advance(personalTokenCacheTTL)
+	mockDB.EXPECT().GetPersonalTokenByHash(ctx, hash, fakeClock.Now()).Return(token, nil)
+	_, _, err := app.ResolvePersonalToken(ctx, secret)
+	require.NoError(t, err, "a token must be looked up again once its caching expires")
+
+	fakeClock.Advance(expiresAt.Sub(fakeClock.Now()))
+	mockDB.EXPECT().GetPersonalTokenByHash(ctx, hash, fakeClock.Now()).Return(nil, storage.ErrPersonalTokenNotFound)
+	_, _, err = app.ResolvePersonalToken(ctx, secret)
+	assert.ErrorIs(t, err, auth.ErrPersonalTokenInvalid, "an expired token must not be served from the cache")
+
+	mockDB.EXPECT().GetPersonalTokenByHash(ctx, hash, fakeClock.Now()).Return(nil, errors.New("db down"))
+	_, _, err = app.ResolvePersonalToken(ctx, secret)
+	assert.EqualError(t, err, "db down")
+}
+
+func TestProcessRevokePersonalToken_ForgetsCachedToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+
+	const secret = "pat_secret"
+	hash := auth.HashPersonalToken(secret)
+
+	mockDB.EXPECT().GetPersonalTokenByHash(ctx, hash, now).Return(&models.PersonalToken{ID: 3, UserID: 1, Scopes: []string{auth.ScopeInfo}}, nil)
+	_, _, err := app.ResolvePersonalToken(ctx, secret)
+	require.NoError(t, err)
+
+	mockDB.EXPECT().RevokePersonalToken(ctx, int32(1), int64(3), now).Return(nil)
+	require.NoError(t, app.ProcessRevokePersonalToken(ctx, 1, 3))
+
+	mockDB.EXPECT().GetPersonalTokenByHash(ctx, hash, now).Return(nil, storage.ErrPersonalTokenNotFound)
+	_, _, err = app.ResolvePersonalToken(ctx, secret)
+	assert.ErrorIs(t, err, auth.ErrPersonalTokenInvalid, "a revoked token must stop working at once")
+
+	mockDB.EXPECT().RevokePersonalToken(ctx, int32(2), int64(3), now).Return(storage.ErrPersonalTokenNotFound)
+	assert.ErrorIs(t, app.ProcessRevokePersonalToken(ctx, 2, 3), storage.ErrPersonalTokenNotFound)
+}
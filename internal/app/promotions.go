@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"merch_store/internal/models"
+)
+
+// maxPromotionPercent bounds percentage discounts, so that a promotion never gives an item away.
+const maxPromotionPercent = 99
+
+// Predefined errors for promotions.
+var (
+	// ErrInvalidPromotionTarget indicates that the promotion does not target exactly one of an item and a category.
+	ErrInvalidPromotionTarget = errors.New("app: promotion must target either an item or a category")
+	// ErrInvalidPromotionDiscount indicates that the promotion does not have exactly one of a percentage discount
+	// between 1 and 99 and a positive discount in coins.
+	ErrInvalidPromotionDiscount = errors.New("app: promotion must have either a discountPercent between 1 and 99 or a positive discountAmount")
+	// ErrInvalidPromotionWindow indicates that the start or the end is not an RFC 3339 timestamp or the end is not after the start.
+	ErrInvalidPromotionWindow = errors.New("app: promotion startsAt and endsAt must be RFC 3339 times, endsAt after startsAt")
+)
+
+// ProcessCreatePromotion validates and creates a promotion. It returns storage.ErrItemNotFound when the promotion
+// targets an unknown item.
+func (app *App) ProcessCreatePromotion(ctx context.Context, req models.PromotionRequest) (*models.Promotion, error) {
+	promotion, err := parsePromotionRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.db.CreatePromotion(ctx, *promotion)
+}
+
+// ProcessPromotions lists the promotions, the latest to start first.
+func (app *App) ProcessPromotions(ctx context.Context) (*models.PromotionsResponse, error) {
+	promotions, err := app.db.GetPromotions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PromotionsResponse{Promotions: promotions}, nil
+}
+
+// ProcessPromotion returns the promotion with the given ID, or storage.ErrPromotionNotFound.
+func (app *App) ProcessPromotion(ctx context.Context, promotionID int64) (*models.Promotion, error) {
+	return app.db.GetPromotion(ctx, promotionID)
+}
+
+// ProcessUpdatePromotion validates the request and replaces the promotion with it. A promotion is ended early by
+// moving its end to now. It returns storage.ErrPromotionNotFound for an unknown promotion and
+// storage.ErrItemNotFound when the promotion targets an unknown item.
+func (app *App) ProcessUpdatePromotion(ctx context.Context, promotionID int64, req models.PromotionRequest) (*models.Promotion, error) {
+	promotion, err := parsePromotionRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	promotion.ID = promotionID
+
+	return app.db.UpdatePromotion(ctx, *promotion)
+}
+
+// ProcessDeletePromotion deletes a promotion that has not discounted any purchase. It returns
+// storage.ErrPromotionNotFound for an unknown promotion and storage.ErrPromotionInUse for a promotion that has.
+func (app *App) ProcessDeletePromotion(ctx context.Context, promotionID int64) error {
+	return app.db.DeletePromotion(ctx, promotionID)
+}
+
+// parsePromotionRequest validates the request and returns the promotion it describes.
+func parsePromotionRequest(req models.PromotionRequest) (*models.Promotion, error) {
+	if (req.Item == "") == (req.Category == "") {
+		return nil, ErrInvalidPromotionTarget
+	}
+
+	if req.DiscountPercent < 0 || req.DiscountPercent > maxPromotionPercent || (req.DiscountPercent == 0) == (req.DiscountAmount == 0) {
+		return nil, ErrInvalidPromotionDiscount
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+	if err != nil {
+		return nil, ErrInvalidPromotionWindow
+	}
+	endsAt, err := time.Parse(time.RFC3339, req.EndsAt)
+	if err != nil || !endsAt.After(startsAt) {
+		return nil, ErrInvalidPromotionWindow
+	}
+
+	return &models.Promotion{
+		Item:            req.Item,
+		Category:        req.Category,
+		DiscountPercent: req.DiscountPercent,
+		DiscountAmount:  int(req.DiscountAmount),
+		StartsAt:        startsAt.UTC(),
+		EndsAt:          endsAt.UTC(),
+	}, nil
+}
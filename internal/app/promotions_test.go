@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessCreatePromotion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	valid := models.PromotionRequest{Category: "apparel", DiscountPercent: 20, StartsAt: "2025-06-02T09:00:00+03:00", EndsAt: "2025-06-09T09:00:00+03:00"}
+
+	t.Run("Valid", func(t *testing.T) {
+		expected := models.Promotion{
+			Category: "apparel", DiscountPercent: 20,
+			StartsAt: time.Date(2025, 6, 2, 6, 0, 0, 0, time.UTC), EndsAt: time.Date(2025, 6, 9, 6, 0, 0, 0, time.UTC),
+		}
+		created := expected
+		created.ID = 1
+		mockDB.EXPECT().CreatePromotion(ctx, expected).Return(&created, nil)
+
+		promotion, err := app.ProcessCreatePromotion(ctx, valid)
+		require.NoError(t, err)
+		assert.Equal(t, &created, promotion)
+	})
+
+	t.Run("Unknown item", func(t *testing.T) {
+		req := valid
+		req.Item, req.Category, req.DiscountPercent, req.DiscountAmount = "yacht", "", 0, 50
+		mockDB.EXPECT().CreatePromotion(ctx, gomock.Any()).Return(nil, storage.ErrItemNotFound)
+
+		_, err := app.ProcessCreatePromotion(ctx, req)
+		assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	})
+
+	testCases := []struct {
+		name   string
+		modify func(req *models.PromotionRequest)
+		err    error
+	}{
+		{name: "No target", modify: func(req *models.PromotionRequest) { req.Category = "" }, err: ErrInvalidPromotionTarget},
+		{name: "Item and category", modify: func(req *models.PromotionRequest) { req.Item = "hoody" }, err: ErrInvalidPromotionTarget},
+		{name: "No discount", modify: func(req *models.PromotionRequest) { req.DiscountPercent = 0 }, err: ErrInvalidPromotionDiscount},
+		{name: "Percent and amount", modify: func(req *models.PromotionRequest) { req.DiscountAmount = 10 }, err: ErrInvalidPromotionDiscount},
+		{name: "Whole price", modify: func(req *models.PromotionRequest) { req.DiscountPercent = 100 }, err: ErrInvalidPromotionDiscount},
+		{name: "Negative percent", modify: func(req *models.PromotionRequest) { req.DiscountPercent = -20 }, err: ErrInvalidPromotionDiscount},
+		{name: "Malformed start", modify: func(req *models.PromotionRequest) { req.StartsAt = "monday" }, err: ErrInvalidPromotionWindow},
+		{name: "End before start", modify: func(req *models.PromotionRequest) { req.StartsAt, req.EndsAt = req.EndsAt, req.StartsAt }, err: ErrInvalidPromotionWindow},
+		{name: "Empty window", modify: func(req *models.PromotionRequest) { req.EndsAt = "2025-06-02T06:00:00Z" }, err: ErrInvalidPromotionWindow},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := valid
+			tc.modify(&req)
+
+			_, err := app.ProcessCreatePromotion(ctx, req)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestProcessUpdatePromotion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	req := models.PromotionRequest{Item: "hoody", DiscountAmount: 100, StartsAt: "2025-06-02T00:00:00Z", EndsAt: "2025-06-02T00:00:01Z"}
+	expected := models.Promotion{
+		ID: 7, Item: "hoody", DiscountAmount: 100,
+		StartsAt: time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), EndsAt: time.Date(2025, 6, 2, 0, 0, 1, 0, time.UTC),
+	}
+	mockDB.EXPECT().UpdatePromotion(ctx, expected).Return(&expected, nil)
+
+	promotion, err := app.ProcessUpdatePromotion(ctx, 7, req)
+	require.NoError(t, err)
+	assert.Equal(t, &expected, promotion, "a window of a single second is valid")
+
+	mockDB.EXPECT().UpdatePromotion(ctx, gomock.Any()).Return(nil, storage.ErrPromotionNotFound)
+	_, err = app.ProcessUpdatePromotion(ctx, 8, req)
+	assert.ErrorIs(t, err, storage.ErrPromotionNotFound)
+}
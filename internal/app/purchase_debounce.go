@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultPurchaseDebounceWindow is how long a purchase of an item blocks another purchase of the same item
+// by the same user, unless configured otherwise with SetPurchaseDebounce.
+const DefaultPurchaseDebounceWindow = 3 * time.Second
+
+// ErrDuplicatePurchase indicates that the user bought the same item moments ago, most likely with a double click,
+// and the purchase was not confirmed to be intended (see WithDuplicateConfirmed).
+var ErrDuplicatePurchase = errors.New("app: duplicate purchase")
+
+// purchaseKey identifies the purchases of an item by a user.
+type purchaseKey struct {
+	userID   int32
+	itemName string
+}
+
+// purchaseDebouncer remembers the last purchase of every item by every user for the length of the window.
+// Entries past the window are removed lazily, at most once per window.
+type purchaseDebouncer struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	last      map[purchaseKey]time.Time // Time of the last purchase of an item by a user.
+	nextSweep time.Time                 // Earliest time of the next removal of expired entries.
+}
+
+// newPurchaseDebouncer creates a purchaseDebouncer rejecting repeated purchases within window.
+func newPurchaseDebouncer(window time.Duration) *purchaseDebouncer {
+	return &purchaseDebouncer{window: window, last: make(map[purchaseKey]time.Time)}
+}
+
+// claim records a purchase of the item by the user at now. It reports false, recording nothing, when the user
+// bought the same item less than the window ago, unless force is set. Purchases of other items are never blocked.
+func (debouncer *purchaseDebouncer) claim(userID int32, itemName string, now time.Time, force bool) bool {
+	debouncer.mu.Lock()
+	defer debouncer.mu.Unlock()
+
+	if !now.Before(debouncer.nextSweep) {
+		for key, at := range debouncer.last {
+			if now.Sub(at) >= debouncer.window {
+				delete(debouncer.last, key)
+			}
+		}
+		debouncer.nextSweep = now.Add(debouncer.window)
+	}
+
+	key := purchaseKey{userID: userID, itemName: itemName}
+	if at, ok := debouncer.last[key]; ok && now.Sub(at) < debouncer.window && !force {
+		return false
+	}
+
+	debouncer.last[key] = now
+	return true
+}
+
+// release forgets the purchase claimed at the given time, so that a failed purchase can be retried at once.
+// A later claim of the same item is kept.
+func (debouncer *purchaseDebouncer) release(userID int32, itemName string, at time.Time) {
+	debouncer.mu.Lock()
+	defer debouncer.mu.Unlock()
+
+	key := purchaseKey{userID: userID, itemName: itemName}
+	if debouncer.last[key].Equal(at) {
+		delete(debouncer.last, key)
+	}
+}
+
+// SetPurchaseDebounce enables rejecting a purchase with ErrDuplicatePurchase when the user bought the same item
+// less than window ago. A zero window disables the check.
+func (app *App) SetPurchaseDebounce(window time.Duration) {
+	if window <= 0 {
+		app.purchaseDebounce = nil
+		return
+	}
+	app.purchaseDebounce = newPurchaseDebouncer(window)
+}
+
+// duplicateConfirmedContextKey is the context key under which WithDuplicateConfirmed marks a purchase.
+type duplicateConfirmedContextKey struct{}
+
+// WithDuplicateConfirmed returns a context marking the purchase made with it as intended even if it repeats
+// a recent purchase of the same item, so that it is not rejected with ErrDuplicatePurchase.
+func WithDuplicateConfirmed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, duplicateConfirmedContextKey{}, true)
+}
+
+// isDuplicateConfirmed reports whether ctx was marked by WithDuplicateConfirmed.
+func isDuplicateConfirmed(ctx context.Context) bool {
+	confirmed, _ := ctx.Value(duplicateConfirmedContextKey{}).(bool)
+	return confirmed
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessBuy_Debounce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	fakeClock := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(fakeClock)
+	app.SetPurchaseDebounce(DefaultPurchaseDebounceWindow)
+	ctx := context.Background()
+
+	purchase := &models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1}
+
+	t.Run("Duplicate", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(ctx, int32(1), "cup").Return(purchase, nil)
+		_, err := app.ProcessBuy(ctx, 1, "cup")
+		require.NoError(t, err)
+
+		fakeClock.Advance(time.Second)
+		_, err = app.ProcessBuy(ctx, 1, "cup")
+		assert.ErrorIs(t, err, ErrDuplicatePurchase)
+	})
+
+	t.Run("Confirmed duplicate", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Return(purchase, nil)
+		_, err := app.ProcessBuy(WithDuplicateConfirmed(ctx), 1, "cup")
+		require.NoError(t, err)
+	})
+
+	t.Run("Distinct items and users", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(ctx, int32(1), "pen").Return(&models.PurchaseResult{Item: "pen"}, nil)
+		mockDB.EXPECT().BuyItem(ctx, int32(2), "cup").Return(purchase, nil)
+		_, err := app.ProcessBuy(ctx, 1, "pen")
+		require.NoError(t, err)
+		_, err = app.ProcessBuy(ctx, 2, "cup")
+		require.NoError(t, err)
+	})
+
+	t.Run("Window elapsed", func(t *testing.T) {
+		fakeClock.Advance(DefaultPurchaseDebounceWindow)
+		mockDB.EXPECT().BuyItem(ctx, int32(1), "cup").Return(purchase, nil)
+		_, err := app.ProcessBuy(ctx, 1, "cup")
+		require.NoError(t, err)
+	})
+
+	t.Run("Failed purchase", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(ctx, int32(3), "hoody").Return(nil, storage.ErrInsufficientFunds)
+		mockDB.EXPECT().BuyItem(ctx, int32(3), "hoody").Return(&models.PurchaseResult{Item: "hoody"}, nil)
+		_, err := app.ProcessBuy(ctx, 3, "hoody")
+		require.ErrorIs(t, err, storage.ErrInsufficientFunds)
+		_, err = app.ProcessBuy(ctx, 3, "hoody")
+		require.NoError(t, err, "a failed purchase must not block its retry")
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		dryRun := storage.WithDryRun(ctx)
+		mockDB.EXPECT().BuyItem(dryRun, int32(4), "cup").Times(2).Return(purchase, nil)
+		for i := 0; i < 2; i++ {
+			_, err := app.ProcessBuy(dryRun, 4, "cup")
+			require.NoError(t, err, "dry runs are not debounced")
+		}
+	})
+}
+
+func TestPurchaseDebouncer_Sweep(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	debouncer := newPurchaseDebouncer(time.Second)
+
+	for i := int32(0); i < 100; i++ {
+		assert.True(t, debouncer.claim(i, "cup", now, false))
+	}
+	assert.True(t, debouncer.claim(0, "pen", now.Add(time.Second), false))
+	assert.Len(t, debouncer.last, 1, "expired entries must be removed lazily")
+}
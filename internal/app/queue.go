@@ -0,0 +1,287 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// Statuses of a queued purchase.
+const (
+	QueueStatusPending   = "pending"
+	QueueStatusCompleted = "completed"
+	QueueStatusFailed    = "failed"
+	QueueStatusExpired   = "expired"
+)
+
+// Predefined errors returned by the purchase queue.
+var (
+	// ErrQueueFull indicates that the queue of the requested item has no free slots.
+	ErrQueueFull = errors.New("app: purchase queue is full")
+	// ErrQueueTicketNotFound indicates that the queue token is unknown or belongs to another user.
+	ErrQueueTicketNotFound = errors.New("app: purchase queue ticket not found")
+	// ErrItemNotQueued indicates that purchases of the item do not go through the queue.
+	ErrItemNotQueued = errors.New("app: item is not sold through the purchase queue")
+)
+
+// queueBuyTimeout bounds a single BuyItem call executed by the queue worker.
+const queueBuyTimeout = 10 * time.Second
+
+// queueEntry is a single purchase waiting in, or processed by, an item queue.
+type queueEntry struct {
+	token      string
+	userID     int32
+	itemName   string
+	expiresAt  time.Time
+	finishedAt time.Time
+	inFlight   bool
+	status     string
+	err        error
+}
+
+// QueuedPurchase describes the state of a purchase submitted to the queue.
+type QueuedPurchase struct {
+	Item     string
+	Status   string
+	Position int   // Position in the queue, set while the purchase is pending.
+	Err      error // Error returned by BuyItem, set when the purchase failed.
+}
+
+// itemQueue holds the pending purchases of a single flash-sale item in arrival order.
+type itemQueue struct {
+	pending []*queueEntry
+	notify  chan struct{}
+}
+
+// PurchaseQueue serializes purchases of designated flash-sale items.
+// Each item has a bounded in-memory queue drained in order by a worker that executes BuyItem.
+// Entries that expire before being processed or that fail release their slot.
+type PurchaseQueue struct {
+	db       storage.Storage
+	log      *logger.Logger
+	capacity int
+	ttl      time.Duration
+	clock    clock.Clock
+
+	mu      sync.Mutex
+	queues  map[string]*itemQueue
+	entries map[string]*queueEntry
+}
+
+// NewPurchaseQueue creates a PurchaseQueue for the given items.
+// Each item queue holds at most capacity pending purchases, and each purchase waits at most ttl.
+func NewPurchaseQueue(db storage.Storage, items []string, capacity int, ttl time.Duration, l *logger.Logger) *PurchaseQueue {
+	queues := make(map[string]*itemQueue, len(items))
+	for _, item := range items {
+		queues[item] = &itemQueue{notify: make(chan struct{}, 1)}
+	}
+
+	return &PurchaseQueue{
+		db:       db,
+		log:      l,
+		capacity: capacity,
+		ttl:      ttl,
+		clock:    clock.Real{},
+		queues:   queues,
+		entries:  make(map[string]*queueEntry),
+	}
+}
+
+// SetClock replaces the source of the current time used to expire queued purchases.
+func (queue *PurchaseQueue) SetClock(c clock.Clock) {
+	queue.clock = c
+}
+
+// IsQueued reports whether purchases of the item go through the queue.
+func (queue *PurchaseQueue) IsQueued(itemName string) bool {
+	_, ok := queue.queues[itemName]
+	return ok
+}
+
+// Enqueue adds a purchase to the item's queue and returns a ticket to poll its status.
+// It returns ErrQueueFull when every slot of the queue is taken.
+func (queue *PurchaseQueue) Enqueue(userID int32, itemName string) (*models.QueueTicket, error) {
+	token, err := newQueueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	q, ok := queue.queues[itemName]
+	if !ok {
+		return nil, ErrItemNotQueued
+	}
+
+	now := queue.clock.Now()
+	queue.expire(q, now)
+	queue.forgetFinished(now)
+
+	if len(q.pending) >= queue.capacity {
+		return nil, ErrQueueFull
+	}
+
+	entry := &queueEntry{
+		token:     token,
+		userID:    userID,
+		itemName:  itemName,
+		expiresAt: now.Add(queue.ttl),
+		status:    QueueStatusPending,
+	}
+	q.pending = append(q.pending, entry)
+	queue.entries[token] = entry
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return &models.QueueTicket{Token: token, Position: len(q.pending)}, nil
+}
+
+// Status returns the state of a queued purchase owned by the user.
+// It returns ErrQueueTicketNotFound for unknown tokens and tokens of other users.
+func (queue *PurchaseQueue) Status(userID int32, token string) (*QueuedPurchase, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	entry, ok := queue.entries[token]
+	if !ok || entry.userID != userID {
+		return nil, ErrQueueTicketNotFound
+	}
+
+	q := queue.queues[entry.itemName]
+	queue.expire(q, queue.clock.Now())
+
+	purchase := &QueuedPurchase{Item: entry.itemName, Status: entry.status, Err: entry.err}
+	if entry.status == QueueStatusPending {
+		purchase.Position = q.position(entry)
+	}
+
+	return purchase, nil
+}
+
+// Run drains every item queue until ctx is canceled. It implements worker.Worker.
+func (queue *PurchaseQueue) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for itemName, q := range queue.queues {
+		wg.Add(1)
+		go func(itemName string, q *itemQueue) {
+			defer wg.Done()
+			queue.drain(ctx, itemName, q)
+		}(itemName, q)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// drain processes the purchases of a single item in arrival order.
+func (queue *PurchaseQueue) drain(ctx context.Context, itemName string, q *itemQueue) {
+	for {
+		entry := queue.next(q)
+		if entry == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.notify:
+				continue
+			}
+		}
+
+		buyCtx, cancel := context.WithTimeout(ctx, queueBuyTimeout)
+		_, err := queue.db.BuyItem(buyCtx, entry.userID, itemName)
+		cancel()
+
+		queue.finish(q, entry, err)
+		if err != nil {
+			queue.log.Sugar().Infof("Queued purchase of %s by user %d failed: %s",
+				logger.Truncate(itemName, logger.MaxLoggedItemNameLength), entry.userID, err)
+		}
+	}
+}
+
+// next pops the first non-expired pending entry of the queue, or returns nil when the queue is empty.
+func (queue *PurchaseQueue) next(q *itemQueue) *queueEntry {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	queue.expire(q, queue.clock.Now())
+	if len(q.pending) == 0 {
+		return nil
+	}
+
+	entry := q.pending[0]
+	entry.inFlight = true
+	return entry
+}
+
+// finish records the outcome of a processed entry and removes it from the pending list.
+func (queue *PurchaseQueue) finish(q *itemQueue, entry *queueEntry, err error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	entry.finishedAt = queue.clock.Now()
+	entry.status = QueueStatusCompleted
+	if err != nil {
+		entry.status = QueueStatusFailed
+		entry.err = err
+	}
+
+	if len(q.pending) > 0 && q.pending[0] == entry {
+		q.pending = q.pending[1:]
+	}
+}
+
+// expire marks pending entries past their deadline as expired, releasing their slots.
+// The entry currently being processed never expires.
+func (queue *PurchaseQueue) expire(q *itemQueue, now time.Time) {
+	kept := q.pending[:0]
+	for _, entry := range q.pending {
+		if !entry.inFlight && now.After(entry.expiresAt) {
+			entry.status = QueueStatusExpired
+			entry.finishedAt = now
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	q.pending = kept
+}
+
+// position returns the 1-based position of a pending entry in the queue.
+func (q *itemQueue) position(entry *queueEntry) int {
+	for i, pending := range q.pending {
+		if pending == entry {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// forgetFinished drops finished entries that were kept for polling longer than the queue TTL.
+func (queue *PurchaseQueue) forgetFinished(now time.Time) {
+	for token, entry := range queue.entries {
+		if entry.status != QueueStatusPending && now.Sub(entry.finishedAt) > queue.ttl {
+			delete(queue.entries, token)
+		}
+	}
+}
+
+// newQueueToken generates a random token identifying a queued purchase.
+func newQueueToken() (string, error) {
+	const tokenBytes = 16
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
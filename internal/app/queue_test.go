@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestPurchaseQueue_DropWithMoreBuyersThanSlots(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	queue := NewPurchaseQueue(mockDB, []string{"pink-hoody"}, 3, time.Minute, &logger.Logger{Logger: zap.NewNop()})
+
+	insufficientFunds := &pgconn.PgError{Code: pgerrcode.CheckViolation, ConstraintName: "users_coins_check"}
+	gomock.InOrder(
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "pink-hoody").Return(&models.PurchaseResult{}, nil),
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(2), "pink-hoody").Return(nil, insufficientFunds),
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(3), "pink-hoody").Return(&models.PurchaseResult{}, nil),
+	)
+
+	tokens := make(map[int32]string)
+	for userID := int32(1); userID <= 5; userID++ {
+		ticket, err := queue.Enqueue(userID, "pink-hoody")
+		if userID > 3 {
+			assert.ErrorIs(t, err, ErrQueueFull, "buyer %d should not fit into the queue", userID)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, int(userID), ticket.Position)
+		tokens[userID] = ticket.Token
+	}
+
+	purchase, err := queue.Status(3, tokens[3])
+	require.NoError(t, err)
+	assert.Equal(t, QueueStatusPending, purchase.Status)
+	assert.Equal(t, 3, purchase.Position)
+
+	_, err = queue.Status(4, tokens[3])
+	assert.ErrorIs(t, err, ErrQueueTicketNotFound, "a ticket must not be visible to other users")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- queue.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		purchase, err := queue.Status(3, tokens[3])
+		return err == nil && purchase.Status != QueueStatusPending
+	}, time.Second, 5*time.Millisecond)
+
+	first, err := queue.Status(1, tokens[1])
+	require.NoError(t, err)
+	assert.Equal(t, QueueStatusCompleted, first.Status)
+
+	second, err := queue.Status(2, tokens[2])
+	require.NoError(t, err)
+	assert.Equal(t, QueueStatusFailed, second.Status)
+	assert.ErrorIs(t, second.Err, insufficientFunds)
+
+	third, err := queue.Status(3, tokens[3])
+	require.NoError(t, err)
+	assert.Equal(t, QueueStatusCompleted, third.Status)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(4), "pink-hoody").Return(&models.PurchaseResult{}, nil)
+	ticket, err := queue.Enqueue(4, "pink-hoody")
+	require.NoError(t, err, "processed purchases must release their slots")
+
+	require.Eventually(t, func() bool {
+		purchase, err := queue.Status(4, ticket.Token)
+		return err == nil && purchase.Status == QueueStatusCompleted
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestPurchaseQueue_ExpiredEntryReleasesSlot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	queue := NewPurchaseQueue(mockDB, []string{"pink-hoody"}, 1, 20*time.Millisecond, &logger.Logger{Logger: zap.NewNop()})
+	fakeClock := clock.NewFake(time.Now())
+	queue.SetClock(fakeClock)
+
+	expired, err := queue.Enqueue(1, "pink-hoody")
+	require.NoError(t, err)
+
+	_, err = queue.Enqueue(2, "pink-hoody")
+	require.ErrorIs(t, err, ErrQueueFull)
+
+	fakeClock.Advance(30 * time.Millisecond)
+
+	_, err = queue.Enqueue(2, "pink-hoody")
+	require.NoError(t, err, "expired purchase must release its slot")
+
+	purchase, err := queue.Status(1, expired.Token)
+	require.NoError(t, err)
+	assert.Equal(t, QueueStatusExpired, purchase.Status)
+}
+
+func TestPurchaseQueue_OnlyDesignatedItems(t *testing.T) {
+	queue := NewPurchaseQueue(nil, []string{"pink-hoody"}, 1, time.Minute, &logger.Logger{Logger: zap.NewNop()})
+
+	assert.True(t, queue.IsQueued("pink-hoody"))
+	assert.False(t, queue.IsQueued("cup"))
+
+	_, err := queue.Enqueue(1, "cup")
+	assert.ErrorIs(t, err, ErrItemNotQueued)
+}
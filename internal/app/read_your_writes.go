@@ -0,0 +1,90 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"merch_store/internal/pkg/metrics"
+	"merch_store/internal/storage"
+)
+
+// DefaultReadYourWritesWindow is how long the reads of a user go to the primary after the user changed their
+// balance or inventory, unless configured otherwise with SetReadReplica.
+const DefaultReadYourWritesWindow = 3 * time.Second
+
+// recentWriters remembers the last mutation of every user for the length of the window.
+// Entries past the window are removed lazily, at most once per window.
+type recentWriters struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	last      map[int32]time.Time // Time of the last mutation by a user.
+	nextSweep time.Time           // Earliest time of the next removal of expired entries.
+}
+
+// newRecentWriters creates a recentWriters remembering mutations for window.
+func newRecentWriters(window time.Duration) *recentWriters {
+	return &recentWriters{window: window, last: make(map[int32]time.Time)}
+}
+
+// record remembers a mutation by the user at now.
+func (writers *recentWriters) record(userID int32, now time.Time) {
+	writers.mu.Lock()
+	defer writers.mu.Unlock()
+
+	if !now.Before(writers.nextSweep) {
+		for key, at := range writers.last {
+			if now.Sub(at) >= writers.window {
+				delete(writers.last, key)
+			}
+		}
+		writers.nextSweep = now.Add(writers.window)
+	}
+
+	writers.last[userID] = now
+}
+
+// wroteRecently reports whether the user made a mutation less than the window before now.
+func (writers *recentWriters) wroteRecently(userID int32, now time.Time) bool {
+	writers.mu.Lock()
+	defer writers.mu.Unlock()
+
+	at, ok := writers.last[userID]
+	return ok && now.Sub(at) < writers.window
+}
+
+// SetReadReplica routes the reads of ProcessInfo, ProcessPartialInfo, ProcessCoinHistory, and
+// ProcessCatalogWithAffordability to replica, a storage connected to a read replica of the database. As the replica
+// lags behind, a user who bought, gifted, transferred, or consumed something keeps reading from the primary for
+// window after that, so that the user sees their own changes; such reads are counted in metrics.PrimaryForcedReads.
+// A zero window uses DefaultReadYourWritesWindow, and a nil replica sends every read to the primary.
+func (app *App) SetReadReplica(replica storage.Storage, window time.Duration) {
+	if replica == nil {
+		app.replica, app.recentWriters = nil, nil
+		return
+	}
+	if window <= 0 {
+		window = DefaultReadYourWritesWindow
+	}
+	app.replica, app.recentWriters = replica, newRecentWriters(window)
+}
+
+// recordWrite notes that the user changed their balance or inventory, so that their next reads go to the primary.
+func (app *App) recordWrite(userID int32) {
+	if app.recentWriters != nil {
+		app.recentWriters.record(userID, app.Now())
+	}
+}
+
+// reader returns the storage to read the data of the user from: the replica, unless none is set or the user made
+// a mutation within the read-your-writes window.
+func (app *App) reader(userID int32) storage.Storage {
+	if app.replica == nil {
+		return app.db
+	}
+	if app.recentWriters.wroteRecently(userID, app.Now()) {
+		metrics.PrimaryForcedReads.Inc()
+		return app.db
+	}
+	return app.replica
+}
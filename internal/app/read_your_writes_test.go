@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/metrics"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mocks.NewMockStorage(ctrl)
+	replica := mocks.NewMockStorage(ctrl)
+	app := NewApp(primary, &logger.Logger{Logger: zap.NewNop()})
+	fakeClock := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	app.SetClock(fakeClock)
+	app.SetReadReplica(replica, 0)
+	ctx := context.Background()
+
+	// The replica lags behind: it still shows the buyer without the item.
+	stale := &models.InfoResponse{Coins: 1000}
+	fresh := &models.InfoResponse{Coins: 990, Inventory: []models.InventoryItem{{Type: "pen", Quantity: 1}}}
+
+	t.Run("Reads go to the replica", func(t *testing.T) {
+		replica.EXPECT().GetInfo(ctx, int32(1)).Return(stale, nil)
+
+		info, err := app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000), info.Coins)
+	})
+
+	t.Run("Info after a buy hits the primary", func(t *testing.T) {
+		before := metrics.PrimaryForcedReads.Value()
+		primary.EXPECT().BuyItem(ctx, int32(1), "pen").Return(&models.PurchaseResult{Item: "pen", Price: 10, RemainingCoins: 990}, nil)
+		primary.EXPECT().GetInfo(ctx, int32(1)).Return(fresh, nil)
+		replica.EXPECT().GetInfo(ctx, int32(2)).Return(&models.InfoResponse{Coins: 500}, nil)
+
+		_, err := app.ProcessBuy(ctx, 1, "pen")
+		require.NoError(t, err)
+
+		fakeClock.Advance(DefaultReadYourWritesWindow - time.Millisecond)
+		info, err := app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(990), info.Coins, "the buyer must see their purchase")
+		assert.Equal(t, before+1, metrics.PrimaryForcedReads.Value())
+
+		_, err = app.ProcessInfo(ctx, 2)
+		require.NoError(t, err, "an unrelated user must keep reading from the replica")
+		assert.Equal(t, before+1, metrics.PrimaryForcedReads.Value())
+	})
+
+	t.Run("Back to the replica after the window", func(t *testing.T) {
+		fakeClock.Advance(time.Millisecond)
+		replica.EXPECT().GetInfo(ctx, int32(1)).Return(fresh, nil)
+
+		_, err := app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("Dry runs are not writes", func(t *testing.T) {
+		dryRun := storage.WithDryRun(ctx)
+		primary.EXPECT().TransferCoins(dryRun, int32(1), gomock.Any()).Return(&models.TransferResult{}, nil)
+		replica.EXPECT().GetInfo(ctx, int32(1)).Return(fresh, nil)
+
+		_, err := app.ProcessSendCoin(dryRun, 1, models.SendCoinRequest{ToUser: "user", Amount: 1})
+		require.NoError(t, err)
+		_, err = app.ProcessInfo(ctx, 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("No replica", func(t *testing.T) {
+		app.SetReadReplica(nil, 0)
+		primary.EXPECT().GetInfo(ctx, int32(2)).Return(&models.InfoResponse{Coins: 500}, nil)
+
+		_, err := app.ProcessInfo(ctx, 2)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"context"
+
+	"merch_store/internal/models"
+)
+
+// ProcessReceipt returns the receipt of one of the user's purchases by its receipt number.
+func (app *App) ProcessReceipt(ctx context.Context, userID int32, number string) (*models.Receipt, error) {
+	return app.db.GetReceipt(ctx, userID, number)
+}
+
+// ProcessRedeemReceipt marks the purchase with the receipt number as handed out at the front desk by the administrator.
+func (app *App) ProcessRedeemReceipt(ctx context.Context, adminID int32, number string) (*models.Receipt, error) {
+	receipt, err := app.db.RedeemReceipt(ctx, adminID, number, app.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	app.log.Sugar().Infof("Receipt %s of %s redeemed by admin %d", receipt.Number, receipt.Owner, adminID)
+	return receipt, nil
+}
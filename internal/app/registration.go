@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"merch_store/internal/models"
+)
+
+// RegistrationMode controls whether signing in with an unknown username creates a new user.
+type RegistrationMode string
+
+// Supported registration modes.
+const (
+	// RegistrationOpen creates a new user for every unknown username.
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationClosed only lets existing users sign in.
+	RegistrationClosed RegistrationMode = "closed"
+	// RegistrationInvite creates a new user only when the request carries an unused, unexpired invite code.
+	RegistrationInvite RegistrationMode = "invite"
+)
+
+// Limits of the validity of invite codes.
+const (
+	// DefaultInviteValidity is how long an invite code stays usable unless requested otherwise.
+	DefaultInviteValidity = 7 * 24 * time.Hour
+	// maxInviteValidity is the longest validity an administrator may request.
+	maxInviteValidity = 90 * 24 * time.Hour
+)
+
+// inviteCodeBytes is the number of random bytes in an invite code.
+const inviteCodeBytes = 16
+
+// Predefined errors for registration.
+var (
+	// ErrRegistrationClosed indicates that the username is unknown and new users cannot register.
+	ErrRegistrationClosed = errors.New("app: registration is closed")
+	// ErrInviteCodeRequired indicates that registration is invite-only and the request has no invite code.
+	ErrInviteCodeRequired = errors.New("app: invite code required")
+	// ErrInvalidInviteValidity indicates that the requested validity of an invite code is not a positive duration within the limit.
+	ErrInvalidInviteValidity = errors.New("app: invalid invite validity")
+)
+
+// ParseRegistrationMode converts a configured registration mode name into a RegistrationMode.
+// An empty name selects RegistrationOpen.
+func ParseRegistrationMode(name string) (RegistrationMode, error) {
+	switch mode := RegistrationMode(name); mode {
+	case "":
+		return RegistrationOpen, nil
+	case RegistrationOpen, RegistrationClosed, RegistrationInvite:
+		return mode, nil
+	default:
+		return RegistrationOpen, fmt.Errorf("app: unsupported registration mode %q", name)
+	}
+}
+
+// SetRegistrationMode selects how unknown usernames are handled by ProcessAuth.
+func (app *App) SetRegistrationMode(mode RegistrationMode) {
+	app.registrationMode = mode
+}
+
+// registerUser creates a new user as allowed by the registration mode. While registration is open, registrations
+// from clientIP are subject to the registration cooldown, if enabled (see SetRegistrationCooldown).
+func (app *App) registerUser(ctx context.Context, user *models.User, inviteCode string, clientIP net.IP) (*models.User, error) {
+	switch app.registrationMode {
+	case RegistrationClosed:
+		return nil, ErrRegistrationClosed
+	case RegistrationInvite:
+		if inviteCode == "" {
+			return nil, ErrInviteCodeRequired
+		}
+		return app.db.CreateUserWithInvite(ctx, user, inviteCode, app.Now())
+	default:
+		if app.registrationCooldown == nil {
+			return app.db.CreateUser(ctx, user)
+		}
+
+		now := app.Now()
+		if !app.registrationCooldown.claim(clientIP, now) {
+			return nil, ErrRegistrationRateLimited
+		}
+		created, err := app.db.CreateUser(ctx, user)
+		if err != nil {
+			app.registrationCooldown.release(clientIP, now)
+		}
+		return created, err
+	}
+}
+
+// ProcessCreateInvite creates a single-use invite code on behalf of the administrator.
+// The code expires after the requested validity, or DefaultInviteValidity when none is requested.
+func (app *App) ProcessCreateInvite(ctx context.Context, userID int32, req models.InviteRequest) (*models.InviteCode, error) {
+	validity := DefaultInviteValidity
+	if req.ValidFor != "" {
+		parsed, err := time.ParseDuration(req.ValidFor)
+		if err != nil || parsed <= 0 || parsed > maxInviteValidity {
+			return nil, ErrInvalidInviteValidity
+		}
+		validity = parsed
+	}
+
+	code := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(code); err != nil {
+		return nil, err
+	}
+
+	invite := models.InviteCode{Code: hex.EncodeToString(code), ExpiresAt: app.Now().Add(validity)}
+	if err := app.db.CreateInviteCode(ctx, invite, userID); err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
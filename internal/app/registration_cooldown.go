@@ -0,0 +1,101 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"merch_store/internal/pkg/ratelimit"
+)
+
+// DefaultRegistrationCooldown is how long a registration from a client address blocks other registrations from
+// the same address, unless configured otherwise with SetRegistrationCooldown.
+const DefaultRegistrationCooldown = 10 * time.Minute
+
+// ErrRegistrationRateLimited indicates that another user registered from the client address less than the
+// registration cooldown ago.
+var ErrRegistrationRateLimited = errors.New("app: registration rate limited")
+
+// registrationCooldown remembers the last registration from every client address, keyed by ratelimit.Key, for the
+// length of the cooldown. Entries past the cooldown are removed lazily, at most once per cooldown.
+type registrationCooldown struct {
+	cooldown  time.Duration
+	allowlist []*net.IPNet
+
+	mu        sync.Mutex
+	last      map[string]time.Time // Time of the last registration from a client address.
+	nextSweep time.Time            // Earliest time of the next removal of expired entries.
+}
+
+// newRegistrationCooldown creates a registrationCooldown rejecting registrations within cooldown of one another,
+// except from the addresses in allowlist.
+func newRegistrationCooldown(cooldown time.Duration, allowlist []*net.IPNet) *registrationCooldown {
+	return &registrationCooldown{cooldown: cooldown, allowlist: allowlist, last: make(map[string]time.Time)}
+}
+
+// claim records a registration from ip at now. It reports false, recording nothing, when another user registered
+// from the same address less than the cooldown ago. Addresses in the allowlist, and requests whose address is
+// unknown, are never blocked.
+func (cooldown *registrationCooldown) claim(ip net.IP, now time.Time) bool {
+	if ip == nil || cooldown.isAllowed(ip) {
+		return true
+	}
+
+	cooldown.mu.Lock()
+	defer cooldown.mu.Unlock()
+
+	if !now.Before(cooldown.nextSweep) {
+		for key, at := range cooldown.last {
+			if now.Sub(at) >= cooldown.cooldown {
+				delete(cooldown.last, key)
+			}
+		}
+		cooldown.nextSweep = now.Add(cooldown.cooldown)
+	}
+
+	key := ratelimit.Key(ip)
+	if at, ok := cooldown.last[key]; ok && now.Sub(at) < cooldown.cooldown {
+		return false
+	}
+
+	cooldown.last[key] = now
+	return true
+}
+
+// release forgets the registration claimed at the given time, so that a failed registration can be retried at once.
+// A later claim from the same address is kept.
+func (cooldown *registrationCooldown) release(ip net.IP, at time.Time) {
+	if ip == nil {
+		return
+	}
+
+	cooldown.mu.Lock()
+	defer cooldown.mu.Unlock()
+
+	key := ratelimit.Key(ip)
+	if cooldown.last[key].Equal(at) {
+		delete(cooldown.last, key)
+	}
+}
+
+// isAllowed reports whether ip belongs to the allowlist.
+func (cooldown *registrationCooldown) isAllowed(ip net.IP) bool {
+	for _, network := range cooldown.allowlist {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRegistrationCooldown enables rejecting a registration with ErrRegistrationRateLimited when another user
+// registered from the same client address (see models.AuthRequest) less than cooldown ago, while registration is
+// open. Addresses in allowlist, such as the NAT addresses of offices, are exempt. A zero cooldown disables the check.
+func (app *App) SetRegistrationCooldown(cooldown time.Duration, allowlist []*net.IPNet) {
+	if cooldown <= 0 {
+		app.registrationCooldown = nil
+		return
+	}
+	app.registrationCooldown = newRegistrationCooldown(cooldown, allowlist)
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrationCooldown(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	_, office, _ := net.ParseCIDR("198.51.100.0/24")
+	cooldown := newRegistrationCooldown(DefaultRegistrationCooldown, []*net.IPNet{office})
+	client := net.ParseIP("203.0.113.1")
+
+	t.Run("Back to back", func(t *testing.T) {
+		assert.True(t, cooldown.claim(client, now))
+		assert.False(t, cooldown.claim(client, now.Add(time.Minute)))
+		assert.True(t, cooldown.claim(net.ParseIP("203.0.113.2"), now.Add(time.Minute)), "other addresses must not be blocked")
+		assert.True(t, cooldown.claim(client, now.Add(DefaultRegistrationCooldown)))
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.True(t, cooldown.claim(net.ParseIP("198.51.100.7"), now))
+		}
+	})
+
+	t.Run("IPv6 network", func(t *testing.T) {
+		assert.True(t, cooldown.claim(net.ParseIP("2001:db8::1"), now))
+		assert.False(t, cooldown.claim(net.ParseIP("2001:db8::2"), now), "addresses of a /64 must share the cooldown")
+	})
+
+	t.Run("Unknown address", func(t *testing.T) {
+		assert.True(t, cooldown.claim(nil, now))
+		assert.True(t, cooldown.claim(nil, now))
+	})
+
+	t.Run("Released", func(t *testing.T) {
+		failed := net.ParseIP("203.0.113.3")
+		assert.True(t, cooldown.claim(failed, now))
+		cooldown.release(failed, now)
+		assert.True(t, cooldown.claim(failed, now), "a failed registration must not block its retry")
+	})
+}
+
+func TestRegistrationCooldown_Sweep(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cooldown := newRegistrationCooldown(time.Minute, nil)
+
+	for i := byte(0); i < 100; i++ {
+		assert.True(t, cooldown.claim(net.IPv4(203, 0, 113, i), now))
+	}
+	assert.True(t, cooldown.claim(net.IPv4(198, 51, 100, 1), now.Add(time.Minute)))
+	assert.Len(t, cooldown.last, 1, "expired entries must be removed lazily")
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestParseRegistrationMode(t *testing.T) {
+	for name, expected := range map[string]RegistrationMode{"": RegistrationOpen, "open": RegistrationOpen, "closed": RegistrationClosed, "invite": RegistrationInvite} {
+		mode, err := ParseRegistrationMode(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, mode)
+	}
+
+	_, err := ParseRegistrationMode("invite-only")
+	assert.Error(t, err)
+}
+
+func TestProcessCreateInvite_Validity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+
+	for _, validFor := range []string{"0s", "-1h", "2161h", "soon"} {
+		_, err := app.ProcessCreateInvite(context.Background(), 1, models.InviteRequest{ValidFor: validFor})
+		assert.ErrorIs(t, err, ErrInvalidInviteValidity, validFor)
+	}
+
+	mockDB.EXPECT().CreateInviteCode(gomock.Any(), gomock.Any(), int32(1)).Return(nil).Times(2)
+	first, err := app.ProcessCreateInvite(context.Background(), 1, models.InviteRequest{ValidFor: "2160h"})
+	require.NoError(t, err)
+	second, err := app.ProcessCreateInvite(context.Background(), 1, models.InviteRequest{})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Code, second.Code, "invite codes must be random")
+}
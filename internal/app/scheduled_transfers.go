@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// maxScheduleAhead is how far in the future a transfer may be scheduled.
+const maxScheduleAhead = 90 * 24 * time.Hour
+
+// scheduledTransferBatchSize is the number of due transfers the worker fetches at a time.
+const scheduledTransferBatchSize = 100
+
+// Predefined errors for scheduled transfers.
+var (
+	// ErrInvalidExecuteAt indicates that the execution time is not an RFC 3339 timestamp in the future within the limit.
+	ErrInvalidExecuteAt = errors.New("app: invalid execution time")
+	// ErrInvalidAmount indicates that the amount of a scheduled transfer is not positive.
+	ErrInvalidAmount = errors.New("app: amount must be positive")
+)
+
+// ScheduledTransferWorker makes scheduled transfers once they are due.
+// Every interval it executes all pending transfers due by then; the state of each transfer is kept
+// in the storage layer, so transfers missed while no worker ran are made on the next start and none is made twice.
+type ScheduledTransferWorker struct {
+	db       storage.Storage
+	log      *logger.Logger
+	clock    clock.Clock
+	interval time.Duration
+}
+
+// NewScheduledTransferWorker creates a ScheduledTransferWorker checking for due transfers every interval.
+func NewScheduledTransferWorker(db storage.Storage, interval time.Duration, c clock.Clock, l *logger.Logger) *ScheduledTransferWorker {
+	return &ScheduledTransferWorker{db: db, log: l, clock: c, interval: interval}
+}
+
+// Run executes due transfers on start and then every interval, until ctx is canceled.
+// It implements worker.Worker.
+func (scheduler *ScheduledTransferWorker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := scheduler.ExecuteDue(ctx); err != nil && ctx.Err() == nil {
+			scheduler.log.Sugar().Errorf("Failed to execute due scheduled transfers: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExecuteDue executes the pending transfers due at the current time and returns how many of them were resolved.
+// Failed transfers are logged as warnings, as there is no other channel to notify their senders through;
+// the senders see the failure and its reason in the list of their scheduled transfers.
+// Transfers that could not be resolved because of an error are left pending and retried on the next run.
+func (scheduler *ScheduledTransferWorker) ExecuteDue(ctx context.Context) (int, error) {
+	now := scheduler.clock.Now()
+	resolved := 0
+
+	for {
+		ids, err := scheduler.db.GetDueScheduledTransfers(ctx, now, scheduledTransferBatchSize)
+		if err != nil {
+			return resolved, err
+		}
+
+		progressed := false
+		for _, id := range ids {
+			scheduled, err := scheduler.db.ExecuteScheduledTransfer(ctx, id, now)
+			if errors.Is(err, storage.ErrScheduledTransferNotPending) {
+				continue
+			}
+			if err != nil {
+				scheduler.log.Sugar().Errorf("Failed to execute scheduled transfer %d: %s", id, err)
+				continue
+			}
+
+			progressed = true
+			resolved++
+			if scheduled.Status == storage.ScheduledTransferFailed {
+				scheduler.log.Sugar().Warnf("Scheduled transfer %d of %d coins from user %d to %s failed: %s",
+					scheduled.ID, scheduled.Amount, scheduled.FromUserID, scheduled.ToUser, scheduled.FailureReason)
+			}
+		}
+
+		if len(ids) < scheduledTransferBatchSize || !progressed {
+			return resolved, nil
+		}
+	}
+}
+
+// ProcessScheduleTransfer schedules a coin transfer to be made at the requested time and holds its coins until then.
+// The execution time must be in the future and at most 90 days ahead. Like ProcessSendCoin, it returns
+// ErrTermsNotAccepted when the user has not accepted the current terms of service.
+func (app *App) ProcessScheduleTransfer(ctx context.Context, userID int32, req models.ScheduleTransferRequest) (*models.ScheduledTransfer, error) {
+	if req.ToUser == "" || req.Amount == 0 {
+		return nil, ErrMissingUsernameOrAmount
+	}
+	if req.Amount < 0 {
+		return nil, ErrInvalidAmount
+	}
+	if err := app.ensureTermsAccepted(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	executeAt, err := time.Parse(time.RFC3339, req.ExecuteAt)
+	if err != nil {
+		return nil, ErrInvalidExecuteAt
+	}
+	now := app.Now()
+	if !executeAt.After(now) || executeAt.Sub(now) > maxScheduleAhead {
+		return nil, ErrInvalidExecuteAt
+	}
+
+	return app.db.CreateScheduledTransfer(ctx, userID, models.SendCoinRequest{ToUser: req.ToUser, Amount: req.Amount}, executeAt.UTC())
+}
+
+// ProcessScheduledTransfers returns the user's scheduled transfers in every status, in order of execution time.
+func (app *App) ProcessScheduledTransfers(ctx context.Context, userID int32) (*models.ScheduledTransfersResponse, error) {
+	scheduledTransfers, err := app.db.GetScheduledTransfers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if scheduledTransfers == nil {
+		scheduledTransfers = []models.ScheduledTransfer{}
+	}
+
+	return &models.ScheduledTransfersResponse{ScheduledTransfers: scheduledTransfers}, nil
+}
+
+// ProcessCancelScheduledTransfer cancels the user's pending scheduled transfer and releases its coins.
+func (app *App) ProcessCancelScheduledTransfer(ctx context.Context, userID int32, scheduledID int64) error {
+	return app.db.CancelScheduledTransfer(ctx, userID, scheduledID, app.Now())
+}
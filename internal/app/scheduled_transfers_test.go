@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestScheduledTransferWorker_ExecuteDue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(start)
+	scheduler := NewScheduledTransferWorker(mockDB, time.Minute, fakeClock, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	mockDB.EXPECT().GetDueScheduledTransfers(ctx, start, scheduledTransferBatchSize).Return([]int64{}, nil)
+	resolved, err := scheduler.ExecuteDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, resolved)
+
+	fakeClock.Advance(time.Minute)
+	now := fakeClock.Now()
+	gomock.InOrder(
+		mockDB.EXPECT().GetDueScheduledTransfers(ctx, now, scheduledTransferBatchSize).Return([]int64{1, 2, 3, 4}, nil),
+		mockDB.EXPECT().ExecuteScheduledTransfer(ctx, int64(1), now).
+			Return(&models.ScheduledTransfer{ID: 1, Status: storage.ScheduledTransferCompleted, TransferID: 10}, nil),
+		mockDB.EXPECT().ExecuteScheduledTransfer(ctx, int64(2), now).
+			Return(&models.ScheduledTransfer{ID: 2, Status: storage.ScheduledTransferFailed, FailureReason: "recipient no longer exists"}, nil),
+		mockDB.EXPECT().ExecuteScheduledTransfer(ctx, int64(3), now).Return(nil, storage.ErrScheduledTransferNotPending),
+		mockDB.EXPECT().ExecuteScheduledTransfer(ctx, int64(4), now).Return(nil, context.DeadlineExceeded),
+	)
+	resolved, err = scheduler.ExecuteDue(ctx)
+	require.NoError(t, err, "errors of single transfers must not stop the run")
+	assert.Equal(t, 2, resolved, "transfers resolved elsewhere or left pending must not be counted")
+
+	mockDB.EXPECT().GetDueScheduledTransfers(ctx, now, scheduledTransferBatchSize).Return(nil, context.Canceled)
+	_, err = scheduler.ExecuteDue(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestScheduledTransferWorker_FetchesUntilDrained(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := NewScheduledTransferWorker(mockDB, time.Minute, clock.NewFake(now), &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	fullBatch := make([]int64, scheduledTransferBatchSize)
+	for i := range fullBatch {
+		fullBatch[i] = int64(i + 1)
+	}
+	gomock.InOrder(
+		mockDB.EXPECT().GetDueScheduledTransfers(ctx, now, scheduledTransferBatchSize).Return(fullBatch, nil),
+		mockDB.EXPECT().GetDueScheduledTransfers(ctx, now, scheduledTransferBatchSize).Return([]int64{101}, nil),
+	)
+	mockDB.EXPECT().ExecuteScheduledTransfer(ctx, gomock.Any(), now).
+		Return(&models.ScheduledTransfer{Status: storage.ScheduledTransferCompleted}, nil).Times(scheduledTransferBatchSize + 1)
+
+	resolved, err := scheduler.ExecuteDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, scheduledTransferBatchSize+1, resolved)
+}
+
+func TestProcessScheduleTransfer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  models.ScheduleTransferRequest
+		err  error
+	}{
+		{name: "missing recipient", req: models.ScheduleTransferRequest{Amount: 10, ExecuteAt: "2025-06-02T12:00:00Z"}, err: ErrMissingUsernameOrAmount},
+		{name: "negative amount", req: models.ScheduleTransferRequest{ToUser: "bob", Amount: -10, ExecuteAt: "2025-06-02T12:00:00Z"}, err: ErrInvalidAmount},
+		{name: "malformed time", req: models.ScheduleTransferRequest{ToUser: "bob", Amount: 10, ExecuteAt: "tomorrow"}, err: ErrInvalidExecuteAt},
+		{name: "past time", req: models.ScheduleTransferRequest{ToUser: "bob", Amount: 10, ExecuteAt: "2025-06-01T12:00:00Z"}, err: ErrInvalidExecuteAt},
+		{name: "too far ahead", req: models.ScheduleTransferRequest{ToUser: "bob", Amount: 10, ExecuteAt: "2025-08-31T12:00:01Z"}, err: ErrInvalidExecuteAt},
+		{name: "past time with offset", req: models.ScheduleTransferRequest{ToUser: "bob", Amount: 10, ExecuteAt: "2025-06-01T14:59:59+03:00"}, err: ErrInvalidExecuteAt},
+		{name: "too far ahead with offset", req: models.ScheduleTransferRequest{ToUser: "bob", Amount: 10, ExecuteAt: "2025-08-31T15:00:01+03:00"}, err: ErrInvalidExecuteAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.ProcessScheduleTransfer(ctx, 1, tt.req)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	executeAt := time.Date(2025, 8, 30, 12, 0, 0, 0, time.UTC)
+	mockDB.EXPECT().CreateScheduledTransfer(ctx, int32(1), models.SendCoinRequest{ToUser: "bob", Amount: 10}, executeAt).
+		Return(&models.ScheduledTransfer{ID: 5, Status: storage.ScheduledTransferPending}, nil)
+	scheduled, err := app.ProcessScheduleTransfer(ctx, 1, models.ScheduleTransferRequest{ToUser: "bob", Amount: 10, ExecuteAt: "2025-08-30T15:00:00+03:00"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), scheduled.ID)
+
+	mockDB.EXPECT().CancelScheduledTransfer(ctx, int32(1), int64(5), now).Return(storage.ErrScheduledTransferNotPending)
+	err = app.ProcessCancelScheduledTransfer(ctx, 1, 5)
+	assert.ErrorIs(t, err, storage.ErrScheduledTransferNotPending)
+}
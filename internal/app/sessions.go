@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+)
+
+// Predefined errors for session tracking.
+var (
+	// ErrSessionRevoked indicates that the token's session has been revoked, explicitly or by the session limit.
+	ErrSessionRevoked = errors.New("app: session revoked")
+	// ErrSessionsDisabled indicates that session tracking is not configured.
+	ErrSessionsDisabled = errors.New("app: session tracking is disabled")
+)
+
+// SetSessionLimit enables session tracking with at most limit active sessions per user.
+// Issuing a token beyond the limit revokes the user's oldest session. A zero limit disables tracking.
+func (app *App) SetSessionLimit(limit int) {
+	app.sessionLimit = limit
+}
+
+// registerSession records the issued token as a session of the user when session tracking is enabled.
+func (app *App) registerSession(ctx context.Context, userID int32, token *auth.IssuedToken, userAgent string) error {
+	if app.sessionLimit <= 0 {
+		return nil
+	}
+
+	session := models.Session{ID: token.ID, UserID: userID, UserAgent: userAgent, IssuedAt: token.IssuedAt, ExpiresAt: token.ExpiresAt}
+	return app.db.CreateSession(ctx, session, app.sessionLimit)
+}
+
+// ValidateSession verifies that the token's session has not been revoked.
+// It returns ErrSessionRevoked otherwise, and nil without querying storage when session tracking is disabled.
+// Tokens issued while tracking was disabled have no registered session and are rejected once it is enabled.
+func (app *App) ValidateSession(ctx context.Context, userID int32, sessionID string) error {
+	if app.sessionLimit <= 0 {
+		return nil
+	}
+
+	if sessionID == "" {
+		return ErrSessionRevoked
+	}
+
+	active, err := app.db.IsSessionActive(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrSessionRevoked
+	}
+
+	return nil
+}
+
+// ProcessSessions lists the user's active sessions, newest first, marking the one with currentID as current.
+func (app *App) ProcessSessions(ctx context.Context, userID int32, currentID string) (*models.SessionsResponse, error) {
+	if app.sessionLimit <= 0 {
+		return nil, ErrSessionsDisabled
+	}
+
+	sessions, err := app.db.GetActiveSessions(ctx, userID, app.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	return &models.SessionsResponse{Sessions: sessions}, nil
+}
+
+// CountActiveSessions returns the number of active sessions of all users, the approximate number of tokens in use.
+func (app *App) CountActiveSessions(ctx context.Context) (int, error) {
+	if app.sessionLimit <= 0 {
+		return 0, ErrSessionsDisabled
+	}
+
+	return app.db.CountActiveSessions(ctx, app.Now())
+}
+
+// ProcessRevokeSession revokes one of the user's active sessions.
+// It returns storage.ErrSessionNotFound when the user has no such active session. The session's token is dropped
+// from the verified token cache of auth.CheckJWTMiddleware.
+func (app *App) ProcessRevokeSession(ctx context.Context, userID int32, sessionID string) error {
+	if app.sessionLimit <= 0 {
+		return ErrSessionsDisabled
+	}
+
+	if err := app.db.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	auth.ForgetToken(sessionID)
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+
+	"merch_store/internal/models"
+)
+
+// termsText is the text of the terms of service of the merch program, served with the configured version.
+//
+//go:embed terms.md
+var termsText string
+
+// Errors of the terms of service.
+var (
+	// ErrTermsNotAccepted indicates that the user has not accepted the current version of the terms of service,
+	// which is required before buying or transferring coins.
+	ErrTermsNotAccepted = errors.New("app: terms of service not accepted")
+	// ErrTermsNotConfigured indicates that no version of the terms of service is configured.
+	ErrTermsNotConfigured = errors.New("app: terms of service not configured")
+	// ErrTermsVersionMismatch indicates an attempt to accept a version of the terms of service other than the current one.
+	ErrTermsVersionMismatch = errors.New("app: terms of service version is not current")
+)
+
+// SetTermsVersion sets the current version of the terms of service. Users must accept it before buying or transferring
+// coins; raising it requires everybody to accept the terms again. Zero, the default, requires no acceptance.
+// The version must change whenever the embedded text does.
+func (app *App) SetTermsVersion(version int) {
+	app.termsVersion = version
+}
+
+// ProcessTerms returns the current terms of service. It returns ErrTermsNotConfigured when no version is set.
+func (app *App) ProcessTerms() (*models.Terms, error) {
+	if app.termsVersion <= 0 {
+		return nil, ErrTermsNotConfigured
+	}
+
+	return &models.Terms{Version: app.termsVersion, Text: termsText}, nil
+}
+
+// ProcessAcceptTerms records that the user accepted the current terms of service. The version the user has read must
+// be the current one; otherwise it returns ErrTermsVersionMismatch, so that a change of the terms made while the user
+// was reading them is not accepted unseen. It returns ErrTermsNotConfigured when no version is set.
+func (app *App) ProcessAcceptTerms(ctx context.Context, userID int32, version int) (*models.TermsAcceptance, error) {
+	if app.termsVersion <= 0 {
+		return nil, ErrTermsNotConfigured
+	}
+	if version != app.termsVersion {
+		return nil, ErrTermsVersionMismatch
+	}
+
+	return app.db.AcceptTerms(ctx, userID, version, app.Now())
+}
+
+// ensureTermsAccepted returns ErrTermsNotAccepted unless the user has accepted the current version of the terms of
+// service. Nothing is checked when no version is set.
+func (app *App) ensureTermsAccepted(ctx context.Context, userID int32) error {
+	if app.termsVersion <= 0 {
+		return nil
+	}
+
+	acceptance, err := app.db.GetTermsAcceptance(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if acceptance.Version < app.termsVersion {
+		return ErrTermsNotAccepted
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestTermsAcceptance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+	transfer := models.SendCoinRequest{ToUser: "bob", Amount: 100}
+
+	t.Run("Disabled", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(ctx, int32(1), "cup").Return(&models.PurchaseResult{Item: "cup"}, nil)
+		_, err := app.ProcessBuy(ctx, 1, "cup")
+		require.NoError(t, err, "no acceptance is required without a version")
+
+		_, err = app.ProcessTerms()
+		assert.ErrorIs(t, err, ErrTermsNotConfigured)
+		_, err = app.ProcessAcceptTerms(ctx, 1, 1)
+		assert.ErrorIs(t, err, ErrTermsNotConfigured)
+	})
+
+	app.SetTermsVersion(2)
+
+	t.Run("Never accepted", func(t *testing.T) {
+		mockDB.EXPECT().GetTermsAcceptance(ctx, int32(1)).Return(&models.TermsAcceptance{}, nil).Times(3)
+
+		_, err := app.ProcessBuy(ctx, 1, "cup")
+		assert.ErrorIs(t, err, ErrTermsNotAccepted)
+		_, err = app.ProcessSendCoin(ctx, 1, transfer)
+		assert.ErrorIs(t, err, ErrTermsNotAccepted)
+		err = app.ProcessGift(ctx, 1, "cup", models.GiftRequest{ToUser: "bob"})
+		assert.ErrorIs(t, err, ErrTermsNotAccepted)
+	})
+
+	t.Run("Older version accepted", func(t *testing.T) {
+		acceptedAt := now.AddDate(0, -1, 0)
+		mockDB.EXPECT().GetTermsAcceptance(ctx, int32(1)).Return(&models.TermsAcceptance{Version: 1, AcceptedAt: &acceptedAt}, nil).Times(2)
+
+		_, err := app.ProcessBuy(ctx, 1, "cup")
+		assert.ErrorIs(t, err, ErrTermsNotAccepted, "a new version must be accepted again")
+		_, err = app.ProcessSendCoin(ctx, 1, transfer)
+		assert.ErrorIs(t, err, ErrTermsNotAccepted)
+	})
+
+	t.Run("Current version accepted", func(t *testing.T) {
+		mockDB.EXPECT().GetTermsAcceptance(ctx, int32(1)).Return(&models.TermsAcceptance{Version: 2, AcceptedAt: &now}, nil).Times(2)
+		mockDB.EXPECT().BuyItem(ctx, int32(1), "cup").Return(&models.PurchaseResult{Item: "cup"}, nil)
+		mockDB.EXPECT().TransferCoins(ctx, int32(1), transfer).Return(&models.TransferResult{TransferID: 7}, nil)
+
+		_, err := app.ProcessBuy(ctx, 1, "cup")
+		require.NoError(t, err)
+		_, err = app.ProcessSendCoin(ctx, 1, transfer)
+		require.NoError(t, err)
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		terms, err := app.ProcessTerms()
+		require.NoError(t, err)
+		assert.Equal(t, 2, terms.Version)
+		assert.NotEmpty(t, terms.Text)
+
+		_, err = app.ProcessAcceptTerms(ctx, 1, 1)
+		assert.ErrorIs(t, err, ErrTermsVersionMismatch, "only the current version can be accepted")
+
+		mockDB.EXPECT().AcceptTerms(ctx, int32(1), 2, now).Return(&models.TermsAcceptance{Version: 2, AcceptedAt: &now}, nil)
+		acceptance, err := app.ProcessAcceptTerms(ctx, 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 2, acceptance.Version)
+	})
+}
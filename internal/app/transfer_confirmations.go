@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// TransferConfirmationTTL is how long a transfer awaiting confirmation can be confirmed.
+const TransferConfirmationTTL = 5 * time.Minute
+
+// confirmationTokenBytes is the number of random bytes in a confirmation token.
+const confirmationTokenBytes = 16
+
+// ErrConfirmationNotFound indicates that a confirmation token is unknown, has expired, has already been used,
+// or belongs to another user.
+var ErrConfirmationNotFound = errors.New("app: transfer confirmation not found")
+
+// pendingTransfer is a transfer awaiting confirmation by its sender.
+type pendingTransfer struct {
+	userID    int32
+	req       models.SendCoinRequest
+	expiresAt time.Time
+}
+
+// transferConfirmations holds the transfers awaiting confirmation by their token, in memory.
+// Expired entries are removed lazily, at most once per TransferConfirmationTTL.
+type transferConfirmations struct {
+	threshold int
+
+	mu        sync.Mutex
+	pending   map[string]pendingTransfer
+	nextSweep time.Time
+}
+
+// newTransferConfirmations creates a transferConfirmations requiring confirmation of transfers above threshold.
+func newTransferConfirmations(threshold int) *transferConfirmations {
+	return &transferConfirmations{threshold: threshold, pending: make(map[string]pendingTransfer)}
+}
+
+// add stores the transfer of the user under a new random token, expiring TransferConfirmationTTL after now.
+func (confirmations *transferConfirmations) add(userID int32, req models.SendCoinRequest, now time.Time) (string, time.Time, error) {
+	id := make([]byte, confirmationTokenBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(id)
+	expiresAt := now.Add(TransferConfirmationTTL)
+
+	confirmations.mu.Lock()
+	defer confirmations.mu.Unlock()
+
+	if !now.Before(confirmations.nextSweep) {
+		for key, pending := range confirmations.pending {
+			if !now.Before(pending.expiresAt) {
+				delete(confirmations.pending, key)
+			}
+		}
+		confirmations.nextSweep = now.Add(TransferConfirmationTTL)
+	}
+
+	confirmations.pending[token] = pendingTransfer{userID: userID, req: req, expiresAt: expiresAt}
+	return token, expiresAt, nil
+}
+
+// take removes and returns the transfer of the user stored under the token, so that it can be confirmed only once.
+// Tokens of other users are left in place; they and unknown or expired tokens are reported as not found.
+func (confirmations *transferConfirmations) take(userID int32, token string, now time.Time) (models.SendCoinRequest, bool) {
+	confirmations.mu.Lock()
+	defer confirmations.mu.Unlock()
+
+	pending, ok := confirmations.pending[token]
+	if !ok || pending.userID != userID {
+		return models.SendCoinRequest{}, false
+	}
+	delete(confirmations.pending, token)
+	if !now.Before(pending.expiresAt) {
+		return models.SendCoinRequest{}, false
+	}
+	return pending.req, true
+}
+
+// SetTransferConfirmation requires transfers of more than threshold coins to be confirmed by their sender
+// (see ProcessRequestTransferConfirmation). A zero threshold disables confirmation.
+func (app *App) SetTransferConfirmation(threshold int) {
+	if threshold <= 0 {
+		app.transferConfirmations = nil
+		return
+	}
+	app.transferConfirmations = newTransferConfirmations(threshold)
+}
+
+// RequiresTransferConfirmation reports whether the transfer must be confirmed before it is executed.
+// Dry runs never need confirmation, as they change nothing.
+func (app *App) RequiresTransferConfirmation(ctx context.Context, req models.SendCoinRequest) bool {
+	return app.transferConfirmations != nil && int(req.Amount) > app.transferConfirmations.threshold && !storage.IsDryRun(ctx)
+}
+
+// ProcessRequestTransferConfirmation validates the transfer with a dry run and, when it would succeed, holds it
+// until the user confirms it with ProcessConfirmTransfer within TransferConfirmationTTL. Balances are not touched
+// until then; it fails with the errors of ProcessSendCoin.
+func (app *App) ProcessRequestTransferConfirmation(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferConfirmation, error) {
+	if _, err := app.ProcessSendCoin(storage.WithDryRun(ctx), userID, req); err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := app.transferConfirmations.add(userID, req, app.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TransferConfirmation{ConfirmationToken: token, ToUser: req.ToUser, Amount: int(req.Amount), ExpiresAt: expiresAt.UTC()}, nil
+}
+
+// ProcessConfirmTransfer executes the transfer held under the confirmation token of the user, as ProcessSendCoin.
+// A token can be used once, even when the transfer then fails; it returns ErrConfirmationNotFound for tokens that
+// are unknown, expired, already used, or issued to another user, and when confirmation is disabled.
+func (app *App) ProcessConfirmTransfer(ctx context.Context, userID int32, token string) (*models.SendCoinResponse, error) {
+	if app.transferConfirmations == nil {
+		return nil, ErrConfirmationNotFound
+	}
+
+	req, ok := app.transferConfirmations.take(userID, token, app.Now())
+	if !ok {
+		return nil, ErrConfirmationNotFound
+	}
+
+	return app.ProcessSendCoin(ctx, userID, req)
+}
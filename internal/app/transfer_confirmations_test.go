@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestTransferConfirmation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetClock(fakeClock)
+	app.SetTransferConfirmation(300)
+	ctx := context.Background()
+
+	large := models.SendCoinRequest{ToUser: "bob", Amount: 500}
+	request := func(t *testing.T) string {
+		mockDB.EXPECT().TransferCoins(storage.WithDryRun(ctx), int32(1), large).Return(&models.TransferResult{}, nil)
+		confirmation, err := app.ProcessRequestTransferConfirmation(ctx, 1, large)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", confirmation.ToUser)
+		assert.Equal(t, 500, confirmation.Amount)
+		assert.Equal(t, fakeClock.Now().Add(TransferConfirmationTTL), confirmation.ExpiresAt)
+		return confirmation.ConfirmationToken
+	}
+
+	t.Run("Threshold", func(t *testing.T) {
+		assert.False(t, app.RequiresTransferConfirmation(ctx, models.SendCoinRequest{ToUser: "bob", Amount: 300}))
+		assert.True(t, app.RequiresTransferConfirmation(ctx, large))
+		assert.False(t, app.RequiresTransferConfirmation(storage.WithDryRun(ctx), large), "dry runs change nothing")
+	})
+
+	t.Run("Confirm once", func(t *testing.T) {
+		token := request(t)
+
+		mockDB.EXPECT().TransferCoins(ctx, int32(1), large).Return(&models.TransferResult{TransferID: 7}, nil)
+		response, err := app.ProcessConfirmTransfer(ctx, 1, token)
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), response.TransferID)
+
+		_, err = app.ProcessConfirmTransfer(ctx, 1, token)
+		assert.ErrorIs(t, err, ErrConfirmationNotFound, "a token must not execute a transfer twice")
+	})
+
+	t.Run("Wrong token", func(t *testing.T) {
+		token := request(t)
+
+		_, err := app.ProcessConfirmTransfer(ctx, 1, "not-a-token")
+		assert.ErrorIs(t, err, ErrConfirmationNotFound)
+		_, err = app.ProcessConfirmTransfer(ctx, 2, token)
+		assert.ErrorIs(t, err, ErrConfirmationNotFound, "another user must not confirm the transfer")
+
+		mockDB.EXPECT().TransferCoins(ctx, int32(1), large).Return(&models.TransferResult{TransferID: 8}, nil)
+		_, err = app.ProcessConfirmTransfer(ctx, 1, token)
+		require.NoError(t, err, "failed attempts of others must not use up the token")
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		token := request(t)
+
+		fakeClock.Advance(TransferConfirmationTTL)
+		_, err := app.ProcessConfirmTransfer(ctx, 1, token)
+		assert.ErrorIs(t, err, ErrConfirmationNotFound, "an expired transfer must never touch balances")
+	})
+
+	t.Run("Invalid transfer is not held", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(storage.WithDryRun(ctx), int32(1), large).Return(nil, storage.ErrInsufficientFunds)
+		_, err := app.ProcessRequestTransferConfirmation(ctx, 1, large)
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+		assert.False(t, app.RequiresTransferConfirmation(ctx, large))
+		_, err := app.ProcessConfirmTransfer(ctx, 1, "token")
+		assert.ErrorIs(t, err, ErrConfirmationNotFound)
+	})
+}
+
+func TestTransferConfirmations_Sweep(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	confirmations := newTransferConfirmations(300)
+
+	for i := int32(0); i < 100; i++ {
+		_, _, err := confirmations.add(i, models.SendCoinRequest{ToUser: "bob", Amount: 500}, now)
+		require.NoError(t, err)
+	}
+	_, _, err := confirmations.add(0, models.SendCoinRequest{ToUser: "bob", Amount: 500}, now.Add(TransferConfirmationTTL))
+	require.NoError(t, err)
+	assert.Len(t, confirmations.pending, 1, "expired entries must be removed lazily")
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"merch_store/internal/models"
+)
+
+// Modes of a transfer reversal.
+const (
+	// ReversalModeFull moves back the whole amount or nothing.
+	ReversalModeFull = "full"
+	// ReversalModePartial moves back as much of the amount as the recipient still has available.
+	ReversalModePartial = "partial"
+)
+
+// ErrInvalidReversalMode indicates that the requested reversal mode is neither full nor partial.
+var ErrInvalidReversalMode = errors.New("app: invalid reversal mode")
+
+// ProcessReverseTransfer reverses a mistaken transfer on behalf of the administrator, moving its coins back
+// from the recipient to the sender. The mode defaults to ReversalModeFull.
+// There is no notification system, so the parties learn about the reversal from their coin history,
+// where it appears as a transfer in the opposite direction.
+func (app *App) ProcessReverseTransfer(ctx context.Context, adminID int32, transferID int64, req models.ReverseTransferRequest) (*models.TransferReversal, error) {
+	var partial bool
+	switch req.Mode {
+	case ReversalModeFull, "":
+	case ReversalModePartial:
+		partial = true
+	default:
+		return nil, ErrInvalidReversalMode
+	}
+
+	reversal, err := app.db.ReverseTransfer(ctx, adminID, transferID, partial, app.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	app.log.Sugar().Infof("Transfer %d reversed by admin %d: %d of %d coins moved back from %s to %s",
+		transferID, adminID, reversal.ReversedAmount, reversal.Amount, reversal.ToUser, reversal.FromUser)
+	return reversal, nil
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// Page size limits of the transfers list.
+const (
+	DefaultTransfersPageSize = 50
+	MaxTransfersPageSize     = 200
+)
+
+// ErrInvalidDirection indicates that the requested transfer direction is not supported.
+var ErrInvalidDirection = errors.New("app: invalid transfer direction")
+
+// ProcessTransfers returns a page of the user's transfers, newest first.
+// The limit is clamped to MaxTransfersPageSize and defaults to DefaultTransfersPageSize when zero.
+// An empty cursor selects the first page; the returned NextCursor selects the following one.
+// Archived transfers (see TransferArchiver) are listed only with includeArchived.
+func (app *App) ProcessTransfers(ctx context.Context, userID int32, direction string, limit int, cursor string, includeArchived bool) (*models.TransfersResponse, error) {
+	if direction == "" {
+		direction = storage.TransferDirectionAll
+	}
+	if direction != storage.TransferDirectionAll && direction != storage.TransferDirectionSent && direction != storage.TransferDirectionReceived {
+		return nil, ErrInvalidDirection
+	}
+
+	limit = clampPageLimit(limit, DefaultTransfersPageSize, MaxTransfersPageSize)
+
+	filter := models.TransfersFilter{Direction: direction, Limit: limit + 1, IncludeArchived: includeArchived}
+	if cursor != "" {
+		after, err := decodePageCursor(cursor, userID, direction)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	transfers, err := app.db.GetTransfers(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.TransfersResponse{Transfers: transfers, PageMeta: models.PageMeta{Limit: limit}}
+	if len(transfers) > limit {
+		response.Transfers = transfers[:limit]
+		last := response.Transfers[limit-1]
+		response.NextCursor, err = encodePageCursor(userID, direction, models.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// ProcessTransfer returns the transfer with the given ID when the user is its sender or recipient.
+// Transfers of other users are reported as storage.ErrTransferNotFound, exactly like missing ones.
+func (app *App) ProcessTransfer(ctx context.Context, userID int32, transferID int64) (*models.Transfer, error) {
+	return app.db.GetTransfer(ctx, userID, transferID)
+}
+
+// SetShowRecipientBalance makes transfer previews disclose the balance the recipient would have after the transfer.
+// It is off by default, as the balance of the recipient is otherwise private to them.
+func (app *App) SetShowRecipientBalance(show bool) {
+	app.showRecipientBalance = show
+}
+
+// ProcessPreviewTransfer checks the transfer as ProcessSendCoin would, failing with the same errors, and returns the
+// balances after it without making it. The balance of the recipient is left out unless SetShowRecipientBalance allows it.
+func (app *App) ProcessPreviewTransfer(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferPreview, error) {
+	if req.ToUser == "" || req.Amount == 0 {
+		return nil, ErrMissingUsernameOrAmount
+	}
+	if err := app.ensureTermsAccepted(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	preview, err := app.db.PreviewTransfer(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	preview.OK = true
+	if !app.showRecipientBalance {
+		preview.RecipientBalance = 0
+	}
+	return preview, nil
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestProcessTransfers_Pagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Microsecond)
+	page := []models.Transfer{
+		{ID: 3, FromUser: "a", ToUser: "b", Amount: 3, CreatedAt: now},
+		{ID: 2, FromUser: "a", ToUser: "b", Amount: 2, CreatedAt: now.Add(-time.Second)},
+		{ID: 1, FromUser: "a", ToUser: "b", Amount: 1, CreatedAt: now.Add(-2 * time.Second)},
+	}
+
+	mockDB.EXPECT().GetTransfers(ctx, int32(1), models.TransfersFilter{Direction: "all", Limit: 3}).Return(page, nil)
+	first, err := app.ProcessTransfers(ctx, 1, "", 2, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, page[:2], first.Transfers)
+	require.NotEmpty(t, first.NextCursor)
+
+	after := &models.PageCursor{CreatedAt: page[1].CreatedAt, ID: page[1].ID}
+	mockDB.EXPECT().GetTransfers(ctx, int32(1), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, userID int32, filter models.TransfersFilter) ([]models.Transfer, error) {
+			require.NotNil(t, filter.After)
+			assert.True(t, after.CreatedAt.Equal(filter.After.CreatedAt))
+			assert.Equal(t, after.ID, filter.After.ID)
+			return page[2:], nil
+		})
+	second, err := app.ProcessTransfers(ctx, 1, "all", 2, first.NextCursor, false)
+	require.NoError(t, err)
+	assert.Equal(t, page[2:], second.Transfers)
+	assert.Empty(t, second.NextCursor, "the last page must not have a next cursor")
+
+	mockDB.EXPECT().GetTransfers(ctx, int32(1), models.TransfersFilter{Direction: "received", Limit: MaxTransfersPageSize + 1}).Return(nil, nil)
+	_, err = app.ProcessTransfers(ctx, 1, "received", 1000, "", false)
+	require.NoError(t, err)
+
+	mockDB.EXPECT().GetTransfers(ctx, int32(1), models.TransfersFilter{Direction: "sent", Limit: 3, IncludeArchived: true}).Return(nil, nil)
+	_, err = app.ProcessTransfers(ctx, 1, "sent", 2, "", true)
+	require.NoError(t, err)
+
+	_, err = app.ProcessTransfers(ctx, 1, "sideways", 10, "", false)
+	assert.ErrorIs(t, err, ErrInvalidDirection)
+}
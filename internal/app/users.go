@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"merch_store/internal/pkg/auth"
+)
+
+// ErrAccountInactive indicates that the user from a valid token has been deleted or deactivated.
+var ErrAccountInactive = errors.New("app: account no longer active")
+
+// ErrTokenStale indicates that a valid token was issued before the token version of its user was bumped,
+// by a password change or a forced logout (see InvalidateTokens).
+var ErrTokenStale = errors.New("app: token issued before the last logout of all sessions")
+
+// maxActiveUsersCached bounds the number of users remembered by activeUserCache.
+const maxActiveUsersCached = 10000
+
+// activeUser is an entry of activeUserCache: the token version of an active user and the expiry of the check.
+type activeUser struct {
+	tokenVersion int32
+	expiresAt    time.Time
+}
+
+// activeUserCache remembers users recently confirmed to be active, with their token versions, so that a request
+// does not hit the database on every call. Only positive results are cached: a deleted or deactivated user, or
+// a token version bumped on another instance, is noticed at the latest ttl after the change.
+type activeUserCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[int32]activeUser // Last successful check, by user ID.
+}
+
+// newActiveUserCache creates an activeUserCache keeping positive checks for ttl.
+func newActiveUserCache(ttl time.Duration) *activeUserCache {
+	return &activeUserCache{ttl: ttl, entries: make(map[int32]activeUser)}
+}
+
+// tokenVersion returns the token version of the user if the user was confirmed to be active less than ttl ago.
+func (cache *activeUserCache) tokenVersion(userID int32, now time.Time) (int32, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[userID]
+	if ok && now.After(entry.expiresAt) {
+		delete(cache.entries, userID)
+		return 0, false
+	}
+	return entry.tokenVersion, ok
+}
+
+// markActive records a successful check of the user, whose token version is tokenVersion.
+func (cache *activeUserCache) markActive(userID int32, tokenVersion int32, now time.Time) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if len(cache.entries) >= maxActiveUsersCached {
+		cache.entries = make(map[int32]activeUser)
+	}
+	cache.entries[userID] = activeUser{tokenVersion: tokenVersion, expiresAt: now.Add(cache.ttl)}
+}
+
+// forget drops the last check of the user, so that the next request checks the user again.
+func (cache *activeUserCache) forget(userID int32) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.entries, userID)
+}
+
+// SetUserValidation enables checking on every request that the user from the token still exists and is active,
+// and that the token is not stale. Successful checks are cached for ttl; a zero ttl disables caching.
+func (app *App) SetUserValidation(ttl time.Duration) {
+	app.activeUsers = newActiveUserCache(ttl)
+}
+
+// ValidateUser verifies that the user from the token still exists and is active, and, for a JWT in ctx
+// (see auth.ClaimsFromContext), that it carries the current token version of the user.
+// It returns ErrAccountInactive or ErrTokenStale otherwise, and nil without querying storage when validation
+// is disabled. Personal access tokens are revoked on their own, and impersonation tokens end with the session of
+// the administrator, so neither is checked for staleness.
+func (app *App) ValidateUser(ctx context.Context, userID int32) error {
+	if app.activeUsers == nil {
+		return nil
+	}
+
+	now := app.Now()
+	version, ok := app.activeUsers.tokenVersion(userID, now)
+	if !ok {
+		var active bool
+		var err error
+		version, active, err = app.db.GetTokenVersion(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !active {
+			return ErrAccountInactive
+		}
+
+		if app.activeUsers.ttl > 0 {
+			app.activeUsers.markActive(userID, version, now)
+		}
+	}
+
+	if claims, ok := auth.ClaimsFromContext(ctx); ok && claims.Impersonator == 0 && claims.TokenVersion != version {
+		return ErrTokenStale
+	}
+	return nil
+}
+
+// InvalidateTokens bumps the token version of the user, so that every token issued to the user before is rejected
+// with ErrTokenStale while user validation is enabled. Other instances notice the change within their user
+// validation cache TTL. It backs forced logouts and is meant for password changes, and returns storage.ErrUserNotFound
+// when the user does not exist.
+func (app *App) InvalidateTokens(ctx context.Context, userID int32) error {
+	if _, err := app.db.BumpTokenVersion(ctx, userID); err != nil {
+		return err
+	}
+
+	if app.activeUsers != nil {
+		app.activeUsers.forget(userID)
+	}
+	return nil
+}
+
+// ProcessForceLogout signs the user out of every session on behalf of the administrator adminID by invalidating
+// the user's tokens (see InvalidateTokens).
+func (app *App) ProcessForceLogout(ctx context.Context, adminID int32, userID int32) error {
+	if err := app.InvalidateTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	app.log.Sugar().Infof("Administrator %d forced the logout of user %d", adminID, userID)
+	return nil
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+func TestValidateUser_CacheWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	app.SetClock(fakeClock)
+	app.SetUserValidation(time.Minute)
+	ctx := context.Background()
+
+	mockDB.EXPECT().GetTokenVersion(ctx, int32(1)).Return(int32(0), true, nil)
+	require.NoError(t, app.ValidateUser(ctx, 1))
+
+	fakeClock.Advance(59 * time.Second)
+	require.NoError(t, app.ValidateUser(ctx, 1), "a cached check must not hit storage")
+
+	fakeClock.Advance(2 * time.Second)
+	mockDB.EXPECT().GetTokenVersion(ctx, int32(1)).Return(int32(0), false, nil)
+	assert.ErrorIs(t, app.ValidateUser(ctx, 1), ErrAccountInactive, "the user must be checked again once the window rolls over")
+
+	mockDB.EXPECT().GetTokenVersion(ctx, int32(1)).Return(int32(0), false, nil)
+	assert.ErrorIs(t, app.ValidateUser(ctx, 1), ErrAccountInactive, "inactive users must never be cached")
+}
+
+func TestValidateUser_TokenVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	app := NewApp(mockDB, &logger.Logger{Logger: zap.NewNop()})
+	app.SetUserValidation(time.Minute)
+	ctx := context.Background()
+	issuedBefore := auth.WithClaims(ctx, &auth.Claims{UserID: 1, TokenVersion: 2})
+
+	mockDB.EXPECT().GetTokenVersion(gomock.Any(), int32(1)).Return(int32(2), true, nil)
+	require.NoError(t, app.ValidateUser(issuedBefore, 1))
+	require.NoError(t, app.ValidateUser(issuedBefore, 1), "a cached check must not hit storage")
+
+	mockDB.EXPECT().BumpTokenVersion(ctx, int32(1)).Return(int32(3), nil)
+	require.NoError(t, app.InvalidateTokens(ctx, 1))
+
+	mockDB.EXPECT().GetTokenVersion(gomock.Any(), int32(1)).Return(int32(3), true, nil)
+	assert.ErrorIs(t, app.ValidateUser(issuedBefore, 1), ErrTokenStale, "the cached version must be dropped on a bump")
+
+	issuedAfter := auth.WithClaims(ctx, &auth.Claims{UserID: 1, TokenVersion: 3})
+	assert.NoError(t, app.ValidateUser(issuedAfter, 1))
+
+	impersonation := auth.WithClaims(ctx, &auth.Claims{UserID: 1, Impersonator: 9})
+	assert.NoError(t, app.ValidateUser(impersonation, 1), "impersonation tokens end with the administrator's session")
+	assert.NoError(t, app.ValidateUser(auth.WithUserID(ctx, 1), 1), "personal access tokens carry no version")
+
+	mockDB.EXPECT().BumpTokenVersion(ctx, int32(5)).Return(int32(0), storage.ErrUserNotFound)
+	assert.ErrorIs(t, app.InvalidateTokens(ctx, 5), storage.ErrUserNotFound)
+}
+
+func TestValidateUser_Disabled(t *testing.T) {
+	app := NewApp(nil, &logger.Logger{Logger: zap.NewNop()})
+	assert.NoError(t, app.ValidateUser(context.Background(), 1))
+}
@@ -1,35 +1,437 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net"
 	"os"
-
-	"github.com/joho/godotenv"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	LogLevel         string
-	ServerRunAddress string
-	DatabaseURI      string
+	LogLevel                string
+	LogSkipPaths            []string
+	LogSuccessSampleRate    int
+	LogSlowRequestThreshold time.Duration
+
+	AppEnv string
+
+	ServerRunAddress   string
+	DatabaseURI        string
+	DBDriver           string
+	DBBalanceIsolation string
+	DBDeadlineFloor    time.Duration
+
+	DatabaseReplicaURI   string
+	ReadYourWritesWindow time.Duration
+
+	EncryptionKeys string
+
+	LeaderElectionInterval time.Duration
+
+	FlashSaleItems     []string
+	FlashSaleQueueSize int
+	FlashSaleQueueTTL  time.Duration
+
+	ValidateUserOnRequest bool
+	ValidateUserCacheTTL  time.Duration
+
+	AccrualAmount        int
+	AccrualCheckInterval time.Duration
+
+	ScheduledTransferInterval time.Duration
+
+	InvariantCheckInterval time.Duration
+
+	FailedPurchaseBufferSize int
+
+	ActivityBufferSize int
+
+	SessionLimit int
+
+	VerifiedTokenCacheSize int
+
+	MaxCoinBalance int64
+
+	AdminAPISecret string
+
+	JWTSecret   string
+	JWTIssuer   string
+	JWTAudience string
+
+	RegistrationMode string
+
+	FeatureFlagsFile           string
+	FeatureFlagsReloadInterval time.Duration
+
+	WebUIEnabled bool
+
+	PurchaseDebounceWindow time.Duration
+
+	TransferConfirmationThreshold int
+
+	InfoHistoryThreshold int
+	InfoHistoryLimit     int
+
+	TransferArchiveAge      time.Duration
+	TransferArchiveInterval time.Duration
+
+	PrivacyShowRecipientBalance bool
+
+	TermsVersion int
+
+	AuthRateLimit  int
+	AuthRateBurst  int
+	TrustedProxies string
+
+	RegistrationCooldown          time.Duration
+	RegistrationCooldownAllowlist string
 )
 
+// UnixSocketPrefix starts server run addresses naming a unix domain socket, such as unix:/run/merch_store/http.sock.
+const UnixSocketPrefix = "unix:"
+
+// ParseRunAddress splits a server run address into the network and the address to listen on:
+// "unix" and the socket path for addresses starting with UnixSocketPrefix, and "tcp" and host:port otherwise.
+// The host of a TCP address may be empty to listen on all interfaces; the port must be a number from 0 to 65535.
+func ParseRunAddress(address string) (network string, listenAddress string, err error) {
+	if path, found := strings.CutPrefix(address, UnixSocketPrefix); found {
+		if path == "" {
+			return "", "", fmt.Errorf("config: missing unix socket path in %q", address)
+		}
+		return "unix", path, nil
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", fmt.Errorf("config: invalid tcp address %q: %w", address, err)
+	}
+	if parsed, err := strconv.ParseUint(port, 10, 16); err != nil || strconv.FormatUint(parsed, 10) != port {
+		return "", "", fmt.Errorf("config: invalid port %q in %q", port, address)
+	}
+	return "tcp", address, nil
+}
+
 func init() {
-	if err := godotenv.Load(); err != nil {
+	if err := loadDotEnv(); err != nil {
 		log.Println("No .env file found, using default values")
 	}
+	startupEnv = restartRequiredEnv()
 
-	LogLevel = os.Getenv("LOG_LEVEL")
-	if LogLevel == "" {
-		LogLevel = "info"
+	loadReloadable()
+
+	AppEnv = os.Getenv("APP_ENV")
+	if AppEnv == "" {
+		AppEnv = "development"
 	}
 
-	ServerRunAddress = os.Getenv("SERVER_RUN_ADDRESS")
-	if ServerRunAddress == "" {
-		ServerRunAddress = "0.0.0.0:8080"
+	ServerRunAddress = "0.0.0.0:8080"
+	if address := os.Getenv("SERVER_RUN_ADDRESS"); address != "" {
+		if _, _, err := ParseRunAddress(address); err == nil {
+			ServerRunAddress = address
+		} else {
+			log.Printf("Invalid SERVER_RUN_ADDRESS %q (%s), using default value %s", address, err, ServerRunAddress)
+		}
 	}
 
-	DatabaseURI = os.Getenv("DATABASE_URI")
+	DatabaseURI = mustLookupSecret("DATABASE_URI")
 	if DatabaseURI == "" {
 		DatabaseURI = "host=db user=postgres password=password dbname=shop sslmode=disable"
 	}
+
+	DBDriver = os.Getenv("DB_DRIVER")
+	if DBDriver == "" {
+		DBDriver = "sql"
+	}
+
+	DBBalanceIsolation = os.Getenv("DB_BALANCE_ISOLATION")
+	if DBBalanceIsolation == "" {
+		DBBalanceIsolation = "read_committed"
+	}
+
+	DBDeadlineFloor = 250 * time.Millisecond
+	if floor := os.Getenv("DB_DEADLINE_FLOOR"); floor != "" {
+		if parsed, err := time.ParseDuration(floor); err == nil && parsed >= 0 {
+			DBDeadlineFloor = parsed
+		} else {
+			log.Printf("Invalid DB_DEADLINE_FLOOR %q, using default value %s", floor, DBDeadlineFloor)
+		}
+	}
+
+	DatabaseReplicaURI = mustLookupSecret("DATABASE_REPLICA_URI")
+
+	EncryptionKeys = mustLookupSecret("ENCRYPTION_KEYS")
+
+	ReadYourWritesWindow = 3 * time.Second
+	if window := os.Getenv("READ_YOUR_WRITES_WINDOW"); window != "" {
+		if parsed, err := time.ParseDuration(window); err == nil && parsed > 0 {
+			ReadYourWritesWindow = parsed
+		} else {
+			log.Printf("Invalid READ_YOUR_WRITES_WINDOW %q, using default value %s", window, ReadYourWritesWindow)
+		}
+	}
+
+	LeaderElectionInterval = 5 * time.Second
+	if interval := os.Getenv("LEADER_ELECTION_INTERVAL"); interval != "" {
+		if parsed, err := time.ParseDuration(interval); err == nil && parsed >= 0 {
+			LeaderElectionInterval = parsed
+		} else {
+			log.Printf("Invalid LEADER_ELECTION_INTERVAL %q, using default value %s", interval, LeaderElectionInterval)
+		}
+	}
+
+	if items := os.Getenv("FLASH_SALE_ITEMS"); items != "" {
+		for _, item := range strings.Split(items, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				FlashSaleItems = append(FlashSaleItems, item)
+			}
+		}
+	}
+
+	FlashSaleQueueSize = 100
+	if size := os.Getenv("FLASH_SALE_QUEUE_SIZE"); size != "" {
+		if parsed, err := strconv.Atoi(size); err == nil && parsed > 0 {
+			FlashSaleQueueSize = parsed
+		} else {
+			log.Printf("Invalid FLASH_SALE_QUEUE_SIZE %q, using default value %d", size, FlashSaleQueueSize)
+		}
+	}
+
+	FlashSaleQueueTTL = 30 * time.Second
+	if ttl := os.Getenv("FLASH_SALE_QUEUE_TTL"); ttl != "" {
+		if parsed, err := time.ParseDuration(ttl); err == nil && parsed > 0 {
+			FlashSaleQueueTTL = parsed
+		} else {
+			log.Printf("Invalid FLASH_SALE_QUEUE_TTL %q, using default value %s", ttl, FlashSaleQueueTTL)
+		}
+	}
+
+	if validate := os.Getenv("VALIDATE_USER_ON_REQUEST"); validate != "" {
+		if parsed, err := strconv.ParseBool(validate); err == nil {
+			ValidateUserOnRequest = parsed
+		} else {
+			log.Printf("Invalid VALIDATE_USER_ON_REQUEST %q, using default value %t", validate, ValidateUserOnRequest)
+		}
+	}
+
+	ValidateUserCacheTTL = 30 * time.Second
+	if ttl := os.Getenv("VALIDATE_USER_CACHE_TTL"); ttl != "" {
+		if parsed, err := time.ParseDuration(ttl); err == nil && parsed >= 0 {
+			ValidateUserCacheTTL = parsed
+		} else {
+			log.Printf("Invalid VALIDATE_USER_CACHE_TTL %q, using default value %s", ttl, ValidateUserCacheTTL)
+		}
+	}
+
+	AccrualAmount = 100
+	if amount := os.Getenv("ACCRUAL_AMOUNT"); amount != "" {
+		if parsed, err := strconv.Atoi(amount); err == nil && parsed >= 0 {
+			AccrualAmount = parsed
+		} else {
+			log.Printf("Invalid ACCRUAL_AMOUNT %q, using default value %d", amount, AccrualAmount)
+		}
+	}
+
+	AccrualCheckInterval = time.Hour
+	if interval := os.Getenv("ACCRUAL_CHECK_INTERVAL"); interval != "" {
+		if parsed, err := time.ParseDuration(interval); err == nil && parsed > 0 {
+			AccrualCheckInterval = parsed
+		} else {
+			log.Printf("Invalid ACCRUAL_CHECK_INTERVAL %q, using default value %s", interval, AccrualCheckInterval)
+		}
+	}
+
+	ScheduledTransferInterval = time.Minute
+	if interval := os.Getenv("SCHEDULED_TRANSFER_INTERVAL"); interval != "" {
+		if parsed, err := time.ParseDuration(interval); err == nil && parsed > 0 {
+			ScheduledTransferInterval = parsed
+		} else {
+			log.Printf("Invalid SCHEDULED_TRANSFER_INTERVAL %q, using default value %s", interval, ScheduledTransferInterval)
+		}
+	}
+
+	InvariantCheckInterval = time.Hour
+	if interval := os.Getenv("INVARIANT_CHECK_INTERVAL"); interval != "" {
+		if parsed, err := time.ParseDuration(interval); err == nil && parsed >= 0 {
+			InvariantCheckInterval = parsed
+		} else {
+			log.Printf("Invalid INVARIANT_CHECK_INTERVAL %q, using default value %s", interval, InvariantCheckInterval)
+		}
+	}
+
+	FailedPurchaseBufferSize = 1000
+	if size := os.Getenv("FAILED_PURCHASE_BUFFER_SIZE"); size != "" {
+		if parsed, err := strconv.Atoi(size); err == nil && parsed > 0 {
+			FailedPurchaseBufferSize = parsed
+		} else {
+			log.Printf("Invalid FAILED_PURCHASE_BUFFER_SIZE %q, using default value %d", size, FailedPurchaseBufferSize)
+		}
+	}
+
+	ActivityBufferSize = 1000
+	if size := os.Getenv("ACTIVITY_BUFFER_SIZE"); size != "" {
+		if parsed, err := strconv.Atoi(size); err == nil && parsed > 0 {
+			ActivityBufferSize = parsed
+		} else {
+			log.Printf("Invalid ACTIVITY_BUFFER_SIZE %q, using default value %d", size, ActivityBufferSize)
+		}
+	}
+
+	if limit := os.Getenv("SESSION_LIMIT"); limit != "" {
+		if parsed, err := strconv.Atoi(limit); err == nil && parsed >= 0 {
+			SessionLimit = parsed
+		} else {
+			log.Printf("Invalid SESSION_LIMIT %q, using default value %d", limit, SessionLimit)
+		}
+	}
+
+	if size := os.Getenv("VERIFIED_TOKEN_CACHE_SIZE"); size != "" {
+		if parsed, err := strconv.Atoi(size); err == nil && parsed >= 0 {
+			VerifiedTokenCacheSize = parsed
+		} else {
+			log.Printf("Invalid VERIFIED_TOKEN_CACHE_SIZE %q, using default value %d", size, VerifiedTokenCacheSize)
+		}
+	}
+
+	MaxCoinBalance = 1_000_000
+	if balance := os.Getenv("MAX_COIN_BALANCE"); balance != "" {
+		if parsed, err := strconv.ParseInt(balance, 10, 64); err == nil && parsed >= 0 {
+			MaxCoinBalance = parsed
+		} else {
+			log.Printf("Invalid MAX_COIN_BALANCE %q, using default value %d", balance, MaxCoinBalance)
+		}
+	}
+
+	AdminAPISecret = mustLookupSecret("ADMIN_API_SECRET")
+
+	JWTSecret = mustLookupSecret("JWT_SECRET")
+	JWTIssuer = os.Getenv("JWT_ISSUER")
+	JWTAudience = os.Getenv("JWT_AUDIENCE")
+
+	RegistrationMode = os.Getenv("REGISTRATION_MODE")
+	if RegistrationMode == "" {
+		RegistrationMode = "open"
+	}
+
+	FeatureFlagsReloadInterval = 30 * time.Second
+	if interval := os.Getenv("FEATURE_FLAGS_RELOAD_INTERVAL"); interval != "" {
+		if parsed, err := time.ParseDuration(interval); err == nil && parsed > 0 {
+			FeatureFlagsReloadInterval = parsed
+		} else {
+			log.Printf("Invalid FEATURE_FLAGS_RELOAD_INTERVAL %q, using default value %s", interval, FeatureFlagsReloadInterval)
+		}
+	}
+
+	WebUIEnabled = true
+	if enabled := os.Getenv("WEB_UI_ENABLED"); enabled != "" {
+		if parsed, err := strconv.ParseBool(enabled); err == nil {
+			WebUIEnabled = parsed
+		} else {
+			log.Printf("Invalid WEB_UI_ENABLED %q, using default value %t", enabled, WebUIEnabled)
+		}
+	}
+
+	PurchaseDebounceWindow = 3 * time.Second
+	if window := os.Getenv("PURCHASE_DEBOUNCE_WINDOW"); window != "" {
+		if parsed, err := time.ParseDuration(window); err == nil && parsed >= 0 {
+			PurchaseDebounceWindow = parsed
+		} else {
+			log.Printf("Invalid PURCHASE_DEBOUNCE_WINDOW %q, using default value %s", window, PurchaseDebounceWindow)
+		}
+	}
+
+	TransferConfirmationThreshold = 0
+	if threshold := os.Getenv("TRANSFER_CONFIRMATION_THRESHOLD"); threshold != "" {
+		if parsed, err := strconv.Atoi(threshold); err == nil && parsed >= 0 {
+			TransferConfirmationThreshold = parsed
+		} else {
+			log.Printf("Invalid TRANSFER_CONFIRMATION_THRESHOLD %q, using default value %d", threshold, TransferConfirmationThreshold)
+		}
+	}
+
+	InfoHistoryThreshold = 10000
+	if threshold := os.Getenv("INFO_HISTORY_THRESHOLD"); threshold != "" {
+		if parsed, err := strconv.Atoi(threshold); err == nil && parsed >= 0 {
+			InfoHistoryThreshold = parsed
+		} else {
+			log.Printf("Invalid INFO_HISTORY_THRESHOLD %q, using default value %d", threshold, InfoHistoryThreshold)
+		}
+	}
+
+	InfoHistoryLimit = 100
+	if limit := os.Getenv("INFO_HISTORY_LIMIT"); limit != "" {
+		if parsed, err := strconv.Atoi(limit); err == nil && parsed > 0 {
+			InfoHistoryLimit = parsed
+		} else {
+			log.Printf("Invalid INFO_HISTORY_LIMIT %q, using default value %d", limit, InfoHistoryLimit)
+		}
+	}
+
+	TransferArchiveAge = 365 * 24 * time.Hour
+	if age := os.Getenv("TRANSFER_ARCHIVE_AGE"); age != "" {
+		if parsed, err := time.ParseDuration(age); err == nil && parsed >= 0 {
+			TransferArchiveAge = parsed
+		} else {
+			log.Printf("Invalid TRANSFER_ARCHIVE_AGE %q, using default value %s", age, TransferArchiveAge)
+		}
+	}
+
+	TransferArchiveInterval = time.Hour
+	if interval := os.Getenv("TRANSFER_ARCHIVE_INTERVAL"); interval != "" {
+		if parsed, err := time.ParseDuration(interval); err == nil && parsed > 0 {
+			TransferArchiveInterval = parsed
+		} else {
+			log.Printf("Invalid TRANSFER_ARCHIVE_INTERVAL %q, using default value %s", interval, TransferArchiveInterval)
+		}
+	}
+
+	PrivacyShowRecipientBalance = false
+	if show := os.Getenv("PRIVACY_SHOW_RECIPIENT_BALANCE"); show != "" {
+		if parsed, err := strconv.ParseBool(show); err == nil {
+			PrivacyShowRecipientBalance = parsed
+		} else {
+			log.Printf("Invalid PRIVACY_SHOW_RECIPIENT_BALANCE %q, using default value %t", show, PrivacyShowRecipientBalance)
+		}
+	}
+
+	TermsVersion = 0
+	if version := os.Getenv("TOS_VERSION"); version != "" {
+		if parsed, err := strconv.Atoi(version); err == nil && parsed >= 0 {
+			TermsVersion = parsed
+		} else {
+			log.Printf("Invalid TOS_VERSION %q, using default value %d", version, TermsVersion)
+		}
+	}
+
+	AuthRateLimit = 60
+	if limit := os.Getenv("AUTH_RATE_LIMIT"); limit != "" {
+		if parsed, err := strconv.Atoi(limit); err == nil && parsed >= 0 {
+			AuthRateLimit = parsed
+		} else {
+			log.Printf("Invalid AUTH_RATE_LIMIT %q, using default value %d", limit, AuthRateLimit)
+		}
+	}
+
+	AuthRateBurst = 20
+	if burst := os.Getenv("AUTH_RATE_BURST"); burst != "" {
+		if parsed, err := strconv.Atoi(burst); err == nil && parsed > 0 {
+			AuthRateBurst = parsed
+		} else {
+			log.Printf("Invalid AUTH_RATE_BURST %q, using default value %d", burst, AuthRateBurst)
+		}
+	}
+
+	TrustedProxies = os.Getenv("TRUSTED_PROXIES")
+
+	RegistrationCooldown = 10 * time.Minute
+	if cooldown := os.Getenv("REGISTRATION_COOLDOWN"); cooldown != "" {
+		if parsed, err := time.ParseDuration(cooldown); err == nil && parsed >= 0 {
+			RegistrationCooldown = parsed
+		} else {
+			log.Printf("Invalid REGISTRATION_COOLDOWN %q, using default value %s", cooldown, RegistrationCooldown)
+		}
+	}
+	RegistrationCooldownAllowlist = os.Getenv("REGISTRATION_COOLDOWN_ALLOWLIST")
 }
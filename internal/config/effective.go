@@ -0,0 +1,126 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// RedactedValue replaces the values of secret settings in the effective configuration.
+const RedactedValue = "***"
+
+// settingsMu serializes Reload with Effective, the one reader of the settings that may run while they are reloaded.
+var settingsMu sync.RWMutex
+
+// setting classifies a setting of the package for Effective: the variable holding it, the environment variable
+// setting it, the subsystem it belongs to, and whether its value is secret.
+type setting struct {
+	variable  string
+	env       string
+	subsystem string
+	secret    bool
+	value     func() any
+}
+
+// settings lists every exported setting of the package. A setting missing here is left out of Effective,
+// which TestSettingsClassified catches.
+var settings = []setting{
+	{"AppEnv", "APP_ENV", "server", false, func() any { return AppEnv }},
+	{"ServerRunAddress", "SERVER_RUN_ADDRESS", "server", false, func() any { return ServerRunAddress }},
+	{"WebUIEnabled", "WEB_UI_ENABLED", "server", false, func() any { return WebUIEnabled }},
+	{"LeaderElectionInterval", "LEADER_ELECTION_INTERVAL", "server", false, func() any { return LeaderElectionInterval.String() }},
+
+	{"LogLevel", "LOG_LEVEL", "logging", false, func() any { return LogLevel }},
+	{"LogSkipPaths", "LOG_SKIP_PATHS", "logging", false, func() any { return LogSkipPaths }},
+	{"LogSuccessSampleRate", "LOG_SUCCESS_SAMPLE_RATE", "logging", false, func() any { return LogSuccessSampleRate }},
+	{"LogSlowRequestThreshold", "LOG_SLOW_REQUEST_THRESHOLD", "logging", false, func() any { return LogSlowRequestThreshold.String() }},
+	{"ActivityBufferSize", "ACTIVITY_BUFFER_SIZE", "logging", false, func() any { return ActivityBufferSize }},
+
+	{"DatabaseURI", "DATABASE_URI", "database", true, func() any { return DatabaseURI }},
+	{"DBDriver", "DB_DRIVER", "database", false, func() any { return DBDriver }},
+	{"DBBalanceIsolation", "DB_BALANCE_ISOLATION", "database", false, func() any { return DBBalanceIsolation }},
+	{"DBDeadlineFloor", "DB_DEADLINE_FLOOR", "database", false, func() any { return DBDeadlineFloor.String() }},
+	{"DatabaseReplicaURI", "DATABASE_REPLICA_URI", "database", true, func() any { return DatabaseReplicaURI }},
+	{"ReadYourWritesWindow", "READ_YOUR_WRITES_WINDOW", "database", false, func() any { return ReadYourWritesWindow.String() }},
+	{"EncryptionKeys", "ENCRYPTION_KEYS", "database", true, func() any { return EncryptionKeys }},
+
+	{"AdminAPISecret", "ADMIN_API_SECRET", "auth", true, func() any { return AdminAPISecret }},
+	{"JWTSecret", "JWT_SECRET", "auth", true, func() any { return JWTSecret }},
+	{"JWTIssuer", "JWT_ISSUER", "auth", false, func() any { return JWTIssuer }},
+	{"JWTAudience", "JWT_AUDIENCE", "auth", false, func() any { return JWTAudience }},
+	{"RegistrationMode", "REGISTRATION_MODE", "auth", false, func() any { return RegistrationMode }},
+	{"ValidateUserOnRequest", "VALIDATE_USER_ON_REQUEST", "auth", false, func() any { return ValidateUserOnRequest }},
+	{"ValidateUserCacheTTL", "VALIDATE_USER_CACHE_TTL", "auth", false, func() any { return ValidateUserCacheTTL.String() }},
+	{"SessionLimit", "SESSION_LIMIT", "auth", false, func() any { return SessionLimit }},
+	{"VerifiedTokenCacheSize", "VERIFIED_TOKEN_CACHE_SIZE", "auth", false, func() any { return VerifiedTokenCacheSize }},
+	{"AuthRateLimit", "AUTH_RATE_LIMIT", "auth", false, func() any { return AuthRateLimit }},
+	{"AuthRateBurst", "AUTH_RATE_BURST", "auth", false, func() any { return AuthRateBurst }},
+	{"TrustedProxies", "TRUSTED_PROXIES", "auth", false, func() any { return TrustedProxies }},
+	{"RegistrationCooldown", "REGISTRATION_COOLDOWN", "auth", false, func() any { return RegistrationCooldown.String() }},
+	{"RegistrationCooldownAllowlist", "REGISTRATION_COOLDOWN_ALLOWLIST", "auth", false, func() any { return RegistrationCooldownAllowlist }},
+	{"TermsVersion", "TOS_VERSION", "auth", false, func() any { return TermsVersion }},
+
+	{"AccrualAmount", "ACCRUAL_AMOUNT", "economy", false, func() any { return AccrualAmount }},
+	{"AccrualCheckInterval", "ACCRUAL_CHECK_INTERVAL", "economy", false, func() any { return AccrualCheckInterval.String() }},
+	{"MaxCoinBalance", "MAX_COIN_BALANCE", "economy", false, func() any { return MaxCoinBalance }},
+	{"InvariantCheckInterval", "INVARIANT_CHECK_INTERVAL", "economy", false, func() any { return InvariantCheckInterval.String() }},
+
+	{"FlashSaleItems", "FLASH_SALE_ITEMS", "purchases", false, func() any { return FlashSaleItems }},
+	{"FlashSaleQueueSize", "FLASH_SALE_QUEUE_SIZE", "purchases", false, func() any { return FlashSaleQueueSize }},
+	{"FlashSaleQueueTTL", "FLASH_SALE_QUEUE_TTL", "purchases", false, func() any { return FlashSaleQueueTTL.String() }},
+	{"PurchaseDebounceWindow", "PURCHASE_DEBOUNCE_WINDOW", "purchases", false, func() any { return PurchaseDebounceWindow.String() }},
+	{"FailedPurchaseBufferSize", "FAILED_PURCHASE_BUFFER_SIZE", "purchases", false, func() any { return FailedPurchaseBufferSize }},
+
+	{"TransferConfirmationThreshold", "TRANSFER_CONFIRMATION_THRESHOLD", "transfers", false, func() any { return TransferConfirmationThreshold }},
+	{"ScheduledTransferInterval", "SCHEDULED_TRANSFER_INTERVAL", "transfers", false, func() any { return ScheduledTransferInterval.String() }},
+	{"PrivacyShowRecipientBalance", "PRIVACY_SHOW_RECIPIENT_BALANCE", "transfers", false, func() any { return PrivacyShowRecipientBalance }},
+	{"InfoHistoryThreshold", "INFO_HISTORY_THRESHOLD", "transfers", false, func() any { return InfoHistoryThreshold }},
+	{"InfoHistoryLimit", "INFO_HISTORY_LIMIT", "transfers", false, func() any { return InfoHistoryLimit }},
+	{"TransferArchiveAge", "TRANSFER_ARCHIVE_AGE", "transfers", false, func() any { return TransferArchiveAge.String() }},
+	{"TransferArchiveInterval", "TRANSFER_ARCHIVE_INTERVAL", "transfers", false, func() any { return TransferArchiveInterval.String() }},
+
+	{"FeatureFlagsFile", "FEATURE_FLAGS_FILE", "features", false, func() any { return FeatureFlagsFile }},
+	{"FeatureFlagsReloadInterval", "FEATURE_FLAGS_RELOAD_INTERVAL", "features", false, func() any { return FeatureFlagsReloadInterval.String() }},
+}
+
+// EffectiveConfig represents the effective configuration of the process: the value of every setting by subsystem
+// and environment variable, and a hash of all of them. Secret values are replaced by RedactedValue unless empty,
+// but still contribute to the hash, so replicas configured differently have different hashes even when the
+// difference is a secret.
+type EffectiveConfig struct {
+	Settings map[string]map[string]any `json:"settings"`
+	Hash     string                    `json:"hash"`
+}
+
+// Effective returns the effective configuration, as loaded on start and updated by Reload, without rereading
+// the environment.
+func Effective() EffectiveConfig {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	effective := EffectiveConfig{Settings: make(map[string]map[string]any)}
+	lines := make([]string, 0, len(settings))
+	for _, s := range settings {
+		value := s.value()
+		lines = append(lines, fmt.Sprintf("%s=%v", s.env, value))
+
+		if s.secret && value != "" {
+			value = RedactedValue
+		}
+		if effective.Settings[s.subsystem] == nil {
+			effective.Settings[s.subsystem] = make(map[string]any)
+		}
+		effective.Settings[s.subsystem][s.env] = value
+	}
+
+	sort.Strings(lines)
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write([]byte(line + "\n"))
+	}
+	effective.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	return effective
+}
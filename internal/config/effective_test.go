@@ -0,0 +1,92 @@
+package config
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSettingsClassified inspects the declarations of config.go, so that a setting added there without being
+// classified in settings, or a secret classified as public, fails the test instead of silently going missing
+// from, or leaking through, Effective.
+func TestSettingsClassified(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", nil, 0)
+	require.NoError(t, err)
+
+	classified := make(map[string]setting, len(settings))
+	envs := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		_, ok := classified[s.variable]
+		assert.False(t, ok, "setting %s is classified twice", s.variable)
+		assert.False(t, envs[s.env], "variable %s is classified twice", s.env)
+		classified[s.variable] = s
+		envs[s.env] = true
+	}
+
+	declared := make(map[string]bool)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				if name.IsExported() {
+					declared[name.Name] = true
+					_, ok := classified[name.Name]
+					assert.True(t, ok, "setting %s must be classified in settings", name.Name)
+				}
+			}
+		}
+	}
+	for variable := range classified {
+		assert.True(t, declared[variable], "classified setting %s is not declared in config.go", variable)
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "mustLookupSecret" {
+			return true
+		}
+		env, err := strconv.Unquote(call.Args[0].(*ast.BasicLit).Value)
+		require.NoError(t, err)
+		for _, s := range settings {
+			if s.env == env {
+				assert.True(t, s.secret, "setting %s is read as a secret and must be classified as one", s.variable)
+			}
+		}
+		return true
+	})
+}
+
+func TestEffective(t *testing.T) {
+	databaseURI, adminAPISecret, maxCoinBalance := DatabaseURI, AdminAPISecret, MaxCoinBalance
+	t.Cleanup(func() {
+		DatabaseURI, AdminAPISecret, MaxCoinBalance = databaseURI, adminAPISecret, maxCoinBalance
+	})
+
+	DatabaseURI = "host=db user=postgres password=s3cret"
+	AdminAPISecret = ""
+	MaxCoinBalance = 5000
+
+	effective := Effective()
+	assert.Equal(t, RedactedValue, effective.Settings["database"]["DATABASE_URI"])
+	assert.Equal(t, "", effective.Settings["auth"]["ADMIN_API_SECRET"], "unset secrets must show as unset")
+	assert.Equal(t, int64(5000), effective.Settings["economy"]["MAX_COIN_BALANCE"])
+	assert.Equal(t, ServerRunAddress, effective.Settings["server"]["SERVER_RUN_ADDRESS"])
+	assert.Len(t, effective.Hash, 64)
+	assert.Equal(t, effective.Hash, Effective().Hash, "the hash must be stable")
+
+	DatabaseURI = "host=db user=postgres password=other"
+	changed := Effective()
+	assert.Equal(t, RedactedValue, changed.Settings["database"]["DATABASE_URI"])
+	assert.NotEqual(t, effective.Hash, changed.Hash, "a changed secret must change the hash")
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// dotEnvPath is the file read for settings not set in the process environment, on start and by Reload.
+var dotEnvPath = ".env"
+
+// dotEnvKeys holds the variables set from the .env file rather than by the process environment.
+// Only these are updated by Reload, so that the process environment keeps taking precedence.
+var dotEnvKeys = make(map[string]bool)
+
+// restartRequiredSettings lists the variables of the settings that are applied once on start.
+// Reload reports their changes but does not apply them.
+var restartRequiredSettings = []string{
+	"SERVER_RUN_ADDRESS", "DATABASE_URI", "DB_DRIVER", "DB_BALANCE_ISOLATION", "DB_DEADLINE_FLOOR",
+	"FLASH_SALE_ITEMS", "FLASH_SALE_QUEUE_SIZE", "FLASH_SALE_QUEUE_TTL",
+	"VALIDATE_USER_ON_REQUEST", "VALIDATE_USER_CACHE_TTL", "ACCRUAL_AMOUNT", "ACCRUAL_CHECK_INTERVAL",
+	"SCHEDULED_TRANSFER_INTERVAL", "FAILED_PURCHASE_BUFFER_SIZE", "SESSION_LIMIT", "MAX_COIN_BALANCE",
+	"ADMIN_API_SECRET", "JWT_ISSUER", "JWT_AUDIENCE", "REGISTRATION_MODE", "FEATURE_FLAGS_RELOAD_INTERVAL",
+	"WEB_UI_ENABLED", "PURCHASE_DEBOUNCE_WINDOW", "TRANSFER_CONFIRMATION_THRESHOLD",
+	"ACTIVITY_BUFFER_SIZE", "DATABASE_URI_FILE", "ADMIN_API_SECRET_FILE", "PRIVACY_SHOW_RECIPIENT_BALANCE",
+	"TOS_VERSION", "AUTH_RATE_LIMIT", "AUTH_RATE_BURST", "TRUSTED_PROXIES", "INVARIANT_CHECK_INTERVAL",
+	"VERIFIED_TOKEN_CACHE_SIZE", "INFO_HISTORY_THRESHOLD", "INFO_HISTORY_LIMIT", "LEADER_ELECTION_INTERVAL",
+	"TRANSFER_ARCHIVE_AGE", "TRANSFER_ARCHIVE_INTERVAL", "REGISTRATION_COOLDOWN", "REGISTRATION_COOLDOWN_ALLOWLIST",
+	"DATABASE_REPLICA_URI", "DATABASE_REPLICA_URI_FILE", "READ_YOUR_WRITES_WINDOW",
+	"APP_ENV", "JWT_SECRET", "JWT_SECRET_FILE", "ENCRYPTION_KEYS", "ENCRYPTION_KEYS_FILE",
+}
+
+// startupEnv holds the values of restartRequiredSettings the process started with.
+var startupEnv map[string]string
+
+// Change describes a setting changed by Reload.
+type Change struct {
+	Setting string // Name of the environment variable.
+	// Old and New are the effective values of a reloaded setting. They are left empty for settings
+	// that require a restart, as some of them, such as DATABASE_URI, hold secrets.
+	Old, New        string
+	RestartRequired bool
+}
+
+func (change Change) String() string {
+	if change.RestartRequired {
+		return change.Setting + " changed, restart to apply"
+	}
+	return fmt.Sprintf("%s: %q -> %q", change.Setting, change.Old, change.New)
+}
+
+// loadDotEnv sets the variables of the .env file that are not set in the process environment.
+func loadDotEnv() error {
+	values, err := godotenv.Read(dotEnvPath)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		os.Setenv(key, value)
+		dotEnvKeys[key] = true
+	}
+	return nil
+}
+
+// reloadDotEnv rereads the .env file, updating, setting, and unsetting the variables that come from it.
+// A missing file unsets all of them.
+func reloadDotEnv() error {
+	values, err := godotenv.Read(dotEnvPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for key := range dotEnvKeys {
+		if _, found := values[key]; !found {
+			os.Unsetenv(key)
+			delete(dotEnvKeys, key)
+		}
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set && !dotEnvKeys[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		dotEnvKeys[key] = true
+	}
+	return nil
+}
+
+// restartRequiredEnv returns the current values of restartRequiredSettings.
+func restartRequiredEnv() map[string]string {
+	env := make(map[string]string, len(restartRequiredSettings))
+	for _, key := range restartRequiredSettings {
+		env[key] = os.Getenv(key)
+	}
+	return env
+}
+
+// loadReloadable sets the settings that can change at runtime from the environment.
+func loadReloadable() {
+	LogLevel = os.Getenv("LOG_LEVEL")
+	if LogLevel == "" {
+		LogLevel = "info"
+	}
+
+	LogSkipPaths = []string{"/healthz", "/metrics"}
+	if paths, found := os.LookupEnv("LOG_SKIP_PATHS"); found {
+		LogSkipPaths = nil
+		for _, path := range strings.Split(paths, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				LogSkipPaths = append(LogSkipPaths, path)
+			}
+		}
+	}
+
+	LogSuccessSampleRate = 1
+	if rate := os.Getenv("LOG_SUCCESS_SAMPLE_RATE"); rate != "" {
+		if parsed, err := strconv.Atoi(rate); err == nil && parsed > 0 {
+			LogSuccessSampleRate = parsed
+		} else {
+			log.Printf("Invalid LOG_SUCCESS_SAMPLE_RATE %q, using default value %d", rate, LogSuccessSampleRate)
+		}
+	}
+
+	LogSlowRequestThreshold = time.Second
+	if threshold := os.Getenv("LOG_SLOW_REQUEST_THRESHOLD"); threshold != "" {
+		if parsed, err := time.ParseDuration(threshold); err == nil && parsed >= 0 {
+			LogSlowRequestThreshold = parsed
+		} else {
+			log.Printf("Invalid LOG_SLOW_REQUEST_THRESHOLD %q, using default value %s", threshold, LogSlowRequestThreshold)
+		}
+	}
+
+	FeatureFlagsFile = os.Getenv("FEATURE_FLAGS_FILE")
+}
+
+// reloadableValues returns the settings that can change at runtime, formatted for comparison, by variable.
+func reloadableValues() map[string]string {
+	return map[string]string{
+		"LOG_LEVEL":                  LogLevel,
+		"LOG_SKIP_PATHS":             strings.Join(LogSkipPaths, ","),
+		"LOG_SUCCESS_SAMPLE_RATE":    strconv.Itoa(LogSuccessSampleRate),
+		"LOG_SLOW_REQUEST_THRESHOLD": LogSlowRequestThreshold.String(),
+		"FEATURE_FLAGS_FILE":         FeatureFlagsFile,
+	}
+}
+
+// Reload rereads the .env file and updates the settings that can change at runtime: LogLevel, LogSkipPaths,
+// LogSuccessSampleRate, LogSlowRequestThreshold, and FeatureFlagsFile. It is up to the caller to apply them.
+// It returns the changes sorted by variable, including the changes of the other settings, which are not applied.
+// The process environment keeps taking precedence over the file. Reload must not be called concurrently
+// with reads of the settings other than Effective.
+func Reload() ([]Change, error) {
+	if err := reloadDotEnv(); err != nil {
+		return nil, err
+	}
+
+	settingsMu.Lock()
+	before := reloadableValues()
+	loadReloadable()
+	settingsMu.Unlock()
+
+	var changes []Change
+	for key, value := range reloadableValues() {
+		if value != before[key] {
+			changes = append(changes, Change{Setting: key, Old: before[key], New: value})
+		}
+	}
+	for key, value := range restartRequiredEnv() {
+		if value != startupEnv[key] {
+			changes = append(changes, Change{Setting: key, RestartRequired: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Setting < changes[j].Setting })
+
+	return changes, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	previous := dotEnvPath
+	dotEnvPath = path
+	t.Cleanup(func() {
+		os.Remove(path)
+		_, err := Reload()
+		assert.NoError(t, err)
+		dotEnvPath = previous
+	})
+	t.Setenv("LOG_SKIP_PATHS", "/healthz")
+
+	require.NoError(t, os.WriteFile(path, []byte("LOG_LEVEL=debug\nLOG_SKIP_PATHS=/other\nLOG_SUCCESS_SAMPLE_RATE=10\nDATABASE_URI=host=elsewhere\n"), 0o600))
+	changes, err := Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Setting: "DATABASE_URI", RestartRequired: true},
+		{Setting: "LOG_LEVEL", Old: "info", New: "debug"},
+		{Setting: "LOG_SKIP_PATHS", Old: "/healthz,/metrics", New: "/healthz"},
+		{Setting: "LOG_SUCCESS_SAMPLE_RATE", Old: "1", New: "10"},
+	}, changes)
+	assert.Equal(t, "debug", LogLevel)
+	assert.Equal(t, []string{"/healthz"}, LogSkipPaths, "the process environment must take precedence over the file")
+	assert.Equal(t, 10, LogSuccessSampleRate)
+	assert.NotEqual(t, "host=elsewhere", DatabaseURI, "settings requiring a restart must not be applied")
+
+	changes, err = Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Setting: "DATABASE_URI", RestartRequired: true}}, changes, "an unchanged file must change nothing")
+
+	require.NoError(t, os.WriteFile(path, []byte("LOG_LEVEL=warn\n"), 0o600))
+	changes, err = Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Setting: "LOG_LEVEL", Old: "debug", New: "warn"},
+		{Setting: "LOG_SUCCESS_SAMPLE_RATE", Old: "10", New: "1"},
+	}, changes, "variables removed from the file must be unset")
+	_, set := os.LookupEnv("DATABASE_URI")
+	assert.False(t, set)
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// secretFileSuffix names the variable holding the path of a file with the value of a secret setting,
+// such as DATABASE_URI_FILE for DATABASE_URI, as mounted by Docker and Kubernetes secrets.
+const secretFileSuffix = "_FILE"
+
+// lookupSecret returns the value of the secret setting name: the variable itself when it is set and not empty, and
+// otherwise the contents of the file named by its _FILE variant, with surrounding whitespace such as a trailing
+// newline trimmed. It returns an empty string when neither is set, and an error when the file cannot be read or
+// holds nothing but whitespace.
+func lookupSecret(name string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+
+	path := os.Getenv(name + secretFileSuffix)
+	if path == "" {
+		return "", nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("config: reading %s%s: %w", name, secretFileSuffix, err)
+	}
+	value := strings.TrimSpace(string(contents))
+	if value == "" {
+		return "", fmt.Errorf("config: %s%s names the empty file %s", name, secretFileSuffix, path)
+	}
+	return value, nil
+}
+
+// mustLookupSecret returns the value of the secret setting name as lookupSecret, stopping the process when its file
+// cannot be used: starting with a default in place of a configured secret would hide the mistake.
+func mustLookupSecret(name string) string {
+	value, err := lookupSecret(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return value
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupSecret(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+		return path
+	}
+
+	t.Run("Unset", func(t *testing.T) {
+		t.Setenv("TEST_SECRET", "")
+		t.Setenv("TEST_SECRET_FILE", "")
+		value, err := lookupSecret("TEST_SECRET")
+		require.NoError(t, err)
+		assert.Empty(t, value)
+	})
+
+	t.Run("File with a trailing newline", func(t *testing.T) {
+		t.Setenv("TEST_SECRET", "")
+		t.Setenv("TEST_SECRET_FILE", write("newline", "s3cret\n"))
+		value, err := lookupSecret("TEST_SECRET")
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", value)
+	})
+
+	t.Run("Variable takes precedence", func(t *testing.T) {
+		t.Setenv("TEST_SECRET", "from-env")
+		t.Setenv("TEST_SECRET_FILE", filepath.Join(dir, "missing"))
+		value, err := lookupSecret("TEST_SECRET")
+		require.NoError(t, err)
+		assert.Equal(t, "from-env", value, "an unusable file must not matter when the variable is set")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		t.Setenv("TEST_SECRET", "")
+		t.Setenv("TEST_SECRET_FILE", filepath.Join(dir, "missing"))
+		_, err := lookupSecret("TEST_SECRET")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.ErrorContains(t, err, "TEST_SECRET_FILE")
+	})
+
+	t.Run("Unreadable file", func(t *testing.T) {
+		t.Setenv("TEST_SECRET", "")
+		t.Setenv("TEST_SECRET_FILE", dir)
+		_, err := lookupSecret("TEST_SECRET")
+		assert.ErrorContains(t, err, "TEST_SECRET_FILE")
+	})
+
+	t.Run("Empty file", func(t *testing.T) {
+		t.Setenv("TEST_SECRET", "")
+		t.Setenv("TEST_SECRET_FILE", write("empty", " \n"))
+		_, err := lookupSecret("TEST_SECRET")
+		assert.ErrorContains(t, err, "empty file")
+	})
+}
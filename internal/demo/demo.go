@@ -0,0 +1,160 @@
+// Package demo populates a merch store with deterministic demo data for sales demos.
+// It drives the application layer directly, like a client would: it registers demo users, makes coin transfers
+// between them, and buys items from the catalog, so that /api/info shows varied balances and histories.
+// The activity is generated from a fixed random seed, so the same configuration against the same catalog
+// always produces the same data.
+package demo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/pgerr"
+)
+
+// Password is the password of every demo user, so that presenters can log in as any of them.
+const Password = "demo"
+
+// MarkerUsername is the user registered once seeding completes. Seeding is skipped while it exists.
+const MarkerUsername = "demo_marker"
+
+// userAgent is recorded with the sessions of the demo users.
+const userAgent = "demo-seed"
+
+// names are the base usernames of the demo users, each prefixed with "demo_".
+var names = []string{
+	"alice", "bob", "carol", "dave", "erin", "frank",
+	"grace", "heidi", "ivan", "judy", "mallory", "oscar",
+}
+
+// Config sets the amount of demo data to generate.
+type Config struct {
+	Users     int
+	Purchases int
+	Transfers int
+	Seed      int64
+}
+
+// DefaultConfig returns the configuration used by the demo-seed command: a dozen users with enough activity
+// to make every account look lived in.
+func DefaultConfig() Config {
+	return Config{Users: len(names), Purchases: 40, Transfers: 60, Seed: 1}
+}
+
+// Result summarizes a seeding run. Purchases and transfers a demo user could not afford are skipped and counted
+// in SkippedPurchases and SkippedTransfers. AlreadySeeded is set when the run did nothing because the marker user exists.
+type Result struct {
+	AlreadySeeded    bool
+	Users            []models.User
+	Purchases        int
+	Transfers        int
+	SkippedPurchases int
+	SkippedTransfers int
+}
+
+// Seed generates the demo data described by cfg unless MarkerUsername already exists.
+// The marker user is registered last, so an interrupted run is continued by the next one: demo users that
+// already exist are logged in instead of registered, and the remaining activity is generated on top of theirs.
+func Seed(ctx context.Context, db storage.Storage, cfg Config, l *logger.Logger) (*Result, error) {
+	if cfg.Users < 2 {
+		return nil, fmt.Errorf("demo: at least 2 users are needed, got %d", cfg.Users)
+	}
+
+	_, err := db.GetUserID(ctx, nil, MarkerUsername)
+	if err == nil {
+		return &Result{AlreadySeeded: true}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	application := app.NewApp(db, l)
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	result := &Result{}
+
+	for i := 0; i < cfg.Users; i++ {
+		user, err := login(ctx, application, username(i))
+		if err != nil {
+			return nil, err
+		}
+		result.Users = append(result.Users, *user)
+	}
+
+	for i := 0; i < cfg.Transfers; i++ {
+		from := rng.Intn(len(result.Users))
+		to := (from + 1 + rng.Intn(len(result.Users)-1)) % len(result.Users)
+		amount := models.CoinAmount(10 * (1 + rng.Intn(15)))
+
+		_, err := application.ProcessSendCoin(ctx, result.Users[from].ID, models.SendCoinRequest{ToUser: result.Users[to].Username, Amount: amount})
+		if isInsufficientFunds(err) {
+			result.SkippedTransfers++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("demo: transfer from %s to %s: %w", result.Users[from].Username, result.Users[to].Username, err)
+		}
+		result.Transfers++
+	}
+
+	catalog, err := application.ProcessCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < cfg.Purchases && len(catalog) > 0; i++ {
+		buyer := result.Users[rng.Intn(len(result.Users))]
+		item := catalog[rng.Intn(len(catalog))]
+
+		_, err := application.ProcessBuy(ctx, buyer.ID, item.Name)
+		if isInsufficientFunds(err) {
+			result.SkippedPurchases++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("demo: purchase of %q by %s: %w", item.Name, buyer.Username, err)
+		}
+		result.Purchases++
+	}
+
+	if _, err := login(ctx, application, MarkerUsername); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// username returns the username of the i-th demo user. Names repeat with a numeric suffix past the end of names.
+func username(i int) string {
+	name := "demo_" + names[i%len(names)]
+	if round := i / len(names); round > 0 {
+		name = fmt.Sprintf("%s%d", name, round+1)
+	}
+	return name
+}
+
+// login registers the demo user through the application layer, or logs them in if they already exist.
+func login(ctx context.Context, application *app.App, username string) (*models.User, error) {
+	token, err := application.ProcessAuth(ctx, models.AuthRequest{Username: username, Password: Password, UserAgent: userAgent})
+	if err != nil {
+		return nil, fmt.Errorf("demo: log in as %s: %w", username, err)
+	}
+
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.User{ID: claims.UserID, Username: username}, nil
+}
+
+// isInsufficientFunds reports whether an operation failed because the demo user could not afford it.
+func isInsufficientFunds(err error) bool {
+	return errors.Is(err, storage.ErrInsufficientFunds) || pgerr.IsCheckViolation(err, "users_coins_check")
+}
@@ -0,0 +1,183 @@
+package demo
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// memoryStorage keeps users, balances, purchases, and transfers in memory. It implements the storage methods
+// used by the seeder; calling any other method panics.
+type memoryStorage struct {
+	storage.Storage
+	users     map[string]*models.User
+	catalog   []models.CatalogItem
+	spent     map[int32]int64
+	purchases int
+	transfers int
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		users:   map[string]*models.User{},
+		catalog: []models.CatalogItem{{Name: "pen", Price: 10}, {Name: "cup", Price: 20}, {Name: "t-shirt", Price: 80}, {Name: "pink-hoody", Price: 500}},
+		spent:   map[int32]int64{},
+	}
+}
+
+func (memory *memoryStorage) CheckUser(ctx context.Context, user *models.User) (*models.User, error) {
+	stored, ok := memory.users[user.Username]
+	if !ok {
+		return user, nil
+	}
+	if stored.Password != user.Password {
+		return user, bcrypt.ErrMismatchedHashAndPassword
+	}
+	user.ID = stored.ID
+	return user, nil
+}
+
+func (memory *memoryStorage) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	stored := *user
+	stored.ID = int32(len(memory.users) + 1)
+	memory.users[user.Username] = &stored
+	user.ID = stored.ID
+	return user, nil
+}
+
+func (memory *memoryStorage) GetUserID(ctx context.Context, tx storage.Tx, username string) (*models.User, error) {
+	stored, ok := memory.users[username]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return stored, nil
+}
+
+func (memory *memoryStorage) GetMerchCatalog(ctx context.Context) ([]models.CatalogItem, error) {
+	return memory.catalog, nil
+}
+
+func (memory *memoryStorage) userByID(userID int32) *models.User {
+	for _, user := range memory.users {
+		if user.ID == userID {
+			return user
+		}
+	}
+	return nil
+}
+
+func (memory *memoryStorage) BuyItem(ctx context.Context, userID int32, itemName string) (*models.PurchaseResult, error) {
+	buyer := memory.userByID(userID)
+	for _, item := range memory.catalog {
+		if item.Name != itemName {
+			continue
+		}
+		if buyer.Coins < int64(item.Price) {
+			return nil, storage.ErrInsufficientFunds
+		}
+		buyer.Coins -= int64(item.Price)
+		memory.spent[userID] += int64(item.Price)
+		memory.purchases++
+		return &models.PurchaseResult{Item: item.Name, Price: item.Price, Quantity: 1, RemainingCoins: buyer.Coins}, nil
+	}
+	return nil, storage.ErrItemNotFound
+}
+
+func (memory *memoryStorage) TransferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+	sender := memory.userByID(userID)
+	recipient, ok := memory.users[req.ToUser]
+	if !ok {
+		return nil, storage.ErrRecipientNotFound
+	}
+	if sender.Coins < int64(req.Amount) {
+		return nil, storage.ErrInsufficientFunds
+	}
+	sender.Coins -= int64(req.Amount)
+	recipient.Coins += int64(req.Amount)
+	memory.transfers++
+	return &models.TransferResult{TransferID: int64(memory.transfers), RemainingCoins: sender.Coins}, nil
+}
+
+// balances returns the coins of every demo user by username, leaving out the marker user.
+func (memory *memoryStorage) balances() map[string]int64 {
+	balances := map[string]int64{}
+	for username, user := range memory.users {
+		if username != MarkerUsername {
+			balances[username] = user.Coins
+		}
+	}
+	return balances
+}
+
+func TestSeed(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	ctx := context.Background()
+	cfg := DefaultConfig()
+
+	memory := newMemoryStorage()
+	result, err := Seed(ctx, memory, cfg, l)
+	require.NoError(t, err)
+
+	require.Len(t, result.Users, cfg.Users)
+	assert.Equal(t, "demo_alice", result.Users[0].Username)
+	assert.Len(t, memory.users, cfg.Users+1, "the demo users and the marker must be registered")
+	assert.Contains(t, memory.users, MarkerUsername)
+
+	assert.Equal(t, cfg.Transfers, result.Transfers+result.SkippedTransfers)
+	assert.Equal(t, cfg.Purchases, result.Purchases+result.SkippedPurchases)
+	assert.Equal(t, memory.transfers, result.Transfers)
+	assert.Equal(t, memory.purchases, result.Purchases)
+	assert.NotZero(t, result.Transfers)
+	assert.NotZero(t, result.Purchases)
+
+	// Transfers move coins between demo users and purchases spend them, so no coin appears or disappears.
+	var total, spent int64
+	distinct := map[int64]bool{}
+	for username, coins := range memory.balances() {
+		assert.GreaterOrEqual(t, coins, int64(0), username)
+		total += coins
+		spent += memory.spent[memory.users[username].ID]
+		distinct[coins] = true
+	}
+	assert.Equal(t, int64(cfg.Users)*1000, total+spent)
+	assert.Greater(t, len(distinct), cfg.Users/2, "balances must vary between the demo users")
+
+	t.Run("Deterministic", func(t *testing.T) {
+		other := newMemoryStorage()
+		otherResult, err := Seed(ctx, other, cfg, l)
+		require.NoError(t, err)
+		assert.Equal(t, memory.balances(), other.balances())
+		assert.Equal(t, result.Purchases, otherResult.Purchases)
+		assert.Equal(t, result.Transfers, otherResult.Transfers)
+	})
+
+	t.Run("Idempotent", func(t *testing.T) {
+		balances := memory.balances()
+		again, err := Seed(ctx, memory, cfg, l)
+		require.NoError(t, err)
+		assert.True(t, again.AlreadySeeded)
+		assert.Equal(t, balances, memory.balances())
+		assert.Equal(t, result.Purchases, memory.purchases)
+		assert.Equal(t, result.Transfers, memory.transfers)
+	})
+
+	t.Run("Too few users", func(t *testing.T) {
+		_, err := Seed(ctx, newMemoryStorage(), Config{Users: 1}, l)
+		assert.Error(t, err)
+	})
+}
+
+func TestUsername(t *testing.T) {
+	assert.Equal(t, "demo_alice", username(0))
+	assert.Equal(t, "demo_oscar", username(len(names)-1))
+	assert.Equal(t, "demo_alice2", username(len(names)))
+}
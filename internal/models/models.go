@@ -3,11 +3,26 @@
 // user information, inventory items, and transaction details.
 package models
 
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
 // AuthRequest represents the authentication request payload.
-// It contains the username and password provided by the user.
+// It contains the username and password provided by the user,
+// and the invite code required to register a new user while registration is invite-only.
+// UserAgent is not part of the payload: it is taken from the request headers and recorded with the session.
+// Neither is ClientIP, the address of the client the request came from, which may be nil when it is unknown.
 type AuthRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	InviteCode string `json:"inviteCode,omitempty"`
+	UserAgent  string `json:"-"`
+	ClientIP   net.IP `json:"-"`
 }
 
 // AuthResponse represents the authentication response payload.
@@ -16,62 +31,980 @@ type AuthResponse struct {
 	Token string `json:"token"`
 }
 
+// AuthResponseV2 represents the authentication response payload of version 2 of the API.
+// Besides the token, it tells how to present it and when it expires.
+type AuthResponseV2 struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ImpersonationResponse represents the response payload of POST /api/admin/impersonate/{userID}.
+// The token lets the administrator read the account of the user until ExpiresAt.
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	UserID    int32     `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 // ErrorResponse represents a generic error response payload.
-// It contains a string describing the encountered error.
+// It contains a string describing the encountered error and, for errors clients are expected
+// to handle programmatically, a stable machine-readable code. Supported lists the acceptable
+// media types when the requested API version is not supported.
 type ErrorResponse struct {
-	Errors string `json:"errors"`
+	Errors    string   `json:"errors"`
+	Code      string   `json:"code,omitempty"`
+	Supported []string `json:"supported,omitempty"`
+}
+
+// ErrorResponseV2 represents the error response payload of version 2 of the API.
+type ErrorResponseV2 struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an error in version 2 of the API. Code is always set.
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
+// Machine-readable codes of authentication (401), authorization (403), request (400, 404), negotiation (406),
+// conflict (409), unprocessable request (422), throttling (429), and availability (503) errors.
+const (
+	ErrCodeAuthHeaderMissing = "AUTH_HEADER_MISSING"
+	ErrCodeAuthHeaderInvalid = "AUTH_HEADER_INVALID"
+	ErrCodeTokenInvalid      = "TOKEN_INVALID"
+	ErrCodeTokenStale        = "TOKEN_STALE"
+	ErrCodeAccountInactive   = "ACCOUNT_INACTIVE"
+	ErrCodeSessionRevoked    = "SESSION_REVOKED"
+	ErrCodeAdminRequired     = "ADMIN_REQUIRED"
+	ErrCodeSignatureInvalid  = "SIGNATURE_INVALID"
+	ErrCodeBodyRequired      = "BODY_REQUIRED"
+	ErrCodeRouteNotFound     = "ROUTE_NOT_FOUND"
+	ErrCodeScopeRequired     = "SCOPE_REQUIRED"
+	ErrCodeAmountInvalid     = "AMOUNT_INVALID"
+	ErrCodeFieldInvalid      = "FIELD_INVALID"
+	ErrCodeItemIDInvalid     = "ITEM_ID_INVALID"
+	ErrCodeItemNameTooLong   = "ITEM_NAME_TOO_LONG"
+	ErrCodeCategoryNotFound  = "CATEGORY_NOT_FOUND"
+	ErrCodeJSONTooDeep       = "JSON_TOO_DEEP"
+	ErrCodeJSONNumberTooLong = "JSON_NUMBER_TOO_LONG"
+	ErrCodeJSONTooManyKeys   = "JSON_TOO_MANY_KEYS"
+
+	ErrCodeImpersonationReadOnly = "IMPERSONATION_READ_ONLY"
+
+	ErrCodeVersionNotAcceptable    = "VERSION_NOT_ACCEPTABLE"
+	ErrCodeDuplicatePurchase       = "DUPLICATE_PURCHASE"
+	ErrCodeStorageUnavailable      = "STORAGE_UNAVAILABLE"
+	ErrCodeIdempotencyKeyReused    = "IDEMPOTENCY_KEY_REUSED"
+	ErrCodeTermsNotAccepted        = "TOS_NOT_ACCEPTED"
+	ErrCodeRateLimited             = "RATE_LIMITED"
+	ErrCodeRegistrationRateLimited = "REGISTRATION_RATE_LIMITED"
+	ErrCodeShuttingDown            = "SHUTTING_DOWN"
+
+	ErrCodeDelegationNotFound          = "DELEGATION_NOT_FOUND"
+	ErrCodeDelegationExpired           = "DELEGATION_EXPIRED"
+	ErrCodeDelegationAllowanceExceeded = "DELEGATION_ALLOWANCE_EXCEEDED"
+
+	ErrCodeNotificationNotFound = "NOTIFICATION_NOT_FOUND"
+)
+
 // User represents a user in the system.
-// It holds the user's identifier, credentials, and current coin balance.
+// It holds the user's identifier, credentials, and current coin balance. TokenVersion is bumped to invalidate
+// the tokens issued to the user before.
 type User struct {
-	ID       int32
-	Username string
-	Password string
-	Coins    int
+	ID           int32
+	Username     string
+	Password     string
+	Coins        int64
+	TokenVersion int32
 }
 
 // Item represents an item available in the merch store.
-// It includes details such as the item's identifier, name, and price.
+// It includes details such as the item's identifier, name, and price. Price is what the item costs now:
+// OriginalPrice less the discount of the promotion identified by PromotionID, when one applies (see Promotion).
 type Item struct {
-	ID    int
-	Name  string
-	Price int
+	ID            int
+	Name          string
+	Price         int
+	OriginalPrice int
+	PromotionID   *int64
+}
+
+// CatalogItem represents an item of the public merch catalog.
+// It contains the item's name, category, and price. While a promotion applies, the price is discounted and
+// the promotion is reported in PromotionID, with the undiscounted price in OriginalPrice.
+type CatalogItem struct {
+	Name          string `json:"name"`
+	Category      string `json:"category,omitempty"`
+	Price         int    `json:"price"`
+	OriginalPrice int    `json:"originalPrice,omitempty"`
+	PromotionID   *int64 `json:"promotionId,omitempty"`
+}
+
+// MerchCategoryRequest represents the payload for assigning an item to a category. An empty category leaves the
+// item uncategorized.
+type MerchCategoryRequest struct {
+	Category string `json:"category"`
+}
+
+// MerchCategory represents the category an item is assigned to, omitted for an uncategorized item.
+type MerchCategory struct {
+	Item     string `json:"item"`
+	Category string `json:"category,omitempty"`
+}
+
+// AffordableCatalogItem represents an item of the merch catalog as seen by a user.
+// Affordable reports whether the user's available balance covers the price, and Shortfall
+// is the number of coins the user lacks to buy the item, zero when it is affordable. Promotions are reported
+// like in CatalogItem, and affordability is that of the discounted price.
+type AffordableCatalogItem struct {
+	Name          string `json:"name"`
+	Price         int    `json:"price"`
+	OriginalPrice int    `json:"originalPrice,omitempty"`
+	PromotionID   *int64 `json:"promotionId,omitempty"`
+	Affordable    bool   `json:"affordable"`
+	Shortfall     int    `json:"shortfall"`
+}
+
+// ErrInvalidAmount indicates that an amount in a request payload is not a non-negative integer.
+var ErrInvalidAmount = errors.New("models: amount must be a non-negative integer")
+
+// coinAmountPattern matches the JSON numbers accepted as a CoinAmount: non-negative integers,
+// optionally written with a zero fractional part, such as 100 or 100.0.
+var coinAmountPattern = regexp.MustCompile(`^(0|[1-9][0-9]*)(\.0+)?$`)
+
+// CoinAmount is an amount of coins in a request payload. It is used for every amount clients send,
+// so that malformed amounts are rejected with ErrInvalidAmount instead of a JSON type error.
+type CoinAmount int
+
+// UnmarshalJSON accepts only non-negative integer JSON numbers. Strings, fractional numbers, exponents,
+// and numbers that do not fit into an int are rejected with ErrInvalidAmount. A null leaves the amount unchanged.
+func (amount *CoinAmount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	match := coinAmountPattern.FindSubmatch(data)
+	if match == nil {
+		return ErrInvalidAmount
+	}
+
+	value, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return ErrInvalidAmount
+	}
+
+	*amount = CoinAmount(value)
+	return nil
 }
 
 // SendCoinRequest represents the payload for transferring coins between users.
 // It contains the recipient's username and the amount of coins to transfer.
 type SendCoinRequest struct {
+	ToUser string     `json:"toUser"`
+	Amount CoinAmount `json:"amount"`
+}
+
+// PurchaseResult represents the response payload for a successful purchase via /api/buy/{item}.
+// RemainingCoins is the buyer's balance after the purchase. DryRun is set when the purchase was only validated.
+// A purchase made on behalf of another user (see Delegation) names the grantor in OnBehalfOf, who is charged and
+// receives the item, and reports the allowance left in RemainingAllowance; the buyer's balance is unchanged.
+// GrantorID and GrantorCoins, the grantor's balance after the purchase, are kept for the grantor's event stream.
+// A purchase discounted by a promotion reports the promotion in PromotionID and the undiscounted price in
+// OriginalPrice.
+type PurchaseResult struct {
+	Item               string `json:"item"`
+	Price              int    `json:"price"`
+	OriginalPrice      int    `json:"originalPrice,omitempty"`
+	PromotionID        *int64 `json:"promotionId,omitempty"`
+	Quantity           int    `json:"quantity"`
+	RemainingCoins     int64  `json:"remainingCoins"`
+	ReceiptNumber      string `json:"receiptNumber,omitempty"`
+	DryRun             bool   `json:"dryRun,omitempty"`
+	OnBehalfOf         string `json:"onBehalfOf,omitempty"`
+	RemainingAllowance *int   `json:"remainingAllowance,omitempty"`
+	GrantorID          int32  `json:"-"`
+	GrantorCoins       int64  `json:"-"`
+}
+
+// PurchaseResultV2 represents the response payload of version 2 of the API for a successful purchase.
+// The purchased item is nested under Purchase, and DryRun is always present.
+type PurchaseResultV2 struct {
+	Purchase           PurchasedItem `json:"purchase"`
+	RemainingCoins     int64         `json:"remainingCoins"`
+	ReceiptNumber      string        `json:"receiptNumber,omitempty"`
+	DryRun             bool          `json:"dryRun"`
+	OnBehalfOf         string        `json:"onBehalfOf,omitempty"`
+	RemainingAllowance *int          `json:"remainingAllowance,omitempty"`
+}
+
+// Receipt represents a purchase as shown at pickup: its receipt number, the item and the number of units bought,
+// the buyer, and when the purchase was made. RedeemedAt is set once the front desk has handed the item out.
+type Receipt struct {
+	Number      string     `json:"number"`
+	Item        string     `json:"item"`
+	Quantity    int        `json:"quantity"`
+	Owner       string     `json:"owner"`
+	PurchasedAt time.Time  `json:"purchasedAt"`
+	RedeemedAt  *time.Time `json:"redeemedAt,omitempty"`
+}
+
+// PurchasedItem describes the item bought in a purchase: its name, unit price, and the number of units bought.
+type PurchasedItem struct {
+	Item     string `json:"item"`
+	Price    int    `json:"price"`
+	Quantity int    `json:"quantity"`
+}
+
+// TransferResult is the outcome of a coin transfer: the ID of the recorded transfer and the sender's balance
+// right after it.
+type TransferResult struct {
+	TransferID     int64
+	RemainingCoins int64
+}
+
+// SendCoinResponse represents the response payload for the /api/sendCoin endpoint.
+// It contains the ID of the recorded transfer. A dry run records nothing, so it reports a zero ID and sets DryRun.
+// RemainingCoins, the sender's balance after the transfer, is sent in a header rather than in the body, and only
+// when the transfer has been made.
+type SendCoinResponse struct {
+	TransferID     int64 `json:"transferId"`
+	DryRun         bool  `json:"dryRun,omitempty"`
+	RemainingCoins int64 `json:"-"`
+}
+
+// TransferConfirmation represents the response payload for a transfer that must be confirmed before it is executed:
+// the token to send to /api/sendCoin/confirm before ExpiresAt, and the transfer it confirms.
+type TransferConfirmation struct {
+	ConfirmationToken string    `json:"confirmationToken"`
+	ToUser            string    `json:"toUser"`
+	Amount            int       `json:"amount"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// Terms represents the response payload of /api/tos: the current version of the terms of service and their text.
+type Terms struct {
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+// AcceptTermsRequest represents the payload for accepting the terms of service of the given version.
+type AcceptTermsRequest struct {
+	Version int `json:"version"`
+}
+
+// TermsAcceptance is the latest version of the terms of service accepted by a user, and when it was accepted.
+type TermsAcceptance struct {
+	Version    int        `json:"version"`
+	AcceptedAt *time.Time `json:"acceptedAt"`
+}
+
+// TransferPreview represents the response payload of /api/sendCoin/preview: the balances the sender and the recipient
+// would have after the transfer. RecipientBalance is only disclosed when the service is configured to show it.
+type TransferPreview struct {
+	OK               bool   `json:"ok"`
+	ToUser           string `json:"toUser"`
+	Amount           int    `json:"amount"`
+	SenderBalance    int64  `json:"senderBalance"`
+	RecipientBalance int64  `json:"recipientBalance,omitempty"`
+}
+
+// IdempotentResponse is the response to a request carrying an Idempotency-Key, stored to be replayed to repeats of
+// the request. Fingerprint identifies the request, so that the key cannot be reused for a different one.
+type IdempotentResponse struct {
+	Fingerprint string
+	StatusCode  int
+	Body        []byte
+}
+
+// ConfirmTransferRequest represents the payload for confirming a transfer with its confirmation token.
+type ConfirmTransferRequest struct {
+	ConfirmationToken string `json:"confirmationToken"`
+}
+
+// ScheduleTransferRequest represents the payload for scheduling a coin transfer.
+// ExecuteAt is an RFC 3339 timestamp in the future at which the transfer is made.
+type ScheduleTransferRequest struct {
+	ToUser    string     `json:"toUser"`
+	Amount    CoinAmount `json:"amount"`
+	ExecuteAt string     `json:"executeAt"`
+}
+
+// ScheduledTransfer represents a coin transfer scheduled for later. Its coins are held from scheduling until
+// the transfer is made, fails, or is canceled. TransferID identifies the transfer made on completion.
+type ScheduledTransfer struct {
+	ID            int64     `json:"id"`
+	FromUserID    int32     `json:"-"`
+	ToUser        string    `json:"toUser"`
+	Amount        int       `json:"amount"`
+	ExecuteAt     time.Time `json:"executeAt"`
+	Status        string    `json:"status"`
+	TransferID    int64     `json:"transferId,omitempty"`
+	FailureReason string    `json:"failureReason,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// ScheduledTransfersResponse represents the response payload listing the user's scheduled transfers.
+type ScheduledTransfersResponse struct {
+	ScheduledTransfers []ScheduledTransfer `json:"scheduledTransfers"`
+}
+
+// GiftRequest represents the payload for buying an item as a gift for another user.
+// It contains the recipient's username.
+type GiftRequest struct {
 	ToUser string `json:"toUser"`
-	Amount int    `json:"amount"`
 }
 
 // InventoryItem represents an entry in a user's inventory.
-// It includes the type of item and the quantity owned by the user.
+// It includes the type of item, its category unless it is uncategorized, and the quantity owned by the user,
+// split into the units still pending pickup and the units already handed out.
 type InventoryItem struct {
-	Type     string `json:"type"`
-	Quantity int    `json:"quantity"`
+	Type              string `json:"type"`
+	Category          string `json:"category,omitempty"`
+	Quantity          int    `json:"quantity"`
+	PendingQuantity   int    `json:"pendingQuantity"`
+	FulfilledQuantity int    `json:"fulfilledQuantity"`
+}
+
+// InventoryCategory represents the entries of a user's inventory in one category. Category is omitted for the
+// group of uncategorized items.
+type InventoryCategory struct {
+	Category string          `json:"category,omitempty"`
+	Items    []InventoryItem `json:"items"`
+}
+
+// ConsumeRequest represents the payload for marking units of an owned item as handed out.
+type ConsumeRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// InventoryDrift is an entry of the materialized inventory counts that differs from the quantities aggregated
+// from the user's purchases. Counted values come from the counts, actual values from the purchases.
+type InventoryDrift struct {
+	UserID           int32  `json:"userId"`
+	Item             string `json:"item"`
+	CountedQuantity  int    `json:"countedQuantity"`
+	CountedFulfilled int    `json:"countedFulfilled"`
+	ActualQuantity   int    `json:"actualQuantity"`
+	ActualFulfilled  int    `json:"actualFulfilled"`
+}
+
+// InventoryReconciliationResponse represents the result of an inventory reconciliation.
+// Repaired is set when the drifted entries were overwritten with the actual quantities.
+type InventoryReconciliationResponse struct {
+	Drift    []InventoryDrift `json:"drift"`
+	Repaired bool             `json:"repaired"`
 }
 
 // TransactionDetail contains detailed information about a coin transaction.
 // It may include details about the sender, the recipient, and the amount transferred.
+// ID identifies the transfer, so that it can be referred to and fetched from /api/transfers/{id}.
 type TransactionDetail struct {
+	ID       int64  `json:"id,omitempty"`
 	FromUser string `json:"fromUser,omitempty"`
 	ToUser   string `json:"toUser,omitempty"`
 	Amount   int    `json:"amount"`
 }
 
+// GiftDetail contains information about an item bought by the user for someone else.
+// It includes the recipient, the item name, and the amount of coins spent.
+type GiftDetail struct {
+	ToUser string `json:"toUser"`
+	Item   string `json:"item"`
+	Amount int    `json:"amount"`
+}
+
 // CoinHistory represents the history of coin transactions for a user.
-// It maintains separate lists for coins received and sent.
+// It maintains separate lists for coins received and sent, and for coins spent on gifts.
 type CoinHistory struct {
 	Received []TransactionDetail `json:"received"`
 	Sent     []TransactionDetail `json:"sent"`
+	Gifts    []GiftDetail        `json:"gifts,omitempty"`
+}
+
+// MarshalJSON encodes the history with empty arrays in place of nil received and sent lists,
+// so that clients always get both arrays.
+func (history CoinHistory) MarshalJSON() ([]byte, error) {
+	type coinHistory CoinHistory
+	if history.Received == nil {
+		history.Received = []TransactionDetail{}
+	}
+	if history.Sent == nil {
+		history.Sent = []TransactionDetail{}
+	}
+	return json.Marshal(coinHistory(history))
 }
 
 // InfoResponse represents the response payload for the /api/info endpoint.
 // It contains the user's current coin balance, inventory details, and transaction history.
+// AvailableCoins is the balance minus the coins reserved by active holds.
+// Warnings names the sections that could not be loaded, which are left empty; it is only set by partial responses.
+// Truncated is set when the coin history is too long to be returned whole and only its most recent transfers are;
+// TotalSent and TotalReceived then count the whole history, which is available from /api/transfers.
+// InventoryByCategory groups the inventory by category and UnreadCount counts the unread notifications of the user;
+// both are only set when the client asks for them.
 type InfoResponse struct {
-	Coins       int             `json:"coins"`
-	Inventory   []InventoryItem `json:"inventory"`
-	CoinHistory *CoinHistory    `json:"coinHistory"`
+	Coins               int64               `json:"coins"`
+	AvailableCoins      int64               `json:"availableCoins"`
+	Inventory           []InventoryItem     `json:"inventory"`
+	InventoryByCategory []InventoryCategory `json:"inventoryByCategory,omitempty"`
+	CoinHistory         CoinHistory         `json:"coinHistory"`
+	Warnings            []string            `json:"warnings,omitempty"`
+	Truncated           bool                `json:"truncated,omitempty"`
+	TotalSent           int64               `json:"totalSent,omitempty"`
+	TotalReceived       int64               `json:"totalReceived,omitempty"`
+	UnreadCount         *int64              `json:"unreadCount,omitempty"`
+}
+
+// MarshalJSON encodes the response with an empty array in place of a nil inventory,
+// so that an empty account is serialized with the same shape as any other.
+func (info InfoResponse) MarshalJSON() ([]byte, error) {
+	type infoResponse InfoResponse
+	if info.Inventory == nil {
+		info.Inventory = []InventoryItem{}
+	}
+	return json.Marshal(infoResponse(info))
+}
+
+// Transfer represents a single coin transfer in the paginated transfers list.
+// Amount is what the sender paid; Bonus is what a gifting campaign, identified by CampaignID, credited the
+// recipient on top of it. Both are omitted for transfers made outside campaigns.
+type Transfer struct {
+	ID         int64     `json:"id"`
+	FromUser   string    `json:"fromUser"`
+	ToUser     string    `json:"toUser"`
+	Amount     int       `json:"amount"`
+	Bonus      int64     `json:"bonus,omitempty"`
+	CampaignID *int64    `json:"campaignId,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ReverseTransferRequest represents the optional request payload of a transfer reversal.
+// Mode is "full", the default, to fail unless the whole amount can be moved back, or "partial"
+// to move back as much as the recipient still has available.
+type ReverseTransferRequest struct {
+	Mode string `json:"mode"`
+}
+
+// TransferReversal represents a transfer reversed by an administrator. ReversalTransferID identifies the compensating
+// transfer moving ReversedAmount coins back from the recipient to the sender; Partial is set when it is less than Amount.
+type TransferReversal struct {
+	TransferID         int64     `json:"transferId"`
+	ReversalTransferID int64     `json:"reversalTransferId"`
+	FromUser           string    `json:"fromUser"`
+	ToUser             string    `json:"toUser"`
+	Amount             int       `json:"amount"`
+	ReversedAmount     int       `json:"reversedAmount"`
+	Partial            bool      `json:"partial"`
+	ReversedBy         int32     `json:"reversedBy"`
+	ReversedAt         time.Time `json:"reversedAt"`
+}
+
+// PageCursor identifies the position of an entry in a list ordered by creation time and ID, such as the transfers.
+type PageCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// TransfersFilter selects a page of a user's transfers.
+// Direction is one of "all", "sent", or "received"; After, when set, selects transfers older than the cursor.
+// IncludeArchived adds the transfers moved to the archive to the recent ones.
+type TransfersFilter struct {
+	Direction       string
+	After           *PageCursor
+	Limit           int
+	IncludeArchived bool
+}
+
+// PageMeta describes a page of a paginated list and is embedded in the response of every list endpoint, next to
+// the entries of the page. Limit is the page size applied; NextCursor is set when more entries are available and is
+// passed back as the cursor query parameter to fetch the next page.
+type PageMeta struct {
+	NextCursor string `json:"nextCursor,omitempty"`
+	Limit      int    `json:"limit"`
+}
+
+// TransfersResponse represents the response payload for the /api/transfers endpoint.
+type TransfersResponse struct {
+	Transfers []Transfer `json:"transfers"`
+	PageMeta
+}
+
+// AccrualRequest represents the payload for manually triggering the monthly coin accrual.
+// Period is a YYYY-MM month; the current month is used when it is empty.
+type AccrualRequest struct {
+	Period string `json:"period"`
+}
+
+// AccrualResponse represents the result of a monthly coin accrual.
+type AccrualResponse struct {
+	Period        string `json:"period"`
+	Amount        int    `json:"amount"`
+	UsersCredited int    `json:"usersCredited"`
+}
+
+// FeatureFlag represents the effective state of a feature flag and where it is set: default, file, or env.
+// An enabled flag applies to Percentage percent of users.
+type FeatureFlag struct {
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	Percentage int    `json:"percentage"`
+	Source     string `json:"source"`
+}
+
+// FeatureFlagsResponse represents the response payload listing the effective feature flags.
+type FeatureFlagsResponse struct {
+	Flags []FeatureFlag `json:"flags"`
+}
+
+// Route describes an endpoint of the service for tooling: its method, its chi pattern, and whether it requires
+// a token (JWTRequired) and administrator rights (AdminRequired).
+type Route struct {
+	Method        string `json:"method"`
+	Pattern       string `json:"pattern"`
+	JWTRequired   bool   `json:"jwtRequired"`
+	AdminRequired bool   `json:"adminRequired"`
+}
+
+// RoutesResponse represents the response payload of /api/routes.
+type RoutesResponse struct {
+	Routes []Route `json:"routes"`
+}
+
+// BulkUsersRequest represents the payload for provisioning several users at once.
+type BulkUsersRequest struct {
+	Users []BulkUser `json:"users"`
+}
+
+// BulkUser is a user to provision. The default balance of a new user is used when Coins is omitted.
+type BulkUser struct {
+	Username string `json:"username"`
+	Coins    *int64 `json:"coins,omitempty"`
+}
+
+// Statuses of users in a BulkUsersResponse.
+const (
+	BulkUserCreated   = "created"   // The user was created with the returned password.
+	BulkUserExists    = "exists"    // A user with the username already exists and was left unchanged.
+	BulkUserDuplicate = "duplicate" // The username appears earlier in the same request.
+)
+
+// BulkUsersResponse represents the outcome of provisioning, one entry per requested user in request order.
+type BulkUsersResponse struct {
+	Users []BulkUserResult `json:"users"`
+}
+
+// BulkUserResult is the outcome for one requested user. Password is the generated password of a created user;
+// it is not stored in plain text and cannot be retrieved again.
+type BulkUserResult struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	Password string `json:"password,omitempty"`
+}
+
+// InviteRequest represents the payload for creating an invite code.
+// ValidFor is a Go duration such as "72h"; a default validity is used when it is empty.
+type InviteRequest struct {
+	ValidFor string `json:"validFor"`
+}
+
+// InviteCode represents a single-use code allowing a new user to register while registration is invite-only.
+type InviteCode struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Session represents an active token of a user, identified by the token's ID (jti).
+// Current marks the session of the token used for the request listing the sessions.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    int32     `json:"-"`
+	UserAgent string    `json:"userAgent"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Current   bool      `json:"current"`
+}
+
+// SessionsResponse represents the response payload for the /api/auth/sessions endpoint.
+type SessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+// PersonalTokenRequest represents the payload for creating a personal access token.
+// Scopes lists the routes the token may use; ExpiresAt, when set, is an RFC 3339 timestamp in the future.
+type PersonalTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expiresAt,omitempty"`
+}
+
+// PersonalToken represents a long-lived personal access token of a user. Only the start of the token, Prefix,
+// is kept in a readable form; the token itself is stored hashed and shown only when it is created.
+type PersonalToken struct {
+	ID        int64      `json:"id"`
+	UserID    int32      `json:"-"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// CreatedPersonalToken represents the response payload for a newly created personal access token.
+// Token is the secret to send as a Bearer token; it cannot be retrieved again.
+type CreatedPersonalToken struct {
+	PersonalToken
+	Token string `json:"token"`
+}
+
+// PersonalTokensResponse represents the response payload listing the user's personal access tokens.
+type PersonalTokensResponse struct {
+	Tokens []PersonalToken `json:"tokens"`
+}
+
+// DelegationRequest represents the payload for authorizing another user, Grantee, to spend up to Allowance coins
+// on purchases on behalf of the authenticated user until ExpiresAt, an RFC 3339 timestamp in the future.
+type DelegationRequest struct {
+	Grantee   string     `json:"grantee"`
+	Allowance CoinAmount `json:"allowance"`
+	ExpiresAt string     `json:"expiresAt"`
+}
+
+// Delegation represents an authorization of Grantee to buy items paid for by Grantor. RemainingAllowance is the part
+// of Allowance not yet spent; the delegation stops working once it is spent, once it expires, or when it is revoked.
+// Listings name only the other party: the grantee of a granted delegation and the grantor of a received one.
+type Delegation struct {
+	ID                 int64     `json:"id"`
+	Grantor            string    `json:"grantor,omitempty"`
+	Grantee            string    `json:"grantee,omitempty"`
+	Allowance          int       `json:"allowance"`
+	RemainingAllowance int       `json:"remainingAllowance"`
+	ExpiresAt          time.Time `json:"expiresAt"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+// DelegationsResponse represents the response payload listing the delegations the user granted to others
+// and those the user received, newest first. Revoked delegations are not listed.
+type DelegationsResponse struct {
+	Granted  []Delegation `json:"granted"`
+	Received []Delegation `json:"received"`
+}
+
+// FailedPurchase represents an attempt to buy an item that failed because of the user's balance or the item itself.
+// Failed purchases are recorded as a signal of unmet demand.
+type FailedPurchase struct {
+	UserID    int32     `json:"-"`
+	ItemName  string    `json:"item"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FailedPurchaseStat represents the number of failed purchases of an item for one reason.
+type FailedPurchaseStat struct {
+	Item   string `json:"item"`
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// FailedPurchaseStatsResponse represents failed purchases aggregated by item and reason over a date range.
+// From and To are inclusive YYYY-MM-DD dates in UTC.
+type FailedPurchaseStatsResponse struct {
+	From  string               `json:"from"`
+	To    string               `json:"to"`
+	Stats []FailedPurchaseStat `json:"stats"`
+}
+
+// EconomyStats represents the health of the coin economy over a date range: the coins held by all users and the
+// Gini coefficient of their balances, from 0 when everyone holds the same to nearly 1 when one user holds all coins,
+// as of GeneratedAt, and the daily transfer and purchase volumes. From and To are inclusive YYYY-MM-DD dates in UTC.
+type EconomyStats struct {
+	From               string       `json:"from"`
+	To                 string       `json:"to"`
+	Users              int          `json:"users"`
+	CoinsInCirculation int64        `json:"coinsInCirculation"`
+	Gini               float64      `json:"gini"`
+	Days               []EconomyDay `json:"days"`
+	GeneratedAt        time.Time    `json:"generatedAt"`
+}
+
+// EconomyDay represents the coin movements of a UTC day: the number of transfers and the coins they moved,
+// and the number of items bought and the coins spent on them.
+type EconomyDay struct {
+	Date           string `json:"date"`
+	Transfers      int    `json:"transfers"`
+	TransferVolume int64  `json:"transferVolume"`
+	Purchases      int    `json:"purchases"`
+	PurchaseVolume int64  `json:"purchaseVolume"`
+}
+
+// CoinHold represents coins of a user reserved for a pending operation.
+// An active hold reduces the available balance until it is released or captured.
+type CoinHold struct {
+	ID        int64
+	UserID    int32
+	Amount    int
+	Reason    string
+	Status    string
+	CreatedAt time.Time
+}
+
+// Invariants of the coin economy checked by the storage, the values of InvariantViolation.Invariant.
+const (
+	InvariantNegativeBalance = "negative_balance" // A user holds, or has reserved, more coins than they have.
+	InvariantLedgerBalance   = "ledger_balance"   // A balance differs from the coins the user received less those spent.
+	InvariantTransferBalance = "transfer_balance" // The records of a transfer, its reversal, or its schedule disagree.
+	InvariantPurchaseTotal   = "purchase_total"   // The inventory counts of a user differ from the purchases of the item.
+	// InvariantUsername reports usernames stored unnormalized, which lookups no longer find, or shared by several
+	// users once normalized (see NormalizeUsername).
+	InvariantUsername = "username_normalized"
+)
+
+// InvariantReport represents the result of checking the invariants of the coin economy as of CheckedAt.
+// TotalBalances is the sum of the balances of all users and TotalLedger the sum of what they should be according to
+// the recorded operations; the two are equal when no user has a ledger_balance violation.
+type InvariantReport struct {
+	CheckedAt     time.Time            `json:"checkedAt"`
+	TotalBalances int64                `json:"totalBalances"`
+	TotalLedger   int64                `json:"totalLedger"`
+	Violations    []InvariantViolation `json:"violations"`
+}
+
+// InvariantViolation represents a row breaking an invariant: the table and ID of the row, or the user ID for
+// content.users and content.inventory_counts, the value the invariant expects and the one found, and a description.
+type InvariantViolation struct {
+	Invariant string `json:"invariant"`
+	Table     string `json:"table"`
+	RowID     int64  `json:"rowId"`
+	Expected  int64  `json:"expected"`
+	Actual    int64  `json:"actual"`
+	Detail    string `json:"detail"`
+}
+
+// QueueTicket represents the response payload for a purchase accepted into a flash-sale queue.
+// It contains the token used to poll the purchase status and the position in the queue.
+type QueueTicket struct {
+	Token    string `json:"token"`
+	Position int    `json:"position"`
+}
+
+// QueueStatusResponse represents the response payload for the /api/buy/status/{token} endpoint.
+// Position is set while the purchase is pending and Errors describes why a failed purchase was rejected.
+type QueueStatusResponse struct {
+	Item     string `json:"item"`
+	Status   string `json:"status"`
+	Position int    `json:"position,omitempty"`
+	Errors   string `json:"errors,omitempty"`
+}
+
+// AccountExport represents the account record of a user in the export of their data.
+// It leaves out the password hash.
+type AccountExport struct {
+	ID        int32     `json:"id"`
+	Username  string    `json:"username"`
+	Coins     int64     `json:"coins"`
+	IsActive  bool      `json:"isActive"`
+	IsAdmin   bool      `json:"isAdmin"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PurchaseExport represents a purchase in the export of a user's data: an item the user bought, possibly
+// as a gift from GiftedBy, or an item the user bought as a gift for GiftedTo.
+type PurchaseExport struct {
+	ID                int64     `json:"id"`
+	Item              string    `json:"item"`
+	Quantity          int       `json:"quantity"`
+	FulfilledQuantity int       `json:"fulfilledQuantity"`
+	GiftedBy          string    `json:"giftedBy,omitempty"`
+	GiftedTo          string    `json:"giftedTo,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// AccrualExport represents coins credited to a user by the monthly accrual of Period, a YYYY-MM month.
+type AccrualExport struct {
+	Period    string    `json:"period"`
+	Amount    int       `json:"amount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SessionExport represents a session of a user in the export of their data, including expired and revoked ones.
+type SessionExport struct {
+	ID        string     `json:"id"`
+	UserAgent string     `json:"userAgent"`
+	IssuedAt  time.Time  `json:"issuedAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Notification represents an entry of a user's notifications inbox. Category is one of the categories users can
+// mute, and Message describes the event in plain words. User is the other user involved in the event and Amount
+// and Item its coins and merch, each omitted when the event has none; Amount is negative for coins taken from the
+// user. ReadAt is set once the user has marked the notification as read.
+type Notification struct {
+	ID        int64      `json:"id"`
+	Category  string     `json:"category"`
+	Message   string     `json:"message"`
+	User      string     `json:"user,omitempty"`
+	Amount    int        `json:"amount,omitempty"`
+	Item      string     `json:"item,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+}
+
+// NotificationsFilter selects a page of a user's notifications.
+// UnreadOnly leaves out the notifications already read; After, when set, selects notifications older than the cursor.
+type NotificationsFilter struct {
+	UnreadOnly bool
+	After      *PageCursor
+	Limit      int
+}
+
+// NotificationsResponse represents the response payload for the /api/notifications endpoint, newest first.
+// UnreadCount counts all the unread notifications of the user, not only those of the page.
+type NotificationsResponse struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int64          `json:"unreadCount"`
+	PageMeta
+}
+
+// ReadAllNotificationsResponse represents the result of marking every notification of a user as read.
+// Marked counts the notifications that were unread until then.
+type ReadAllNotificationsResponse struct {
+	Marked int64 `json:"marked"`
+}
+
+// NotificationPreferences represents the notification categories a user has muted. No notification of a muted
+// category is written to the inbox; notifications written before the category was muted are kept.
+type NotificationPreferences struct {
+	Muted []string `json:"muted"`
+}
+
+// Types of the events published to the event stream of a user, sent as the event field of /api/events.
+const (
+	EventCoinsReceived     = "coins_received"
+	EventPurchaseCompleted = "purchase_completed"
+	EventBalanceChanged    = "balance_changed"
+)
+
+// EventTypes lists every event type, in the order they are documented.
+var EventTypes = []string{EventCoinsReceived, EventPurchaseCompleted, EventBalanceChanged}
+
+// Event is a notification for a user. Data holds the payload of the type: one of the Event...V1 structs.
+// Payloads only gain fields; an incompatible change is published as a new event type with a V2 payload.
+type Event struct {
+	Type string
+	Data any
+}
+
+// EventCoinsReceivedV1 is the payload of coins_received: a transfer to the user has been committed.
+type EventCoinsReceivedV1 struct {
+	TransferID int64  `json:"transferId"`
+	FromUser   string `json:"fromUser"`
+	Amount     int    `json:"amount"`
+}
+
+// EventPurchaseCompletedV1 is the payload of purchase_completed: a purchase of the user has been committed.
+type EventPurchaseCompletedV1 struct {
+	Item          string `json:"item"`
+	Price         int    `json:"price"`
+	Quantity      int    `json:"quantity"`
+	ReceiptNumber string `json:"receiptNumber,omitempty"`
+}
+
+// EventBalanceChangedV1 is the payload of balance_changed: the coin balance of the user after a committed change.
+type EventBalanceChangedV1 struct {
+	Coins int64 `json:"coins"`
+}
+
+// APIActivity is an authenticated request of a user to the API, recorded so that users can debug their scripts.
+// Action is the method and route pattern, such as "GET /api/buy/{item}", and Path the requested path.
+type APIActivity struct {
+	ID        int64     `json:"-"`
+	UserID    int32     `json:"-"`
+	Action    string    `json:"action"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"timestamp"`
+}
+
+// ActivityFilter selects a page of a user's API activity recorded in [From, To).
+// After, when set, selects activity older than the cursor.
+type ActivityFilter struct {
+	From  time.Time
+	To    time.Time
+	After *PageCursor
+	Limit int
+}
+
+// UserActivityResponse represents the response payload for the /api/account/activity endpoint, newest first.
+// From and To are the inclusive YYYY-MM-DD dates of the range.
+type UserActivityResponse struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Activity []APIActivity `json:"activity"`
+	PageMeta
+}
+
+// CampaignRequest represents the payload for creating or updating a gifting campaign. Multiplier is how many times
+// the amount of a transfer its recipient gets, with at most two decimal places, and StartsAt and EndsAt are RFC 3339
+// timestamps delimiting the campaign.
+type CampaignRequest struct {
+	Name       string     `json:"name"`
+	Multiplier float64    `json:"multiplier"`
+	Budget     CoinAmount `json:"budget"`
+	StartsAt   string     `json:"startsAt"`
+	EndsAt     string     `json:"endsAt"`
+}
+
+// Campaign represents a gifting campaign: from StartsAt until EndsAt, every transfer credits its recipient Multiplier
+// times its amount while the sender is charged the amount once. The bonus is paid from Budget, of which
+// RemainingBudget is left; a transfer whose whole bonus the remaining budget cannot cover gets no bonus.
+type Campaign struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	Multiplier      float64   `json:"multiplier"`
+	Budget          int64     `json:"budget"`
+	RemainingBudget int64     `json:"remainingBudget"`
+	StartsAt        time.Time `json:"startsAt"`
+	EndsAt          time.Time `json:"endsAt"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// CampaignsResponse represents the response payload listing the gifting campaigns.
+type CampaignsResponse struct {
+	Campaigns []Campaign `json:"campaigns"`
+}
+
+// PromotionRequest represents the payload for creating or updating a promotion. It targets either one item,
+// by name, or every item of a category, and takes either DiscountPercent percent or DiscountAmount coins off
+// the price. StartsAt and EndsAt are RFC 3339 timestamps delimiting the promotion.
+type PromotionRequest struct {
+	Item            string     `json:"item,omitempty"`
+	Category        string     `json:"category,omitempty"`
+	DiscountPercent int        `json:"discountPercent,omitempty"`
+	DiscountAmount  CoinAmount `json:"discountAmount,omitempty"`
+	StartsAt        string     `json:"startsAt"`
+	EndsAt          string     `json:"endsAt"`
+}
+
+// Promotion represents a discount on the price of an item, or of every item of a category, from StartsAt until
+// EndsAt. The discount is DiscountPercent percent of the price, rounded down, or DiscountAmount coins; it never
+// brings a price below one coin. When several promotions apply to an item, the one taking the most coins off
+// its price wins, and the earliest created of those on a tie.
+type Promotion struct {
+	ID              int64     `json:"id"`
+	Item            string    `json:"item,omitempty"`
+	Category        string    `json:"category,omitempty"`
+	DiscountPercent int       `json:"discountPercent,omitempty"`
+	DiscountAmount  int       `json:"discountAmount,omitempty"`
+	StartsAt        time.Time `json:"startsAt"`
+	EndsAt          time.Time `json:"endsAt"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// PromotionsResponse represents the response payload listing the promotions.
+type PromotionsResponse struct {
+	Promotions []Promotion `json:"promotions"`
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfoResponse_MarshalJSON_EmptyAccount(t *testing.T) {
+	const golden = `{"coins":0,"availableCoins":0,"inventory":[],"coinHistory":{"received":[],"sent":[]}}`
+
+	result, err := json.Marshal(InfoResponse{})
+	require.NoError(t, err)
+	assert.Equal(t, golden, string(result))
+
+	result, err = json.Marshal(&InfoResponse{})
+	require.NoError(t, err)
+	assert.Equal(t, golden, string(result), "pointers must be serialized the same way")
+}
+
+func TestCoinAmount_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    CoinAmount
+		wantErr bool
+	}{
+		{name: "integer", payload: `{"amount": 100}`, want: 100},
+		{name: "zero", payload: `{"amount": 0}`, want: 0},
+		{name: "zero fractional part", payload: `{"amount": 100.0}`, want: 100},
+		{name: "null", payload: `{"amount": null}`, want: 0},
+		{name: "missing", payload: `{}`, want: 0},
+		{name: "fractional", payload: `{"amount": 99.5}`, wantErr: true},
+		{name: "string", payload: `{"amount": "100"}`, wantErr: true},
+		{name: "exponent", payload: `{"amount": 1e2}`, wantErr: true},
+		{name: "negative", payload: `{"amount": -5}`, wantErr: true},
+		{name: "negative zero", payload: `{"amount": -0}`, wantErr: true},
+		{name: "overflow", payload: `{"amount": 99999999999999999999}`, wantErr: true},
+		{name: "boolean", payload: `{"amount": true}`, wantErr: true},
+		{name: "object", payload: `{"amount": {}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req SendCoinRequest
+			err := json.Unmarshal([]byte(tt.payload), &req)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAmount)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, req.Amount)
+		})
+	}
+}
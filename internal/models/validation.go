@@ -0,0 +1,220 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Length limits of string inputs, in characters unless stated otherwise.
+const (
+	MaxUsernameLength = 32
+	MaxItemNameLength = 64
+	MaxCategoryLength = 50
+	MaxMessageLength  = 200
+	// MaxPasswordBytes is the longest password bcrypt can hash, in bytes.
+	MaxPasswordBytes = 72
+	// maxTokenLength caps short machine-readable values such as invite codes, scopes, periods, and timestamps.
+	maxTokenLength = 64
+)
+
+// Validator is implemented by request payloads that check and normalize their fields after decoding.
+type Validator interface {
+	Validate() error
+}
+
+// ErrTooLong is wrapped by the FieldError of a field longer than its length limit, so that callers can tell it
+// from other validation failures.
+var ErrTooLong = errors.New("models: value too long")
+
+// FieldError reports the request field that failed validation and why. Err, when set, classifies the failure,
+// such as ErrTooLong.
+type FieldError struct {
+	Field  string
+	Reason string
+	Err    error
+}
+
+func (err *FieldError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Field, err.Reason)
+}
+
+func (err *FieldError) Unwrap() error {
+	return err.Err
+}
+
+// sanitizeText validates a free-text field in place: it must be valid UTF-8 and at most maxLength characters
+// once NFC-normalized and trimmed of surrounding whitespace. The normalized value replaces the original.
+// Invalid bytes decoded by encoding/json turn into U+FFFD, so the replacement character is rejected as well.
+func sanitizeText(field string, value *string, maxLength int) error {
+	if !utf8.ValidString(*value) || strings.ContainsRune(*value, utf8.RuneError) {
+		return &FieldError{Field: field, Reason: "must be valid UTF-8"}
+	}
+
+	normalized := strings.TrimSpace(norm.NFC.String(*value))
+	if utf8.RuneCountInString(normalized) > maxLength {
+		return &FieldError{Field: field, Reason: fmt.Sprintf("must be at most %d characters", maxLength), Err: ErrTooLong}
+	}
+
+	*value = normalized
+	return nil
+}
+
+// NormalizeUsername returns the username NFC-normalized, trimmed, and with every run of whitespace inside it
+// collapsed into a single space, so that names differing only in whitespace name the same user.
+func NormalizeUsername(username string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(username)), " ")
+}
+
+// sanitizeUsername validates a username field in place as sanitizeText does, and collapses its whitespace as
+// NormalizeUsername does. A name made of whitespace only becomes empty.
+func sanitizeUsername(field string, value *string) error {
+	collapsed := strings.Join(strings.Fields(*value), " ")
+	if err := sanitizeText(field, &collapsed, MaxUsernameLength); err != nil {
+		return err
+	}
+
+	*value = collapsed
+	return nil
+}
+
+// SanitizeItemName returns the item name NFC-normalized and trimmed, or a FieldError when it is not valid UTF-8
+// or longer than MaxItemNameLength characters, in which case it wraps ErrTooLong.
+func SanitizeItemName(name string) (string, error) {
+	if err := sanitizeText("item", &name, MaxItemNameLength); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// SanitizeCategory returns the category NFC-normalized, trimmed, and lowercased, like the categories of the items,
+// or a FieldError when it is not valid UTF-8 or longer than MaxCategoryLength characters.
+func SanitizeCategory(category string) (string, error) {
+	if err := sanitizeText("category", &category, MaxCategoryLength); err != nil {
+		return "", err
+	}
+	return strings.ToLower(category), nil
+}
+
+// Validate normalizes the username (see NormalizeUsername) and the invite code. The password is kept byte for byte, so that existing
+// passwords keep matching, and is only checked to be valid UTF-8 that bcrypt can hash.
+func (req *AuthRequest) Validate() error {
+	if err := sanitizeUsername("username", &req.Username); err != nil {
+		return err
+	}
+	if !utf8.ValidString(req.Password) || strings.ContainsRune(req.Password, utf8.RuneError) {
+		return &FieldError{Field: "password", Reason: "must be valid UTF-8"}
+	}
+	if len(req.Password) > MaxPasswordBytes {
+		return &FieldError{Field: "password", Reason: fmt.Sprintf("must be at most %d bytes", MaxPasswordBytes)}
+	}
+	return sanitizeText("inviteCode", &req.InviteCode, maxTokenLength)
+}
+
+// Validate normalizes the recipient.
+func (req *SendCoinRequest) Validate() error {
+	return sanitizeUsername("toUser", &req.ToUser)
+}
+
+// Validate normalizes the confirmation token.
+func (req *ConfirmTransferRequest) Validate() error {
+	return sanitizeText("confirmationToken", &req.ConfirmationToken, maxTokenLength)
+}
+
+// Validate normalizes the recipient and the execution time.
+func (req *ScheduleTransferRequest) Validate() error {
+	if err := sanitizeUsername("toUser", &req.ToUser); err != nil {
+		return err
+	}
+	return sanitizeText("executeAt", &req.ExecuteAt, maxTokenLength)
+}
+
+// Validate normalizes the recipient.
+func (req *GiftRequest) Validate() error {
+	return sanitizeUsername("toUser", &req.ToUser)
+}
+
+// Validate normalizes the period.
+func (req *AccrualRequest) Validate() error {
+	return sanitizeText("period", &req.Period, maxTokenLength)
+}
+
+// Validate normalizes the usernames of all users, reporting the first invalid one by index.
+func (req *BulkUsersRequest) Validate() error {
+	for i := range req.Users {
+		if err := sanitizeUsername(fmt.Sprintf("users[%d].username", i), &req.Users[i].Username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate normalizes the validity period.
+func (req *InviteRequest) Validate() error {
+	return sanitizeText("validFor", &req.ValidFor, maxTokenLength)
+}
+
+// Validate normalizes the name and the window of the campaign.
+func (req *CampaignRequest) Validate() error {
+	if err := sanitizeText("name", &req.Name, MaxMessageLength); err != nil {
+		return err
+	}
+	if err := sanitizeText("startsAt", &req.StartsAt, maxTokenLength); err != nil {
+		return err
+	}
+	return sanitizeText("endsAt", &req.EndsAt, maxTokenLength)
+}
+
+// Validate normalizes the category (see SanitizeCategory).
+func (req *MerchCategoryRequest) Validate() error {
+	category, err := SanitizeCategory(req.Category)
+	if err != nil {
+		return err
+	}
+	req.Category = category
+	return nil
+}
+
+// Validate normalizes the target and the window of the promotion. Categories are lowercased, like those of the items.
+func (req *PromotionRequest) Validate() error {
+	if err := sanitizeText("item", &req.Item, MaxItemNameLength); err != nil {
+		return err
+	}
+	if err := sanitizeText("category", &req.Category, MaxCategoryLength); err != nil {
+		return err
+	}
+	req.Category = strings.ToLower(req.Category)
+	if err := sanitizeText("startsAt", &req.StartsAt, maxTokenLength); err != nil {
+		return err
+	}
+	return sanitizeText("endsAt", &req.EndsAt, maxTokenLength)
+}
+
+// Validate normalizes the name, the scopes, and the expiry of the token.
+func (req *PersonalTokenRequest) Validate() error {
+	if err := sanitizeText("name", &req.Name, MaxMessageLength); err != nil {
+		return err
+	}
+	for i := range req.Scopes {
+		if err := sanitizeText(fmt.Sprintf("scopes[%d]", i), &req.Scopes[i], maxTokenLength); err != nil {
+			return err
+		}
+	}
+	return sanitizeText("expiresAt", &req.ExpiresAt, maxTokenLength)
+}
+
+// Validate normalizes the grantee and the expiry time.
+func (req *DelegationRequest) Validate() error {
+	if err := sanitizeUsername("grantee", &req.Grantee); err != nil {
+		return err
+	}
+	return sanitizeText("expiresAt", &req.ExpiresAt, maxTokenLength)
+}
+
+// Validate normalizes the mode.
+func (req *ReverseTransferRequest) Validate() error {
+	return sanitizeText("mode", &req.Mode, maxTokenLength)
+}
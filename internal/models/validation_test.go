@@ -0,0 +1,140 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   Validator
+		field string
+	}{
+		{name: "valid auth", req: &AuthRequest{Username: "alice", Password: "secret"}},
+		{name: "invalid UTF-8 username", req: &AuthRequest{Username: "al\xffice"}, field: "username"},
+		{name: "replacement character username", req: &AuthRequest{Username: "al�ice"}, field: "username"},
+		{name: "long username", req: &AuthRequest{Username: strings.Repeat("a", MaxUsernameLength+1)}, field: "username"},
+		{name: "invalid UTF-8 password", req: &AuthRequest{Username: "alice", Password: "\xc3"}, field: "password"},
+		{name: "long password", req: &AuthRequest{Username: "alice", Password: strings.Repeat("p", MaxPasswordBytes+1)}, field: "password"},
+		{name: "long invite code", req: &AuthRequest{Username: "alice", InviteCode: strings.Repeat("c", 65)}, field: "inviteCode"},
+		{name: "huge recipient", req: &SendCoinRequest{ToUser: strings.Repeat("b", 1<<20), Amount: 10}, field: "toUser"},
+		{name: "scheduled recipient", req: &ScheduleTransferRequest{ToUser: "\xfe"}, field: "toUser"},
+		{name: "gift recipient", req: &GiftRequest{ToUser: strings.Repeat("b", 33)}, field: "toUser"},
+		{name: "bulk username", req: &BulkUsersRequest{Users: []BulkUser{{Username: "ok"}, {Username: "\xff"}}}, field: "users[1].username"},
+		{name: "token scope", req: &PersonalTokenRequest{Name: "bot", Scopes: []string{"info", "\xff"}}, field: "scopes[1]"},
+		{name: "delegation grantee", req: &DelegationRequest{Grantee: "b\xff", Allowance: 100}, field: "grantee"},
+		{name: "long promotion category", req: &PromotionRequest{Category: strings.Repeat("c", MaxCategoryLength+1)}, field: "category"},
+		{name: "long token name", req: &PersonalTokenRequest{Name: strings.Repeat("n", MaxMessageLength+1)}, field: "name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var fieldError *FieldError
+			require.ErrorAs(t, err, &fieldError)
+			assert.Equal(t, tt.field, fieldError.Field)
+		})
+	}
+
+	t.Run("Normalization", func(t *testing.T) {
+		req := AuthRequest{Username: "  José ", Password: " secret "}
+		require.NoError(t, req.Validate())
+		assert.Equal(t, "José", req.Username, "usernames must be trimmed and NFC-normalized")
+		assert.Equal(t, " secret ", req.Password, "passwords must be kept as they are")
+
+		spaced := SendCoinRequest{ToUser: "\tmary \u00a0 ann\n"}
+		require.NoError(t, spaced.Validate())
+		assert.Equal(t, "mary ann", spaced.ToUser, "whitespace inside usernames must be collapsed")
+		assert.Equal(t, "mary ann", NormalizeUsername(" mary\t\tann "))
+
+		blank := AuthRequest{Username: " \t ", Password: "secret"}
+		require.NoError(t, blank.Validate())
+		assert.Empty(t, blank.Username, "a username of whitespace only must become empty")
+
+		promotion := PromotionRequest{Item: " hoody ", Category: " Apparel\n"}
+		require.NoError(t, promotion.Validate())
+		assert.Equal(t, "hoody", promotion.Item)
+		assert.Equal(t, "apparel", promotion.Category, "categories must be lowercased")
+
+		long := SendCoinRequest{ToUser: strings.Repeat("е", MaxUsernameLength)}
+		assert.NoError(t, long.Validate(), "lengths are counted in characters, not bytes")
+	})
+
+	t.Run("Item name", func(t *testing.T) {
+		name, err := SanitizeItemName(" pink-hoody ")
+		require.NoError(t, err)
+		assert.Equal(t, "pink-hoody", name)
+
+		_, err = SanitizeItemName(strings.Repeat("x", MaxItemNameLength+1))
+		assert.ErrorIs(t, err, ErrTooLong)
+
+		_, err = SanitizeItemName("pink\xffhoody")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrTooLong)
+	})
+}
+
+func FuzzAuthRequestValidate(f *testing.F) {
+	f.Add([]byte(`{"username":"alice","password":"secret"}`))
+	f.Add([]byte("{\"username\":\"al\xffice\",\"password\":\"\xc3\"}"))
+	f.Add([]byte(`{"username":"  José  ","password":"p"}`))
+	f.Add([]byte(`{"username":"` + strings.Repeat("a", 100) + `"}`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var req AuthRequest
+		if json.Unmarshal(body, &req) != nil {
+			return
+		}
+		raw := req
+
+		if err := req.Validate(); err != nil {
+			var fieldError *FieldError
+			assert.ErrorAs(t, err, &fieldError)
+			return
+		}
+
+		assert.True(t, utf8.ValidString(req.Username))
+		assert.NotContains(t, req.Username, string(utf8.RuneError))
+		assert.LessOrEqual(t, utf8.RuneCountInString(req.Username), MaxUsernameLength)
+		assert.True(t, norm.NFC.IsNormalString(req.Username))
+		assert.Equal(t, NormalizeUsername(req.Username), req.Username)
+		assert.Equal(t, raw.Password, req.Password)
+		assert.LessOrEqual(t, len(req.Password), MaxPasswordBytes)
+	})
+}
+
+func FuzzSanitizeText(f *testing.F) {
+	f.Add("toUser", "bob")
+	f.Add("toUser", "\xff\xfe")
+	f.Add("toUser", " é́ ")
+	f.Add("toUser", strings.Repeat("ж", 40))
+
+	f.Fuzz(func(t *testing.T, field string, value string) {
+		sanitized := value
+		err := sanitizeText(field, &sanitized, MaxUsernameLength)
+		if !utf8.ValidString(value) {
+			require.Error(t, err, "invalid UTF-8 must be rejected")
+		}
+		if err != nil {
+			assert.Equal(t, value, sanitized, "a rejected value must be left unchanged")
+			return
+		}
+
+		assert.True(t, utf8.ValidString(sanitized))
+		assert.LessOrEqual(t, utf8.RuneCountInString(sanitized), MaxUsernameLength)
+		assert.True(t, norm.NFC.IsNormalString(sanitized))
+		assert.Equal(t, strings.TrimSpace(sanitized), sanitized)
+	})
+}
@@ -0,0 +1,169 @@
+// Package apiversion negotiates the version of the API response shapes from the Accept header.
+// Version 1 is the original flat contract served as application/json and stays the default;
+// later versions are selected with a vendor media type such as application/vnd.merchstore.v2+json.
+// The negotiated version is stored in the request context, so that any code writing a response,
+// including the error helpers of other packages, can shape it accordingly.
+package apiversion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"merch_store/internal/models"
+)
+
+// Version is a version of the API response shapes.
+type Version int
+
+// Supported versions of the API response shapes.
+const (
+	// V1 is the original flat contract.
+	V1 Version = 1
+	// V2 nests error details, describes the issued token in auth responses, and nests the purchase in buy responses.
+	V2 Version = 2
+)
+
+// Latest is the newest supported version.
+const Latest = V2
+
+// vendorPrefix and vendorSuffix surround the version number in vendor media types.
+const (
+	vendorPrefix = "application/vnd.merchstore.v"
+	vendorSuffix = "+json"
+)
+
+// ErrNotAcceptable indicates that the Accept header asks only for versions that are not supported.
+var ErrNotAcceptable = errors.New("apiversion: no supported version is acceptable")
+
+// MediaType returns the media type of responses shaped by the version: application/json for V1
+// and the vendor media type for later versions.
+func (version Version) MediaType() string {
+	if version <= V1 {
+		return "application/json"
+	}
+	return vendorPrefix + strconv.Itoa(int(version)) + vendorSuffix
+}
+
+// SupportedMediaTypes lists the media types of all supported versions, oldest first.
+func SupportedMediaTypes() []string {
+	mediaTypes := make([]string, 0, int(Latest))
+	for version := V1; version <= Latest; version++ {
+		mediaTypes = append(mediaTypes, version.MediaType())
+	}
+	return mediaTypes
+}
+
+// Negotiate selects the version of the response from an Accept header value. The acceptable media range with
+// the highest quality wins, and the first one listed among equals. Vendor media types select their version;
+// any other range, as well as an empty header, selects V1, so clients unaware of versioning keep the original
+// contract. It returns ErrNotAcceptable when the header lists only vendor media types of unsupported versions.
+func Negotiate(accept string) (Version, error) {
+	if strings.TrimSpace(accept) == "" {
+		return V1, nil
+	}
+
+	selected, selectedQuality := Version(0), 0.0
+	unsupported := false
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		version := V1
+		if number, found := strings.CutPrefix(mediaType, vendorPrefix); found {
+			parsed, err := strconv.Atoi(strings.TrimSuffix(number, vendorSuffix))
+			if err != nil || !strings.HasSuffix(number, vendorSuffix) || Version(parsed) < V1 || Version(parsed) > Latest {
+				unsupported = true
+				continue
+			}
+			version = Version(parsed)
+		}
+
+		if quality > selectedQuality {
+			selected, selectedQuality = version, quality
+		}
+	}
+
+	if selected == 0 {
+		if unsupported {
+			return 0, ErrNotAcceptable
+		}
+		return V1, nil
+	}
+	return selected, nil
+}
+
+// versionContextKey is the context key under which WithVersion stores the negotiated version.
+type versionContextKey struct{}
+
+// WithVersion returns a context carrying the negotiated version.
+func WithVersion(ctx context.Context, version Version) context.Context {
+	return context.WithValue(ctx, versionContextKey{}, version)
+}
+
+// FromContext returns the version stored by WithVersion, or V1 when none was negotiated.
+func FromContext(ctx context.Context) Version {
+	if version, ok := ctx.Value(versionContextKey{}).(Version); ok {
+		return version
+	}
+	return V1
+}
+
+// Middleware negotiates the version of every request from its Accept header and stores it in the request context.
+// Requests asking only for unsupported versions get 406 Not Acceptable listing the supported media types.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		version, err := Negotiate(r.Header.Get("Accept"))
+		if err != nil {
+			supported := SupportedMediaTypes()
+			w.Header().Set("Content-Type", V1.MediaType())
+			w.WriteHeader(http.StatusNotAcceptable)
+			json.NewEncoder(w).Encode(models.ErrorResponse{
+				Errors:    fmt.Sprintf("unsupported API version, supported media types: %s", strings.Join(supported, ", ")),
+				Code:      models.ErrCodeVersionNotAcceptable,
+				Supported: supported,
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithVersion(r.Context(), version)))
+	})
+}
+
+// WriteError writes an error response shaped by the version negotiated for ctx. V1 responses are a flat
+// models.ErrorResponse whose code is omitted when empty; later versions nest the message and the code in
+// models.ErrorResponseV2, falling back to a code derived from the status, such as NOT_FOUND, when none is given.
+func WriteError(w http.ResponseWriter, ctx context.Context, message string, code string, statusCode int) {
+	version := FromContext(ctx)
+	w.Header().Set("Content-Type", version.MediaType())
+	w.WriteHeader(statusCode)
+
+	if version == V1 {
+		json.NewEncoder(w).Encode(models.ErrorResponse{Errors: message, Code: code})
+		return
+	}
+
+	if code == "" {
+		code = strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(http.StatusText(statusCode)))
+	}
+	json.NewEncoder(w).Encode(models.ErrorResponseV2{Error: models.ErrorDetail{Code: code, Message: message}})
+}
@@ -0,0 +1,84 @@
+package apiversion
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept  string
+		version Version
+		err     error
+	}{
+		{accept: "", version: V1},
+		{accept: "application/json", version: V1},
+		{accept: "*/*", version: V1},
+		{accept: "text/html", version: V1},
+		{accept: "application/vnd.merchstore.v1+json", version: V1},
+		{accept: "application/vnd.merchstore.v2+json", version: V2},
+		{accept: "Application/VND.merchstore.v2+JSON; charset=utf-8", version: V2},
+		{accept: "application/vnd.merchstore.v2+json, application/json", version: V2},
+		{accept: "application/json, application/vnd.merchstore.v2+json", version: V1},
+		{accept: "application/json;q=0.5, application/vnd.merchstore.v2+json", version: V2},
+		{accept: "application/vnd.merchstore.v2+json;q=0, application/json", version: V1},
+		{accept: "application/vnd.merchstore.v3+json, application/json;q=0.1", version: V1},
+		{accept: "application/vnd.merchstore.v3+json", err: ErrNotAcceptable},
+		{accept: "application/vnd.merchstore.v0+json", err: ErrNotAcceptable},
+		{accept: "application/vnd.merchstore.vx+json", err: ErrNotAcceptable},
+		{accept: "application/vnd.merchstore.v2", err: ErrNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			version, err := Negotiate(tt.accept)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var negotiated Version
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		negotiated = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", V2.MediaType())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, V2, negotiated)
+	assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+
+	req.Header.Set("Accept", "application/vnd.merchstore.v9+json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.JSONEq(t, `{"errors":"unsupported API version, supported media types: application/json, application/vnd.merchstore.v2+json",
+		"code":"VERSION_NOT_ACCEPTABLE","supported":["application/json","application/vnd.merchstore.v2+json"]}`, rec.Body.String())
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, context.Background(), "item not found", "", http.StatusBadRequest)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"errors\":\"item not found\"}\n", rec.Body.String())
+
+	ctx := WithVersion(context.Background(), V2)
+	rec = httptest.NewRecorder()
+	WriteError(rec, ctx, "item not found", "", http.StatusBadRequest)
+	assert.Equal(t, "application/vnd.merchstore.v2+json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"error\":{\"code\":\"BAD_REQUEST\",\"message\":\"item not found\"}}\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	WriteError(rec, ctx, "invalid token", "TOKEN_INVALID", http.StatusUnauthorized)
+	assert.Equal(t, "{\"error\":{\"code\":\"TOKEN_INVALID\",\"message\":\"invalid token\"}}\n", rec.Body.String())
+}
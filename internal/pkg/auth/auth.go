@@ -4,54 +4,142 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"merch_store/internal/models"
+	"merch_store/internal/pkg/apiversion"
+	"merch_store/internal/pkg/metrics"
 	"net/http"
 	"strings"
+	"unicode"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
-// contextKey is a custom type used for storing values in a context without risking collisions.
-type contextKey string
+// AccessTokenParam is the query parameter carrying the token of requests to QueryTokenPath.
+const AccessTokenParam = "access_token"
 
-// ContextUserID is the key used to store and retrieve the user ID from the request context.
-const ContextUserID contextKey = "сontextUserID"
+// QueryTokenPath is the only path whose GET requests may carry the token in AccessTokenParam instead of the
+// Authorization header: the server-sent events stream, which browsers open with EventSource, unable to set headers.
+const QueryTokenPath = "/api/events"
 
 // CheckJWTMiddleware is an HTTP middleware function that validates the Authorization header of incoming requests.
-// It checks for the presence of a Bearer token, parses the token to extract the user ID, and stores it in the request context.
-// If validation fails at any point, it returns an error response with the appropriate HTTP status code.
+// It checks for the presence of a Bearer token, parses the token, and stores its claims in the request context
+// (see ClaimsFromContext and UserIDFromContext). Requests without the header may pass the token in AccessTokenParam
+// on QueryTokenPath only (see queryToken).
+// It is the single source of 401 responses for protected routes: handlers behind it rely on the user ID being present.
+// Rejected tokens are counted in the authentication metrics as expired or invalid.
 func CheckJWTMiddleware() func(h http.Handler) http.Handler {
+	return defaultTokenManager.Middleware()
+}
+
+// CheckTokenMiddleware behaves like CheckJWTMiddleware and additionally accepts personal access tokens,
+// resolved by resolver (see TokenManager.MiddlewareWithPersonalTokens).
+func CheckTokenMiddleware(resolver PersonalTokenResolver) func(h http.Handler) http.Handler {
+	return defaultTokenManager.MiddlewareWithPersonalTokens(resolver)
+}
+
+// Middleware returns the CheckJWTMiddleware behavior with tokens validated by the manager.
+func (manager *TokenManager) Middleware() func(h http.Handler) http.Handler {
+	return manager.MiddlewareWithPersonalTokens(nil)
+}
+
+// MiddlewareWithPersonalTokens returns the CheckJWTMiddleware behavior with JWTs validated by the manager and
+// Bearer credentials starting with PersonalTokenPrefix resolved by resolver. For a personal access token the
+// request context holds the owner's user ID and the token scopes (see RequestScopes), but no claims.
+// A nil resolver rejects personal access tokens as invalid.
+func (manager *TokenManager) MiddlewareWithPersonalTokens(resolver PersonalTokenResolver) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
+			authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
 
+			var token string
+			var ok bool
 			if authHeader == "" {
-				writeErrorResponse(w, "missing auth header", http.StatusUnauthorized)
+				if token, ok = queryToken(r); !ok {
+					writeErrorResponse(w, r, "missing auth header", models.ErrCodeAuthHeaderMissing, http.StatusUnauthorized)
+					return
+				}
+			} else if token, ok = parseBearerToken(authHeader); !ok {
+				metrics.AuthOutcomes.Inc(metrics.AuthOutcomeTokenInvalid)
+				writeErrorResponse(w, r, "invalid auth header", models.ErrCodeAuthHeaderInvalid, http.StatusUnauthorized)
 				return
 			}
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				writeErrorResponse(w, "invalid auth header", http.StatusUnauthorized)
+
+			if strings.HasPrefix(token, PersonalTokenPrefix) && resolver != nil {
+				userID, scopes, err := resolver.ResolvePersonalToken(r.Context(), token)
+				if errors.Is(err, ErrPersonalTokenInvalid) {
+					metrics.AuthOutcomes.Inc(metrics.AuthOutcomeTokenInvalid)
+					writeErrorResponse(w, r, "invalid token", models.ErrCodeTokenInvalid, http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					writeErrorResponse(w, r, err.Error(), "", http.StatusInternalServerError)
+					return
+				}
+
+				h.ServeHTTP(w, r.WithContext(withTokenScopes(WithUserID(r.Context(), userID), scopes)))
 				return
 			}
 
-			claims, err := ParseToken(parts[1])
+			claims, err := manager.ParseToken(token)
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				metrics.AuthOutcomes.Inc(metrics.AuthOutcomeTokenExpired)
+			} else if err != nil {
+				metrics.AuthOutcomes.Inc(metrics.AuthOutcomeTokenInvalid)
+			}
+			if errors.Is(err, ErrTokenNotForService) {
+				writeErrorResponse(w, r, "token not valid for this service", models.ErrCodeTokenInvalid, http.StatusUnauthorized)
+				return
+			}
 			if err != nil {
-				writeErrorResponse(w, "invalid token", http.StatusUnauthorized)
+				writeErrorResponse(w, r, "invalid token", models.ErrCodeTokenInvalid, http.StatusUnauthorized)
 				return
 			}
 
-			// Store the user ID from the token claims into the request context.
-			ctx := context.WithValue(r.Context(), ContextUserID, claims.UserID)
-			h.ServeHTTP(w, r.WithContext(ctx))
+			h.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
-// writeErrorResponse writes a JSON-formatted error response to the HTTP response writer.
-// It sets the Content-Type header, writes the appropriate HTTP status code, and encodes an ErrorResponse payload.
-func writeErrorResponse(res http.ResponseWriter, errorInfo string, statusCode int) {
-	res.Header().Set("Content-Type", "application/json")
-	res.WriteHeader(statusCode)
-	json.NewEncoder(res).Encode(models.ErrorResponse{Errors: errorInfo})
+// RequestImpersonator returns the administrator impersonating the user of the request. It reports false for
+// requests not authenticated with an impersonation token.
+func RequestImpersonator(ctx context.Context) (int32, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.Impersonator == 0 {
+		return 0, false
+	}
+	return claims.Impersonator, true
+}
+
+// parseBearerToken extracts the credentials from a Bearer Authorization header value.
+// The scheme is matched case-insensitively (RFC 7235) and any amount of whitespace
+// between the scheme and the credentials is tolerated. Empty credentials are rejected.
+// The header value is expected to be trimmed already. Unlike splitting it into fields, this does not allocate.
+func parseBearerToken(authHeader string) (string, bool) {
+	index := strings.IndexFunc(authHeader, unicode.IsSpace)
+	if index < 0 || !strings.EqualFold(authHeader[:index], "Bearer") {
+		return "", false
+	}
+	token := strings.TrimLeftFunc(authHeader[index:], unicode.IsSpace)
+	if token == "" || strings.IndexFunc(token, unicode.IsSpace) >= 0 {
+		return "", false
+	}
+	return token, true
+}
+
+// queryToken returns the token passed in AccessTokenParam by a GET request to QueryTokenPath. It reports false for
+// every other request, so that the parameter is ignored on the other routes, and for an empty parameter.
+func queryToken(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet || r.URL.Path != QueryTokenPath {
+		return "", false
+	}
+	token := r.URL.Query().Get(AccessTokenParam)
+	return token, token != ""
+}
+
+// writeErrorResponse writes a JSON-formatted error response to the HTTP response writer,
+// shaped by the API version negotiated for the request (see apiversion.WriteError).
+func writeErrorResponse(res http.ResponseWriter, req *http.Request, errorInfo string, code string, statusCode int) {
+	apiversion.WriteError(res, req.Context(), errorInfo, code, statusCode)
 }
@@ -0,0 +1,466 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/pkg/clock"
+)
+
+func TestCheckJWTMiddleware_HeaderVariants(t *testing.T) {
+	token, err := GenerateToken(42)
+	require.NoError(t, err)
+
+	handler := CheckJWTMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		w.Write([]byte(strconv.Itoa(int(userID))))
+	}))
+
+	testCases := []struct {
+		name               string
+		header             string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{name: "Canonical scheme", header: "Bearer " + token, expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Lowercase scheme", header: "bearer " + token, expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Uppercase scheme", header: "BEARER " + token, expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Surrounding whitespace", header: "  Bearer " + token + "  ", expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Multiple spaces", header: "Bearer    " + token, expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Tab separator", header: "Bearer\t" + token, expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Missing header", header: "", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n"},
+		{name: "Whitespace-only header", header: "   ", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n"},
+		{name: "Scheme without credentials", header: "Bearer", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid auth header\",\"code\":\"AUTH_HEADER_INVALID\"}\n"},
+		{name: "Scheme with blank credentials", header: "Bearer    ", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid auth header\",\"code\":\"AUTH_HEADER_INVALID\"}\n"},
+		{name: "Wrong scheme", header: "Basic " + token, expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid auth header\",\"code\":\"AUTH_HEADER_INVALID\"}\n"},
+		{name: "Extra credentials part", header: "Bearer " + token + " extra", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid auth header\",\"code\":\"AUTH_HEADER_INVALID\"}\n"},
+		{name: "Invalid token", header: "Bearer not-a-token", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid token\",\"code\":\"TOKEN_INVALID\"}\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			resp := rec.Result()
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, tc.expectedBody, string(body))
+		})
+	}
+}
+
+func TestCheckJWTMiddleware_QueryToken(t *testing.T) {
+	token, err := GenerateToken(42)
+	require.NoError(t, err)
+
+	handler := CheckJWTMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		w.Write([]byte(strconv.Itoa(int(userID))))
+	}))
+
+	missing := "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n"
+	testCases := []struct {
+		name               string
+		method             string
+		target             string
+		header             string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{name: "Events stream", method: http.MethodGet, target: "/api/events?access_token=" + token, expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Events stream with other parameters", method: http.MethodGet, target: "/api/events?types=coins_received&access_token=" + token, expectedStatusCode: http.StatusOK, expectedBody: "42"},
+		{name: "Invalid query token", method: http.MethodGet, target: "/api/events?access_token=not-a-token", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid token\",\"code\":\"TOKEN_INVALID\"}\n"},
+		{name: "Empty query token", method: http.MethodGet, target: "/api/events?access_token=", expectedStatusCode: http.StatusUnauthorized, expectedBody: missing},
+		{name: "Header takes precedence", method: http.MethodGet, target: "/api/events?access_token=" + token, header: "Basic " + token, expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid auth header\",\"code\":\"AUTH_HEADER_INVALID\"}\n"},
+		{name: "Other route", method: http.MethodGet, target: "/api/info?access_token=" + token, expectedStatusCode: http.StatusUnauthorized, expectedBody: missing},
+		{name: "Other route under the events path", method: http.MethodGet, target: "/api/events/other?access_token=" + token, expectedStatusCode: http.StatusUnauthorized, expectedBody: missing},
+		{name: "Other method", method: http.MethodPost, target: "/api/events?access_token=" + token, expectedStatusCode: http.StatusUnauthorized, expectedBody: missing},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.Equal(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestTokenManager_Expiry(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewTokenManager([]byte("test-secret"), time.Hour, fakeClock)
+
+	token, err := manager.GenerateToken(7)
+	require.NoError(t, err)
+
+	claims, err := manager.ParseToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), claims.UserID)
+
+	fakeClock.Advance(time.Hour - time.Second)
+	_, err = manager.ParseToken(token)
+	require.NoError(t, err, "token must be valid until its expiry")
+
+	fakeClock.Advance(2 * time.Second)
+	_, err = manager.ParseToken(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	handler := manager.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "{\"errors\":\"invalid token\",\"code\":\"TOKEN_INVALID\"}\n", rec.Body.String())
+}
+
+func TestTokenManager_RejectsOtherSecret(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	token, err := NewTokenManager([]byte("other-secret"), time.Hour, fakeClock).GenerateToken(7)
+	require.NoError(t, err)
+
+	_, err = NewTokenManager([]byte("test-secret"), time.Hour, fakeClock).ParseToken(token)
+	assert.Error(t, err)
+}
+
+func TestTokenManager_IssueToken(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	manager := NewTokenManager([]byte("test-secret"), time.Hour, clock.NewFake(now))
+
+	first, err := manager.IssueToken(7)
+	require.NoError(t, err)
+	second, err := manager.IssueToken(7)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, first.ID)
+	assert.NotEqual(t, first.ID, second.ID, "every token must get its own ID")
+	assert.Equal(t, now, first.IssuedAt)
+	assert.Equal(t, now.Add(time.Hour), first.ExpiresAt)
+
+	claims, err := manager.ParseToken(first.Token)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, claims.ID)
+
+	handler := manager.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		w.Write([]byte(claims.ID))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+first.Token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, first.ID, rec.Body.String())
+}
+
+func TestTokenManager_IssueVersionedToken(t *testing.T) {
+	manager := NewTokenManager([]byte("test-secret"), time.Hour, clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	issued, err := manager.IssueVersionedToken(7, 3)
+	require.NoError(t, err)
+	claims, err := manager.ParseToken(issued.Token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), claims.UserID)
+	assert.Equal(t, int32(3), claims.TokenVersion)
+
+	issued, err = manager.IssueToken(7)
+	require.NoError(t, err)
+	claims, err = manager.ParseToken(issued.Token)
+	require.NoError(t, err)
+	assert.Zero(t, claims.TokenVersion, "tokens issued without a version carry version zero")
+}
+
+func TestTokenManager_IssueImpersonationToken(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewTokenManager([]byte("test-secret"), time.Hour, fakeClock)
+
+	issued, err := manager.IssueImpersonationToken(7, 1, "admin-session")
+	require.NoError(t, err)
+	assert.Equal(t, "admin-session", issued.ID, "the token must belong to the administrator's session")
+	assert.Equal(t, fakeClock.Now().Add(ImpersonationTTL), issued.ExpiresAt)
+
+	claims, err := manager.ParseToken(issued.Token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), claims.UserID)
+	assert.Equal(t, int32(1), claims.Impersonator)
+
+	handler := manager.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		impersonator, ok := RequestImpersonator(r.Context())
+		fmt.Fprintf(w, "%d %d %t", userID, impersonator, ok)
+	}))
+	serve := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	assert.Equal(t, "7 1 true", serve(issued.Token))
+
+	own, err := manager.GenerateToken(7)
+	require.NoError(t, err)
+	assert.Equal(t, "7 0 false", serve(own), "tokens issued to the user must not carry an impersonator")
+
+	fakeClock.Advance(ImpersonationTTL)
+	_, err = manager.ParseToken(issued.Token)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func TestTokenManager_IssuerAndAudience(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	newManager := func(issuer, audience string) *TokenManager {
+		manager := NewTokenManager([]byte("test-secret"), time.Hour, fakeClock)
+		manager.SetIssuerAndAudience(issuer, audience)
+		return manager
+	}
+	production := newManager("merch_store", "production")
+
+	token, err := production.GenerateToken(7)
+	require.NoError(t, err)
+	claims, err := production.ParseToken(token)
+	require.NoError(t, err, "a token must be accepted by the deployment that issued it")
+	assert.Equal(t, "merch_store", claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{"production"}, claims.Audience)
+
+	testCases := []struct {
+		name     string
+		issuedBy *TokenManager
+		err      error
+	}{
+		{name: "Matching claims", issuedBy: newManager("merch_store", "production")},
+		{name: "Other audience", issuedBy: newManager("merch_store", "staging"), err: ErrTokenNotForService},
+		{name: "Other issuer", issuedBy: newManager("other_store", "production"), err: ErrTokenNotForService},
+		{name: "Absent claims", issuedBy: newManager("", ""), err: ErrTokenNotForService},
+		{name: "Absent audience", issuedBy: newManager("merch_store", ""), err: ErrTokenNotForService},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := tc.issuedBy.GenerateToken(7)
+			require.NoError(t, err)
+
+			_, err = production.ParseToken(token)
+			if tc.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+
+	t.Run("Unconfigured manager accepts any claims", func(t *testing.T) {
+		_, err := newManager("", "").ParseToken(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Middleware", func(t *testing.T) {
+		staging, err := newManager("merch_store", "staging").GenerateToken(7)
+		require.NoError(t, err)
+
+		handler := production.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+staging)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "{\"errors\":\"token not valid for this service\",\"code\":\"TOKEN_INVALID\"}\n", rec.Body.String())
+	})
+}
+
+// fakeResolver resolves the personal access tokens in tokens, failing with err when it is set.
+type fakeResolver struct {
+	tokens map[string][]string
+	err    error
+}
+
+func (resolver fakeResolver) ResolvePersonalToken(ctx context.Context, token string) (int32, []string, error) {
+	if resolver.err != nil {
+		return 0, nil, resolver.err
+	}
+	scopes, ok := resolver.tokens[token]
+	if !ok {
+		return 0, nil, ErrPersonalTokenInvalid
+	}
+	return 7, scopes, nil
+}
+
+func TestMiddlewareWithPersonalTokens(t *testing.T) {
+	manager := NewTokenManager([]byte("test-secret"), time.Hour, clock.NewFake(time.Now()))
+	jwtToken, err := manager.GenerateToken(42)
+	require.NoError(t, err)
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		scopes, personal := RequestScopes(r.Context())
+		fmt.Fprintf(w, "%d %t %v %t", userID, personal, scopes, HasScope(r.Context(), ScopeInfo))
+	})
+	resolver := fakeResolver{tokens: map[string][]string{"pat_valid": {ScopeSendCoin}}}
+
+	testCases := []struct {
+		name               string
+		resolver           PersonalTokenResolver
+		token              string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{name: "Personal token", resolver: resolver, token: "pat_valid", expectedStatusCode: http.StatusOK, expectedBody: "7 true [sendCoin] false"},
+		{name: "Session token", resolver: resolver, token: jwtToken, expectedStatusCode: http.StatusOK, expectedBody: "42 false [] true"},
+		{name: "Unknown personal token", resolver: resolver, token: "pat_revoked", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid token\",\"code\":\"TOKEN_INVALID\"}\n"},
+		{name: "Resolver failure", resolver: fakeResolver{err: errors.New("db down")}, token: "pat_valid", expectedStatusCode: http.StatusInternalServerError, expectedBody: "{\"errors\":\"db down\"}\n"},
+		{name: "Personal tokens disabled", resolver: nil, token: "pat_valid", expectedStatusCode: http.StatusUnauthorized, expectedBody: "{\"errors\":\"invalid token\",\"code\":\"TOKEN_INVALID\"}\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rec := httptest.NewRecorder()
+
+			manager.MiddlewareWithPersonalTokens(tc.resolver)(echo).ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.Equal(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestGeneratePersonalToken(t *testing.T) {
+	first, err := GeneratePersonalToken()
+	require.NoError(t, err)
+	second, err := GeneratePersonalToken()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(first.Token, PersonalTokenPrefix))
+	assert.Len(t, first.Token, len(PersonalTokenPrefix)+43, "32 random bytes must be encoded without padding")
+	assert.True(t, strings.HasPrefix(first.Token, first.Prefix))
+	assert.Len(t, first.Prefix, 12)
+	assert.Equal(t, HashPersonalToken(first.Token), first.Hash)
+	assert.NotContains(t, first.Hash, first.Token)
+	assert.NotEqual(t, first.Token, second.Token)
+	assert.NotEqual(t, first.Hash, second.Hash)
+}
+
+func TestTokenManager_RejectsOtherSigningMethods(t *testing.T) {
+	manager := NewTokenManager([]byte("test-secret"), time.Hour, clock.NewFake(time.Now()))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS384, Claims{UserID: 7}).SignedString([]byte("test-secret"))
+	require.NoError(t, err)
+
+	_, err = manager.ParseToken(token)
+	assert.Error(t, err, "only HS256 tokens must be accepted, even when signed with the secret")
+}
+
+func TestTokenManager_VerifiedTokenCache(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewTokenManager([]byte("test-secret"), time.Hour, fakeClock)
+	manager.SetVerifiedTokenCacheSize(2)
+
+	issued, err := manager.IssueToken(7)
+	require.NoError(t, err)
+
+	claims, err := manager.ParseToken(issued.Token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, manager.verified.len(), "a verified token must be cached")
+	claims.UserID = 8
+	cached, err := manager.ParseToken(issued.Token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), cached.UserID, "callers must not be able to change cached claims")
+	assert.Equal(t, issued.ID, cached.ID)
+
+	t.Run("Forged claims", func(t *testing.T) {
+		forged, err := NewTokenManager([]byte("test-secret"), time.Hour, fakeClock).GenerateToken(8)
+		require.NoError(t, err)
+		header, _, _ := strings.Cut(forged, ".")
+		_, payload, _ := strings.Cut(forged[len(header)+1:], ".")
+		_, err = manager.ParseToken(header + "." + payload + "." + tokenSignature(issued.Token))
+		assert.Error(t, err, "a cached signature must not vouch for other claims")
+	})
+
+	t.Run("Bounded size", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			token, err := manager.GenerateToken(int32(i))
+			require.NoError(t, err)
+			_, err = manager.ParseToken(token)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, manager.verified.len())
+		_, ok := manager.verified.get(issued.Token)
+		assert.False(t, ok, "the least recently used token must be evicted")
+	})
+
+	t.Run("Revocation", func(t *testing.T) {
+		_, err := manager.ParseToken(issued.Token)
+		require.NoError(t, err)
+		manager.ForgetToken(issued.ID)
+		_, ok := manager.verified.get(issued.Token)
+		assert.False(t, ok, "a forgotten token must be verified again")
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		_, err := manager.ParseToken(issued.Token)
+		require.NoError(t, err)
+
+		fakeClock.Advance(time.Hour + time.Second)
+		_, err = manager.ParseToken(issued.Token)
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired, "a cached token must still expire")
+		_, ok := manager.verified.get(issued.Token)
+		assert.False(t, ok, "an expired token must be dropped from the cache")
+
+		handler := manager.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+issued.Token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func BenchmarkCheckJWTMiddleware(b *testing.B) {
+	for _, size := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			manager := NewTokenManager([]byte("test-secret"), time.Hour, clock.Real{})
+			manager.SetVerifiedTokenCacheSize(size)
+			token, err := manager.GenerateToken(7)
+			require.NoError(b, err)
+
+			handler := manager.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handler.ServeHTTP(rec, req)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import "context"
+
+// Context keys under which the middleware stores the authentication of a request. The values are set and read only
+// through the typed accessors of this file.
+type (
+	userIDContextKey      struct{} // The authenticated user's ID, an int32.
+	claimsContextKey      struct{} // The claims of the request's JWT, a *Claims.
+	tokenScopesContextKey struct{} // The scopes of the request's personal access token, a []string.
+)
+
+// WithUserID returns a copy of ctx holding userID as the authenticated user's ID.
+func WithUserID(ctx context.Context, userID int32) context.Context {
+	return context.WithValue(ctx, userIDContextKey{}, userID)
+}
+
+// UserIDFromContext returns the authenticated user's ID stored in ctx by the middleware, or by WithUserID or
+// WithClaims. It reports false when ctx holds none.
+func UserIDFromContext(ctx context.Context) (int32, bool) {
+	userID, ok := ctx.Value(userIDContextKey{}).(int32)
+	return userID, ok
+}
+
+// WithClaims returns a copy of ctx holding the claims of the request's JWT, and the user ID of the claims as the
+// authenticated user's ID.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = WithUserID(ctx, claims.UserID)
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the JWT the request was authenticated with. It reports false when ctx
+// holds none, as for requests authenticated with a personal access token.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// withTokenScopes returns a copy of ctx holding the scopes of the request's personal access token.
+func withTokenScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, tokenScopesContextKey{}, scopes)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextAccessors(t *testing.T) {
+	t.Run("Missing", func(t *testing.T) {
+		ctx := context.Background()
+
+		userID, ok := UserIDFromContext(ctx)
+		assert.False(t, ok)
+		assert.Zero(t, userID)
+		claims, ok := ClaimsFromContext(ctx)
+		assert.False(t, ok)
+		assert.Nil(t, claims)
+		_, ok = RequestImpersonator(ctx)
+		assert.False(t, ok)
+		_, ok = RequestScopes(ctx)
+		assert.False(t, ok)
+	})
+
+	t.Run("User ID", func(t *testing.T) {
+		ctx := WithUserID(context.Background(), 42)
+
+		userID, ok := UserIDFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, int32(42), userID)
+		_, ok = ClaimsFromContext(ctx)
+		assert.False(t, ok, "a bare user ID carries no claims")
+	})
+
+	t.Run("Claims", func(t *testing.T) {
+		claims := &Claims{UserID: 7, Impersonator: 1, RegisteredClaims: jwt.RegisteredClaims{ID: "session"}}
+		ctx := WithClaims(context.Background(), claims)
+
+		userID, ok := UserIDFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, int32(7), userID, "the claims must set the user ID")
+		stored, ok := ClaimsFromContext(ctx)
+		require.True(t, ok)
+		assert.Same(t, claims, stored)
+		impersonator, ok := RequestImpersonator(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, int32(1), impersonator)
+
+		_, ok = RequestImpersonator(WithClaims(context.Background(), &Claims{UserID: 7}))
+		assert.False(t, ok, "only impersonation tokens have an impersonator")
+	})
+
+	t.Run("Unrelated values", func(t *testing.T) {
+		type otherKey string
+		ctx := context.WithValue(context.Background(), otherKey("contextUserID"), int32(42))
+
+		_, ok := UserIDFromContext(ctx)
+		assert.False(t, ok, "values stored under other keys must not be mistaken for the user ID")
+	})
+}
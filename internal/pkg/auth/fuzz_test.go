@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/clock"
+)
+
+// FuzzAuthHeaderParse checks parseBearerToken against splitting the header into fields, and that the middleware
+// answers any Authorization header either by passing the request on or with a typed 401 error.
+// It runs its seed corpus with the rest of the tests; run it with -fuzz, as in make test.fuzz, to explore further.
+func FuzzAuthHeaderParse(f *testing.F) {
+	manager := NewTokenManager([]byte("fuzz-secret"), time.Hour, clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)))
+	token, err := manager.GenerateToken(42)
+	require.NoError(f, err)
+
+	for _, header := range []string{
+		"Bearer " + token,
+		"bearer " + token,
+		"BEARER " + token,
+		"  Bearer " + token + "  ",
+		"Bearer    " + token,
+		"Bearer\t" + token,
+		"",
+		"   ",
+		"Bearer",
+		"Bearer    ",
+		"Basic " + token,
+		"Bearer " + token + " extra",
+		"Bearer not-a-token",
+		"Bearer " + token[:len(token)/2],
+		"Bearer " + token,
+		"Bearer \x00",
+		"Bearer \xff\xfe",
+		"Беарер " + token,
+		"Bearer a.b.c",
+		"Bearer ..",
+	} {
+		f.Add(header)
+	}
+
+	handler := manager.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	f.Fuzz(func(t *testing.T, header string) {
+		trimmed := strings.TrimSpace(header)
+		parsed, ok := parseBearerToken(trimmed)
+		fields := strings.Fields(trimmed)
+		wantOK := len(fields) == 2 && strings.EqualFold(fields[0], "Bearer")
+		require.Equal(t, wantOK, ok, "header %q", header)
+		if ok {
+			assert.Equal(t, fields[1], parsed)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+		req.Header["Authorization"] = []string{header}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code == http.StatusNoContent {
+			assert.True(t, ok, "only a well-formed header may be accepted")
+			return
+		}
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		var response struct {
+			Errors string `json:"errors"`
+			Code   string `json:"code"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response), "the error must be JSON: %q", rec.Body.String())
+		assert.NotEmpty(t, response.Errors)
+		assert.Contains(t, []string{models.ErrCodeAuthHeaderMissing, models.ErrCodeAuthHeaderInvalid, models.ErrCodeTokenInvalid}, response.Code)
+	})
+}
@@ -3,9 +3,14 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+
+	"merch_store/internal/pkg/clock"
 )
 
 // secretKey is the key used to sign the JWT. It should be kept secure.
@@ -17,41 +22,262 @@ const TOKENEXP = time.Hour * 3
 // SECRETKEY is a string constant representation of the secret key.
 const SECRETKEY = "supersecretkey"
 
+// ImpersonationTTL is how long an impersonation token (see IssueImpersonationToken) is valid.
+const ImpersonationTTL = 10 * time.Minute
+
 // Claims represents the custom JWT claims that include the user ID and standard claims.
 // It embeds jwt.RegisteredClaims for standard fields like expiration time.
+// Impersonator is set in impersonation tokens only, to the administrator acting as the user.
+// TokenVersion is the token version of the user when the token was issued (see IssueVersionedToken); tokens
+// issued before the version was bumped, by a password change or a forced logout, are stale.
 type Claims struct {
-	UserID int32
+	UserID       int32
+	Impersonator int32 `json:",omitempty"`
+	TokenVersion int32 `json:",omitempty"`
 	jwt.RegisteredClaims
 }
 
+// ErrTokenNotForService indicates that a token was issued by another deployment: its iss or aud claim does not
+// match the issuer or the audience the manager is configured with.
+var ErrTokenNotForService = errors.New("auth: token not valid for this service")
+
+// TokenManager issues and validates tokens using its own clock,
+// so that expiry can be tested without waiting for real time to pass.
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+	clock  clock.Clock
+	// issuer and audience are set as the iss and aud claims of issued tokens and required of parsed ones.
+	// Empty values are neither set nor checked.
+	issuer   string
+	audience string
+	// parser is shared by every ParseToken call and only accepts tokens signed with HS256.
+	parser *jwt.Parser
+	// verified caches the claims of recently verified tokens; nil disables the cache.
+	verified *verifiedTokenCache
+}
+
+// NewTokenManager creates a TokenManager signing tokens with secret and issuing them for ttl.
+func NewTokenManager(secret []byte, ttl time.Duration, c clock.Clock) *TokenManager {
+	return &TokenManager{
+		secret: secret,
+		ttl:    ttl,
+		clock:  c,
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation()),
+	}
+}
+
+// SetIssuerAndAudience makes the manager set the iss and aud claims of the tokens it issues to issuer and
+// audience and reject tokens whose claims do not match with ErrTokenNotForService. An empty issuer or audience
+// leaves that claim unset and unchecked, so that tokens of deployments sharing the secret stay interchangeable.
+func (manager *TokenManager) SetIssuerAndAudience(issuer, audience string) {
+	manager.issuer = issuer
+	manager.audience = audience
+}
+
+// SetVerifiedTokenCacheSize makes the manager remember the claims of up to size recently verified tokens, so
+// that ParseToken skips signature verification for a token it has already verified. Expiry, not-before, issuer,
+// and audience are still checked on every call. A size of zero or less disables the cache. It must be called
+// before the tokens are used.
+func (manager *TokenManager) SetVerifiedTokenCacheSize(size int) {
+	if size <= 0 {
+		manager.verified = nil
+		return
+	}
+	manager.verified = newVerifiedTokenCache(size)
+}
+
+// ForgetToken drops the tokens with the token ID (jti) tokenID from the verified token cache, so that the next
+// request with one of them has its signature verified again. Revocation itself is enforced by the session
+// checks behind the middleware; forgetting the token keeps a revoked session from being served from the cache.
+func (manager *TokenManager) ForgetToken(tokenID string) {
+	if manager.verified != nil {
+		manager.verified.forget(tokenID)
+	}
+}
+
+// IssuedToken is a signed token together with the claims identifying the session it starts.
+type IssuedToken struct {
+	Token     string
+	ID        string // Unique token ID (the jti claim).
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// tokenIDBytes is the number of random bytes in a token ID.
+const tokenIDBytes = 16
+
+// defaultTokenManager backs the package-level GenerateToken, ParseToken, and CheckJWTMiddleware.
+var defaultTokenManager = NewTokenManager(secretKey, TOKENEXP, clock.Real{})
+
 // GenerateToken creates a new JWT token for a given userID.
 // It sets the expiration time based on TOKENEXP and includes the userID in the claims.
 func GenerateToken(userID int32) (string, error) {
-	claims := Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TOKENEXP)),
-		},
-		UserID: userID,
+	return defaultTokenManager.GenerateToken(userID)
+}
+
+// IssueToken creates a new JWT token for a given userID and returns it with its ID and validity period.
+func IssueToken(userID int32) (*IssuedToken, error) {
+	return defaultTokenManager.IssueToken(userID)
+}
+
+// IssueVersionedToken creates a new JWT token for a given userID carrying the user's token version
+// (see TokenManager.IssueVersionedToken).
+func IssueVersionedToken(userID int32, tokenVersion int32) (*IssuedToken, error) {
+	return defaultTokenManager.IssueVersionedToken(userID, tokenVersion)
+}
+
+// IssueImpersonationToken creates an impersonation token letting the administrator impersonator act as userID
+// (see TokenManager.IssueImpersonationToken).
+func IssueImpersonationToken(userID int32, impersonator int32, sessionID string) (*IssuedToken, error) {
+	return defaultTokenManager.IssueImpersonationToken(userID, impersonator, sessionID)
+}
+
+// SetSecret replaces the secret signing and verifying the tokens of GenerateToken, IssueToken, ParseToken, and
+// CheckJWTMiddleware. An empty secret keeps the built-in SECRETKEY, which is only fit for development.
+// It must be called before the tokens are used.
+func SetSecret(secret string) {
+	if secret != "" {
+		defaultTokenManager.secret = []byte(secret)
 	}
-	// Create a new token with HS256 signing method and the specified claims.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// Sign the token using the secret key and return the signed token string.
-	return token.SignedString(secretKey)
+}
+
+// SetIssuerAndAudience configures the issuer and the audience of the tokens issued and accepted by
+// GenerateToken, IssueToken, ParseToken, and CheckJWTMiddleware (see TokenManager.SetIssuerAndAudience).
+// It must be called before the tokens are used.
+func SetIssuerAndAudience(issuer, audience string) {
+	defaultTokenManager.SetIssuerAndAudience(issuer, audience)
 }
 
 // ParseToken validates the provided JWT token string and parses its claims.
 // It returns the Claims if the token is valid, or an error otherwise.
 func ParseToken(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
+	return defaultTokenManager.ParseToken(tokenStr)
+}
+
+// SetVerifiedTokenCacheSize configures the verified token cache of ParseToken and CheckJWTMiddleware
+// (see TokenManager.SetVerifiedTokenCacheSize). It must be called before the tokens are used.
+func SetVerifiedTokenCacheSize(size int) {
+	defaultTokenManager.SetVerifiedTokenCacheSize(size)
+}
+
+// ForgetToken drops the tokens with the token ID tokenID from the verified token cache of ParseToken and
+// CheckJWTMiddleware (see TokenManager.ForgetToken).
+func ForgetToken(tokenID string) {
+	defaultTokenManager.ForgetToken(tokenID)
+}
+
+// GenerateToken creates a new JWT token for a given userID, expiring ttl after the manager's current time.
+func (manager *TokenManager) GenerateToken(userID int32) (string, error) {
+	issued, err := manager.IssueToken(userID)
+	if err != nil {
+		return "", err
+	}
+
+	return issued.Token, nil
+}
+
+// IssueToken creates a new JWT token for a given userID with a random token ID,
+// issued at the manager's current time and expiring ttl later. The token carries token version zero.
+func (manager *TokenManager) IssueToken(userID int32) (*IssuedToken, error) {
+	return manager.IssueVersionedToken(userID, 0)
+}
+
+// IssueVersionedToken behaves like IssueToken and records tokenVersion, the current token version of the user,
+// in the claims, so that the token can be told stale once the version is bumped.
+func (manager *TokenManager) IssueVersionedToken(userID int32, tokenVersion int32) (*IssuedToken, error) {
+	id := make([]byte, tokenIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return manager.issue(Claims{UserID: userID, TokenVersion: tokenVersion}, hex.EncodeToString(id), manager.ttl)
+}
+
+// IssueImpersonationToken creates a token letting the administrator impersonator act as userID, issued at
+// the manager's current time and expiring ImpersonationTTL later. The token takes the ID sessionID of
+// the administrator's session, so that the session checks and ForgetToken treat it as part of that session.
+func (manager *TokenManager) IssueImpersonationToken(userID int32, impersonator int32, sessionID string) (*IssuedToken, error) {
+	return manager.issue(Claims{UserID: userID, Impersonator: impersonator}, sessionID, ImpersonationTTL)
+}
+
+// issue signs claims as a token with the ID id, issued at the manager's current time and expiring ttl later.
+func (manager *TokenManager) issue(claims Claims, id string, ttl time.Duration) (*IssuedToken, error) {
+	now := manager.clock.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        id,
+		Issuer:    manager.issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	if manager.audience != "" {
+		claims.Audience = jwt.ClaimStrings{manager.audience}
+	}
+	// Create a new token with HS256 signing method and the specified claims.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Sign the token using the secret key and return the signed token string.
+	signed, err := token.SignedString(manager.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IssuedToken{Token: signed, ID: claims.ID, IssuedAt: claims.IssuedAt.Time, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
+
+// ParseToken validates the token signature and parses its claims.
+// Time-based claims are checked against the manager's clock rather than the wall clock. When the manager has
+// an issuer or an audience, tokens without matching claims fail with ErrTokenNotForService. With the verified
+// token cache enabled, the signature of a cached token is not verified again, but its claims are.
+func (manager *TokenManager) ParseToken(tokenStr string) (*Claims, error) {
+	if manager.verified != nil {
+		if claims, ok := manager.verified.get(tokenStr); ok {
+			if err := manager.validateClaims(claims); err != nil {
+				manager.verified.delete(tokenStr)
+				return nil, err
+			}
+			return claims, nil
+		}
+	}
+
+	token, err := manager.parser.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return manager.secret, nil
 	})
 	if err != nil {
 		return nil, err
 	}
 	// Validate and extract the claims.
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		// Return an error if the token signature is invalid.
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	if err := manager.validateClaims(claims); err != nil {
+		return nil, err
 	}
-	// Return an error if the token signature is invalid.
-	return nil, jwt.ErrSignatureInvalid
+	if manager.verified != nil {
+		manager.verified.add(tokenStr, claims)
+	}
+
+	return claims, nil
+}
+
+// validateClaims checks the time-based claims against the manager's clock and the issuer and audience claims
+// against the manager's configuration.
+func (manager *TokenManager) validateClaims(claims *Claims) error {
+	now := manager.clock.Now()
+	if !claims.VerifyExpiresAt(now, false) {
+		return jwt.ErrTokenExpired
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return jwt.ErrTokenNotValidYet
+	}
+	if manager.issuer != "" && !claims.VerifyIssuer(manager.issuer, true) {
+		return ErrTokenNotForService
+	}
+	if manager.audience != "" && !claims.VerifyAudience(manager.audience, true) {
+		return ErrTokenNotForService
+	}
+
+	return nil
 }
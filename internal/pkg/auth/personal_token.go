@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+)
+
+// PersonalTokenPrefix starts every personal access token, telling it apart from a JWT.
+const PersonalTokenPrefix = "pat_"
+
+// Scopes of personal access tokens. A personal access token is accepted only by the routes of its scopes,
+// while session tokens are accepted by every route.
+const (
+	ScopeSendCoin = "sendCoin" // POST /api/sendCoin and POST /api/sendCoin/confirm.
+	ScopeInfo     = "info"     // GET /api/info.
+)
+
+// Scopes lists the known scopes of personal access tokens.
+var Scopes = []string{ScopeSendCoin, ScopeInfo}
+
+// personalTokenBytes is the number of random bytes in the secret of a personal access token.
+const personalTokenBytes = 32
+
+// personalTokenDisplayLength is the length of the token prefix shown in token lists, including PersonalTokenPrefix.
+const personalTokenDisplayLength = len(PersonalTokenPrefix) + 8
+
+// ErrPersonalTokenInvalid indicates that a personal access token is unknown, revoked, or expired.
+var ErrPersonalTokenInvalid = errors.New("auth: invalid personal access token")
+
+// PersonalTokenResolver resolves a personal access token to its owner and scopes.
+// It returns ErrPersonalTokenInvalid for tokens that must be rejected.
+type PersonalTokenResolver interface {
+	ResolvePersonalToken(ctx context.Context, token string) (userID int32, scopes []string, err error)
+}
+
+// PersonalToken is a newly generated personal access token. Only Hash is stored; Token is shown to its owner once.
+type PersonalToken struct {
+	Token  string
+	Prefix string // The start of the token, enough for its owner to recognize it.
+	Hash   string
+}
+
+// GeneratePersonalToken creates a personal access token with a random secret.
+func GeneratePersonalToken() (*PersonalToken, error) {
+	secret := make([]byte, personalTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	token := PersonalTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return &PersonalToken{Token: token, Prefix: token[:personalTokenDisplayLength], Hash: HashPersonalToken(token)}, nil
+}
+
+// HashPersonalToken returns the hex-encoded SHA-256 hash under which a personal access token is stored.
+// The secret has 256 bits of entropy, so a fast unsalted hash is enough to keep leaked hashes useless.
+func HashPersonalToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestScopes returns the scopes of the personal access token the request was authenticated with.
+// It reports false for requests authenticated with a session token, which are not limited by scopes.
+func RequestScopes(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(tokenScopesContextKey{}).([]string)
+	return scopes, ok
+}
+
+// HasScope reports whether the request may use a route of the scope: requests authenticated with a session token
+// always may, and requests authenticated with a personal access token only when the token has the scope.
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, ok := RequestScopes(ctx)
+	return !ok || slices.Contains(scopes, scope)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/pkg/clock"
+)
+
+func TestRequestVerifier_Middleware(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	verifier := NewRequestVerifier([]byte("admin-secret"), SignatureWindow, fakeClock)
+
+	handler := verifier.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	const path = "/api/admin/accruals?month=2025-01"
+	const body = `{"amount":100}`
+	signedRequest := func(signedAt time.Time, nonce, signedBody, sentBody string) *http.Request {
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(sentBody))
+		req.Header.Set(HeaderAdminTimestamp, timestamp)
+		req.Header.Set(HeaderAdminNonce, nonce)
+		req.Header.Set(HeaderAdminSignature, verifier.Sign(http.MethodPost, path, timestamp, nonce, []byte(signedBody)))
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		rec := serve(signedRequest(now.Add(-time.Minute), "valid", body, body))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, body, rec.Body.String(), "the body must reach the handler unchanged")
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		rec := serve(signedRequest(now.Add(-SignatureWindow-time.Second), "expired", body, body))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "{\"errors\":\"request signature expired\",\"code\":\"SIGNATURE_INVALID\"}\n", rec.Body.String())
+
+		rec = serve(signedRequest(now.Add(SignatureWindow+time.Second), "future", body, body))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Replayed", func(t *testing.T) {
+		req := signedRequest(now, "replayed", body, body)
+		replay := signedRequest(now, "replayed", body, body)
+
+		require.Equal(t, http.StatusOK, serve(req).Code)
+		rec := serve(replay)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "{\"errors\":\"request signature replayed\",\"code\":\"SIGNATURE_INVALID\"}\n", rec.Body.String())
+	})
+
+	t.Run("TamperedBody", func(t *testing.T) {
+		rec := serve(signedRequest(now, "tampered", body, `{"amount":100000}`))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "{\"errors\":\"invalid request signature\",\"code\":\"SIGNATURE_INVALID\"}\n", rec.Body.String())
+
+		rec = serve(signedRequest(now, "tampered", body, body))
+		assert.Equal(t, http.StatusOK, rec.Code, "a rejected request must not use up its nonce")
+	})
+
+	t.Run("MissingHeaders", func(t *testing.T) {
+		rec := serve(httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "{\"errors\":\"missing request signature\",\"code\":\"SIGNATURE_INVALID\"}\n", rec.Body.String())
+	})
+
+	t.Run("NonceExpiresWithWindow", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, serve(signedRequest(now, "reused", body, body)).Code)
+
+		fakeClock.Advance(SignatureWindow + time.Second)
+		defer fakeClock.Set(now)
+		require.Equal(t, http.StatusOK, serve(signedRequest(fakeClock.Now(), "other", body, body)).Code)
+		assert.NotContains(t, verifier.nonces, "reused", "nonces outside the window must be dropped")
+	})
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// verifiedTokenCache remembers the claims of recently verified tokens, so that a client sending the same token
+// on every request has its signature verified once. It holds at most size tokens and evicts the least recently
+// used one beyond that. Entries are keyed by the token signature, and a hit still requires the whole token to
+// match, so a signature pasted onto other claims is never accepted.
+type verifiedTokenCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Front is the most recently used entry.
+	entries map[string]*list.Element
+}
+
+// verifiedToken is an entry of verifiedTokenCache.
+type verifiedToken struct {
+	signature string
+	token     string
+	claims    Claims
+}
+
+// newVerifiedTokenCache creates a verifiedTokenCache holding at most size tokens.
+func newVerifiedTokenCache(size int) *verifiedTokenCache {
+	return &verifiedTokenCache{size: size, order: list.New(), entries: make(map[string]*list.Element, size)}
+}
+
+// tokenSignature returns the signature part of a compact JWT, or an empty string when there is none.
+func tokenSignature(token string) string {
+	index := strings.LastIndexByte(token, '.')
+	if index < 0 {
+		return ""
+	}
+	return token[index+1:]
+}
+
+// get returns a copy of the claims of token if it is cached.
+func (cache *verifiedTokenCache) get(token string) (*Claims, bool) {
+	signature := tokenSignature(token)
+	if signature == "" {
+		return nil, false
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[signature]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*verifiedToken)
+	if entry.token != token {
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+
+	claims := entry.claims
+	return &claims, true
+}
+
+// add caches the claims of a verified token, evicting the least recently used token when the cache is full.
+func (cache *verifiedTokenCache) add(token string, claims *Claims) {
+	signature := tokenSignature(token)
+	if signature == "" {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, ok := cache.entries[signature]; ok {
+		cache.order.MoveToFront(element)
+		element.Value = &verifiedToken{signature: signature, token: token, claims: *claims}
+		return
+	}
+
+	cache.entries[signature] = cache.order.PushFront(&verifiedToken{signature: signature, token: token, claims: *claims})
+	if cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+// delete drops token from the cache.
+func (cache *verifiedTokenCache) delete(token string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, ok := cache.entries[tokenSignature(token)]; ok && element.Value.(*verifiedToken).token == token {
+		cache.remove(element)
+	}
+}
+
+// remove drops the entry of element. The caller must hold mu.
+func (cache *verifiedTokenCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*verifiedToken).signature)
+}
+
+// forget drops the cached tokens with the token ID (jti) tokenID.
+func (cache *verifiedTokenCache) forget(tokenID string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for element := cache.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*verifiedToken).claims.ID == tokenID {
+			cache.remove(element)
+		}
+		element = next
+	}
+}
+
+// len returns the number of cached tokens.
+func (cache *verifiedTokenCache) len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.order.Len()
+}
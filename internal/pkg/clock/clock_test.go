@@ -0,0 +1,27 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2025, 1, 1, 23, 59, 0, 0, time.UTC)
+	fake := NewFake(start)
+	assert.Equal(t, start, fake.Now())
+
+	fake.Advance(2 * time.Minute)
+	assert.Equal(t, start.Add(2*time.Minute), fake.Now())
+
+	later := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	fake.Set(later)
+	assert.Equal(t, later, fake.Now())
+}
+
+func TestReal(t *testing.T) {
+	now := Real{}.Now()
+	assert.Equal(t, time.UTC, now.Location())
+	assert.WithinDuration(t, time.Now(), now, time.Second)
+}
@@ -0,0 +1,142 @@
+// Package crypto encrypts values stored at rest with AES-GCM under rotatable keys.
+// Each ciphertext is prefixed with the ID of the key that sealed it, so that values written under retired keys can
+// still be read, and values without the prefix are taken as plaintext written before encryption was enabled.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks encrypted values; it is followed by the key ID, a colon, and the base64 nonce and ciphertext.
+const encryptedPrefix = "enc:"
+
+var (
+	// ErrUnknownKey indicates that a value was encrypted under a key that is not configured.
+	ErrUnknownKey = errors.New("crypto: unknown key")
+	// ErrDecryptionFailed indicates that a value is malformed or was not sealed by the configured key of its ID.
+	ErrDecryptionFailed = errors.New("crypto: decryption failed")
+	// ErrInvalidKeys indicates that the keys given to ParseKeys or NewCipher are unusable.
+	ErrInvalidKeys = errors.New("crypto: invalid keys")
+)
+
+// Cipher encrypts values under its primary key and decrypts values under any of its keys.
+// A nil *Cipher disables encryption: it stores values as they are and cannot read encrypted ones.
+type Cipher struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewCipher creates a Cipher encrypting under the key with ID primary. Keys must be 16, 24, or 32 bytes long
+// (AES-128, AES-192, or AES-256), and their IDs must not contain colons.
+func NewCipher(primary string, keys map[string][]byte) (*Cipher, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: primary key %q is not configured", ErrInvalidKeys, primary)
+	}
+
+	c := &Cipher{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("%w: key ID %q", ErrInvalidKeys, id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %s", ErrInvalidKeys, id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[id] = aead
+	}
+	return c, nil
+}
+
+// ParseKeys creates a Cipher from a comma-separated list of id:base64key pairs, the first of which is the primary
+// key. Rotating keys means prepending a new pair and keeping the old ones until no value uses them.
+// An empty list returns a nil Cipher, which disables encryption.
+func ParseKeys(value string) (*Cipher, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var primary string
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(value, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: expected id:base64key, got %q", ErrInvalidKeys, pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q is not base64", ErrInvalidKeys, id)
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("%w: duplicate key ID %q", ErrInvalidKeys, id)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+	return NewCipher(primary, keys)
+}
+
+// Enabled reports whether values are encrypted.
+func (c *Cipher) Enabled() bool {
+	return c != nil
+}
+
+// Encrypt seals the plaintext under the primary key with a random nonce, binding it to the key ID.
+// When encryption is disabled, it returns the plaintext unchanged.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if c == nil {
+		return plaintext, nil
+	}
+
+	aead := c.keys[c.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(c.primary))
+	return encryptedPrefix + c.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value returned by Encrypt under the key named in it. Values without the encrypted prefix are
+// returned unchanged, so that rows written before encryption was enabled still read correctly. It returns
+// ErrUnknownKey when the key is not configured or encryption is disabled, and ErrDecryptionFailed when the value
+// is malformed or has been tampered with.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", ErrDecryptionFailed
+	}
+	if c == nil {
+		return "", ErrUnknownKey
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrDecryptionFailed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestCipher_RoundTrip(t *testing.T) {
+	c, err := ParseKeys("k1:" + key(1))
+	require.NoError(t, err)
+	require.True(t, c.Enabled())
+
+	details := `{"ip":"203.0.113.7","userAgent":"curl/8.0"}`
+	encrypted, err := c.Encrypt(details)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "enc:k1:"))
+	assert.NotContains(t, encrypted, "203.0.113.7")
+
+	again, err := c.Encrypt(details)
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again, "nonces must be random")
+
+	decrypted, err := c.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, details, decrypted)
+}
+
+func TestCipher_Plaintext(t *testing.T) {
+	c, err := ParseKeys("k1:" + key(1))
+	require.NoError(t, err)
+
+	decrypted, err := c.Decrypt(`{"ip":"203.0.113.7"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ip":"203.0.113.7"}`, decrypted, "rows written before encryption must still read")
+
+	var disabled *Cipher
+	assert.False(t, disabled.Enabled())
+	stored, err := disabled.Encrypt("details")
+	require.NoError(t, err)
+	assert.Equal(t, "details", stored)
+
+	encrypted, err := c.Encrypt("details")
+	require.NoError(t, err)
+	_, err = disabled.Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestCipher_Rotation(t *testing.T) {
+	old, err := ParseKeys("k1:" + key(1))
+	require.NoError(t, err)
+	encrypted, err := old.Encrypt("details")
+	require.NoError(t, err)
+
+	rotated, err := ParseKeys("k2:" + key(2) + ", k1:" + key(1))
+	require.NoError(t, err)
+	decrypted, err := rotated.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "details", decrypted, "values under retired keys must still read")
+
+	encrypted, err = rotated.Encrypt("details")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "enc:k2:"))
+	_, err = old.Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestCipher_WrongKey(t *testing.T) {
+	c, err := ParseKeys("k1:" + key(1))
+	require.NoError(t, err)
+	encrypted, err := c.Encrypt("details")
+	require.NoError(t, err)
+
+	other, err := ParseKeys("k1:" + key(2))
+	require.NoError(t, err)
+	_, err = other.Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	tampered := encrypted[:len(encrypted)-4] + "AAA="
+	_, err = c.Decrypt(tampered)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	for _, value := range []string{"enc:k1", "enc:k1:not base64", "enc:k1:AAAA"} {
+		_, err = c.Decrypt(value)
+		assert.ErrorIs(t, err, ErrDecryptionFailed, value)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	c, err := ParseKeys(" ")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	for _, value := range []string{
+		"k1",
+		"k1:not base64",
+		"k1:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"k1:" + key(1) + ",k1:" + key(2),
+		":" + key(1),
+	} {
+		_, err = ParseKeys(value)
+		assert.ErrorIs(t, err, ErrInvalidKeys, value)
+	}
+}
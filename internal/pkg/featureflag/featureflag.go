@@ -0,0 +1,320 @@
+// Package featureflag provides coarse-grained feature flags evaluated per request.
+// Flags are read from a JSON file and from environment variables, which take precedence, and fall back to
+// the defaults of the known flags. A flag may be rolled out to a percentage of users: each user is placed
+// in a stable bucket derived from the flag name and the user ID, so a user sees the same state on every request.
+// The file is reloaded when it changes, so flags can be switched without a redeploy.
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+)
+
+// Known flags.
+const (
+	// StrictJSON rejects request bodies with fields the endpoint does not know.
+	StrictJSON = "strict_json"
+	// PurchaseQueue sends purchases of flash-sale items through their queue.
+	PurchaseQueue = "purchase_queue"
+	// PublicRoutes serves the listing of the routes on /api/routes without authentication.
+	PublicRoutes = "public_routes"
+)
+
+// Defaults holds the state of the known flags when neither the file nor the environment sets them.
+// Flags missing here and not set otherwise are off.
+var Defaults = map[string]Rule{
+	StrictJSON:    {Enabled: false, Percentage: 100},
+	PurchaseQueue: {Enabled: true, Percentage: 100},
+	PublicRoutes:  {Enabled: false, Percentage: 100},
+}
+
+// EnvPrefix starts the names of environment variables setting flags: FEATURE_FLAG_STRICT_JSON sets strict_json.
+// The value is a rollout percentage from 0 to 100 or, otherwise, a boolean such as true or false.
+const EnvPrefix = "FEATURE_FLAG_"
+
+// Sources of the effective state of a flag.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+)
+
+// Rule is the configured state of a flag. An enabled flag applies to Percentage percent of users.
+// In the flag file a rule is either a boolean or an object such as {"enabled": true, "percentage": 25};
+// the percentage defaults to 100.
+type Rule struct {
+	Enabled    bool `json:"enabled"`
+	Percentage int  `json:"percentage"`
+}
+
+// UnmarshalJSON decodes a rule from a boolean or an object, validating the percentage.
+func (rule *Rule) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*rule = Rule{Enabled: enabled, Percentage: 100}
+		return nil
+	}
+
+	var object struct {
+		Enabled    bool `json:"enabled"`
+		Percentage *int `json:"percentage"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	*rule = Rule{Enabled: object.Enabled, Percentage: 100}
+	if object.Percentage != nil {
+		if *object.Percentage < 0 || *object.Percentage > 100 {
+			return ErrInvalidPercentage
+		}
+		rule.Percentage = *object.Percentage
+	}
+	return nil
+}
+
+// State is the effective state of a flag together with where it comes from.
+type State struct {
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	Percentage int    `json:"percentage"`
+	Source     string `json:"source"`
+}
+
+// ErrInvalidPercentage indicates that a rollout percentage is outside 0-100.
+var ErrInvalidPercentage = errors.New("featureflag: percentage must be between 0 and 100")
+
+// Flags evaluates feature flags. It is safe for concurrent use.
+// A nil *Flags evaluates every flag to its default.
+type Flags struct {
+	interval time.Duration
+	log      *logger.Logger
+	environ  func() []string
+
+	mu      sync.RWMutex
+	path    string
+	states  map[string]State
+	modTime time.Time // Modification time of the file when it was last loaded.
+	size    int64     // Size of the file when it was last loaded.
+}
+
+// New creates Flags reading the JSON file at path, when not empty, and checking it for changes every interval.
+// Call Reload to load the flags before use; until then every flag has its default.
+func New(path string, interval time.Duration, l *logger.Logger) *Flags {
+	flags := &Flags{path: path, interval: interval, log: l, environ: os.Environ}
+	flags.states = mergeStates(nil, nil)
+	return flags
+}
+
+// Reload reads the flag file and the environment and replaces the effective flags.
+// When the file cannot be read or parsed, the previous flags are kept and the error is returned.
+func (flags *Flags) Reload() error {
+	return flags.load(flags.Path())
+}
+
+// Path returns the path of the flag file, empty when flags are read from the environment only.
+func (flags *Flags) Path() string {
+	flags.mu.RLock()
+	defer flags.mu.RUnlock()
+	return flags.path
+}
+
+// SetPath switches to the flag file at path, or to the environment only when path is empty, and reloads the flags.
+// When the new file cannot be read or parsed, the previous file and flags are kept and the error is returned.
+func (flags *Flags) SetPath(path string) error {
+	return flags.load(path)
+}
+
+// load reads the flag file at path and the environment, and replaces the flag file and the effective flags.
+func (flags *Flags) load(path string) error {
+	var fileRules map[string]Rule
+	var modTime time.Time
+	var size int64
+	if path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(data, &fileRules); err != nil {
+			return fmt.Errorf("featureflag: parsing %s: %w", path, err)
+		}
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	envRules, err := parseEnv(flags.environ())
+	if err != nil {
+		return err
+	}
+
+	states := mergeStates(fileRules, envRules)
+
+	flags.mu.Lock()
+	flags.path = path
+	flags.states = states
+	flags.modTime, flags.size = modTime, size
+	flags.mu.Unlock()
+
+	return nil
+}
+
+// Run reloads the flags whenever the flag file changes, checking every interval until ctx is canceled.
+// Without a flag file, there is nothing to check until one is set with SetPath. It implements worker.Worker.
+func (flags *Flags) Run(ctx context.Context) error {
+	ticker := time.NewTicker(flags.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if _, err := flags.reloadIfChanged(); err != nil {
+			flags.log.Sugar().Errorf("Failed to reload feature flags, keeping the previous ones: %s", err)
+		}
+	}
+}
+
+// reloadIfChanged reloads the flags when the modification time or the size of the flag file has changed
+// since it was last loaded, and reports whether it did.
+func (flags *Flags) reloadIfChanged() (bool, error) {
+	path := flags.Path()
+	if path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	flags.mu.RLock()
+	unchanged := info.ModTime().Equal(flags.modTime) && info.Size() == flags.size
+	flags.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if err = flags.load(path); err != nil {
+		return false, err
+	}
+	flags.log.Sugar().Infof("Reloaded feature flags from %s", path)
+	return true, nil
+}
+
+// IsEnabled reports whether the flag is on for the request. For a flag rolled out to part of the users,
+// it is on only for requests of authenticated users whose bucket falls within the percentage.
+// Unknown flags are off.
+func (flags *Flags) IsEnabled(ctx context.Context, flag string) bool {
+	state, ok := flags.state(flag)
+	if !ok || !state.Enabled {
+		return false
+	}
+	if state.Percentage >= 100 {
+		return true
+	}
+
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return false
+	}
+	return bucket(flag, userID) < state.Percentage
+}
+
+// States returns the effective state of every flag, sorted by name.
+func (flags *Flags) States() []State {
+	var states map[string]State
+	if flags == nil {
+		states = mergeStates(nil, nil)
+	} else {
+		flags.mu.RLock()
+		states = flags.states
+		flags.mu.RUnlock()
+	}
+
+	list := make([]State, 0, len(states))
+	for _, state := range states {
+		list = append(list, state)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// state returns the effective state of the flag.
+func (flags *Flags) state(flag string) (State, bool) {
+	if flags == nil {
+		rule, ok := Defaults[flag]
+		return State{Name: flag, Enabled: rule.Enabled, Percentage: rule.Percentage, Source: SourceDefault}, ok
+	}
+
+	flags.mu.RLock()
+	defer flags.mu.RUnlock()
+	state, ok := flags.states[flag]
+	return state, ok
+}
+
+// bucket places the user in one of 100 buckets of the flag. The bucket depends only on the flag name and
+// the user ID, so a user keeps their bucket across requests and restarts, and buckets of different flags are independent.
+func bucket(flag string, userID int32) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(flag))
+	hash.Write([]byte{':'})
+	hash.Write([]byte(strconv.FormatInt(int64(userID), 10)))
+	return int(hash.Sum32() % 100)
+}
+
+// mergeStates combines the defaults with the rules of the file and then of the environment, later ones winning.
+func mergeStates(fileRules, envRules map[string]Rule) map[string]State {
+	states := make(map[string]State, len(Defaults)+len(fileRules)+len(envRules))
+	for _, source := range []struct {
+		name  string
+		rules map[string]Rule
+	}{{SourceDefault, Defaults}, {SourceFile, fileRules}, {SourceEnv, envRules}} {
+		for name, rule := range source.rules {
+			states[name] = State{Name: name, Enabled: rule.Enabled, Percentage: rule.Percentage, Source: source.name}
+		}
+	}
+	return states
+}
+
+// parseEnv returns the rules set by EnvPrefix variables of the environment.
+func parseEnv(environ []string) (map[string]Rule, error) {
+	rules := make(map[string]Rule)
+	for _, variable := range environ {
+		key, value, found := strings.Cut(variable, "=")
+		if !found || !strings.HasPrefix(key, EnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, EnvPrefix))
+
+		if percentage, err := strconv.Atoi(value); err == nil {
+			if percentage < 0 || percentage > 100 {
+				return nil, fmt.Errorf("featureflag: %s: %w", key, ErrInvalidPercentage)
+			}
+			rules[name] = Rule{Enabled: percentage > 0, Percentage: percentage}
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("featureflag: invalid value %q of %s", value, key)
+		}
+		rules[name] = Rule{Enabled: enabled, Percentage: 100}
+	}
+	return rules, nil
+}
@@ -0,0 +1,140 @@
+package featureflag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+)
+
+// userContext returns a context of a request authenticated as the user.
+func userContext(userID int32) context.Context {
+	return auth.WithUserID(context.Background(), userID)
+}
+
+// newTestFlags creates Flags reading path with the given environment instead of the process one.
+func newTestFlags(path string, environ ...string) *Flags {
+	flags := New(path, time.Minute, &logger.Logger{Logger: zap.NewNop()})
+	flags.environ = func() []string { return environ }
+	return flags
+}
+
+func TestIsEnabled_Defaults(t *testing.T) {
+	flags := newTestFlags("")
+	require.NoError(t, flags.Reload())
+	ctx := userContext(1)
+
+	assert.False(t, flags.IsEnabled(ctx, "no_such_flag"), "unknown flags must be off")
+	assert.False(t, flags.IsEnabled(ctx, StrictJSON))
+	assert.True(t, flags.IsEnabled(ctx, PurchaseQueue))
+
+	var unset *Flags
+	assert.False(t, unset.IsEnabled(ctx, "no_such_flag"))
+	assert.True(t, unset.IsEnabled(ctx, PurchaseQueue), "nil flags must evaluate to the defaults")
+	assert.Equal(t, flags.States(), unset.States())
+}
+
+func TestReload_FileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"strict_json": true, "new_flag": {"enabled": true, "percentage": 30}, "purchase_queue": false}`), 0o600))
+
+	flags := newTestFlags(path, "FEATURE_FLAG_PURCHASE_QUEUE=true", "FEATURE_FLAG_ROLLOUT=0", "OTHER=1")
+	require.NoError(t, flags.Reload())
+
+	assert.Equal(t, []State{
+		{Name: "new_flag", Enabled: true, Percentage: 30, Source: SourceFile},
+		{Name: PublicRoutes, Enabled: false, Percentage: 100, Source: SourceDefault},
+		{Name: PurchaseQueue, Enabled: true, Percentage: 100, Source: SourceEnv},
+		{Name: "rollout", Enabled: false, Percentage: 0, Source: SourceEnv},
+		{Name: StrictJSON, Enabled: true, Percentage: 100, Source: SourceFile},
+	}, flags.States())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"new_flag": {"percentage": 150}}`), 0o600))
+	assert.ErrorIs(t, flags.Reload(), ErrInvalidPercentage)
+	assert.True(t, flags.IsEnabled(userContext(1), StrictJSON), "a failed reload must keep the previous flags")
+
+	flags = newTestFlags("", "FEATURE_FLAG_STRICT_JSON=maybe")
+	assert.Error(t, flags.Reload())
+}
+
+func TestReloadIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"strict_json": false}`), 0o600))
+
+	flags := newTestFlags(path)
+	require.NoError(t, flags.Reload())
+	ctx := userContext(1)
+	assert.False(t, flags.IsEnabled(ctx, StrictJSON))
+
+	reloaded, err := flags.reloadIfChanged()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "an unchanged file must not be reloaded")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"strict_json": true}`), 0o600))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	reloaded, err = flags.reloadIfChanged()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.True(t, flags.IsEnabled(ctx, StrictJSON), "a changed file must be picked up")
+
+	require.NoError(t, os.Remove(path))
+	_, err = flags.reloadIfChanged()
+	assert.Error(t, err)
+	assert.True(t, flags.IsEnabled(ctx, StrictJSON), "a missing file must keep the previous flags")
+}
+
+func TestSetPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "flags.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"strict_json": true}`), 0o600))
+	broken := filepath.Join(dir, "broken.json")
+	require.NoError(t, os.WriteFile(broken, []byte(`{`), 0o600))
+
+	flags := newTestFlags("")
+	require.NoError(t, flags.Reload())
+	ctx := userContext(1)
+	reloaded, err := flags.reloadIfChanged()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "without a file there is nothing to reload")
+
+	require.NoError(t, flags.SetPath(path))
+	assert.Equal(t, path, flags.Path())
+	assert.True(t, flags.IsEnabled(ctx, StrictJSON), "the new file must be loaded at once")
+
+	assert.Error(t, flags.SetPath(broken))
+	assert.Equal(t, path, flags.Path(), "a broken file must keep the previous one")
+	assert.True(t, flags.IsEnabled(ctx, StrictJSON))
+
+	require.NoError(t, flags.SetPath(""))
+	assert.False(t, flags.IsEnabled(ctx, StrictJSON), "an empty path must go back to the defaults")
+}
+
+func TestIsEnabled_PercentageRollout(t *testing.T) {
+	flags := newTestFlags("", "FEATURE_FLAG_ROLLOUT=25")
+	require.NoError(t, flags.Reload())
+
+	enabled := 0
+	const users = 10000
+	for userID := int32(1); userID <= users; userID++ {
+		first := flags.IsEnabled(userContext(userID), "rollout")
+		assert.Equal(t, first, flags.IsEnabled(userContext(userID), "rollout"), "a user must keep their bucket")
+		assert.Equal(t, bucket("rollout", userID) < 25, first)
+		if first {
+			enabled++
+		}
+	}
+	assert.InDelta(t, users/4, enabled, users/20, "about a quarter of the users must be enabled")
+
+	assert.False(t, flags.IsEnabled(context.Background(), "rollout"), "a partial rollout must be off without a user")
+	assert.Equal(t, bucket("rollout", 42), bucket("rollout", 42))
+}
@@ -4,19 +4,31 @@
 package logger
 
 import (
+	"errors"
 	"log"
+	"math/rand"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // Logger wraps the zap.Logger to provide additional logging functionality.
 type Logger struct {
 	*zap.Logger
+
+	level      *zap.AtomicLevel
+	requestLog atomic.Pointer[requestLogFilter]
 }
 
+// ErrFixedLevel indicates that the level of a Logger not created by CreateLogger cannot be changed.
+var ErrFixedLevel = errors.New("logger: level cannot be changed")
+
 // newLogger initializes a new Logger instance using the production configuration of Zap.
 // In case of an error during creation, it logs the error using the standard log package.
 func newLogger() *Logger {
@@ -47,24 +59,118 @@ func CreateLogger(level string) (customLog *Logger, err error) {
 	}
 
 	log.Logger = zl
+	log.level = &lvl
 	return log, nil
 }
 
+// SetLevel changes the minimum level of the entries logged by a Logger created by CreateLogger.
+// The change is immediate and affects every logger derived from it.
+func (log *Logger) SetLevel(level string) error {
+	if log.level == nil {
+		return ErrFixedLevel
+	}
+	parsed, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.level.SetLevel(parsed)
+	return nil
+}
+
+// RequestLogPolicy configures which requests WithLogging logs.
+type RequestLogPolicy struct {
+	// SkipPrefixes lists the path prefixes of requests that are never logged, such as health probes and metrics scrapes.
+	SkipPrefixes []string
+	// SuccessSampleRate logs one in SuccessSampleRate successful (2xx) requests. Values below 2 log all of them.
+	SuccessSampleRate int
+	// SlowThreshold is the duration from which a request is logged even if it is successful and not sampled.
+	// Zero disables it.
+	SlowThreshold time.Duration
+	// Source picks the sampled requests. It defaults to a source seeded with the current time.
+	Source rand.Source
+}
+
+// requestLogFilter decides which requests are logged according to a RequestLogPolicy.
+type requestLogFilter struct {
+	policy RequestLogPolicy
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// SetRequestLogPolicy changes which requests are logged by the middleware returned by WithLogging,
+// starting with the requests that finish after the call. By default every request is logged.
+func (log *Logger) SetRequestLogPolicy(policy RequestLogPolicy) {
+	if policy.Source == nil {
+		policy.Source = rand.NewSource(time.Now().UnixNano())
+	}
+	log.requestLog.Store(&requestLogFilter{policy: policy, rnd: rand.New(policy.Source)})
+}
+
+// skip reports whether requests to path are never logged.
+func (filter *requestLogFilter) skip(path string) bool {
+	for _, prefix := range filter.policy.SkipPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sample reports whether a request that finished with status after duration is logged. Unsuccessful and slow
+// requests are always logged, and successful ones at the sample rate, which is returned for the requests logged by sampling.
+// A zero status means that the handler wrote nothing, which net/http answers with 200.
+func (filter *requestLogFilter) sample(status int, duration time.Duration) (logged bool, sampleRate int) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status < 200 || status >= 300 || filter.policy.SuccessSampleRate < 2 {
+		return true, 0
+	}
+	if filter.policy.SlowThreshold > 0 && duration >= filter.policy.SlowThreshold {
+		return true, 0
+	}
+
+	filter.mu.Lock()
+	defer filter.mu.Unlock()
+	return filter.rnd.Intn(filter.policy.SuccessSampleRate) == 0, filter.policy.SuccessSampleRate
+}
+
 // WithLogging returns HTTP middleware that logs incoming HTTP requests.
 // It wraps the provided HTTP handler, recording details such as method, URI, status code,
-// duration, and response size using the Zap logger.
+// duration, and response size using the Zap logger. The URI is truncated to MaxLoggedURILength characters.
+// Requests are filtered by the policy set with SetRequestLogPolicy; entries of sampled successful requests
+// carry the sample rate, so that the actual number of requests can be estimated.
 func (log *Logger) WithLogging() func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			filter := log.requestLog.Load()
+			if filter != nil && filter.skip(r.URL.Path) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 			t1 := time.Now()
 			defer func() {
-				log.Info("served",
+				duration := time.Since(t1)
+				fields := []zap.Field{
 					zap.String("method", r.Method),
-					zap.String("uri", r.URL.Path),
+					zap.String("uri", Truncate(r.URL.Path, MaxLoggedURILength)),
 					zap.Int("status", ww.Status()),
-					zap.Duration("duration", time.Since(t1)),
-					zap.Int("size", ww.BytesWritten()))
+					zap.Duration("duration", duration),
+					zap.Int("size", ww.BytesWritten()),
+				}
+				if filter != nil {
+					logged, sampleRate := filter.sample(ww.Status(), duration)
+					if !logged {
+						return
+					}
+					if sampleRate > 0 {
+						fields = append(fields, zap.Int("sampleRate", sampleRate))
+					}
+				}
+				log.Info("served", fields...)
 			}()
 			h.ServeHTTP(ww, r)
 		}
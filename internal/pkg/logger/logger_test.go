@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observedLogger returns a Logger recording its entries with the policy applied, if any.
+func observedLogger(policy *RequestLogPolicy) (*Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	log := &Logger{Logger: zap.New(core)}
+	if policy != nil {
+		log.SetRequestLogPolicy(*policy)
+	}
+	return log, logs
+}
+
+// serve sends a request to path through the logging middleware of log, answered with status after delay.
+func serve(log *Logger, path string, status int, delay time.Duration) {
+	handler := log.WithLogging()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func TestWithLogging(t *testing.T) {
+	t.Run("Default policy logs everything", func(t *testing.T) {
+		log, logs := observedLogger(nil)
+		serve(log, "/metrics", http.StatusOK, 0)
+		serve(log, "/api/info", http.StatusOK, 0)
+		assert.Equal(t, 2, logs.Len())
+	})
+
+	t.Run("Skipped paths", func(t *testing.T) {
+		log, logs := observedLogger(&RequestLogPolicy{SkipPrefixes: []string{"/healthz", "/metrics"}})
+		serve(log, "/healthz", http.StatusOK, 0)
+		serve(log, "/healthz/ready", http.StatusServiceUnavailable, 0)
+		serve(log, "/metrics", http.StatusOK, 0)
+		assert.Zero(t, logs.Len(), "skipped paths must produce no entries")
+
+		serve(log, "/api/info", http.StatusOK, 0)
+		entries := logs.All()
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, "/api/info", entries[0].ContextMap()["uri"])
+		}
+	})
+
+	t.Run("Errors are always logged", func(t *testing.T) {
+		log, logs := observedLogger(&RequestLogPolicy{SuccessSampleRate: 1_000_000, Source: rand.NewSource(1)})
+		for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+			serve(log, "/api/info", status, 0)
+		}
+		assert.Equal(t, 4, logs.Len())
+		for _, entry := range logs.All() {
+			assert.NotContains(t, entry.ContextMap(), "sampleRate")
+		}
+	})
+
+	t.Run("Slow requests are always logged", func(t *testing.T) {
+		log, logs := observedLogger(&RequestLogPolicy{SuccessSampleRate: 1_000_000, SlowThreshold: time.Millisecond, Source: rand.NewSource(1)})
+		serve(log, "/api/info", http.StatusOK, 5*time.Millisecond)
+		assert.Equal(t, 1, logs.Len())
+	})
+
+	t.Run("Deterministic sampling", func(t *testing.T) {
+		sampled := func() []int {
+			log, logs := observedLogger(&RequestLogPolicy{SuccessSampleRate: 10, Source: rand.NewSource(42)})
+			var logged []int
+			for i := 0; i < 1000; i++ {
+				before := logs.Len()
+				serve(log, "/api/info", http.StatusOK, 0)
+				if logs.Len() > before {
+					logged = append(logged, i)
+				}
+			}
+			for _, entry := range logs.All() {
+				assert.Equal(t, int64(10), entry.ContextMap()["sampleRate"])
+			}
+			return logged
+		}
+
+		first := sampled()
+		assert.Equal(t, first, sampled(), "the same seed must sample the same requests")
+		assert.InDelta(t, 100, len(first), 40, "about one in ten successful requests must be logged")
+	})
+}
+
+func TestSetLevel(t *testing.T) {
+	log, err := CreateLogger("info")
+	require.NoError(t, err)
+	assert.False(t, log.Core().Enabled(zapcore.DebugLevel))
+
+	derived := log.With(zap.String("component", "test"))
+	require.NoError(t, log.SetLevel("debug"))
+	assert.True(t, log.Core().Enabled(zapcore.DebugLevel))
+	assert.True(t, derived.Core().Enabled(zapcore.DebugLevel), "derived loggers must follow the level")
+
+	assert.Error(t, log.SetLevel("loud"))
+	assert.True(t, log.Core().Enabled(zapcore.DebugLevel), "an invalid level must keep the current one")
+
+	fixed := &Logger{Logger: zap.NewNop()}
+	assert.ErrorIs(t, fixed.SetLevel("debug"), ErrFixedLevel)
+}
+
+func TestSetRequestLogPolicy_Reload(t *testing.T) {
+	log, logs := observedLogger(nil)
+	handler := log.WithLogging()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	}
+
+	request()
+	assert.Equal(t, 1, logs.Len())
+
+	log.SetRequestLogPolicy(RequestLogPolicy{SkipPrefixes: []string{"/metrics"}})
+	request()
+	assert.Equal(t, 1, logs.Len(), "a new policy must apply to existing middleware")
+}
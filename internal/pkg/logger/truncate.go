@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"go.uber.org/zap"
+)
+
+// Longest values written to the logs, in characters. Longer values are truncated with an ellipsis by Truncate, so
+// that a request with an oversized path or item name cannot flood the logs.
+const (
+	MaxLoggedItemNameLength = 80
+	MaxLoggedURILength      = 256
+)
+
+// ellipsis replaces the end of truncated values.
+const ellipsis = "…"
+
+// Truncate returns value when it is at most maxLength characters long, and otherwise its first maxLength-1
+// characters followed by an ellipsis, so that the result is maxLength characters long.
+func Truncate(value string, maxLength int) string {
+	if maxLength <= 0 {
+		return ""
+	}
+
+	characters := 0
+	cut := 0
+	for i := range value {
+		if characters == maxLength-1 {
+			cut = i
+		}
+		if characters == maxLength {
+			return value[:cut] + ellipsis
+		}
+		characters++
+	}
+	return value
+}
+
+// ItemName returns the "itemName" log field of an item name, truncated to MaxLoggedItemNameLength characters.
+func ItemName(name string) zap.Field {
+	return zap.String("itemName", Truncate(name, MaxLoggedItemNameLength))
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     string
+		maxLength int
+		expected  string
+	}{
+		{name: "Empty", value: "", maxLength: 5, expected: ""},
+		{name: "Shorter", value: "cup", maxLength: 5, expected: "cup"},
+		{name: "Exact length", value: "hoody", maxLength: 5, expected: "hoody"},
+		{name: "One character over", value: "t-shirt", maxLength: 6, expected: "t-shi…"},
+		{name: "Counted in characters", value: "футболка", maxLength: 5, expected: "футб…"},
+		{name: "Ellipsis only", value: "pen", maxLength: 1, expected: "…"},
+		{name: "No room", value: "pen", maxLength: 0, expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Truncate(tc.value, tc.maxLength))
+		})
+	}
+}
+
+func TestItemName(t *testing.T) {
+	field := ItemName(strings.Repeat("x", 10<<10))
+	assert.Equal(t, "itemName", field.Key)
+	assert.Equal(t, MaxLoggedItemNameLength, utf8.RuneCountInString(field.String))
+	assert.True(t, strings.HasSuffix(field.String, ellipsis))
+
+	assert.Equal(t, "pink-hoody", ItemName("pink-hoody").String, "short names are logged whole")
+}
@@ -0,0 +1,28 @@
+package metrics
+
+// Outcomes of authentication attempts and token checks, the values of the outcome label of AuthOutcomes.
+const (
+	AuthOutcomeLogin        = "login"         // An existing user signed in.
+	AuthOutcomeRegistration = "registration"  // A new user was created on first sign-in.
+	AuthOutcomeBadPassword  = "bad_password"  // A sign-in was rejected because of a wrong password.
+	AuthOutcomeTokenExpired = "token_expired" // A request was rejected because its token has expired.
+	AuthOutcomeTokenInvalid = "token_invalid" // A request was rejected because its token or auth header is malformed or forged.
+)
+
+// Authentication metrics. They are never labeled by user, so that their cardinality stays fixed.
+var (
+	// TokensIssued counts the tokens issued on successful sign-ins.
+	TokensIssued = Default.NewCounter("merch_store_auth_tokens_issued_total", "Number of tokens issued on successful sign-ins.")
+	// AuthOutcomes counts sign-in attempts and rejected tokens by outcome.
+	AuthOutcomes = Default.NewCounterVec("merch_store_auth_outcomes_total", "Number of sign-in attempts and token checks by outcome.", "outcome",
+		AuthOutcomeLogin, AuthOutcomeRegistration, AuthOutcomeBadPassword, AuthOutcomeTokenExpired, AuthOutcomeTokenInvalid)
+)
+
+// activeTokensMetric is the name of the gauge registered by RegisterActiveTokens.
+const activeTokensMetric = "merch_store_auth_active_tokens"
+
+// RegisterActiveTokens exports the approximate number of active tokens, as reported by count on every scrape.
+// It is only meaningful when issued tokens are tracked in the session registry.
+func RegisterActiveTokens(count func() float64) {
+	Default.NewGaugeFunc(activeTokensMetric, "Approximate number of unexpired and unrevoked tokens.", count)
+}
@@ -0,0 +1,12 @@
+package metrics
+
+// Invariant metrics, updated by the scheduled invariant checks. The values of the invariant label of
+// InvariantViolations are the invariants of models.InvariantViolation.
+var (
+	// InvariantChecks counts the completed invariant checks.
+	InvariantChecks = Default.NewCounter("merch_store_invariant_checks_total", "Number of completed checks of the coin economy invariants.")
+	// InvariantViolations counts the violations reported by the invariant checks by invariant. A violation left
+	// unrepaired is counted again by every check, so any increase means the economy is inconsistent.
+	InvariantViolations = Default.NewCounterVec("merch_store_invariant_violations_total", "Number of violations of the coin economy invariants found by the checks.", "invariant",
+		"negative_balance", "ledger_balance", "transfer_balance", "purchase_total", "username_normalized")
+)
@@ -0,0 +1,212 @@
+// Package metrics provides counters and gauges exposed in the Prometheus text exposition format.
+// Metrics are registered in a Registry, whose Handler serves them for scraping;
+// the metrics of the application itself are registered in Default.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// collector is a metric able to write itself in the text exposition format.
+type collector interface {
+	name() string
+	write(w io.Writer) error
+}
+
+// Registry holds metrics and serves them for scraping. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default is the registry of the application metrics served on /metrics.
+var Default = NewRegistry()
+
+// register adds the collector to the registry, replacing a previously registered metric with the same name.
+func (registry *Registry) register(c collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.collectors[c.name()] = c
+}
+
+// WriteTo writes all registered metrics, sorted by name, in the text exposition format.
+func (registry *Registry) WriteTo(w io.Writer) (int64, error) {
+	registry.mu.Lock()
+	collectors := make([]collector, 0, len(registry.collectors))
+	for _, c := range registry.collectors {
+		collectors = append(collectors, c)
+	}
+	registry.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	counter := &countingWriter{w: w}
+	for _, c := range collectors {
+		if err := c.write(counter); err != nil {
+			return counter.written, err
+		}
+	}
+	return counter.written, nil
+}
+
+// Handler returns an HTTP handler serving the registered metrics in the text exposition format.
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		registry.WriteTo(w)
+	})
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	metricName string
+	help       string
+	value      atomic.Int64
+}
+
+// NewCounter creates a counter and registers it in the registry.
+func (registry *Registry) NewCounter(name, help string) *Counter {
+	counter := &Counter{metricName: name, help: help}
+	registry.register(counter)
+	return counter
+}
+
+// Inc increments the counter by one.
+func (counter *Counter) Inc() {
+	counter.value.Add(1)
+}
+
+// Value returns the current value of the counter.
+func (counter *Counter) Value() int64 {
+	return counter.value.Load()
+}
+
+func (counter *Counter) name() string {
+	return counter.metricName
+}
+
+func (counter *Counter) write(w io.Writer) error {
+	if err := writeHeader(w, counter.metricName, counter.help, "counter"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %d\n", counter.metricName, counter.Value())
+	return err
+}
+
+// CounterVec is a family of counters partitioned by the value of a single label.
+// The label values are fixed when the family is created, so that every series is exported,
+// with a zero value until first incremented, and alerts on rates never see a missing series.
+type CounterVec struct {
+	metricName string
+	help       string
+	label      string
+	values     map[string]*atomic.Int64
+}
+
+// NewCounterVec creates a counter family with the given label and its allowed values and registers it in the registry.
+func (registry *Registry) NewCounterVec(name, help, label string, values ...string) *CounterVec {
+	vec := &CounterVec{metricName: name, help: help, label: label, values: make(map[string]*atomic.Int64, len(values))}
+	for _, value := range values {
+		vec.values[value] = &atomic.Int64{}
+	}
+	registry.register(vec)
+	return vec
+}
+
+// Inc increments the counter with the label value by one. Values the family was not created with are ignored.
+func (vec *CounterVec) Inc(value string) {
+	if counter, ok := vec.values[value]; ok {
+		counter.Add(1)
+	}
+}
+
+// Value returns the current value of the counter with the label value.
+func (vec *CounterVec) Value(value string) int64 {
+	if counter, ok := vec.values[value]; ok {
+		return counter.Load()
+	}
+	return 0
+}
+
+func (vec *CounterVec) name() string {
+	return vec.metricName
+}
+
+func (vec *CounterVec) write(w io.Writer) error {
+	if err := writeHeader(w, vec.metricName, vec.help, "counter"); err != nil {
+		return err
+	}
+
+	values := make([]string, 0, len(vec.values))
+	for value := range vec.values {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	for _, value := range values {
+		_, err := fmt.Fprintf(w, "%s{%s=%s} %d\n", vec.metricName, vec.label, strconv.Quote(value), vec.values[value].Load())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFunc is a value that can go up and down, computed by a function at scrape time.
+type GaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+// NewGaugeFunc creates a gauge reporting the value returned by fn and registers it in the registry.
+// fn is called on every scrape and must be safe for concurrent use.
+func (registry *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	gauge := &GaugeFunc{metricName: name, help: help, fn: fn}
+	registry.register(gauge)
+	return gauge
+}
+
+func (gauge *GaugeFunc) name() string {
+	return gauge.metricName
+}
+
+func (gauge *GaugeFunc) write(w io.Writer) error {
+	if err := writeHeader(w, gauge.metricName, gauge.help, "gauge"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", gauge.metricName, strconv.FormatFloat(gauge.fn(), 'g', -1, 64))
+	return err
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name, help, metricType string) error {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	return err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (writer *countingWriter) Write(p []byte) (int, error) {
+	n, err := writer.w.Write(p)
+	writer.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("test_requests_total", "Number of requests.")
+	outcomes := registry.NewCounterVec("test_outcomes_total", "Number of outcomes\nby kind.", "outcome", "ok", "failed")
+	gauge := 2.5
+	registry.NewGaugeFunc("test_level", "Current level.", func() float64 { return gauge })
+
+	requests.Inc()
+	requests.Inc()
+	outcomes.Inc("failed")
+	outcomes.Inc("unknown")
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		registry.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+		body, err := io.ReadAll(rec.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	expected := "# HELP test_level Current level.\n" +
+		"# TYPE test_level gauge\n" +
+		"test_level 2.5\n" +
+		"# HELP test_outcomes_total Number of outcomes\\nby kind.\n" +
+		"# TYPE test_outcomes_total counter\n" +
+		"test_outcomes_total{outcome=\"failed\"} 1\n" +
+		"test_outcomes_total{outcome=\"ok\"} 0\n" +
+		"# HELP test_requests_total Number of requests.\n" +
+		"# TYPE test_requests_total counter\n" +
+		"test_requests_total 2\n"
+	assert.Equal(t, expected, scrape())
+	assert.Equal(t, int64(0), outcomes.Value("unknown"), "label values outside the family must be ignored")
+
+	gauge = math.NaN()
+	assert.Contains(t, scrape(), "test_level NaN\n")
+}
@@ -0,0 +1,9 @@
+package metrics
+
+// StorageUnavailable counts database operations that failed because the database could not be reached
+// or the connection to it was lost, as opposed to queries rejected by the database.
+var StorageUnavailable = Default.NewCounter("merch_store_storage_unavailable_total", "Number of database operations that failed because the database was unreachable.")
+
+// PrimaryForcedReads counts the reads sent to the primary rather than the read replica because the user changed
+// their data moments before, and the replica may not have caught up yet.
+var PrimaryForcedReads = Default.NewCounter("merch_store_storage_primary_forced_reads_total", "Number of reads sent to the primary instead of the replica to let users read their own writes.")
@@ -0,0 +1,233 @@
+// Package ratelimit throttles requests per client IP address with token buckets, for endpoints such as sign-in
+// that are called before the client is authenticated. The client address is taken from the connection or, behind
+// trusted proxies, from X-Forwarded-For. IPv6 clients are limited per /64 network, which a single host can
+// otherwise rotate addresses within at will.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/apiversion"
+	"merch_store/internal/pkg/clock"
+)
+
+// ipv6PrefixBits is the length of the IPv6 prefix sharing a bucket.
+const ipv6PrefixBits = 64
+
+// bucket holds the tokens of a client as of updatedAt; a request takes one token.
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// IPLimiter allows each client up to burst requests at once, refilled at perMinute requests per minute.
+// Buckets that have refilled completely are removed lazily, as they are no different from new ones.
+// It is safe for concurrent use.
+type IPLimiter struct {
+	rate           float64 // Tokens added per second.
+	burst          float64
+	trustedProxies []*net.IPNet
+	clock          clock.Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+// NewIPLimiter creates an IPLimiter allowing perMinute requests per minute with bursts of up to burst requests
+// per client; both must be positive. Requests coming from trustedProxies are attributed to the client named in
+// X-Forwarded-For.
+func NewIPLimiter(perMinute int, burst int, trustedProxies []*net.IPNet, c clock.Clock) *IPLimiter {
+	return &IPLimiter{
+		rate:           float64(perMinute) / 60,
+		burst:          float64(burst),
+		trustedProxies: trustedProxies,
+		clock:          c,
+		buckets:        make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty it returns false together with how long
+// it takes for the next token to be added.
+func (limiter *IPLimiter) Allow(key string) (bool, time.Duration) {
+	status := limiter.take(key)
+	return status.allowed, status.retryAfter
+}
+
+// bucketStatus is the outcome of taking a token from a bucket: whether a token was taken, the tokens left,
+// how long it takes for the next token to be added when none was, and how long until the bucket is full again.
+type bucketStatus struct {
+	allowed    bool
+	tokens     float64
+	retryAfter time.Duration
+	resetAfter time.Duration
+}
+
+// take takes a token from the bucket of key, as Allow does, and reports the state of the bucket after it.
+func (limiter *IPLimiter) take(key string) bucketStatus {
+	now := limiter.clock.Now()
+	refillTime := limiter.timeToAdd(limiter.burst)
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if !now.Before(limiter.nextSweep) {
+		for key, bucket := range limiter.buckets {
+			if now.Sub(bucket.updatedAt) >= refillTime {
+				delete(limiter.buckets, key)
+			}
+		}
+		limiter.nextSweep = now.Add(refillTime)
+	}
+
+	current, ok := limiter.buckets[key]
+	if !ok {
+		current = &bucket{tokens: limiter.burst, updatedAt: now}
+		limiter.buckets[key] = current
+	}
+	if elapsed := now.Sub(current.updatedAt); elapsed > 0 {
+		current.tokens = math.Min(limiter.burst, current.tokens+elapsed.Seconds()*limiter.rate)
+		current.updatedAt = now
+	}
+
+	status := bucketStatus{allowed: current.tokens >= 1}
+	if status.allowed {
+		current.tokens--
+	} else {
+		status.retryAfter = limiter.timeToAdd(1 - current.tokens)
+	}
+	status.tokens = current.tokens
+	status.resetAfter = limiter.timeToAdd(limiter.burst - current.tokens)
+	return status
+}
+
+// timeToAdd returns how long it takes for the given number of tokens to be added to a bucket.
+func (limiter *IPLimiter) timeToAdd(tokens float64) time.Duration {
+	return time.Duration(tokens / limiter.rate * float64(time.Second))
+}
+
+// ClientIP returns the address of the client that sent the request, as the package-level ClientIP does with the
+// trusted proxies of the limiter.
+func (limiter *IPLimiter) ClientIP(req *http.Request) net.IP {
+	return ClientIP(req, limiter.trustedProxies)
+}
+
+// ClientIP returns the address of the client that sent the request. When the connection comes from one of
+// trustedProxies, X-Forwarded-For is read from the right, skipping trusted proxies, and the first other address is
+// the client; addresses further left could have been forged by the client. It returns nil when RemoteAddr holds no
+// IP address.
+func ClientIP(req *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+// isTrustedProxy reports whether ip belongs to one of trustedProxies.
+func isTrustedProxy(ip net.IP, trustedProxies []*net.IPNet) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the bucket key of a client address: the address itself for IPv4, and its /64 network for IPv6.
+func Key(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.Mask(net.CIDRMask(ipv6PrefixBits, 8*net.IPv6len)).String() + "/" + strconv.Itoa(ipv6PrefixBits)
+}
+
+// Middleware returns an HTTP middleware answering requests of clients that have run out of tokens with
+// 429 Too Many Requests, a JSON error, and a Retry-After hint in whole seconds. Every response it passes on or
+// answers reports the limit in X-RateLimit-Limit, the requests left in X-RateLimit-Remaining, and in
+// X-RateLimit-Reset the whole seconds until the client may send a full burst again.
+func (limiter *IPLimiter) Middleware() func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.RemoteAddr
+			if ip := limiter.ClientIP(r); ip != nil {
+				key = Key(ip)
+			}
+
+			status := limiter.take(key)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(int(limiter.burst)))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Floor(status.tokens))))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(status.resetAfter.Seconds()))))
+			if !status.allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(status.retryAfter.Seconds()))))
+				apiversion.WriteError(w, r.Context(), "too many requests, try again later", models.ErrCodeRateLimited, http.StatusTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// ParseTrustedProxies parses a comma-separated list of trusted proxies in the format of ParseNetworks.
+// An empty list trusts no proxy.
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	return ParseNetworks(value)
+}
+
+// ParseNetworks parses a comma-separated list of IP addresses and CIDR networks, such as "10.0.0.0/8,192.0.2.1".
+// Single addresses stand for themselves.
+func ParseNetworks(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("ratelimit: invalid network %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
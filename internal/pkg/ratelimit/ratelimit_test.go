@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/pkg/clock"
+)
+
+func TestIPLimiter_Allow(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewIPLimiter(60, 3, nil, fakeClock)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("192.0.2.1")
+		require.True(t, ok, "request %d is within the burst", i)
+	}
+	ok, retryAfter := limiter.Allow("192.0.2.1")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retryAfter)
+
+	ok, _ = limiter.Allow("192.0.2.2")
+	assert.True(t, ok, "other clients have buckets of their own")
+
+	fakeClock.Advance(time.Second)
+	ok, _ = limiter.Allow("192.0.2.1")
+	assert.True(t, ok, "a token is added every second")
+	ok, _ = limiter.Allow("192.0.2.1")
+	assert.False(t, ok)
+
+	fakeClock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ = limiter.Allow("192.0.2.1")
+		require.True(t, ok, "a bucket refills up to the burst only")
+	}
+	ok, _ = limiter.Allow("192.0.2.1")
+	assert.False(t, ok)
+	assert.Len(t, limiter.buckets, 1, "buckets refilled completely must be removed")
+}
+
+func TestIPLimiter_ClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	require.NoError(t, err)
+	limiter := NewIPLimiter(60, 3, trusted, clock.NewFake(time.Now()))
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIP   string
+	}{
+		{name: "Direct", remoteAddr: "203.0.113.7:5000", expectedIP: "203.0.113.7"},
+		{name: "Untrusted proxy", remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, expectedIP: "203.0.113.7"},
+		{name: "Trusted proxy", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1"}, expectedIP: "198.51.100.1"},
+		{name: "Chain of trusted proxies", remoteAddr: "192.0.2.10:5000", forwardedFor: []string{"198.51.100.1, 10.0.0.5", "10.0.0.6"}, expectedIP: "198.51.100.1"},
+		{name: "Forged hop", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"1.1.1.1, 198.51.100.1"}, expectedIP: "198.51.100.1"},
+		{name: "Only trusted hops", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"10.0.0.5"}, expectedIP: "10.0.0.5"},
+		{name: "Invalid hop", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1, garbage"}, expectedIP: "10.1.2.3"},
+		{name: "Without header", remoteAddr: "10.1.2.3:5000", expectedIP: "10.1.2.3"},
+		{name: "IPv6", remoteAddr: "[2001:db8::1]:5000", expectedIP: "2001:db8::1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/auth", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, value := range tc.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tc.expectedIP, limiter.ClientIP(req).String())
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "192.0.2.1", Key(net.ParseIP("192.0.2.1")))
+	assert.Equal(t, "192.0.2.1", Key(net.ParseIP("::ffff:192.0.2.1")), "IPv4-mapped addresses are IPv4 clients")
+	assert.Equal(t, "2001:db8:1:2::/64", Key(net.ParseIP("2001:db8:1:2:aaaa::1")))
+	assert.Equal(t, Key(net.ParseIP("2001:db8:1:2::1")), Key(net.ParseIP("2001:db8:1:2:ffff:ffff:ffff:ffff")), "a /64 shares one bucket")
+	assert.NotEqual(t, Key(net.ParseIP("2001:db8:1:2::1")), Key(net.ParseIP("2001:db8:1:3::1")))
+}
+
+func TestIPLimiter_Middleware(t *testing.T) {
+	limiter := NewIPLimiter(30, 1, nil, clock.NewFake(time.Now()))
+	handler := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve("[2001:db8::1]:5000").Code)
+	rec := serve("[2001:db8::2]:5000")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "addresses of the same /64 share a bucket")
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"errors\":\"too many requests, try again later\",\"code\":\"RATE_LIMITED\"}\n", rec.Body.String())
+
+	assert.Equal(t, http.StatusNoContent, serve("[2001:db8:0:1::1]:5000").Code)
+}
+
+func TestIPLimiter_MiddlewareHeaders(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewIPLimiter(60, 3, nil, fakeClock)
+	handler := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth", nil)
+		req.RemoteAddr = "192.0.2.1:5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		expectedCode      int
+		expectedRemaining string
+		expectedReset     string
+	}{
+		{expectedCode: http.StatusNoContent, expectedRemaining: "2", expectedReset: "1"},
+		{expectedCode: http.StatusNoContent, expectedRemaining: "1", expectedReset: "2"},
+		{expectedCode: http.StatusNoContent, expectedRemaining: "0", expectedReset: "3"},
+		{expectedCode: http.StatusTooManyRequests, expectedRemaining: "0", expectedReset: "3"},
+	}
+	for i, test := range tests {
+		rec := serve()
+		require.Equal(t, test.expectedCode, rec.Code, "request %d", i)
+		assert.Equal(t, "3", rec.Header().Get("X-RateLimit-Limit"), "request %d", i)
+		assert.Equal(t, test.expectedRemaining, rec.Header().Get("X-RateLimit-Remaining"), "request %d", i)
+		assert.Equal(t, test.expectedReset, rec.Header().Get("X-RateLimit-Reset"), "request %d", i)
+	}
+
+	fakeClock.Advance(1500 * time.Millisecond)
+	rec := serve()
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"), "partial tokens are not reported")
+	assert.Equal(t, "3", rec.Header().Get("X-RateLimit-Reset"), "the reset is rounded up to whole seconds")
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := ParseTrustedProxies("")
+	require.NoError(t, err)
+	assert.Empty(t, networks)
+
+	networks, err = ParseTrustedProxies("10.0.0.0/8, 192.0.2.1,2001:db8::/32,::1")
+	require.NoError(t, err)
+	require.Len(t, networks, 4)
+	assert.Equal(t, "192.0.2.1/32", networks[1].String())
+	assert.Equal(t, "::1/128", networks[3].String())
+
+	networks, err = ParseTrustedProxies("192.0.2.1,")
+	require.NoError(t, err, "empty entries are skipped")
+	assert.Len(t, networks, 1)
+
+	for _, value := range []string{"proxy", "10.0.0.0/33", "192.0.2.1/"} {
+		_, err = ParseTrustedProxies(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -1,9 +1,13 @@
-// Package security provides functionality for handling password hashing and verification.
+// Package security provides functionality for generating, hashing, and verifying passwords.
 // It leverages the bcrypt algorithm to securely hash passwords and compare hashed values.
 package security
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"log"
+	"runtime"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -28,3 +32,41 @@ func CheckPassword(hashedPassword, userPassword string) error {
 	err := bcrypt.CompareHashAndPassword(hashedPasswordBytes, userPasswordBytes)
 	return err
 }
+
+// generatedPasswordBytes is the number of random bytes in a generated password.
+const generatedPasswordBytes = 12
+
+// GeneratePassword returns a random password of 16 URL-safe characters.
+func GeneratePassword() (string, error) {
+	password := make([]byte, generatedPasswordBytes)
+	if _, err := rand.Read(password); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(password), nil
+}
+
+// HashPasswords returns the bcrypt hashes of the passwords, in the same order, hashing them in parallel
+// on all available CPUs since bcrypt is deliberately slow.
+func HashPasswords(passwords []string) []string {
+	hashes := make([]string, len(passwords))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for workers := min(runtime.GOMAXPROCS(0), len(passwords)); workers > 0; workers-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				hashes[i] = HashPassword(passwords[i])
+			}
+		}()
+	}
+
+	for i := range passwords {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return hashes
+}
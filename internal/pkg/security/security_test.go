@@ -0,0 +1,61 @@
+package security
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// urlSafePassword matches the 16 characters of the unpadded URL-safe base64 encoding of 12 random bytes.
+var urlSafePassword = regexp.MustCompile(`^[A-Za-z0-9_-]{16}$`)
+
+func TestGeneratePassword(t *testing.T) {
+	t.Run("Length and charset", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			password, err := GeneratePassword()
+			require.NoError(t, err)
+			assert.Regexp(t, urlSafePassword, password)
+		}
+	})
+
+	t.Run("Unique", func(t *testing.T) {
+		passwords := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			password, err := GeneratePassword()
+			require.NoError(t, err)
+			require.False(t, passwords[password], "password %q generated twice", password)
+			passwords[password] = true
+		}
+	})
+}
+
+func TestHashPasswords(t *testing.T) {
+	t.Run("Hashes in order", func(t *testing.T) {
+		passwords := make([]string, 8)
+		for i := range passwords {
+			passwords[i] = fmt.Sprintf("password-%d", i)
+		}
+
+		hashes := HashPasswords(passwords)
+		require.Len(t, hashes, len(passwords))
+		for i, hash := range hashes {
+			assert.NoError(t, CheckPassword(hash, passwords[i]), "hash %d must verify its own password", i)
+			assert.Error(t, CheckPassword(hash, passwords[(i+1)%len(passwords)]), "hash %d must not verify another password", i)
+		}
+	})
+
+	t.Run("Empty input", func(t *testing.T) {
+		assert.Empty(t, HashPasswords(nil))
+		assert.Empty(t, HashPasswords([]string{}))
+	})
+
+	t.Run("Single password", func(t *testing.T) {
+		hashes := HashPasswords([]string{"secret"})
+		require.Len(t, hashes, 1)
+		assert.NoError(t, CheckPassword(hashes[0], "secret"))
+		assert.Error(t, CheckPassword(hashes[0], "other"))
+	})
+}
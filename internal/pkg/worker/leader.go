@@ -0,0 +1,113 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotElected indicates that another instance of the service holds the leadership.
+var ErrNotElected = errors.New("worker: another instance is the leader")
+
+// Lease is the leadership of this instance among the replicas of the service.
+type Lease interface {
+	// Lost returns a channel that is closed once the leadership ends, because it was released or because
+	// the instance could no longer prove it holds it, such as when its database connection broke.
+	Lost() <-chan struct{}
+	// Release gives up the leadership.
+	Release()
+}
+
+// Elector elects one instance among the replicas of the service to run the singleton workers.
+type Elector interface {
+	// TryAcquire returns the leadership of this instance without waiting for it, or ErrNotElected when another
+	// instance holds it.
+	TryAcquire(ctx context.Context) (Lease, error)
+}
+
+// SetElector makes the singleton workers run only on the instance elected by elector. An instance that is not
+// the leader asks again every interval, so it takes over within about an interval of the leader stepping down.
+// Without an elector, singleton workers run on every instance like any other worker. It must be called before Start.
+func (manager *Manager) SetElector(elector Elector, interval time.Duration) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.elector = elector
+	manager.electionInterval = interval
+}
+
+// RegisterSingleton adds a named worker that must run on a single instance of the service at a time, such as
+// a job moving coins on a schedule. With an elector set, it runs only while this instance is the leader: it is
+// started on election and its context is canceled as soon as the leadership is lost, and started again on the
+// next election. Workers must be registered before Start.
+func (manager *Manager) RegisterSingleton(name string, w Worker) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.started {
+		manager.log.Sugar().Errorf("Worker %s registered after start, ignoring", name)
+		return
+	}
+
+	manager.singletons = append(manager.singletons, &namedWorker{name: name, worker: w})
+}
+
+// lead runs for as long as ctx, taking the leadership whenever it is free and running the singleton workers while
+// it is held. The leadership is released once they have returned, including on shutdown, so that another instance
+// takes over without waiting for this one's session to time out.
+func (manager *Manager) lead(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		lease, err := manager.elector.TryAcquire(ctx)
+		switch {
+		case err == nil:
+			manager.log.Info("Elected leader, starting singleton workers")
+			manager.runSingletons(ctx, lease)
+			lease.Release()
+			if ctx.Err() == nil {
+				manager.log.Warn("Leadership lost, singleton workers stopped")
+			}
+		case errors.Is(err, ErrNotElected):
+		case ctx.Err() == nil:
+			manager.log.Error("Leader election failed", zap.Error(err))
+		}
+
+		timer.Reset(manager.electionInterval)
+	}
+}
+
+// runSingletons runs every singleton worker until they have all returned, canceling their context once ctx is done
+// or the lease is lost.
+func (manager *Manager) runSingletons(ctx context.Context, lease Lease) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-lease.Lost():
+			cancel()
+		case <-leaderCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, singleton := range manager.singletons {
+		wg.Add(1)
+		go func(w *namedWorker) {
+			defer wg.Done()
+			manager.run(leaderCtx, w)
+		}(&namedWorker{name: singleton.name, worker: singleton.worker, done: make(chan struct{})})
+	}
+	wg.Wait()
+}
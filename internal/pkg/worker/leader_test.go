@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeElector elects the first instance asking while no lease is held, like an advisory lock shared by
+// the instances of a database.
+type fakeElector struct {
+	mu     sync.Mutex
+	leader *fakeLease
+}
+
+// fakeLease is a lease of fakeElector.
+type fakeLease struct {
+	elector *fakeElector
+	once    sync.Once
+	lost    chan struct{}
+}
+
+// instance returns the Elector of one more instance sharing the election.
+func (elector *fakeElector) instance() Elector {
+	return electorFunc(func(ctx context.Context) (Lease, error) {
+		elector.mu.Lock()
+		defer elector.mu.Unlock()
+
+		if elector.leader != nil {
+			return nil, ErrNotElected
+		}
+		elector.leader = &fakeLease{elector: elector, lost: make(chan struct{})}
+		return elector.leader, nil
+	})
+}
+
+// lose ends the current lease as a broken connection would, without its holder releasing it.
+func (elector *fakeElector) lose() {
+	elector.mu.Lock()
+	lease := elector.leader
+	elector.mu.Unlock()
+
+	if lease != nil {
+		lease.end()
+	}
+}
+
+func (lease *fakeLease) end() {
+	lease.once.Do(func() {
+		lease.elector.mu.Lock()
+		if lease.elector.leader == lease {
+			lease.elector.leader = nil
+		}
+		lease.elector.mu.Unlock()
+		close(lease.lost)
+	})
+}
+
+func (lease *fakeLease) Lost() <-chan struct{} { return lease.lost }
+func (lease *fakeLease) Release()              { lease.end() }
+
+// electorFunc adapts a function to the Elector interface.
+type electorFunc func(ctx context.Context) (Lease, error)
+
+func (f electorFunc) TryAcquire(ctx context.Context) (Lease, error) { return f(ctx) }
+
+// instance is a Manager of one of several in-process instances of the service, counting the runs of its workers.
+type instance struct {
+	manager   *Manager
+	running   atomic.Int32 // Number of currently running singletons.
+	starts    atomic.Int32 // Number of times the singleton was started.
+	perWorker atomic.Int32 // Number of currently running per-instance workers.
+}
+
+func newInstance(elector Elector) *instance {
+	i := &instance{manager: newTestManager(time.Second)}
+	if elector != nil {
+		i.manager.SetElector(elector, 10*time.Millisecond)
+	}
+	i.manager.Register("per-instance", Func(func(ctx context.Context) error {
+		i.perWorker.Add(1)
+		defer i.perWorker.Add(-1)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	i.manager.RegisterSingleton("singleton", Func(func(ctx context.Context) error {
+		i.running.Add(1)
+		defer i.running.Add(-1)
+		i.starts.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	return i
+}
+
+func TestManager_SingletonRunsOnLeaderOnly(t *testing.T) {
+	elector := &fakeElector{}
+	first, second := newInstance(elector.instance()), newInstance(elector.instance())
+
+	first.manager.Start(context.Background())
+	require.Eventually(t, func() bool { return first.running.Load() == 1 }, time.Second, time.Millisecond)
+	second.manager.Start(context.Background())
+	defer second.manager.Stop()
+
+	require.Eventually(t, func() bool { return second.perWorker.Load() == 1 }, time.Second, time.Millisecond,
+		"per-instance workers must run on every instance")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), first.running.Load())
+	assert.Zero(t, second.running.Load(), "the singleton must not run on a follower")
+
+	require.NoError(t, first.manager.Stop())
+	assert.Zero(t, first.running.Load())
+	assert.Eventually(t, func() bool { return second.running.Load() == 1 }, time.Second, time.Millisecond,
+		"the follower must take over once the leader stops")
+}
+
+func TestManager_SingletonStopsOnLostLease(t *testing.T) {
+	elector := &fakeElector{}
+	leader := newInstance(elector.instance())
+	leader.manager.Start(context.Background())
+	defer leader.manager.Stop()
+	require.Eventually(t, func() bool { return leader.running.Load() == 1 }, time.Second, time.Millisecond)
+
+	elector.mu.Lock()
+	lease := elector.leader
+	elector.mu.Unlock()
+
+	elector.lose()
+	require.Eventually(t, func() bool { return leader.starts.Load() == 2 }, time.Second, time.Millisecond,
+		"the singleton must be stopped as soon as the lease is lost and started again on the next election")
+	assert.Equal(t, int32(1), leader.running.Load())
+	assert.Equal(t, int32(1), leader.perWorker.Load(), "per-instance workers must keep running")
+	elector.mu.Lock()
+	assert.NotSame(t, lease, elector.leader)
+	elector.mu.Unlock()
+}
+
+func TestManager_SingletonWithoutElector(t *testing.T) {
+	first, second := newInstance(nil), newInstance(nil)
+	first.manager.Start(context.Background())
+	second.manager.Start(context.Background())
+
+	require.Eventually(t, func() bool { return first.running.Load() == 1 && second.running.Load() == 1 }, time.Second, time.Millisecond,
+		"without an elector singletons run on every instance")
+	require.NoError(t, first.manager.Stop())
+	require.NoError(t, second.manager.Stop())
+}
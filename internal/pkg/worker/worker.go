@@ -0,0 +1,183 @@
+// Package worker provides a manager for long-running background goroutines.
+// Workers are registered under a name, started together, and stopped together on shutdown:
+// the manager cancels their context and waits for each of them with a bounded timeout,
+// logging workers that fail to stop in time and isolating panics so that one misbehaving
+// worker cannot take down the others or the process. Singleton workers, which must run on a single instance
+// of a replicated service at a time, run only on the instance elected leader (see SetElector).
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"merch_store/internal/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// ErrStopTimeout indicates that a worker did not return within the stop timeout after its context was canceled.
+var ErrStopTimeout = errors.New("worker: stop timed out")
+
+// Worker is a long-running background task.
+// Run must return once ctx is canceled; the returned error is logged by the Manager.
+type Worker interface {
+	Run(ctx context.Context) error
+}
+
+// Func adapts an ordinary function to the Worker interface.
+type Func func(ctx context.Context) error
+
+// Run calls f(ctx).
+func (f Func) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// namedWorker pairs a registered worker with its name and completion state.
+type namedWorker struct {
+	name   string
+	worker Worker
+	done   chan struct{}
+	err    error
+}
+
+// Manager starts registered workers and stops them gracefully.
+type Manager struct {
+	log         *logger.Logger
+	stopTimeout time.Duration
+
+	mu      sync.Mutex
+	workers []*namedWorker
+	cancel  context.CancelFunc
+	started bool
+	done    chan struct{}
+
+	singletons       []*namedWorker // Workers run only on the leader, set by RegisterSingleton.
+	elector          Elector        // Optional election of the leader, set by SetElector.
+	electionInterval time.Duration  // How often an instance that is not the leader tries to become it.
+}
+
+// NewManager creates a Manager that waits up to stopTimeout for each worker on Stop.
+func NewManager(l *logger.Logger, stopTimeout time.Duration) *Manager {
+	return &Manager{log: l, stopTimeout: stopTimeout, done: make(chan struct{})}
+}
+
+// Register adds a named worker to the manager. Workers must be registered before Start.
+func (manager *Manager) Register(name string, w Worker) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.started {
+		manager.log.Sugar().Errorf("Worker %s registered after start, ignoring", name)
+		return
+	}
+
+	manager.workers = append(manager.workers, &namedWorker{name: name, worker: w, done: make(chan struct{})})
+}
+
+// Start runs every registered worker in its own goroutine with a context derived from ctx.
+// With an elector set, the singleton workers are run by an additional "leader-election" worker while this
+// instance is the leader; otherwise they are run like the other workers.
+func (manager *Manager) Start(ctx context.Context) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.started {
+		return
+	}
+	manager.started = true
+
+	switch {
+	case len(manager.singletons) == 0:
+	case manager.elector == nil:
+		for _, singleton := range manager.singletons {
+			manager.workers = append(manager.workers, &namedWorker{name: singleton.name, worker: singleton.worker, done: make(chan struct{})})
+		}
+	default:
+		manager.workers = append(manager.workers, &namedWorker{name: "leader-election", worker: Func(manager.lead), done: make(chan struct{})})
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	manager.cancel = cancel
+
+	var wg sync.WaitGroup
+	for _, w := range manager.workers {
+		wg.Add(1)
+		go func(w *namedWorker) {
+			defer wg.Done()
+			manager.run(workerCtx, w)
+		}(w)
+	}
+
+	go func() {
+		wg.Wait()
+		close(manager.done)
+	}()
+}
+
+// Done returns a channel that is closed once every started worker has returned.
+func (manager *Manager) Done() <-chan struct{} {
+	return manager.done
+}
+
+// Stop cancels the workers' context and waits for each worker up to the stop timeout.
+// Workers that do not return in time are logged and reported as ErrStopTimeout.
+// The returned error joins the errors returned by the workers, excluding context cancellation.
+func (manager *Manager) Stop() error {
+	manager.mu.Lock()
+	started := manager.started
+	cancel := manager.cancel
+	workers := manager.workers
+	manager.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+	cancel()
+
+	errs := make([]error, len(workers))
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		wg.Add(1)
+		go func(i int, w *namedWorker) {
+			defer wg.Done()
+
+			timer := time.NewTimer(manager.stopTimeout)
+			defer timer.Stop()
+
+			select {
+			case <-w.done:
+				if w.err != nil && !errors.Is(w.err, context.Canceled) {
+					errs[i] = fmt.Errorf("worker %s: %w", w.name, w.err)
+				}
+			case <-timer.C:
+				manager.log.Error("Worker did not stop in time", zap.String("worker", w.name), zap.Duration("timeout", manager.stopTimeout))
+				errs[i] = fmt.Errorf("worker %s: %w", w.name, ErrStopTimeout)
+			}
+		}(i, w)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// run executes a single worker, recovering from panics so they stay isolated to that worker.
+func (manager *Manager) run(ctx context.Context, w *namedWorker) {
+	defer close(w.done)
+	defer func() {
+		if r := recover(); r != nil {
+			manager.log.Error("Worker panicked", zap.String("worker", w.name), zap.Any("panic", r), zap.Stack("stack"))
+			w.err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	manager.log.Info("Worker started", zap.String("worker", w.name))
+	w.err = w.worker.Run(ctx)
+	if w.err != nil && !errors.Is(w.err, context.Canceled) {
+		manager.log.Error("Worker failed", zap.String("worker", w.name), zap.Error(w.err))
+		return
+	}
+	manager.log.Info("Worker stopped", zap.String("worker", w.name))
+}
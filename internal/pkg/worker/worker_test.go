@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/logger"
+)
+
+func newTestManager(stopTimeout time.Duration) *Manager {
+	return NewManager(&logger.Logger{Logger: zap.NewNop()}, stopTimeout)
+}
+
+func TestManager_CleanShutdown(t *testing.T) {
+	manager := newTestManager(time.Second)
+
+	var stopped atomic.Int32
+	for _, name := range []string{"first", "second"} {
+		manager.Register(name, Func(func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped.Add(1)
+			return ctx.Err()
+		}))
+	}
+
+	manager.Start(context.Background())
+	require.NoError(t, manager.Stop())
+	assert.Equal(t, int32(2), stopped.Load())
+
+	select {
+	case <-manager.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done channel should be closed after all workers returned")
+	}
+}
+
+func TestManager_WorkerIgnoresCancellation(t *testing.T) {
+	manager := newTestManager(50 * time.Millisecond)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	manager.Register("stubborn", Func(func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+	manager.Register("polite", Func(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}))
+
+	manager.Start(context.Background())
+
+	started := time.Now()
+	err := manager.Stop()
+	require.ErrorIs(t, err, ErrStopTimeout)
+	assert.Contains(t, err.Error(), "stubborn")
+	assert.NotContains(t, err.Error(), "polite")
+	assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestManager_PanicIsolation(t *testing.T) {
+	manager := newTestManager(time.Second)
+
+	var healthyRunning atomic.Bool
+	manager.Register("panicking", Func(func(ctx context.Context) error {
+		panic("boom")
+	}))
+	manager.Register("healthy", Func(func(ctx context.Context) error {
+		healthyRunning.Store(true)
+		<-ctx.Done()
+		return nil
+	}))
+
+	manager.Start(context.Background())
+
+	require.Eventually(t, healthyRunning.Load, time.Second, 10*time.Millisecond)
+
+	err := manager.Stop()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "worker panicking: panic: boom")
+	assert.NotContains(t, err.Error(), "healthy")
+}
+
+func TestManager_WorkerError(t *testing.T) {
+	manager := newTestManager(time.Second)
+
+	errFailed := errors.New("failed")
+	manager.Register("failing", Func(func(ctx context.Context) error {
+		return errFailed
+	}))
+
+	manager.Start(context.Background())
+
+	select {
+	case <-manager.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done channel should be closed after the worker returned")
+	}
+	require.ErrorIs(t, manager.Stop(), errFailed)
+}
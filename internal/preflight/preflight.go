@@ -0,0 +1,176 @@
+// Package preflight checks, before the merch store starts serving in production, that security-sensitive
+// settings were not left at their development defaults. Each check is independent and reports an error when it
+// fails; the severity table decides whether the failure stops the start or is only logged as a warning.
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"merch_store/internal/app"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+)
+
+// ProductionEnv is the value of APP_ENV under which the preflight checks run on start.
+const ProductionEnv = "production"
+
+// MinJWTSecretLength is the shortest JWT secret accepted in production, in bytes: the output size of the
+// HMAC-SHA256 signing the tokens.
+const MinJWTSecretLength = 32
+
+// Severity tells how the failure of a check is treated.
+type Severity int
+
+const (
+	Warning Severity = iota // The failure is logged and the service starts.
+	Fatal                   // The failure stops the start.
+)
+
+func (severity Severity) String() string {
+	if severity == Fatal {
+		return "fatal"
+	}
+	return "warning"
+}
+
+// Names of the checks.
+const (
+	CheckJWTSecret    = "jwt secret"
+	CheckRegistration = "registration"
+	CheckDatabaseRole = "database role"
+	CheckEncryption   = "encryption at rest"
+)
+
+// severities is the severity table of the checks. A check missing from it is fatal.
+var severities = map[string]Severity{
+	CheckJWTSecret:    Fatal,
+	CheckRegistration: Warning,
+	CheckDatabaseRole: Fatal,
+	CheckEncryption:   Warning,
+}
+
+// Predefined errors of failed checks.
+var (
+	// ErrDefaultJWTSecret indicates that tokens are signed with the built-in development secret, known to anyone
+	// who has read the source, so that anyone can forge them.
+	ErrDefaultJWTSecret = errors.New("preflight: JWT secret is the built-in default; set JWT_SECRET")
+	// ErrShortJWTSecret indicates that the JWT secret is shorter than MinJWTSecretLength bytes.
+	ErrShortJWTSecret = fmt.Errorf("preflight: JWT secret is shorter than %d bytes", MinJWTSecretLength)
+	// ErrOpenRegistration indicates that signing in with an unknown username creates an account.
+	ErrOpenRegistration = errors.New("preflight: registration is open, anyone can create an account; set REGISTRATION_MODE to invite or closed")
+	// ErrDatabaseSuperuser indicates that the service connects to the database as a superuser.
+	ErrDatabaseSuperuser = errors.New("preflight: the database role is a superuser")
+	// ErrEncryptionDisabled indicates that no encryption keys are configured, so that the client IPs of the API
+	// activity and the user agents of the sessions are stored in plaintext.
+	ErrEncryptionDisabled = errors.New("preflight: no encryption keys are configured, client IPs and user agents are stored in plaintext; set ENCRYPTION_KEYS")
+)
+
+// RoleChecker reports whether the database role of a storage is a superuser; storage.PostgreSQL implements it.
+type RoleChecker interface {
+	IsSuperuser(ctx context.Context) (bool, error)
+}
+
+// Config holds the settings checked by Run.
+type Config struct {
+	JWTSecret         string // Configured JWT secret, empty when the built-in auth.SECRETKEY is used.
+	RegistrationMode  app.RegistrationMode
+	EncryptionEnabled bool // Whether encryption keys for personal data are configured (see crypto.ParseKeys).
+}
+
+// Result is the outcome of a single check. Err is nil when the check passed.
+type Result struct {
+	Name     string
+	Severity Severity
+	Err      error
+}
+
+// Report is the outcome of a preflight run, one entry per check in the order they ran.
+type Report struct {
+	Results []Result
+}
+
+// Fatal reports whether a check of Fatal severity failed, in which case the service must not start.
+func (report *Report) Fatal() bool {
+	for _, result := range report.Results {
+		if result.Err != nil && result.Severity == Fatal {
+			return true
+		}
+	}
+	return false
+}
+
+// Log logs every failed check, as an error when it is fatal and as a warning otherwise.
+func (report *Report) Log(l *logger.Logger) {
+	for _, result := range report.Results {
+		switch {
+		case result.Err == nil:
+			l.Sugar().Infof("Preflight check %q passed", result.Name)
+		case result.Severity == Fatal:
+			l.Sugar().Errorf("Preflight check %q failed: %s", result.Name, result.Err)
+		default:
+			l.Sugar().Warnf("PREFLIGHT WARNING: check %q failed, starting anyway: %s", result.Name, result.Err)
+		}
+	}
+}
+
+// Run runs every check against the configuration and the database role of db and returns their results.
+// Every check runs, whether or not an earlier one failed, so that all problems are reported at once.
+func Run(ctx context.Context, config Config, db RoleChecker) *Report {
+	report := &Report{}
+	report.add(CheckJWTSecret, checkJWTSecret(config.JWTSecret))
+	report.add(CheckRegistration, checkRegistration(config.RegistrationMode))
+	report.add(CheckDatabaseRole, checkDatabaseRole(ctx, db))
+	report.add(CheckEncryption, checkEncryption(config.EncryptionEnabled))
+	return report
+}
+
+// add records the result of the named check with its severity from the table.
+func (report *Report) add(name string, err error) {
+	severity, ok := severities[name]
+	if !ok {
+		severity = Fatal
+	}
+	report.Results = append(report.Results, Result{Name: name, Severity: severity, Err: err})
+}
+
+// checkJWTSecret fails for the built-in secret, used when none is configured, and for secrets shorter than
+// MinJWTSecretLength bytes.
+func checkJWTSecret(secret string) error {
+	if secret == "" || secret == auth.SECRETKEY {
+		return ErrDefaultJWTSecret
+	}
+	if len(secret) < MinJWTSecretLength {
+		return ErrShortJWTSecret
+	}
+	return nil
+}
+
+// checkRegistration fails when registration is open.
+func checkRegistration(mode app.RegistrationMode) error {
+	if mode == app.RegistrationOpen {
+		return ErrOpenRegistration
+	}
+	return nil
+}
+
+// checkDatabaseRole fails when the database role is a superuser, or when its attributes cannot be read.
+func checkDatabaseRole(ctx context.Context, db RoleChecker) error {
+	superuser, err := db.IsSuperuser(ctx)
+	if err != nil {
+		return fmt.Errorf("preflight: reading the attributes of the database role: %w", err)
+	}
+	if superuser {
+		return ErrDatabaseSuperuser
+	}
+	return nil
+}
+
+// checkEncryption fails when no encryption keys are configured.
+func checkEncryption(enabled bool) error {
+	if !enabled {
+		return ErrEncryptionDisabled
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"merch_store/internal/app"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+)
+
+// fakeRoleChecker reports the configured role attributes.
+type fakeRoleChecker struct {
+	superuser bool
+	err       error
+}
+
+func (checker fakeRoleChecker) IsSuperuser(context.Context) (bool, error) {
+	return checker.superuser, checker.err
+}
+
+var strongSecret = strings.Repeat("s", MinJWTSecretLength)
+
+func TestCheckJWTSecret(t *testing.T) {
+	testCases := []struct {
+		name   string
+		secret string
+		err    error
+	}{
+		{name: "Unset", secret: "", err: ErrDefaultJWTSecret},
+		{name: "Built-in default", secret: auth.SECRETKEY, err: ErrDefaultJWTSecret},
+		{name: "Short", secret: strings.Repeat("s", MinJWTSecretLength-1), err: ErrShortJWTSecret},
+		{name: "Strong", secret: strongSecret},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, checkJWTSecret(tc.secret), tc.err)
+		})
+	}
+}
+
+func TestCheckRegistration(t *testing.T) {
+	assert.ErrorIs(t, checkRegistration(app.RegistrationOpen), ErrOpenRegistration)
+	assert.NoError(t, checkRegistration(app.RegistrationInvite))
+	assert.NoError(t, checkRegistration(app.RegistrationClosed))
+}
+
+func TestCheckDatabaseRole(t *testing.T) {
+	ctx := context.Background()
+
+	assert.ErrorIs(t, checkDatabaseRole(ctx, fakeRoleChecker{superuser: true}), ErrDatabaseSuperuser)
+	assert.NoError(t, checkDatabaseRole(ctx, fakeRoleChecker{}))
+
+	errQuery := errors.New("connection reset")
+	assert.ErrorIs(t, checkDatabaseRole(ctx, fakeRoleChecker{err: errQuery}), errQuery,
+		"a role whose attributes cannot be read is not known to be safe")
+}
+
+func TestCheckEncryption(t *testing.T) {
+	assert.ErrorIs(t, checkEncryption(false), ErrEncryptionDisabled)
+	assert.NoError(t, checkEncryption(true))
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	safe := Config{JWTSecret: strongSecret, RegistrationMode: app.RegistrationInvite, EncryptionEnabled: true}
+
+	t.Run("Passed", func(t *testing.T) {
+		report := Run(ctx, safe, fakeRoleChecker{})
+		require.Len(t, report.Results, 4)
+		for _, result := range report.Results {
+			assert.NoError(t, result.Err, result.Name)
+		}
+		assert.False(t, report.Fatal())
+	})
+
+	t.Run("Warnings do not stop the start", func(t *testing.T) {
+		config := safe
+		config.RegistrationMode = app.RegistrationOpen
+		config.EncryptionEnabled = false
+
+		report := Run(ctx, config, fakeRoleChecker{})
+		assert.False(t, report.Fatal())
+		assert.Equal(t, Result{Name: CheckEncryption, Severity: Warning, Err: ErrEncryptionDisabled}, report.Results[3])
+		assert.Equal(t, Result{Name: CheckRegistration, Severity: Warning, Err: ErrOpenRegistration}, report.Results[1])
+	})
+
+	t.Run("Fatal failures stop the start", func(t *testing.T) {
+		report := Run(ctx, Config{RegistrationMode: app.RegistrationOpen}, fakeRoleChecker{superuser: true})
+		assert.True(t, report.Fatal())
+		assert.Equal(t, []Result{
+			{Name: CheckJWTSecret, Severity: Fatal, Err: ErrDefaultJWTSecret},
+			{Name: CheckRegistration, Severity: Warning, Err: ErrOpenRegistration},
+			{Name: CheckDatabaseRole, Severity: Fatal, Err: ErrDatabaseSuperuser},
+			{Name: CheckEncryption, Severity: Warning, Err: ErrEncryptionDisabled},
+		}, report.Results, "every check runs, whatever failed before")
+
+		report = Run(ctx, safe, fakeRoleChecker{superuser: true})
+		assert.True(t, report.Fatal(), "a superuser role alone stops the start")
+	})
+
+	t.Run("Log", func(t *testing.T) {
+		core, logs := observer.New(zapcore.InfoLevel)
+		report := Run(ctx, Config{RegistrationMode: app.RegistrationOpen}, fakeRoleChecker{})
+		report.Log(&logger.Logger{Logger: zap.New(core)})
+
+		entries := logs.AllUntimed()
+		require.Len(t, entries, 4)
+		assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+		assert.Contains(t, entries[0].Message, ErrDefaultJWTSecret.Error())
+		assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+		assert.Contains(t, entries[1].Message, ErrOpenRegistration.Error())
+		assert.Equal(t, zapcore.InfoLevel, entries[2].Level)
+		assert.Equal(t, zapcore.WarnLevel, entries[3].Level)
+		assert.Contains(t, entries[3].Message, ErrEncryptionDisabled.Error())
+	})
+}
+
+func TestSeverities(t *testing.T) {
+	for _, name := range []string{CheckJWTSecret, CheckRegistration, CheckDatabaseRole, CheckEncryption} {
+		_, ok := severities[name]
+		assert.True(t, ok, "check %q must be classified in the severity table", name)
+	}
+}
@@ -0,0 +1,245 @@
+// Package selftest verifies the critical paths of the merch store against a live database.
+// It drives the application layer directly, without going over HTTP: it registers throwaway users,
+// issues and parses a token, makes a purchase and a coin transfer in rolled-back transactions,
+// fetches the account information, and checks that the balances are consistent.
+// The throwaway users are deleted once the checks finish, so a successful run leaves no trace in the database.
+package selftest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// transferAmount is the number of coins the self-test sends between its throwaway users.
+const transferAmount = 1
+
+// Predefined errors for failed self-test checks.
+var (
+	// ErrInvariantViolated indicates that a step succeeded but left the account in an unexpected state.
+	ErrInvariantViolated = errors.New("selftest: invariant violated")
+	// ErrNoAffordableItem indicates that the catalog has no item a new user can afford.
+	ErrNoAffordableItem = errors.New("selftest: no affordable item in the catalog")
+	// errSkipped marks steps that were not run because an earlier step failed.
+	errSkipped = errors.New("selftest: skipped after an earlier failure")
+)
+
+// Step is the outcome of a single self-test step.
+type Step struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// Skipped reports whether the step was not run because an earlier step failed.
+func (step Step) Skipped() bool {
+	return errors.Is(step.Err, errSkipped)
+}
+
+// Report is the outcome of a self-test run, one entry per step in the order they ran.
+type Report struct {
+	Steps []Step
+}
+
+// Passed reports whether every step of the run succeeded.
+func (report *Report) Passed() bool {
+	for _, step := range report.Steps {
+		if step.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo writes a human-readable pass/fail line per step followed by the overall verdict.
+func (report *Report) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	write := func(format string, args ...any) error {
+		n, err := fmt.Fprintf(w, format, args...)
+		written += int64(n)
+		return err
+	}
+
+	for _, step := range report.Steps {
+		var err error
+		switch {
+		case step.Err == nil:
+			err = write("PASS  %-22s %s\n", step.Name, step.Duration.Round(time.Millisecond))
+		case step.Skipped():
+			err = write("SKIP  %s\n", step.Name)
+		default:
+			err = write("FAIL  %-22s %s: %s\n", step.Name, step.Duration.Round(time.Millisecond), step.Err)
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+
+	verdict := "passed"
+	if !report.Passed() {
+		verdict = "failed"
+	}
+	return written, write("selftest %s\n", verdict)
+}
+
+// stepRunner executes self-test steps in order, skipping the remaining ones after the first failure.
+type stepRunner struct {
+	report *Report
+	failed bool
+}
+
+// run executes fn as the named step unless an earlier step failed.
+func (runner *stepRunner) run(name string, fn func() error) {
+	if runner.failed {
+		runner.report.Steps = append(runner.report.Steps, Step{Name: name, Err: errSkipped})
+		return
+	}
+
+	started := time.Now()
+	err := fn()
+	runner.report.Steps = append(runner.report.Steps, Step{Name: name, Err: err, Duration: time.Since(started)})
+	runner.failed = err != nil
+}
+
+// always executes fn as the named step even when an earlier step failed, as cleanup must.
+func (runner *stepRunner) always(name string, fn func() error) {
+	failed := runner.failed
+	runner.failed = false
+	runner.run(name, fn)
+	runner.failed = runner.failed || failed
+}
+
+// Run executes the self-test against db and returns the report of its steps.
+// Purchases and transfers are made under storage.WithDryRun, so no balance is changed,
+// and the throwaway users are deleted at the end whether or not the checks passed.
+func Run(ctx context.Context, db storage.Storage, l *logger.Logger) *Report {
+	application := app.NewApp(db, l)
+	runner := &stepRunner{report: &Report{}}
+
+	var sender, recipient *models.User
+	var before *models.InfoResponse
+	var item models.CatalogItem
+
+	runner.run("register users", func() error {
+		var err error
+		if sender, err = register(ctx, application, "selftest_sender"); err != nil {
+			return err
+		}
+		recipient, err = register(ctx, application, "selftest_recipient")
+		return err
+	})
+
+	runner.run("fetch info", func() error {
+		var err error
+		before, err = application.ProcessInfo(ctx, sender.ID)
+		if err != nil {
+			return err
+		}
+		if before.Coins <= 0 || before.AvailableCoins != before.Coins {
+			return fmt.Errorf("%w: new user has %d coins, %d available", ErrInvariantViolated, before.Coins, before.AvailableCoins)
+		}
+		if len(before.Inventory) != 0 || len(before.CoinHistory.Sent) != 0 || len(before.CoinHistory.Received) != 0 {
+			return fmt.Errorf("%w: new user has history", ErrInvariantViolated)
+		}
+		return nil
+	})
+
+	runner.run("load catalog", func() error {
+		catalog, err := application.ProcessCatalog(ctx)
+		if err != nil {
+			return err
+		}
+		for _, candidate := range catalog {
+			if int64(candidate.Price) <= before.Coins && (item.Name == "" || candidate.Price < item.Price) {
+				item = candidate
+			}
+		}
+		if item.Name == "" {
+			return ErrNoAffordableItem
+		}
+		return nil
+	})
+
+	runner.run("buy (dry run)", func() error {
+		purchase, err := application.ProcessBuy(storage.WithDryRun(ctx), sender.ID, item.Name)
+		if err != nil {
+			return err
+		}
+		if !purchase.DryRun || purchase.Price != item.Price || purchase.RemainingCoins != before.Coins-int64(item.Price) {
+			return fmt.Errorf("%w: bought %q for %d leaving %d of %d coins", ErrInvariantViolated, purchase.Item, purchase.Price, purchase.RemainingCoins, before.Coins)
+		}
+		return nil
+	})
+
+	runner.run("transfer (dry run)", func() error {
+		transfer, err := application.ProcessSendCoin(storage.WithDryRun(ctx), sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: transferAmount})
+		if err != nil {
+			return err
+		}
+		if !transfer.DryRun || transfer.TransferID != 0 {
+			return fmt.Errorf("%w: dry-run transfer was recorded as %d", ErrInvariantViolated, transfer.TransferID)
+		}
+		return nil
+	})
+
+	runner.run("verify rollback", func() error {
+		after, err := application.ProcessInfo(ctx, sender.ID)
+		if err != nil {
+			return err
+		}
+		if after.Coins != before.Coins || len(after.Inventory) != 0 || len(after.CoinHistory.Sent) != 0 {
+			return fmt.Errorf("%w: dry-run operations changed the account to %d coins", ErrInvariantViolated, after.Coins)
+		}
+		return nil
+	})
+
+	runner.always("delete users", func() error {
+		var errs []error
+		for _, user := range []*models.User{sender, recipient} {
+			if user != nil {
+				errs = append(errs, db.DeleteUser(ctx, user.ID))
+			}
+		}
+		return errors.Join(errs...)
+	})
+
+	return runner.report
+}
+
+// register signs up a throwaway user through the application layer and checks the issued token.
+func register(ctx context.Context, application *app.App, prefix string) (*models.User, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+
+	req := models.AuthRequest{Username: prefix + "_" + hex.EncodeToString(suffix), Password: hex.EncodeToString(password), UserAgent: "selftest"}
+	token, err := application.ProcessAuth(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == 0 {
+		return nil, fmt.Errorf("%w: token of %q has no user ID", ErrInvariantViolated, req.Username)
+	}
+
+	return &models.User{ID: claims.UserID, Username: req.Username}, nil
+}
@@ -0,0 +1,119 @@
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/mocks"
+)
+
+// dryRunContext matches contexts marked with storage.WithDryRun.
+type dryRunContext struct{}
+
+func (dryRunContext) Matches(x any) bool {
+	ctx, ok := x.(context.Context)
+	return ok && storage.IsDryRun(ctx)
+}
+
+func (dryRunContext) String() string {
+	return "is a dry-run context"
+}
+
+// expectUsers sets up the registration of the sender and the recipient with IDs 1 and 2 and their deletion.
+func expectUsers(mockStorage *mocks.MockStorage) {
+	mockStorage.EXPECT().CheckUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, user *models.User) (*models.User, error) {
+		return user, nil
+	}).Times(2)
+	nextID := int32(0)
+	mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, user *models.User) (*models.User, error) {
+		nextID++
+		user.ID = nextID
+		return user, nil
+	}).Times(2)
+	mockStorage.EXPECT().DeleteUser(gomock.Any(), int32(1)).Return(nil)
+	mockStorage.EXPECT().DeleteUser(gomock.Any(), int32(2)).Return(nil)
+}
+
+func TestRun_Gomock(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	catalog := []models.CatalogItem{{Name: "t-shirt", Price: 80}, {Name: "pen", Price: 10}}
+	info := func() *models.InfoResponse {
+		return &models.InfoResponse{Coins: 1000, AvailableCoins: 1000}
+	}
+	dryRun := dryRunContext{}
+
+	t.Run("Passed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockStorage := mocks.NewMockStorage(ctrl)
+
+		expectUsers(mockStorage)
+		mockStorage.EXPECT().GetInfo(gomock.Any(), int32(1)).DoAndReturn(func(context.Context, int32) (*models.InfoResponse, error) {
+			return info(), nil
+		}).Times(2)
+		mockStorage.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+		mockStorage.EXPECT().BuyItem(dryRun, int32(1), "pen").Return(&models.PurchaseResult{Item: "pen", Price: 10, Quantity: 1, RemainingCoins: 990}, nil)
+		mockStorage.EXPECT().TransferCoins(dryRun, int32(1), gomock.Any()).DoAndReturn(func(_ context.Context, _ int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+			assert.Contains(t, req.ToUser, "selftest_recipient_")
+			return &models.TransferResult{}, nil
+		})
+
+		report := Run(context.Background(), mockStorage, l)
+		require.True(t, report.Passed(), "%+v", report.Steps)
+		assert.Len(t, report.Steps, 7)
+
+		var out bytes.Buffer
+		_, err := report.WriteTo(&out)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "PASS  buy (dry run)")
+		assert.Contains(t, out.String(), "selftest passed\n")
+	})
+
+	t.Run("BuyFails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockStorage := mocks.NewMockStorage(ctrl)
+
+		expectUsers(mockStorage)
+		mockStorage.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(info(), nil)
+		mockStorage.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+		mockStorage.EXPECT().BuyItem(dryRun, int32(1), "pen").Return(nil, errors.New("connection reset"))
+
+		report := Run(context.Background(), mockStorage, l)
+		require.False(t, report.Passed())
+
+		var out bytes.Buffer
+		_, err := report.WriteTo(&out)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "FAIL  buy (dry run)")
+		assert.Contains(t, out.String(), ": connection reset\n")
+		assert.Contains(t, out.String(), "SKIP  transfer (dry run)\n")
+		assert.Contains(t, out.String(), "PASS  delete users", "cleanup must run after a failure")
+		assert.Contains(t, out.String(), "selftest failed\n")
+	})
+
+	t.Run("InvariantViolated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockStorage := mocks.NewMockStorage(ctrl)
+
+		expectUsers(mockStorage)
+		mockStorage.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(info(), nil)
+		mockStorage.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+		mockStorage.EXPECT().BuyItem(dryRun, int32(1), "pen").Return(&models.PurchaseResult{Item: "pen", Price: 10, Quantity: 1, RemainingCoins: 1000}, nil)
+
+		report := Run(context.Background(), mockStorage, l)
+		require.False(t, report.Passed())
+		assert.ErrorIs(t, report.Steps[3].Err, ErrInvariantViolated)
+	})
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/featureflag"
+	"merch_store/internal/pkg/logger"
+)
+
+// The fuzz targets run their seed corpus with the rest of the tests; run them with -fuzz, as in make test.fuzz,
+// to explore further.
+
+// malformedBodies are the malformed payloads of the handler tests and the crash reports, shared by the seed corpora
+// of the decoding fuzz targets.
+var malformedBodies = []string{
+	"",
+	" \n\t ",
+	"{}",
+	"[]",
+	"null",
+	`"username"`,
+	`{"username": "user"`,
+	`{"username": "user", "password": "pass"}{"username": "other"}`,
+	`{"username": 1, "password": true}`,
+	`{"username": "\ud800", "password": "pass"}`,
+	`{"username": "us\u0000er", "password": "pass"}`,
+	"{\"username\": \"\xff\xfe\", \"password\": \"pass\"}",
+	`{"username": "` + strings.Repeat("u", 300) + `", "password": "pass"}`,
+	`{"to_user": "recipient", "amount": 100}`,
+	`{"toUser": "", "amount": 0}`,
+	`{"toUser": "recipient", "amount": 99.5}`,
+	`{"toUser": "recipient", "amount": "100"}`,
+	`{"toUser": "recipient", "amount": 1e2}`,
+	`{"toUser": "recipient", "amount": -5}`,
+	`{"toUser": "recipient", "amount": 99999999999999999999}`,
+	`{"toUser": "recipient", "amount": 100, "note": "unknown field"}`,
+}
+
+// errorBody is the body of an error response.
+type errorBody struct {
+	Errors string `json:"errors"`
+	Code   string `json:"code"`
+}
+
+// newFuzzHandlers returns handlers decoding request bodies leniently and strictly (see featureflag.StrictJSON).
+func newFuzzHandlers(f *testing.F) (lenient *handlers, strict *handlers) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+
+	path := filepath.Join(f.TempDir(), "flags.json")
+	require.NoError(f, os.WriteFile(path, []byte(`{"strict_json": true}`), 0o600))
+	flags := featureflag.New(path, time.Minute, l)
+	require.NoError(f, flags.Reload())
+	strictApp := app.NewApp(nil, l)
+	strictApp.SetFeatureFlags(flags)
+
+	return newHandlers(app.NewApp(nil, l), l), newHandlers(strictApp, l)
+}
+
+// checkDecode decodes body into v with decodeJSONBody and checks that the outcome is either a valid payload with
+// nothing written to the response, or a 400 response with an error message and one of codes.
+func checkDecode(t *testing.T, h *handlers, body []byte, v models.Validator, codes ...string) bool {
+	req := httptest.NewRequest(http.MethodPost, "/api", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+
+	if h.decodeJSONBody(rec, req, v) {
+		assert.Zero(t, rec.Body.Len(), "a decoded payload must leave the response to the handler")
+		assert.NoError(t, v.Validate(), "a decoded payload must be valid")
+		assert.True(t, json.Valid(body), "only valid JSON may be decoded")
+		return true
+	}
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var response errorBody
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response), "the error must be JSON: %q", rec.Body.String())
+	assert.NotEmpty(t, response.Errors)
+	assert.Contains(t, append(codes, models.ErrCodeBodyRequired, models.ErrCodeFieldInvalid,
+		models.ErrCodeJSONTooDeep, models.ErrCodeJSONNumberTooLong, models.ErrCodeJSONTooManyKeys, ""), response.Code)
+	return false
+}
+
+func FuzzAuthRequestDecode(f *testing.F) {
+	for _, body := range malformedBodies {
+		f.Add([]byte(body), false)
+		f.Add([]byte(body), true)
+	}
+	f.Add([]byte(`{"username": "user", "password": "pass"}`), false)
+	f.Add([]byte(`{"username": "user", "password": "pass", "inviteCode": "code"}`), true)
+
+	lenient, strict := newFuzzHandlers(f)
+	f.Fuzz(func(t *testing.T, body []byte, strictJSON bool) {
+		h := lenient
+		if strictJSON {
+			h = strict
+		}
+
+		var authRequest models.AuthRequest
+		checkDecode(t, h, body, &authRequest)
+	})
+}
+
+func FuzzSendCoinDecode(f *testing.F) {
+	for _, body := range malformedBodies {
+		f.Add([]byte(body), false)
+		f.Add([]byte(body), true)
+	}
+	f.Add([]byte(`{"toUser": "recipient", "amount": 100}`), false)
+	f.Add([]byte(`{"toUser": "recipient", "amount": 100}`), true)
+
+	lenient, strict := newFuzzHandlers(f)
+	f.Fuzz(func(t *testing.T, body []byte, strictJSON bool) {
+		h := lenient
+		if strictJSON {
+			h = strict
+		}
+
+		var sendCoinRequest models.SendCoinRequest
+		if checkDecode(t, h, body, &sendCoinRequest, models.ErrCodeAmountInvalid) {
+			assert.GreaterOrEqual(t, sendCoinRequest.Amount, models.CoinAmount(0))
+		}
+	})
+}
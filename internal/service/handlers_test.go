@@ -1,61 +1,49 @@
 package service
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/golang/mock/gomock"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
+	pgx_pgconn "github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"golang.org/x/crypto/bcrypt"
 
 	"merch_store/internal/app"
 	"merch_store/internal/config"
 	"merch_store/internal/models"
 	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/clock"
+	"merch_store/internal/pkg/featureflag"
 	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/ratelimit"
+	"merch_store/internal/service/servicetest"
+	"merch_store/internal/storage"
 	"merch_store/internal/storage/mocks"
+	"merch_store/internal/webui"
 )
 
-func testRequest(t *testing.T, ts *httptest.Server, method, path string, requestBody []byte) (*http.Response, string) {
-	req, err := http.NewRequest(method, ts.URL+path, bytes.NewBuffer(requestBody))
-	require.NoError(t, err)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	require.NoError(t, err)
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	require.NoError(t, err)
-
-	return resp, string(body)
-}
-
-func testRequestWithAuth(t *testing.T, ts *httptest.Server, method, path string, requestBody []byte, token string) (*http.Response, string) {
-	req, err := http.NewRequest(method, ts.URL+path, bytes.NewBuffer(requestBody))
-	require.NoError(t, err)
-	if token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
-	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	require.NoError(t, err)
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	require.NoError(t, err)
-	return resp, string(body)
-}
-
 func TestAuthHandler_Gomock(t *testing.T) {
 
 	l, err := logger.CreateLogger(config.LogLevel)
@@ -71,6 +59,7 @@ func TestAuthHandler_Gomock(t *testing.T) {
 	service := NewService(appInstance, config.ServerRunAddress, l)
 	testServer := httptest.NewServer(service.NewRouter())
 	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
 
 	type expectedData struct {
 		expectedContentType string
@@ -104,6 +93,16 @@ func TestAuthHandler_Gomock(t *testing.T) {
 				expectedBody:        "{\"errors\":\"missing username or password\"}\n",
 			},
 		},
+		{
+			name:        "Username of whitespace only",
+			requestBody: []byte(`{"username": " \t\n ", "password": "pass"}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedContentType: "application/json",
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedBody:        "{\"errors\":\"missing username or password\"}\n",
+			},
+		},
 		{
 			name:        "Missing password",
 			requestBody: []byte(`{"username": "user", "password": ""}`),
@@ -169,6 +168,22 @@ func TestAuthHandler_Gomock(t *testing.T) {
 				expectedBody:        "",
 			},
 		},
+		{
+			name:        "Successful authorization - username with stray whitespace",
+			requestBody: []byte(`{"username": "  existing \t user ", "password": "pass"}`),
+			setupMock: func() {
+				mockDB.EXPECT().CheckUser(gomock.Any(), gomock.AssignableToTypeOf(&models.User{})).
+					DoAndReturn(func(ctx context.Context, user *models.User) (*models.User, error) {
+						assert.Equal(t, "existing user", user.Username, "whitespace variants must sign in to the same user")
+						return &models.User{ID: 456, Username: user.Username}, nil
+					})
+			},
+			expected: expectedData{
+				expectedContentType: "application/json",
+				expectedStatusCode:  http.StatusOK,
+				expectedBody:        "",
+			},
+		},
 		{
 			name:        "Successful authorization - existing user",
 			requestBody: []byte(`{"username": "existing_user", "password": "pass"}`),
@@ -190,18 +205,18 @@ func TestAuthHandler_Gomock(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 
 			tc.setupMock()
-			resp, body := testRequest(t, testServer, http.MethodPost, "/api/auth", tc.requestBody)
+			resp := client.Post(t, "/api/auth", tc.requestBody)
 			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
 			assert.Equal(t, tc.expected.expectedContentType, resp.Header.Get("Content-Type"))
 
 			if tc.expected.expectedStatusCode == http.StatusOK {
 
 				var authResp models.AuthResponse
-				err := json.Unmarshal([]byte(body), &authResp)
+				err := json.Unmarshal([]byte(resp.Body), &authResp)
 				require.NoError(t, err)
 				assert.NotEmpty(t, authResp.Token, "token should not be empty")
 			} else {
-				assert.Equal(t, tc.expected.expectedBody, body)
+				assert.Equal(t, tc.expected.expectedBody, resp.Body)
 			}
 		})
 	}
@@ -221,6 +236,7 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 	service := NewService(appInstance, config.ServerRunAddress, l)
 	testServer := httptest.NewServer(service.NewRouter())
 	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
 
 	token, err := auth.GenerateToken(1)
 	require.NoError(t, err)
@@ -229,6 +245,7 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 		expectedStatusCode  int
 		expectedContentType string
 		expectedBody        string
+		expectedBalance     string
 	}
 
 	testCases := []struct {
@@ -248,7 +265,7 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 			expected: expectedData{
 				expectedStatusCode:  http.StatusUnauthorized,
 				expectedContentType: "application/json",
-				expectedBody:        "{\"errors\":\"missing auth header\"}\n",
+				expectedBody:        "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
 			},
 		},
 		{
@@ -258,7 +275,7 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 			token:  token,
 			setupMock: func() {
 				mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "item1").
-					Return(sql.ErrNoRows)
+					Return(nil, sql.ErrNoRows)
 			},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusBadRequest,
@@ -266,6 +283,36 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 				expectedBody:        "{\"errors\":\"invalid item name provided\"}\n",
 			},
 		},
+		{
+			name:   "Insufficient available funds",
+			method: http.MethodGet,
+			path:   "/api/buy/item1",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "item1").
+					Return(nil, storage.ErrInsufficientFunds)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"insufficient funds to purchase the item\"}\n",
+			},
+		},
+		{
+			name:   "Buyer no longer exists",
+			method: http.MethodGet,
+			path:   "/api/buy/item1",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "item1").
+					Return(nil, storage.ErrUserNotFound)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusUnauthorized,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"user not found\"}\n",
+			},
+		},
 		{
 			name:   "Generic error in buying item",
 			method: http.MethodGet,
@@ -273,7 +320,7 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 			token:  token,
 			setupMock: func() {
 				mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "item1").
-					Return(errors.New("buy error"))
+					Return(nil, errors.New("buy error"))
 			},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusInternalServerError,
@@ -288,12 +335,13 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 			token:  token,
 			setupMock: func() {
 				mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "item1").
-					Return(nil)
+					Return(&models.PurchaseResult{Item: "item1", Price: 80, Quantity: 1, RemainingCoins: 920}, nil)
 			},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusOK,
-				expectedContentType: "",
-				expectedBody:        "",
+				expectedContentType: "application/json",
+				expectedBody:        "{\"item\":\"item1\",\"price\":80,\"quantity\":1,\"remainingCoins\":920}",
+				expectedBalance:     "920",
 			},
 		},
 	}
@@ -301,17 +349,250 @@ func TestBuyItemHandler_Gomock(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.setupMock()
-			resp, body := testRequestWithAuth(t, testServer, tc.method, tc.path, nil, tc.token)
+			resp := client.WithToken(tc.token).Do(t, tc.method, tc.path, nil)
 			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
 			if tc.expected.expectedContentType != "" {
 				assert.Equal(t, tc.expected.expectedContentType, resp.Header.Get("Content-Type"))
 			}
-			assert.Equal(t, tc.expected.expectedBody, body)
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+			assert.Equal(t, tc.expected.expectedBalance, resp.Header.Get("X-Coins-Balance"))
 		})
 	}
 }
 
-func TestSendCoinHandler_Gomock(t *testing.T) {
+func TestQueuedBuyHandler_Gomock(t *testing.T) {
+	l, err := logger.CreateLogger(config.LogLevel)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetPurchaseQueue(app.NewPurchaseQueue(mockDB, []string{"pink-hoody"}, 1, time.Minute, l))
+
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+	otherToken, err := auth.GenerateToken(2)
+	require.NoError(t, err)
+
+	resp := client.WithToken(token).Get(t, "/api/buy/pink-hoody")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	var ticket models.QueueTicket
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &ticket))
+	assert.NotEmpty(t, ticket.Token)
+	assert.Equal(t, 1, ticket.Position)
+
+	resp = client.WithToken(otherToken).Get(t, "/api/buy/pink-hoody")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "{\"errors\":\"purchase queue is full, try again later\"}\n", resp.Body)
+
+	resp = client.WithToken(token).Get(t, "/api/buy/status/"+ticket.Token)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "{\"item\":\"pink-hoody\",\"status\":\"pending\",\"position\":1}", resp.Body)
+
+	resp = client.WithToken(otherToken).Get(t, "/api/buy/status/"+ticket.Token)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "{\"errors\":\"purchase not found\"}\n", resp.Body)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Return(&models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 980}, nil)
+	resp = client.WithToken(token).Get(t, "/api/buy/cup")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "items outside the flash sale are bought directly")
+	assert.Equal(t, "{\"item\":\"cup\",\"price\":20,\"quantity\":1,\"remainingCoins\":980}", resp.Body)
+}
+
+func TestDryRun_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetPurchaseQueue(app.NewPurchaseQueue(mockDB, []string{"pink-hoody"}, 10, time.Minute, l))
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	buy := func(ctx context.Context, userID int32, itemName string) (*models.PurchaseResult, error) {
+		if !storage.IsDryRun(ctx) {
+			return nil, errors.New("expected a dry run")
+		}
+		return &models.PurchaseResult{Item: itemName, Price: 500, Quantity: 1, RemainingCoins: 500, ReceiptNumber: "R-2025-000001"}, nil
+	}
+	transfer := func(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+		if !storage.IsDryRun(ctx) {
+			return nil, errors.New("expected a dry run")
+		}
+		return &models.TransferResult{TransferID: 42}, nil
+	}
+
+	t.Run("Buy with query parameter", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "pink-hoody").DoAndReturn(buy)
+
+		resp := client.WithToken(token).Get(t, "/api/buy/pink-hoody?dryRun=true")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "a dry run bypasses the flash-sale queue")
+		assert.Equal(t, `{"item":"pink-hoody","price":500,"quantity":1,"remainingCoins":500,"dryRun":true}`, resp.Body)
+		assert.Empty(t, resp.Header.Get("X-Coins-Balance"), "a dry run changes no balance")
+	})
+
+	t.Run("Send coins with header", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.Any()).DoAndReturn(transfer)
+
+		resp := client.WithToken(token).WithHeader("X-Dry-Run", "true").Post(t, "/api/sendCoin", []byte(`{"toUser": "recipient", "amount": 100}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"transferId":0,"dryRun":true}`, resp.Body, "a dry run records no transfer")
+		assert.Empty(t, resp.Header.Get("X-Coins-Balance"), "a dry run changes no balance")
+	})
+
+	t.Run("Errors match the real call", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.Any()).Return(nil, storage.ErrInsufficientFunds)
+
+		resp := client.WithToken(token).Post(t, "/api/sendCoin?dryRun=1", []byte(`{"toUser": "recipient", "amount": 100}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"insufficient funds to perform the transfer\"}\n", resp.Body)
+	})
+
+	t.Run("Invalid value", func(t *testing.T) {
+		resp := client.WithToken(token).Get(t, "/api/buy/cup?dryRun=maybe")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"invalid dryRun value\"}\n", resp.Body)
+	})
+}
+
+func TestEmptyBody_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	const bodyRequired = "{\"errors\":\"request body is required\",\"code\":\"BODY_REQUIRED\"}\n"
+	endpoints := []struct {
+		name             string
+		path             string
+		token            string
+		emptyObjectError string
+	}{
+		{name: "auth", path: "/api/auth", emptyObjectError: "{\"errors\":\"missing username or password\"}\n"},
+		{name: "sendCoin", path: "/api/sendCoin", token: token, emptyObjectError: "{\"errors\":\"missing username or amount\"}\n"},
+		{name: "gift", path: "/api/buy/cup/gift", token: token, emptyObjectError: "{\"errors\":\"missing recipient\"}\n"},
+	}
+	bodies := []struct {
+		name string
+		body []byte
+	}{
+		{name: "nil body", body: nil},
+		{name: "empty string", body: []byte("")},
+		{name: "whitespace", body: []byte(" \n\t ")},
+	}
+
+	for _, endpoint := range endpoints {
+		for _, body := range bodies {
+			t.Run(endpoint.name+"/"+body.name, func(t *testing.T) {
+				resp := client.WithToken(endpoint.token).Post(t, endpoint.path, body.body)
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				assert.Equal(t, bodyRequired, resp.Body)
+			})
+		}
+
+		t.Run(endpoint.name+"/empty object", func(t *testing.T) {
+			resp := client.WithToken(endpoint.token).Post(t, endpoint.path, []byte("{}"))
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Equal(t, endpoint.emptyObjectError, resp.Body, "an empty object falls through to field validation")
+		})
+	}
+}
+
+func TestConsumeItemHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name               string
+		requestBody        []byte
+		setupMock          func()
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "Non-positive quantity",
+			requestBody:        []byte(`{"quantity": 0}`),
+			setupMock:          func() {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "{\"errors\":\"quantity must be positive\"}\n",
+		},
+		{
+			name:        "More than owned",
+			requestBody: []byte(`{"quantity": 3}`),
+			setupMock: func() {
+				mockDB.EXPECT().ConsumeItem(gomock.Any(), int32(1), "cup", 3).Return(nil, storage.ErrInsufficientItems)
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "{\"errors\":\"cannot consume more items than are pending pickup\"}\n",
+		},
+		{
+			name:        "Generic error",
+			requestBody: []byte(`{"quantity": 1}`),
+			setupMock: func() {
+				mockDB.EXPECT().ConsumeItem(gomock.Any(), int32(1), "cup", 1).Return(nil, errors.New("consume error"))
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       "{\"errors\":\"consume error\"}\n",
+		},
+		{
+			name:        "Partial fulfillment",
+			requestBody: []byte(`{"quantity": 2}`),
+			setupMock: func() {
+				mockDB.EXPECT().ConsumeItem(gomock.Any(), int32(1), "cup", 2).
+					Return(&models.InventoryItem{Type: "cup", Quantity: 3, PendingQuantity: 1, FulfilledQuantity: 2}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"type":"cup","quantity":3,"pendingQuantity":1,"fulfilledQuantity":2}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			resp := client.WithToken(token).Post(t, "/api/inventory/cup/consume", tc.requestBody)
+			assert.Equal(t, tc.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, tc.expectedBody, resp.Body)
+		})
+	}
+}
+
+func TestGiftItemHandler_Gomock(t *testing.T) {
 	l, err := logger.CreateLogger(config.LogLevel)
 	require.NoError(t, err)
 
@@ -325,6 +606,7 @@ func TestSendCoinHandler_Gomock(t *testing.T) {
 	service := NewService(appInstance, config.ServerRunAddress, l)
 	testServer := httptest.NewServer(service.NewRouter())
 	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
 
 	token, err := auth.GenerateToken(1)
 	require.NoError(t, err)
@@ -337,8 +619,6 @@ func TestSendCoinHandler_Gomock(t *testing.T) {
 
 	testCases := []struct {
 		name        string
-		method      string
-		path        string
 		token       string
 		requestBody []byte
 		setupMock   func()
@@ -346,69 +626,102 @@ func TestSendCoinHandler_Gomock(t *testing.T) {
 	}{
 		{
 			name:        "Unauthorized - no token",
-			method:      http.MethodPost,
-			path:        "/api/sendCoin",
 			token:       "",
-			requestBody: []byte(`{"to_user": "recipient", "amount": 100}`),
+			requestBody: []byte(`{"toUser": "recipient"}`),
 			setupMock:   func() {},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusUnauthorized,
 				expectedContentType: "application/json",
-				expectedBody:        "{\"errors\":\"missing auth header\"}\n",
+				expectedBody:        "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
 			},
 		},
 		{
-			name:        "Invalid JSON",
-			method:      http.MethodPost,
-			path:        "/api/sendCoin",
+			name:        "Missing recipient",
 			token:       token,
-			requestBody: []byte("some body"),
+			requestBody: []byte(`{"toUser": ""}`),
 			setupMock:   func() {},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusBadRequest,
 				expectedContentType: "application/json",
-				expectedBody:        "{\"errors\":\"invalid character 's' looking for beginning of value\"}\n",
+				expectedBody:        "{\"errors\":\"missing recipient\"}\n",
 			},
 		},
 		{
-			name:        "Missing username or amount",
-			method:      http.MethodPost,
-			path:        "/api/sendCoin",
+			name:        "Invalid item name (sql.ErrNoRows)",
 			token:       token,
-			requestBody: []byte(`{"toUser": "", "amount": 0}`),
-			setupMock:   func() {},
+			requestBody: []byte(`{"toUser": "recipient"}`),
+			setupMock: func() {
+				mockDB.EXPECT().GiftItem(gomock.Any(), int32(1), "item1", models.GiftRequest{ToUser: "recipient"}).
+					Return(sql.ErrNoRows)
+			},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusBadRequest,
 				expectedContentType: "application/json",
-				expectedBody:        "{\"errors\":\"missing username or amount\"}\n",
+				expectedBody:        "{\"errors\":\"invalid item name provided\"}\n",
 			},
 		},
 		{
-			name:        "Generic error in sending coin",
-			method:      http.MethodPost,
-			path:        "/api/sendCoin",
+			name:        "Unknown recipient",
 			token:       token,
-			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			requestBody: []byte(`{"toUser": "ghost"}`),
 			setupMock: func() {
-				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
-					DoAndReturn(func(ctx context.Context, userID int32, req models.SendCoinRequest) error {
-						return errors.New("send coin error")
-					})
+				mockDB.EXPECT().GiftItem(gomock.Any(), int32(1), "item1", models.GiftRequest{ToUser: "ghost"}).
+					Return(storage.ErrRecipientNotFound)
 			},
 			expected: expectedData{
-				expectedStatusCode:  http.StatusInternalServerError,
+				expectedStatusCode:  http.StatusBadRequest,
 				expectedContentType: "application/json",
-				expectedBody:        "{\"errors\":\"send coin error\"}\n",
+				expectedBody:        "{\"errors\":\"recipient not found\"}\n",
 			},
 		},
 		{
-			name:        "Successful coin transfer",
-			method:      http.MethodPost,
-			path:        "/api/sendCoin",
+			name:        "Buyer no longer exists",
 			token:       token,
-			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			requestBody: []byte(`{"toUser": "recipient"}`),
 			setupMock: func() {
-				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+				mockDB.EXPECT().GiftItem(gomock.Any(), int32(1), "item1", models.GiftRequest{ToUser: "recipient"}).
+					Return(storage.ErrUserNotFound)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusUnauthorized,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"user not found\"}\n",
+			},
+		},
+		{
+			name:        "Self gift (check violation)",
+			token:       token,
+			requestBody: []byte(`{"toUser": "me"}`),
+			setupMock: func() {
+				mockDB.EXPECT().GiftItem(gomock.Any(), int32(1), "item1", models.GiftRequest{ToUser: "me"}).
+					Return(&pgx_pgconn.PgError{Code: pgerrcode.CheckViolation, ConstraintName: "chk_gift_different_users"})
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"self-gifting is not allowed; please choose a different user.\"}\n",
+			},
+		},
+		{
+			name:        "Insufficient funds (check violation)",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient"}`),
+			setupMock: func() {
+				mockDB.EXPECT().GiftItem(gomock.Any(), int32(1), "item1", models.GiftRequest{ToUser: "recipient"}).
+					Return(&pgx_pgconn.PgError{Code: pgerrcode.CheckViolation, ConstraintName: "users_coins_check"})
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"insufficient funds to purchase the item\"}\n",
+			},
+		},
+		{
+			name:        "Successful gift",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient"}`),
+			setupMock: func() {
+				mockDB.EXPECT().GiftItem(gomock.Any(), int32(1), "item1", models.GiftRequest{ToUser: "recipient"}).
 					Return(nil)
 			},
 			expected: expectedData{
@@ -422,17 +735,17 @@ func TestSendCoinHandler_Gomock(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.setupMock()
-			resp, body := testRequestWithAuth(t, testServer, tc.method, tc.path, tc.requestBody, tc.token)
+			resp := client.WithToken(tc.token).Post(t, "/api/buy/item1/gift", tc.requestBody)
 			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
 			if tc.expected.expectedContentType != "" {
 				assert.Equal(t, tc.expected.expectedContentType, resp.Header.Get("Content-Type"))
 			}
-			assert.Equal(t, tc.expected.expectedBody, body)
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
 		})
 	}
 }
 
-func TestInfoHandler_Gomock(t *testing.T) {
+func TestSendCoinHandler_Gomock(t *testing.T) {
 	l, err := logger.CreateLogger(config.LogLevel)
 	require.NoError(t, err)
 
@@ -446,6 +759,7 @@ func TestInfoHandler_Gomock(t *testing.T) {
 	service := NewService(appInstance, config.ServerRunAddress, l)
 	testServer := httptest.NewServer(service.NewRouter())
 	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
 
 	token, err := auth.GenerateToken(1)
 	require.NoError(t, err)
@@ -454,66 +768,252 @@ func TestInfoHandler_Gomock(t *testing.T) {
 		expectedStatusCode  int
 		expectedContentType string
 		expectedBody        string
+		expectedBalance     string
 	}
 
 	testCases := []struct {
-		name      string
-		method    string
-		path      string
-		token     string
-		setupMock func()
-		expected  expectedData
+		name        string
+		method      string
+		path        string
+		token       string
+		requestBody []byte
+		setupMock   func()
+		expected    expectedData
 	}{
 		{
-			name:      "Unauthorized - no token",
-			method:    http.MethodGet,
-			path:      "/api/info",
-			token:     "",
-			setupMock: func() {},
-			expected: expectedData{
-				expectedStatusCode:  http.StatusUnauthorized,
-				expectedContentType: "application/json",
-				expectedBody:        "{\"errors\":\"missing auth header\"}\n",
-			},
+			name:        "Unauthorized - no token",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       "",
+			requestBody: []byte(`{"to_user": "recipient", "amount": 100}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusUnauthorized,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
+			},
 		},
 		{
-			name:   "Info error",
-			method: http.MethodGet,
-			path:   "/api/info",
-			token:  token,
+			name:        "Invalid JSON",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte("some body"),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"invalid character 's' looking for beginning of value\"}\n",
+			},
+		},
+		{
+			name:        "Missing username or amount",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "", "amount": 0}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"missing username or amount\"}\n",
+			},
+		},
+		{
+			name:        "Fractional amount",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 99.5}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"amount must be a non-negative integer\",\"code\":\"AMOUNT_INVALID\"}\n",
+			},
+		},
+		{
+			name:        "String amount",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": "100"}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"amount must be a non-negative integer\",\"code\":\"AMOUNT_INVALID\"}\n",
+			},
+		},
+		{
+			name:        "Scientific notation amount",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 1e2}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"amount must be a non-negative integer\",\"code\":\"AMOUNT_INVALID\"}\n",
+			},
+		},
+		{
+			name:        "Negative amount",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": -5}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"amount must be a non-negative integer\",\"code\":\"AMOUNT_INVALID\"}\n",
+			},
+		},
+		{
+			name:        "Amount overflowing int",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 99999999999999999999}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"amount must be a non-negative integer\",\"code\":\"AMOUNT_INVALID\"}\n",
+			},
+		},
+		{
+			name:        "Sender no longer exists",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
 			setupMock: func() {
-				mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).
-					Return(nil, errors.New("info error"))
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+					Return(nil, storage.ErrUserNotFound)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusUnauthorized,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"user not found\"}\n",
+			},
+		},
+		{
+			name:        "Recipient not found",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			setupMock: func() {
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+					Return(nil, storage.ErrRecipientNotFound)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"recipient not found\"}\n",
+			},
+		},
+		{
+			name:        "Insufficient available funds",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			setupMock: func() {
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+					Return(nil, storage.ErrInsufficientFunds)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"insufficient funds to perform the transfer\"}\n",
+			},
+		},
+		{
+			name:        "Wrapped self-transfer check violation",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			setupMock: func() {
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+					Return(nil, fmt.Errorf("transfer: %w", &pgx_pgconn.PgError{Code: pgerrcode.CheckViolation, ConstraintName: "chk_different_users"}))
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"self-transfer of money is not allowed; please choose a different user.\"}\n",
+			},
+		},
+		{
+			name:        "Recipient balance cap exceeded",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			setupMock: func() {
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+					Return(nil, storage.ErrBalanceCapExceeded)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"recipient cannot hold that many coins\"}\n",
+			},
+		},
+		{
+			name:        "Generic error in sending coin",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			setupMock: func() {
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+					DoAndReturn(func(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+						return nil, errors.New("send coin error")
+					})
 			},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusInternalServerError,
 				expectedContentType: "application/json",
-				expectedBody:        "{\"errors\":\"info error\"}\n",
+				expectedBody:        "{\"errors\":\"send coin error\"}\n",
 			},
 		},
 		{
-			name:   "Successful info retrieval",
-			method: http.MethodGet,
-			path:   "/api/info",
-			token:  token,
+			name:        "Recipient with stray whitespace",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": " mary \t ann ", "amount": 100}`),
 			setupMock: func() {
-				infoResp := &models.InfoResponse{
-					Coins: 500,
-					Inventory: []models.InventoryItem{
-						{Type: "tshirt", Quantity: 2},
-					},
-					CoinHistory: &models.CoinHistory{
-						Sent:     []models.TransactionDetail{{ToUser: "user2", Amount: 100}},
-						Received: []models.TransactionDetail{{FromUser: "user3", Amount: 50}},
-					},
-				}
-				mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).
-					Return(infoResp, nil)
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), models.SendCoinRequest{ToUser: "mary ann", Amount: 100}).
+					Return(&models.TransferResult{TransferID: 12346, RemainingCoins: 800}, nil)
 			},
 			expected: expectedData{
 				expectedStatusCode:  http.StatusOK,
 				expectedContentType: "application/json",
-				expectedBody:        "\"coins\":500",
+				expectedBody:        `{"transferId":12346}`,
+				expectedBalance:     "800",
+			},
+		},
+		{
+			name:        "Successful coin transfer",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin",
+			token:       token,
+			requestBody: []byte(`{"toUser": "recipient", "amount": 100}`),
+			setupMock: func() {
+				mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.AssignableToTypeOf(models.SendCoinRequest{})).
+					Return(&models.TransferResult{TransferID: 12345, RemainingCoins: 900}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusOK,
+				expectedContentType: "application/json",
+				expectedBody:        `{"transferId":12345}`,
+				expectedBalance:     "900",
 			},
 		},
 	}
@@ -521,16 +1021,4212 @@ func TestInfoHandler_Gomock(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.setupMock()
-			resp, body := testRequestWithAuth(t, testServer, tc.method, tc.path, nil, tc.token)
+			resp := client.WithToken(tc.token).Do(t, tc.method, tc.path, tc.requestBody)
 			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
 			if tc.expected.expectedContentType != "" {
 				assert.Equal(t, tc.expected.expectedContentType, resp.Header.Get("Content-Type"))
 			}
-			if tc.name == "Successful info retrieval" {
-				assert.Contains(t, body, tc.expected.expectedBody)
-			} else {
-				assert.Equal(t, tc.expected.expectedBody, body)
-			}
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+			assert.Equal(t, tc.expected.expectedBalance, resp.Header.Get("X-Coins-Balance"))
 		})
 	}
 }
+
+func TestInfoHandler_Gomock(t *testing.T) {
+	l, err := logger.CreateLogger(config.LogLevel)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+
+	appInstance := app.NewApp(mockDB, l)
+
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	type expectedData struct {
+		expectedStatusCode  int
+		expectedContentType string
+		expectedBody        string
+	}
+
+	testCases := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		setupMock func()
+		expected  expectedData
+	}{
+		{
+			name:      "Unauthorized - no token",
+			method:    http.MethodGet,
+			path:      "/api/info",
+			token:     "",
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusUnauthorized,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
+			},
+		},
+		{
+			name:   "Info error",
+			method: http.MethodGet,
+			path:   "/api/info",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).
+					Return(nil, errors.New("info error"))
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusInternalServerError,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"info error\"}\n",
+			},
+		},
+		{
+			name:   "Info with a failed commit",
+			method: http.MethodGet,
+			path:   "/api/info",
+			token:  token,
+			setupMock: func() {
+				// A response returned alongside an error must never reach the client.
+				mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).
+					Return(&models.InfoResponse{Coins: 1000, AvailableCoins: 1000}, errors.New("commit failed"))
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusInternalServerError,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"commit failed\"}\n",
+			},
+		},
+		{
+			name:   "Successful info retrieval",
+			method: http.MethodGet,
+			path:   "/api/info",
+			token:  token,
+			setupMock: func() {
+				infoResp := &models.InfoResponse{
+					Coins:          500,
+					AvailableCoins: 400,
+					Inventory: []models.InventoryItem{
+						{Type: "tshirt", Quantity: 2},
+					},
+					CoinHistory: models.CoinHistory{
+						Sent:     []models.TransactionDetail{{ToUser: "user2", Amount: 100}},
+						Received: []models.TransactionDetail{{FromUser: "user3", Amount: 50}},
+					},
+				}
+				mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).
+					Return(infoResp, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusOK,
+				expectedContentType: "application/json",
+				expectedBody:        "\"coins\":500",
+			},
+		},
+		{
+			name:   "Empty account",
+			method: http.MethodGet,
+			path:   "/api/info",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).
+					Return(&models.InfoResponse{Coins: 1000, AvailableCoins: 1000}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusOK,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"coins\":1000,\"availableCoins\":1000,\"inventory\":[],\"coinHistory\":{\"received\":[],\"sent\":[]}}\n",
+			},
+		},
+		{
+			name:   "Partial info",
+			method: http.MethodGet,
+			path:   "/api/info?allowPartial=true",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().GetPartialInfo(gomock.Any(), int32(1)).Return(&models.InfoResponse{
+					Coins:          1000,
+					AvailableCoins: 900,
+					Inventory:      []models.InventoryItem{{Type: "cup", Quantity: 1}},
+					Warnings:       []string{storage.InfoSectionSent, storage.InfoSectionReceived},
+				}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusOK,
+				expectedContentType: "application/json",
+				expectedBody: `{"coins":1000,"availableCoins":900,"inventory":[{"type":"cup","quantity":1,"pendingQuantity":0,"fulfilledQuantity":0}],` +
+					`"coinHistory":{"received":[],"sent":[]},"warnings":["coinHistory.sent","coinHistory.received"]}` + "\n",
+			},
+		},
+		{
+			name:   "Partial info without a balance",
+			method: http.MethodGet,
+			path:   "/api/info?allowPartial=1",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().GetPartialInfo(gomock.Any(), int32(1)).Return(nil, errors.New("lock timeout"))
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusInternalServerError,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"lock timeout\"}\n",
+			},
+		},
+		{
+			name:      "Invalid allowPartial",
+			method:    http.MethodGet,
+			path:      "/api/info?allowPartial=maybe",
+			token:     token,
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusBadRequest,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"invalid allowPartial value; expected a boolean\"}\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			resp := client.WithToken(tc.token).Do(t, tc.method, tc.path, nil)
+			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
+			if tc.expected.expectedContentType != "" {
+				assert.Equal(t, tc.expected.expectedContentType, resp.Header.Get("Content-Type"))
+			}
+			if tc.name == "Successful info retrieval" {
+				assert.Contains(t, resp.Body, tc.expected.expectedBody)
+			} else {
+				assert.Equal(t, tc.expected.expectedBody, resp.Body)
+			}
+		})
+	}
+}
+
+func TestHistoryHandler_Gomock(t *testing.T) {
+	l, err := logger.CreateLogger(config.LogLevel)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+
+	appInstance := app.NewApp(mockDB, l)
+
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	history := []models.TransactionDetail{
+		{FromUser: "user1", ToUser: "user2", Amount: 100},
+		{FromUser: "user3", ToUser: "user1", Amount: 50},
+	}
+	streamHistory := func(ctx context.Context, userID int32, fn func(models.TransactionDetail) error) error {
+		for _, transactionDetail := range history {
+			if err := fn(transactionDetail); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type expectedData struct {
+		expectedStatusCode  int
+		expectedContentType string
+		expectedBody        string
+	}
+
+	testCases := []struct {
+		name      string
+		accept    string
+		token     string
+		setupMock func()
+		expected  expectedData
+	}{
+		{
+			name:      "Unauthorized - no token",
+			token:     "",
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusUnauthorized,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
+			},
+		},
+		{
+			name:  "JSON array",
+			token: token,
+			setupMock: func() {
+				mockDB.EXPECT().StreamCoinHistory(gomock.Any(), int32(1), gomock.Any()).DoAndReturn(streamHistory)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusOK,
+				expectedContentType: "application/json",
+				expectedBody:        `[{"fromUser":"user1","toUser":"user2","amount":100},{"fromUser":"user3","toUser":"user1","amount":50}]` + "\n",
+			},
+		},
+		{
+			name:   "JSON Lines",
+			accept: "application/x-ndjson",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().StreamCoinHistory(gomock.Any(), int32(1), gomock.Any()).DoAndReturn(streamHistory)
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusOK,
+				expectedContentType: "application/x-ndjson",
+				expectedBody:        "{\"fromUser\":\"user1\",\"toUser\":\"user2\",\"amount\":100}\n{\"fromUser\":\"user3\",\"toUser\":\"user1\",\"amount\":50}\n",
+			},
+		},
+		{
+			name:   "JSON Lines error before the first row",
+			accept: "application/x-ndjson",
+			token:  token,
+			setupMock: func() {
+				mockDB.EXPECT().StreamCoinHistory(gomock.Any(), int32(1), gomock.Any()).Return(errors.New("history error"))
+			},
+			expected: expectedData{
+				expectedStatusCode:  http.StatusInternalServerError,
+				expectedContentType: "application/json",
+				expectedBody:        "{\"errors\":\"history error\"}\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			client := client.WithToken(tc.token)
+			if tc.accept != "" {
+				client = client.WithHeader("Accept", tc.accept)
+			}
+
+			resp := client.Get(t, "/api/history")
+			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, tc.expected.expectedContentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+		})
+	}
+}
+
+func TestAccountExportHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	createdAt := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	records := []struct {
+		section string
+		record  any
+	}{
+		{storage.ExportSectionAccount, &models.AccountExport{ID: 1, Username: "alice", Coins: 900, IsActive: true, CreatedAt: createdAt, UpdatedAt: createdAt}},
+		{storage.ExportSectionPurchases, models.PurchaseExport{ID: 7, Item: "cup", Quantity: 1, CreatedAt: createdAt}},
+		{storage.ExportSectionPurchases, models.PurchaseExport{ID: 8, Item: "pen", Quantity: 2, GiftedTo: "bob", CreatedAt: createdAt}},
+		{storage.ExportSectionAccruals, models.AccrualExport{Period: "2025-05", Amount: 100, CreatedAt: createdAt}},
+	}
+	streamExport := func(ctx context.Context, userID int32, fn func(string, any) error) error {
+		for _, record := range records {
+			if err := fn(record.section, record.record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	exportRequest := func(t *testing.T) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, testServer.URL+"/api/account/export", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	t.Run("Document", func(t *testing.T) {
+		mockDB.EXPECT().ReserveDataExport(gomock.Any(), int32(1), now, app.DataExportInterval).Return(now.Add(app.DataExportInterval), nil)
+		mockDB.EXPECT().StreamUserExport(gomock.Any(), int32(1), gomock.Any()).DoAndReturn(streamExport)
+
+		resp, body := exportRequest(t)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		assert.JSONEq(t, `{
+			"account": {"id": 1, "username": "alice", "coins": 900, "isActive": true, "isAdmin": false,
+				"createdAt": "2025-05-01T10:00:00Z", "updatedAt": "2025-05-01T10:00:00Z"},
+			"purchases": [
+				{"id": 7, "item": "cup", "quantity": 1, "fulfilledQuantity": 0, "createdAt": "2025-05-01T10:00:00Z"},
+				{"id": 8, "item": "pen", "quantity": 2, "fulfilledQuantity": 0, "giftedTo": "bob", "createdAt": "2025-05-01T10:00:00Z"}
+			],
+			"transfers": [],
+			"scheduledTransfers": [],
+			"accruals": [{"period": "2025-05", "amount": 100, "createdAt": "2025-05-01T10:00:00Z"}],
+			"failedPurchases": [],
+			"sessions": [],
+			"activity": []
+		}`, body)
+		assert.NotContains(t, strings.ToLower(body), "password")
+	})
+
+	t.Run("Too soon", func(t *testing.T) {
+		mockDB.EXPECT().ReserveDataExport(gomock.Any(), int32(1), now, app.DataExportInterval).
+			Return(now.Add(30*time.Minute+500*time.Millisecond), storage.ErrDataExportTooSoon)
+
+		resp, body := exportRequest(t)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "1801", resp.Header.Get("Retry-After"))
+		assert.Equal(t, "{\"errors\":\"data export is allowed once per hour\"}\n", body)
+	})
+
+	t.Run("Error before the document", func(t *testing.T) {
+		mockDB.EXPECT().ReserveDataExport(gomock.Any(), int32(1), now, app.DataExportInterval).Return(now.Add(app.DataExportInterval), nil)
+		mockDB.EXPECT().StreamUserExport(gomock.Any(), int32(1), gomock.Any()).Return(errors.New("export error"))
+
+		resp, body := exportRequest(t)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"export error\"}\n", body)
+	})
+
+	t.Run("Error within the document", func(t *testing.T) {
+		mockDB.EXPECT().ReserveDataExport(gomock.Any(), int32(1), now, app.DataExportInterval).Return(now.Add(app.DataExportInterval), nil)
+		mockDB.EXPECT().StreamUserExport(gomock.Any(), int32(1), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, userID int32, fn func(string, any) error) error {
+				if err := fn(records[0].section, records[0].record); err != nil {
+					return err
+				}
+				return errors.New("export error")
+			})
+
+		resp, body := exportRequest(t)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.False(t, json.Valid([]byte(body)), "an interrupted export must not look complete")
+	})
+}
+
+func TestHistoryHandler_StreamsWithoutBuffering(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	const totalRows = 100_000
+	firstLineRead := make(chan struct{})
+
+	mockDB.EXPECT().StreamCoinHistory(gomock.Any(), int32(1), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, userID int32, fn func(models.TransactionDetail) error) error {
+			for i := 0; i < totalRows; i++ {
+				if i == totalRows/2 {
+					// Half of the rows are produced: a buffering handler would not have sent anything yet.
+					select {
+					case <-firstLineRead:
+					case <-time.After(5 * time.Second):
+						return errors.New("client received nothing while rows were being produced")
+					}
+				}
+				if err := fn(models.TransactionDetail{FromUser: "user1", ToUser: "user2", Amount: i + 1}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	req, err := http.NewRequest(http.MethodGet, testServer.URL+"/api/history", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	lines := 0
+	for scanner.Scan() {
+		var transactionDetail models.TransactionDetail
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &transactionDetail))
+		lines++
+		if lines == 1 {
+			close(firstLineRead)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, totalRows, lines)
+}
+
+func TestActiveUserMiddleware_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetUserValidation(time.Minute)
+
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	t.Run("Deleted user", func(t *testing.T) {
+		token, err := auth.GenerateToken(2)
+		require.NoError(t, err)
+
+		mockDB.EXPECT().GetTokenVersion(gomock.Any(), int32(2)).Return(int32(0), false, nil)
+
+		resp := client.WithToken(token).Get(t, "/api/buy/item1")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"account no longer active\",\"code\":\"ACCOUNT_INACTIVE\"}\n", resp.Body)
+	})
+
+	t.Run("Lookup error", func(t *testing.T) {
+		token, err := auth.GenerateToken(3)
+		require.NoError(t, err)
+
+		mockDB.EXPECT().GetTokenVersion(gomock.Any(), int32(3)).Return(int32(0), false, errors.New("lookup error"))
+
+		resp := client.WithToken(token).Get(t, "/api/buy/item1")
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"lookup error\"}\n", resp.Body)
+	})
+
+	t.Run("Active user is checked once", func(t *testing.T) {
+		token, err := auth.GenerateToken(1)
+		require.NoError(t, err)
+
+		mockDB.EXPECT().GetTokenVersion(gomock.Any(), int32(1)).Return(int32(0), true, nil).Times(1)
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "item1").Return(&models.PurchaseResult{Item: "item1"}, nil).Times(2)
+
+		for i := 0; i < 2; i++ {
+			resp := client.WithToken(token).Get(t, "/api/buy/item1")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("Token from before a forced logout", func(t *testing.T) {
+		before, err := auth.IssueVersionedToken(4, 0)
+		require.NoError(t, err)
+		mockDB.EXPECT().GetTokenVersion(gomock.Any(), int32(4)).Return(int32(0), true, nil)
+		mockDB.EXPECT().GetInfo(gomock.Any(), int32(4)).Return(&models.InfoResponse{}, nil)
+		resp := client.WithToken(before.Token).Get(t, "/api/info")
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().BumpTokenVersion(gomock.Any(), int32(4)).Return(int32(1), nil)
+		resp = client.WithUser(t, 1).Post(t, "/api/admin/users/4/logout", nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode, resp.Body)
+
+		mockDB.EXPECT().GetTokenVersion(gomock.Any(), int32(4)).Return(int32(1), true, nil)
+		resp = client.WithToken(before.Token).Get(t, "/api/info")
+		resp.AssertErrorCode(t, http.StatusUnauthorized, models.ErrCodeTokenStale, "token is no longer valid; sign in again")
+
+		after, err := auth.IssueVersionedToken(4, 1)
+		require.NoError(t, err)
+		mockDB.EXPECT().GetInfo(gomock.Any(), int32(4)).Return(&models.InfoResponse{}, nil)
+		resp = client.WithToken(after.Token).Get(t, "/api/info")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "a token issued after the logout must be accepted")
+
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().BumpTokenVersion(gomock.Any(), int32(99)).Return(int32(0), storage.ErrUserNotFound)
+		resp = client.WithUser(t, 1).Post(t, "/api/admin/users/99/logout", nil)
+		resp.AssertError(t, http.StatusNotFound, "user not found")
+	})
+}
+
+func TestTransfersHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	type expectedData struct {
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	testCases := []struct {
+		name      string
+		path      string
+		token     string
+		setupMock func()
+		expected  expectedData
+	}{
+		{
+			name:      "Unauthorized - no token",
+			path:      "/api/transfers",
+			token:     "",
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusUnauthorized,
+				expectedBody:       "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
+			},
+		},
+		{
+			name:      "Invalid limit",
+			path:      "/api/transfers?limit=abc",
+			token:     token,
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid limit\"}\n",
+			},
+		},
+		{
+			name:      "Invalid cursor",
+			path:      "/api/transfers?cursor=bm90LWEtY3Vyc29y.c2ln",
+			token:     token,
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid cursor\"}\n",
+			},
+		},
+		{
+			name:      "Invalid direction",
+			path:      "/api/transfers?direction=up",
+			token:     token,
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid direction\"}\n",
+			},
+		},
+		{
+			name:  "Storage error",
+			path:  "/api/transfers",
+			token: token,
+			setupMock: func() {
+				mockDB.EXPECT().GetTransfers(gomock.Any(), int32(1), gomock.Any()).Return(nil, errors.New("transfers error"))
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusInternalServerError,
+				expectedBody:       "{\"errors\":\"transfers error\"}\n",
+			},
+		},
+		{
+			name:  "Last page",
+			path:  "/api/transfers?direction=sent&limit=10",
+			token: token,
+			setupMock: func() {
+				mockDB.EXPECT().GetTransfers(gomock.Any(), int32(1), models.TransfersFilter{Direction: "sent", Limit: 11}).
+					Return([]models.Transfer{{ID: 5, FromUser: "user1", ToUser: "user2", Amount: 10, CreatedAt: createdAt}}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusOK,
+				expectedBody:       `{"transfers":[{"id":5,"fromUser":"user1","toUser":"user2","amount":10,"createdAt":"2025-01-02T03:04:05Z"}],"limit":10}`,
+			},
+		},
+		{
+			name:      "Invalid includeArchived",
+			path:      "/api/transfers?includeArchived=maybe",
+			token:     token,
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid includeArchived value; expected a boolean\"}\n",
+			},
+		},
+		{
+			name:  "Include archived",
+			path:  "/api/transfers?includeArchived=true&limit=10",
+			token: token,
+			setupMock: func() {
+				mockDB.EXPECT().GetTransfers(gomock.Any(), int32(1), models.TransfersFilter{Direction: "all", Limit: 11, IncludeArchived: true}).
+					DoAndReturn(func(ctx context.Context, userID int32, filter models.TransfersFilter) ([]models.Transfer, error) {
+						deadline, ok := ctx.Deadline()
+						require.True(t, ok)
+						assert.Greater(t, time.Until(deadline), requestTimeout, "reads of the archive must get a longer deadline")
+						return []models.Transfer{{ID: 1, FromUser: "user1", ToUser: "user2", Amount: 10, CreatedAt: createdAt}}, nil
+					})
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusOK,
+				expectedBody:       `{"transfers":[{"id":1,"fromUser":"user1","toUser":"user2","amount":10,"createdAt":"2025-01-02T03:04:05Z"}],"limit":10}`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			resp := client.WithToken(tc.token).Get(t, tc.path)
+			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+		})
+	}
+}
+
+func TestTransferHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	createdAt := time.Date(2025, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	type expectedData struct {
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	testCases := []struct {
+		name      string
+		path      string
+		setupMock func()
+		expected  expectedData
+	}{
+		{
+			name:      "Invalid ID",
+			path:      "/api/transfers/abc",
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid transfer id\"}\n",
+			},
+		},
+		{
+			name: "Transfer of other users is not found",
+			path: "/api/transfers/7",
+			setupMock: func() {
+				mockDB.EXPECT().GetTransfer(gomock.Any(), int32(1), int64(7)).Return(nil, storage.ErrTransferNotFound)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusNotFound,
+				expectedBody:       "{\"errors\":\"transfer not found\"}\n",
+			},
+		},
+		{
+			name: "Storage error",
+			path: "/api/transfers/7",
+			setupMock: func() {
+				mockDB.EXPECT().GetTransfer(gomock.Any(), int32(1), int64(7)).Return(nil, errors.New("db error"))
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusInternalServerError,
+				expectedBody:       "{\"errors\":\"db error\"}\n",
+			},
+		},
+		{
+			name: "Transfer of the requester",
+			path: "/api/transfers/12345",
+			setupMock: func() {
+				mockDB.EXPECT().GetTransfer(gomock.Any(), int32(1), int64(12345)).
+					Return(&models.Transfer{ID: 12345, FromUser: "alice", ToUser: "bob", Amount: 40, CreatedAt: createdAt}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusOK,
+				expectedBody:       `{"id":12345,"fromUser":"alice","toUser":"bob","amount":40,"createdAt":"2025-02-03T04:05:06Z"}`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			resp := client.WithToken(token).Get(t, tc.path)
+			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+		})
+	}
+}
+
+func TestScheduledTransferHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	executeAt := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	createdAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	type expectedData struct {
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		requestBody []byte
+		setupMock   func()
+		expected    expectedData
+	}{
+		{
+			name:        "Schedule in the past",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin/schedule",
+			requestBody: []byte(`{"toUser": "bob", "amount": 40, "executeAt": "2025-06-01T11:59:00Z"}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"executeAt must be an RFC 3339 time in the future, at most 90 days ahead\"}\n",
+			},
+		},
+		{
+			name:        "Schedule with a fractional amount",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin/schedule",
+			requestBody: []byte(`{"toUser": "bob", "amount": 40.5, "executeAt": "2025-06-02T09:00:00Z"}`),
+			setupMock:   func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"amount must be a non-negative integer\",\"code\":\"AMOUNT_INVALID\"}\n",
+			},
+		},
+		{
+			name:        "Schedule with insufficient funds",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin/schedule",
+			requestBody: []byte(`{"toUser": "bob", "amount": 40, "executeAt": "2025-06-02T09:00:00Z"}`),
+			setupMock: func() {
+				mockDB.EXPECT().CreateScheduledTransfer(gomock.Any(), int32(1), models.SendCoinRequest{ToUser: "bob", Amount: 40}, executeAt).
+					Return(nil, storage.ErrInsufficientFunds)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"insufficient funds to perform the transfer\"}\n",
+			},
+		},
+		{
+			name:        "Schedule",
+			method:      http.MethodPost,
+			path:        "/api/sendCoin/schedule",
+			requestBody: []byte(`{"toUser": "bob", "amount": 40, "executeAt": "2025-06-02T09:00:00Z"}`),
+			setupMock: func() {
+				mockDB.EXPECT().CreateScheduledTransfer(gomock.Any(), int32(1), models.SendCoinRequest{ToUser: "bob", Amount: 40}, executeAt).
+					Return(&models.ScheduledTransfer{ID: 3, FromUserID: 1, ToUser: "bob", Amount: 40, ExecuteAt: executeAt,
+						Status: storage.ScheduledTransferPending, CreatedAt: createdAt}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusCreated,
+				expectedBody:       `{"id":3,"toUser":"bob","amount":40,"executeAt":"2025-06-02T09:00:00Z","status":"pending","createdAt":"2025-06-01T12:00:00Z"}`,
+			},
+		},
+		{
+			name:   "List",
+			method: http.MethodGet,
+			path:   "/api/sendCoin/scheduled",
+			setupMock: func() {
+				mockDB.EXPECT().GetScheduledTransfers(gomock.Any(), int32(1)).Return([]models.ScheduledTransfer{{
+					ID: 2, ToUser: "carol", Amount: 10, ExecuteAt: createdAt, Status: storage.ScheduledTransferFailed,
+					FailureReason: "recipient no longer exists", CreatedAt: createdAt,
+				}}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusOK,
+				expectedBody: `{"scheduledTransfers":[{"id":2,"toUser":"carol","amount":10,"executeAt":"2025-06-01T12:00:00Z",` +
+					`"status":"failed","failureReason":"recipient no longer exists","createdAt":"2025-06-01T12:00:00Z"}]}`,
+			},
+		},
+		{
+			name:      "Cancel with invalid ID",
+			method:    http.MethodDelete,
+			path:      "/api/sendCoin/scheduled/abc",
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid scheduled transfer id\"}\n",
+			},
+		},
+		{
+			name:   "Cancel a transfer that is not pending",
+			method: http.MethodDelete,
+			path:   "/api/sendCoin/scheduled/2",
+			setupMock: func() {
+				mockDB.EXPECT().CancelScheduledTransfer(gomock.Any(), int32(1), int64(2), now).Return(storage.ErrScheduledTransferNotPending)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusNotFound,
+				expectedBody:       "{\"errors\":\"pending scheduled transfer not found\"}\n",
+			},
+		},
+		{
+			name:   "Cancel",
+			method: http.MethodDelete,
+			path:   "/api/sendCoin/scheduled/3",
+			setupMock: func() {
+				mockDB.EXPECT().CancelScheduledTransfer(gomock.Any(), int32(1), int64(3), now).Return(nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusNoContent,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			resp := client.WithToken(token).Do(t, tc.method, tc.path, tc.requestBody)
+			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+		})
+	}
+}
+
+func TestFeatureFlags_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+
+	path := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"strict_json": true}`), 0o600))
+	flags := featureflag.New(path, time.Minute, l)
+	require.NoError(t, flags.Reload())
+
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetFeatureFlags(flags)
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	t.Run("Strict JSON rejects unknown fields", func(t *testing.T) {
+		resp := client.WithToken(token).Post(t, "/api/sendCoin", []byte(`{"toUser": "bob", "amount": 10, "note": "hi"}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"json: unknown field \\\"note\\\"\"}\n", resp.Body)
+	})
+
+	t.Run("Strict JSON rejects trailing data", func(t *testing.T) {
+		resp := client.WithToken(token).Post(t, "/api/sendCoin", []byte(`{"toUser": "bob", "amount": 10} {}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"unexpected data after the JSON value\"}\n", resp.Body)
+	})
+
+	t.Run("Strict JSON accepts known fields", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), models.SendCoinRequest{ToUser: "bob", Amount: 10}).Return(&models.TransferResult{TransferID: 7}, nil)
+
+		resp := client.WithToken(token).Post(t, "/api/sendCoin", []byte(`{"toUser": "bob", "amount": 10}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Admins list effective flags", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+		resp := client.WithToken(token).Get(t, "/api/admin/flags")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"flags":[{"name":"public_routes","enabled":false,"percentage":100,"source":"default"},`+
+			`{"name":"purchase_queue","enabled":true,"percentage":100,"source":"default"},`+
+			`{"name":"strict_json","enabled":true,"percentage":100,"source":"file"}]}`, resp.Body)
+	})
+
+	t.Run("Flags are admin only", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.WithToken(token).Get(t, "/api/admin/flags")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestCatalogHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	catalog := []models.CatalogItem{{Name: "t-shirt", Price: 80}, {Name: "cup", Price: 20}}
+	catalogClock := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 500, time.UTC))
+	lastModified := catalogClock.Now()
+	mockDB.EXPECT().GetCatalogLastModified(gomock.Any()).DoAndReturn(func(context.Context) (time.Time, error) {
+		return lastModified, nil
+	}).AnyTimes()
+
+	t.Run("Public without token", func(t *testing.T) {
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+
+		resp := client.Get(t, "/api/merch")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "public, max-age=300", resp.Header.Get("Cache-Control"))
+		assert.NotEmpty(t, resp.Header.Get("ETag"))
+		assert.Equal(t, `[{"name":"t-shirt","price":80},{"name":"cup","price":20}]`, resp.Body)
+	})
+
+	t.Run("Conditional request", func(t *testing.T) {
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil).Times(3)
+
+		resp := client.Get(t, "/api/merch")
+		etag := resp.Header.Get("ETag")
+
+		for _, ifNoneMatch := range []string{etag, `"other", W/` + etag} {
+			resp := client.WithHeader("If-None-Match", ifNoneMatch).Get(t, "/api/merch")
+			assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+			assert.Equal(t, etag, resp.Header.Get("ETag"))
+			assert.Empty(t, resp.Body)
+		}
+	})
+
+	t.Run("Changed catalog", func(t *testing.T) {
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+		resp := client.Get(t, "/api/merch")
+		etag := resp.Header.Get("ETag")
+
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return([]models.CatalogItem{{Name: "t-shirt", Price: 90}}, nil)
+		resp = client.WithHeader("If-None-Match", etag).Get(t, "/api/merch")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	})
+
+	t.Run("If-Modified-Since", func(t *testing.T) {
+		conditionalGet := func(ifModifiedSince, ifNoneMatch string) *servicetest.Response {
+			conditional := client.WithHeader("If-Modified-Since", ifModifiedSince)
+			if ifNoneMatch != "" {
+				conditional = conditional.WithHeader("If-None-Match", ifNoneMatch)
+			}
+			return conditional.Get(t, "/api/merch")
+		}
+
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil).Times(4)
+		resp := client.Get(t, "/api/merch")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		modified := resp.Header.Get("Last-Modified")
+		assert.Equal(t, "Sun, 01 Jun 2025 12:00:00 GMT", modified)
+
+		assert.Equal(t, http.StatusNotModified, conditionalGet(modified, "").StatusCode,
+			"a catalog last modified within the second of the header must not be sent again")
+		assert.Equal(t, http.StatusOK, conditionalGet("Sun, 01 Jun 2025 11:59:59 GMT", "").StatusCode)
+		assert.Equal(t, http.StatusOK, conditionalGet(modified, `"other"`).StatusCode,
+			"If-None-Match must take precedence over If-Modified-Since")
+
+		catalogClock.Advance(time.Hour)
+		lastModified = catalogClock.Now()
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return([]models.CatalogItem{{Name: "t-shirt", Price: 90}}, nil)
+		resp = conditionalGet(modified, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "a price change must invalidate cached copies")
+		assert.Equal(t, "Sun, 01 Jun 2025 13:00:00 GMT", resp.Header.Get("Last-Modified"))
+	})
+
+	t.Run("Info still requires token", func(t *testing.T) {
+		resp := client.Get(t, "/api/info")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n", resp.Body)
+	})
+}
+
+func TestAccrualHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetMonthlyAccrual(app.NewMonthlyAccrual(mockDB, 100, time.Hour, clock.Real{}, l))
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	period := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type expectedData struct {
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	testCases := []struct {
+		name        string
+		token       string
+		requestBody []byte
+		setupMock   func()
+		expected    expectedData
+	}{
+		{
+			name:      "Unauthorized - no token",
+			token:     "",
+			setupMock: func() {},
+			expected: expectedData{
+				expectedStatusCode: http.StatusUnauthorized,
+				expectedBody:       "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
+			},
+		},
+		{
+			name:  "Forbidden for non-admins",
+			token: token,
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusForbidden,
+				expectedBody:       "{\"errors\":\"administrator rights required\",\"code\":\"ADMIN_REQUIRED\"}\n",
+			},
+		},
+		{
+			name:        "Invalid period",
+			token:       token,
+			requestBody: []byte(`{"period": "January"}`),
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid period; expected YYYY-MM\"}\n",
+			},
+		},
+		{
+			name:        "Malformed body",
+			token:       token,
+			requestBody: []byte(`{"period": "2025-01"`),
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"unexpected end of JSON input\"}\n",
+			},
+		},
+		{
+			name:        "Already accrued",
+			token:       token,
+			requestBody: []byte(`{"period": "2025-01"}`),
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+				mockDB.EXPECT().AccrueMonthlyCoins(gomock.Any(), period, 100).Return(0, storage.ErrAccrualAlreadyDone)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusConflict,
+				expectedBody:       "{\"errors\":\"accrual for the period has already been executed\"}\n",
+			},
+		},
+		{
+			name:        "Successful accrual",
+			token:       token,
+			requestBody: []byte(`{"period": "2025-01"}`),
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+				mockDB.EXPECT().AccrueMonthlyCoins(gomock.Any(), period, 100).Return(42, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusOK,
+				expectedBody:       `{"period":"2025-01","amount":100,"usersCredited":42}`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			resp := client.WithToken(tc.token).Post(t, "/api/admin/accruals", tc.requestBody)
+			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+		})
+	}
+}
+
+func TestAdminRequestSignature_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetMonthlyAccrual(app.NewMonthlyAccrual(mockDB, 100, time.Hour, clock.Real{}, l))
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	verifier := auth.NewRequestVerifier([]byte("admin-secret"), auth.SignatureWindow, clock.Real{})
+	service.SetAdminRequestVerifier(verifier)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	const path = "/api/admin/accruals"
+	requestBody := []byte(`{"period": "2025-01"}`)
+
+	resp := client.WithToken(token).Post(t, path, requestBody)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "an admin token alone is not enough")
+	assert.Equal(t, "{\"errors\":\"missing request signature\",\"code\":\"SIGNATURE_INVALID\"}\n", resp.Body)
+
+	mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+	mockDB.EXPECT().AccrueMonthlyCoins(gomock.Any(), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 100).Return(42, nil)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	resp = client.WithToken(token).
+		WithHeader(auth.HeaderAdminTimestamp, timestamp).
+		WithHeader(auth.HeaderAdminNonce, "nonce-1").
+		WithHeader(auth.HeaderAdminSignature, verifier.Sign(http.MethodPost, path, timestamp, "nonce-1", requestBody)).
+		Post(t, path, requestBody)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"period":"2025-01","amount":100,"usersCredited":42}`, resp.Body)
+}
+
+func TestFailedPurchaseStatsHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	type expectedData struct {
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	testCases := []struct {
+		name      string
+		query     string
+		setupMock func()
+		expected  expectedData
+	}{
+		{
+			name:  "Forbidden for non-admins",
+			query: "",
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusForbidden,
+				expectedBody:       "{\"errors\":\"administrator rights required\",\"code\":\"ADMIN_REQUIRED\"}\n",
+			},
+		},
+		{
+			name:  "Invalid date",
+			query: "?from=2025-13-01",
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusBadRequest,
+				expectedBody:       "{\"errors\":\"invalid date range; expected from and to as YYYY-MM-DD with from not after to\"}\n",
+			},
+		},
+		{
+			name:  "Successful aggregation",
+			query: "?from=2025-01-01&to=2025-01-31",
+			setupMock: func() {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+				mockDB.EXPECT().GetFailedPurchaseStats(gomock.Any(), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)).
+					Return([]models.FailedPurchaseStat{{Item: "pink-hoody", Reason: "insufficient_funds", Count: 12}, {Item: "unicorn", Reason: "item_not_found", Count: 3}}, nil)
+			},
+			expected: expectedData{
+				expectedStatusCode: http.StatusOK,
+				expectedBody:       `{"from":"2025-01-01","to":"2025-01-31","stats":[{"item":"pink-hoody","reason":"insufficient_funds","count":12},{"item":"unicorn","reason":"item_not_found","count":3}]}`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setupMock()
+			resp := client.WithToken(token).Get(t, "/api/admin/stats/failed-purchases"+tc.query)
+			assert.Equal(t, tc.expected.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, tc.expected.expectedBody, resp.Body)
+		})
+	}
+}
+
+func TestSessionLimit_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetSessionLimit(3)
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	// The registry emulates the storage contract: registering a session beyond the limit revokes the oldest one.
+	var sessions []models.Session
+	revoked := map[string]bool{}
+	mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(&models.User{ID: 1, Username: "user"}, nil).Times(4)
+	mockDB.EXPECT().CreateSession(gomock.Any(), gomock.Any(), 3).Times(4).DoAndReturn(func(_ context.Context, session models.Session, limit int) error {
+		sessions = append(sessions, session)
+		active := 0
+		for i := len(sessions) - 1; i >= 0; i-- {
+			if revoked[sessions[i].ID] {
+				continue
+			}
+			if active++; active > limit {
+				revoked[sessions[i].ID] = true
+			}
+		}
+		return nil
+	})
+	mockDB.EXPECT().IsSessionActive(gomock.Any(), int32(1), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, _ int32, sessionID string) (bool, error) {
+		for _, session := range sessions {
+			if session.ID == sessionID {
+				return !revoked[sessionID], nil
+			}
+		}
+		return false, nil
+	})
+	mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).AnyTimes().Return(&models.InfoResponse{Coins: 1000}, nil)
+
+	tokens := make([]string, 4)
+	for i := range tokens {
+		resp := client.Post(t, "/api/auth", []byte(`{"username": "user", "password": "password"}`))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var authResponse models.AuthResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &authResponse))
+		tokens[i] = authResponse.Token
+	}
+
+	resp := client.WithToken(tokens[0]).Get(t, "/api/info")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "the oldest session must be revoked by the fourth sign-in")
+	assert.Equal(t, "{\"errors\":\"session revoked\",\"code\":\"SESSION_REVOKED\"}\n", resp.Body)
+
+	for _, token := range tokens[1:] {
+		resp := client.WithToken(token).Get(t, "/api/info")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestSessionsHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(fakeClock)
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.IssueToken(1)
+	require.NoError(t, err)
+
+	resp := client.WithToken(token.Token).Get(t, "/api/auth/sessions")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "sessions are not tracked by default")
+	assert.Equal(t, "{\"errors\":\"session tracking is disabled\"}\n", resp.Body)
+
+	appInstance.SetSessionLimit(3)
+	issuedAt := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	mockDB.EXPECT().IsSessionActive(gomock.Any(), int32(1), token.ID).AnyTimes().Return(true, nil)
+	mockDB.EXPECT().GetActiveSessions(gomock.Any(), int32(1), fakeClock.Now()).Return([]models.Session{
+		{ID: token.ID, UserID: 1, UserAgent: "curl/8.0", IssuedAt: issuedAt, ExpiresAt: issuedAt.Add(3 * time.Hour)},
+		{ID: "older", UserID: 1, UserAgent: "Mozilla/5.0", IssuedAt: issuedAt.Add(-time.Hour), ExpiresAt: issuedAt.Add(2 * time.Hour)},
+	}, nil)
+
+	resp = client.WithToken(token.Token).Get(t, "/api/auth/sessions")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"sessions":[{"id":"`+token.ID+`","userAgent":"curl/8.0","issuedAt":"2025-01-01T10:00:00Z","expiresAt":"2025-01-01T13:00:00Z","current":true},`+
+		`{"id":"older","userAgent":"Mozilla/5.0","issuedAt":"2025-01-01T09:00:00Z","expiresAt":"2025-01-01T12:00:00Z","current":false}]}`, resp.Body)
+
+	mockDB.EXPECT().RevokeSession(gomock.Any(), int32(1), "older").Return(nil)
+	resp = client.WithToken(token.Token).Delete(t, "/api/auth/sessions/older")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Empty(t, resp.Body)
+
+	mockDB.EXPECT().RevokeSession(gomock.Any(), int32(1), "foreign").Return(storage.ErrSessionNotFound)
+	resp = client.WithToken(token.Token).Delete(t, "/api/auth/sessions/foreign")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "{\"errors\":\"session not found\"}\n", resp.Body)
+}
+
+func TestHandlers_MissingUserContext(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	handlers := newHandlers(app.NewApp(nil, l), l)
+
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "buy", handler: handlers.buyItemHandler},
+		{name: "gift", handler: handlers.giftItemHandler},
+		{name: "sendCoin", handler: handlers.sendCoinHandler},
+		{name: "info", handler: handlers.infoHandler},
+		{name: "activeUserMiddleware", handler: handlers.activeUserMiddleware(http.NotFoundHandler()).ServeHTTP},
+		{name: "adminOnlyMiddleware", handler: handlers.adminOnlyMiddleware(http.NotFoundHandler()).ServeHTTP},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, http.StatusInternalServerError, rec.Code, "a route without the auth middleware is a routing bug, not a 401")
+			assert.Equal(t, "{\"errors\":\"missing authenticated user in request context\"}\n", rec.Body.String())
+		})
+	}
+}
+
+func TestDecodeOptionalJSONBody(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	h := newHandlers(app.NewApp(nil, l), l)
+
+	testCases := []struct {
+		name           string
+		body           string
+		expectedOK     bool
+		expectedPeriod string
+		expectedBody   string
+	}{
+		{name: "Missing body", body: "", expectedOK: true},
+		{name: "Whitespace-only body", body: " \n\t", expectedOK: true},
+		{name: "Payload", body: `{"period": "2025-01"}`, expectedOK: true, expectedPeriod: "2025-01"},
+		{
+			name:         "Malformed payload",
+			body:         `{"period": `,
+			expectedBody: "{\"errors\":\"unexpected end of JSON input\"}\n",
+		},
+		{
+			name:         "Invalid field",
+			body:         `{"period": "` + strings.Repeat("x", 300) + `"}`,
+			expectedBody: "{\"errors\":\"invalid period: must be at most 64 characters\",\"code\":\"FIELD_INVALID\"}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/accruals", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+
+			var accrualRequest models.AccrualRequest
+			ok := h.decodeOptionalJSONBody(rec, req, &accrualRequest)
+			assert.Equal(t, tc.expectedOK, ok)
+			if tc.expectedOK {
+				assert.Equal(t, tc.expectedPeriod, accrualRequest.Period)
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestAuthMetrics_Gomock(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	scrape := func() map[string]int64 {
+		resp := client.Get(t, "/metrics")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		samples := make(map[string]int64)
+		scanner := bufio.NewScanner(bytes.NewBufferString(resp.Body))
+		for scanner.Scan() {
+			var name string
+			var value int64
+			if _, err := fmt.Sscan(scanner.Text(), &name, &value); err == nil {
+				samples[name] = value
+			}
+		}
+		return samples
+	}
+	outcome := func(name string) string {
+		return "merch_store_auth_outcomes_total{outcome=\"" + name + "\"}"
+	}
+	const issued = "merch_store_auth_tokens_issued_total"
+
+	expiredToken, err := auth.NewTokenManager([]byte(auth.SECRETKEY), -time.Minute, clock.Real{}).GenerateToken(1)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		setup      func()
+		send       func() *servicetest.Response
+		statusCode int
+		increments []string
+	}{
+		{
+			name: "Registration",
+			setup: func() {
+				mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(&models.User{}, nil)
+				mockDB.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(&models.User{ID: 1}, nil)
+			},
+			send: func() *servicetest.Response {
+				return client.Post(t, "/api/auth", []byte(`{"username":"new","password":"secret"}`))
+			},
+			statusCode: http.StatusOK,
+			increments: []string{outcome("registration"), issued},
+		},
+		{
+			name: "Login",
+			setup: func() {
+				mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(&models.User{ID: 1}, nil)
+			},
+			send: func() *servicetest.Response {
+				return client.Post(t, "/api/auth", []byte(`{"username":"user","password":"secret"}`))
+			},
+			statusCode: http.StatusOK,
+			increments: []string{outcome("login"), issued},
+		},
+		{
+			name: "BadPassword",
+			setup: func() {
+				mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(nil, bcrypt.ErrMismatchedHashAndPassword)
+			},
+			send: func() *servicetest.Response {
+				return client.Post(t, "/api/auth", []byte(`{"username":"user","password":"wrong"}`))
+			},
+			statusCode: http.StatusUnauthorized,
+			increments: []string{outcome("bad_password")},
+		},
+		{
+			name:  "ExpiredToken",
+			setup: func() {},
+			send: func() *servicetest.Response {
+				return client.WithToken(expiredToken).Get(t, "/api/info")
+			},
+			statusCode: http.StatusUnauthorized,
+			increments: []string{outcome("token_expired")},
+		},
+		{
+			name:  "InvalidToken",
+			setup: func() {},
+			send: func() *servicetest.Response {
+				return client.WithToken("forged").Get(t, "/api/info")
+			},
+			statusCode: http.StatusUnauthorized,
+			increments: []string{outcome("token_invalid")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setup()
+			before := scrape()
+
+			resp := tc.send()
+			require.Equal(t, tc.statusCode, resp.StatusCode)
+
+			after := scrape()
+			expected := make(map[string]int64, len(before))
+			for name, value := range before {
+				expected[name] = value
+			}
+			for _, name := range tc.increments {
+				require.Contains(t, before, name, "every series must be exported before it is first incremented")
+				expected[name]++
+			}
+			assert.Equal(t, expected, after)
+		})
+	}
+}
+
+func TestRegistrationMode_Gomock(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	unknownUser := func(mockDB *mocks.MockStorage) {
+		mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(&models.User{Username: "new"}, nil)
+	}
+
+	testCases := []struct {
+		name               string
+		mode               app.RegistrationMode
+		requestBody        string
+		setupMock          func(mockDB *mocks.MockStorage)
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:        "Open registers unknown users",
+			mode:        app.RegistrationOpen,
+			requestBody: `{"username":"new","password":"secret"}`,
+			setupMock: func(mockDB *mocks.MockStorage) {
+				unknownUser(mockDB)
+				mockDB.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(&models.User{ID: 1}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:        "Closed rejects unknown users",
+			mode:        app.RegistrationClosed,
+			requestBody: `{"username":"new","password":"secret"}`,
+			setupMock: func(mockDB *mocks.MockStorage) {
+				unknownUser(mockDB)
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       "{\"errors\":\"registration is closed\"}\n",
+		},
+		{
+			name:        "Closed lets existing users sign in",
+			mode:        app.RegistrationClosed,
+			requestBody: `{"username":"user","password":"secret"}`,
+			setupMock: func(mockDB *mocks.MockStorage) {
+				mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(&models.User{ID: 1}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:        "Invite requires a code",
+			mode:        app.RegistrationInvite,
+			requestBody: `{"username":"new","password":"secret"}`,
+			setupMock: func(mockDB *mocks.MockStorage) {
+				unknownUser(mockDB)
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       "{\"errors\":\"invite code required\"}\n",
+		},
+		{
+			name:        "Invite registers with a valid code",
+			mode:        app.RegistrationInvite,
+			requestBody: `{"username":"new","password":"secret","inviteCode":"abc"}`,
+			setupMock: func(mockDB *mocks.MockStorage) {
+				unknownUser(mockDB)
+				mockDB.EXPECT().CreateUserWithInvite(gomock.Any(), gomock.Any(), "abc", gomock.Any()).
+					DoAndReturn(func(_ context.Context, user *models.User, _ string, _ time.Time) (*models.User, error) {
+						assert.Equal(t, int64(1000), user.Coins)
+						user.ID = 1
+						return user, nil
+					})
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:        "Invite rejects a spent code",
+			mode:        app.RegistrationInvite,
+			requestBody: `{"username":"new","password":"secret","inviteCode":"spent"}`,
+			setupMock: func(mockDB *mocks.MockStorage) {
+				unknownUser(mockDB)
+				mockDB.EXPECT().CreateUserWithInvite(gomock.Any(), gomock.Any(), "spent", gomock.Any()).Return(&models.User{}, storage.ErrInviteCodeInvalid)
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       "{\"errors\":\"invalid or expired invite code\"}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockStorage(ctrl)
+			appInstance := app.NewApp(mockDB, l)
+			appInstance.SetRegistrationMode(tc.mode)
+			testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+			defer testServer.Close()
+			client := servicetest.NewClient(testServer)
+
+			tc.setupMock(mockDB)
+			resp := client.Post(t, "/api/auth", []byte(tc.requestBody))
+			assert.Equal(t, tc.expectedStatusCode, resp.StatusCode)
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, resp.Body)
+			}
+		})
+	}
+}
+
+func TestRegistrationCooldown_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	fakeClock := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	_, office, _ := net.ParseCIDR("198.51.100.0/24")
+	_, proxy, _ := net.ParseCIDR("127.0.0.1/32")
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(fakeClock)
+	appInstance.SetRegistrationCooldown(app.DefaultRegistrationCooldown, []*net.IPNet{office})
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	service.SetTrustedProxies([]*net.IPNet{proxy})
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	register := func(t *testing.T, clientIP string, username string) *servicetest.Response {
+		mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(&models.User{Username: username}, nil)
+		return client.WithHeader("X-Forwarded-For", clientIP).PostJSON(t, "/api/auth", models.AuthRequest{Username: username, Password: "secret"})
+	}
+	registered := func(ids ...int32) {
+		for _, id := range ids {
+			mockDB.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(&models.User{ID: id}, nil)
+		}
+	}
+
+	t.Run("Back to back registrations", func(t *testing.T) {
+		registered(1)
+		resp := register(t, "203.0.113.1", "first")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = register(t, "203.0.113.1", "second")
+		resp.AssertErrorCode(t, http.StatusTooManyRequests, models.ErrCodeRegistrationRateLimited, "too many registrations from this address, try again later")
+
+		registered(2)
+		resp = register(t, "203.0.113.2", "third")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "other addresses must not be blocked")
+	})
+
+	t.Run("Logins unaffected", func(t *testing.T) {
+		mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Return(&models.User{ID: 1, Username: "first"}, nil).Times(3)
+		for i := 0; i < 3; i++ {
+			resp := client.WithHeader("X-Forwarded-For", "203.0.113.1").PostJSON(t, "/api/auth", models.AuthRequest{Username: "first", Password: "secret"})
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		registered(3, 4)
+		for _, username := range []string{"office1", "office2"} {
+			resp := register(t, "198.51.100.7", username)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("Cooldown elapsed", func(t *testing.T) {
+		fakeClock.Advance(app.DefaultRegistrationCooldown)
+		registered(5)
+		resp := register(t, "203.0.113.1", "later")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestInviteHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	t.Run("Default validity", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().CreateInviteCode(gomock.Any(), gomock.Any(), int32(1)).Return(nil)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/invites", nil)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var invite models.InviteCode
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &invite))
+		assert.Len(t, invite.Code, 32)
+		assert.True(t, now.Add(app.DefaultInviteValidity).Equal(invite.ExpiresAt))
+	})
+
+	t.Run("Requested validity", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().CreateInviteCode(gomock.Any(), gomock.Any(), int32(1)).DoAndReturn(func(_ context.Context, invite models.InviteCode, _ int32) error {
+			assert.True(t, now.Add(time.Hour).Equal(invite.ExpiresAt))
+			return nil
+		})
+
+		resp := client.WithToken(token).Post(t, "/api/admin/invites", []byte(`{"validFor":"1h"}`))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+
+	t.Run("Invalid validity", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/invites", []byte(`{"validFor":"-1h"}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"invalid validFor; expected a positive duration of at most 90 days\"}\n", resp.Body)
+	})
+
+	t.Run("Malformed body", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/invites", []byte(`{"validFor":`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"unexpected end of JSON input\"}\n", resp.Body)
+	})
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/invites", nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(nil, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	for _, path := range []string{"/api", "/api/", "/api/byu/cup", "/api/info/extra", "/api/auth/unknown", "/api/v2/info"} {
+		t.Run(path, func(t *testing.T) {
+			resp := client.WithToken(token).Get(t, path)
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			assert.Equal(t, "{\"errors\":\"route not found\",\"code\":\"ROUTE_NOT_FOUND\"}\n", resp.Body)
+		})
+	}
+
+	t.Run("Unknown path without a token", func(t *testing.T) {
+		resp := client.Get(t, "/api/byu/cup")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"route not found\",\"code\":\"ROUTE_NOT_FOUND\"}\n", resp.Body)
+	})
+
+	t.Run("Non-API paths are unaffected", func(t *testing.T) {
+		for _, path := range []string{"/healthz", "/debug/pprof", "/apiinfo"} {
+			resp := client.Get(t, path)
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+			assert.Equal(t, "404 page not found\n", resp.Body, path)
+		}
+
+		resp := client.Get(t, "/metrics")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestBulkUsersHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	t.Run("Skips existing and repeated usernames", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().CreateUsersBulk(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, users []models.User) ([]models.User, error) {
+			require.Len(t, users, 3)
+			assert.Equal(t, []string{"alice", "bob", "carol"}, []string{users[0].Username, users[1].Username, users[2].Username})
+			assert.Equal(t, int64(1000), users[0].Coins, "the default balance must be used when none is given")
+			assert.Equal(t, int64(50), users[2].Coins)
+			// bob already exists, so the insert skips him in the middle of the batch.
+			return []models.User{{ID: 10, Username: "alice", Password: users[0].Password}, {ID: 11, Username: "carol", Password: users[2].Password}}, nil
+		})
+
+		requestBody := []byte(`{"users":[{"username":"alice"},{"username":"bob"},{"username":"carol","coins":50},{"username":"alice"}]}`)
+		resp := client.WithToken(token).Post(t, "/api/admin/users/bulk", requestBody)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+		var provisioned models.BulkUsersResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &provisioned))
+		require.Len(t, provisioned.Users, 4)
+		statuses := make([]string, len(provisioned.Users))
+		for i, user := range provisioned.Users {
+			statuses[i] = user.Status
+		}
+		assert.Equal(t, []string{models.BulkUserCreated, models.BulkUserExists, models.BulkUserCreated, models.BulkUserDuplicate}, statuses)
+		assert.Len(t, provisioned.Users[0].Password, 16)
+		assert.NotEqual(t, provisioned.Users[0].Password, provisioned.Users[2].Password)
+		assert.Empty(t, provisioned.Users[1].Password)
+		assert.Empty(t, provisioned.Users[3].Password)
+	})
+
+	testCases := []struct {
+		name         string
+		requestBody  []byte
+		expectedBody string
+	}{
+		{
+			name:         "Empty body",
+			expectedBody: "{\"errors\":\"request body is required\",\"code\":\"BODY_REQUIRED\"}\n",
+		},
+		{
+			name:         "No users",
+			requestBody:  []byte(`{"users":[]}`),
+			expectedBody: "{\"errors\":\"expected between 1 and 200 users\"}\n",
+		},
+		{
+			name:         "Too many users",
+			requestBody:  []byte(`{"users":[` + strings.Repeat(`{"username":"user"},`, app.MaxBulkUsers) + `{"username":"last"}]}`),
+			expectedBody: "{\"errors\":\"expected between 1 and 200 users\"}\n",
+		},
+		{
+			name:         "Negative balance",
+			requestBody:  []byte(`{"users":[{"username":"alice","coins":-1}]}`),
+			expectedBody: "{\"errors\":\"every user needs a username and a non-negative balance\"}\n",
+		},
+		{
+			name:         "Empty username",
+			requestBody:  []byte(`{"users":[{"username":""}]}`),
+			expectedBody: "{\"errors\":\"every user needs a username and a non-negative balance\"}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+			resp := client.WithToken(token).Post(t, "/api/admin/users/bulk", tc.requestBody)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Equal(t, tc.expectedBody, resp.Body)
+		})
+	}
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/users/bulk", []byte(`{"users":[{"username":"alice"}]}`))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestDeadlineTooClose_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	const expectedBody = "{\"errors\":\"request deadline exceeded\"}\n"
+
+	mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(nil, storage.ErrDeadlineTooClose)
+	resp := client.WithToken(token).Get(t, "/api/info")
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Equal(t, expectedBody, resp.Body)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "pen").Return(nil, storage.ErrDeadlineTooClose)
+	resp = client.WithToken(token).Get(t, "/api/buy/pen")
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Equal(t, expectedBody, resp.Body)
+
+	mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.Any()).Return(nil, fmt.Errorf("transfer: %w", storage.ErrDeadlineTooClose))
+	resp = client.WithToken(token).Post(t, "/api/sendCoin", []byte(`{"toUser":"user","amount":10}`))
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Equal(t, expectedBody, resp.Body)
+}
+
+func TestInputValidation_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         []byte
+		token        string
+		expectedBody string
+	}{
+		{
+			name:         "Invalid UTF-8 username",
+			method:       http.MethodPost,
+			path:         "/api/auth",
+			body:         []byte("{\"username\":\"al\xffice\",\"password\":\"secret\"}"),
+			expectedBody: "{\"errors\":\"invalid username: must be valid UTF-8\",\"code\":\"FIELD_INVALID\"}\n",
+		},
+		{
+			name:         "Huge recipient",
+			method:       http.MethodPost,
+			path:         "/api/sendCoin",
+			body:         []byte(`{"toUser":"` + strings.Repeat("b", 1<<20) + `","amount":10}`),
+			token:        token,
+			expectedBody: "{\"errors\":\"invalid toUser: must be at most 32 characters\",\"code\":\"FIELD_INVALID\"}\n",
+		},
+		{
+			name:         "Long item name",
+			method:       http.MethodGet,
+			path:         "/api/buy/" + strings.Repeat("x", 65),
+			token:        token,
+			expectedBody: "{\"errors\":\"invalid item: must be at most 64 characters\",\"code\":\"ITEM_NAME_TOO_LONG\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := client.WithToken(tt.token).Do(t, tt.method, tt.path, tt.body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Equal(t, tt.expectedBody, resp.Body)
+		})
+	}
+
+	t.Run("Normalized recipient", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), models.SendCoinRequest{ToUser: "José", Amount: 10}).Return(&models.TransferResult{TransferID: 1}, nil)
+		resp := client.WithToken(token).Post(t, "/api/sendCoin", []byte(`{"toUser":"  José ","amount":10}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestReverseTransferHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		body         []byte
+		partial      bool
+		reversal     *models.TransferReversal
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Full",
+			reversal:     &models.TransferReversal{TransferID: 7, ReversalTransferID: 9, FromUser: "alice", ToUser: "alexey", Amount: 500, ReversedAmount: 500, ReversedBy: 1},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"transferId":7,"reversalTransferId":9,"fromUser":"alice","toUser":"alexey","amount":500,"reversedAmount":500,"partial":false,"reversedBy":1,"reversedAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:         "Insufficient recipient balance",
+			err:          storage.ErrInsufficientFunds,
+			expectedCode: http.StatusConflict,
+			expectedBody: "{\"errors\":\"recipient no longer has enough coins; use mode partial to reverse what is available\"}\n",
+		},
+		{
+			name:         "Partial",
+			body:         []byte(`{"mode":"partial"}`),
+			partial:      true,
+			reversal:     &models.TransferReversal{TransferID: 7, ReversalTransferID: 9, FromUser: "alice", ToUser: "alexey", Amount: 500, ReversedAmount: 300, Partial: true, ReversedBy: 1},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"transferId":7,"reversalTransferId":9,"fromUser":"alice","toUser":"alexey","amount":500,"reversedAmount":300,"partial":true,"reversedBy":1,"reversedAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:         "Already reversed",
+			err:          storage.ErrTransferAlreadyReversed,
+			expectedCode: http.StatusConflict,
+			expectedBody: "{\"errors\":\"transfer has already been reversed\"}\n",
+		},
+		{
+			name:         "Unknown transfer",
+			err:          storage.ErrTransferNotFound,
+			expectedCode: http.StatusNotFound,
+			expectedBody: "{\"errors\":\"transfer not found\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+			mockDB.EXPECT().ReverseTransfer(gomock.Any(), int32(1), int64(7), tt.partial, gomock.Any()).Return(tt.reversal, tt.err)
+
+			resp := client.WithToken(token).Post(t, "/api/admin/transfers/7/reverse", tt.body)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+			assert.Equal(t, tt.expectedBody, resp.Body)
+		})
+	}
+
+	t.Run("Invalid mode", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		resp := client.WithToken(token).Post(t, "/api/admin/transfers/7/reverse", []byte(`{"mode":"some"}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"invalid mode; expected full or partial\"}\n", resp.Body)
+	})
+
+	t.Run("Malformed body", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		resp := client.WithToken(token).Post(t, "/api/admin/transfers/7/reverse", []byte(`{"mode":`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"unexpected end of JSON input\"}\n", resp.Body)
+	})
+
+	t.Run("Not an admin", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+		resp := client.WithToken(token).Post(t, "/api/admin/transfers/7/reverse", nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestInventoryReconcileHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	drift := []models.InventoryDrift{{UserID: 2, Item: "cup", CountedQuantity: 1, ActualQuantity: 2}}
+
+	tests := []struct {
+		name         string
+		query        string
+		repair       bool
+		drift        []models.InventoryDrift
+		expectedBody string
+	}{
+		{
+			name:         "No drift",
+			expectedBody: `{"drift":[],"repaired":false}`,
+		},
+		{
+			name:         "Report",
+			drift:        drift,
+			expectedBody: `{"drift":[{"userId":2,"item":"cup","countedQuantity":1,"countedFulfilled":0,"actualQuantity":2,"actualFulfilled":0}],"repaired":false}`,
+		},
+		{
+			name:         "Repair",
+			query:        "?repair=true",
+			repair:       true,
+			drift:        drift,
+			expectedBody: `{"drift":[{"userId":2,"item":"cup","countedQuantity":1,"countedFulfilled":0,"actualQuantity":2,"actualFulfilled":0}],"repaired":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+			mockDB.EXPECT().ReconcileInventoryCounts(gomock.Any(), tt.repair).Return(tt.drift, nil)
+
+			resp := client.WithToken(token).Post(t, "/api/admin/inventory/reconcile"+tt.query, nil)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.expectedBody, resp.Body)
+		})
+	}
+
+	t.Run("Invalid repair", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		resp := client.WithToken(token).Post(t, "/api/admin/inventory/reconcile?repair=maybe", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"invalid repair value; expected a boolean\"}\n", resp.Body)
+	})
+}
+
+func TestCatalogAffordabilityHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	t.Run("Balance at price", func(t *testing.T) {
+		mockDB.EXPECT().GetCatalogWithAffordability(gomock.Any(), int32(1)).Return([]models.AffordableCatalogItem{
+			{Name: "t-shirt", Price: 80, Affordable: true},
+			{Name: "pink-hoody", Price: 500, Shortfall: 420},
+		}, nil)
+
+		resp := client.WithToken(token).Get(t, "/api/merch/affordability")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+		assert.Equal(t, `[{"name":"t-shirt","price":80,"affordable":true,"shortfall":0},{"name":"pink-hoody","price":500,"affordable":false,"shortfall":420}]`, resp.Body)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		mockDB.EXPECT().GetCatalogWithAffordability(gomock.Any(), int32(1)).Return(nil, storage.ErrUserNotFound)
+
+		resp := client.WithToken(token).Get(t, "/api/merch/affordability")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Requires a token", func(t *testing.T) {
+		resp := client.Get(t, "/api/merch/affordability")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestReceiptHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	purchasedAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	redeemedAt := purchasedAt.Add(time.Hour)
+	receipt := &models.Receipt{Number: "R-2025-000123", Item: "cup", Quantity: 1, Owner: "alice", PurchasedAt: purchasedAt}
+
+	t.Run("Buy returns the receipt number", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").
+			Return(&models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 980, ReceiptNumber: "R-2025-000123"}, nil)
+
+		resp := client.WithToken(token).Get(t, "/api/buy/cup")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"item":"cup","price":20,"quantity":1,"remainingCoins":980,"receiptNumber":"R-2025-000123"}`, resp.Body)
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		mockDB.EXPECT().GetReceipt(gomock.Any(), int32(1), "R-2025-000123").Return(receipt, nil)
+
+		resp := client.WithToken(token).Get(t, "/api/receipts/R-2025-000123")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"number":"R-2025-000123","item":"cup","quantity":1,"owner":"alice","purchasedAt":"2025-06-01T12:00:00Z"}`, resp.Body)
+	})
+
+	t.Run("Not the owner", func(t *testing.T) {
+		mockDB.EXPECT().GetReceipt(gomock.Any(), int32(1), "R-2025-000124").Return(nil, storage.ErrReceiptNotFound)
+
+		resp := client.WithToken(token).Get(t, "/api/receipts/R-2025-000124")
+		resp.AssertError(t, http.StatusNotFound, "receipt not found")
+	})
+
+	t.Run("Redeem", func(t *testing.T) {
+		redeemed := *receipt
+		redeemed.RedeemedAt = &redeemedAt
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().RedeemReceipt(gomock.Any(), int32(1), "R-2025-000123", gomock.Any()).Return(&redeemed, nil)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/receipts/R-2025-000123/redeem", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"number":"R-2025-000123","item":"cup","quantity":1,"owner":"alice","purchasedAt":"2025-06-01T12:00:00Z","redeemedAt":"2025-06-01T13:00:00Z"}`, resp.Body)
+	})
+
+	t.Run("Redeem twice", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().RedeemReceipt(gomock.Any(), int32(1), "R-2025-000123", gomock.Any()).Return(nil, storage.ErrReceiptAlreadyRedeemed)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/receipts/R-2025-000123/redeem", nil)
+		resp.AssertError(t, http.StatusConflict, "receipt has already been redeemed")
+	})
+
+	t.Run("Redeem unknown", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().RedeemReceipt(gomock.Any(), int32(1), "R-1999-000000", gomock.Any()).Return(nil, storage.ErrReceiptNotFound)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/receipts/R-1999-000000/redeem", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Redeem requires an admin", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.WithToken(token).Post(t, "/api/admin/receipts/R-2025-000123/redeem", nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestDuplicatePurchase_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	application := app.NewApp(mockDB, l)
+	application.SetClock(clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)))
+	application.SetPurchaseDebounce(app.DefaultPurchaseDebounceWindow)
+	testServer := httptest.NewServer(NewService(application, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Times(2).Return(&models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 980}, nil)
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "pen").Return(&models.PurchaseResult{Item: "pen", Price: 10, Quantity: 1, RemainingCoins: 970}, nil)
+
+	client = client.WithToken(token)
+	resp := client.Get(t, "/api/buy/cup")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = client.Get(t, "/api/buy/cup")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, resp.Body, `"code":"DUPLICATE_PURCHASE"`)
+
+	resp = client.Get(t, "/api/buy/pen")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "purchases of other items must not be blocked")
+
+	resp = client.WithHeader("X-Confirm-Duplicate", "true").Get(t, "/api/buy/cup")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a confirmed duplicate must go through")
+}
+
+func TestStorageUnavailable_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	const expectedBody = "{\"errors\":\"storage temporarily unavailable, try again later\",\"code\":\"STORAGE_UNAVAILABLE\"}\n"
+	unavailable := fmt.Errorf("%w: %w", storage.ErrStorageUnavailable, io.ErrUnexpectedEOF)
+
+	mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(nil, unavailable)
+	resp := client.WithToken(token).Get(t, "/api/info")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+	assert.Equal(t, expectedBody, resp.Body)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "pen").Return(nil, unavailable)
+	resp = client.WithToken(token).Get(t, "/api/buy/pen")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+	assert.Equal(t, expectedBody, resp.Body)
+
+	mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), gomock.Any()).Return(nil, fmt.Errorf("transfer: %w", unavailable))
+	resp = client.WithToken(token).Post(t, "/api/sendCoin", []byte(`{"toUser":"user","amount":10}`))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, expectedBody, resp.Body)
+
+	mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(nil, errors.New("unexpected"))
+	resp = client.WithToken(token).Get(t, "/api/info")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "other failures must stay internal errors")
+	assert.Empty(t, resp.Header.Get("Retry-After"))
+	assert.Equal(t, "{\"errors\":\"unexpected\"}\n", resp.Body)
+}
+
+func TestPersonalTokenHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetSessionLimit(3)
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	session, err := auth.IssueToken(1)
+	require.NoError(t, err)
+	mockDB.EXPECT().IsSessionActive(gomock.Any(), int32(1), session.ID).Return(true, nil).AnyTimes()
+
+	// The registry emulates the storage of personal access tokens.
+	hashes := map[string]*models.PersonalToken{}
+	revoked := map[int64]bool{}
+	mockDB.EXPECT().CreatePersonalToken(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(_ context.Context, token models.PersonalToken, hash string) (*models.PersonalToken, error) {
+			token.ID = int64(len(hashes) + 1)
+			hashes[hash] = &token
+			return &token, nil
+		})
+	mockDB.EXPECT().GetPersonalTokenByHash(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(_ context.Context, hash string, _ time.Time) (*models.PersonalToken, error) {
+			token, ok := hashes[hash]
+			if !ok || revoked[token.ID] {
+				return nil, storage.ErrPersonalTokenNotFound
+			}
+			return token, nil
+		})
+	mockDB.EXPECT().RevokePersonalToken(gomock.Any(), int32(1), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(_ context.Context, _ int32, tokenID int64, _ time.Time) error {
+			if revoked[tokenID] || tokenID > int64(len(hashes)) {
+				return storage.ErrPersonalTokenNotFound
+			}
+			revoked[tokenID] = true
+			return nil
+		})
+
+	createToken := func(t *testing.T, scopes ...string) models.CreatedPersonalToken {
+		body, err := json.Marshal(models.PersonalTokenRequest{Name: "bot", Scopes: scopes})
+		require.NoError(t, err)
+		resp := client.WithToken(session.Token).Post(t, "/api/auth/tokens", body)
+		require.Equal(t, http.StatusCreated, resp.StatusCode, resp.Body)
+
+		var created models.CreatedPersonalToken
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &created))
+		return created
+	}
+
+	scopeError := "{\"errors\":\"token scope does not allow this request\",\"code\":\"SCOPE_REQUIRED\"}\n"
+
+	t.Run("Create with invalid scope", func(t *testing.T) {
+		resp := client.WithToken(session.Token).Post(t, "/api/auth/tokens", []byte(`{"name":"bot","scopes":["buy"]}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "{\"errors\":\"app: token scopes must be a non-empty list of sendCoin and info\"}\n", resp.Body)
+	})
+
+	t.Run("Info scope", func(t *testing.T) {
+		created := createToken(t, auth.ScopeInfo)
+		assert.True(t, strings.HasPrefix(created.Token, auth.PersonalTokenPrefix))
+		assert.Equal(t, []string{auth.ScopeInfo}, created.Scopes)
+
+		mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(&models.InfoResponse{Coins: 900}, nil)
+		resp := client.WithToken(created.Token).Get(t, "/api/info")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "a personal token must not need a session")
+
+		for _, route := range []struct{ method, path string }{
+			{http.MethodPost, "/api/sendCoin"},
+			{http.MethodGet, "/api/history"},
+			{http.MethodGet, "/api/auth/tokens"},
+			{http.MethodPost, "/api/auth/tokens"},
+			{http.MethodGet, "/api/buy/cup"},
+		} {
+			resp := client.WithToken(created.Token).Do(t, route.method, route.path, []byte(`{}`))
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode, route.path)
+			assert.Equal(t, scopeError, resp.Body, route.path)
+		}
+	})
+
+	t.Run("SendCoin scope", func(t *testing.T) {
+		created := createToken(t, auth.ScopeSendCoin)
+
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), models.SendCoinRequest{ToUser: "bob", Amount: 10}).Return(&models.TransferResult{TransferID: 5}, nil)
+		resp := client.WithToken(created.Token).Post(t, "/api/sendCoin", []byte(`{"toUser":"bob","amount":10}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+		resp = client.WithToken(created.Token).Get(t, "/api/info")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, scopeError, resp.Body)
+	})
+
+	t.Run("List and revoke", func(t *testing.T) {
+		created := createToken(t, auth.ScopeInfo)
+
+		mockDB.EXPECT().GetPersonalTokens(gomock.Any(), int32(1)).Return([]models.PersonalToken{created.PersonalToken}, nil)
+		resp := client.WithToken(session.Token).Get(t, "/api/auth/tokens")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Body, created.Prefix)
+		assert.NotContains(t, resp.Body, created.Token, "listed tokens must show their prefix only")
+
+		resp = client.WithToken(session.Token).Delete(t, "/api/auth/tokens/"+strconv.FormatInt(created.ID, 10))
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp = client.WithToken(created.Token).Get(t, "/api/info")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "a revoked token must be rejected")
+		assert.Equal(t, "{\"errors\":\"invalid token\",\"code\":\"TOKEN_INVALID\"}\n", resp.Body)
+
+		resp = client.WithToken(session.Token).Delete(t, "/api/auth/tokens/"+strconv.FormatInt(created.ID, 10))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp = client.WithToken(session.Token).Delete(t, "/api/auth/tokens/abc")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		resp := client.WithToken("pat_unknown").Get(t, "/api/info")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestDelegationHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	t.Run("Create", func(t *testing.T) {
+		expiresAt := now.Add(7 * 24 * time.Hour)
+		mockDB.EXPECT().CreateDelegation(gomock.Any(), int32(1), models.Delegation{Grantee: "bob", Allowance: 100, ExpiresAt: expiresAt, CreatedAt: now}).
+			Return(&models.Delegation{ID: 3, Grantor: "alice", Grantee: "bob", Allowance: 100, RemainingAllowance: 100, ExpiresAt: expiresAt, CreatedAt: now}, nil)
+
+		resp := client.PostJSON(t, "/api/delegations", models.DelegationRequest{Grantee: "bob", Allowance: 100, ExpiresAt: "2025-06-08T15:00:00+03:00"})
+		require.Equal(t, http.StatusCreated, resp.StatusCode, resp.Body)
+		var delegation models.Delegation
+		resp.Decode(t, &delegation)
+		assert.Equal(t, int64(3), delegation.ID)
+		assert.Equal(t, 100, delegation.RemainingAllowance)
+	})
+
+	t.Run("Create rejected", func(t *testing.T) {
+		resp := client.PostJSON(t, "/api/delegations", models.DelegationRequest{Grantee: "bob", ExpiresAt: "2025-06-08T12:00:00Z"})
+		resp.AssertErrorCode(t, http.StatusBadRequest, models.ErrCodeAmountInvalid, "allowance must be a positive number of coins")
+
+		resp = client.PostJSON(t, "/api/delegations", models.DelegationRequest{Grantee: "bob", Allowance: 100, ExpiresAt: "2025-06-01T11:00:00Z"})
+		resp.AssertError(t, http.StatusBadRequest, "expiresAt must be an RFC 3339 time in the future, at most a year ahead")
+
+		resp = client.PostJSON(t, "/api/delegations", models.DelegationRequest{Grantee: "bob", Allowance: 100, ExpiresAt: "2027-06-01T12:00:00Z"})
+		resp.AssertError(t, http.StatusBadRequest, "expiresAt must be an RFC 3339 time in the future, at most a year ahead")
+
+		mockDB.EXPECT().CreateDelegation(gomock.Any(), int32(1), gomock.Any()).Return(nil, storage.ErrSelfDelegation)
+		resp = client.PostJSON(t, "/api/delegations", models.DelegationRequest{Grantee: "alice", Allowance: 100, ExpiresAt: "2025-06-08T12:00:00Z"})
+		resp.AssertError(t, http.StatusBadRequest, "spending cannot be delegated to yourself")
+
+		mockDB.EXPECT().CreateDelegation(gomock.Any(), int32(1), gomock.Any()).Return(nil, storage.ErrRecipientNotFound)
+		resp = client.PostJSON(t, "/api/delegations", models.DelegationRequest{Grantee: "nobody", Allowance: 100, ExpiresAt: "2025-06-08T12:00:00Z"})
+		resp.AssertError(t, http.StatusBadRequest, "grantee not found")
+	})
+
+	t.Run("List", func(t *testing.T) {
+		mockDB.EXPECT().GetDelegations(gomock.Any(), int32(1)).Return(&models.DelegationsResponse{
+			Granted:  []models.Delegation{{ID: 3, Grantee: "bob", Allowance: 100, RemainingAllowance: 40}},
+			Received: []models.Delegation{},
+		}, nil)
+
+		resp := client.Get(t, "/api/delegations")
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		var delegations models.DelegationsResponse
+		resp.Decode(t, &delegations)
+		require.Len(t, delegations.Granted, 1)
+		assert.Equal(t, "bob", delegations.Granted[0].Grantee)
+		assert.Equal(t, 40, delegations.Granted[0].RemainingAllowance)
+		assert.Empty(t, delegations.Received)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		mockDB.EXPECT().RevokeDelegation(gomock.Any(), int32(1), int64(3), now).Return(nil)
+		resp := client.Delete(t, "/api/delegations/3")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		mockDB.EXPECT().RevokeDelegation(gomock.Any(), int32(1), int64(3), now).Return(storage.ErrDelegationNotFound)
+		resp = client.Delete(t, "/api/delegations/3")
+		resp.AssertError(t, http.StatusNotFound, "delegation not found")
+
+		resp = client.Delete(t, "/api/delegations/abc")
+		resp.AssertError(t, http.StatusBadRequest, "invalid delegation id")
+	})
+
+	t.Run("Buy on behalf", func(t *testing.T) {
+		remaining := 60
+		mockDB.EXPECT().BuyItemOnBehalf(gomock.Any(), int32(2), "alice", "cup", now).Return(&models.PurchaseResult{
+			Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 1000, ReceiptNumber: "R-2025-000001",
+			OnBehalfOf: "alice", RemainingAllowance: &remaining, GrantorID: 1, GrantorCoins: 480,
+		}, nil)
+
+		resp := client.WithUser(t, 2).Get(t, "/api/buy/cup?onBehalfOf=alice")
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		assert.Equal(t, "1000", resp.Header.Get(coinsBalanceHeader), "the buyer's own balance is reported")
+		assert.JSONEq(t, `{"item":"cup","price":20,"quantity":1,"remainingCoins":1000,"receiptNumber":"R-2025-000001","onBehalfOf":"alice","remainingAllowance":60}`, resp.Body)
+	})
+
+	t.Run("Buy on behalf rejected", func(t *testing.T) {
+		for _, tc := range []struct {
+			err     error
+			code    string
+			message string
+		}{
+			{storage.ErrDelegationNotFound, models.ErrCodeDelegationNotFound, "no active delegation from this user"},
+			{storage.ErrDelegationExpired, models.ErrCodeDelegationExpired, "the delegation has expired"},
+			{storage.ErrDelegationAllowanceExceeded, models.ErrCodeDelegationAllowanceExceeded, "the price exceeds the remaining allowance of the delegation"},
+		} {
+			mockDB.EXPECT().BuyItemOnBehalf(gomock.Any(), int32(2), "alice", "cup", now).Return(nil, tc.err)
+			resp := client.WithUser(t, 2).Get(t, "/api/buy/cup?onBehalfOf=alice")
+			resp.AssertErrorCode(t, http.StatusForbidden, tc.code, tc.message)
+		}
+	})
+}
+
+func TestWebUI(t *testing.T) {
+	handler := webui.Handler()
+	if handler == nil {
+		t.Skip("the frontend is left out of builds with the noui tag")
+	}
+
+	service := newCatalogService(t, config.ServerRunAddress)
+	service.SetWebUI(handler)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	t.Run("Redirect to the page", func(t *testing.T) {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(testServer.URL + "/ui")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+		assert.Equal(t, "/ui/", resp.Header.Get("Location"))
+	})
+
+	for _, file := range []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{"/ui/", "text/html; charset=utf-8", "<title>Merch store</title>"},
+		{"/ui/app.js", "text/javascript; charset=utf-8", "async function api("},
+		{"/ui/style.css", "text/css; charset=utf-8", "font-family"},
+	} {
+		t.Run(file.path, func(t *testing.T) {
+			resp := client.Get(t, file.path)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, file.contentType, resp.Header.Get("Content-Type"))
+			assert.Contains(t, resp.Body, file.contains)
+		})
+	}
+
+	t.Run("Missing asset", func(t *testing.T) {
+		resp := client.Get(t, "/ui/missing.js")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("API routes are not shadowed", func(t *testing.T) {
+		resp := client.Get(t, "/api/merch")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `[{"name":"cup","price":20}]`, resp.Body)
+
+		resp = client.Get(t, "/api/info")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "the frontend must not bypass authentication")
+		assert.Equal(t, "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n", resp.Body)
+
+		resp = client.Get(t, "/api/ui/")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabled := httptest.NewServer(newCatalogService(t, config.ServerRunAddress).NewRouter())
+		defer disabled.Close()
+
+		resp := servicetest.NewClient(disabled).Get(t, "/ui/")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPIVersionNegotiation_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	const v2 = "application/vnd.merchstore.v2+json"
+	request := func(t *testing.T, method, path, accept, token string, body []byte) (*servicetest.Response, string) {
+		client := client.WithToken(token)
+		if accept != "" {
+			client = client.WithHeader("Accept", accept)
+		}
+		resp := client.Do(t, method, path, body)
+		return resp, resp.Body
+	}
+
+	t.Run("Auth", func(t *testing.T) {
+		mockDB.EXPECT().CheckUser(gomock.Any(), gomock.Any()).Times(2).
+			DoAndReturn(func(_ context.Context, user *models.User) (*models.User, error) {
+				user.ID = 1
+				return user, nil
+			})
+		credentials := []byte(`{"username":"alice","password":"secret"}`)
+
+		resp, body := request(t, http.MethodPost, "/api/auth", "", "", credentials)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		var v1Response map[string]any
+		require.NoError(t, json.Unmarshal([]byte(body), &v1Response))
+		assert.Len(t, v1Response, 1, "version 1 must keep the flat contract")
+		assert.NotEmpty(t, v1Response["token"])
+
+		resp, body = request(t, http.MethodPost, "/api/auth", v2, "", credentials)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, v2, resp.Header.Get("Content-Type"))
+		var v2Response models.AuthResponseV2
+		require.NoError(t, json.Unmarshal([]byte(body), &v2Response))
+		assert.Equal(t, "Bearer", v2Response.TokenType)
+		assert.True(t, v2Response.ExpiresAt.After(time.Now()))
+		claims, err := auth.ParseToken(v2Response.Token)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), claims.UserID)
+	})
+
+	t.Run("Buy", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Times(2).
+			Return(&models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 980}, nil)
+
+		resp, body := request(t, http.MethodGet, "/api/buy/cup", "application/json", token, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"item":"cup","price":20,"quantity":1,"remainingCoins":980}`, body)
+
+		resp, body = request(t, http.MethodGet, "/api/buy/cup", v2, token, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, v2, resp.Header.Get("Content-Type"))
+		assert.JSONEq(t, `{"purchase":{"item":"cup","price":20,"quantity":1},"remainingCoins":980,"dryRun":false}`, body)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "yacht").Times(2).Return(nil, storage.ErrInsufficientFunds)
+
+		tests := []struct {
+			name   string
+			path   string
+			token  string
+			status int
+			v1     string
+			v2     string
+		}{
+			{
+				name: "Handler error without a code", path: "/api/buy/yacht", token: token, status: http.StatusBadRequest,
+				v1: "{\"errors\":\"insufficient funds to purchase the item\"}\n",
+				v2: "{\"error\":{\"code\":\"BAD_REQUEST\",\"message\":\"insufficient funds to purchase the item\"}}\n",
+			},
+			{
+				name: "Authentication error", path: "/api/info", status: http.StatusUnauthorized,
+				v1: "{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n",
+				v2: "{\"error\":{\"code\":\"AUTH_HEADER_MISSING\",\"message\":\"missing auth header\"}}\n",
+			},
+			{
+				name: "Unknown route", path: "/api/unknown", token: token, status: http.StatusNotFound,
+				v1: "{\"errors\":\"route not found\",\"code\":\"ROUTE_NOT_FOUND\"}\n",
+				v2: "{\"error\":{\"code\":\"ROUTE_NOT_FOUND\",\"message\":\"route not found\"}}\n",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, body := request(t, http.MethodGet, tt.path, "", tt.token, nil)
+				assert.Equal(t, tt.status, resp.StatusCode)
+				assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+				assert.Equal(t, tt.v1, body)
+
+				resp, body = request(t, http.MethodGet, tt.path, v2, tt.token, nil)
+				assert.Equal(t, tt.status, resp.StatusCode)
+				assert.Equal(t, v2, resp.Header.Get("Content-Type"))
+				assert.Equal(t, tt.v2, body)
+			})
+		}
+	})
+
+	t.Run("Unsupported version", func(t *testing.T) {
+		resp, body := request(t, http.MethodGet, "/api/info", "application/vnd.merchstore.v3+json", token, nil)
+		assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+		assert.Contains(t, resp.Header.Values("Vary"), "Accept")
+		assert.JSONEq(t, `{"errors":"unsupported API version, supported media types: application/json, application/vnd.merchstore.v2+json",
+			"code":"VERSION_NOT_ACCEPTABLE","supported":["application/json","application/vnd.merchstore.v2+json"]}`, body)
+	})
+}
+
+func TestNotifications_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	user := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	createdAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	readAt := createdAt.Add(time.Hour)
+	received := models.Notification{ID: 7, Category: storage.NotificationCoinsReceived, Message: "you received 100 coins from bob",
+		User: "bob", Amount: 100, CreatedAt: createdAt}
+
+	t.Run("Unread notifications", func(t *testing.T) {
+		mockDB.EXPECT().GetNotifications(gomock.Any(), int32(1), models.NotificationsFilter{UnreadOnly: true, Limit: app.DefaultNotificationsPageSize + 1}).
+			Return([]models.Notification{received}, nil)
+		mockDB.EXPECT().CountUnreadNotifications(gomock.Any(), int32(1)).Return(int64(1), nil)
+
+		resp := user.Get(t, "/api/notifications?unread=true")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"notifications":[{"id":7,"category":"coins_received","message":"you received 100 coins from bob",
+			"user":"bob","amount":100,"createdAt":"2025-06-01T12:00:00Z"}],"unreadCount":1,"limit":50}`, resp.Body)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		older := models.Notification{ID: 6, Category: storage.NotificationGiftReceived, Item: "cup", CreatedAt: createdAt.Add(-time.Minute)}
+		oldest := models.Notification{ID: 5, Category: storage.NotificationGiftReceived, Item: "pen", CreatedAt: createdAt.Add(-2 * time.Minute)}
+		mockDB.EXPECT().GetNotifications(gomock.Any(), int32(1), models.NotificationsFilter{Limit: 3}).
+			Return([]models.Notification{received, older, oldest}, nil)
+		mockDB.EXPECT().CountUnreadNotifications(gomock.Any(), int32(1)).Return(int64(3), nil).Times(2)
+
+		var first models.NotificationsResponse
+		user.Get(t, "/api/notifications?limit=2").Decode(t, &first)
+		require.Len(t, first.Notifications, 2)
+		require.NotEmpty(t, first.NextCursor)
+
+		mockDB.EXPECT().GetNotifications(gomock.Any(), int32(1), models.NotificationsFilter{
+			After: &models.PageCursor{CreatedAt: older.CreatedAt.Local(), ID: 6}, Limit: 3,
+		}).Return([]models.Notification{oldest}, nil)
+
+		var second models.NotificationsResponse
+		user.Get(t, "/api/notifications?limit=2&cursor="+first.NextCursor).Decode(t, &second)
+		assert.Equal(t, []models.Notification{oldest}, second.Notifications)
+		assert.Empty(t, second.NextCursor)
+
+		resp := user.Get(t, "/api/notifications?unread=true&limit=2&cursor="+first.NextCursor)
+		resp.AssertError(t, http.StatusBadRequest, "invalid cursor")
+	})
+
+	t.Run("Invalid unread", func(t *testing.T) {
+		user.Get(t, "/api/notifications?unread=maybe").AssertError(t, http.StatusBadRequest, "invalid unread value; expected a boolean")
+	})
+
+	t.Run("Marking read is idempotent", func(t *testing.T) {
+		read := received
+		read.ReadAt = &readAt
+		mockDB.EXPECT().MarkNotificationRead(gomock.Any(), int32(1), int64(7), gomock.Any()).Return(&read, nil).Times(2)
+
+		for attempt := 0; attempt < 2; attempt++ {
+			resp := user.Post(t, "/api/notifications/7/read", nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var notification models.Notification
+			resp.Decode(t, &notification)
+			require.NotNil(t, notification.ReadAt)
+			assert.True(t, readAt.Equal(*notification.ReadAt), "the time of the first read is kept")
+		}
+	})
+
+	t.Run("Unknown notification", func(t *testing.T) {
+		mockDB.EXPECT().MarkNotificationRead(gomock.Any(), int32(1), int64(8), gomock.Any()).Return(nil, storage.ErrNotificationNotFound)
+
+		resp := user.Post(t, "/api/notifications/8/read", nil)
+		resp.AssertErrorCode(t, http.StatusNotFound, models.ErrCodeNotificationNotFound, "notification not found")
+	})
+
+	t.Run("Invalid notification id", func(t *testing.T) {
+		user.Post(t, "/api/notifications/0/read", nil).AssertError(t, http.StatusBadRequest, "invalid notification id")
+	})
+
+	t.Run("Read all", func(t *testing.T) {
+		mockDB.EXPECT().MarkAllNotificationsRead(gomock.Any(), int32(1), gomock.Any()).Return(int64(3), nil)
+		mockDB.EXPECT().MarkAllNotificationsRead(gomock.Any(), int32(1), gomock.Any()).Return(int64(0), nil)
+
+		resp := user.Post(t, "/api/notifications/readAll", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"marked":3}`, resp.Body)
+
+		resp = user.Post(t, "/api/notifications/readAll", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"marked":0}`, resp.Body, "marking everything read again changes nothing")
+	})
+
+	t.Run("Preferences", func(t *testing.T) {
+		mockDB.EXPECT().SetMutedNotificationCategories(gomock.Any(), int32(1),
+			[]string{storage.NotificationAdminAdjustment, storage.NotificationGiftReceived}).Return(nil)
+		mockDB.EXPECT().GetMutedNotificationCategories(gomock.Any(), int32(1)).
+			Return([]string{storage.NotificationAdminAdjustment, storage.NotificationGiftReceived}, nil)
+
+		resp := user.Do(t, http.MethodPut, "/api/notifications/preferences",
+			[]byte(`{"muted": ["gift_received", "admin_adjustment", "gift_received"]}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"muted":["admin_adjustment","gift_received"]}`, resp.Body)
+
+		resp = user.Get(t, "/api/notifications/preferences")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"muted":["admin_adjustment","gift_received"]}`, resp.Body)
+	})
+
+	t.Run("Unknown category", func(t *testing.T) {
+		resp := user.Do(t, http.MethodPut, "/api/notifications/preferences", []byte(`{"muted": ["coins_received", "weather"]}`))
+		resp.AssertError(t, http.StatusBadRequest, "unknown notification category")
+	})
+
+	t.Run("Unread count in info", func(t *testing.T) {
+		mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(&models.InfoResponse{Coins: 1000}, nil)
+		mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(&models.InfoResponse{Coins: 1000}, nil)
+		mockDB.EXPECT().CountUnreadNotifications(gomock.Any(), int32(1)).Return(int64(0), nil)
+
+		resp := user.Get(t, "/api/info?includeUnreadCount=true")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Body, `"unreadCount":0`, "a zero count is returned when asked for")
+
+		resp = user.Get(t, "/api/info")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotContains(t, resp.Body, "unreadCount")
+	})
+
+	t.Run("Invalid includeUnreadCount", func(t *testing.T) {
+		resp := user.Get(t, "/api/info?includeUnreadCount=maybe")
+		resp.AssertError(t, http.StatusBadRequest, "invalid includeUnreadCount value; expected a boolean")
+	})
+}
+
+func TestEventsHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetEventBroker(app.NewEventBroker())
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	t.Run("Filtered stream", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, testServer.URL+"/api/events?types=purchase_completed", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		// The headers are sent once the subscription exists, so the purchases below are published to it.
+		for i, item := range []string{"cup", "pen"} {
+			mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), item).
+				Return(&models.PurchaseResult{Item: item, Price: 20, Quantity: 1, RemainingCoins: int64(980 - 20*i)}, nil)
+			require.Equal(t, http.StatusOK, client.WithToken(token).Get(t, "/api/buy/"+item).StatusCode)
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		readEvent := func() string {
+			var lines []string
+			for {
+				line, err := reader.ReadString('\n')
+				require.NoError(t, err)
+				if line == "\n" {
+					return strings.Join(lines, "")
+				}
+				lines = append(lines, line)
+			}
+		}
+		assert.Equal(t, "event: purchase_completed\ndata: {\"item\":\"cup\",\"price\":20,\"quantity\":1}\n", readEvent())
+		assert.Equal(t, "event: purchase_completed\ndata: {\"item\":\"pen\",\"price\":20,\"quantity\":1}\n", readEvent(),
+			"balance_changed must be filtered out and events must arrive in order")
+	})
+
+	t.Run("Token in the query", func(t *testing.T) {
+		// Browsers open the stream with EventSource, which cannot set the Authorization header.
+		resp, err := http.Get(testServer.URL + "/api/events?access_token=" + token)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		client.Get(t, "/api/info?access_token="+token).AssertErrorCode(t, http.StatusUnauthorized, models.ErrCodeAuthHeaderMissing, "missing auth header")
+	})
+
+	t.Run("Invalid types", func(t *testing.T) {
+		resp := client.WithToken(token).Get(t, "/api/events?types=purchase_completed,refund")
+		resp.AssertError(t, http.StatusBadRequest, "invalid types; expected a comma-separated list of coins_received, purchase_completed, balance_changed")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+		defer testServer.Close()
+
+		resp := servicetest.NewClient(testServer).WithToken(token).Get(t, "/api/events")
+		resp.AssertError(t, http.StatusNotFound, "event stream is disabled")
+	})
+}
+
+func TestTransferConfirmationHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	appInstance.SetTransferConfirmation(300)
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	large := models.SendCoinRequest{ToUser: "bob", Amount: 500}
+
+	t.Run("Small transfer", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), models.SendCoinRequest{ToUser: "bob", Amount: 300}).Return(&models.TransferResult{TransferID: 6}, nil)
+
+		resp := client.PostJSON(t, "/api/sendCoin", models.SendCoinRequest{ToUser: "bob", Amount: 300})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"transferId":6}`, resp.Body)
+	})
+
+	t.Run("Large transfer", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), large).
+			DoAndReturn(func(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+				assert.True(t, storage.IsDryRun(ctx), "an unconfirmed transfer must not touch balances")
+				return &models.TransferResult{}, nil
+			})
+
+		resp := client.PostJSON(t, "/api/sendCoin", large)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		var confirmation models.TransferConfirmation
+		resp.Decode(t, &confirmation)
+		assert.NotEmpty(t, confirmation.ConfirmationToken)
+		assert.Equal(t, models.TransferConfirmation{
+			ConfirmationToken: confirmation.ConfirmationToken,
+			ToUser:            "bob",
+			Amount:            500,
+			ExpiresAt:         now.Add(app.TransferConfirmationTTL),
+		}, confirmation)
+
+		confirm := models.ConfirmTransferRequest{ConfirmationToken: confirmation.ConfirmationToken}
+		resp = client.WithUser(t, 2).PostJSON(t, "/api/sendCoin/confirm", confirm)
+		resp.AssertError(t, http.StatusNotFound, "confirmation not found or expired")
+
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), large).Return(&models.TransferResult{TransferID: 7, RemainingCoins: 500}, nil)
+		resp = client.PostJSON(t, "/api/sendCoin/confirm", confirm)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"transferId":7}`, resp.Body)
+		assert.Equal(t, "500", resp.Header.Get("X-Coins-Balance"))
+
+		resp = client.PostJSON(t, "/api/sendCoin/confirm", confirm)
+		resp.AssertError(t, http.StatusNotFound, "confirmation not found or expired")
+	})
+
+	t.Run("Invalid large transfer", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), large).Return(nil, storage.ErrInsufficientFunds)
+
+		resp := client.PostJSON(t, "/api/sendCoin", large)
+		resp.AssertError(t, http.StatusBadRequest, "insufficient funds to perform the transfer")
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), large).Return(&models.TransferResult{}, nil)
+
+		resp := client.WithHeader("X-Dry-Run", "true").PostJSON(t, "/api/sendCoin", large)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"transferId":0,"dryRun":true}`, resp.Body)
+	})
+}
+
+func TestServerTime_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.FixedZone("", 3*60*60))))
+	appInstance.SetTransferConfirmation(300)
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	t.Run("Header", func(t *testing.T) {
+		resp := servicetest.NewClient(testServer).Get(t, "/api/unknown")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "2025-06-01T09:00:00Z", resp.Header.Get("X-Server-Time"))
+	})
+
+	t.Run("Timestamps in UTC", func(t *testing.T) {
+		large := models.SendCoinRequest{ToUser: "bob", Amount: 500}
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), large).Return(&models.TransferResult{}, nil)
+
+		resp := client.PostJSON(t, "/api/sendCoin", large)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		var confirmation struct {
+			ExpiresAt string `json:"expiresAt"`
+		}
+		resp.Decode(t, &confirmation)
+		assert.Equal(t, "2025-06-01T09:05:00Z", confirmation.ExpiresAt)
+		assert.Equal(t, "2025-06-01T09:00:00Z", resp.Header.Get("X-Server-Time"))
+	})
+}
+
+func TestEconomyHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.Get(t, "/api/admin/economy")
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Statistics", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().GetEconomyStats(gomock.Any(), time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC)).
+			Return(&models.EconomyStats{Users: 2, CoinsInCirculation: 1500, Gini: 0.25, Days: []models.EconomyDay{
+				{Date: "2025-06-01", Transfers: 2, TransferVolume: 150, Purchases: 1, PurchaseVolume: 80},
+				{Date: "2025-06-02"},
+			}}, nil)
+
+		resp := client.Get(t, "/api/admin/economy?from=2025-06-01&to=2025-06-02")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"from":"2025-06-01","to":"2025-06-02","users":2,"coinsInCirculation":1500,"gini":0.25,
+			"days":[{"date":"2025-06-01","transfers":2,"transferVolume":150,"purchases":1,"purchaseVolume":80},
+				{"date":"2025-06-02","transfers":0,"transferVolume":0,"purchases":0,"purchaseVolume":0}],
+			"generatedAt":"2025-06-10T12:00:00Z"}`, resp.Body)
+	})
+
+	t.Run("Invalid range", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(2)
+
+		resp := client.Get(t, "/api/admin/economy?from=2025-06-02&to=2025-06-01")
+		resp.AssertError(t, http.StatusBadRequest, "invalid date range; expected from and to as YYYY-MM-DD with from not after to")
+
+		resp = client.Get(t, "/api/admin/economy?from=2020-01-01&to=2025-06-01")
+		resp.AssertError(t, http.StatusBadRequest, "invalid date range; expected at most 366 days")
+	})
+}
+
+func TestBuyItemHandler_LongItemName_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	core, logs := observer.New(zap.InfoLevel)
+	l := &logger.Logger{Logger: zap.New(core)}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	user := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockDB.EXPECT().GetItemPrice(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockDB.EXPECT().RecordFailedPurchase(gomock.Any(), gomock.Any()).Times(0)
+
+	longName := strings.Repeat("x", 10<<10)
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodGet, path: "/api/buy/" + longName},
+		{method: http.MethodPost, path: "/api/buy/" + longName + "/gift"},
+		{method: http.MethodPost, path: "/api/inventory/" + longName + "/consume"},
+	}
+	for _, request := range requests {
+		resp := user.Do(t, request.method, request.path, []byte(`{"toUser":"bob"}`))
+		resp.AssertErrorCode(t, http.StatusBadRequest, models.ErrCodeItemNameTooLong,
+			fmt.Sprintf("invalid item: must be at most %d characters", models.MaxItemNameLength))
+	}
+
+	entries := logs.FilterMessage("served").AllUntimed()
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		uri := entry.ContextMap()["uri"].(string)
+		assert.LessOrEqual(t, utf8.RuneCountInString(uri), logger.MaxLoggedURILength, "the request log must not echo the whole name")
+	}
+}
+
+func TestUserActivityHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)))
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	createdAt := time.Date(2025, 6, 10, 11, 0, 0, 0, time.UTC)
+	page := []models.APIActivity{
+		{ID: 9, UserID: 1, Action: "GET /api/buy/{item}", Path: "/api/buy/cup", Status: 200, IP: "203.0.113.7", CreatedAt: createdAt},
+		{ID: 8, UserID: 1, Action: "GET /api/info", Path: "/api/info", Status: 200, IP: "203.0.113.7", CreatedAt: createdAt.Add(-time.Minute)},
+	}
+
+	var cursor string
+	t.Run("Own activity", func(t *testing.T) {
+		mockDB.EXPECT().GetUserActivity(gomock.Any(), int32(1), models.ActivityFilter{
+			From: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 6, 11, 0, 0, 0, 0, time.UTC), Limit: 2,
+		}).Return(page, nil)
+
+		resp := client.WithUser(t, 1).Get(t, "/api/account/activity?from=2025-06-01&to=2025-06-10&limit=1")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var activity models.UserActivityResponse
+		resp.Decode(t, &activity)
+		assert.Equal(t, "2025-06-01", activity.From)
+		require.Len(t, activity.Activity, 1)
+		assert.Equal(t, "/api/buy/cup", activity.Activity[0].Path)
+		assert.NotContains(t, resp.Body, `"id"`)
+		require.NotEmpty(t, activity.NextCursor)
+		cursor = activity.NextCursor
+	})
+
+	t.Run("Scoped to the requesting user", func(t *testing.T) {
+		mockDB.EXPECT().GetUserActivity(gomock.Any(), int32(2), gomock.Any()).Return([]models.APIActivity{}, nil)
+
+		resp := client.WithUser(t, 2).Get(t, "/api/account/activity")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"from":"2025-05-12","to":"2025-06-10","activity":[],"limit":50}`, resp.Body)
+
+		resp = client.WithUser(t, 2).Get(t, "/api/account/activity?cursor="+cursor)
+		resp.AssertError(t, http.StatusBadRequest, "invalid cursor")
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		resp := client.WithUser(t, 1).Get(t, "/api/account/activity?limit=0")
+		resp.AssertError(t, http.StatusBadRequest, "invalid limit")
+
+		resp = client.WithUser(t, 1).Get(t, "/api/account/activity?from=yesterday")
+		resp.AssertError(t, http.StatusBadRequest, "invalid date range; expected from and to as YYYY-MM-DD with from not after to")
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		resp := client.Get(t, "/api/account/activity")
+		resp.AssertErrorCode(t, http.StatusUnauthorized, models.ErrCodeAuthHeaderMissing, "missing auth header")
+	})
+}
+
+func TestActivityMiddleware_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	recorder := app.NewActivityRecorder(mockDB, 10, l)
+	appInstance.SetActivityRecorder(recorder)
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Return(nil, storage.ErrInsufficientFunds)
+	resp := client.WithUser(t, 1).Get(t, "/api/buy/cup")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = client.Get(t, "/api/info")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "requests without a user are not recorded")
+
+	mockDB.EXPECT().RecordAPIActivity(gomock.Any(), models.APIActivity{
+		UserID: 1, Action: "GET /api/buy/{item}", Path: "/api/buy/cup", Status: http.StatusBadRequest, IP: "127.0.0.1", CreatedAt: now,
+	}).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, recorder.Run(ctx), context.Canceled)
+}
+
+func TestIdempotencyMiddleware_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	mockDB.EXPECT().WithinTransaction(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}).AnyTimes()
+	claim := func(key string) *gomock.Call {
+		return mockDB.EXPECT().ClaimIdempotencyKey(gomock.Any(), int32(1), key, gomock.Any(), now, now.Add(-app.IdempotencyKeyTTL))
+	}
+
+	var saved models.IdempotentResponse
+	t.Run("First request", func(t *testing.T) {
+		claim("key-1").Return(nil, nil)
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Return(&models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1, RemainingCoins: 980}, nil)
+		mockDB.EXPECT().SaveIdempotentResponse(gomock.Any(), int32(1), "key-1", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ int32, _ string, response models.IdempotentResponse) error {
+				saved = response
+				return nil
+			})
+
+		resp := client.WithHeader(idempotencyKeyHeader, "key-1").Get(t, "/api/buy/cup")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get(idempotentReplayedHeader))
+		assert.Equal(t, "980", resp.Header.Get(coinsBalanceHeader))
+		assert.Equal(t, http.StatusOK, saved.StatusCode)
+		assert.Equal(t, resp.Body, string(saved.Body), "the response sent must be the one stored")
+		assert.NotEmpty(t, saved.Fingerprint)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		claim("key-1").Return(&saved, nil)
+
+		resp := client.WithHeader(idempotencyKeyHeader, "key-1").Get(t, "/api/buy/cup")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "true", resp.Header.Get(idempotentReplayedHeader))
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, string(saved.Body), resp.Body, "a repeat must not buy the item again")
+		assert.Empty(t, resp.Header.Get(coinsBalanceHeader), "the balance may have changed since the first request")
+	})
+
+	t.Run("Key reused for another item", func(t *testing.T) {
+		claim("key-1").Return(&saved, nil)
+
+		resp := client.WithHeader(idempotencyKeyHeader, "key-1").Get(t, "/api/buy/pen")
+		resp.AssertErrorCode(t, http.StatusUnprocessableEntity, models.ErrCodeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+	})
+
+	t.Run("Failure is not stored", func(t *testing.T) {
+		claim("key-2").Return(nil, nil)
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Return(nil, storage.ErrInsufficientFunds)
+
+		resp := client.WithHeader(idempotencyKeyHeader, "key-2").Get(t, "/api/buy/cup")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Transfer", func(t *testing.T) {
+		req := models.SendCoinRequest{ToUser: "bob", Amount: 100}
+		claim("key-3").Return(nil, nil)
+		mockDB.EXPECT().TransferCoins(gomock.Any(), int32(1), req).Return(&models.TransferResult{TransferID: 7}, nil)
+		mockDB.EXPECT().SaveIdempotentResponse(gomock.Any(), int32(1), "key-3", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ int32, _ string, response models.IdempotentResponse) error {
+				saved = response
+				return nil
+			})
+
+		resp := client.WithHeader(idempotencyKeyHeader, "key-3").PostJSON(t, "/api/sendCoin", req)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"transferId":7}`, string(saved.Body))
+
+		claim("key-3").Return(&saved, nil)
+		resp = client.WithHeader(idempotencyKeyHeader, "key-3").PostJSON(t, "/api/sendCoin", req)
+		assert.Equal(t, "true", resp.Header.Get(idempotentReplayedHeader))
+		assert.JSONEq(t, `{"transferId":7}`, resp.Body)
+
+		claim("key-3").Return(&saved, nil)
+		resp = client.WithHeader(idempotencyKeyHeader, "key-3").PostJSON(t, "/api/sendCoin", models.SendCoinRequest{ToUser: "bob", Amount: 200})
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("Bypassed", func(t *testing.T) {
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Return(&models.PurchaseResult{Item: "cup"}, nil).Times(2)
+
+		resp := client.Get(t, "/api/buy/cup")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "requests without a key are served as usual")
+		resp = client.WithHeader(idempotencyKeyHeader, "key-4").WithHeader("X-Dry-Run", "true").Get(t, "/api/buy/cup")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "dry runs change nothing and need no key")
+	})
+
+	t.Run("Key too long", func(t *testing.T) {
+		resp := client.WithHeader(idempotencyKeyHeader, strings.Repeat("k", maxIdempotencyKeyLength+1)).Get(t, "/api/buy/cup")
+		resp.AssertError(t, http.StatusBadRequest, "invalid Idempotency-Key value; expected at most 255 characters")
+	})
+}
+
+func TestPreviewTransferHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	bob := models.SendCoinRequest{ToUser: "bob", Amount: 760}
+	preview := func() *models.TransferPreview {
+		return &models.TransferPreview{ToUser: "bob", Amount: 760, SenderBalance: 240, RecipientBalance: 1860}
+	}
+
+	errorCases := []struct {
+		name    string
+		query   string
+		err     error
+		status  int
+		message string
+	}{
+		{name: "Missing recipient", query: "amount=760", status: http.StatusBadRequest, message: "missing username or amount"},
+		{name: "Missing amount", query: "toUser=bob", status: http.StatusBadRequest, message: "missing username or amount"},
+		{name: "Sender no longer exists", query: "toUser=bob&amount=760", err: storage.ErrUserNotFound, status: http.StatusUnauthorized, message: "user not found"},
+		{name: "Insufficient funds", query: "toUser=bob&amount=760", err: storage.ErrInsufficientFunds, status: http.StatusBadRequest, message: "insufficient funds to perform the transfer"},
+		{name: "Recipient not found", query: "toUser=bob&amount=760", err: storage.ErrRecipientNotFound, status: http.StatusBadRequest, message: "recipient not found"},
+		{name: "Self-transfer", query: "toUser=bob&amount=760", err: storage.ErrSelfTransfer, status: http.StatusBadRequest, message: "self-transfer of money is not allowed; please choose a different user."},
+		{name: "Balance cap", query: "toUser=bob&amount=760", err: storage.ErrBalanceCapExceeded, status: http.StatusBadRequest, message: "recipient cannot hold that many coins"},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.err != nil {
+				mockDB.EXPECT().PreviewTransfer(gomock.Any(), int32(1), bob).Return(nil, tc.err)
+			}
+			client.Get(t, "/api/sendCoin/preview?"+tc.query).AssertError(t, tc.status, tc.message)
+		})
+	}
+
+	t.Run("Invalid amount", func(t *testing.T) {
+		for _, amount := range []string{"-5", "7.5", "abc"} {
+			resp := client.Get(t, "/api/sendCoin/preview?toUser=bob&amount="+amount)
+			resp.AssertErrorCode(t, http.StatusBadRequest, models.ErrCodeAmountInvalid, "amount must be a non-negative integer")
+		}
+	})
+
+	t.Run("Recipient balance hidden", func(t *testing.T) {
+		mockDB.EXPECT().PreviewTransfer(gomock.Any(), int32(1), bob).Return(preview(), nil)
+
+		resp := client.Get(t, "/api/sendCoin/preview?toUser=bob&amount=760")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"ok":true,"toUser":"bob","amount":760,"senderBalance":240}`, resp.Body)
+	})
+
+	t.Run("Recipient balance shown", func(t *testing.T) {
+		appInstance.SetShowRecipientBalance(true)
+		defer appInstance.SetShowRecipientBalance(false)
+		mockDB.EXPECT().PreviewTransfer(gomock.Any(), int32(1), bob).Return(preview(), nil)
+
+		resp := client.Get(t, "/api/sendCoin/preview?toUser=bob&amount=760")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"ok":true,"toUser":"bob","amount":760,"senderBalance":240,"recipientBalance":1860}`, resp.Body)
+	})
+}
+
+func TestTermsHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(now))
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+	user := client.WithUser(t, 1)
+
+	t.Run("Not configured", func(t *testing.T) {
+		client.Get(t, "/api/tos").AssertError(t, http.StatusNotFound, "terms of service not configured")
+		user.PostJSON(t, "/api/tos/accept", models.AcceptTermsRequest{Version: 1}).AssertError(t, http.StatusNotFound, "terms of service not configured")
+	})
+
+	appInstance.SetTermsVersion(3)
+
+	t.Run("Terms", func(t *testing.T) {
+		resp := client.Get(t, "/api/tos")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var terms models.Terms
+		resp.Decode(t, &terms)
+		assert.Equal(t, 3, terms.Version)
+		assert.NotEmpty(t, terms.Text)
+	})
+
+	t.Run("Purchase before acceptance", func(t *testing.T) {
+		mockDB.EXPECT().GetTermsAcceptance(gomock.Any(), int32(1)).Return(&models.TermsAcceptance{Version: 2}, nil)
+		resp := user.Get(t, "/api/buy/cup")
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeTermsNotAccepted, "terms of service must be accepted at /api/tos/accept")
+	})
+
+	t.Run("Transfer before acceptance", func(t *testing.T) {
+		mockDB.EXPECT().GetTermsAcceptance(gomock.Any(), int32(1)).Return(&models.TermsAcceptance{}, nil)
+		resp := user.PostJSON(t, "/api/sendCoin", models.SendCoinRequest{ToUser: "bob", Amount: 100})
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeTermsNotAccepted, "terms of service must be accepted at /api/tos/accept")
+	})
+
+	t.Run("Accept outdated version", func(t *testing.T) {
+		resp := user.PostJSON(t, "/api/tos/accept", models.AcceptTermsRequest{Version: 2})
+		resp.AssertError(t, http.StatusConflict, "terms of service version is not current; read them again at /api/tos")
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		mockDB.EXPECT().AcceptTerms(gomock.Any(), int32(1), 3, now).Return(&models.TermsAcceptance{Version: 3, AcceptedAt: &now}, nil)
+		resp := user.PostJSON(t, "/api/tos/accept", models.AcceptTermsRequest{Version: 3})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"version":3,"acceptedAt":"2025-06-10T12:00:00Z"}`, resp.Body)
+
+		mockDB.EXPECT().GetTermsAcceptance(gomock.Any(), int32(1)).Return(&models.TermsAcceptance{Version: 3, AcceptedAt: &now}, nil)
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "cup").Return(&models.PurchaseResult{Item: "cup", Price: 20, Quantity: 1}, nil)
+		assert.Equal(t, http.StatusOK, user.Get(t, "/api/buy/cup").StatusCode)
+	})
+}
+
+func TestAuthRateLimiter_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l)
+	service.SetAuthRateLimiter(ratelimit.NewIPLimiter(60, 2, nil, clock.NewFake(time.Now())))
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(&models.InfoResponse{Coins: 1000}, nil).Times(5)
+
+	credentials := models.AuthRequest{Username: "alice"}
+	for i := 0; i < 2; i++ {
+		resp := client.PostJSON(t, "/api/auth", credentials)
+		resp.AssertError(t, http.StatusBadRequest, "missing username or password")
+	}
+	client.PostJSON(t, "/api/auth", credentials).AssertErrorCode(t, http.StatusTooManyRequests, models.ErrCodeRateLimited, "too many requests, try again later")
+
+	for i := 0; i < 5; i++ {
+		resp := client.WithUser(t, 1).Get(t, "/api/info")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "authenticated routes must not be throttled per IP")
+	}
+}
+
+func TestInvariantsHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetClock(clock.NewFake(time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)))
+	testServer := httptest.NewServer(NewService(appInstance, config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.Get(t, "/api/admin/invariants")
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Consistent", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().CheckInvariants(gomock.Any()).Return(&models.InvariantReport{TotalBalances: 1500, TotalLedger: 1500, Violations: []models.InvariantViolation{}}, nil)
+
+		resp := client.Get(t, "/api/admin/invariants")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"checkedAt":"2025-06-10T12:00:00Z","totalBalances":1500,"totalLedger":1500,"violations":[]}`, resp.Body)
+	})
+
+	t.Run("Violations", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().CheckInvariants(gomock.Any()).Return(&models.InvariantReport{TotalBalances: 1507, TotalLedger: 1500, Violations: []models.InvariantViolation{
+			{Invariant: models.InvariantLedgerBalance, Table: "content.users", RowID: 2, Expected: 500, Actual: 507, Detail: "balance differs from the recorded operations"},
+		}}, nil)
+
+		resp := client.Get(t, "/api/admin/invariants")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"checkedAt":"2025-06-10T12:00:00Z","totalBalances":1507,"totalLedger":1500,"violations":[
+			{"invariant":"ledger_balance","table":"content.users","rowId":2,"expected":500,"actual":507,"detail":"balance differs from the recorded operations"}]}`, resp.Body)
+	})
+}
+
+func TestBuyItemByIDHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	t.Run("Same item by name and by ID", func(t *testing.T) {
+		mockDB.EXPECT().GetItemByID(gomock.Any(), 7).Return(&models.Item{ID: 7, Name: "pink-hoody", Price: 500}, nil).Times(2)
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "pink-hoody").
+			Return(&models.PurchaseResult{Item: "pink-hoody", Price: 500, Quantity: 1, RemainingCoins: 500}, nil).Times(3)
+
+		byName := client.Get(t, "/api/buy/pink-hoody")
+		require.Equal(t, http.StatusOK, byName.StatusCode)
+		byID := client.Get(t, "/api/buy/id/7")
+		require.Equal(t, http.StatusOK, byID.StatusCode)
+		assert.JSONEq(t, byName.Body, byID.Body, "both addressing modes must make the same purchase")
+
+		byPost := client.Post(t, "/api/buy/id/7", nil)
+		require.Equal(t, http.StatusOK, byPost.StatusCode)
+		assert.JSONEq(t, byName.Body, byPost.Body)
+	})
+
+	t.Run("Invalid ID", func(t *testing.T) {
+		for _, id := range []string{"abc", "0", "-3", "1.5", "99999999999999999999"} {
+			resp := client.Get(t, "/api/buy/id/"+id)
+			resp.AssertErrorCode(t, http.StatusBadRequest, models.ErrCodeItemIDInvalid, "invalid item ID; expected a positive integer")
+		}
+	})
+
+	t.Run("Unknown ID", func(t *testing.T) {
+		mockDB.EXPECT().GetItemByID(gomock.Any(), 404).Return(nil, fmt.Errorf("%w: %w", storage.ErrItemNotFound, sql.ErrNoRows))
+
+		resp := client.Get(t, "/api/buy/id/404")
+		resp.AssertError(t, http.StatusBadRequest, "invalid item name provided")
+	})
+}
+
+func TestConfigHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	adminAPISecret, accrualAmount := config.AdminAPISecret, config.AccrualAmount
+	t.Cleanup(func() { config.AdminAPISecret, config.AccrualAmount = adminAPISecret, accrualAmount })
+	config.AdminAPISecret = "top-secret-value"
+	config.AccrualAmount = 250
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.Get(t, "/api/admin/config")
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Redacted", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+		resp := client.Get(t, "/api/admin/config")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotContains(t, resp.Body, "top-secret-value", "secrets must never be served")
+
+		var effective config.EffectiveConfig
+		resp.Decode(t, &effective)
+		assert.Equal(t, config.RedactedValue, effective.Settings["auth"]["ADMIN_API_SECRET"])
+		assert.Equal(t, config.RedactedValue, effective.Settings["database"]["DATABASE_URI"])
+		assert.Equal(t, float64(250), effective.Settings["economy"]["ACCRUAL_AMOUNT"])
+		assert.Equal(t, config.Effective().Hash, effective.Hash)
+	})
+}
+
+func TestVerifiedTokenCacheRevocation_Gomock(t *testing.T) {
+	auth.SetVerifiedTokenCacheSize(16)
+	t.Cleanup(func() { auth.SetVerifiedTokenCacheSize(0) })
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetSessionLimit(3)
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	testServer := httptest.NewServer(service.NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.IssueToken(1)
+	require.NoError(t, err)
+	other, err := auth.IssueToken(1)
+	require.NoError(t, err)
+
+	revoked := false
+	mockDB.EXPECT().IsSessionActive(gomock.Any(), int32(1), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, _ int32, sessionID string) (bool, error) {
+		return !(revoked && sessionID == token.ID), nil
+	})
+	mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).AnyTimes().Return(&models.InfoResponse{Coins: 1000}, nil)
+
+	for i := 0; i < 2; i++ {
+		resp := client.WithToken(token.Token).Get(t, "/api/info")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	mockDB.EXPECT().RevokeSession(gomock.Any(), int32(1), token.ID).DoAndReturn(func(context.Context, int32, string) error {
+		revoked = true
+		return nil
+	})
+	resp := client.WithToken(other.Token).Delete(t, "/api/auth/sessions/"+token.ID)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = client.WithToken(token.Token).Get(t, "/api/info")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "a revoked session must be rejected with the cache enabled")
+	assert.Equal(t, "{\"errors\":\"session revoked\",\"code\":\"SESSION_REVOKED\"}\n", resp.Body)
+}
+
+func TestCampaignHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	startsAt, endsAt := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC), time.Date(2025, 6, 9, 9, 0, 0, 0, time.UTC)
+	campaign := models.Campaign{ID: 3, Name: "Kudos week", Multiplier: 2, Budget: 10000, RemainingBudget: 10000, StartsAt: startsAt, EndsAt: endsAt, CreatedAt: startsAt}
+	campaignJSON := `{"id":3,"name":"Kudos week","multiplier":2,"budget":10000,"remainingBudget":10000,"startsAt":"2025-06-02T09:00:00Z","endsAt":"2025-06-09T09:00:00Z","createdAt":"2025-06-02T09:00:00Z"}`
+	body := []byte(`{"name": "Kudos week", "multiplier": 2, "budget": 10000, "startsAt": "2025-06-02T09:00:00Z", "endsAt": "2025-06-09T09:00:00Z"}`)
+	request := models.Campaign{Name: "Kudos week", Multiplier: 2, Budget: 10000, StartsAt: startsAt, EndsAt: endsAt}
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.Post(t, "/api/admin/campaigns", body)
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().CreateCampaign(gomock.Any(), request).Return(&campaign, nil)
+
+		resp := client.Post(t, "/api/admin/campaigns", body)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.JSONEq(t, campaignJSON, resp.Body)
+	})
+
+	t.Run("Create invalid", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+		resp := client.Post(t, "/api/admin/campaigns", []byte(`{"name": "Kudos week", "multiplier": 1, "budget": 10000, "startsAt": "2025-06-02T09:00:00Z", "endsAt": "2025-06-09T09:00:00Z"}`))
+		resp.AssertError(t, http.StatusBadRequest, app.ErrInvalidCampaignMultiplier.Error())
+	})
+
+	t.Run("List", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().GetCampaigns(gomock.Any()).Return([]models.Campaign{campaign}, nil)
+
+		resp := client.Get(t, "/api/admin/campaigns")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"campaigns":[`+campaignJSON+`]}`, resp.Body)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(3)
+		mockDB.EXPECT().GetCampaign(gomock.Any(), int64(3)).Return(&campaign, nil)
+		mockDB.EXPECT().GetCampaign(gomock.Any(), int64(4)).Return(nil, storage.ErrCampaignNotFound)
+
+		resp := client.Get(t, "/api/admin/campaigns/3")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, campaignJSON, resp.Body)
+
+		client.Get(t, "/api/admin/campaigns/4").AssertError(t, http.StatusNotFound, "campaign not found")
+		client.Get(t, "/api/admin/campaigns/abc").AssertError(t, http.StatusBadRequest, "invalid campaign id")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(2)
+		updated := request
+		updated.ID = 3
+		mockDB.EXPECT().UpdateCampaign(gomock.Any(), updated).Return(&campaign, nil)
+		mockDB.EXPECT().UpdateCampaign(gomock.Any(), updated).Return(nil, storage.ErrCampaignBudgetSpent)
+
+		resp := client.Do(t, http.MethodPut, "/api/admin/campaigns/3", body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, campaignJSON, resp.Body)
+
+		resp = client.Do(t, http.MethodPut, "/api/admin/campaigns/3", body)
+		resp.AssertError(t, http.StatusConflict, "budget is lower than the bonuses already paid")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(2)
+		mockDB.EXPECT().DeleteCampaign(gomock.Any(), int64(3)).Return(storage.ErrCampaignInUse)
+		mockDB.EXPECT().DeleteCampaign(gomock.Any(), int64(4)).Return(nil)
+
+		resp := client.Delete(t, "/api/admin/campaigns/3")
+		resp.AssertError(t, http.StatusConflict, "campaign has paid bonuses; move its end to end it instead")
+
+		resp = client.Delete(t, "/api/admin/campaigns/4")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+}
+
+func TestTransferHandler_CampaignBonus_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	campaignID := int64(3)
+	createdAt := time.Date(2025, 6, 3, 10, 0, 0, 0, time.UTC)
+	mockDB.EXPECT().GetTransfer(gomock.Any(), int32(1), int64(7)).Return(&models.Transfer{ID: 7, FromUser: "alice", ToUser: "bob", Amount: 100, Bonus: 100, CampaignID: &campaignID, CreatedAt: createdAt}, nil)
+	mockDB.EXPECT().GetTransfer(gomock.Any(), int32(1), int64(8)).Return(&models.Transfer{ID: 8, FromUser: "alice", ToUser: "bob", Amount: 100, CreatedAt: createdAt}, nil)
+
+	resp := client.Get(t, "/api/transfers/7")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"id":7,"fromUser":"alice","toUser":"bob","amount":100,"bonus":100,"campaignId":3,"createdAt":"2025-06-03T10:00:00Z"}`, resp.Body)
+
+	resp = client.Get(t, "/api/transfers/8")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"id":8,"fromUser":"alice","toUser":"bob","amount":100,"createdAt":"2025-06-03T10:00:00Z"}`, resp.Body, "transfers outside campaigns must not show a bonus")
+}
+
+func TestPromotionHandlers_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer).WithUser(t, 1)
+
+	startsAt, endsAt := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC)
+	promotion := models.Promotion{ID: 5, Item: "hoody", DiscountPercent: 20, StartsAt: startsAt, EndsAt: endsAt, CreatedAt: startsAt}
+	promotionJSON := `{"id":5,"item":"hoody","discountPercent":20,"startsAt":"2025-06-02T00:00:00Z","endsAt":"2025-06-09T00:00:00Z","createdAt":"2025-06-02T00:00:00Z"}`
+	body := []byte(`{"item": "hoody", "discountPercent": 20, "startsAt": "2025-06-02T00:00:00Z", "endsAt": "2025-06-09T00:00:00Z"}`)
+	request := models.Promotion{Item: "hoody", DiscountPercent: 20, StartsAt: startsAt, EndsAt: endsAt}
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.Post(t, "/api/admin/promotions", body)
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().CreatePromotion(gomock.Any(), request).Return(&promotion, nil)
+
+		resp := client.Post(t, "/api/admin/promotions", body)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.JSONEq(t, promotionJSON, resp.Body)
+	})
+
+	t.Run("Create invalid", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(2)
+		mockDB.EXPECT().CreatePromotion(gomock.Any(), gomock.Any()).Return(nil, storage.ErrItemNotFound)
+
+		resp := client.Post(t, "/api/admin/promotions", []byte(`{"item": "hoody", "discountPercent": 20, "discountAmount": 50, "startsAt": "2025-06-02T00:00:00Z", "endsAt": "2025-06-09T00:00:00Z"}`))
+		resp.AssertError(t, http.StatusBadRequest, app.ErrInvalidPromotionDiscount.Error())
+
+		resp = client.Post(t, "/api/admin/promotions", []byte(`{"item": "yacht", "discountAmount": 50, "startsAt": "2025-06-02T00:00:00Z", "endsAt": "2025-06-09T00:00:00Z"}`))
+		resp.AssertError(t, http.StatusBadRequest, "item not found")
+	})
+
+	t.Run("List and get", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(4)
+		mockDB.EXPECT().GetPromotions(gomock.Any()).Return([]models.Promotion{promotion}, nil)
+		mockDB.EXPECT().GetPromotion(gomock.Any(), int64(5)).Return(&promotion, nil)
+		mockDB.EXPECT().GetPromotion(gomock.Any(), int64(6)).Return(nil, storage.ErrPromotionNotFound)
+
+		resp := client.Get(t, "/api/admin/promotions")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"promotions":[`+promotionJSON+`]}`, resp.Body)
+
+		resp = client.Get(t, "/api/admin/promotions/5")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, promotionJSON, resp.Body)
+
+		client.Get(t, "/api/admin/promotions/6").AssertError(t, http.StatusNotFound, "promotion not found")
+		client.Get(t, "/api/admin/promotions/abc").AssertError(t, http.StatusBadRequest, "invalid promotion id")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(2)
+		updated := request
+		updated.ID = 5
+		mockDB.EXPECT().UpdatePromotion(gomock.Any(), updated).Return(&promotion, nil)
+		mockDB.EXPECT().UpdatePromotion(gomock.Any(), updated).Return(nil, storage.ErrPromotionNotFound)
+
+		resp := client.Do(t, http.MethodPut, "/api/admin/promotions/5", body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, promotionJSON, resp.Body)
+
+		resp = client.Do(t, http.MethodPut, "/api/admin/promotions/5", body)
+		resp.AssertError(t, http.StatusNotFound, "promotion not found")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(2)
+		mockDB.EXPECT().DeletePromotion(gomock.Any(), int64(5)).Return(storage.ErrPromotionInUse)
+		mockDB.EXPECT().DeletePromotion(gomock.Any(), int64(6)).Return(nil)
+
+		resp := client.Delete(t, "/api/admin/promotions/5")
+		resp.AssertError(t, http.StatusConflict, "promotion has discounted purchases; move its end to end it instead")
+
+		resp = client.Delete(t, "/api/admin/promotions/6")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("Promoted prices", func(t *testing.T) {
+		promotionID := int64(5)
+		mockDB.EXPECT().GetCatalogLastModified(gomock.Any()).Return(startsAt, nil)
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return([]models.CatalogItem{
+			{Name: "hoody", Category: "apparel", Price: 240, OriginalPrice: 300, PromotionID: &promotionID},
+			{Name: "cup", Category: "accessories", Price: 20},
+		}, nil)
+
+		resp := client.Get(t, "/api/merch")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `[{"name":"hoody","category":"apparel","price":240,"originalPrice":300,"promotionId":5},{"name":"cup","category":"accessories","price":20}]`, resp.Body)
+
+		mockDB.EXPECT().BuyItem(gomock.Any(), int32(1), "hoody").Return(&models.PurchaseResult{
+			Item: "hoody", Price: 240, OriginalPrice: 300, PromotionID: &promotionID, Quantity: 1, RemainingCoins: 760,
+		}, nil)
+
+		resp = client.Get(t, "/api/buy/hoody")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var purchase models.PurchaseResult
+		resp.Decode(t, &purchase)
+		assert.Equal(t, 240, purchase.Price)
+		assert.Equal(t, 300, purchase.OriginalPrice)
+		require.NotNil(t, purchase.PromotionID)
+		assert.Equal(t, promotionID, *purchase.PromotionID)
+	})
+}
+
+func TestMerchCategories_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+	user := client.WithUser(t, 1)
+
+	catalog := []models.CatalogItem{
+		{Name: "t-shirt", Category: "apparel", Price: 80},
+		{Name: "cup", Category: "accessories", Price: 20},
+		{Name: "hoody", Category: "apparel", Price: 300},
+		{Name: "sticker", Price: 5},
+	}
+	mockDB.EXPECT().GetCatalogLastModified(gomock.Any()).Return(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), nil).AnyTimes()
+
+	t.Run("Catalog of a category", func(t *testing.T) {
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+
+		resp := client.Get(t, "/api/merch?category=Apparel")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `[{"name":"t-shirt","category":"apparel","price":80},{"name":"hoody","category":"apparel","price":300}]`, resp.Body)
+	})
+
+	t.Run("Uncategorized items in the whole catalog only", func(t *testing.T) {
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+
+		resp := client.Get(t, "/api/merch")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Body, `{"name":"sticker","price":5}`, "uncategorized items have no category")
+	})
+
+	t.Run("Unknown category", func(t *testing.T) {
+		mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return(catalog, nil)
+
+		client.Get(t, "/api/merch?category=furniture").AssertErrorCode(t, http.StatusNotFound, models.ErrCodeCategoryNotFound, "unknown category")
+	})
+
+	t.Run("Invalid category", func(t *testing.T) {
+		resp := client.Get(t, "/api/merch?category="+strings.Repeat("a", models.MaxCategoryLength+1))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, resp.Body, models.ErrCodeFieldInvalid)
+	})
+
+	t.Run("Inventory grouped by category", func(t *testing.T) {
+		mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(&models.InfoResponse{
+			Coins: 600,
+			Inventory: []models.InventoryItem{
+				{Type: "sticker", Quantity: 3, PendingQuantity: 3},
+				{Type: "t-shirt", Category: "apparel", Quantity: 1, PendingQuantity: 1},
+				{Type: "cup", Category: "accessories", Quantity: 2, FulfilledQuantity: 2},
+			},
+		}, nil)
+
+		resp := user.Get(t, "/api/info?groupBy=category")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var info models.InfoResponse
+		resp.Decode(t, &info)
+		assert.Len(t, info.Inventory, 3, "the flat inventory is kept")
+		assert.Equal(t, []models.InventoryCategory{
+			{Category: "accessories", Items: []models.InventoryItem{{Type: "cup", Category: "accessories", Quantity: 2, FulfilledQuantity: 2}}},
+			{Category: "apparel", Items: []models.InventoryItem{{Type: "t-shirt", Category: "apparel", Quantity: 1, PendingQuantity: 1}}},
+			{Items: []models.InventoryItem{{Type: "sticker", Quantity: 3, PendingQuantity: 3}}},
+		}, info.InventoryByCategory)
+	})
+
+	t.Run("Inventory not grouped by default", func(t *testing.T) {
+		mockDB.EXPECT().GetInfo(gomock.Any(), int32(1)).Return(&models.InfoResponse{
+			Inventory: []models.InventoryItem{{Type: "t-shirt", Category: "apparel", Quantity: 1, PendingQuantity: 1}},
+		}, nil)
+
+		resp := user.Get(t, "/api/info")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotContains(t, resp.Body, "inventoryByCategory")
+		assert.Contains(t, resp.Body, `{"type":"t-shirt","category":"apparel","quantity":1,"pendingQuantity":1,"fulfilledQuantity":0}`)
+	})
+
+	t.Run("Invalid groupBy", func(t *testing.T) {
+		user.Get(t, "/api/info?groupBy=price").AssertError(t, http.StatusBadRequest, "invalid groupBy value; expected category")
+	})
+
+	t.Run("Assignment forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := user.Do(t, http.MethodPut, "/api/admin/merch/cup/category", []byte(`{"category": "kitchen"}`))
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Assign and clear", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil).Times(2)
+		mockDB.EXPECT().SetMerchCategory(gomock.Any(), "cup", "kitchen").Return(&models.MerchCategory{Item: "cup", Category: "kitchen"}, nil)
+		mockDB.EXPECT().SetMerchCategory(gomock.Any(), "cup", "").Return(&models.MerchCategory{Item: "cup"}, nil)
+
+		resp := user.Do(t, http.MethodPut, "/api/admin/merch/cup/category", []byte(`{"category": " Kitchen "}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"item":"cup","category":"kitchen"}`, resp.Body)
+
+		resp = user.Do(t, http.MethodPut, "/api/admin/merch/cup/category", []byte(`{"category": ""}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"item":"cup"}`, resp.Body, "the item is left uncategorized")
+	})
+
+	t.Run("Assign to an unknown item", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().SetMerchCategory(gomock.Any(), "yacht", "boats").Return(nil, storage.ErrItemNotFound)
+
+		resp := user.Do(t, http.MethodPut, "/api/admin/merch/yacht/category", []byte(`{"category": "boats"}`))
+		resp.AssertError(t, http.StatusNotFound, "item not found")
+	})
+}
+
+func TestImpersonation_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	core, logs := observer.New(zap.InfoLevel)
+	l := &logger.Logger{Logger: zap.New(core)}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+	admin := client.WithUser(t, 1)
+
+	t.Run("Not an administrator", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(2)).Return(false, nil)
+
+		resp := client.WithUser(t, 2).Post(t, "/api/admin/impersonate/3", nil)
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().IsUserActive(gomock.Any(), int32(99)).Return(false, nil)
+
+		resp := admin.Post(t, "/api/admin/impersonate/99", nil)
+		resp.AssertError(t, http.StatusNotFound, "user not found")
+	})
+
+	t.Run("Oneself", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+		resp := admin.Post(t, "/api/admin/impersonate/1", nil)
+		resp.AssertError(t, http.StatusBadRequest, "cannot impersonate yourself")
+	})
+
+	mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+	mockDB.EXPECT().IsUserActive(gomock.Any(), int32(2)).Return(true, nil)
+	resp := admin.Post(t, "/api/admin/impersonate/2", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	var impersonation models.ImpersonationResponse
+	resp.Decode(t, &impersonation)
+	assert.Equal(t, int32(2), impersonation.UserID)
+	assert.WithinDuration(t, time.Now().Add(auth.ImpersonationTTL), impersonation.ExpiresAt, time.Minute)
+	support := client.WithToken(impersonation.Token)
+
+	t.Run("Read-only route", func(t *testing.T) {
+		logs.TakeAll()
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+		mockDB.EXPECT().GetTransfer(gomock.Any(), int32(2), int64(7)).
+			Return(&models.Transfer{ID: 7, FromUser: "bob", ToUser: "alice", Amount: 40, CreatedAt: time.Date(2025, 2, 3, 4, 5, 6, 0, time.UTC)}, nil)
+
+		resp := support.Get(t, "/api/transfers/7")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"id":7,"fromUser":"bob","toUser":"alice","amount":40,"createdAt":"2025-02-03T04:05:06Z"}`, resp.Body,
+			"the administrator must see what the user sees")
+
+		entries := logs.FilterMessage("impersonated request").AllUntimed()
+		require.Len(t, entries, 1)
+		assert.Equal(t, map[string]any{
+			"impersonator": int32(1), "userID": int32(2), "route": "GET /api/transfers/{id}", "path": "/api/transfers/7", "status": int64(http.StatusOK),
+		}, entries[0].ContextMap())
+	})
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		route  string
+	}{
+		{name: "Transfer", method: http.MethodPost, path: "/api/sendCoin", body: []byte(`{"toUser": "mallory", "amount": 100}`), route: "POST /api/sendCoin"},
+		{name: "Purchase", method: http.MethodGet, path: "/api/buy/cup", route: "GET /api/buy/{item}"},
+		{name: "Data export", method: http.MethodGet, path: "/api/account/export", route: "GET /api/account/export"},
+		{name: "Administration", method: http.MethodPost, path: "/api/admin/impersonate/3", route: "POST /api/admin/*"},
+	} {
+		t.Run("Mutation rejected: "+tc.name, func(t *testing.T) {
+			logs.TakeAll()
+
+			resp := support.Do(t, tc.method, tc.path, tc.body)
+			resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeImpersonationReadOnly, "impersonation tokens are read-only")
+
+			entries := logs.FilterMessage("impersonated request").AllUntimed()
+			require.Len(t, entries, 1, "rejected requests must be audited as well")
+			fields := entries[0].ContextMap()
+			assert.Equal(t, int32(1), fields["impersonator"])
+			assert.Equal(t, int32(2), fields["userID"])
+			assert.Equal(t, tc.route, fields["route"])
+			assert.Equal(t, int64(http.StatusForbidden), fields["status"])
+		})
+	}
+
+	t.Run("Administrator rights lost", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := support.Get(t, "/api/transfers/7")
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+}
+
+func TestWriteJSONStream(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	h := newHandlers(nil, &logger.Logger{Logger: zap.New(core)})
+
+	t.Run("Exact output", func(t *testing.T) {
+		info := &models.InfoResponse{
+			Coins:          990,
+			AvailableCoins: 990,
+			Inventory:      []models.InventoryItem{{Type: "pen", Quantity: 1}},
+			CoinHistory: models.CoinHistory{
+				Received: []models.TransactionDetail{{FromUser: "alice", Amount: 20}},
+				Sent:     []models.TransactionDetail{{ToUser: "bob", Amount: 30}},
+			},
+		}
+
+		res := httptest.NewRecorder()
+		h.writeJSONStream(res, httptest.NewRequest(http.MethodGet, "/api/info", nil), info)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+		// Like the error responses, successful streamed responses end with the newline written by json.Encoder.
+		assert.Equal(t, `{"coins":990,"availableCoins":990,`+
+			`"inventory":[{"type":"pen","quantity":1,"pendingQuantity":0,"fulfilledQuantity":0}],`+
+			`"coinHistory":{"received":[{"fromUser":"alice","amount":20}],"sent":[{"toUser":"bob","amount":30}]}}`+"\n",
+			res.Body.String())
+		assert.Zero(t, logs.Len())
+	})
+
+	t.Run("Encoding failure after the status", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		h.writeJSONStream(res, httptest.NewRequest(http.MethodGet, "/api/history", nil), map[string]any{"amount": make(chan int)})
+
+		assert.Equal(t, http.StatusOK, res.Code, "the status is written before encoding")
+		assert.Empty(t, res.Body.String())
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		assert.Contains(t, entries[0].Message, "GET /api/history cut short")
+	})
+}
+
+// discardResponseWriter is a ResponseWriter dropping the body, so that benchmarks measure only the serialization.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (res *discardResponseWriter) Header() http.Header         { return res.header }
+func (res *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (res *discardResponseWriter) WriteHeader(int)             {}
+
+// BenchmarkInfoResponse_50kHistory compares the allocations of marshaling the account information of a user with
+// 50,000 transfers into a byte slice before writing it and of encoding it straight into the response.
+func BenchmarkInfoResponse_50kHistory(b *testing.B) {
+	info := &models.InfoResponse{Coins: 1000, AvailableCoins: 1000, Inventory: []models.InventoryItem{}}
+	for i := 0; i < 25000; i++ {
+		info.CoinHistory.Received = append(info.CoinHistory.Received, models.TransactionDetail{FromUser: fmt.Sprintf("sender%d", i), Amount: i})
+		info.CoinHistory.Sent = append(info.CoinHistory.Sent, models.TransactionDetail{ToUser: fmt.Sprintf("recipient%d", i), Amount: i})
+	}
+	h := newHandlers(nil, &logger.Logger{Logger: zap.NewNop()})
+	req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+
+	b.Run("json.Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			res := &discardResponseWriter{header: http.Header{}}
+			result, err := json.Marshal(info)
+			if err != nil {
+				b.Fatal(err)
+			}
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusOK)
+			res.Write(result)
+		}
+	})
+
+	b.Run("json.Encoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			h.writeJSONStream(&discardResponseWriter{header: http.Header{}}, req, info)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+)
+
+// Headers of idempotent requests: the key chosen by the client, and the marker of responses replayed for it.
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds the length of an idempotency key, which is stored for app.IdempotencyKeyTTL.
+const maxIdempotencyKeyLength = 255
+
+// responseBuffer is an http.ResponseWriter holding the response back until it is known to be stored.
+type responseBuffer struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+// Header returns the header map of the buffered response.
+func (buffer *responseBuffer) Header() http.Header {
+	return buffer.header
+}
+
+// WriteHeader records the status code of the buffered response; only the first call counts.
+func (buffer *responseBuffer) WriteHeader(statusCode int) {
+	if buffer.statusCode == 0 {
+		buffer.statusCode = statusCode
+	}
+}
+
+// Write appends to the body of the buffered response.
+func (buffer *responseBuffer) Write(data []byte) (int, error) {
+	buffer.WriteHeader(http.StatusOK)
+	return buffer.body.Write(data)
+}
+
+// idempotencyMiddleware makes requests carrying an Idempotency-Key header safe to retry: the first request with a key
+// is served and, when successful, its response is stored in the transaction of the changes it reports (see
+// app.ProcessIdempotent). Repeats of the request within app.IdempotencyKeyTTL get the stored response with the
+// Idempotent-Replayed header instead of being served again. A request is identified by its method, path, and body;
+// reusing a key for a different request gets 422. Requests without the header and dry runs are passed through.
+// It must run after auth.CheckTokenMiddleware.
+func (handlers *handlers) idempotencyMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(idempotencyKeyHeader)
+		if dryRun, err := requestDryRun(req); key == "" || err != nil || dryRun {
+			h.ServeHTTP(res, req)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeErrorResponse(res, req, "invalid Idempotency-Key value; expected at most 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := requestUserID(res, req)
+		if !ok {
+			return
+		}
+
+		requestBody, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeErrorResponse(res, req, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var buffer *responseBuffer
+		response, replayed, err := handlers.app.ProcessIdempotent(req.Context(), userID, key, requestFingerprint(req, requestBody),
+			func(ctx context.Context) models.IdempotentResponse {
+				buffer = &responseBuffer{header: res.Header().Clone()}
+				req := req.WithContext(ctx)
+				req.Body = io.NopCloser(bytes.NewReader(requestBody))
+				h.ServeHTTP(buffer, req)
+				buffer.WriteHeader(http.StatusOK)
+				return models.IdempotentResponse{StatusCode: buffer.statusCode, Body: buffer.body.Bytes()}
+			})
+		if errors.Is(err, app.ErrIdempotencyKeyReused) {
+			writeErrorCodeResponse(res, req, "Idempotency-Key was already used for a different request", models.ErrCodeIdempotencyKeyReused, http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			writeInternalErrorResponse(res, req, err)
+			return
+		}
+
+		if replayed {
+			res.Header().Set("Content-Type", "application/json")
+			res.Header().Set(idempotentReplayedHeader, "true")
+		} else {
+			for name, values := range buffer.header {
+				res.Header()[name] = values
+			}
+		}
+		res.WriteHeader(response.StatusCode)
+		res.Write(response.Body)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// requestFingerprint identifies a request by its method, path, and body, so that two requests share a fingerprint
+// only when they ask for the same thing.
+func requestFingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
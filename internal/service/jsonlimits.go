@@ -0,0 +1,116 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+)
+
+// jsonLimits bound the shape of a JSON request body. They are checked by a pass over the tokens of the body before
+// it is decoded, so that pathological payloads, such as thousands of nested objects, are rejected in time linear in
+// their size, whatever the decoding of the target type would cost.
+type jsonLimits struct {
+	maxDepth  int // Maximum nesting of objects and arrays.
+	maxDigits int // Maximum number of digits of a number.
+	maxKeys   int // Maximum number of object keys in the whole body.
+}
+
+// defaultJSONLimits bound the bodies decoded by decodeJSONBody, all of which are flat objects of a few fields.
+var defaultJSONLimits = jsonLimits{maxDepth: 10, maxDigits: 20, maxKeys: 100}
+
+// bulkUsersJSONLimits bound the bodies of bulk user provisioning, which list up to app.MaxBulkUsers objects of two
+// fields. The key cap leaves room for oversized lists to reach the size check of the app.
+var bulkUsersJSONLimits = jsonLimits{maxDepth: 10, maxDigits: 20, maxKeys: 4 * app.MaxBulkUsers}
+
+// jsonLimitError reports a body exceeding one of its jsonLimits, with the machine-readable code of the limit.
+type jsonLimitError struct {
+	code    string
+	message string
+}
+
+func (err *jsonLimitError) Error() string {
+	return err.message
+}
+
+// check walks the tokens of data and returns the first limit it exceeds, or nil.
+// Syntax errors end the walk without an error and are left to the decoding of the body, which reports them.
+func (limits jsonLimits) check(data []byte) *jsonLimitError {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	// Each open container is an object or an array; expectKey is set for objects whose next token is a key.
+	type container struct {
+		object    bool
+		expectKey bool
+	}
+	var stack []container
+	keys := 0
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+
+		var parent *container
+		if len(stack) > 0 {
+			parent = &stack[len(stack)-1]
+		}
+
+		if delim, ok := token.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				if len(stack) == limits.maxDepth {
+					return &jsonLimitError{
+						code:    models.ErrCodeJSONTooDeep,
+						message: fmt.Sprintf("request body is nested deeper than %d levels", limits.maxDepth),
+					}
+				}
+				if parent != nil && parent.object {
+					parent.expectKey = true
+				}
+				stack = append(stack, container{object: delim == '{', expectKey: delim == '{'})
+			default:
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		if parent != nil && parent.object && parent.expectKey {
+			keys++
+			if keys > limits.maxKeys {
+				return &jsonLimitError{
+					code:    models.ErrCodeJSONTooManyKeys,
+					message: fmt.Sprintf("request body has more than %d object keys", limits.maxKeys),
+				}
+			}
+			parent.expectKey = false
+			continue
+		}
+
+		if number, ok := token.(json.Number); ok && countDigits(string(number)) > limits.maxDigits {
+			return &jsonLimitError{
+				code:    models.ErrCodeJSONNumberTooLong,
+				message: fmt.Sprintf("request body has a number longer than %d digits", limits.maxDigits),
+			}
+		}
+		if parent != nil && parent.object {
+			parent.expectKey = true
+		}
+	}
+}
+
+// countDigits returns the number of decimal digits in the number literal s, including those of its fraction and
+// exponent.
+func countDigits(s string) int {
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits++
+		}
+	}
+	return digits
+}
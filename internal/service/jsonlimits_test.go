@@ -0,0 +1,173 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/app"
+	"merch_store/internal/config"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/service/servicetest"
+	"merch_store/internal/storage/mocks"
+)
+
+// nestedJSON returns depth objects nested in each other under the key "a".
+func nestedJSON(depth int) string {
+	return strings.Repeat(`{"a":`, depth) + "1" + strings.Repeat("}", depth)
+}
+
+// nestedArrays returns depth arrays nested in each other.
+func nestedArrays(depth int) string {
+	return strings.Repeat("[", depth) + strings.Repeat("]", depth)
+}
+
+// manyKeysJSON returns an object of n keys.
+func manyKeysJSON(n int) string {
+	fields := make([]string, n)
+	for i := range fields {
+		fields[i] = fmt.Sprintf(`"k%d":%d`, i, i)
+	}
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+func TestJSONLimits_Check(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{name: "Flat object", body: `{"toUser": "bob", "amount": 100}`},
+		{name: "Maximum depth", body: nestedJSON(10)},
+		{name: "Too deep", body: nestedJSON(11), wantCode: models.ErrCodeJSONTooDeep},
+		{name: "Pathologically deep", body: nestedJSON(10000), wantCode: models.ErrCodeJSONTooDeep},
+		{name: "Too deep arrays", body: `{"a":` + nestedArrays(10) + `}`, wantCode: models.ErrCodeJSONTooDeep},
+		{name: "Maximum number", body: `{"amount": -12345678901234567890}`},
+		{name: "Too long number", body: `{"amount": 123456789012345678901}`, wantCode: models.ErrCodeJSONNumberTooLong},
+		{name: "Too long fraction", body: `{"amount": 1.` + strings.Repeat("0", 20) + `}`, wantCode: models.ErrCodeJSONNumberTooLong},
+		{name: "Too long number in an array", body: `[1, 2, ` + strings.Repeat("9", 1000) + `]`, wantCode: models.ErrCodeJSONNumberTooLong},
+		{name: "Long string", body: `{"toUser": "` + strings.Repeat("9", 1000) + `"}`},
+		{name: "Maximum keys", body: manyKeysJSON(100)},
+		{name: "Too many keys", body: manyKeysJSON(101), wantCode: models.ErrCodeJSONTooManyKeys},
+		{name: "Too many keys across objects", body: "[" + strings.Repeat(manyKeysJSON(10)+",", 10) + manyKeysJSON(1) + "]", wantCode: models.ErrCodeJSONTooManyKeys},
+		{name: "Values are not keys", body: `{"a": "b", "c": ["d", "e", {"f": "g"}], "h": {}}`},
+		{name: "Malformed", body: `{"a": {"a": `},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := defaultJSONLimits.check([]byte(tc.body))
+			if tc.wantCode == "" {
+				assert.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			assert.Equal(t, tc.wantCode, err.code)
+			assert.NotEmpty(t, err.Error())
+		})
+	}
+}
+
+func TestDecodeJSONBody_Limits(t *testing.T) {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	h := newHandlers(app.NewApp(nil, l), l)
+
+	t.Run("Rejected with the code of the limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", strings.NewReader(nestedJSON(50)))
+		res := httptest.NewRecorder()
+
+		var sendCoinRequest models.SendCoinRequest
+		assert.False(t, h.decodeJSONBody(res, req, &sendCoinRequest))
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Contains(t, res.Body.String(), `"code":"JSON_TOO_DEEP"`)
+	})
+
+	t.Run("Optional body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/accruals", strings.NewReader(nestedJSON(50)))
+		res := httptest.NewRecorder()
+
+		var accrualRequest models.AccrualRequest
+		assert.False(t, h.decodeOptionalJSONBody(res, req, &accrualRequest))
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Contains(t, res.Body.String(), `"code":"JSON_TOO_DEEP"`)
+	})
+
+	t.Run("Per-endpoint limits", func(t *testing.T) {
+		users := make([]string, app.MaxBulkUsers)
+		for i := range users {
+			users[i] = fmt.Sprintf(`{"username": "user%d", "coins": 100}`, i)
+		}
+		body := `{"users": [` + strings.Join(users, ",") + `]}`
+
+		var bulkRequest models.BulkUsersRequest
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/users/bulk", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		assert.False(t, h.decodeJSONBody(res, req, &bulkRequest))
+		assert.Contains(t, res.Body.String(), `"code":"JSON_TOO_MANY_KEYS"`)
+
+		req = httptest.NewRequest(http.MethodPost, "/api/admin/users/bulk", strings.NewReader(body))
+		res = httptest.NewRecorder()
+		require.True(t, h.decodeJSONBodyWithin(res, req, &bulkRequest, bulkUsersJSONLimits), res.Body.String())
+		assert.Len(t, bulkRequest.Users, app.MaxBulkUsers)
+	})
+}
+
+func TestOptionalJSONBody_Limits_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	l := &logger.Logger{Logger: zap.NewNop()}
+	testServer := httptest.NewServer(NewService(app.NewApp(mockDB, l), config.ServerRunAddress, l).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	token, err := auth.GenerateToken(1)
+	require.NoError(t, err)
+
+	bodies := map[string]string{
+		models.ErrCodeJSONTooDeep:       nestedJSON(11),
+		models.ErrCodeJSONNumberTooLong: `{"mode": 123456789012345678901}`,
+		models.ErrCodeJSONTooManyKeys:   manyKeysJSON(101),
+	}
+
+	for _, path := range []string{"/api/admin/accruals", "/api/admin/invites", "/api/admin/transfers/7/reverse"} {
+		for code, body := range bodies {
+			t.Run(path+" "+code, func(t *testing.T) {
+				mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+				resp := client.WithToken(token).Post(t, path, []byte(body))
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				assert.Contains(t, resp.Body, `"code":"`+code+`"`)
+			})
+		}
+	}
+}
+
+// BenchmarkJSONLimits_Check shows that pathological bodies are rejected in bounded time: deeply nested bodies and
+// bodies of many keys are rejected once the limit is reached, whatever follows, and a long number is read only once.
+func BenchmarkJSONLimits_Check(b *testing.B) {
+	bodies := map[string][]byte{
+		"Flat":                 []byte(`{"toUser": "bob", "amount": 100}`),
+		"Nested 100000":        []byte(nestedJSON(100000)),
+		"Keys 100000":          []byte(manyKeysJSON(100000)),
+		"Number 100000 digits": []byte(`{"amount": ` + strings.Repeat("9", 100000) + `}`),
+	}
+
+	for name, body := range bodies {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				defaultJSONLimits.check(body)
+			}
+		})
+	}
+}
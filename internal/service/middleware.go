@@ -0,0 +1,239 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// shutdownMiddleware rejects requests arriving once the service has begun shutting down (see Service.BeginShutdown)
+// with 503, asking the client to retry, ideally on another instance, over a new connection.
+func (service *Service) shutdownMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		if service.shuttingDown.Load() {
+			res.Header().Set("Connection", "close")
+			res.Header().Set("Retry-After", shutdownRetryAfter)
+			writeErrorCodeResponse(res, req, "server is shutting down, try again later", models.ErrCodeShuttingDown, http.StatusServiceUnavailable)
+			return
+		}
+
+		h.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// serverTimeMiddleware reports the current time of the app on every response in serverTimeHeader.
+func (service *Service) serverTimeMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set(serverTimeHeader, service.app.Now().Format(time.RFC3339Nano))
+		h.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// activeUserMiddleware rejects requests whose token belongs to a user that has been deleted or deactivated, and
+// requests with a stale token, issued before a password change or a forced logout of the user.
+// It must run after auth.CheckJWTMiddleware. When user validation is disabled in the app it passes every request through.
+func (handlers *handlers) activeUserMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requestUserID(res, req)
+		if !ok {
+			return
+		}
+
+		if err := handlers.app.ValidateUser(req.Context(), userID); err != nil {
+			if errors.Is(err, app.ErrAccountInactive) {
+				writeErrorCodeResponse(res, req, "account no longer active", models.ErrCodeAccountInactive, http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, app.ErrTokenStale) {
+				writeErrorCodeResponse(res, req, "token is no longer valid; sign in again", models.ErrCodeTokenStale, http.StatusUnauthorized)
+				return
+			}
+
+			writeInternalErrorResponse(res, req, err)
+			return
+		}
+
+		h.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// sessionMiddleware rejects requests whose token belongs to a revoked session, including sessions
+// revoked because the user exceeded the session limit. It must run after auth.CheckJWTMiddleware.
+// When session tracking is disabled in the app it passes every request through, and so it does for requests
+// authenticated with a personal access token, which is not a session and is revoked on its own.
+// An impersonation token belongs to the session of the administrator it was issued to.
+func (handlers *handlers) sessionMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requestUserID(res, req)
+		if !ok {
+			return
+		}
+
+		if _, personal := auth.RequestScopes(req.Context()); personal {
+			h.ServeHTTP(res, req)
+			return
+		}
+		if impersonator, ok := auth.RequestImpersonator(req.Context()); ok {
+			userID = impersonator
+		}
+
+		if err := handlers.app.ValidateSession(req.Context(), userID, requestTokenID(req)); err != nil {
+			if errors.Is(err, app.ErrSessionRevoked) {
+				writeErrorCodeResponse(res, req, "session revoked", models.ErrCodeSessionRevoked, http.StatusUnauthorized)
+				return
+			}
+
+			writeInternalErrorResponse(res, req, err)
+			return
+		}
+
+		h.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// activityMiddleware records the request, once served, as API activity of the authenticated user: the method and
+// route pattern, the path, the status, and the address of the client connection. It must run after
+// auth.CheckJWTMiddleware. When activity recording is disabled in the app nothing is recorded.
+func (handlers *handlers) activityMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requestUserID(res, req)
+		if !ok {
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(res, req.ProtoMajor)
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			ip, _, err := net.SplitHostPort(req.RemoteAddr)
+			if err != nil {
+				ip = req.RemoteAddr
+			}
+			handlers.app.RecordActivity(models.APIActivity{
+				UserID: userID,
+				Action: req.Method + " " + chi.RouteContext(req.Context()).RoutePattern(),
+				Path:   req.URL.Path,
+				Status: status,
+				IP:     ip,
+			})
+		}()
+		h.ServeHTTP(ww, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// impersonationRoutes are the routes accepting impersonation tokens: those showing the account of the user
+// without changing it. The routes are given as method and route pattern.
+var impersonationRoutes = map[string]bool{
+	"GET /api/info":                true,
+	"GET /api/transfers":           true,
+	"GET /api/transfers/{id}":      true,
+	"GET /api/merch/affordability": true,
+}
+
+// impersonationMiddleware limits requests authenticated with an impersonation token to impersonationRoutes,
+// responding 403 to any other, and only while the impersonating user is still an administrator. Every such
+// request, allowed or not, is logged with both the administrator and the user. Other requests pass through.
+// It must run after auth.CheckJWTMiddleware.
+func (handlers *handlers) impersonationMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		impersonator, ok := auth.RequestImpersonator(req.Context())
+		if !ok {
+			h.ServeHTTP(res, req)
+			return
+		}
+		userID, ok := requestUserID(res, req)
+		if !ok {
+			return
+		}
+
+		route := req.Method + " " + chi.RouteContext(req.Context()).RoutePattern()
+		ww := middleware.NewWrapResponseWriter(res, req.ProtoMajor)
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			handlers.log.Info("impersonated request",
+				zap.Int32("impersonator", impersonator),
+				zap.Int32("userID", userID),
+				zap.String("route", route),
+				zap.String("path", req.URL.Path),
+				zap.Int("status", status),
+			)
+		}()
+
+		if !impersonationRoutes[route] {
+			writeErrorCodeResponse(ww, req, "impersonation tokens are read-only", models.ErrCodeImpersonationReadOnly, http.StatusForbidden)
+			return
+		}
+		admin, err := handlers.app.IsAdmin(req.Context(), impersonator)
+		if err != nil {
+			writeInternalErrorResponse(ww, req, err)
+			return
+		}
+		if !admin {
+			writeErrorCodeResponse(ww, req, "administrator rights required", models.ErrCodeAdminRequired, http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(ww, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// scopeMiddleware allows requests authenticated with a personal access token only when the token has the scope,
+// responding 403 otherwise; no token has the empty scope, which thus rejects every personal access token. Requests authenticated with
+// a session token are not limited by scopes. It must run after auth.CheckTokenMiddleware.
+func scopeMiddleware(scope string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		fn := func(res http.ResponseWriter, req *http.Request) {
+			if !auth.HasScope(req.Context(), scope) {
+				writeErrorCodeResponse(res, req, "token scope does not allow this request", models.ErrCodeScopeRequired, http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(res, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// adminOnlyMiddleware allows the request only when the authenticated user has administrator rights,
+// responding 403 otherwise. It must run after auth.CheckJWTMiddleware.
+func (handlers *handlers) adminOnlyMiddleware(h http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requestUserID(res, req)
+		if !ok {
+			return
+		}
+
+		admin, err := handlers.app.IsAdmin(req.Context(), userID)
+		if err != nil {
+			writeInternalErrorResponse(res, req, err)
+			return
+		}
+		if !admin {
+			writeErrorCodeResponse(res, req, "administrator rights required", models.ErrCodeAdminRequired, http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
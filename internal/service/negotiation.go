@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/apiversion"
+	"merch_store/internal/pkg/auth"
+)
+
+// requestAPIVersion returns the API version negotiated for the request by apiversion.Middleware.
+func requestAPIVersion(req *http.Request) apiversion.Version {
+	return apiversion.FromContext(req.Context())
+}
+
+// writeJSONResponse writes body as JSON with the status code, labeled with the media type of the API version
+// negotiated for the request. It is used for responses whose shape depends on the version.
+func writeJSONResponse(res http.ResponseWriter, req *http.Request, statusCode int, body any) {
+	result, err := json.Marshal(body)
+	if err != nil {
+		writeErrorResponse(res, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", requestAPIVersion(req).MediaType())
+	res.WriteHeader(statusCode)
+	res.Write(result)
+}
+
+// authResponse returns the authentication response for the token in the shape of the negotiated API version.
+func authResponse(req *http.Request, token string) (any, error) {
+	if requestAPIVersion(req) == apiversion.V1 {
+		return models.AuthResponse{Token: token}, nil
+	}
+
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return models.AuthResponseV2{Token: token, TokenType: "Bearer", ExpiresAt: claims.ExpiresAt.Time.UTC()}, nil
+}
+
+// purchaseResponse returns the response for a successful purchase in the shape of the negotiated API version.
+func purchaseResponse(req *http.Request, purchase *models.PurchaseResult) any {
+	if requestAPIVersion(req) == apiversion.V1 {
+		return purchase
+	}
+
+	return models.PurchaseResultV2{
+		Purchase:           models.PurchasedItem{Item: purchase.Item, Price: purchase.Price, Quantity: purchase.Quantity},
+		RemainingCoins:     purchase.RemainingCoins,
+		ReceiptNumber:      purchase.ReceiptNumber,
+		DryRun:             purchase.DryRun,
+		OnBehalfOf:         purchase.OnBehalfOf,
+		RemainingAllowance: purchase.RemainingAllowance,
+	}
+}
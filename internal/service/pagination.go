@@ -0,0 +1,25 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// parsePageParams reads the limit and cursor query parameters shared by the list endpoints. A missing limit is
+// returned as zero, for the app to apply the default page size of the list, and limits over its maximum are clamped
+// by the app. A limit that is not a positive integer is answered with 400, in which case ok is false. The cursor is
+// opaque here; the app verifies it was issued to the user for the same list.
+func parsePageParams(res http.ResponseWriter, req *http.Request) (limit int, cursor string, ok bool) {
+	query := req.URL.Query()
+
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 {
+			writeErrorResponse(res, req, "invalid limit", http.StatusBadRequest)
+			return 0, "", false
+		}
+		limit = parsed
+	}
+
+	return limit, query.Get("cursor"), true
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePageParams(t *testing.T) {
+	testCases := []struct {
+		name       string
+		query      string
+		wantLimit  int
+		wantCursor string
+		wantOK     bool
+	}{
+		{name: "Missing", query: "", wantLimit: 0, wantOK: true},
+		{name: "Limit and cursor", query: "?limit=10&cursor=abc.def", wantLimit: 10, wantCursor: "abc.def", wantOK: true},
+		{name: "Over the maximum", query: "?limit=100000", wantLimit: 100000, wantOK: true},
+		{name: "Zero", query: "?limit=0"},
+		{name: "Negative", query: "?limit=-1"},
+		{name: "Not numeric", query: "?limit=abc"},
+		{name: "Fractional", query: "?limit=1.5"},
+		{name: "Overflowing", query: "?limit=99999999999999999999"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			limit, cursor, ok := parsePageParams(res, httptest.NewRequest(http.MethodGet, "/api/transfers"+tc.query, nil))
+
+			assert.Equal(t, tc.wantOK, ok)
+			if !tc.wantOK {
+				assert.Equal(t, http.StatusBadRequest, res.Code)
+				assert.Equal(t, "{\"errors\":\"invalid limit\"}\n", res.Body.String())
+				return
+			}
+			assert.Equal(t, tc.wantLimit, limit, "clamping is left to the app, which knows the maximum of the list")
+			assert.Equal(t, tc.wantCursor, cursor)
+		})
+	}
+}
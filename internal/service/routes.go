@@ -0,0 +1,159 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/featureflag"
+)
+
+// routeAccess classifies the authentication a route requires.
+type routeAccess int
+
+const (
+	accessPublic routeAccess = iota // Served without a token.
+	accessUser                      // Requires a session token or, where its scope allows, a personal access token.
+	accessAdmin                     // Requires a session token of an administrator.
+)
+
+// routeAccessTable classifies every route registered by NewRouter by method and chi pattern, for the listing of
+// /api/routes; routes registered for every method with Handle are classified under the method "*".
+// It is maintained next to NewRouter: TestRouteAccessTable fails for a route missing from it.
+var routeAccessTable = map[string]routeAccess{
+	"GET /metrics": accessPublic,
+	"GET /ui":      accessPublic,
+	"* /ui/*":      accessPublic,
+
+	"POST /api/auth": accessPublic,
+	"GET /api/merch": accessPublic,
+	"GET /api/tos":   accessPublic,
+
+	"GET /api/info":                       accessUser,
+	"POST /api/sendCoin":                  accessUser,
+	"POST /api/sendCoin/confirm":          accessUser,
+	"GET /api/sendCoin/preview":           accessUser,
+	"GET /api/auth/sessions":              accessUser,
+	"DELETE /api/auth/sessions/{jti}":     accessUser,
+	"POST /api/auth/tokens":               accessUser,
+	"GET /api/auth/tokens":                accessUser,
+	"DELETE /api/auth/tokens/{id}":        accessUser,
+	"POST /api/delegations":               accessUser,
+	"GET /api/delegations":                accessUser,
+	"DELETE /api/delegations/{id}":        accessUser,
+	"GET /api/account/export":             accessUser,
+	"GET /api/account/activity":           accessUser,
+	"POST /api/tos/accept":                accessUser,
+	"GET /api/merch/affordability":        accessUser,
+	"GET /api/receipts/{number}":          accessUser,
+	"GET /api/history":                    accessUser,
+	"GET /api/events":                     accessUser,
+	"GET /api/transfers":                  accessUser,
+	"GET /api/transfers/{id}":             accessUser,
+	"POST /api/sendCoin/schedule":         accessUser,
+	"GET /api/sendCoin/scheduled":         accessUser,
+	"DELETE /api/sendCoin/scheduled/{id}": accessUser,
+	"GET /api/buy/{item}":                 accessUser,
+	"GET /api/buy/id/{merchID}":           accessUser,
+	"POST /api/buy/id/{merchID}":          accessUser,
+	"GET /api/buy/status/{token}":         accessUser,
+	"POST /api/buy/{item}/gift":           accessUser,
+	"POST /api/inventory/{item}/consume":  accessUser,
+	"GET /api/notifications":              accessUser,
+	"POST /api/notifications/{id}/read":   accessUser,
+	"POST /api/notifications/readAll":     accessUser,
+	"GET /api/notifications/preferences":  accessUser,
+	"PUT /api/notifications/preferences":  accessUser,
+
+	"GET /api/routes":                          accessAdmin,
+	"POST /api/admin/accruals":                 accessAdmin,
+	"POST /api/admin/invites":                  accessAdmin,
+	"POST /api/admin/users/bulk":               accessAdmin,
+	"POST /api/admin/impersonate/{userID}":     accessAdmin,
+	"POST /api/admin/users/{userID}/logout":    accessAdmin,
+	"POST /api/admin/transfers/{id}/reverse":   accessAdmin,
+	"GET /api/admin/stats/failed-purchases":    accessAdmin,
+	"GET /api/admin/economy":                   accessAdmin,
+	"POST /api/admin/inventory/reconcile":      accessAdmin,
+	"GET /api/admin/invariants":                accessAdmin,
+	"POST /api/admin/receipts/{number}/redeem": accessAdmin,
+	"GET /api/admin/flags":                     accessAdmin,
+	"GET /api/admin/config":                    accessAdmin,
+	"POST /api/admin/campaigns":                accessAdmin,
+	"GET /api/admin/campaigns":                 accessAdmin,
+	"GET /api/admin/campaigns/{id}":            accessAdmin,
+	"PUT /api/admin/campaigns/{id}":            accessAdmin,
+	"DELETE /api/admin/campaigns/{id}":         accessAdmin,
+	"POST /api/admin/promotions":               accessAdmin,
+	"GET /api/admin/promotions":                accessAdmin,
+	"GET /api/admin/promotions/{id}":           accessAdmin,
+	"PUT /api/admin/promotions/{id}":           accessAdmin,
+	"DELETE /api/admin/promotions/{id}":        accessAdmin,
+	"PUT /api/admin/merch/{item}/category":     accessAdmin,
+}
+
+// listRoutes returns the routes of router sorted by pattern and method, with their authentication requirements
+// taken from routeAccessTable. A route missing from the table is listed as requiring administrator rights, so that
+// tooling never calls it unauthenticated.
+func listRoutes(router chi.Routes) ([]models.Route, error) {
+	routes := []models.Route{}
+	err := chi.Walk(router, func(method string, pattern string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		access, ok := lookupRouteAccess(method, pattern)
+		if !ok {
+			access = accessAdmin
+		}
+		routes = append(routes, models.Route{
+			Method:        method,
+			Pattern:       pattern,
+			JWTRequired:   access != accessPublic,
+			AdminRequired: access == accessAdmin,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes, nil
+}
+
+// lookupRouteAccess returns the classification of the route in routeAccessTable, if any.
+func lookupRouteAccess(method, pattern string) (routeAccess, bool) {
+	if access, ok := routeAccessTable[method+" "+pattern]; ok {
+		return access, true
+	}
+	access, ok := routeAccessTable["* "+pattern]
+	return access, ok
+}
+
+// routesHandler lists the routes of router with their authentication requirements for tooling. The listing is
+// served without authentication while the featureflag.PublicRoutes flag is on, and through admin, the middleware
+// of the admin routes, otherwise.
+func (service *Service) routesHandler(router chi.Routes, admin func(http.Handler) http.Handler) http.HandlerFunc {
+	listing := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		routes, err := listRoutes(router)
+		if err != nil {
+			writeInternalErrorResponse(res, req, err)
+			return
+		}
+
+		writeJSONResponse(res, req, http.StatusOK, models.RoutesResponse{Routes: routes})
+	})
+	protected := admin(listing)
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		if service.app.IsFeatureEnabled(req.Context(), featureflag.PublicRoutes) {
+			listing.ServeHTTP(res, req)
+			return
+		}
+		protected.ServeHTTP(res, req)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/app"
+	"merch_store/internal/config"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/featureflag"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/service/servicetest"
+	"merch_store/internal/storage/mocks"
+)
+
+// newRoutesService returns a Service registering every optional route, with the feature flags read from the
+// environment.
+func newRoutesService(t *testing.T, mockDB *mocks.MockStorage) *Service {
+	l := &logger.Logger{Logger: zap.NewNop()}
+	flags := featureflag.New("", time.Minute, l)
+	require.NoError(t, flags.Reload())
+
+	appInstance := app.NewApp(mockDB, l)
+	appInstance.SetFeatureFlags(flags)
+	service := NewService(appInstance, config.ServerRunAddress, l)
+	service.SetWebUI(http.NotFoundHandler())
+	return service
+}
+
+func TestRouteAccessTable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	routes, err := listRoutes(newRoutesService(t, mocks.NewMockStorage(ctrl)).NewRouter())
+	require.NoError(t, err)
+
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		_, ok := lookupRouteAccess(route.Method, route.Pattern)
+		assert.True(t, ok, "route %s %s must be classified in routeAccessTable", route.Method, route.Pattern)
+		registered[route.Method+" "+route.Pattern] = true
+		registered["* "+route.Pattern] = true
+	}
+	for key := range routeAccessTable {
+		assert.True(t, registered[key], "routeAccessTable classifies %s, which is not registered", key)
+	}
+}
+
+func TestRouteAccessFlags_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	mockDB.EXPECT().GetCatalogLastModified(gomock.Any()).Return(time.Now(), nil).AnyTimes()
+	mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return([]models.CatalogItem{}, nil).AnyTimes()
+	mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil).AnyTimes()
+
+	router := newRoutesService(t, mockDB).NewRouter()
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+	anonymous := servicetest.NewClient(testServer)
+	user := anonymous.WithUser(t, 1)
+
+	routes, err := listRoutes(router)
+	require.NoError(t, err)
+	for _, route := range routes {
+		method := route.Method
+		if method == http.MethodConnect || method == http.MethodTrace {
+			continue
+		}
+		path := strings.NewReplacer("{", "", "}", "", "*", "index.html").Replace(route.Pattern)
+
+		t.Run(method+" "+route.Pattern, func(t *testing.T) {
+			resp := anonymous.Do(t, method, path, nil)
+			if route.JWTRequired {
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "the route must require a token")
+			} else {
+				assert.NotEqual(t, http.StatusUnauthorized, resp.StatusCode, "the route must not require a token")
+			}
+
+			if route.AdminRequired {
+				resp = user.Do(t, method, path, nil)
+				resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+			}
+		})
+	}
+}
+
+func TestRoutesHandler_Gomock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockStorage(ctrl)
+	testServer := httptest.NewServer(newRoutesService(t, mockDB).NewRouter())
+	defer testServer.Close()
+	client := servicetest.NewClient(testServer)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		resp := client.Get(t, "/api/routes")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Forbidden for non-admins", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(false, nil)
+
+		resp := client.WithUser(t, 1).Get(t, "/api/routes")
+		resp.AssertErrorCode(t, http.StatusForbidden, models.ErrCodeAdminRequired, "administrator rights required")
+	})
+
+	t.Run("Admins list the routes", func(t *testing.T) {
+		mockDB.EXPECT().IsUserAdmin(gomock.Any(), int32(1)).Return(true, nil)
+
+		resp := client.WithUser(t, 1).Get(t, "/api/routes")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var listing models.RoutesResponse
+		resp.Decode(t, &listing)
+		assert.Contains(t, listing.Routes, models.Route{Method: http.MethodGet, Pattern: "/api/merch"})
+		assert.Contains(t, listing.Routes, models.Route{Method: http.MethodGet, Pattern: "/api/info", JWTRequired: true})
+		assert.Contains(t, listing.Routes, models.Route{Method: http.MethodPost, Pattern: "/api/admin/campaigns", JWTRequired: true, AdminRequired: true})
+	})
+
+	t.Run("Public behind the flag", func(t *testing.T) {
+		t.Setenv(featureflag.EnvPrefix+"PUBLIC_ROUTES", "true")
+		testServer := httptest.NewServer(newRoutesService(t, mockDB).NewRouter())
+		defer testServer.Close()
+
+		resp := servicetest.NewClient(testServer).Get(t, "/api/routes")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var listing models.RoutesResponse
+		resp.Decode(t, &listing)
+		assert.Contains(t, listing.Routes, models.Route{Method: http.MethodGet, Pattern: "/api/routes", JWTRequired: true, AdminRequired: true},
+			"the classification of the listing does not depend on the flag")
+	})
+}
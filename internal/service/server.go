@@ -1,11 +1,26 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
 	"merch_store/internal/app"
+	"merch_store/internal/config"
+	"merch_store/internal/pkg/apiversion"
 	"merch_store/internal/pkg/auth"
 	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/metrics"
+	"merch_store/internal/pkg/ratelimit"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 // Service encapsulates the HTTP server configuration, including the application's business logic,
@@ -15,6 +30,12 @@ type Service struct {
 	app        *app.App
 	runAddress string
 	log        *logger.Logger
+
+	adminVerifier *auth.RequestVerifier
+	authLimiter   *ratelimit.IPLimiter
+	webUI         http.Handler
+
+	shuttingDown atomic.Bool // Set by BeginShutdown; new requests are then turned away.
 }
 
 // NewService creates and initializes a new Service instance.
@@ -25,17 +46,264 @@ func NewService(app *app.App, runAddress string, l *logger.Logger) *Service {
 	return &Service{handlers: handlers, app: app, runAddress: runAddress, log: l}
 }
 
-// NewRouter sets up and returns a new chi.Router instance with the necessary middleware and routes.
-// It applies logging middleware globally, and JWT authentication middleware for protected routes.
+// SetAdminRequestVerifier requires requests to the admin API to be signed, in addition to the
+// administrator role, with signatures checked by verifier.
+func (service *Service) SetAdminRequestVerifier(verifier *auth.RequestVerifier) {
+	service.adminVerifier = verifier
+}
+
+// SetAuthRateLimiter throttles the unauthenticated authentication routes per client IP address with limiter.
+// Authenticated routes are not affected.
+func (service *Service) SetAuthRateLimiter(limiter *ratelimit.IPLimiter) {
+	service.authLimiter = limiter
+}
+
+// SetTrustedProxies attributes the requests coming from trustedProxies to the client named in X-Forwarded-For when
+// recording the client address of registrations (see app.App.SetRegistrationCooldown).
+func (service *Service) SetTrustedProxies(trustedProxies []*net.IPNet) {
+	service.handlers.trustedProxies = trustedProxies
+}
+
+// WebUIPath is the path the manual testing frontend is served at.
+const WebUIPath = "/ui"
+
+// SetWebUI serves the manual testing frontend (see webui.Handler) at WebUIPath. The frontend only calls the public API,
+// so it is served without authentication. A nil handler, as returned in builds with the noui tag, leaves it out.
+func (service *Service) SetWebUI(handler http.Handler) {
+	service.webUI = handler
+}
+
+// BeginShutdown marks the service as shutting down: from then on new requests, including those arriving on kept-alive
+// connections, get 503 with Connection: close and a Retry-After hint instead of reaching the handlers, while requests
+// already in flight finish normally. It is called before the server and the storage are shut down, and is safe to
+// call more than once and concurrently with requests.
+func (service *Service) BeginShutdown() {
+	if !service.shuttingDown.Swap(true) {
+		service.log.Info("Shutting down, new requests are rejected")
+	}
+}
+
+// NewRouter builds the chi.Router serving the service. Every request first passes the global middleware, which
+// assigns a request ID (taken from X-Request-Id when the client sends one) that storage errors are logged with, logs
+// the request, adds the server time (see serverTimeHeader), and rejects new requests once BeginShutdown is called.
+// Application metrics are served on /metrics in the Prometheus text format, and the frontend set by SetWebUI on
+// WebUIPath.
+//
+// Routes requiring a token share the authenticated chain: token authentication, then the active user, session,
+// impersonation, and activity recording checks. Personal access tokens are accepted only by the routes of their
+// scopes. Admin routes add the admin chain on top of it: the request signature check when an admin request verifier
+// is set, then the admin role check.
+//
+// The API lives in the /api subrouter, which negotiates the version of the response shapes from the Accept header
+// (see apiversion.Middleware) and answers unknown paths with a JSON 404; other paths keep the router's default
+// responses. Its authentication route is throttled per client IP when an auth rate limiter is set. The routes are
+// listed with their authentication requirements on /api/routes (see routesHandler), so a route added here must also
+// be classified in routeAccessTable.
 func (service *Service) NewRouter() chi.Router {
+	// Middleware of the routes requiring a token, and of the admin routes on top of it.
+	authenticated := chi.Middlewares{
+		auth.CheckTokenMiddleware(service.app),
+		service.handlers.activeUserMiddleware,
+		service.handlers.sessionMiddleware,
+		service.handlers.impersonationMiddleware,
+		service.handlers.activityMiddleware,
+	}
+	var admin chi.Middlewares
+	if service.adminVerifier != nil {
+		admin = append(admin, service.adminVerifier.Middleware())
+	}
+	admin = append(admin, service.handlers.adminOnlyMiddleware)
+
 	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
 	router.Use(service.log.WithLogging())
-	router.Post("/api/auth", service.handlers.authHandler)
-	router.Route("/", func(r chi.Router) {
-		r.Use(auth.CheckJWTMiddleware())
-		r.Get("/api/info", service.handlers.infoHandler)
-		r.Post("/api/sendCoin", service.handlers.sendCoinHandler)
-		r.Get("/api/buy/{item}", service.handlers.buyItemHandler)
+	router.Use(service.serverTimeMiddleware)
+	router.Use(service.shutdownMiddleware)
+	router.Method(http.MethodGet, "/metrics", metrics.Default.Handler())
+	if service.webUI != nil {
+		router.Get(WebUIPath, http.RedirectHandler(WebUIPath+"/", http.StatusMovedPermanently).ServeHTTP)
+		router.Handle(WebUIPath+"/*", http.StripPrefix(WebUIPath, service.webUI))
+	}
+	router.Route("/api", func(r chi.Router) {
+		r.Use(apiversion.Middleware)
+		r.NotFound(service.handlers.notFoundHandler)
+		r.Group(func(r chi.Router) {
+			// Authentication routes are called before the client is known, so they are throttled per client IP.
+			if service.authLimiter != nil {
+				r.Use(service.authLimiter.Middleware())
+			}
+			r.Post("/auth", service.handlers.authHandler)
+		})
+		r.Get("/merch", service.handlers.catalogHandler)
+		r.Get("/tos", service.handlers.termsHandler)
+		// Unless it is public, the listing of the routes is protected like the admin routes.
+		var routesMiddleware chi.Middlewares
+		routesMiddleware = append(routesMiddleware, authenticated...)
+		routesMiddleware = append(routesMiddleware, scopeMiddleware(""))
+		routesMiddleware = append(routesMiddleware, admin...)
+		r.Get("/routes", service.routesHandler(router, routesMiddleware.Handler))
+		r.Group(func(r chi.Router) {
+			r.Use(authenticated...)
+			r.With(scopeMiddleware(auth.ScopeInfo)).Get("/info", service.handlers.infoHandler)
+			r.With(scopeMiddleware(auth.ScopeSendCoin), service.handlers.idempotencyMiddleware).Post("/sendCoin", service.handlers.sendCoinHandler)
+			r.With(scopeMiddleware(auth.ScopeSendCoin)).Post("/sendCoin/confirm", service.handlers.confirmTransferHandler)
+			r.With(scopeMiddleware(auth.ScopeSendCoin)).Get("/sendCoin/preview", service.handlers.previewTransferHandler)
+
+			// The remaining routes accept session tokens only.
+			r.Group(func(r chi.Router) {
+				r.Use(scopeMiddleware(""))
+				r.Get("/auth/sessions", service.handlers.sessionsHandler)
+				r.Delete("/auth/sessions/{jti}", service.handlers.revokeSessionHandler)
+				r.Post("/auth/tokens", service.handlers.createPersonalTokenHandler)
+				r.Get("/auth/tokens", service.handlers.personalTokensHandler)
+				r.Delete("/auth/tokens/{id}", service.handlers.revokePersonalTokenHandler)
+				r.Post("/delegations", service.handlers.createDelegationHandler)
+				r.Get("/delegations", service.handlers.delegationsHandler)
+				r.Delete("/delegations/{id}", service.handlers.revokeDelegationHandler)
+				r.Get("/account/export", service.handlers.accountExportHandler)
+				r.Get("/account/activity", service.handlers.userActivityHandler)
+				r.Post("/tos/accept", service.handlers.acceptTermsHandler)
+				r.Get("/merch/affordability", service.handlers.catalogAffordabilityHandler)
+				r.Get("/receipts/{number}", service.handlers.receiptHandler)
+				r.Get("/history", service.handlers.historyHandler)
+				r.Get("/events", service.handlers.eventsHandler)
+				r.Get("/transfers", service.handlers.transfersHandler)
+				r.Get("/transfers/{id}", service.handlers.transferHandler)
+				r.Post("/sendCoin/schedule", service.handlers.scheduleTransferHandler)
+				r.Get("/sendCoin/scheduled", service.handlers.scheduledTransfersHandler)
+				r.Delete("/sendCoin/scheduled/{id}", service.handlers.cancelScheduledTransferHandler)
+				r.With(service.handlers.idempotencyMiddleware).Get("/buy/{item}", service.handlers.buyItemHandler)
+				r.With(service.handlers.idempotencyMiddleware).Get("/buy/id/{merchID}", service.handlers.buyItemByIDHandler)
+				r.With(service.handlers.idempotencyMiddleware).Post("/buy/id/{merchID}", service.handlers.buyItemByIDHandler)
+				r.Get("/buy/status/{token}", service.handlers.buyStatusHandler)
+				r.Post("/buy/{item}/gift", service.handlers.giftItemHandler)
+				r.Post("/inventory/{item}/consume", service.handlers.consumeItemHandler)
+				r.Get("/notifications", service.handlers.notificationsHandler)
+				r.Post("/notifications/{id}/read", service.handlers.readNotificationHandler)
+				r.Post("/notifications/readAll", service.handlers.readAllNotificationsHandler)
+				r.Get("/notifications/preferences", service.handlers.notificationPreferencesHandler)
+				r.Put("/notifications/preferences", service.handlers.setNotificationPreferencesHandler)
+
+				r.Route("/admin", func(r chi.Router) {
+					r.Use(admin...)
+					r.Post("/accruals", service.handlers.accrualHandler)
+					r.Post("/invites", service.handlers.inviteHandler)
+					r.Post("/users/bulk", service.handlers.bulkUsersHandler)
+					r.Post("/impersonate/{userID}", service.handlers.impersonateHandler)
+					r.Post("/users/{userID}/logout", service.handlers.forceLogoutHandler)
+					r.Post("/transfers/{id}/reverse", service.handlers.reverseTransferHandler)
+					r.Get("/stats/failed-purchases", service.handlers.failedPurchaseStatsHandler)
+					r.Get("/economy", service.handlers.economyHandler)
+					r.Post("/inventory/reconcile", service.handlers.inventoryReconcileHandler)
+					r.Get("/invariants", service.handlers.invariantsHandler)
+					r.Post("/receipts/{number}/redeem", service.handlers.redeemReceiptHandler)
+					r.Get("/flags", service.handlers.featureFlagsHandler)
+					r.Get("/config", service.handlers.configHandler)
+					r.Post("/campaigns", service.handlers.createCampaignHandler)
+					r.Get("/campaigns", service.handlers.campaignsHandler)
+					r.Get("/campaigns/{id}", service.handlers.campaignHandler)
+					r.Put("/campaigns/{id}", service.handlers.updateCampaignHandler)
+					r.Delete("/campaigns/{id}", service.handlers.deleteCampaignHandler)
+					r.Post("/promotions", service.handlers.createPromotionHandler)
+					r.Get("/promotions", service.handlers.promotionsHandler)
+					r.Get("/promotions/{id}", service.handlers.promotionHandler)
+					r.Put("/promotions/{id}", service.handlers.updatePromotionHandler)
+					r.Delete("/promotions/{id}", service.handlers.deletePromotionHandler)
+					r.Put("/merch/{item}/category", service.handlers.setMerchCategoryHandler)
+				})
+			})
+		})
 	})
 	return router
 }
+
+// DefaultSocketMode is the permission of a unix socket the server listens on: the owner and the group,
+// typically shared with the local proxy, may connect.
+const DefaultSocketMode fs.FileMode = 0o660
+
+// ServerConfig holds the settings of the HTTP server started by ListenAndServe.
+// Zero durations disable the corresponding timeout, and a zero SocketMode stands for DefaultSocketMode.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration
+	ShutdownTimeout   time.Duration
+	SocketMode        fs.FileMode
+}
+
+// ListenAndServe serves the router on the service's run address until ctx is canceled, then shuts the server down
+// gracefully, waiting up to cfg.ShutdownTimeout for active requests. The address is either host:port or
+// unix: followed by a socket path (see config.ParseRunAddress). A stale socket file left by a previous run is removed
+// before listening, the socket gets cfg.SocketMode permissions, and it is removed again on shutdown.
+// It implements the body of a worker.Func.
+func (service *Service) ListenAndServe(ctx context.Context, cfg ServerConfig) error {
+	listener, err := listen(service.runAddress, cfg.SocketMode)
+	if err != nil {
+		return err
+	}
+	return service.serve(ctx, listener, cfg)
+}
+
+// serve serves the router on listener until ctx is canceled, then shuts the server down gracefully.
+// The listener is closed when serve returns.
+func (service *Service) serve(ctx context.Context, listener net.Listener, cfg ServerConfig) error {
+	server := &http.Server{Handler: service.NewRouter(), ReadHeaderTimeout: cfg.ReadHeaderTimeout}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+	service.log.Sugar().Infof("Listening on %s %s", listener.Addr().Network(), listener.Addr())
+
+	select {
+	case err := <-serverErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		service.BeginShutdown()
+		shutdownCtx := context.Background()
+		if cfg.ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			shutdownCtx, cancel = context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout)
+			defer cancel()
+		}
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// listen opens a listener on a run address. For a unix socket it removes a stale socket file at the path,
+// refusing to remove anything else, and sets the socket permissions to mode.
+func listen(address string, mode fs.FileMode) (net.Listener, error) {
+	network, listenAddress, err := config.ParseRunAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if network != "unix" {
+		return net.Listen(network, listenAddress)
+	}
+
+	if info, err := os.Lstat(listenAddress); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("service: %s exists and is not a socket", listenAddress)
+		}
+		if err = os.Remove(listenAddress); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen(network, listenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if err = os.Chmod(listenAddress, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage/mocks"
+)
+
+// newCatalogService returns a Service on runAddress whose storage serves a one-item catalog.
+func newCatalogService(t *testing.T, runAddress string) *Service {
+	ctrl := gomock.NewController(t)
+	mockDB := mocks.NewMockStorage(ctrl)
+	mockDB.EXPECT().GetCatalogLastModified(gomock.Any()).Return(time.Now(), nil).AnyTimes()
+	mockDB.EXPECT().GetMerchCatalog(gomock.Any()).Return([]models.CatalogItem{{Name: "cup", Price: 20}}, nil).AnyTimes()
+
+	l := &logger.Logger{Logger: zap.NewNop()}
+	return NewService(app.NewApp(mockDB, l), runAddress, l)
+}
+
+// startServing runs serveFn in the background and returns a function that stops it and returns its error.
+func startServing(t *testing.T, serveFn func(ctx context.Context) error) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveFn(ctx)
+	}()
+
+	return func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("server did not shut down")
+			return nil
+		}
+	}
+}
+
+// getCatalog requests the catalog with client and returns the response body.
+func getCatalog(t *testing.T, client *http.Client, url string) string {
+	resp, err := client.Get(url + "/api/merch")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	return string(body)
+}
+
+func TestListenAndServe_TCP(t *testing.T) {
+	service := newCatalogService(t, "127.0.0.1:0")
+	listener, err := listen(service.runAddress, 0)
+	require.NoError(t, err)
+	address := listener.Addr().String()
+
+	stop := startServing(t, func(ctx context.Context) error {
+		return service.serve(ctx, listener, ServerConfig{ShutdownTimeout: time.Second})
+	})
+
+	assert.Equal(t, `[{"name":"cup","price":20}]`, getCatalog(t, http.DefaultClient, "http://"+address))
+	require.NoError(t, stop(), "a graceful shutdown must not be reported as an error")
+
+	_, err = net.DialTimeout("tcp", address, time.Second)
+	assert.Error(t, err, "the listener must be closed on shutdown")
+}
+
+func TestListenAndServe_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+
+	// A socket file left by a crashed run must not prevent listening.
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	service := newCatalogService(t, "unix:"+path)
+	stop := startServing(t, func(ctx context.Context) error {
+		return service.ListenAndServe(ctx, ServerConfig{ShutdownTimeout: time.Second, SocketMode: 0o600})
+	})
+
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Mode().Perm() == 0o600
+	}, 5*time.Second, 10*time.Millisecond, "the socket must be created with the configured permissions")
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	assert.Equal(t, `[{"name":"cup","price":20}]`, getCatalog(t, client, "http://unix"))
+	client.CloseIdleConnections()
+
+	require.NoError(t, stop())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "the socket file must be removed on shutdown")
+}
+
+func TestListen_RefusesToReplaceRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+	_, err := listen("unix:"+path, 0)
+	assert.Error(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data), "a file that is not a socket must be left alone")
+}
+
+func TestListen_InvalidAddress(t *testing.T) {
+	for _, address := range []string{"unix:", "localhost", "localhost:http", ":70000"} {
+		_, err := listen(address, 0)
+		assert.Error(t, err, address)
+	}
+}
+
+func TestServe_RejectsRequestsAfterBeginShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ctrl := gomock.NewController(t)
+	mockDB := mocks.NewMockStorage(ctrl)
+	mockDB.EXPECT().GetCatalogLastModified(gomock.Any()).Return(time.Now(), nil).AnyTimes()
+	mockDB.EXPECT().GetMerchCatalog(gomock.Any()).DoAndReturn(func(ctx context.Context) ([]models.CatalogItem, error) {
+		close(started)
+		<-release
+		return []models.CatalogItem{{Name: "cup", Price: 20}}, nil
+	})
+
+	l := &logger.Logger{Logger: zap.NewNop()}
+	service := NewService(app.NewApp(mockDB, l), "127.0.0.1:0", l)
+	listener, err := listen(service.runAddress, 0)
+	require.NoError(t, err)
+	url := "http://" + listener.Addr().String()
+	stop := startServing(t, func(ctx context.Context) error {
+		return service.serve(ctx, listener, ServerConfig{ShutdownTimeout: 5 * time.Second})
+	})
+
+	slow := make(chan string, 1)
+	go func() {
+		slow <- getCatalog(t, http.DefaultClient, url)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow request did not reach the storage")
+	}
+
+	service.BeginShutdown()
+	resp, err := http.Get(url + "/api/merch")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.True(t, resp.Close, "the connection must be closed after the response")
+	assert.Equal(t, shutdownRetryAfter, resp.Header.Get("Retry-After"))
+	assert.JSONEq(t, `{"errors":"server is shutting down, try again later","code":"SHUTTING_DOWN"}`, string(body))
+
+	close(release)
+	select {
+	case body := <-slow:
+		assert.Equal(t, `[{"name":"cup","price":20}]`, body, "a request in flight must finish normally")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow request did not finish")
+	}
+	require.NoError(t, stop())
+}
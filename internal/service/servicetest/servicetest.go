@@ -0,0 +1,170 @@
+// Package servicetest provides a client for tests of the HTTP API of the service. It sends requests to an
+// httptest.Server, reads the responses in full, and offers helpers for authentication and the JSON error shape,
+// so that handler and integration tests do not need to assemble requests by hand.
+package servicetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+)
+
+// Client sends requests to the API under test. Its With methods return modified copies, so a client configured
+// once can be shared by subtests. Requests take the testing.TB of the (sub)test they are made in.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	header  http.Header
+}
+
+// NewClient creates a Client sending unauthenticated requests to server.
+func NewClient(server *httptest.Server) *Client {
+	return &Client{baseURL: server.URL, http: server.Client(), header: http.Header{}}
+}
+
+// WithHeader returns a copy of the client sending the header with every request.
+func (client *Client) WithHeader(key, value string) *Client {
+	clone := *client
+	clone.header = client.header.Clone()
+	clone.header.Set(key, value)
+	return &clone
+}
+
+// WithToken returns a copy of the client authenticating with the bearer token. An empty token
+// makes the copy send requests without authentication.
+func (client *Client) WithToken(token string) *Client {
+	if token == "" {
+		clone := *client
+		clone.header = client.header.Clone()
+		clone.header.Del("Authorization")
+		return &clone
+	}
+	return client.WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithUser returns a copy of the client authenticating as the user with a freshly minted session token.
+func (client *Client) WithUser(t testing.TB, userID int32) *Client {
+	return client.WithToken(Token(t, userID))
+}
+
+// Login authenticates through /api/auth with the username and password and returns a copy of the client
+// using the issued token. It fails the test unless authentication succeeds.
+func (client *Client) Login(t testing.TB, username, password string) *Client {
+	t.Helper()
+
+	resp := client.PostJSON(t, "/api/auth", models.AuthRequest{Username: username, Password: password})
+	require.Equal(t, http.StatusOK, resp.StatusCode, "authentication failed: %s", resp.Body)
+
+	var authResponse models.AuthResponse
+	resp.Decode(t, &authResponse)
+	require.NotEmpty(t, authResponse.Token, "authentication must issue a token")
+	return client.WithToken(authResponse.Token)
+}
+
+// Do sends a request with the method, path, and body, which may be nil, and returns the response read in full.
+func (client *Client) Do(t testing.TB, method, path string, body []byte) *Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, client.baseURL+path, bytes.NewReader(body))
+	require.NoError(t, err)
+	for key, values := range client.header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.http.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(responseBody)}
+}
+
+// Get sends a GET request.
+func (client *Client) Get(t testing.TB, path string) *Response {
+	t.Helper()
+	return client.Do(t, http.MethodGet, path, nil)
+}
+
+// Post sends a POST request with the raw body.
+func (client *Client) Post(t testing.TB, path string, body []byte) *Response {
+	t.Helper()
+	return client.Do(t, http.MethodPost, path, body)
+}
+
+// PostJSON sends a POST request with v encoded as JSON.
+func (client *Client) PostJSON(t testing.TB, path string, v any) *Response {
+	t.Helper()
+
+	body, err := json.Marshal(v)
+	require.NoError(t, err)
+	return client.WithHeader("Content-Type", "application/json").Post(t, path, body)
+}
+
+// Delete sends a DELETE request.
+func (client *Client) Delete(t testing.TB, path string) *Response {
+	t.Helper()
+	return client.Do(t, http.MethodDelete, path, nil)
+}
+
+// Response is a response of the API read in full.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// Decode decodes the JSON body into v, failing the test when it cannot.
+func (response *Response) Decode(t testing.TB, v any) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal([]byte(response.Body), v), "body: %s", response.Body)
+}
+
+// Error decodes the body as the error envelope of version 1 of the API.
+func (response *Response) Error(t testing.TB) models.ErrorResponse {
+	t.Helper()
+
+	var errorResponse models.ErrorResponse
+	response.Decode(t, &errorResponse)
+	return errorResponse
+}
+
+// AssertError asserts that the response is a JSON error of version 1 of the API with the status code and message,
+// and without an error code.
+func (response *Response) AssertError(t testing.TB, statusCode int, message string) bool {
+	t.Helper()
+	return response.AssertErrorCode(t, statusCode, "", message)
+}
+
+// AssertErrorCode asserts that the response is a JSON error of version 1 of the API with the status code,
+// the machine-readable error code, and the message. The body must be exactly what the service writes, so
+// that a change of the error shape is caught.
+func (response *Response) AssertErrorCode(t testing.TB, statusCode int, code, message string) bool {
+	t.Helper()
+
+	expected, err := json.Marshal(models.ErrorResponse{Errors: message, Code: code})
+	require.NoError(t, err)
+
+	ok := assert.Equal(t, statusCode, response.StatusCode)
+	ok = assert.Equal(t, "application/json", response.Header.Get("Content-Type")) && ok
+	return assert.Equal(t, string(expected)+"\n", response.Body) && ok
+}
+
+// Token mints a session token for the user, as issued by /api/auth, without going through the database.
+func Token(t testing.TB, userID int32) string {
+	t.Helper()
+
+	token, err := auth.GenerateToken(userID)
+	require.NoError(t, err)
+	return token
+}
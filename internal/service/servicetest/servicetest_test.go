@@ -0,0 +1,39 @@
+package servicetest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") == "" {
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusUnauthorized)
+			_, _ = res.Write([]byte("{\"errors\":\"missing auth header\",\"code\":\"AUTH_HEADER_MISSING\"}\n"))
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		_, _ = res.Write([]byte(req.Method + " " + req.URL.Path + " " + req.Header.Get("Content-Type") + " " + string(body)))
+	}))
+	defer server.Close()
+	client := NewClient(server)
+
+	resp := client.Get(t, "/api/info")
+	resp.AssertErrorCode(t, http.StatusUnauthorized, "AUTH_HEADER_MISSING", "missing auth header")
+
+	authenticated := client.WithToken("token")
+	resp = authenticated.PostJSON(t, "/api/sendCoin", map[string]int{"amount": 1})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `POST /api/sendCoin application/json {"amount":1}`, resp.Body)
+
+	resp = authenticated.Get(t, "/api/info")
+	assert.Equal(t, "GET /api/info  ", resp.Body, "PostJSON must not leak its content type into the client")
+
+	resp = authenticated.WithToken("").Delete(t, "/api/sessions/1")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "an empty token must remove authentication")
+}
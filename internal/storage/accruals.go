@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	claimAccrualQuery        = `INSERT INTO content.coin_accruals (period, amount) VALUES ($1, $2) ON CONFLICT (period) DO NOTHING;`
+	insertAccrualEntryQuery  = `INSERT INTO content.coin_accrual_entries (period, user_id, amount) SELECT $1, id, $2 FROM content.users WHERE is_active;`
+	accrueCoinsQuery         = `UPDATE content.users SET coins = coins + $1, updated_at = NOW() WHERE is_active;`
+	setAccrualUsersQuery     = `UPDATE content.coin_accruals SET users_credited = $1 WHERE period = $2;`
+	getAccrualEntryUserQuery = `SELECT amount FROM content.coin_accrual_entries WHERE period = $1 AND user_id = $2;`
+)
+
+// ErrAccrualAlreadyDone indicates that the coins for the period have already been accrued.
+var ErrAccrualAlreadyDone = errors.New("storage: accrual for the period has already been executed")
+
+// AccrueMonthlyCoins credits amount coins to every active user for the period and returns the number of users credited.
+// The period row in content.coin_accruals acts as a lock: inserting it with ON CONFLICT DO NOTHING lets only one
+// execution per period proceed, even across replicas, and a ledger entry is written for every credited user.
+// It returns ErrAccrualAlreadyDone when the period has already been accrued.
+func (postgresql *PostgreSQL) AccrueMonthlyCoins(ctx context.Context, period time.Time, amount int) (int, error) {
+	tx, err := postgresql.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, claimAccrualQuery, period, amount)
+	if err != nil {
+		postgresql.logQueryError(ctx, "AccrueMonthlyCoins", err, zap.String("query", "claimAccrualQuery"),
+			zap.Int("amount", amount))
+		return 0, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "AccrueMonthlyCoins", err, zap.String("query", "claimAccrualQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int("amount", amount))
+		return 0, err
+	}
+	if claimed == 0 {
+		return 0, ErrAccrualAlreadyDone
+	}
+
+	if _, err = tx.ExecContext(ctx, insertAccrualEntryQuery, period, amount); err != nil {
+		postgresql.logQueryError(ctx, "AccrueMonthlyCoins", err, zap.String("query", "insertAccrualEntryQuery"),
+			zap.Int("amount", amount))
+		return 0, err
+	}
+
+	result, err = tx.ExecContext(ctx, accrueCoinsQuery, amount)
+	if err != nil {
+		postgresql.logQueryError(ctx, "AccrueMonthlyCoins", err, zap.String("query", "accrueCoinsQuery"),
+			zap.Int("amount", amount))
+		return 0, err
+	}
+	credited, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "AccrueMonthlyCoins", err, zap.String("query", "accrueCoinsQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int("amount", amount))
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, setAccrualUsersQuery, credited, period); err != nil {
+		postgresql.logQueryError(ctx, "AccrueMonthlyCoins", err, zap.String("query", "setAccrualUsersQuery"),
+			zap.Int("amount", amount))
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(credited), nil
+}
+
+// GetAccrualEntry returns the amount credited to the user for the period, or sql.ErrNoRows when the user got nothing.
+func (postgresql *PostgreSQL) GetAccrualEntry(ctx context.Context, period time.Time, userID int32) (int, error) {
+	var amount int
+	err := postgresql.db.QueryRowContext(ctx, getAccrualEntryUserQuery, period, userID).Scan(&amount)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount, nil
+}
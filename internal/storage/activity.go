@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	recordAPIActivityQuery = `INSERT INTO content.api_activity (user_id, action, path, status, ip, created_at) VALUES ($1, $2, $3, $4, $5, $6);`
+	getUserActivityQuery   = `SELECT id, action, path, status, ip, created_at FROM content.api_activity WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 AND ($4::timestamptz IS NULL OR (created_at, id) < ($4, $5)) ORDER BY created_at DESC, id DESC LIMIT $6;`
+)
+
+// RecordAPIActivity stores a request of a user to the API, encrypting its IP when a cipher is set (see SetCipher).
+// CreatedAt is the time of the request, which precedes the write when activity is recorded asynchronously.
+func (postgresql *PostgreSQL) RecordAPIActivity(ctx context.Context, activity models.APIActivity) error {
+	ip, err := postgresql.cipher.Encrypt(activity.IP)
+	if err != nil {
+		postgresql.logQueryError(ctx, "RecordAPIActivity", err, zap.String("query", "recordAPIActivityQuery"),
+			zap.String("stage", "encrypt"))
+		return err
+	}
+
+	_, err = postgresql.db.ExecContext(ctx, recordAPIActivityQuery, activity.UserID, activity.Action, activity.Path, activity.Status, ip, activity.CreatedAt)
+	if err != nil {
+		postgresql.logQueryError(ctx, "RecordAPIActivity", err, zap.String("query", "recordAPIActivityQuery"))
+		return err
+	}
+
+	return nil
+}
+
+// GetUserActivity returns a page of the API requests of the user recorded in [filter.From, filter.To), newest first,
+// with their IPs decrypted (see decrypt). Only the rows of the user are ever selected, whatever the cursor.
+func (postgresql *PostgreSQL) GetUserActivity(ctx context.Context, userID int32, filter models.ActivityFilter) ([]models.APIActivity, error) {
+	var afterCreatedAt, afterID any
+	if filter.After != nil {
+		afterCreatedAt, afterID = filter.After.CreatedAt, filter.After.ID
+	}
+
+	rows, err := postgresql.db.QueryContext(ctx, getUserActivityQuery, userID, filter.From, filter.To, afterCreatedAt, afterID, filter.Limit)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetUserActivity", err, zap.String("query", "getUserActivityQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := make([]models.APIActivity, 0, filter.Limit)
+	for rows.Next() {
+		entry := models.APIActivity{UserID: userID}
+		if err = rows.Scan(&entry.ID, &entry.Action, &entry.Path, &entry.Status, &entry.IP, &entry.CreatedAt); err != nil {
+			postgresql.logQueryError(ctx, "GetUserActivity", err, zap.String("query", "getUserActivityQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		entry.IP = postgresql.decrypt(ctx, "GetUserActivity", entry.IP, zap.Int64("activityID", entry.ID), zap.Int32("userID", userID))
+		activity = append(activity, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetUserActivity", err, zap.String("query", "getUserActivityQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return activity, nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const getCatalogWithAffordabilityQuery = `
+	WITH balance AS (
+		SELECT u.coins - COALESCE((SELECT SUM(h.amount) FROM content.coin_holds h WHERE h.user_id = u.id AND h.status = 'active'), 0) AS available
+		FROM content.users u WHERE u.id = $1
+	)
+	SELECT c.merch_name, c.price, c.effective_price, c.promotion_id, c.effective_price <= c.available, GREATEST(c.effective_price - c.available, 0)
+	FROM (
+		SELECT m.id, m.merch_name, m.price, m.price - COALESCE(bp.discount, 0) AS effective_price, bp.id AS promotion_id, b.available
+		FROM content.merch m CROSS JOIN balance b` + bestPromotionJoin + `
+	) c
+	ORDER BY c.id;`
+
+// GetCatalogWithAffordability retrieves the merch catalog together with whether the user can afford each item
+// with their available balance, that is their coins less the active holds, and how many coins they are short of it.
+// Like in GetMerchCatalog, prices are discounted by the best promotions active now.
+// It returns ErrUserNotFound when the user does not exist.
+func (postgresql *PostgreSQL) GetCatalogWithAffordability(ctx context.Context, userID int32) ([]models.AffordableCatalogItem, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getCatalogWithAffordabilityQuery, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetCatalogWithAffordability", err,
+			zap.String("query", "getCatalogWithAffordabilityQuery"), zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	const catalogCapacity = 10
+	catalog := make([]models.AffordableCatalogItem, 0, catalogCapacity)
+	for rows.Next() {
+		item := models.AffordableCatalogItem{}
+		var price int
+		var promotionID sql.NullInt64
+		if err := rows.Scan(&item.Name, &price, &item.Price, &promotionID, &item.Affordable, &item.Shortfall); err != nil {
+			postgresql.logQueryError(ctx, "GetCatalogWithAffordability", err,
+				zap.String("query", "getCatalogWithAffordabilityQuery"), zap.String("stage", "scan"),
+				zap.Int32("userID", userID))
+			return nil, err
+		}
+		if promotionID.Valid {
+			item.OriginalPrice, item.PromotionID = price, &promotionID.Int64
+		}
+		catalog = append(catalog, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetCatalogWithAffordability", err,
+			zap.String("query", "getCatalogWithAffordabilityQuery"), zap.String("stage", "rows"),
+			zap.Int32("userID", userID))
+		return catalog, err
+	}
+
+	// The catalog is never empty, so no rows means that the user does not exist.
+	if len(catalog) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return catalog, nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// archiveTransfersQuery moves up to $2 transfers created before $1, oldest first, from content.coin_transfers
+	// to content.coin_transfers_archive in one statement, so that a transfer is always in exactly one of them:
+	// should an ID somehow be archived already, the statement fails as a whole instead of dropping the transfer.
+	// Reversed transfers and reversals stay: the reversal records reference them, and they may still be checked.
+	// Rows locked by a concurrent reversal are skipped and archived by a later run.
+	archiveTransfersQuery = `
+	WITH candidates AS (
+		SELECT id FROM content.coin_transfers
+		WHERE created_at < $1 AND reversal_of IS NULL AND reversed_at IS NULL
+		ORDER BY created_at, id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	), moved AS (
+		DELETE FROM content.coin_transfers t USING candidates c WHERE t.id = c.id
+		RETURNING t.id, t.from_user_id, t.to_user_id, t.amount, t.bonus, t.campaign_id, t.created_at, t.reversal_of, t.reversed_by, t.reversed_at
+	)
+	INSERT INTO content.coin_transfers_archive (id, from_user_id, to_user_id, amount, bonus, campaign_id, created_at, reversal_of, reversed_by, reversed_at)
+	SELECT id, from_user_id, to_user_id, amount, bonus, campaign_id, created_at, reversal_of, reversed_by, reversed_at FROM moved;`
+
+	getArchivedTransfersQuery     = `SELECT ct.id, fu.username, tu.username, ct.amount, ct.bonus, ct.campaign_id, ct.created_at FROM content.all_coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE (ct.from_user_id = $1 OR ct.to_user_id = $1) AND ($2::timestamptz IS NULL OR (ct.created_at, ct.id) < ($2, $3)) ORDER BY ct.created_at DESC, ct.id DESC LIMIT $4;`
+	getArchivedSentTransfersQuery = `SELECT ct.id, fu.username, tu.username, ct.amount, ct.bonus, ct.campaign_id, ct.created_at FROM content.all_coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE ct.from_user_id = $1 AND ($2::timestamptz IS NULL OR (ct.created_at, ct.id) < ($2, $3)) ORDER BY ct.created_at DESC, ct.id DESC LIMIT $4;`
+	getArchivedRecvTransfersQuery = `SELECT ct.id, fu.username, tu.username, ct.amount, ct.bonus, ct.campaign_id, ct.created_at FROM content.all_coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE ct.to_user_id = $1 AND ($2::timestamptz IS NULL OR (ct.created_at, ct.id) < ($2, $3)) ORDER BY ct.created_at DESC, ct.id DESC LIMIT $4;`
+)
+
+// ArchiveTransfers moves up to limit transfers created before the given time to the archive, oldest first, and
+// returns how many it moved. Each call is a single transaction, and calling it again for the same time moves only
+// what is left, so an interrupted run is simply repeated. Reversed transfers and reversals are never archived.
+// Archived transfers are left out of the history, the /api/info summary, and GetTransfers unless requested, but
+// still count in the invariants, the economy statistics, and the account exports.
+func (postgresql *PostgreSQL) ArchiveTransfers(ctx context.Context, before time.Time, limit int) (int64, error) {
+	result, err := postgresql.db.ExecContext(ctx, archiveTransfersQuery, before, limit)
+	if err != nil {
+		postgresql.logQueryError(ctx, "ArchiveTransfers", err, zap.String("query", "archiveTransfersQuery"),
+			zap.Int("limit", limit))
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+const lockUserCoinsQuery = `SELECT coins FROM content.users WHERE id = $1 FOR UPDATE;`
+
+// DefaultMaxCoinBalance is the largest balance a user may hold unless configured otherwise with SetMaxCoinBalance.
+const DefaultMaxCoinBalance int64 = 1_000_000
+
+// ErrBalanceCapExceeded indicates that crediting the user would push their balance over the maximum coin balance.
+var ErrBalanceCapExceeded = errors.New("storage: balance cap exceeded")
+
+// SetMaxCoinBalance sets the largest balance a user may hold; credits that would exceed it fail with ErrBalanceCapExceeded.
+// Zero disables the cap.
+func (postgresql *PostgreSQL) SetMaxCoinBalance(maxBalance int64) {
+	postgresql.maxCoinBalance = maxBalance
+}
+
+// ensureBalanceCap locks the user's row and verifies that crediting it with coins keeps the balance within the cap.
+// Debits and credits made while the cap is disabled are not checked.
+func (postgresql *PostgreSQL) ensureBalanceCap(ctx context.Context, tx Tx, userID int32, coins int64) error {
+	if coins <= 0 || postgresql.maxCoinBalance <= 0 {
+		return nil
+	}
+
+	var balance int64
+	err := postgresql.querier(ctx, tx).QueryRowContext(ctx, lockUserCoinsQuery, userID).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "ensureBalanceCap", err, zap.String("query", "lockUserCoinsQuery"),
+			zap.Int32("userID", userID), zap.Int64("coins", coins))
+		return err
+	}
+
+	if exceedsBalanceCap(balance, coins, postgresql.maxCoinBalance) {
+		return ErrBalanceCapExceeded
+	}
+
+	return nil
+}
+
+// exceedsBalanceCap reports whether adding coins to balance would go over maxBalance.
+// The comparison is arranged so that it cannot overflow int64 for any non-negative balance and cap.
+func exceedsBalanceCap(balance, coins, maxBalance int64) bool {
+	return coins > 0 && balance > maxBalance-coins
+}
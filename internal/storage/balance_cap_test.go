@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExceedsBalanceCap(t *testing.T) {
+	testCases := []struct {
+		name       string
+		balance    int64
+		coins      int64
+		maxBalance int64
+		expected   bool
+	}{
+		{name: "Below the cap", balance: 999_000, coins: 999, maxBalance: DefaultMaxCoinBalance, expected: false},
+		{name: "Exactly the cap", balance: 999_000, coins: 1000, maxBalance: DefaultMaxCoinBalance, expected: false},
+		{name: "Over the cap", balance: 999_000, coins: 1001, maxBalance: DefaultMaxCoinBalance, expected: true},
+		{name: "Already over the cap", balance: DefaultMaxCoinBalance + 1, coins: 1, maxBalance: DefaultMaxCoinBalance, expected: true},
+		{name: "Debit over the cap", balance: DefaultMaxCoinBalance + 1, coins: -1, maxBalance: DefaultMaxCoinBalance, expected: false},
+		{name: "Sum would overflow int64", balance: math.MaxInt64 - 1, coins: math.MaxInt64, maxBalance: math.MaxInt64, expected: true},
+		{name: "Credit larger than any cap", balance: 1, coins: math.MaxInt64, maxBalance: DefaultMaxCoinBalance, expected: true},
+		{name: "Exactly the largest balance", balance: math.MaxInt64 - 10, coins: 10, maxBalance: math.MaxInt64, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, exceedsBalanceCap(tc.balance, tc.coins, tc.maxBalance))
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/security"
+)
+
+// Prefix and suffix of the multi-row insert built by CreateUsersBulk around one row of values per user.
+// Rows whose username is already taken are skipped rather than failing the whole batch.
+const (
+	createUsersBulkQuery       = `INSERT INTO content.users (username, password_hash, coins, opening_coins) VALUES `
+	createUsersBulkQuerySuffix = ` ON CONFLICT (username) DO NOTHING RETURNING id, username;`
+)
+
+// CreateUsersBulk creates the users with a single multi-row insert in one transaction and returns those created,
+// with their IDs set. Users whose username already exists are skipped and left out of the result.
+// Passwords are taken in plain text and hashed before the transaction starts.
+func (postgresql *PostgreSQL) CreateUsersBulk(ctx context.Context, users []models.User) ([]models.User, error) {
+	if len(users) == 0 {
+		return []models.User{}, nil
+	}
+
+	passwords := make([]string, len(users))
+	for i, user := range users {
+		passwords[i] = user.Password
+	}
+	hashes := security.HashPasswords(passwords)
+
+	var query strings.Builder
+	query.WriteString(createUsersBulkQuery)
+	args := make([]any, 0, 3*len(users))
+	byUsername := make(map[string]models.User, len(users))
+	for i, user := range users {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", 3*i+1, 3*i+2, 3*i+3, 3*i+3)
+		args = append(args, user.Username, hashes[i], user.Coins)
+		byUsername[user.Username] = user
+	}
+	query.WriteString(createUsersBulkQuerySuffix)
+
+	created := []models.User{}
+	err := postgresql.inTransaction(ctx, "CreateUsersBulk", func(ctx context.Context) error {
+		created = created[:0]
+
+		rows, err := postgresql.querier(ctx, nil).QueryContext(ctx, query.String(), args...)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateUsersBulk", err, zap.String("query", "createUsersBulkQuery"))
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var user models.User
+			if err := rows.Scan(&user.ID, &user.Username); err != nil {
+				postgresql.logQueryError(ctx, "CreateUsersBulk", err, zap.String("query", "createUsersBulkQuery"),
+					zap.String("stage", "scan"))
+				return err
+			}
+			user.Password = byUsername[user.Username].Password
+			user.Coins = byUsername[user.Username].Coins
+			created = append(created, user)
+		}
+
+		if err := rows.Err(); err != nil {
+			postgresql.logQueryError(ctx, "CreateUsersBulk", err, zap.String("query", "createUsersBulkQuery"),
+				zap.String("stage", "rows"))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	createCampaignQuery = `INSERT INTO content.gifting_campaigns (name, multiplier_percent, budget, starts_at, ends_at) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at;`
+	getCampaignsQuery   = `SELECT id, name, multiplier_percent, budget, spent, starts_at, ends_at, created_at FROM content.gifting_campaigns ORDER BY starts_at DESC, id DESC;`
+	getCampaignQuery    = `SELECT id, name, multiplier_percent, budget, spent, starts_at, ends_at, created_at FROM content.gifting_campaigns WHERE id = $1;`
+	lockCampaignQuery   = `SELECT spent FROM content.gifting_campaigns WHERE id = $1 FOR UPDATE;`
+	updateCampaignQuery = `UPDATE content.gifting_campaigns SET name = $2, multiplier_percent = $3, budget = $4, starts_at = $5, ends_at = $6 WHERE id = $1 RETURNING created_at;`
+	deleteCampaignQuery = `DELETE FROM content.gifting_campaigns c WHERE c.id = $1 AND NOT EXISTS (SELECT 1 FROM content.all_coin_transfers t WHERE t.campaign_id = c.id);`
+	// claimCampaignBonusQuery takes the bonus of a transfer of $1 coins from the budget of the active campaign with
+	// the highest multiplier that can still pay it. The budget is checked again by the UPDATE itself, so when
+	// a concurrent transfer spends it first no row is returned and the transfer gets no bonus.
+	claimCampaignBonusQuery = `
+	UPDATE content.gifting_campaigns SET spent = spent + $1::bigint * (multiplier_percent - 100) / 100
+	WHERE id = (
+		SELECT id FROM content.gifting_campaigns
+		WHERE starts_at <= NOW() AND ends_at > NOW() AND $1::bigint * (multiplier_percent - 100) / 100 BETWEEN 1 AND budget - spent
+		ORDER BY multiplier_percent DESC, id
+		LIMIT 1)
+		AND $1::bigint * (multiplier_percent - 100) / 100 <= budget - spent
+	RETURNING id, $1::bigint * (multiplier_percent - 100) / 100;`
+	refundCampaignBonusQuery = `UPDATE content.gifting_campaigns SET spent = spent - $2 WHERE id = $1;`
+)
+
+// Predefined errors for gifting campaigns.
+var (
+	// ErrCampaignNotFound indicates that no gifting campaign with the given ID exists.
+	ErrCampaignNotFound = errors.New("storage: campaign not found")
+	// ErrCampaignInUse indicates that the campaign cannot be deleted because transfers received its bonus.
+	ErrCampaignInUse = errors.New("storage: campaign has paid bonuses")
+	// ErrCampaignBudgetSpent indicates that the new budget of the campaign is lower than the bonuses already paid from it.
+	ErrCampaignBudgetSpent = errors.New("storage: campaign budget is lower than the bonuses already paid")
+)
+
+// multiplierPercent converts a campaign multiplier to the percentage it is stored as, so that bonuses are computed
+// in integers.
+func multiplierPercent(multiplier float64) int {
+	return int(math.Round(multiplier * 100))
+}
+
+// CreateCampaign stores a gifting campaign and returns it with its ID and creation time.
+func (postgresql *PostgreSQL) CreateCampaign(ctx context.Context, campaign models.Campaign) (*models.Campaign, error) {
+	err := postgresql.db.QueryRowContext(ctx, createCampaignQuery, campaign.Name, multiplierPercent(campaign.Multiplier),
+		campaign.Budget, campaign.StartsAt, campaign.EndsAt).Scan(&campaign.ID, &campaign.CreatedAt)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CreateCampaign", err, zap.String("query", "createCampaignQuery"))
+		return nil, err
+	}
+	campaign.RemainingBudget = campaign.Budget
+
+	return &campaign, nil
+}
+
+// GetCampaigns returns every gifting campaign, the latest to start first.
+func (postgresql *PostgreSQL) GetCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getCampaignsQuery)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetCampaigns", err, zap.String("query", "getCampaignsQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []models.Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			postgresql.logQueryError(ctx, "GetCampaigns", err, zap.String("query", "getCampaignsQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+		campaigns = append(campaigns, *campaign)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetCampaigns", err, zap.String("query", "getCampaignsQuery"), zap.String("stage", "rows"))
+		return nil, err
+	}
+
+	return campaigns, nil
+}
+
+// GetCampaign returns the gifting campaign with the given ID, or ErrCampaignNotFound.
+func (postgresql *PostgreSQL) GetCampaign(ctx context.Context, campaignID int64) (*models.Campaign, error) {
+	campaign, err := scanCampaign(postgresql.db.QueryRowContext(ctx, getCampaignQuery, campaignID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCampaignNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetCampaign", err, zap.String("query", "getCampaignQuery"),
+			zap.Int64("campaignID", campaignID))
+		return nil, err
+	}
+
+	return campaign, nil
+}
+
+// UpdateCampaign replaces the name, multiplier, budget, and window of the campaign with campaign.ID, keeping the
+// bonuses already paid from it. It returns ErrCampaignNotFound for an unknown campaign and ErrCampaignBudgetSpent
+// when the new budget is lower than the bonuses already paid. Transfers racing with the update either pay their
+// bonus under the old settings or wait for it and pay under the new ones.
+func (postgresql *PostgreSQL) UpdateCampaign(ctx context.Context, campaign models.Campaign) (*models.Campaign, error) {
+	err := postgresql.inTransaction(ctx, "UpdateCampaign", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		var spent int64
+		err := q.QueryRowContext(ctx, lockCampaignQuery, campaign.ID).Scan(&spent)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCampaignNotFound
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "UpdateCampaign", err, zap.String("query", "lockCampaignQuery"))
+			return err
+		}
+		if campaign.Budget < spent {
+			return ErrCampaignBudgetSpent
+		}
+
+		err = q.QueryRowContext(ctx, updateCampaignQuery, campaign.ID, campaign.Name, multiplierPercent(campaign.Multiplier),
+			campaign.Budget, campaign.StartsAt, campaign.EndsAt).Scan(&campaign.CreatedAt)
+		if err != nil {
+			postgresql.logQueryError(ctx, "UpdateCampaign", err, zap.String("query", "updateCampaignQuery"))
+			return err
+		}
+		campaign.RemainingBudget = campaign.Budget - spent
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &campaign, nil
+}
+
+// DeleteCampaign deletes the campaign with the given ID. A campaign that has paid bonuses is referenced by the
+// history of the transfers it paid them to and cannot be deleted: it returns ErrCampaignInUse, and the campaign can
+// be ended by moving its end instead. It returns ErrCampaignNotFound for an unknown campaign.
+func (postgresql *PostgreSQL) DeleteCampaign(ctx context.Context, campaignID int64) error {
+	result, err := postgresql.db.ExecContext(ctx, deleteCampaignQuery, campaignID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "DeleteCampaign", err, zap.String("query", "deleteCampaignQuery"),
+			zap.Int64("campaignID", campaignID))
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "DeleteCampaign", err, zap.String("query", "deleteCampaignQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int64("campaignID", campaignID))
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	if _, err = postgresql.GetCampaign(ctx, campaignID); err != nil {
+		return err
+	}
+
+	return ErrCampaignInUse
+}
+
+// payCampaignBonus credits the recipient of a transfer of amount coins with the bonus of the active campaign, paid
+// from the campaign budget, within the transaction stored in ctx. It returns the bonus and the ID of the campaign
+// paying it. The transfer falls back to no bonus, returning zero and an invalid ID, when no campaign is active, when
+// the budget cannot cover the whole bonus, including when a concurrent transfer has just spent it, and when the bonus
+// would push the recipient's balance over the cap.
+func (postgresql *PostgreSQL) payCampaignBonus(ctx context.Context, recipientID int32, amount int64) (int64, sql.NullInt64, error) {
+	q := postgresql.querier(ctx, nil)
+
+	var bonus int64
+	var campaignID sql.NullInt64
+	err := q.QueryRowContext(ctx, claimCampaignBonusQuery, amount).Scan(&campaignID.Int64, &bonus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, sql.NullInt64{}, nil
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "payCampaignBonus", err, zap.String("query", "claimCampaignBonusQuery"),
+			zap.Int32("recipientID", recipientID), zap.Int64("amount", amount))
+		return 0, sql.NullInt64{}, err
+	}
+	campaignID.Valid = true
+
+	err = postgresql.UpdateUserCoins(ctx, nil, recipientID, bonus)
+	if errors.Is(err, ErrBalanceCapExceeded) {
+		if _, err = q.ExecContext(ctx, refundCampaignBonusQuery, campaignID.Int64, bonus); err != nil {
+			postgresql.logQueryError(ctx, "payCampaignBonus", err, zap.String("query", "refundCampaignBonusQuery"),
+				zap.Int32("recipientID", recipientID), zap.Int64("amount", amount))
+			return 0, sql.NullInt64{}, err
+		}
+		return 0, sql.NullInt64{}, nil
+	}
+	if err != nil {
+		return 0, sql.NullInt64{}, err
+	}
+
+	return bonus, campaignID, nil
+}
+
+// scanCampaign scans a row of getCampaignsQuery or getCampaignQuery.
+func scanCampaign(row Row) (*models.Campaign, error) {
+	campaign := &models.Campaign{}
+	var percent int
+	var spent int64
+	err := row.Scan(&campaign.ID, &campaign.Name, &percent, &campaign.Budget, &spent, &campaign.StartsAt, &campaign.EndsAt, &campaign.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	campaign.Multiplier = float64(percent) / 100
+	campaign.RemainingBudget = campaign.Budget - spent
+	campaign.StartsAt, campaign.EndsAt, campaign.CreatedAt = campaign.StartsAt.UTC(), campaign.EndsAt.UTC(), campaign.CreatedAt.UTC()
+
+	return campaign, nil
+}
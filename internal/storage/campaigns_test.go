@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+)
+
+// countEvents returns the number of times the event was recorded.
+func countEvents(events []string, event string) int {
+	count := 0
+	for _, e := range events {
+		if e == event {
+			count++
+		}
+	}
+	return count
+}
+
+func TestTransferCoins_CampaignBonus(t *testing.T) {
+	oneRow := func(string, []any) int64 { return 1 }
+
+	t.Run("Active campaign", func(t *testing.T) {
+		postgresql, db := newScriptedPostgreSQL(nil, oneRow)
+
+		_, err := postgresql.TransferCoins(context.Background(), 1, models.SendCoinRequest{ToUser: "user", Amount: 1})
+		require.NoError(t, err)
+		assert.Contains(t, db.events, "tx: "+claimCampaignBonusQuery)
+		assert.Equal(t, 1, countEvents(db.events, "tx: "+spendUserCoinsQuery))
+		assert.Equal(t, 2, countEvents(db.events, "tx: "+updateUserCoinsQuery), "the recipient must be credited with the bonus")
+		assert.NotContains(t, db.events, "tx: "+refundCampaignBonusQuery)
+		assert.Equal(t, "commit", db.events[len(db.events)-1])
+	})
+
+	t.Run("No campaign or exhausted budget", func(t *testing.T) {
+		postgresql, db := newScriptedPostgreSQL([]string{claimCampaignBonusQuery}, oneRow)
+
+		_, err := postgresql.TransferCoins(context.Background(), 1, models.SendCoinRequest{ToUser: "user", Amount: 1})
+		require.NoError(t, err, "a transfer without a bonus to pay must still be made")
+		assert.Equal(t, 1, countEvents(db.events, "tx: "+updateUserCoinsQuery))
+		assert.Contains(t, db.events, "tx: "+transferCoinsQuery)
+		assert.Equal(t, "commit", db.events[len(db.events)-1])
+	})
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+)
+
+const setMerchCategoryQuery = `UPDATE content.merch SET category = $2 WHERE merch_name = $1 RETURNING merch_name, category;`
+
+// SetMerchCategory assigns the item to category, or leaves it uncategorized when category is empty, and returns
+// the new assignment. It returns ErrItemNotFound when there is no such item. Like any change to content.merch,
+// it bumps the Last-Modified time of the catalog.
+func (postgresql *PostgreSQL) SetMerchCategory(ctx context.Context, itemName string, category string) (*models.MerchCategory, error) {
+	assignment := &models.MerchCategory{}
+	var assigned sql.NullString
+	err := postgresql.db.QueryRowContext(ctx, setMerchCategoryQuery, itemName, nullString(category)).
+		Scan(&assignment.Item, &assigned)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "SetMerchCategory", err, zap.String("query", "setMerchCategoryQuery"),
+			logger.ItemName(itemName))
+		return nil, err
+	}
+	assignment.Category = assigned.String
+
+	return assignment, nil
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultDeadlineFloor is the least time that must remain before the context deadline for a storage
+// operation to issue its next query, unless configured otherwise with SetDeadlineFloor.
+const DefaultDeadlineFloor = 250 * time.Millisecond
+
+// ErrDeadlineTooClose indicates that an operation was abandoned between two queries because too little time
+// remained before the context deadline for the rest of it to complete.
+var ErrDeadlineTooClose = errors.New("storage: too little time left before the deadline")
+
+// SetDeadlineFloor sets the least time that must remain before the context deadline for multi-query operations
+// to issue their next query; they fail with ErrDeadlineTooClose otherwise. Zero disables the check.
+func (postgresql *PostgreSQL) SetDeadlineFloor(floor time.Duration) {
+	postgresql.deadlineFloor = floor
+}
+
+// checkDeadline returns ErrDeadlineTooClose when ctx has a deadline less than the deadline floor away,
+// so that an operation stops before starting a query it would most likely not be able to finish.
+// Contexts without a deadline always pass.
+func (postgresql *PostgreSQL) checkDeadline(ctx context.Context) error {
+	if postgresql.deadlineFloor <= 0 {
+		return nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if ok && time.Until(deadline) < postgresql.deadlineFloor {
+		return ErrDeadlineTooClose
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+)
+
+// slowDatabase is a fakeDatabase whose transactions take delay to answer every single-row query.
+type slowDatabase struct {
+	*fakeDatabase
+	delay time.Duration
+}
+
+func (d *slowDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	d.events = append(d.events, "begin")
+	return &slowTx{fakeTx: fakeTx{db: d.fakeDatabase}, delay: d.delay}, nil
+}
+
+// slowTx records its queries and answers each single-row query after a delay with zero-like values.
+type slowTx struct {
+	fakeTx
+	delay time.Duration
+}
+
+func (tx *slowTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	tx.db.events = append(tx.db.events, "tx: "+query)
+	return nil, errors.New("not implemented")
+}
+
+func (tx *slowTx) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	tx.db.events = append(tx.db.events, "tx: "+query)
+	time.Sleep(tx.delay)
+	return slowRow{}
+}
+
+// slowRow scans 1 into every integer destination and "user" into every string destination.
+type slowRow struct{}
+
+func (slowRow) Scan(dest ...any) error {
+	for _, d := range dest {
+		switch d := d.(type) {
+		case *int:
+			*d = 1
+		case *int32:
+			*d = 1
+		case *int64:
+			*d = 1
+		case *string:
+			*d = "user"
+		}
+	}
+	return nil
+}
+
+func newSlowPostgreSQL(delay, floor time.Duration) (*PostgreSQL, *fakeDatabase) {
+	postgresql, db := newFakePostgreSQL()
+	postgresql.db = &slowDatabase{fakeDatabase: db, delay: delay}
+	postgresql.SetDeadlineFloor(floor)
+	return postgresql, db
+}
+
+func TestCheckDeadline(t *testing.T) {
+	postgresql, _ := newFakePostgreSQL()
+	postgresql.SetDeadlineFloor(250 * time.Millisecond)
+
+	assert.NoError(t, postgresql.checkDeadline(context.Background()), "a context without a deadline must pass")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, postgresql.checkDeadline(ctx))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, postgresql.checkDeadline(ctx), ErrDeadlineTooClose)
+
+	postgresql.SetDeadlineFloor(0)
+	assert.NoError(t, postgresql.checkDeadline(ctx), "a zero floor must disable the check")
+}
+
+func TestDeadlineFloor_AbortsEarly(t *testing.T) {
+	const (
+		delay = 100 * time.Millisecond
+		floor = 250 * time.Millisecond
+	)
+	// The first query leaves less than the floor before the deadline, so no second query may start.
+	deadlineAfter := floor + delay/2
+
+	t.Run("GetInfo", func(t *testing.T) {
+		postgresql, db := newSlowPostgreSQL(delay, floor)
+		ctx, cancel := context.WithTimeout(context.Background(), deadlineAfter)
+		defer cancel()
+
+		_, err := postgresql.GetInfo(ctx, 1)
+		require.ErrorIs(t, err, ErrDeadlineTooClose)
+		assert.Equal(t, []string{"begin", "tx: " + getUserInfoQuery, "rollback"}, db.events)
+	})
+
+	t.Run("BuyItem", func(t *testing.T) {
+		postgresql, db := newSlowPostgreSQL(delay, floor)
+		ctx, cancel := context.WithTimeout(context.Background(), deadlineAfter)
+		defer cancel()
+
+		_, err := postgresql.BuyItem(ctx, 1, "pen")
+		require.ErrorIs(t, err, ErrDeadlineTooClose)
+		assert.Equal(t, []string{"begin", "tx: " + getItemPriceQuery, "rollback"}, db.events)
+	})
+
+	t.Run("TransferCoins", func(t *testing.T) {
+		postgresql, db := newSlowPostgreSQL(delay, floor)
+		ctx, cancel := context.WithTimeout(context.Background(), deadlineAfter)
+		defer cancel()
+
+		_, err := postgresql.TransferCoins(ctx, 1, models.SendCoinRequest{ToUser: "user", Amount: 1})
+		require.ErrorIs(t, err, ErrDeadlineTooClose)
+		assert.NotContains(t, db.events, "tx: "+transferCoinsQuery)
+		assert.Equal(t, "rollback", db.events[len(db.events)-1])
+	})
+
+	t.Run("Enough time left", func(t *testing.T) {
+		postgresql, db := newSlowPostgreSQL(0, floor)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, err := postgresql.GetInfo(ctx, 1)
+		assert.NotErrorIs(t, err, ErrDeadlineTooClose)
+		assert.Contains(t, db.events, "tx: "+getMerchPurchasesQuery, "the next query must run while time is left")
+	})
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+)
+
+const (
+	lockGrantorQuery              = `SELECT username FROM content.users WHERE id = $1 FOR UPDATE;`
+	revokeActiveDelegationQuery   = `UPDATE content.spending_delegations SET revoked_at = $3 WHERE grantor_id = $1 AND grantee_id = $2 AND revoked_at IS NULL;`
+	createDelegationQuery         = `INSERT INTO content.spending_delegations (grantor_id, grantee_id, allowance, remaining_allowance, expires_at, created_at) VALUES ($1, $2, $3, $3, $4, $5) RETURNING id;`
+	getGrantedDelegationsQuery    = `SELECT d.id, u.username, d.allowance, d.remaining_allowance, d.expires_at, d.created_at FROM content.spending_delegations d JOIN content.users u ON u.id = d.grantee_id WHERE d.grantor_id = $1 AND d.revoked_at IS NULL ORDER BY d.created_at DESC, d.id DESC;`
+	getReceivedDelegationsQuery   = `SELECT d.id, u.username, d.allowance, d.remaining_allowance, d.expires_at, d.created_at FROM content.spending_delegations d JOIN content.users u ON u.id = d.grantor_id WHERE d.grantee_id = $1 AND d.revoked_at IS NULL ORDER BY d.created_at DESC, d.id DESC;`
+	revokeDelegationQuery         = `UPDATE content.spending_delegations SET revoked_at = $3 WHERE id = $1 AND grantor_id = $2 AND revoked_at IS NULL;`
+	spendDelegatedAllowanceQuery  = `UPDATE content.spending_delegations d SET remaining_allowance = d.remaining_allowance - $3 FROM content.users u WHERE u.username = $2 AND d.grantor_id = u.id AND d.grantee_id = $1 AND d.revoked_at IS NULL AND d.expires_at > $4 AND d.remaining_allowance >= $3 RETURNING d.grantor_id, d.remaining_allowance;`
+	getActiveDelegationStateQuery = `SELECT d.expires_at, d.remaining_allowance FROM content.spending_delegations d JOIN content.users u ON u.id = d.grantor_id WHERE u.username = $2 AND d.grantee_id = $1 AND d.revoked_at IS NULL;`
+)
+
+// Predefined errors for spending delegations.
+var (
+	// ErrDelegationNotFound indicates that the delegation does not exist, has been revoked, or was not granted by
+	// the user revoking it; for a purchase, that the grantor has not authorized the buyer at all.
+	ErrDelegationNotFound = errors.New("storage: delegation not found")
+	// ErrDelegationExpired indicates that the delegation a purchase relies on has expired.
+	ErrDelegationExpired = errors.New("storage: delegation expired")
+	// ErrDelegationAllowanceExceeded indicates that the price of an item exceeds what is left of the allowance.
+	ErrDelegationAllowanceExceeded = errors.New("storage: delegation allowance exceeded")
+	// ErrSelfDelegation indicates that a user tried to delegate spending to themselves.
+	ErrSelfDelegation = errors.New("storage: self-delegation")
+)
+
+// CreateDelegation authorizes delegation.Grantee to spend up to delegation.Allowance coins of the grantor on purchases
+// until delegation.ExpiresAt, and returns the delegation with its ID and the usernames of both parties.
+// An active delegation of the grantor to the same grantee is revoked at delegation.CreatedAt and replaced, so that
+// a grantor can raise or lower the allowance at any time. It returns ErrRecipientNotFound when the grantee does not
+// exist and ErrSelfDelegation when the grantee is the grantor.
+func (postgresql *PostgreSQL) CreateDelegation(ctx context.Context, grantorID int32, delegation models.Delegation) (*models.Delegation, error) {
+	err := postgresql.inTransaction(ctx, "CreateDelegation", func(ctx context.Context) error {
+		// Locking the grantor serializes the delegations of one grantor, so that replacing an active delegation
+		// cannot race another one into the unique index of active delegations.
+		err := postgresql.querier(ctx, nil).QueryRowContext(ctx, lockGrantorQuery, grantorID).Scan(&delegation.Grantor)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateDelegation", err, zap.String("query", "lockGrantorQuery"),
+				zap.Int32("grantorID", grantorID))
+			return err
+		}
+
+		grantee, err := postgresql.GetUserID(ctx, nil, delegation.Grantee)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecipientNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if grantee.ID == grantorID {
+			return ErrSelfDelegation
+		}
+		delegation.Grantee = grantee.Username
+
+		if _, err = postgresql.querier(ctx, nil).ExecContext(ctx, revokeActiveDelegationQuery, grantorID, grantee.ID, delegation.CreatedAt); err != nil {
+			postgresql.logQueryError(ctx, "CreateDelegation", err, zap.String("query", "revokeActiveDelegationQuery"),
+				zap.Int32("grantorID", grantorID))
+			return err
+		}
+
+		delegation.RemainingAllowance = delegation.Allowance
+		err = postgresql.querier(ctx, nil).QueryRowContext(ctx, createDelegationQuery, grantorID, grantee.ID, delegation.Allowance,
+			delegation.ExpiresAt, delegation.CreatedAt).Scan(&delegation.ID)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateDelegation", err, zap.String("query", "createDelegationQuery"),
+				zap.Int32("grantorID", grantorID))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &delegation, nil
+}
+
+// GetDelegations returns the delegations the user granted and those the user received that have not been revoked,
+// newest first. Expired and spent delegations are listed until they are revoked or replaced.
+func (postgresql *PostgreSQL) GetDelegations(ctx context.Context, userID int32) (*models.DelegationsResponse, error) {
+	granted, err := postgresql.getDelegations(ctx, getGrantedDelegationsQuery, "getGrantedDelegationsQuery", userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	received, err := postgresql.getDelegations(ctx, getReceivedDelegationsQuery, "getReceivedDelegationsQuery", userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DelegationsResponse{Granted: granted, Received: received}, nil
+}
+
+// getDelegations runs one of the listing queries of GetDelegations. The queries return the username of the other
+// party, which is the grantee of the delegations the user granted and the grantor of those the user received.
+func (postgresql *PostgreSQL) getDelegations(ctx context.Context, query string, queryName string, userID int32, granted bool) ([]models.Delegation, error) {
+	rows, err := postgresql.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "getDelegations", err, zap.String("query", queryName), zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	delegations := []models.Delegation{}
+	for rows.Next() {
+		var delegation models.Delegation
+		var otherParty string
+		if err := rows.Scan(&delegation.ID, &otherParty, &delegation.Allowance, &delegation.RemainingAllowance,
+			&delegation.ExpiresAt, &delegation.CreatedAt); err != nil {
+			postgresql.logQueryError(ctx, "getDelegations", err, zap.String("query", queryName),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		if granted {
+			delegation.Grantee = otherParty
+		} else {
+			delegation.Grantor = otherParty
+		}
+		delegations = append(delegations, delegation)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "getDelegations", err, zap.String("query", queryName), zap.String("stage", "rows"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return delegations, nil
+}
+
+// RevokeDelegation revokes a delegation granted by the user at now. Purchases relying on it fail from then on;
+// a purchase committed concurrently keeps what it spent. It returns ErrDelegationNotFound when the delegation
+// does not exist, was granted by another user, or is already revoked.
+func (postgresql *PostgreSQL) RevokeDelegation(ctx context.Context, grantorID int32, delegationID int64, now time.Time) error {
+	result, err := postgresql.db.ExecContext(ctx, revokeDelegationQuery, delegationID, grantorID, now)
+	if err != nil {
+		postgresql.logQueryError(ctx, "RevokeDelegation", err, zap.String("query", "revokeDelegationQuery"),
+			zap.Int32("grantorID", grantorID), zap.Int64("delegationID", delegationID))
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrDelegationNotFound
+	}
+
+	return nil
+}
+
+// BuyItemOnBehalf processes the purchase of an item by the grantee, paid for by the grantor, named by username,
+// under the grantor's active delegation to the grantee. Within one transaction, the price of the item is taken from
+// the remaining allowance, the grantor is charged, and the purchase is recorded against the grantor, who receives
+// the item, with the grantee noted in bought_by. The result holds the grantee's own balance, unchanged, and what is
+// left of the allowance.
+//
+// The allowance is decremented by a single conditional update, so concurrent purchases never spend more than
+// the allowance together, and a purchase racing the revocation of the delegation either completes before it or
+// fails. It returns ErrDelegationNotFound when the grantor has no active delegation to the grantee,
+// ErrDelegationExpired when the delegation has expired at now, ErrDelegationAllowanceExceeded when the price exceeds
+// the remaining allowance, and the errors of BuyItem otherwise.
+func (postgresql *PostgreSQL) BuyItemOnBehalf(ctx context.Context, granteeID int32, grantor string, itemName string, now time.Time) (*models.PurchaseResult, error) {
+	grantor = models.NormalizeUsername(grantor)
+
+	var purchase *models.PurchaseResult
+	err := postgresql.inTransaction(ctx, "BuyItemOnBehalf", func(ctx context.Context) error {
+		item, err := postgresql.GetItemPrice(ctx, nil, itemName)
+		if err != nil {
+			return err
+		}
+
+		if err = postgresql.checkDeadline(ctx); err != nil {
+			return err
+		}
+
+		var grantorID int32
+		var remainingAllowance int
+		err = postgresql.querier(ctx, nil).QueryRowContext(ctx, spendDelegatedAllowanceQuery, granteeID, grantor, item.Price, now).
+			Scan(&grantorID, &remainingAllowance)
+		if errors.Is(err, sql.ErrNoRows) {
+			return postgresql.delegationRefusal(ctx, granteeID, grantor, now)
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "BuyItemOnBehalf", err, zap.String("query", "spendDelegatedAllowanceQuery"),
+				zap.Int32("granteeID", granteeID), zap.String("grantor", grantor), logger.ItemName(itemName))
+			return err
+		}
+
+		if err = postgresql.checkDeadline(ctx); err != nil {
+			return err
+		}
+
+		purchase, err = postgresql.chargePurchase(ctx, grantorID, sql.NullInt32{Int32: granteeID, Valid: true}, item)
+		if err != nil {
+			return err
+		}
+
+		grantee, err := postgresql.GetUserInfo(ctx, nil, granteeID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		purchase.GrantorID, purchase.GrantorCoins = grantorID, purchase.RemainingCoins
+		purchase.RemainingCoins = grantee.Coins
+		purchase.OnBehalfOf = grantor
+		purchase.RemainingAllowance = &remainingAllowance
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return purchase, nil
+}
+
+// delegationRefusal tells why the grantor's delegation to the grantee does not cover a purchase at now.
+func (postgresql *PostgreSQL) delegationRefusal(ctx context.Context, granteeID int32, grantor string, now time.Time) error {
+	var expiresAt time.Time
+	var remainingAllowance int
+	err := postgresql.querier(ctx, nil).QueryRowContext(ctx, getActiveDelegationStateQuery, granteeID, grantor).Scan(&expiresAt, &remainingAllowance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDelegationNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "delegationRefusal", err, zap.String("query", "getActiveDelegationStateQuery"),
+			zap.Int32("granteeID", granteeID), zap.String("grantor", grantor))
+		return err
+	}
+
+	if !expiresAt.After(now) {
+		return ErrDelegationExpired
+	}
+	return ErrDelegationAllowanceExceeded
+}
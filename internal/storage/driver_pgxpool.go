@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pgxDatabase adapts a native *pgxpool.Pool to the database interface.
+type pgxDatabase struct {
+	pool *pgxpool.Pool
+}
+
+// openPgxDatabase creates a native pgx connection pool, with sessions in SessionTimeZone.
+func openPgxDatabase(cofigDBString string) (*pgxDatabase, error) {
+	config, err := pgxpool.ParseConfig(cofigDBString)
+	if err != nil {
+		return nil, err
+	}
+	configureTimeZone(config.ConnConfig)
+	config.AfterConnect = scanTimestampsInUTC
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	return &pgxDatabase{pool: pool}, nil
+}
+
+func (d *pgxDatabase) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	tag, err := d.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return pgxResult{tag: tag}, nil
+}
+
+func (d *pgxDatabase) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return pgxRows{rows: rows}, nil
+}
+
+func (d *pgxDatabase) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return pgxRow{row: d.pool.QueryRow(ctx, query, args...)}
+}
+
+func (d *pgxDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.pool.BeginTx(ctx, pgxTxOptions(opts))
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &pgxTx{ctx: ctx, tx: tx}, nil
+}
+
+func (d *pgxDatabase) Conn(ctx context.Context) (Conn, error) {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &pgxConn{conn: conn}, nil
+}
+
+func (d *pgxDatabase) PingContext(ctx context.Context) error {
+	return classifyError(d.pool.Ping(ctx))
+}
+
+func (d *pgxDatabase) Close() {
+	d.pool.Close()
+}
+
+// pgxTx adapts pgx.Tx to the Tx interface. Commit and Rollback use the context the transaction was started with.
+type pgxTx struct {
+	ctx context.Context
+	tx  pgx.Tx
+}
+
+func (t *pgxTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	tag, err := t.tx.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return pgxResult{tag: tag}, nil
+}
+
+func (t *pgxTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := t.tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return pgxRows{rows: rows}, nil
+}
+
+func (t *pgxTx) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return pgxRow{row: t.tx.QueryRow(ctx, query, args...)}
+}
+
+func (t *pgxTx) Commit() error {
+	return classifyError(t.tx.Commit(t.ctx))
+}
+
+func (t *pgxTx) Rollback() error {
+	return t.tx.Rollback(t.ctx)
+}
+
+// pgxConn adapts a connection acquired from pgxpool.Pool to the Conn interface.
+type pgxConn struct {
+	conn *pgxpool.Conn
+}
+
+func (c *pgxConn) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	tag, err := c.conn.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return pgxResult{tag: tag}, nil
+}
+
+func (c *pgxConn) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := c.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return pgxRows{rows: rows}, nil
+}
+
+func (c *pgxConn) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return pgxRow{row: c.conn.QueryRow(ctx, query, args...)}
+}
+
+// Release returns the connection to the pool. A discarded connection is taken out of the pool and closed,
+// waiting at most a second for the server to be told.
+func (c *pgxConn) Release(discard bool) {
+	if !discard {
+		c.conn.Release()
+		return
+	}
+
+	const closeTimeout = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	c.conn.Hijack().Close(ctx)
+}
+
+// pgxResult adapts pgconn.CommandTag to the Result interface.
+type pgxResult struct {
+	tag pgconn.CommandTag
+}
+
+func (r pgxResult) RowsAffected() (int64, error) {
+	return r.tag.RowsAffected(), nil
+}
+
+// pgxRows adapts pgx.Rows to the Rows interface.
+type pgxRows struct {
+	rows pgx.Rows
+}
+
+func (r pgxRows) Next() bool {
+	return r.rows.Next()
+}
+
+func (r pgxRows) Scan(dest ...any) error {
+	return r.rows.Scan(dest...)
+}
+
+func (r pgxRows) Err() error {
+	return classifyError(r.rows.Err())
+}
+
+func (r pgxRows) Close() error {
+	r.rows.Close()
+	return nil
+}
+
+// pgxRow adapts pgx.Row to the Row interface, translating pgx.ErrNoRows into sql.ErrNoRows
+// so that callers can detect missing rows the same way for both drivers, and classifying connection errors.
+type pgxRow struct {
+	row pgx.Row
+}
+
+func (r pgxRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	return classifyError(err)
+}
+
+// pgxTxOptions converts database/sql transaction options into their pgx equivalent.
+func pgxTxOptions(opts *sql.TxOptions) pgx.TxOptions {
+	var txOptions pgx.TxOptions
+	if opts == nil {
+		return txOptions
+	}
+
+	switch opts.Isolation {
+	case sql.LevelReadUncommitted:
+		txOptions.IsoLevel = pgx.ReadUncommitted
+	case sql.LevelReadCommitted:
+		txOptions.IsoLevel = pgx.ReadCommitted
+	case sql.LevelRepeatableRead, sql.LevelSnapshot:
+		txOptions.IsoLevel = pgx.RepeatableRead
+	case sql.LevelSerializable, sql.LevelLinearizable:
+		txOptions.IsoLevel = pgx.Serializable
+	}
+
+	if opts.ReadOnly {
+		txOptions.AccessMode = pgx.ReadOnly
+	}
+
+	return txOptions
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// sqlDatabase adapts *sql.DB opened with the pgx stdlib driver to the database interface.
+type sqlDatabase struct {
+	db *sql.DB
+}
+
+// openSQLDatabase opens a database/sql connection pool using the pgx stdlib driver, with sessions in
+// SessionTimeZone.
+func openSQLDatabase(cofigDBString string) (*sqlDatabase, error) {
+	config, err := pgx.ParseConfig(cofigDBString)
+	if err != nil {
+		return nil, err
+	}
+	configureTimeZone(config)
+	return &sqlDatabase{db: stdlib.OpenDB(*config, stdlib.OptionAfterConnect(scanTimestampsInUTC))}, nil
+}
+
+func (d *sqlDatabase) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	result, err := d.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return result, nil
+}
+
+func (d *sqlDatabase) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return sqlRows{Rows: rows}, nil
+}
+
+func (d *sqlDatabase) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return sqlRow{row: d.db.QueryRowContext(ctx, query, args...)}
+}
+
+func (d *sqlDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &sqlTx{tx: tx}, nil
+}
+
+func (d *sqlDatabase) Conn(ctx context.Context) (Conn, error) {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &sqlConn{conn: conn}, nil
+}
+
+func (d *sqlDatabase) PingContext(ctx context.Context) error {
+	return classifyError(d.db.PingContext(ctx))
+}
+
+func (d *sqlDatabase) Close() {
+	d.db.Close()
+}
+
+// sqlTx adapts *sql.Tx to the Tx interface.
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqlTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	result, err := t.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return result, nil
+}
+
+func (t *sqlTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := t.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return sqlRows{Rows: rows}, nil
+}
+
+func (t *sqlTx) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return sqlRow{row: t.tx.QueryRowContext(ctx, query, args...)}
+}
+
+func (t *sqlTx) Commit() error {
+	return classifyError(t.tx.Commit())
+}
+
+func (t *sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// sqlConn adapts *sql.Conn to the Conn interface.
+type sqlConn struct {
+	conn *sql.Conn
+}
+
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	result, err := c.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return result, nil
+}
+
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := c.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return sqlRows{Rows: rows}, nil
+}
+
+func (c *sqlConn) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return sqlRow{row: c.conn.QueryRowContext(ctx, query, args...)}
+}
+
+// Release returns the connection to the pool. A discarded connection is reported to database/sql as bad,
+// which closes it instead.
+func (c *sqlConn) Release(discard bool) {
+	if discard {
+		c.conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	c.conn.Close()
+}
+
+// sqlRows adapts *sql.Rows to the Rows interface, classifying the error that ended the iteration.
+type sqlRows struct {
+	*sql.Rows
+}
+
+func (r sqlRows) Err() error {
+	return classifyError(r.Rows.Err())
+}
+
+// sqlRow adapts *sql.Row to the Row interface, classifying connection errors.
+type sqlRow struct {
+	row *sql.Row
+}
+
+func (r sqlRow) Scan(dest ...any) error {
+	return classifyError(r.row.Scan(dest...))
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	// getCoinDistributionQuery computes the Gini coefficient of the balances from their ascending ranks i:
+	// G = 2 * sum(i * x_i) / (n * sum(x_i)) - (n + 1) / n, which is 0 when all users hold the same balance.
+	getCoinDistributionQuery = `
+	WITH ranked AS (
+		SELECT coins, ROW_NUMBER() OVER (ORDER BY coins) AS rank FROM content.users
+	)
+	SELECT COUNT(*), COALESCE(SUM(coins), 0)::bigint,
+		CASE WHEN COALESCE(SUM(coins), 0) = 0 THEN 0
+			ELSE 2.0 * SUM(rank * coins) / (COUNT(*) * SUM(coins)) - (COUNT(*) + 1.0) / COUNT(*)
+		END::float8
+	FROM ranked;`
+	getDailyCoinVolumesQuery = `
+	WITH days AS (
+		SELECT generate_series($1::date::timestamp, ($2::date - 1)::timestamp, INTERVAL '1 day')::date AS day
+	), transfers AS (
+		SELECT (created_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count, SUM(amount) AS volume
+		FROM content.all_coin_transfers
+		WHERE created_at >= $1::date::timestamp AT TIME ZONE 'UTC' AND created_at < $2::date::timestamp AT TIME ZONE 'UTC'
+		GROUP BY 1
+	), purchases AS (
+		SELECT (p.created_at AT TIME ZONE 'UTC')::date AS day, SUM(p.quantity) AS count, SUM(p.quantity * p.price) AS volume
+		FROM content.merch_purchases p
+		WHERE p.created_at >= $1::date::timestamp AT TIME ZONE 'UTC' AND p.created_at < $2::date::timestamp AT TIME ZONE 'UTC'
+		GROUP BY 1
+	)
+	SELECT to_char(d.day, 'YYYY-MM-DD'), COALESCE(t.count, 0), COALESCE(t.volume, 0), COALESCE(p.count, 0), COALESCE(p.volume, 0)
+	FROM days d LEFT JOIN transfers t ON t.day = d.day LEFT JOIN purchases p ON p.day = d.day
+	ORDER BY d.day;`
+)
+
+// GetEconomyStats computes the health of the coin economy: the coins held by all users and how evenly they are
+// spread, as of now, and the number and volume of transfers and purchases on every UTC day in [from, to), including
+// days without any. Transfer volumes include the compensating transfers of reversals; purchase volumes count gifts
+// and are valued at the prices the items were bought at.
+func (postgresql *PostgreSQL) GetEconomyStats(ctx context.Context, from time.Time, to time.Time) (*models.EconomyStats, error) {
+	stats := &models.EconomyStats{Days: []models.EconomyDay{}}
+
+	err := postgresql.db.QueryRowContext(ctx, getCoinDistributionQuery).Scan(&stats.Users, &stats.CoinsInCirculation, &stats.Gini)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetEconomyStats", err, zap.String("query", "getCoinDistributionQuery"))
+		return nil, err
+	}
+
+	rows, err := postgresql.db.QueryContext(ctx, getDailyCoinVolumesQuery, from, to)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetEconomyStats", err, zap.String("query", "getDailyCoinVolumesQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day models.EconomyDay
+		if err = rows.Scan(&day.Date, &day.Transfers, &day.TransferVolume, &day.Purchases, &day.PurchaseVolume); err != nil {
+			postgresql.logQueryError(ctx, "GetEconomyStats", err, zap.String("query", "getDailyCoinVolumesQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+		stats.Days = append(stats.Days, day)
+	}
+
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetEconomyStats", err, zap.String("query", "getDailyCoinVolumesQuery"),
+			zap.String("stage", "rows"))
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/crypto"
+)
+
+// SetCipher encrypts the personal data stored from then on with c: the client IPs of the API activity and the user
+// agents of the sessions. A nil c, the default, stores them in plaintext. Values stored in plaintext, before
+// encryption was enabled, read as they are either way.
+func (postgresql *PostgreSQL) SetCipher(c *crypto.Cipher) {
+	postgresql.cipher = c
+}
+
+// decrypt returns a value read from an encrypted column in plaintext. A value that cannot be decrypted, typically
+// one encrypted under a key since removed from the configuration, is logged with fields identifying its row and read
+// as empty, so that a single such row does not fail the whole listing it belongs to.
+func (postgresql *PostgreSQL) decrypt(ctx context.Context, op string, value string, fields ...zap.Field) string {
+	plaintext, err := postgresql.cipher.Decrypt(value)
+	if err != nil {
+		postgresql.logQueryError(ctx, op, err, append([]zap.Field{zap.String("stage", "decrypt")}, fields...)...)
+		return ""
+	}
+	return plaintext
+}
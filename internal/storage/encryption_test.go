@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/crypto"
+	"merch_store/internal/pkg/logger"
+)
+
+// activityDatabase is a fakeDatabase keeping the IP column of the recorded API activity, as written, and returning
+// it from activity queries.
+type activityDatabase struct {
+	*fakeDatabase
+	ips []string
+}
+
+func (d *activityDatabase) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	d.ips = append(d.ips, args[4].(string))
+	return affectedResult(1), nil
+}
+
+func (d *activityDatabase) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	return &ipRows{ips: d.ips}, nil
+}
+
+// ipRows returns a row of API activity for each of its IPs.
+type ipRows struct {
+	ips  []string
+	next int
+}
+
+func (rows *ipRows) Next() bool {
+	rows.next++
+	return rows.next <= len(rows.ips)
+}
+
+func (rows *ipRows) Scan(dest ...any) error {
+	*dest[0].(*int64) = int64(rows.next)
+	*dest[1].(*string) = "GET /api/info"
+	*dest[2].(*string) = "/api/info"
+	*dest[3].(*int) = 200
+	*dest[4].(*string) = rows.ips[rows.next-1]
+	*dest[5].(*time.Time) = time.Now()
+	return nil
+}
+
+func (rows *ipRows) Err() error   { return nil }
+func (rows *ipRows) Close() error { return nil }
+
+func newActivityPostgreSQL() (*PostgreSQL, *activityDatabase) {
+	postgresql, db := newFakePostgreSQL()
+	activity := &activityDatabase{fakeDatabase: db}
+	postgresql.db = activity
+	return postgresql, activity
+}
+
+func testCipher(t *testing.T, keys string) *crypto.Cipher {
+	c, err := crypto.ParseKeys(keys)
+	require.NoError(t, err)
+	return c
+}
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func activityIPs(t *testing.T, postgresql *PostgreSQL) []string {
+	activity, err := postgresql.GetUserActivity(context.Background(), 1, models.ActivityFilter{Limit: 10})
+	require.NoError(t, err)
+
+	var ips []string
+	for _, entry := range activity {
+		ips = append(ips, entry.IP)
+	}
+	return ips
+}
+
+func TestAPIActivity_Encryption(t *testing.T) {
+	ctx := context.Background()
+	record := func(t *testing.T, postgresql *PostgreSQL, ip string) {
+		require.NoError(t, postgresql.RecordAPIActivity(ctx, models.APIActivity{UserID: 1, IP: ip}))
+	}
+
+	t.Run("Encrypted at rest", func(t *testing.T) {
+		postgresql, db := newActivityPostgreSQL()
+		postgresql.SetCipher(testCipher(t, "k1:"+testKey(1)))
+
+		record(t, postgresql, "203.0.113.7")
+		require.Len(t, db.ips, 1)
+		assert.True(t, strings.HasPrefix(db.ips[0], "enc:k1:"), db.ips[0])
+		assert.NotContains(t, db.ips[0], "203.0.113.7")
+
+		assert.Equal(t, []string{"203.0.113.7"}, activityIPs(t, postgresql))
+	})
+
+	t.Run("Plaintext without keys", func(t *testing.T) {
+		postgresql, db := newActivityPostgreSQL()
+
+		record(t, postgresql, "203.0.113.7")
+		assert.Equal(t, []string{"203.0.113.7"}, db.ips)
+		assert.Equal(t, []string{"203.0.113.7"}, activityIPs(t, postgresql))
+	})
+
+	t.Run("Plaintext rows read after encryption is enabled", func(t *testing.T) {
+		postgresql, _ := newActivityPostgreSQL()
+		record(t, postgresql, "198.51.100.1")
+
+		postgresql.SetCipher(testCipher(t, "k1:"+testKey(1)))
+		record(t, postgresql, "203.0.113.7")
+
+		assert.Equal(t, []string{"198.51.100.1", "203.0.113.7"}, activityIPs(t, postgresql))
+	})
+
+	t.Run("Rows under a retired key read", func(t *testing.T) {
+		postgresql, _ := newActivityPostgreSQL()
+		postgresql.SetCipher(testCipher(t, "k1:"+testKey(1)))
+		record(t, postgresql, "198.51.100.1")
+
+		postgresql.SetCipher(testCipher(t, "k2:"+testKey(2)+",k1:"+testKey(1)))
+		record(t, postgresql, "203.0.113.7")
+
+		assert.Equal(t, []string{"198.51.100.1", "203.0.113.7"}, activityIPs(t, postgresql))
+	})
+
+	t.Run("Rows under an unknown key read empty", func(t *testing.T) {
+		postgresql, _ := newActivityPostgreSQL()
+		core, logs := observer.New(zapcore.ErrorLevel)
+		postgresql.log = &logger.Logger{Logger: zap.New(core)}
+		postgresql.SetCipher(testCipher(t, "k1:"+testKey(1)))
+		record(t, postgresql, "198.51.100.1")
+
+		postgresql.SetCipher(testCipher(t, "k2:"+testKey(2)))
+		record(t, postgresql, "203.0.113.7")
+		record(t, postgresql, "203.0.113.8")
+
+		assert.Equal(t, []string{"", "203.0.113.7", "203.0.113.8"}, activityIPs(t, postgresql),
+			"a row under a removed key must not hide the others")
+
+		entries := logs.FilterField(zap.String("stage", "decrypt")).All()
+		require.Len(t, entries, 1)
+		assert.Equal(t, int64(1), entries[0].ContextMap()["activityID"])
+		assert.Contains(t, entries[0].ContextMap()["error"], crypto.ErrUnknownKey.Error())
+	})
+}
+
+// sessionDatabase is a scriptedDatabase keeping the user agent column of the created sessions, as written, and
+// returning it from session queries.
+type sessionDatabase struct {
+	*scriptedDatabase
+	userAgents []string
+}
+
+func (d *sessionDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.scriptedDatabase.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionTx{scriptedTx: tx.(*scriptedTx), db: d}, nil
+}
+
+func (d *sessionDatabase) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	return &userAgentRows{userAgents: d.userAgents}, nil
+}
+
+type sessionTx struct {
+	*scriptedTx
+	db *sessionDatabase
+}
+
+func (tx *sessionTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	if query == createSessionQuery {
+		tx.db.userAgents = append(tx.db.userAgents, args[2].(string))
+	}
+	return tx.scriptedTx.ExecContext(ctx, query, args...)
+}
+
+// userAgentRows returns an active session for each of its user agents.
+type userAgentRows struct {
+	userAgents []string
+	next       int
+}
+
+func (rows *userAgentRows) Next() bool {
+	rows.next++
+	return rows.next <= len(rows.userAgents)
+}
+
+func (rows *userAgentRows) Scan(dest ...any) error {
+	*dest[0].(*string) = fmt.Sprintf("session-%d", rows.next)
+	*dest[1].(*string) = rows.userAgents[rows.next-1]
+	*dest[2].(*time.Time) = time.Now()
+	*dest[3].(*time.Time) = time.Now().Add(time.Hour)
+	return nil
+}
+
+func (rows *userAgentRows) Err() error   { return nil }
+func (rows *userAgentRows) Close() error { return nil }
+
+func TestSessions_Encryption(t *testing.T) {
+	ctx := context.Background()
+	newSessionPostgreSQL := func() (*PostgreSQL, *sessionDatabase) {
+		postgresql, _ := newScriptedPostgreSQL(nil, func(string, []any) int64 { return 1 })
+		sessions := &sessionDatabase{scriptedDatabase: postgresql.db.(*scriptedDatabase)}
+		postgresql.db = sessions
+		return postgresql, sessions
+	}
+	create := func(t *testing.T, postgresql *PostgreSQL, userAgent string) {
+		require.NoError(t, postgresql.CreateSession(ctx, models.Session{ID: "jti", UserID: 1, UserAgent: userAgent}, 5))
+	}
+	userAgents := func(t *testing.T, postgresql *PostgreSQL) []string {
+		sessions, err := postgresql.GetActiveSessions(ctx, 1, time.Now())
+		require.NoError(t, err)
+
+		var userAgents []string
+		for _, session := range sessions {
+			userAgents = append(userAgents, session.UserAgent)
+		}
+		return userAgents
+	}
+
+	t.Run("Encrypted at rest", func(t *testing.T) {
+		postgresql, db := newSessionPostgreSQL()
+		postgresql.SetCipher(testCipher(t, "k1:"+testKey(1)))
+
+		create(t, postgresql, "curl/8.0")
+		require.Len(t, db.userAgents, 1)
+		assert.True(t, strings.HasPrefix(db.userAgents[0], "enc:k1:"), db.userAgents[0])
+		assert.NotContains(t, db.userAgents[0], "curl")
+
+		assert.Equal(t, []string{"curl/8.0"}, userAgents(t, postgresql))
+	})
+
+	t.Run("Plaintext and unknown key rows", func(t *testing.T) {
+		postgresql, db := newSessionPostgreSQL()
+		create(t, postgresql, "plaintext/1.0")
+		assert.Equal(t, []string{"plaintext/1.0"}, db.userAgents)
+
+		postgresql.SetCipher(testCipher(t, "k1:"+testKey(1)))
+		create(t, postgresql, "removed/1.0")
+		postgresql.SetCipher(testCipher(t, "k2:"+testKey(2)))
+		create(t, postgresql, "curl/8.0")
+
+		assert.Equal(t, []string{"plaintext/1.0", "", "curl/8.0"}, userAgents(t, postgresql))
+	})
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+// Sections of a user data export, in the order StreamUserExport passes their records.
+const (
+	ExportSectionAccount            = "account"
+	ExportSectionPurchases          = "purchases"
+	ExportSectionTransfers          = "transfers"
+	ExportSectionScheduledTransfers = "scheduledTransfers"
+	ExportSectionAccruals           = "accruals"
+	ExportSectionFailedPurchases    = "failedPurchases"
+	ExportSectionSessions           = "sessions"
+	ExportSectionActivity           = "activity"
+)
+
+// ExportSections lists the sections of a user data export in order. The account section holds a single
+// *models.AccountExport; every other section is a list of records.
+var ExportSections = []string{
+	ExportSectionAccount,
+	ExportSectionPurchases,
+	ExportSectionTransfers,
+	ExportSectionScheduledTransfers,
+	ExportSectionAccruals,
+	ExportSectionFailedPurchases,
+	ExportSectionSessions,
+	ExportSectionActivity,
+}
+
+const (
+	reserveDataExportQuery     = `INSERT INTO content.data_exports (user_id, exported_at) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET exported_at = EXCLUDED.exported_at WHERE content.data_exports.exported_at <= $3 RETURNING exported_at;`
+	getDataExportQuery         = `SELECT exported_at FROM content.data_exports WHERE user_id = $1;`
+	exportAccountQuery         = `SELECT id, username, coins, is_active, is_admin, created_at, updated_at FROM content.users WHERE id = $1;`
+	exportPurchasesQuery       = `SELECT p.id, m.merch_name, p.quantity, p.fulfilled_quantity, CASE WHEN p.user_id = $1 THEN COALESCE(g.username, '') ELSE '' END, CASE WHEN p.user_id = $1 THEN '' ELSE o.username END, p.created_at FROM content.merch_purchases p JOIN content.merch m ON m.id = p.merch_id JOIN content.users o ON o.id = p.user_id LEFT JOIN content.users g ON g.id = p.gifted_by WHERE p.user_id = $1 OR p.gifted_by = $1 ORDER BY p.created_at, p.id;`
+	exportTransfersQuery       = `SELECT t.id, f.username, r.username, t.amount, t.created_at FROM content.all_coin_transfers t JOIN content.users f ON f.id = t.from_user_id JOIN content.users r ON r.id = t.to_user_id WHERE t.from_user_id = $1 OR t.to_user_id = $1 ORDER BY t.created_at, t.id;`
+	exportAccrualsQuery        = `SELECT to_char(period, 'YYYY-MM'), amount, created_at FROM content.coin_accrual_entries WHERE user_id = $1 ORDER BY period;`
+	exportFailedPurchasesQuery = `SELECT item_name, reason, created_at FROM content.failed_purchases WHERE user_id = $1 ORDER BY created_at, id;`
+	exportSessionsQuery        = `SELECT jti, user_agent, issued_at, expires_at, revoked_at FROM content.sessions WHERE user_id = $1 ORDER BY issued_at, id;`
+	exportActivityQuery        = `SELECT id, action, path, status, ip, created_at FROM content.api_activity WHERE user_id = $1 ORDER BY created_at, id;`
+)
+
+// ErrDataExportTooSoon indicates that the user has already exported their data within the allowed interval.
+var ErrDataExportTooSoon = errors.New("storage: data export requested too soon")
+
+// ReserveDataExport records a data export of the user at now unless the previous one was less than interval ago.
+// It returns the time from which the next export is allowed, together with ErrDataExportTooSoon when this one is not.
+// The check and the update are a single statement, so concurrent requests of the same user cannot both pass.
+func (postgresql *PostgreSQL) ReserveDataExport(ctx context.Context, userID int32, now time.Time, interval time.Duration) (time.Time, error) {
+	var exportedAt time.Time
+	err := postgresql.db.QueryRowContext(ctx, reserveDataExportQuery, userID, now, now.Add(-interval)).Scan(&exportedAt)
+	if err == nil {
+		return exportedAt.Add(interval), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		postgresql.logQueryError(ctx, "ReserveDataExport", err, zap.String("query", "reserveDataExportQuery"),
+			zap.Int32("userID", userID))
+		return time.Time{}, err
+	}
+
+	if err = postgresql.db.QueryRowContext(ctx, getDataExportQuery, userID).Scan(&exportedAt); err != nil {
+		postgresql.logQueryError(ctx, "ReserveDataExport", err, zap.String("query", "getDataExportQuery"),
+			zap.Int32("userID", userID))
+		return time.Time{}, err
+	}
+	return exportedAt.Add(interval), ErrDataExportTooSoon
+}
+
+// StreamUserExport passes everything stored about the user to fn, section by section in the order of ExportSections:
+// the account record, the purchases made by or for the user, the transfers sent and received, the scheduled transfers,
+// the monthly accruals, the failed purchase attempts, the sessions, and the API activity. Within a section records are oldest first.
+// Sections without records are skipped. All sections are read from a single snapshot, and rows are scanned one
+// at a time, so memory usage does not depend on the size of the history. The password hash is never exported.
+// It returns ErrUserNotFound when the user does not exist, and stops at the first error returned by fn.
+func (postgresql *PostgreSQL) StreamUserExport(ctx context.Context, userID int32, fn func(section string, record any) error) error {
+	tx, err := postgresql.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	account := &models.AccountExport{}
+	err = tx.QueryRowContext(ctx, exportAccountQuery, userID).Scan(&account.ID, &account.Username, &account.Coins,
+		&account.IsActive, &account.IsAdmin, &account.CreatedAt, &account.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "StreamUserExport", err, zap.String("query", "exportAccountQuery"),
+			zap.Int32("userID", userID))
+		return err
+	}
+	if err = fn(ExportSectionAccount, account); err != nil {
+		return err
+	}
+
+	sections := []struct {
+		name  string
+		query string
+		scan  func(rows Rows) (any, error)
+	}{
+		{ExportSectionPurchases, exportPurchasesQuery, func(rows Rows) (any, error) {
+			purchase := models.PurchaseExport{}
+			err := rows.Scan(&purchase.ID, &purchase.Item, &purchase.Quantity, &purchase.FulfilledQuantity,
+				&purchase.GiftedBy, &purchase.GiftedTo, &purchase.CreatedAt)
+			return purchase, err
+		}},
+		{ExportSectionTransfers, exportTransfersQuery, func(rows Rows) (any, error) {
+			transfer := models.Transfer{}
+			err := rows.Scan(&transfer.ID, &transfer.FromUser, &transfer.ToUser, &transfer.Amount, &transfer.CreatedAt)
+			return transfer, err
+		}},
+		{ExportSectionScheduledTransfers, getScheduledTransfersQuery, func(rows Rows) (any, error) {
+			scheduled := models.ScheduledTransfer{FromUserID: userID}
+			err := rows.Scan(&scheduled.ID, &scheduled.ToUser, &scheduled.Amount, &scheduled.ExecuteAt, &scheduled.Status,
+				&scheduled.TransferID, &scheduled.FailureReason, &scheduled.CreatedAt)
+			return scheduled, err
+		}},
+		{ExportSectionAccruals, exportAccrualsQuery, func(rows Rows) (any, error) {
+			accrual := models.AccrualExport{}
+			err := rows.Scan(&accrual.Period, &accrual.Amount, &accrual.CreatedAt)
+			return accrual, err
+		}},
+		{ExportSectionFailedPurchases, exportFailedPurchasesQuery, func(rows Rows) (any, error) {
+			purchase := models.FailedPurchase{UserID: userID}
+			err := rows.Scan(&purchase.ItemName, &purchase.Reason, &purchase.CreatedAt)
+			return purchase, err
+		}},
+		{ExportSectionSessions, exportSessionsQuery, func(rows Rows) (any, error) {
+			session := models.SessionExport{}
+			var revokedAt sql.NullTime
+			if err := rows.Scan(&session.ID, &session.UserAgent, &session.IssuedAt, &session.ExpiresAt, &revokedAt); err != nil {
+				return nil, err
+			}
+			session.UserAgent = postgresql.decrypt(ctx, "StreamUserExport", session.UserAgent, zap.String("sessionID", session.ID), zap.Int32("userID", userID))
+			if revokedAt.Valid {
+				session.RevokedAt = &revokedAt.Time
+			}
+			return session, nil
+		}},
+		{ExportSectionActivity, exportActivityQuery, func(rows Rows) (any, error) {
+			activity := models.APIActivity{UserID: userID}
+			if err := rows.Scan(&activity.ID, &activity.Action, &activity.Path, &activity.Status, &activity.IP, &activity.CreatedAt); err != nil {
+				return nil, err
+			}
+			activity.IP = postgresql.decrypt(ctx, "StreamUserExport", activity.IP, zap.Int64("activityID", activity.ID), zap.Int32("userID", userID))
+			return activity, nil
+		}},
+	}
+
+	for _, section := range sections {
+		err := postgresql.streamExportSection(ctx, tx, userID, section.name, section.query, section.scan, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// streamExportSection passes every row of the section's query to fn as scanned by scan.
+func (postgresql *PostgreSQL) streamExportSection(ctx context.Context, tx Tx, userID int32, section string, query string,
+	scan func(rows Rows) (any, error), fn func(section string, record any) error) error {
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "streamExportSection", err, zap.String("section", section), zap.Int32("userID", userID))
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			postgresql.logQueryError(ctx, "streamExportSection", err, zap.String("section", section),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return err
+		}
+
+		if err := fn(section, record); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "streamExportSection", err, zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+// Reasons of failed purchases.
+const (
+	FailedPurchaseReasonInsufficientFunds = "insufficient_funds"
+	FailedPurchaseReasonItemNotFound      = "item_not_found"
+)
+
+const (
+	recordFailedPurchaseQuery   = `INSERT INTO content.failed_purchases (user_id, item_name, reason, created_at) VALUES ($1, $2, $3, $4);`
+	getFailedPurchaseStatsQuery = `SELECT item_name, reason, COUNT(*) FROM content.failed_purchases WHERE created_at >= $1 AND created_at < $2 GROUP BY item_name, reason ORDER BY COUNT(*) DESC, item_name, reason;`
+)
+
+// RecordFailedPurchase stores a failed purchase attempt for demand analytics.
+// CreatedAt is the time of the attempt, which precedes the write when purchases are recorded asynchronously.
+func (postgresql *PostgreSQL) RecordFailedPurchase(ctx context.Context, purchase models.FailedPurchase) error {
+	_, err := postgresql.db.ExecContext(ctx, recordFailedPurchaseQuery, purchase.UserID, purchase.ItemName, purchase.Reason, purchase.CreatedAt)
+	if err != nil {
+		postgresql.logQueryError(ctx, "RecordFailedPurchase", err, zap.String("query", "recordFailedPurchaseQuery"))
+		return err
+	}
+
+	return nil
+}
+
+// GetFailedPurchaseStats counts the failed purchases recorded in [from, to), grouped by item and reason,
+// most frequent first.
+func (postgresql *PostgreSQL) GetFailedPurchaseStats(ctx context.Context, from time.Time, to time.Time) ([]models.FailedPurchaseStat, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getFailedPurchaseStatsQuery, from, to)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetFailedPurchaseStats", err, zap.String("query", "getFailedPurchaseStatsQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.FailedPurchaseStat{}
+	for rows.Next() {
+		var stat models.FailedPurchaseStat
+		if err = rows.Scan(&stat.Item, &stat.Reason, &stat.Count); err != nil {
+			postgresql.logQueryError(ctx, "GetFailedPurchaseStats", err,
+				zap.String("query", "getFailedPurchaseStatsQuery"), zap.String("stage", "scan"))
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetFailedPurchaseStats", err, zap.String("query", "getFailedPurchaseStatsQuery"),
+			zap.String("stage", "rows"))
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+// Statuses of a coin hold.
+const (
+	HoldStatusActive   = "active"
+	HoldStatusReleased = "released"
+	HoldStatusCaptured = "captured"
+)
+
+const (
+	lockAvailableCoinsQuery = `SELECT u.coins - COALESCE((SELECT SUM(h.amount) FROM content.coin_holds h WHERE h.user_id = u.id AND h.status = 'active'), 0) FROM content.users u WHERE u.id = $1 FOR UPDATE OF u;`
+	getActiveHoldsQuery     = `SELECT COALESCE(SUM(amount), 0) FROM content.coin_holds WHERE user_id = $1 AND status = 'active';`
+	createHoldQuery         = `INSERT INTO content.coin_holds (user_id, amount, reason) VALUES ($1, $2, $3) RETURNING id, created_at;`
+	releaseHoldQuery        = `UPDATE content.coin_holds SET status = 'released', resolved_at = NOW() WHERE id = $1 AND status = 'active';`
+	lockHoldQuery           = `SELECT user_id, amount, reason, created_at FROM content.coin_holds WHERE id = $1 AND status = 'active' FOR UPDATE;`
+	captureHoldQuery        = `UPDATE content.coin_holds SET status = 'captured', resolved_at = NOW() WHERE id = $1;`
+)
+
+// Predefined errors for balance and hold operations.
+var (
+	// ErrInsufficientFunds indicates that the user's available balance (coins minus active holds) is too low.
+	ErrInsufficientFunds = errors.New("storage: insufficient funds")
+	// ErrHoldNotActive indicates that the hold does not exist or has already been released or captured.
+	ErrHoldNotActive = errors.New("storage: hold not found or not active")
+)
+
+// ensureAvailableCoins locks the user's row and verifies that the available balance covers amount.
+// Every balance-decreasing operation calls it first, so holds and spends of the same user are serialized.
+func (postgresql *PostgreSQL) ensureAvailableCoins(ctx context.Context, tx Tx, userID int32, amount int) error {
+	var available int64
+	err := postgresql.querier(ctx, tx).QueryRowContext(ctx, lockAvailableCoinsQuery, userID).Scan(&available)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "ensureAvailableCoins", err, zap.String("query", "lockAvailableCoinsQuery"),
+			zap.Int32("userID", userID), zap.Int("amount", amount))
+		return err
+	}
+
+	if available < int64(amount) {
+		return ErrInsufficientFunds
+	}
+
+	return nil
+}
+
+// GetActiveHoldsAmount returns the total amount of coins reserved by the user's active holds.
+func (postgresql *PostgreSQL) GetActiveHoldsAmount(ctx context.Context, tx Tx, userID int32) (int, error) {
+	var amount int
+	err := postgresql.querier(ctx, tx).QueryRowContext(ctx, getActiveHoldsQuery, userID).Scan(&amount)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetActiveHoldsAmount", err, zap.String("query", "getActiveHoldsQuery"),
+			zap.Int32("userID", userID))
+		return 0, err
+	}
+
+	return amount, nil
+}
+
+// CreateHold reserves amount coins of the user without spending them.
+// It fails with ErrInsufficientFunds when the available balance does not cover the hold.
+func (postgresql *PostgreSQL) CreateHold(ctx context.Context, userID int32, amount int, reason string) (*models.CoinHold, error) {
+	hold := &models.CoinHold{UserID: userID, Amount: amount, Reason: reason, Status: HoldStatusActive}
+
+	err := postgresql.inTransaction(ctx, "CreateHold", func(ctx context.Context) error {
+		if err := postgresql.ensureAvailableCoins(ctx, nil, userID, amount); err != nil {
+			return err
+		}
+
+		err := postgresql.querier(ctx, nil).QueryRowContext(ctx, createHoldQuery, userID, amount, reason).Scan(&hold.ID, &hold.CreatedAt)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateHold", err, zap.String("query", "createHoldQuery"),
+				zap.Int32("userID", userID), zap.Int("amount", amount))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// ReleaseHold cancels an active hold, making its coins available again.
+func (postgresql *PostgreSQL) ReleaseHold(ctx context.Context, holdID int64) error {
+	result, err := postgresql.db.ExecContext(ctx, releaseHoldQuery, holdID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "ReleaseHold", err, zap.String("query", "releaseHoldQuery"), zap.Int64("holdID", holdID))
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "ReleaseHold", err, zap.String("query", "releaseHoldQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int64("holdID", holdID))
+		return err
+	}
+	if rows == 0 {
+		return ErrHoldNotActive
+	}
+
+	return nil
+}
+
+// CaptureHold spends the coins reserved by an active hold: the user's balance is decreased by the hold amount
+// and the hold is marked as captured, both within one transaction.
+func (postgresql *PostgreSQL) CaptureHold(ctx context.Context, holdID int64) (*models.CoinHold, error) {
+	hold := &models.CoinHold{ID: holdID, Status: HoldStatusCaptured}
+
+	err := postgresql.inTransaction(ctx, "CaptureHold", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		err := q.QueryRowContext(ctx, lockHoldQuery, holdID).Scan(&hold.UserID, &hold.Amount, &hold.Reason, &hold.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrHoldNotActive
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "CaptureHold", err, zap.String("query", "lockHoldQuery"), zap.Int64("holdID", holdID))
+			return err
+		}
+
+		if err = postgresql.UpdateUserCoins(ctx, nil, hold.UserID, -int64(hold.Amount)); err != nil {
+			return err
+		}
+
+		if _, err = q.ExecContext(ctx, captureHoldQuery, holdID); err != nil {
+			postgresql.logQueryError(ctx, "CaptureHold", err, zap.String("query", "captureHoldQuery"),
+				zap.Int64("holdID", holdID))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
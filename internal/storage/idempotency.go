@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	claimIdempotencyKeyQuery    = `INSERT INTO content.idempotency_keys (user_id, idempotency_key, fingerprint, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, idempotency_key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status_code = 0, body = NULL, created_at = EXCLUDED.created_at WHERE content.idempotency_keys.created_at <= $5 RETURNING created_at;`
+	getIdempotentResponseQuery  = `SELECT fingerprint, status_code, body FROM content.idempotency_keys WHERE user_id = $1 AND idempotency_key = $2;`
+	saveIdempotentResponseQuery = `UPDATE content.idempotency_keys SET status_code = $3, body = $4 WHERE user_id = $1 AND idempotency_key = $2;`
+)
+
+// ClaimIdempotencyKey claims the idempotency key of the user at now for the request with the fingerprint, replacing
+// a claim made no later than expiredAt. It returns nil when the key is claimed, and the stored response otherwise.
+// Called within WithinTransaction, the claim holds the key until the transaction ends: a concurrent claim of the same
+// key waits for it, and gets the response saved by SaveIdempotentResponse if the transaction commits.
+func (postgresql *PostgreSQL) ClaimIdempotencyKey(ctx context.Context, userID int32, key string, fingerprint string, now time.Time, expiredAt time.Time) (*models.IdempotentResponse, error) {
+	querier := postgresql.querier(ctx, nil)
+
+	var claimedAt time.Time
+	err := querier.QueryRowContext(ctx, claimIdempotencyKeyQuery, userID, key, fingerprint, now, expiredAt).Scan(&claimedAt)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		postgresql.logQueryError(ctx, "ClaimIdempotencyKey", err, zap.String("query", "claimIdempotencyKeyQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	response := &models.IdempotentResponse{}
+	err = querier.QueryRowContext(ctx, getIdempotentResponseQuery, userID, key).Scan(&response.Fingerprint, &response.StatusCode, &response.Body)
+	if err != nil {
+		postgresql.logQueryError(ctx, "ClaimIdempotencyKey", err, zap.String("query", "getIdempotentResponseQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+	return response, nil
+}
+
+// SaveIdempotentResponse stores the response to the request for which the user claimed the idempotency key,
+// to be returned by later claims of the key.
+func (postgresql *PostgreSQL) SaveIdempotentResponse(ctx context.Context, userID int32, key string, response models.IdempotentResponse) error {
+	_, err := postgresql.querier(ctx, nil).ExecContext(ctx, saveIdempotentResponseQuery, userID, key, response.StatusCode, response.Body)
+	if err != nil {
+		postgresql.logQueryError(ctx, "SaveIdempotentResponse", err, zap.String("query", "saveIdempotentResponseQuery"),
+			zap.Int32("userID", userID))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+)
+
+// snapshotDatabase is a fakeDatabase whose transactions answer single-row queries like slowRow, return no rows
+// for multi-row queries, and fail to commit with commitErr. It remembers the options of the last transaction.
+type snapshotDatabase struct {
+	*fakeDatabase
+	commitErr error
+	opts      *sql.TxOptions
+}
+
+func (d *snapshotDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	d.events = append(d.events, "begin")
+	d.opts = opts
+	return &snapshotTx{fakeTx: fakeTx{db: d.fakeDatabase}, commitErr: d.commitErr}, nil
+}
+
+// snapshotTx records its queries and answers them as described by snapshotDatabase.
+type snapshotTx struct {
+	fakeTx
+	commitErr error
+}
+
+func (tx *snapshotTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	tx.db.events = append(tx.db.events, "tx: "+query)
+	return emptyRows{}, nil
+}
+
+func (tx *snapshotTx) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	tx.db.events = append(tx.db.events, "tx: "+query)
+	return slowRow{}
+}
+
+func (tx *snapshotTx) Commit() error {
+	if tx.commitErr != nil {
+		tx.db.events = append(tx.db.events, "commit failed")
+		return tx.commitErr
+	}
+	return tx.fakeTx.Commit()
+}
+
+// emptyRows is the result of a query that selected no rows.
+type emptyRows struct{}
+
+func (emptyRows) Next() bool             { return false }
+func (emptyRows) Scan(dest ...any) error { return sql.ErrNoRows }
+func (emptyRows) Err() error             { return nil }
+func (emptyRows) Close() error           { return nil }
+
+func TestGetInfo_Snapshot(t *testing.T) {
+	postgresql, db := newFakePostgreSQL()
+	snapshot := &snapshotDatabase{fakeDatabase: db}
+	postgresql.db = snapshot
+
+	info, err := postgresql.GetInfo(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), info.Coins)
+	assert.Equal(t, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, snapshot.opts,
+		"all queries must read from a single snapshot")
+	assert.Equal(t, "commit", db.events[len(db.events)-1])
+}
+
+func TestGetInfoWithHistoryLimit_Snapshot(t *testing.T) {
+	postgresql, db := newFakePostgreSQL()
+	snapshot := &snapshotDatabase{fakeDatabase: db}
+	postgresql.db = snapshot
+
+	info, err := postgresql.GetInfoWithHistoryLimit(context.Background(), 1, 100)
+	require.NoError(t, err)
+	assert.Contains(t, db.events, "tx: "+countCoinHistoryQuery, "the totals must come from the snapshot of the history")
+	assert.Equal(t, int64(1), info.TotalSent)
+	assert.Equal(t, int64(1), info.TotalReceived)
+	assert.True(t, info.Truncated, "the totals exceed the transfers returned")
+	assert.Equal(t, "commit", db.events[len(db.events)-1])
+
+	info, err = postgresql.GetInfo(context.Background(), 1)
+	require.NoError(t, err)
+	assert.False(t, info.Truncated)
+	assert.Zero(t, info.TotalSent)
+}
+
+func TestGetInfo_CommitFails(t *testing.T) {
+	postgresql, db := newFakePostgreSQL()
+	commitErr := errors.New("connection reset by peer")
+	postgresql.db = &snapshotDatabase{fakeDatabase: db, commitErr: commitErr}
+
+	info, err := postgresql.GetInfo(context.Background(), 1)
+	assert.ErrorIs(t, err, commitErr)
+	assert.Nil(t, info, "a partially built response must not be returned")
+	assert.Contains(t, db.events, "commit failed")
+}
+
+// failingDatabase is a fakeDatabase answering pool queries like snapshotTx, except that the queries in failures
+// fail with their error. It is safe for concurrent use.
+type failingDatabase struct {
+	*fakeDatabase
+	failures map[string]error
+}
+
+func (d *failingDatabase) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	if err := d.failures[query]; err != nil {
+		return nil, err
+	}
+	return emptyRows{}, nil
+}
+
+func (d *failingDatabase) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	if err := d.failures[query]; err != nil {
+		return errRow{err: err}
+	}
+	return slowRow{}
+}
+
+// errRow is a single-row result failing with err.
+type errRow struct {
+	err error
+}
+
+func (row errRow) Scan(dest ...any) error { return row.err }
+
+func TestGetPartialInfo(t *testing.T) {
+	lockTimeout := errors.New("canceling statement due to lock timeout")
+
+	t.Run("Failed sections", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+		postgresql.db = &failingDatabase{fakeDatabase: db, failures: map[string]error{
+			getSendCoinsQuery:     lockTimeout,
+			getReceivedCoinsQuery: lockTimeout,
+		}}
+
+		info, err := postgresql.GetPartialInfo(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), info.Coins)
+		assert.Equal(t, []models.InventoryItem{}, info.Inventory, "sections that loaded must be returned")
+		assert.Equal(t, []models.GiftDetail{}, info.CoinHistory.Gifts)
+		assert.Nil(t, info.CoinHistory.Sent)
+		assert.Nil(t, info.CoinHistory.Received)
+		assert.Equal(t, []string{InfoSectionSent, InfoSectionReceived}, info.Warnings)
+		assert.Empty(t, db.events, "sections must not share a transaction that one failure would abort")
+	})
+
+	t.Run("All sections", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+		postgresql.db = &failingDatabase{fakeDatabase: db}
+
+		info, err := postgresql.GetPartialInfo(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Empty(t, info.Warnings)
+	})
+
+	for name, query := range map[string]string{"Failed balance": getUserInfoQuery, "Failed holds": getActiveHoldsQuery} {
+		t.Run(name, func(t *testing.T) {
+			postgresql, db := newFakePostgreSQL()
+			postgresql.db = &failingDatabase{fakeDatabase: db, failures: map[string]error{query: lockTimeout}}
+
+			info, err := postgresql.GetPartialInfo(context.Background(), 1)
+			assert.ErrorIs(t, err, lockTimeout)
+			assert.Nil(t, info)
+		})
+	}
+}
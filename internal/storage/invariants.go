@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	// getLedgerBalancesQuery returns every user's balance, what it should be according to the recorded operations,
+	// and the available balance. Purchases are charged to the buyer, who is the giver of a gift, at the price it was
+	// bought at; captured holds of scheduled transfers are already counted by the transfers they were captured for.
+	// Recipients are credited with the campaign bonuses of their transfers on top of the amounts. Archived transfers
+	// count like recent ones.
+	getLedgerBalancesQuery = `
+	SELECT u.id, u.coins,
+		(u.opening_coins
+			+ COALESCE((SELECT SUM(a.amount) FROM content.coin_accrual_entries a WHERE a.user_id = u.id), 0)
+			+ COALESCE((SELECT SUM(t.amount + t.bonus) FROM content.all_coin_transfers t WHERE t.to_user_id = u.id), 0)
+			- COALESCE((SELECT SUM(t.amount) FROM content.all_coin_transfers t WHERE t.from_user_id = u.id), 0)
+			- COALESCE((SELECT SUM(p.quantity * p.price) FROM content.merch_purchases p
+				WHERE COALESCE(p.gifted_by, p.user_id) = u.id), 0)
+			- COALESCE((SELECT SUM(h.amount) FROM content.coin_holds h WHERE h.user_id = u.id AND h.status = 'captured'
+				AND NOT EXISTS (SELECT 1 FROM content.scheduled_transfers s WHERE s.hold_id = h.id)), 0))::bigint,
+		(u.coins - COALESCE((SELECT SUM(h.amount) FROM content.coin_holds h WHERE h.user_id = u.id AND h.status = 'active'), 0))::bigint
+	FROM content.users u
+	ORDER BY u.id;`
+	// getTransferMismatchesQuery returns the transfers whose records disagree: reversals not sending coins back
+	// to the sender of the reversed transfer or sending back more than it moved, transfers marked as reversed without
+	// a reversal, reversal records differing from their compensating transfers, and completed scheduled transfers
+	// differing from the transfers they made, and campaigns whose spent budget differs from the bonuses they paid.
+	// Reversed transfers and reversals are never archived, so only the recent transfers are checked for reversals.
+	getTransferMismatchesQuery = `
+	SELECT 'content.coin_transfers', r.id, o.amount::bigint, r.amount::bigint, 'reversal does not send the coins of transfer ' || o.id || ' back to its sender'
+	FROM content.coin_transfers r JOIN content.coin_transfers o ON r.reversal_of = o.id
+	WHERE r.from_user_id <> o.to_user_id OR r.to_user_id <> o.from_user_id OR r.amount > o.amount
+	UNION ALL
+	SELECT 'content.coin_transfers', o.id, 1, 0, 'transfer is marked as reversed but has no reversal'
+	FROM content.coin_transfers o
+	WHERE o.reversed_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM content.coin_transfers r WHERE r.reversal_of = o.id)
+	UNION ALL
+	SELECT 'content.transfer_reversals', tr.transfer_id, tr.reversed_amount::bigint, r.amount::bigint, 'reversal record differs from compensating transfer ' || r.id
+	FROM content.transfer_reversals tr JOIN content.coin_transfers r ON tr.reversal_transfer_id = r.id
+	WHERE r.amount <> tr.reversed_amount OR r.reversal_of IS DISTINCT FROM tr.transfer_id
+	UNION ALL
+	SELECT 'content.scheduled_transfers', s.id, s.amount::bigint, COALESCE(t.amount, 0)::bigint, 'completed scheduled transfer differs from transfer ' || COALESCE(s.transfer_id::text, 'NULL')
+	FROM content.scheduled_transfers s LEFT JOIN content.all_coin_transfers t ON s.transfer_id = t.id
+	WHERE s.status = 'completed'
+		AND (t.id IS NULL OR t.amount <> s.amount OR t.from_user_id <> s.from_user_id OR t.to_user_id IS DISTINCT FROM s.to_user_id)
+	UNION ALL
+	SELECT 'content.gifting_campaigns', c.id, COALESCE(SUM(t.bonus), 0)::bigint, c.spent, 'campaign spent budget differs from the bonuses of its transfers'
+	FROM content.gifting_campaigns c LEFT JOIN content.all_coin_transfers t ON t.campaign_id = c.id
+	GROUP BY c.id, c.spent
+	HAVING c.spent <> COALESCE(SUM(t.bonus), 0)
+	ORDER BY 1, 2;`
+	// getUsernameCollisionsQuery returns the users whose username is not normalized or is shared by other users once
+	// normalized, with the normalized username and the number of users sharing it. Usernames have always been stored
+	// NFC-normalized and trimmed, so only their inner whitespace is normalized here.
+	getUsernameCollisionsQuery = `
+	SELECT id, username, normalized, accounts FROM (
+		SELECT id, username, normalized, COUNT(*) OVER (PARTITION BY normalized) AS accounts
+		FROM (SELECT id, username, btrim(regexp_replace(username, '\s+', ' ', 'g')) AS normalized FROM content.users) u
+	) c
+	WHERE accounts > 1 OR username <> normalized
+	ORDER BY normalized, id;`
+)
+
+// CheckInvariants checks the invariants of the coin economy on one snapshot of the database and reports every row
+// breaking them: users holding or reserving more coins than they have, balances differing from the opening balance
+// plus the accruals, transfers, and campaign bonuses received less the transfers sent, the purchases paid for, and
+// the holds captured, transfers and campaigns whose records disagree, inventory counts differing from the purchases they total,
+// and usernames that are unnormalized or collide once normalized. An empty list of violations means the economy is consistent. It scans all users, transfers, and purchases, so it is meant to be run
+// by administrators and scheduled jobs rather than on a request path.
+func (postgresql *PostgreSQL) CheckInvariants(ctx context.Context) (*models.InvariantReport, error) {
+	report := &models.InvariantReport{Violations: []models.InvariantViolation{}}
+
+	tx, err := postgresql.db.BeginTx(ctx, postgresql.readTxOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, getLedgerBalancesQuery)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getLedgerBalancesQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, coins, expected, available int64
+		if err = rows.Scan(&userID, &coins, &expected, &available); err != nil {
+			postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getLedgerBalancesQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+		report.TotalBalances += coins
+		report.TotalLedger += expected
+
+		if available < 0 {
+			report.Violations = append(report.Violations, models.InvariantViolation{
+				Invariant: models.InvariantNegativeBalance, Table: "content.users", RowID: userID, Expected: 0, Actual: available,
+				Detail: fmt.Sprintf("%d coins with %d reserved by active holds", coins, coins-available),
+			})
+		}
+		if coins != expected {
+			report.Violations = append(report.Violations, models.InvariantViolation{
+				Invariant: models.InvariantLedgerBalance, Table: "content.users", RowID: userID, Expected: expected, Actual: coins,
+				Detail: "balance differs from the recorded operations",
+			})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getLedgerBalancesQuery"),
+			zap.String("stage", "rows"))
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = tx.QueryContext(ctx, getTransferMismatchesQuery)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getTransferMismatchesQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		violation := models.InvariantViolation{Invariant: models.InvariantTransferBalance}
+		if err = rows.Scan(&violation.Table, &violation.RowID, &violation.Expected, &violation.Actual, &violation.Detail); err != nil {
+			postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getTransferMismatchesQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+		report.Violations = append(report.Violations, violation)
+	}
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getTransferMismatchesQuery"),
+			zap.String("stage", "rows"))
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = tx.QueryContext(ctx, inventoryDriftQuery)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "inventoryDriftQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var drift models.InventoryDrift
+		err = rows.Scan(&drift.UserID, &drift.Item, &drift.CountedQuantity, &drift.CountedFulfilled, &drift.ActualQuantity, &drift.ActualFulfilled)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "inventoryDriftQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+		report.Violations = append(report.Violations, models.InvariantViolation{
+			Invariant: models.InvariantPurchaseTotal, Table: "content.inventory_counts", RowID: int64(drift.UserID),
+			Expected: int64(drift.ActualQuantity), Actual: int64(drift.CountedQuantity),
+			Detail: fmt.Sprintf("%s: %d bought and %d fulfilled, %d counted and %d fulfilled", drift.Item,
+				drift.ActualQuantity, drift.ActualFulfilled, drift.CountedQuantity, drift.CountedFulfilled),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "inventoryDriftQuery"),
+			zap.String("stage", "rows"))
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = tx.QueryContext(ctx, getUsernameCollisionsQuery)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getUsernameCollisionsQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, accounts int64
+		var username, normalized string
+		if err = rows.Scan(&userID, &username, &normalized, &accounts); err != nil {
+			postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getUsernameCollisionsQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+
+		detail := fmt.Sprintf("username %q is not normalized and cannot sign in until renamed to %q", username, normalized)
+		if accounts > 1 {
+			detail = fmt.Sprintf("username %q is shared by %d users once normalized to %q", username, accounts, normalized)
+		}
+		report.Violations = append(report.Violations, models.InvariantViolation{
+			Invariant: models.InvariantUsername, Table: "content.users", RowID: userID, Expected: 1, Actual: accounts, Detail: detail,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "CheckInvariants", err, zap.String("query", "getUsernameCollisionsQuery"),
+			zap.String("stage", "rows"))
+		return nil, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+)
+
+const (
+	lockPendingPurchasesQuery = `SELECT mp.id, mp.quantity - mp.fulfilled_quantity FROM content.merch_purchases mp JOIN content.merch m ON mp.merch_id = m.id WHERE mp.user_id = $1 AND m.merch_name = $2 AND mp.fulfilled_quantity < mp.quantity ORDER BY mp.created_at, mp.id FOR UPDATE OF mp;`
+	fulfillPurchaseQuery      = `UPDATE content.merch_purchases SET fulfilled_quantity = fulfilled_quantity + $1 WHERE id = $2;`
+	getInventoryItemQuery     = `SELECT m.category, ic.quantity, ic.quantity - ic.fulfilled_quantity, ic.fulfilled_quantity FROM content.inventory_counts ic JOIN content.merch m ON ic.merch_id = m.id WHERE ic.user_id = $1 AND m.merch_name = $2;`
+
+	addInventoryCountQuery     = `INSERT INTO content.inventory_counts (user_id, merch_id, quantity) VALUES ($1, $2, $3) ON CONFLICT (user_id, merch_id) DO UPDATE SET quantity = content.inventory_counts.quantity + EXCLUDED.quantity;`
+	fulfillInventoryCountQuery = `UPDATE content.inventory_counts ic SET fulfilled_quantity = ic.fulfilled_quantity + $3 FROM content.merch m WHERE ic.merch_id = m.id AND ic.user_id = $1 AND m.merch_name = $2;`
+	inventoryDriftQuery        = `WITH actual AS (SELECT user_id, merch_id, SUM(quantity) AS quantity, SUM(fulfilled_quantity) AS fulfilled_quantity FROM content.merch_purchases GROUP BY user_id, merch_id) SELECT COALESCE(a.user_id, ic.user_id) AS user_id, m.merch_name, COALESCE(ic.quantity, 0), COALESCE(ic.fulfilled_quantity, 0), COALESCE(a.quantity, 0), COALESCE(a.fulfilled_quantity, 0) FROM actual a FULL JOIN content.inventory_counts ic ON ic.user_id = a.user_id AND ic.merch_id = a.merch_id JOIN content.merch m ON m.id = COALESCE(a.merch_id, ic.merch_id) WHERE a.user_id IS NULL OR ic.user_id IS NULL OR a.quantity <> ic.quantity OR a.fulfilled_quantity <> ic.fulfilled_quantity ORDER BY user_id, m.merch_name;`
+	repairInventoryCountsQuery = `INSERT INTO content.inventory_counts (user_id, merch_id, quantity, fulfilled_quantity) SELECT user_id, merch_id, SUM(quantity), SUM(fulfilled_quantity) FROM content.merch_purchases GROUP BY user_id, merch_id ON CONFLICT (user_id, merch_id) DO UPDATE SET quantity = EXCLUDED.quantity, fulfilled_quantity = EXCLUDED.fulfilled_quantity WHERE (content.inventory_counts.quantity, content.inventory_counts.fulfilled_quantity) IS DISTINCT FROM (EXCLUDED.quantity, EXCLUDED.fulfilled_quantity);`
+	deleteStaleInventoryQuery  = `DELETE FROM content.inventory_counts ic WHERE NOT EXISTS (SELECT 1 FROM content.merch_purchases mp WHERE mp.user_id = ic.user_id AND mp.merch_id = ic.merch_id);`
+)
+
+// ErrInsufficientItems indicates that the user does not have enough units of the item pending pickup.
+var ErrInsufficientItems = errors.New("storage: not enough items pending pickup")
+
+// pendingPurchase is a purchase row with units not yet handed out.
+type pendingPurchase struct {
+	id      int64
+	pending int
+}
+
+// ConsumeItem marks quantity units of the user's item as handed out and returns the updated inventory entry.
+// Units are taken from the oldest purchases first, so a single call may partially fulfill several purchase rows.
+// It returns ErrInsufficientItems when fewer than quantity units are pending pickup, including for items the user never bought.
+func (postgresql *PostgreSQL) ConsumeItem(ctx context.Context, userID int32, itemName string, quantity int) (*models.InventoryItem, error) {
+	var item *models.InventoryItem
+	err := postgresql.inTransaction(ctx, "ConsumeItem", func(ctx context.Context) error {
+		var err error
+		item, err = postgresql.consumeItem(ctx, userID, itemName, quantity)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// consumeItem runs the steps of ConsumeItem within the transaction stored in ctx.
+func (postgresql *PostgreSQL) consumeItem(ctx context.Context, userID int32, itemName string, quantity int) (*models.InventoryItem, error) {
+	purchases, err := postgresql.lockPendingPurchases(ctx, userID, itemName)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending int
+	for _, purchase := range purchases {
+		pending += purchase.pending
+	}
+	if pending < quantity {
+		return nil, ErrInsufficientItems
+	}
+
+	remaining := quantity
+	for _, purchase := range purchases {
+		if remaining == 0 {
+			break
+		}
+		if err = postgresql.checkDeadline(ctx); err != nil {
+			return nil, err
+		}
+
+		fulfilled := min(purchase.pending, remaining)
+		if _, err = postgresql.querier(ctx, nil).ExecContext(ctx, fulfillPurchaseQuery, fulfilled, purchase.id); err != nil {
+			postgresql.logQueryError(ctx, "consumeItem", err, zap.String("query", "fulfillPurchaseQuery"),
+				zap.Int32("userID", userID), logger.ItemName(itemName), zap.Int("quantity", quantity))
+			return nil, err
+		}
+		remaining -= fulfilled
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err = postgresql.querier(ctx, nil).ExecContext(ctx, fulfillInventoryCountQuery, userID, itemName, quantity); err != nil {
+		postgresql.logQueryError(ctx, "consumeItem", err, zap.String("query", "fulfillInventoryCountQuery"),
+			zap.Int32("userID", userID), logger.ItemName(itemName), zap.Int("quantity", quantity))
+		return nil, err
+	}
+
+	item := &models.InventoryItem{Type: itemName}
+	var category sql.NullString
+	err = postgresql.querier(ctx, nil).QueryRowContext(ctx, getInventoryItemQuery, userID, itemName).
+		Scan(&category, &item.Quantity, &item.PendingQuantity, &item.FulfilledQuantity)
+	if err != nil {
+		postgresql.logQueryError(ctx, "consumeItem", err, zap.String("query", "getInventoryItemQuery"),
+			zap.Int32("userID", userID), logger.ItemName(itemName), zap.Int("quantity", quantity))
+		return nil, err
+	}
+	item.Category = category.String
+
+	return item, nil
+}
+
+// lockPendingPurchases locks and returns the user's purchases of the item with units pending pickup, oldest first.
+func (postgresql *PostgreSQL) lockPendingPurchases(ctx context.Context, userID int32, itemName string) ([]pendingPurchase, error) {
+	rows, err := postgresql.querier(ctx, nil).QueryContext(ctx, lockPendingPurchasesQuery, userID, itemName)
+	if err != nil {
+		postgresql.logQueryError(ctx, "lockPendingPurchases", err, zap.String("query", "lockPendingPurchasesQuery"),
+			zap.Int32("userID", userID), logger.ItemName(itemName))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []pendingPurchase
+	for rows.Next() {
+		var purchase pendingPurchase
+		if err := rows.Scan(&purchase.id, &purchase.pending); err != nil {
+			postgresql.logQueryError(ctx, "lockPendingPurchases", err, zap.String("query", "lockPendingPurchasesQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID), logger.ItemName(itemName))
+			return nil, err
+		}
+
+		purchases = append(purchases, purchase)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "lockPendingPurchases", err, zap.String("query", "lockPendingPurchasesQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID), logger.ItemName(itemName))
+		return nil, err
+	}
+
+	return purchases, nil
+}
+
+// addInventoryCount adds quantity units of the item to the user's entry in content.inventory_counts, creating it
+// when needed. Every operation inserting purchase rows calls it in the same transaction, so the counts read by
+// GetMerchPurchasesInfo never drift from the rows they summarize.
+func (postgresql *PostgreSQL) addInventoryCount(ctx context.Context, tx Tx, userID int32, merchID int, quantity int) error {
+	if _, err := postgresql.querier(ctx, tx).ExecContext(ctx, addInventoryCountQuery, userID, merchID, quantity); err != nil {
+		postgresql.logQueryError(ctx, "addInventoryCount", err, zap.String("query", "addInventoryCountQuery"),
+			zap.Int32("userID", userID), zap.Int("merchID", merchID), zap.Int("quantity", quantity))
+		return err
+	}
+
+	return nil
+}
+
+// ReconcileInventoryCounts compares content.inventory_counts with the quantities aggregated from the purchase rows
+// and returns every entry that differs, ordered by user and item. When repair is set, the drifted entries are
+// overwritten with the aggregated quantities in the same transaction. It scans all purchases, so it is meant
+// to be run by administrators rather than on a request path.
+func (postgresql *PostgreSQL) ReconcileInventoryCounts(ctx context.Context, repair bool) ([]models.InventoryDrift, error) {
+	var drift []models.InventoryDrift
+	err := postgresql.inTransaction(ctx, "ReconcileInventoryCounts", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		rows, err := q.QueryContext(ctx, inventoryDriftQuery)
+		if err != nil {
+			postgresql.logQueryError(ctx, "ReconcileInventoryCounts", err, zap.String("query", "inventoryDriftQuery"))
+			return err
+		}
+		defer rows.Close()
+
+		drift = nil
+		for rows.Next() {
+			var entry models.InventoryDrift
+			err := rows.Scan(&entry.UserID, &entry.Item, &entry.CountedQuantity, &entry.CountedFulfilled, &entry.ActualQuantity, &entry.ActualFulfilled)
+			if err != nil {
+				postgresql.logQueryError(ctx, "ReconcileInventoryCounts", err,
+					zap.String("query", "inventoryDriftQuery"), zap.String("stage", "scan"))
+				return err
+			}
+			drift = append(drift, entry)
+		}
+		if err := rows.Err(); err != nil {
+			postgresql.logQueryError(ctx, "ReconcileInventoryCounts", err, zap.String("query", "inventoryDriftQuery"),
+				zap.String("stage", "rows"))
+			return err
+		}
+		rows.Close()
+
+		if !repair || len(drift) == 0 {
+			return nil
+		}
+
+		if _, err = q.ExecContext(ctx, repairInventoryCountsQuery); err != nil {
+			postgresql.logQueryError(ctx, "ReconcileInventoryCounts", err, zap.String("query", "repairInventoryCountsQuery"))
+			return err
+		}
+		if _, err = q.ExecContext(ctx, deleteStaleInventoryQuery); err != nil {
+			postgresql.logQueryError(ctx, "ReconcileInventoryCounts", err, zap.String("query", "deleteStaleInventoryQuery"))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drift, nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/security"
+)
+
+const (
+	createInviteCodeQuery = `INSERT INTO content.invite_codes (code, created_by, expires_at) VALUES ($1, $2, $3);`
+	useInviteCodeQuery    = `UPDATE content.invite_codes SET used_by = $2, used_at = $3 WHERE code = $1 AND used_at IS NULL AND expires_at > $3;`
+)
+
+// ErrInviteCodeInvalid indicates that the invite code does not exist, has already been used, or has expired.
+var ErrInviteCodeInvalid = errors.New("storage: invalid invite code")
+
+// CreateInviteCode stores a new unused invite code created by the administrator with ID createdBy.
+func (postgresql *PostgreSQL) CreateInviteCode(ctx context.Context, invite models.InviteCode, createdBy int32) error {
+	_, err := postgresql.db.ExecContext(ctx, createInviteCodeQuery, invite.Code, createdBy, invite.ExpiresAt)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CreateInviteCode", err, zap.String("query", "createInviteCodeQuery"),
+			zap.Int32("createdBy", createdBy))
+		return err
+	}
+
+	return nil
+}
+
+// CreateUserWithInvite creates the user and spends the invite code in one transaction, so that a code
+// registers at most one user and a user is only created with a code unused and unexpired at now.
+// It returns ErrInviteCodeInvalid, without creating the user, when the code cannot be used.
+// The username is normalized as by CreateUser.
+func (postgresql *PostgreSQL) CreateUserWithInvite(ctx context.Context, user *models.User, code string, now time.Time) (*models.User, error) {
+	encryptedPassword := security.HashPassword(user.Password)
+	user.Username = models.NormalizeUsername(user.Username)
+
+	err := postgresql.inTransaction(ctx, "CreateUserWithInvite", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		err := q.QueryRowContext(ctx, createUserQuery, user.Username, encryptedPassword, user.Coins).Scan(&user.ID)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateUserWithInvite", err, zap.String("query", "createUserQuery"),
+				zap.String("username", user.Username))
+			return err
+		}
+
+		result, err := q.ExecContext(ctx, useInviteCodeQuery, code, user.ID, now)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateUserWithInvite", err, zap.String("query", "useInviteCodeQuery"),
+				zap.String("username", user.Username))
+			return err
+		}
+		used, err := result.RowsAffected()
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateUserWithInvite", err, zap.String("query", "useInviteCodeQuery"),
+				zap.String("stage", "rowsAffected"), zap.String("username", user.Username))
+			return err
+		}
+		if used == 0 {
+			return ErrInviteCodeInvalid
+		}
+
+		return nil
+	})
+	if err != nil {
+		user.ID = 0
+		return user, err
+	}
+
+	return user, nil
+}
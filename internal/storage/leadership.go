@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/worker"
+)
+
+const (
+	// Advisory locks are keyed by the hash of the leadership key, so that keys can be readable names.
+	tryLeadershipLockQuery = `SELECT pg_try_advisory_lock(hashtext($1));`
+	leadershipUnlockQuery  = `SELECT pg_advisory_unlock(hashtext($1));`
+	leadershipPingQuery    = `SELECT 1;`
+)
+
+// DefaultLeaderKeepAlive is how often a leadership checks the connection holding it, unless configured otherwise
+// with SetLeaderKeepAlive.
+const DefaultLeaderKeepAlive = 5 * time.Second
+
+// ErrLeadershipTaken indicates that the leadership is held by another instance.
+var ErrLeadershipTaken = errors.New("storage: leadership is held by another instance")
+
+// SetLeaderKeepAlive sets how often a leadership checks the connection holding it. A broken connection is noticed,
+// and the leadership reported lost, within about twice the interval. A non-positive interval restores the default.
+func (postgresql *PostgreSQL) SetLeaderKeepAlive(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultLeaderKeepAlive
+	}
+	postgresql.leaderKeepAlive = interval
+}
+
+// Leadership is the leadership among the instances sharing the database under a key, held as a session-level
+// advisory lock on a connection reserved for it. The lock, and so the leadership, lasts until Release or until
+// the session ends: if the connection breaks, the server releases the lock for another instance to take and
+// Lost is closed once the next keep-alive check fails.
+type Leadership struct {
+	postgresql *PostgreSQL
+	key        string
+	conn       Conn
+
+	release sync.Once
+	stop    chan struct{} // Closed by Release to stop the keep-alive checks.
+	stopped chan struct{} // Closed once the keep-alive checks have stopped.
+	lost    chan struct{} // Closed once the leadership has ended.
+}
+
+// TryAcquireLeadership makes this instance the leader under key if no other instance is, without waiting.
+// It returns ErrLeadershipTaken when another instance is the leader. The leadership must be released with Release.
+func (postgresql *PostgreSQL) TryAcquireLeadership(ctx context.Context, key string) (*Leadership, error) {
+	conn, err := postgresql.db.Conn(ctx)
+	if err != nil {
+		postgresql.logQueryError(ctx, "TryAcquireLeadership", err, zap.String("stage", "connect"),
+			zap.String("leadershipKey", key))
+		return nil, err
+	}
+
+	var acquired bool
+	if err = conn.QueryRowContext(ctx, tryLeadershipLockQuery, key).Scan(&acquired); err != nil {
+		postgresql.logQueryError(ctx, "TryAcquireLeadership", err, zap.String("query", "tryLeadershipLockQuery"))
+		conn.Release(true)
+		return nil, err
+	}
+	if !acquired {
+		conn.Release(false)
+		return nil, ErrLeadershipTaken
+	}
+
+	leadership := &Leadership{
+		postgresql: postgresql,
+		key:        key,
+		conn:       conn,
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		lost:       make(chan struct{}),
+	}
+	go leadership.keepAlive(postgresql.leaderKeepAlive)
+
+	return leadership, nil
+}
+
+// Lost returns a channel that is closed once the leadership has ended, by Release or by the loss of its connection.
+func (leadership *Leadership) Lost() <-chan struct{} {
+	return leadership.lost
+}
+
+// Release gives up the leadership and returns its connection to the pool. A connection that may still hold
+// the lock, because unlocking it failed, is closed instead, which ends the session and releases the lock.
+// Release may be called more than once.
+func (leadership *Leadership) Release() {
+	leadership.release.Do(func() {
+		close(leadership.stop)
+		<-leadership.stopped
+
+		select {
+		case <-leadership.lost:
+			leadership.conn.Release(true)
+			return
+		default:
+		}
+		defer close(leadership.lost)
+
+		ctx, cancel := context.WithTimeout(context.Background(), leadership.postgresql.leaderKeepAlive)
+		defer cancel()
+		var unlocked bool
+		if err := leadership.conn.QueryRowContext(ctx, leadershipUnlockQuery, leadership.key).Scan(&unlocked); err != nil || !unlocked {
+			leadership.postgresql.logQueryError(ctx, "Release", err, zap.String("query", "leadershipUnlockQuery"),
+				zap.String("leadershipKey", leadership.key))
+			leadership.conn.Release(true)
+			return
+		}
+		leadership.conn.Release(false)
+	})
+}
+
+// keepAlive checks the connection holding the leadership every interval until Release, closing lost when a check
+// fails.
+func (leadership *Leadership) keepAlive(interval time.Duration) {
+	defer close(leadership.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-leadership.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		var one int
+		err := leadership.conn.QueryRowContext(ctx, leadershipPingQuery).Scan(&one)
+		cancel()
+		if err != nil {
+			leadership.postgresql.logQueryError(ctx, "keepAlive", err, zap.String("query", "leadershipPingQuery"),
+				zap.String("leadershipKey", leadership.key))
+			close(leadership.lost)
+			return
+		}
+	}
+}
+
+// Elector returns a worker.Elector electing, among the instances sharing the database, the one holding
+// the leadership under key.
+func (postgresql *PostgreSQL) Elector(key string) worker.Elector {
+	return leaderElector{postgresql: postgresql, key: key}
+}
+
+// leaderElector adapts TryAcquireLeadership to the worker.Elector interface.
+type leaderElector struct {
+	postgresql *PostgreSQL
+	key        string
+}
+
+func (elector leaderElector) TryAcquire(ctx context.Context) (worker.Lease, error) {
+	leadership, err := elector.postgresql.TryAcquireLeadership(ctx, elector.key)
+	if errors.Is(err, ErrLeadershipTaken) {
+		return nil, worker.ErrNotElected
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return leadership, nil
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/pkg/worker"
+)
+
+// lockDatabase is a fakeDatabase handing out connections that answer the advisory lock queries with locked,
+// and fail the keep-alive checks once broken is set. It is safe for concurrent use.
+type lockDatabase struct {
+	*fakeDatabase
+	locked bool
+
+	mu     sync.Mutex
+	broken bool
+	events []string
+}
+
+func (d *lockDatabase) Conn(ctx context.Context) (Conn, error) {
+	return &lockConn{db: d}, nil
+}
+
+func (d *lockDatabase) record(event string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events = append(d.events, event)
+}
+
+func (d *lockDatabase) recorded() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.events...)
+}
+
+func (d *lockDatabase) breakConnections() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.broken = true
+}
+
+// lockConn is a connection of lockDatabase.
+type lockConn struct {
+	db *lockDatabase
+}
+
+func (c *lockConn) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *lockConn) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *lockConn) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	c.db.record("conn: " + query)
+	c.db.mu.Lock()
+	broken := c.db.broken
+	c.db.mu.Unlock()
+	if broken {
+		return errRow{err: ErrStorageUnavailable}
+	}
+	return boolRow(c.db.locked)
+}
+
+func (c *lockConn) Release(discard bool) {
+	if discard {
+		c.db.record("discard")
+		return
+	}
+	c.db.record("release")
+}
+
+// boolRow is a single-row result scanning value into bool destinations and 1 into int ones.
+type boolRow bool
+
+func (row boolRow) Scan(dest ...any) error {
+	for _, d := range dest {
+		switch d := d.(type) {
+		case *bool:
+			*d = bool(row)
+		case *int:
+			*d = 1
+		}
+	}
+	return nil
+}
+
+func newLockPostgreSQL(locked bool) (*PostgreSQL, *lockDatabase) {
+	postgresql, db := newFakePostgreSQL()
+	lock := &lockDatabase{fakeDatabase: db, locked: locked}
+	postgresql.db = lock
+	postgresql.SetLeaderKeepAlive(5 * time.Millisecond)
+	return postgresql, lock
+}
+
+func TestTryAcquireLeadership(t *testing.T) {
+	t.Run("Taken", func(t *testing.T) {
+		postgresql, db := newLockPostgreSQL(false)
+
+		leadership, err := postgresql.TryAcquireLeadership(context.Background(), "jobs")
+		assert.ErrorIs(t, err, ErrLeadershipTaken)
+		assert.Nil(t, leadership)
+		assert.Equal(t, []string{"conn: " + tryLeadershipLockQuery, "release"}, db.recorded())
+
+		_, err = postgresql.Elector("jobs").TryAcquire(context.Background())
+		assert.ErrorIs(t, err, worker.ErrNotElected)
+	})
+
+	t.Run("Released", func(t *testing.T) {
+		postgresql, db := newLockPostgreSQL(true)
+
+		leadership, err := postgresql.TryAcquireLeadership(context.Background(), "jobs")
+		require.NoError(t, err)
+		leadership.Release()
+		leadership.Release()
+
+		select {
+		case <-leadership.Lost():
+		default:
+			t.Fatal("Lost must be closed once the leadership is released")
+		}
+		events := db.recorded()
+		assert.Equal(t, "conn: "+leadershipUnlockQuery, events[len(events)-2])
+		assert.Equal(t, "release", events[len(events)-1], "an unlocked connection must be returned to the pool")
+	})
+
+	t.Run("Connection lost", func(t *testing.T) {
+		postgresql, db := newLockPostgreSQL(true)
+
+		leadership, err := postgresql.TryAcquireLeadership(context.Background(), "jobs")
+		require.NoError(t, err)
+		db.breakConnections()
+
+		select {
+		case <-leadership.Lost():
+		case <-time.After(time.Second):
+			t.Fatal("Lost must be closed once the keep-alive check fails")
+		}
+		leadership.Release()
+		events := db.recorded()
+		assert.NotContains(t, events, "conn: "+leadershipUnlockQuery)
+		assert.Equal(t, "discard", events[len(events)-1], "a connection that may hold the lock must not be reused")
+	})
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/auth"
+)
+
+// queryErrorMessage is the message of every entry logged for a failed storage operation, so that alerts can match
+// a single message.
+const queryErrorMessage = "storage query failed"
+
+// loggedFields lists the keys of the fields logQueryError keeps: the failed query and stage of an operation, and
+// the parameters that are safe to log. Passwords, password hashes, tokens, codes, and idempotency keys are never
+// listed, and fields with any other key are dropped.
+var loggedFields = map[string]bool{
+	"query":          true,
+	"stage":          true,
+	"section":        true,
+	"activityID":     true,
+	"leadershipKey":  true,
+	"userID":         true,
+	"adminID":        true,
+	"createdBy":      true,
+	"username":       true,
+	"toUser":         true,
+	"grantor":        true,
+	"granteeID":      true,
+	"grantorID":      true,
+	"recipientID":    true,
+	"itemName":       true,
+	"itemID":         true,
+	"merchID":        true,
+	"quantity":       true,
+	"amount":         true,
+	"coins":          true,
+	"limit":          true,
+	"category":       true,
+	"campaignID":     true,
+	"delegationID":   true,
+	"holdID":         true,
+	"notificationID": true,
+	"promotionID":    true,
+	"scheduledID":    true,
+	"sessionID":      true,
+	"tokenID":        true,
+	"transferID":     true,
+}
+
+// logQueryError logs the failure of the storage operation op with err at error level under queryErrorMessage.
+// The entry carries the ID of the request and of the authenticated user stored in ctx, if any, and the fields
+// listed in loggedFields; the query that failed is passed as the "query" field, and the step that failed after it
+// ran, such as "scan", as the "stage" field.
+func (postgresql *PostgreSQL) logQueryError(ctx context.Context, op string, err error, fields ...zap.Field) {
+	entry := make([]zap.Field, 0, len(fields)+4)
+	entry = append(entry, zap.String("operation", op), zap.Error(err))
+	if requestID := middleware.GetReqID(ctx); requestID != "" {
+		entry = append(entry, zap.String("requestID", requestID))
+	}
+	if userID, ok := auth.UserIDFromContext(ctx); ok {
+		entry = append(entry, zap.Int32("requestUserID", userID))
+	}
+	for _, field := range fields {
+		if loggedFields[field.Key] {
+			entry = append(entry, field)
+		}
+	}
+
+	postgresql.log.Error(queryErrorMessage, entry...)
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/pkg/logger"
+)
+
+// failingTxDatabase is a scriptedDatabase whose transactions fail the single-row queries in failures with their error.
+type failingTxDatabase struct {
+	*scriptedDatabase
+	failures map[string]error
+}
+
+func (d *failingTxDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.scriptedDatabase.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &failingTx{scriptedTx: tx.(*scriptedTx), failures: d.failures}, nil
+}
+
+type failingTx struct {
+	*scriptedTx
+	failures map[string]error
+}
+
+func (tx *failingTx) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	if err := tx.failures[query]; err != nil {
+		tx.db.events = append(tx.db.events, "tx: "+query)
+		return errRow{err: err}
+	}
+	return tx.scriptedTx.QueryRowContext(ctx, query, args...)
+}
+
+// newObservedPostgreSQL returns a PostgreSQL logging to the returned observer.
+func newObservedPostgreSQL() (*PostgreSQL, *observer.ObservedLogs) {
+	postgresql, _ := newFakePostgreSQL()
+	core, logs := observer.New(zapcore.InfoLevel)
+	postgresql.log = &logger.Logger{Logger: zap.New(core)}
+	return postgresql, logs
+}
+
+func TestLogQueryError_TransferCoins(t *testing.T) {
+	errInsert := errors.New("insert failed")
+	postgresql, logs := newObservedPostgreSQL()
+	scripted, _ := newScriptedPostgreSQL([]string{claimCampaignBonusQuery}, func(string, []any) int64 { return 1 })
+	postgresql.db = &failingTxDatabase{
+		scriptedDatabase: scripted.db.(*scriptedDatabase),
+		failures:         map[string]error{transferCoinsQuery: errInsert},
+	}
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "host/request-1")
+	ctx = auth.WithUserID(ctx, 7)
+	_, err := postgresql.TransferCoins(ctx, 7, models.SendCoinRequest{ToUser: "recipient", Amount: 1})
+	require.ErrorIs(t, err, errInsert)
+
+	entries := logs.FilterMessage(queryErrorMessage).AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.Equal(t, map[string]any{
+		"operation":     "transferCoins",
+		"error":         "insert failed",
+		"requestID":     "host/request-1",
+		"requestUserID": int32(7),
+		"query":         "transferCoinsQuery",
+		"userID":        int32(7),
+		"toUser":        "recipient",
+		"amount":        int64(1),
+	}, entries[0].ContextMap())
+}
+
+func TestLogQueryError_DropsUnlistedFields(t *testing.T) {
+	postgresql, logs := newObservedPostgreSQL()
+
+	postgresql.logQueryError(context.Background(), "CheckUser", errors.New("mismatch"),
+		zap.String("username", "user"), zap.String("password", "secret"), zap.String("passwordHash", "hash"))
+
+	entries := logs.FilterMessage(queryErrorMessage).AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]any{
+		"operation": "CheckUser",
+		"error":     "mismatch",
+		"username":  "user",
+	}, entries[0].ContextMap(), "only listed parameters, and no request or user ID absent from the context, may be logged")
+}
@@ -8,7 +8,13 @@ CREATE TABLE IF NOT EXISTS content.users (
     id SERIAL PRIMARY KEY,
     username VARCHAR(255) NOT NULL UNIQUE,
     password_hash TEXT NOT NULL,
-    coins INTEGER NOT NULL DEFAULT 1000 CHECK (coins >= 0),
+    coins BIGINT NOT NULL DEFAULT 1000 CHECK (coins >= 0),
+    opening_coins BIGINT NOT NULL DEFAULT 1000,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    tos_version INTEGER NOT NULL DEFAULT 0,
+    tos_accepted_at TIMESTAMPTZ,
+    token_version INTEGER NOT NULL DEFAULT 0,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
@@ -16,19 +22,90 @@ CREATE TABLE IF NOT EXISTS content.users (
 CREATE TABLE IF NOT EXISTS content.merch (
     id SERIAL PRIMARY KEY,
     merch_name VARCHAR(100) NOT NULL UNIQUE,
-    price INTEGER NOT NULL CHECK (price > 0)
+    price INTEGER NOT NULL CHECK (price > 0),
+    category VARCHAR(50)
 );
 
+CREATE TABLE IF NOT EXISTS content.promotions (
+    id BIGSERIAL PRIMARY KEY,
+    merch_id INTEGER,
+    category VARCHAR(50),
+    discount_percent INTEGER CHECK (discount_percent BETWEEN 1 AND 99),
+    discount_amount INTEGER CHECK (discount_amount > 0),
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_promotion_merch FOREIGN KEY (merch_id)
+        REFERENCES content.merch (id) ON DELETE CASCADE,
+    CONSTRAINT chk_promotion_target CHECK ((merch_id IS NULL) <> (category IS NULL)),
+    CONSTRAINT chk_promotion_discount CHECK ((discount_percent IS NULL) <> (discount_amount IS NULL)),
+    CONSTRAINT chk_promotion_window CHECK (ends_at > starts_at)
+);
+
+CREATE SEQUENCE IF NOT EXISTS content.receipt_number_seq;
+
 CREATE TABLE IF NOT EXISTS content.merch_purchases (
     id BIGSERIAL PRIMARY KEY,
     user_id INT NOT NULL,
     merch_id INTEGER NOT NULL,
     quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    price INTEGER NOT NULL CHECK (price > 0),
+    promotion_id BIGINT,
+    fulfilled_quantity INTEGER NOT NULL DEFAULT 0,
+    gifted_by INT,
+    bought_by INT,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    receipt_number VARCHAR(32) UNIQUE,
+    redeemed_by INT,
+    redeemed_at TIMESTAMPTZ,
     CONSTRAINT fk_user_purchase FOREIGN KEY (user_id)
         REFERENCES content.users (id) ON DELETE CASCADE,
     CONSTRAINT fk_merch_purchase FOREIGN KEY (merch_id)
-        REFERENCES content.merch (id) ON DELETE RESTRICT
+        REFERENCES content.merch (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_gifted_by_user FOREIGN KEY (gifted_by)
+        REFERENCES content.users (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_redeemed_by_user FOREIGN KEY (redeemed_by)
+        REFERENCES content.users (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_bought_by_user FOREIGN KEY (bought_by)
+        REFERENCES content.users (id) ON DELETE SET NULL,
+    CONSTRAINT fk_purchase_promotion FOREIGN KEY (promotion_id)
+        REFERENCES content.promotions (id) ON DELETE RESTRICT,
+    CONSTRAINT chk_gift_different_users CHECK (gifted_by <> user_id),
+    CONSTRAINT chk_bought_by_different_users CHECK (bought_by <> user_id),
+    CONSTRAINT chk_fulfilled_quantity CHECK (fulfilled_quantity BETWEEN 0 AND quantity)
+);
+
+CREATE TABLE IF NOT EXISTS content.inventory_counts (
+    user_id INT NOT NULL,
+    merch_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    fulfilled_quantity INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, merch_id),
+    CONSTRAINT fk_inventory_count_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_inventory_count_merch FOREIGN KEY (merch_id)
+        REFERENCES content.merch (id) ON DELETE RESTRICT,
+    CONSTRAINT chk_inventory_fulfilled_quantity CHECK (fulfilled_quantity BETWEEN 0 AND quantity)
+);
+
+-- Backfill the counts of purchases made before the table existed. Later runs find every user's counts in place.
+INSERT INTO content.inventory_counts (user_id, merch_id, quantity, fulfilled_quantity)
+SELECT user_id, merch_id, SUM(quantity), SUM(fulfilled_quantity)
+FROM content.merch_purchases
+GROUP BY user_id, merch_id
+ON CONFLICT (user_id, merch_id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS content.gifting_campaigns (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    multiplier_percent INTEGER NOT NULL CHECK (multiplier_percent > 100),
+    budget BIGINT NOT NULL CHECK (budget > 0),
+    spent BIGINT NOT NULL DEFAULT 0,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_campaign_spent CHECK (spent BETWEEN 0 AND budget),
+    CONSTRAINT chk_campaign_window CHECK (ends_at > starts_at)
 );
 
 CREATE TABLE IF NOT EXISTS content.coin_transfers (
@@ -36,17 +113,270 @@ CREATE TABLE IF NOT EXISTS content.coin_transfers (
     from_user_id INT NOT NULL,
     to_user_id INT NOT NULL,
     amount INTEGER NOT NULL CHECK (amount > 0),
+    bonus BIGINT NOT NULL DEFAULT 0 CHECK (bonus >= 0),
+    campaign_id BIGINT,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    reversal_of BIGINT UNIQUE,
+    reversed_by INT,
+    reversed_at TIMESTAMPTZ,
     CONSTRAINT fk_from_user FOREIGN KEY (from_user_id)
         REFERENCES content.users (id) ON DELETE RESTRICT,
     CONSTRAINT fk_to_user FOREIGN KEY (to_user_id)
         REFERENCES content.users (id) ON DELETE RESTRICT,
-    CONSTRAINT chk_different_users CHECK (from_user_id <> to_user_id)
+    CONSTRAINT fk_reversal_of FOREIGN KEY (reversal_of)
+        REFERENCES content.coin_transfers (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_reversed_by FOREIGN KEY (reversed_by)
+        REFERENCES content.users (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_transfer_campaign FOREIGN KEY (campaign_id)
+        REFERENCES content.gifting_campaigns (id) ON DELETE RESTRICT,
+    CONSTRAINT chk_different_users CHECK (from_user_id <> to_user_id),
+    CONSTRAINT chk_bonus_campaign CHECK (bonus = 0 OR campaign_id IS NOT NULL)
+);
+
+-- Transfers older than TRANSFER_ARCHIVE_AGE are moved here by the archiver. The columns are those of
+-- content.coin_transfers; reversed transfers and reversals are never archived, so the reversal references are omitted.
+CREATE TABLE IF NOT EXISTS content.coin_transfers_archive (
+    id BIGINT PRIMARY KEY,
+    from_user_id INT NOT NULL,
+    to_user_id INT NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    bonus BIGINT NOT NULL DEFAULT 0 CHECK (bonus >= 0),
+    campaign_id BIGINT,
+    created_at TIMESTAMPTZ NOT NULL,
+    reversal_of BIGINT,
+    reversed_by INT,
+    reversed_at TIMESTAMPTZ,
+    CONSTRAINT fk_archived_from_user FOREIGN KEY (from_user_id)
+        REFERENCES content.users (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_archived_to_user FOREIGN KEY (to_user_id)
+        REFERENCES content.users (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_archived_transfer_campaign FOREIGN KEY (campaign_id)
+        REFERENCES content.gifting_campaigns (id) ON DELETE RESTRICT
+);
+
+-- All transfers, recent and archived, for the ledger, the statistics, and the exports.
+CREATE OR REPLACE VIEW content.all_coin_transfers AS
+    SELECT id, from_user_id, to_user_id, amount, bonus, campaign_id, created_at, reversal_of, reversed_by, reversed_at
+    FROM content.coin_transfers
+    UNION ALL
+    SELECT id, from_user_id, to_user_id, amount, bonus, campaign_id, created_at, reversal_of, reversed_by, reversed_at
+    FROM content.coin_transfers_archive;
+
+CREATE TABLE IF NOT EXISTS content.transfer_reversals (
+    transfer_id BIGINT PRIMARY KEY,
+    reversal_transfer_id BIGINT NOT NULL,
+    admin_id INT NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    reversed_amount INTEGER NOT NULL CHECK (reversed_amount BETWEEN 1 AND amount),
+    partial BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_reversal_transfer FOREIGN KEY (transfer_id)
+        REFERENCES content.coin_transfers (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_reversal_compensation FOREIGN KEY (reversal_transfer_id)
+        REFERENCES content.coin_transfers (id) ON DELETE RESTRICT,
+    CONSTRAINT fk_reversal_admin FOREIGN KEY (admin_id)
+        REFERENCES content.users (id) ON DELETE RESTRICT
+);
+
+CREATE TABLE IF NOT EXISTS content.coin_holds (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    reason VARCHAR(100) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'released', 'captured')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    CONSTRAINT fk_hold_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS content.scheduled_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    from_user_id INT NOT NULL,
+    to_user_id INT,
+    to_username VARCHAR(255) NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    execute_at TIMESTAMPTZ NOT NULL,
+    hold_id BIGINT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'completed', 'failed', 'canceled')),
+    transfer_id BIGINT,
+    failure_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    CONSTRAINT fk_scheduled_from_user FOREIGN KEY (from_user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_scheduled_to_user FOREIGN KEY (to_user_id)
+        REFERENCES content.users (id) ON DELETE SET NULL,
+    CONSTRAINT fk_scheduled_hold FOREIGN KEY (hold_id)
+        REFERENCES content.coin_holds (id) ON DELETE CASCADE,
+    CONSTRAINT chk_scheduled_different_users CHECK (from_user_id <> to_user_id)
+);
+
+CREATE TABLE IF NOT EXISTS content.coin_accruals (
+    period DATE PRIMARY KEY,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    users_credited INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS content.coin_accrual_entries (
+    id BIGSERIAL PRIMARY KEY,
+    period DATE NOT NULL,
+    user_id INT NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_accrual_period FOREIGN KEY (period)
+        REFERENCES content.coin_accruals (period) ON DELETE RESTRICT,
+    CONSTRAINT fk_accrual_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE,
+    CONSTRAINT uq_accrual_period_user UNIQUE (period, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS content.sessions (
+    id BIGSERIAL PRIMARY KEY,
+    jti TEXT NOT NULL UNIQUE,
+    user_id INT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    issued_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    CONSTRAINT fk_session_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS content.failed_purchases (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    item_name TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_failed_purchase_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS content.invite_codes (
+    code TEXT PRIMARY KEY,
+    created_by INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_by INT,
+    used_at TIMESTAMPTZ,
+    CONSTRAINT fk_invite_created_by FOREIGN KEY (created_by)
+        REFERENCES content.users (id) ON DELETE SET NULL,
+    CONSTRAINT fk_invite_used_by FOREIGN KEY (used_by)
+        REFERENCES content.users (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS content.personal_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    CONSTRAINT fk_personal_token_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS content.spending_delegations (
+    id BIGSERIAL PRIMARY KEY,
+    grantor_id INT NOT NULL,
+    grantee_id INT NOT NULL,
+    allowance INTEGER NOT NULL CHECK (allowance > 0),
+    remaining_allowance INTEGER NOT NULL CHECK (remaining_allowance >= 0),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ,
+    CONSTRAINT fk_delegation_grantor FOREIGN KEY (grantor_id)
+        REFERENCES content.users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_delegation_grantee FOREIGN KEY (grantee_id)
+        REFERENCES content.users (id) ON DELETE CASCADE,
+    CONSTRAINT chk_delegation_different_users CHECK (grantor_id <> grantee_id),
+    CONSTRAINT chk_delegation_remaining_allowance CHECK (remaining_allowance <= allowance)
+);
+
+CREATE TABLE IF NOT EXISTS content.data_exports (
+    user_id INT PRIMARY KEY,
+    exported_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT fk_data_export_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS content.notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    category VARCHAR(32) NOT NULL,
+    actor_id INT,
+    amount INTEGER,
+    item VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMPTZ,
+    CONSTRAINT fk_notification_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_notification_actor FOREIGN KEY (actor_id)
+        REFERENCES content.users (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS content.notification_mutes (
+    user_id INT NOT NULL,
+    category VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, category),
+    CONSTRAINT fk_notification_mute_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS content.api_activity (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    action TEXT NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_api_activity_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS content.idempotency_keys (
+    user_id INT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, idempotency_key),
+    CONSTRAINT fk_idempotency_keys_user FOREIGN KEY (user_id)
+        REFERENCES content.users (id) ON DELETE CASCADE
 );
 
 CREATE INDEX IF NOT EXISTS idx_merch_purchases_user_id ON content.merch_purchases(user_id);
+CREATE INDEX IF NOT EXISTS idx_merch_purchases_user_merch_covering ON content.merch_purchases(user_id, merch_id) INCLUDE (quantity, fulfilled_quantity);
+CREATE INDEX IF NOT EXISTS idx_merch_purchases_gifted_by ON content.merch_purchases(gifted_by);
 CREATE INDEX IF NOT EXISTS idx_coin_transfers_from_user_id ON content.coin_transfers(from_user_id);
 CREATE INDEX IF NOT EXISTS idx_coin_transfers_to_user_id ON content.coin_transfers(to_user_id);
+CREATE INDEX IF NOT EXISTS idx_coin_transfers_from_user_keyset ON content.coin_transfers(from_user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_coin_transfers_to_user_keyset ON content.coin_transfers(to_user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_coin_transfers_created_at ON content.coin_transfers(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_coin_transfers_archive_from_user_keyset ON content.coin_transfers_archive(from_user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_coin_transfers_archive_to_user_keyset ON content.coin_transfers_archive(to_user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_coin_transfers_archive_campaign_id ON content.coin_transfers_archive(campaign_id) WHERE campaign_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_coin_holds_active_user_id ON content.coin_holds(user_id) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_sessions_active_user_id ON content.sessions(user_id, issued_at DESC) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_failed_purchases_created_at ON content.failed_purchases(created_at);
+CREATE INDEX IF NOT EXISTS idx_scheduled_transfers_pending ON content.scheduled_transfers(execute_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_personal_tokens_user_id ON content.personal_tokens(user_id) WHERE revoked_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_delegations_active ON content.spending_delegations(grantor_id, grantee_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_spending_delegations_grantee_id ON content.spending_delegations(grantee_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_scheduled_transfers_from_user_id ON content.scheduled_transfers(from_user_id, execute_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_keyset ON content.notifications(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON content.notifications(user_id, created_at DESC, id DESC) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_api_activity_user_keyset ON content.api_activity(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_promotions_merch_id ON content.promotions(merch_id, ends_at) WHERE merch_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_promotions_category ON content.promotions(category, ends_at) WHERE category IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_merch_purchases_promotion_id ON content.merch_purchases(promotion_id) WHERE promotion_id IS NOT NULL;
 
 CREATE OR REPLACE FUNCTION content.update_updated_at_column()
 RETURNS TRIGGER AS $$
@@ -62,17 +392,44 @@ BEFORE UPDATE ON content.users
 FOR EACH ROW
 EXECUTE FUNCTION content.update_updated_at_column();
 
-INSERT INTO content.merch (merch_name, price) VALUES
-    ('t-shirt', 80),
-    ('cup', 20),
-    ('book', 50),
-    ('pen', 10),
-    ('powerbank', 200),
-    ('hoody', 300),
-    ('umbrella', 200),
-    ('socks', 10),
-    ('wallet', 50),
-    ('pink-hoody', 500)
+CREATE TABLE IF NOT EXISTS content.catalog_version (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    last_modified TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO content.catalog_version (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
+
+CREATE OR REPLACE FUNCTION content.bump_catalog_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE content.catalog_version SET last_modified = NOW();
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_bump_catalog_version ON content.merch;
+CREATE TRIGGER trg_bump_catalog_version
+AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON content.merch
+FOR EACH STATEMENT
+EXECUTE FUNCTION content.bump_catalog_version();
+
+DROP TRIGGER IF EXISTS trg_bump_catalog_version ON content.promotions;
+CREATE TRIGGER trg_bump_catalog_version
+AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON content.promotions
+FOR EACH STATEMENT
+EXECUTE FUNCTION content.bump_catalog_version();
+
+INSERT INTO content.merch (merch_name, price, category) VALUES
+    ('t-shirt', 80, 'apparel'),
+    ('cup', 20, 'accessories'),
+    ('book', 50, 'stationery'),
+    ('pen', 10, 'stationery'),
+    ('powerbank', 200, 'accessories'),
+    ('hoody', 300, 'apparel'),
+    ('umbrella', 200, 'accessories'),
+    ('socks', 10, 'apparel'),
+    ('wallet', 50, 'accessories'),
+    ('pink-hoody', 500, 'apparel')
 ON CONFLICT (merch_name) DO NOTHING;
 
 COMMIT;
@@ -84,9 +441,26 @@ COMMIT;
 
 -- DROP TRIGGER IF EXISTS trg_update_updated_at ON content.users;
 -- DROP FUNCTION IF EXISTS content.update_updated_at_column();
+-- DROP TRIGGER IF EXISTS trg_bump_catalog_version ON content.merch;
+-- DROP TRIGGER IF EXISTS trg_bump_catalog_version ON content.promotions;
+-- DROP FUNCTION IF EXISTS content.bump_catalog_version();
+-- DROP TABLE IF EXISTS content.catalog_version;
 
+-- DROP TABLE IF EXISTS content.data_exports;
+-- DROP TABLE IF EXISTS content.personal_tokens;
+-- DROP TABLE IF EXISTS content.failed_purchases;
+-- DROP TABLE IF EXISTS content.sessions;
+-- DROP TABLE IF EXISTS content.coin_accrual_entries;
+-- DROP TABLE IF EXISTS content.coin_accruals;
+-- DROP TABLE IF EXISTS content.coin_holds;
+-- DROP TABLE IF EXISTS content.transfer_reversals;
+-- DROP VIEW IF EXISTS content.all_coin_transfers;
+-- DROP TABLE IF EXISTS content.coin_transfers_archive;
 -- DROP TABLE IF EXISTS content.coin_transfers;
+-- DROP TABLE IF EXISTS content.inventory_counts;
 -- DROP TABLE IF EXISTS content.merch_purchases;
+-- DROP SEQUENCE IF EXISTS content.receipt_number_seq;
+-- DROP TABLE IF EXISTS content.promotions;
 -- DROP TABLE IF EXISTS content.merch;
 -- DROP TABLE IF EXISTS content.users;
 
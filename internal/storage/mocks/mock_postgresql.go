@@ -6,13 +6,51 @@ package mocks
 
 import (
 	context "context"
-	sql "database/sql"
 	models "merch_store/internal/models"
+	storage "merch_store/internal/storage"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
 
+// MockTxManager is a mock of TxManager interface.
+type MockTxManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockTxManagerMockRecorder
+}
+
+// MockTxManagerMockRecorder is the mock recorder for MockTxManager.
+type MockTxManagerMockRecorder struct {
+	mock *MockTxManager
+}
+
+// NewMockTxManager creates a new mock instance.
+func NewMockTxManager(ctrl *gomock.Controller) *MockTxManager {
+	mock := &MockTxManager{ctrl: ctrl}
+	mock.recorder = &MockTxManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTxManager) EXPECT() *MockTxManagerMockRecorder {
+	return m.recorder
+}
+
+// WithinTransaction mocks base method.
+func (m *MockTxManager) WithinTransaction(ctx context.Context, fn func(context.Context) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithinTransaction", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithinTransaction indicates an expected call of WithinTransaction.
+func (mr *MockTxManagerMockRecorder) WithinTransaction(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithinTransaction", reflect.TypeOf((*MockTxManager)(nil).WithinTransaction), ctx, fn)
+}
+
 // MockStorage is a mock of Storage interface.
 type MockStorage struct {
 	ctrl     *gomock.Controller
@@ -36,12 +74,73 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// AcceptTerms mocks base method.
+func (m *MockStorage) AcceptTerms(ctx context.Context, userID int32, version int, acceptedAt time.Time) (*models.TermsAcceptance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptTerms", ctx, userID, version, acceptedAt)
+	ret0, _ := ret[0].(*models.TermsAcceptance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptTerms indicates an expected call of AcceptTerms.
+func (mr *MockStorageMockRecorder) AcceptTerms(ctx, userID, version, acceptedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptTerms", reflect.TypeOf((*MockStorage)(nil).AcceptTerms), ctx, userID, version, acceptedAt)
+}
+
+// AccrueMonthlyCoins mocks base method.
+func (m *MockStorage) AccrueMonthlyCoins(ctx context.Context, period time.Time, amount int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccrueMonthlyCoins", ctx, period, amount)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AccrueMonthlyCoins indicates an expected call of AccrueMonthlyCoins.
+func (mr *MockStorageMockRecorder) AccrueMonthlyCoins(ctx, period, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccrueMonthlyCoins", reflect.TypeOf((*MockStorage)(nil).AccrueMonthlyCoins), ctx, period, amount)
+}
+
+// ArchiveTransfers mocks base method.
+func (m *MockStorage) ArchiveTransfers(ctx context.Context, before time.Time, limit int) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArchiveTransfers", ctx, before, limit)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ArchiveTransfers indicates an expected call of ArchiveTransfers.
+func (mr *MockStorageMockRecorder) ArchiveTransfers(ctx, before, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArchiveTransfers", reflect.TypeOf((*MockStorage)(nil).ArchiveTransfers), ctx, before, limit)
+}
+
+// BumpTokenVersion mocks base method.
+func (m *MockStorage) BumpTokenVersion(ctx context.Context, userID int32) (int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BumpTokenVersion", ctx, userID)
+	ret0, _ := ret[0].(int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BumpTokenVersion indicates an expected call of BumpTokenVersion.
+func (mr *MockStorageMockRecorder) BumpTokenVersion(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BumpTokenVersion", reflect.TypeOf((*MockStorage)(nil).BumpTokenVersion), ctx, userID)
+}
+
 // BuyItem mocks base method.
-func (m *MockStorage) BuyItem(ctx context.Context, userID int32, itemName string) error {
+func (m *MockStorage) BuyItem(ctx context.Context, userID int32, itemName string) (*models.PurchaseResult, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "BuyItem", ctx, userID, itemName)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*models.PurchaseResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // BuyItem indicates an expected call of BuyItem.
@@ -50,6 +149,65 @@ func (mr *MockStorageMockRecorder) BuyItem(ctx, userID, itemName interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyItem", reflect.TypeOf((*MockStorage)(nil).BuyItem), ctx, userID, itemName)
 }
 
+// BuyItemOnBehalf mocks base method.
+func (m *MockStorage) BuyItemOnBehalf(ctx context.Context, granteeID int32, grantor, itemName string, now time.Time) (*models.PurchaseResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BuyItemOnBehalf", ctx, granteeID, grantor, itemName, now)
+	ret0, _ := ret[0].(*models.PurchaseResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BuyItemOnBehalf indicates an expected call of BuyItemOnBehalf.
+func (mr *MockStorageMockRecorder) BuyItemOnBehalf(ctx, granteeID, grantor, itemName, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyItemOnBehalf", reflect.TypeOf((*MockStorage)(nil).BuyItemOnBehalf), ctx, granteeID, grantor, itemName, now)
+}
+
+// CancelScheduledTransfer mocks base method.
+func (m *MockStorage) CancelScheduledTransfer(ctx context.Context, userID int32, scheduledID int64, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelScheduledTransfer", ctx, userID, scheduledID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelScheduledTransfer indicates an expected call of CancelScheduledTransfer.
+func (mr *MockStorageMockRecorder) CancelScheduledTransfer(ctx, userID, scheduledID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelScheduledTransfer", reflect.TypeOf((*MockStorage)(nil).CancelScheduledTransfer), ctx, userID, scheduledID, now)
+}
+
+// CaptureHold mocks base method.
+func (m *MockStorage) CaptureHold(ctx context.Context, holdID int64) (*models.CoinHold, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CaptureHold", ctx, holdID)
+	ret0, _ := ret[0].(*models.CoinHold)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CaptureHold indicates an expected call of CaptureHold.
+func (mr *MockStorageMockRecorder) CaptureHold(ctx, holdID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CaptureHold", reflect.TypeOf((*MockStorage)(nil).CaptureHold), ctx, holdID)
+}
+
+// CheckInvariants mocks base method.
+func (m *MockStorage) CheckInvariants(ctx context.Context) (*models.InvariantReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckInvariants", ctx)
+	ret0, _ := ret[0].(*models.InvariantReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckInvariants indicates an expected call of CheckInvariants.
+func (mr *MockStorageMockRecorder) CheckInvariants(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckInvariants", reflect.TypeOf((*MockStorage)(nil).CheckInvariants), ctx)
+}
+
 // CheckUser mocks base method.
 func (m *MockStorage) CheckUser(ctx context.Context, user *models.User) (*models.User, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +223,21 @@ func (mr *MockStorageMockRecorder) CheckUser(ctx, user interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckUser", reflect.TypeOf((*MockStorage)(nil).CheckUser), ctx, user)
 }
 
+// ClaimIdempotencyKey mocks base method.
+func (m *MockStorage) ClaimIdempotencyKey(ctx context.Context, userID int32, key, fingerprint string, now, expiredAt time.Time) (*models.IdempotentResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimIdempotencyKey", ctx, userID, key, fingerprint, now, expiredAt)
+	ret0, _ := ret[0].(*models.IdempotentResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimIdempotencyKey indicates an expected call of ClaimIdempotencyKey.
+func (mr *MockStorageMockRecorder) ClaimIdempotencyKey(ctx, userID, key, fingerprint, now, expiredAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimIdempotencyKey", reflect.TypeOf((*MockStorage)(nil).ClaimIdempotencyKey), ctx, userID, key, fingerprint, now, expiredAt)
+}
+
 // Close mocks base method.
 func (m *MockStorage) Close() {
 	m.ctrl.T.Helper()
@@ -77,135 +250,1201 @@ func (mr *MockStorageMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorage)(nil).Close))
 }
 
-// CreateUser mocks base method.
-func (m *MockStorage) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+// ConsumeItem mocks base method.
+func (m *MockStorage) ConsumeItem(ctx context.Context, userID int32, itemName string, quantity int) (*models.InventoryItem, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", ctx, user)
-	ret0, _ := ret[0].(*models.User)
+	ret := m.ctrl.Call(m, "ConsumeItem", ctx, userID, itemName, quantity)
+	ret0, _ := ret[0].(*models.InventoryItem)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreateUser indicates an expected call of CreateUser.
-func (mr *MockStorageMockRecorder) CreateUser(ctx, user interface{}) *gomock.Call {
+// ConsumeItem indicates an expected call of ConsumeItem.
+func (mr *MockStorageMockRecorder) ConsumeItem(ctx, userID, itemName, quantity interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockStorage)(nil).CreateUser), ctx, user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeItem", reflect.TypeOf((*MockStorage)(nil).ConsumeItem), ctx, userID, itemName, quantity)
 }
 
-// GetCoinsTransactionInfo mocks base method.
-func (m *MockStorage) GetCoinsTransactionInfo(ctx context.Context, tx *sql.Tx, userID int32, username, query string) ([]models.TransactionDetail, error) {
+// CountActiveSessions mocks base method.
+func (m *MockStorage) CountActiveSessions(ctx context.Context, now time.Time) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCoinsTransactionInfo", ctx, tx, userID, username, query)
-	ret0, _ := ret[0].([]models.TransactionDetail)
+	ret := m.ctrl.Call(m, "CountActiveSessions", ctx, now)
+	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetCoinsTransactionInfo indicates an expected call of GetCoinsTransactionInfo.
-func (mr *MockStorageMockRecorder) GetCoinsTransactionInfo(ctx, tx, userID, username, query interface{}) *gomock.Call {
+// CountActiveSessions indicates an expected call of CountActiveSessions.
+func (mr *MockStorageMockRecorder) CountActiveSessions(ctx, now interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCoinsTransactionInfo", reflect.TypeOf((*MockStorage)(nil).GetCoinsTransactionInfo), ctx, tx, userID, username, query)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountActiveSessions", reflect.TypeOf((*MockStorage)(nil).CountActiveSessions), ctx, now)
 }
 
-// GetInfo mocks base method.
-func (m *MockStorage) GetInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
+// CountCoinHistory mocks base method.
+func (m *MockStorage) CountCoinHistory(ctx context.Context, userID int32) (int64, int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInfo", ctx, userID)
-	ret0, _ := ret[0].(*models.InfoResponse)
+	ret := m.ctrl.Call(m, "CountCoinHistory", ctx, userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CountCoinHistory indicates an expected call of CountCoinHistory.
+func (mr *MockStorageMockRecorder) CountCoinHistory(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCoinHistory", reflect.TypeOf((*MockStorage)(nil).CountCoinHistory), ctx, userID)
+}
+
+// CountUnreadNotifications mocks base method.
+func (m *MockStorage) CountUnreadNotifications(ctx context.Context, userID int32) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUnreadNotifications", ctx, userID)
+	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetInfo indicates an expected call of GetInfo.
-func (mr *MockStorageMockRecorder) GetInfo(ctx, userID interface{}) *gomock.Call {
+// CountUnreadNotifications indicates an expected call of CountUnreadNotifications.
+func (mr *MockStorageMockRecorder) CountUnreadNotifications(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockStorage)(nil).GetInfo), ctx, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUnreadNotifications", reflect.TypeOf((*MockStorage)(nil).CountUnreadNotifications), ctx, userID)
 }
 
-// GetItemPrice mocks base method.
-func (m *MockStorage) GetItemPrice(ctx context.Context, tx *sql.Tx, itemName string) (*models.Item, error) {
+// CreateCampaign mocks base method.
+func (m *MockStorage) CreateCampaign(ctx context.Context, campaign models.Campaign) (*models.Campaign, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetItemPrice", ctx, tx, itemName)
-	ret0, _ := ret[0].(*models.Item)
+	ret := m.ctrl.Call(m, "CreateCampaign", ctx, campaign)
+	ret0, _ := ret[0].(*models.Campaign)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetItemPrice indicates an expected call of GetItemPrice.
-func (mr *MockStorageMockRecorder) GetItemPrice(ctx, tx, itemName interface{}) *gomock.Call {
+// CreateCampaign indicates an expected call of CreateCampaign.
+func (mr *MockStorageMockRecorder) CreateCampaign(ctx, campaign interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemPrice", reflect.TypeOf((*MockStorage)(nil).GetItemPrice), ctx, tx, itemName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCampaign", reflect.TypeOf((*MockStorage)(nil).CreateCampaign), ctx, campaign)
 }
 
-// GetMerchPurchasesInfo mocks base method.
-func (m *MockStorage) GetMerchPurchasesInfo(ctx context.Context, tx *sql.Tx, userID int32) ([]models.InventoryItem, error) {
+// CreateDelegation mocks base method.
+func (m *MockStorage) CreateDelegation(ctx context.Context, grantorID int32, delegation models.Delegation) (*models.Delegation, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMerchPurchasesInfo", ctx, tx, userID)
-	ret0, _ := ret[0].([]models.InventoryItem)
+	ret := m.ctrl.Call(m, "CreateDelegation", ctx, grantorID, delegation)
+	ret0, _ := ret[0].(*models.Delegation)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetMerchPurchasesInfo indicates an expected call of GetMerchPurchasesInfo.
-func (mr *MockStorageMockRecorder) GetMerchPurchasesInfo(ctx, tx, userID interface{}) *gomock.Call {
+// CreateDelegation indicates an expected call of CreateDelegation.
+func (mr *MockStorageMockRecorder) CreateDelegation(ctx, grantorID, delegation interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMerchPurchasesInfo", reflect.TypeOf((*MockStorage)(nil).GetMerchPurchasesInfo), ctx, tx, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDelegation", reflect.TypeOf((*MockStorage)(nil).CreateDelegation), ctx, grantorID, delegation)
 }
 
-// GetUserID mocks base method.
-func (m *MockStorage) GetUserID(ctx context.Context, tx *sql.Tx, username string) (*models.User, error) {
+// CreateHold mocks base method.
+func (m *MockStorage) CreateHold(ctx context.Context, userID int32, amount int, reason string) (*models.CoinHold, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserID", ctx, tx, username)
+	ret := m.ctrl.Call(m, "CreateHold", ctx, userID, amount, reason)
+	ret0, _ := ret[0].(*models.CoinHold)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateHold indicates an expected call of CreateHold.
+func (mr *MockStorageMockRecorder) CreateHold(ctx, userID, amount, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateHold", reflect.TypeOf((*MockStorage)(nil).CreateHold), ctx, userID, amount, reason)
+}
+
+// CreateInviteCode mocks base method.
+func (m *MockStorage) CreateInviteCode(ctx context.Context, invite models.InviteCode, createdBy int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInviteCode", ctx, invite, createdBy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateInviteCode indicates an expected call of CreateInviteCode.
+func (mr *MockStorageMockRecorder) CreateInviteCode(ctx, invite, createdBy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInviteCode", reflect.TypeOf((*MockStorage)(nil).CreateInviteCode), ctx, invite, createdBy)
+}
+
+// CreatePersonalToken mocks base method.
+func (m *MockStorage) CreatePersonalToken(ctx context.Context, token models.PersonalToken, hash string) (*models.PersonalToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePersonalToken", ctx, token, hash)
+	ret0, _ := ret[0].(*models.PersonalToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePersonalToken indicates an expected call of CreatePersonalToken.
+func (mr *MockStorageMockRecorder) CreatePersonalToken(ctx, token, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePersonalToken", reflect.TypeOf((*MockStorage)(nil).CreatePersonalToken), ctx, token, hash)
+}
+
+// CreatePromotion mocks base method.
+func (m *MockStorage) CreatePromotion(ctx context.Context, promotion models.Promotion) (*models.Promotion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePromotion", ctx, promotion)
+	ret0, _ := ret[0].(*models.Promotion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePromotion indicates an expected call of CreatePromotion.
+func (mr *MockStorageMockRecorder) CreatePromotion(ctx, promotion interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePromotion", reflect.TypeOf((*MockStorage)(nil).CreatePromotion), ctx, promotion)
+}
+
+// CreateScheduledTransfer mocks base method.
+func (m *MockStorage) CreateScheduledTransfer(ctx context.Context, userID int32, req models.SendCoinRequest, executeAt time.Time) (*models.ScheduledTransfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateScheduledTransfer", ctx, userID, req, executeAt)
+	ret0, _ := ret[0].(*models.ScheduledTransfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateScheduledTransfer indicates an expected call of CreateScheduledTransfer.
+func (mr *MockStorageMockRecorder) CreateScheduledTransfer(ctx, userID, req, executeAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateScheduledTransfer", reflect.TypeOf((*MockStorage)(nil).CreateScheduledTransfer), ctx, userID, req, executeAt)
+}
+
+// CreateSession mocks base method.
+func (m *MockStorage) CreateSession(ctx context.Context, session models.Session, limit int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", ctx, session, limit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockStorageMockRecorder) CreateSession(ctx, session, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockStorage)(nil).CreateSession), ctx, session, limit)
+}
+
+// CreateUser mocks base method.
+func (m *MockStorage) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", ctx, user)
 	ret0, _ := ret[0].(*models.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserID indicates an expected call of GetUserID.
-func (mr *MockStorageMockRecorder) GetUserID(ctx, tx, username interface{}) *gomock.Call {
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockStorageMockRecorder) CreateUser(ctx, user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserID", reflect.TypeOf((*MockStorage)(nil).GetUserID), ctx, tx, username)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockStorage)(nil).CreateUser), ctx, user)
 }
 
-// GetUserInfo mocks base method.
-func (m *MockStorage) GetUserInfo(ctx context.Context, tx *sql.Tx, userID int32) (*models.User, error) {
+// CreateUserWithInvite mocks base method.
+func (m *MockStorage) CreateUserWithInvite(ctx context.Context, user *models.User, code string, now time.Time) (*models.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserInfo", ctx, tx, userID)
+	ret := m.ctrl.Call(m, "CreateUserWithInvite", ctx, user, code, now)
 	ret0, _ := ret[0].(*models.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserInfo indicates an expected call of GetUserInfo.
-func (mr *MockStorageMockRecorder) GetUserInfo(ctx, tx, userID interface{}) *gomock.Call {
+// CreateUserWithInvite indicates an expected call of CreateUserWithInvite.
+func (mr *MockStorageMockRecorder) CreateUserWithInvite(ctx, user, code, now interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserInfo", reflect.TypeOf((*MockStorage)(nil).GetUserInfo), ctx, tx, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserWithInvite", reflect.TypeOf((*MockStorage)(nil).CreateUserWithInvite), ctx, user, code, now)
 }
 
-// TransferCoins mocks base method.
-func (m *MockStorage) TransferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) error {
+// CreateUsersBulk mocks base method.
+func (m *MockStorage) CreateUsersBulk(ctx context.Context, users []models.User) ([]models.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "TransferCoins", ctx, userID, req)
+	ret := m.ctrl.Call(m, "CreateUsersBulk", ctx, users)
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUsersBulk indicates an expected call of CreateUsersBulk.
+func (mr *MockStorageMockRecorder) CreateUsersBulk(ctx, users interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUsersBulk", reflect.TypeOf((*MockStorage)(nil).CreateUsersBulk), ctx, users)
+}
+
+// DeleteCampaign mocks base method.
+func (m *MockStorage) DeleteCampaign(ctx context.Context, campaignID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCampaign", ctx, campaignID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// TransferCoins indicates an expected call of TransferCoins.
-func (mr *MockStorageMockRecorder) TransferCoins(ctx, userID, req interface{}) *gomock.Call {
+// DeleteCampaign indicates an expected call of DeleteCampaign.
+func (mr *MockStorageMockRecorder) DeleteCampaign(ctx, campaignID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferCoins", reflect.TypeOf((*MockStorage)(nil).TransferCoins), ctx, userID, req)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCampaign", reflect.TypeOf((*MockStorage)(nil).DeleteCampaign), ctx, campaignID)
 }
 
-// UpdateUserCoins mocks base method.
-func (m *MockStorage) UpdateUserCoins(ctx context.Context, tx *sql.Tx, userID int32, coins int) error {
+// DeletePromotion mocks base method.
+func (m *MockStorage) DeletePromotion(ctx context.Context, promotionID int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateUserCoins", ctx, tx, userID, coins)
+	ret := m.ctrl.Call(m, "DeletePromotion", ctx, promotionID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateUserCoins indicates an expected call of UpdateUserCoins.
-func (mr *MockStorageMockRecorder) UpdateUserCoins(ctx, tx, userID, coins interface{}) *gomock.Call {
+// DeletePromotion indicates an expected call of DeletePromotion.
+func (mr *MockStorageMockRecorder) DeletePromotion(ctx, promotionID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserCoins", reflect.TypeOf((*MockStorage)(nil).UpdateUserCoins), ctx, tx, userID, coins)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePromotion", reflect.TypeOf((*MockStorage)(nil).DeletePromotion), ctx, promotionID)
+}
+
+// DeleteUser mocks base method.
+func (m *MockStorage) DeleteUser(ctx context.Context, userID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockStorageMockRecorder) DeleteUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockStorage)(nil).DeleteUser), ctx, userID)
+}
+
+// ExecuteScheduledTransfer mocks base method.
+func (m *MockStorage) ExecuteScheduledTransfer(ctx context.Context, scheduledID int64, now time.Time) (*models.ScheduledTransfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecuteScheduledTransfer", ctx, scheduledID, now)
+	ret0, _ := ret[0].(*models.ScheduledTransfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecuteScheduledTransfer indicates an expected call of ExecuteScheduledTransfer.
+func (mr *MockStorageMockRecorder) ExecuteScheduledTransfer(ctx, scheduledID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteScheduledTransfer", reflect.TypeOf((*MockStorage)(nil).ExecuteScheduledTransfer), ctx, scheduledID, now)
+}
+
+// GetAccrualEntry mocks base method.
+func (m *MockStorage) GetAccrualEntry(ctx context.Context, period time.Time, userID int32) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccrualEntry", ctx, period, userID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccrualEntry indicates an expected call of GetAccrualEntry.
+func (mr *MockStorageMockRecorder) GetAccrualEntry(ctx, period, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccrualEntry", reflect.TypeOf((*MockStorage)(nil).GetAccrualEntry), ctx, period, userID)
+}
+
+// GetActiveHoldsAmount mocks base method.
+func (m *MockStorage) GetActiveHoldsAmount(ctx context.Context, tx storage.Tx, userID int32) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetActiveHoldsAmount", ctx, tx, userID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetActiveHoldsAmount indicates an expected call of GetActiveHoldsAmount.
+func (mr *MockStorageMockRecorder) GetActiveHoldsAmount(ctx, tx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetActiveHoldsAmount", reflect.TypeOf((*MockStorage)(nil).GetActiveHoldsAmount), ctx, tx, userID)
+}
+
+// GetActiveSessions mocks base method.
+func (m *MockStorage) GetActiveSessions(ctx context.Context, userID int32, now time.Time) ([]models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetActiveSessions", ctx, userID, now)
+	ret0, _ := ret[0].([]models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetActiveSessions indicates an expected call of GetActiveSessions.
+func (mr *MockStorageMockRecorder) GetActiveSessions(ctx, userID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetActiveSessions", reflect.TypeOf((*MockStorage)(nil).GetActiveSessions), ctx, userID, now)
+}
+
+// GetCampaign mocks base method.
+func (m *MockStorage) GetCampaign(ctx context.Context, campaignID int64) (*models.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaign", ctx, campaignID)
+	ret0, _ := ret[0].(*models.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaign indicates an expected call of GetCampaign.
+func (mr *MockStorageMockRecorder) GetCampaign(ctx, campaignID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaign", reflect.TypeOf((*MockStorage)(nil).GetCampaign), ctx, campaignID)
+}
+
+// GetCampaigns mocks base method.
+func (m *MockStorage) GetCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaigns", ctx)
+	ret0, _ := ret[0].([]models.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaigns indicates an expected call of GetCampaigns.
+func (mr *MockStorageMockRecorder) GetCampaigns(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaigns", reflect.TypeOf((*MockStorage)(nil).GetCampaigns), ctx)
+}
+
+// GetCatalogLastModified mocks base method.
+func (m *MockStorage) GetCatalogLastModified(ctx context.Context) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCatalogLastModified", ctx)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCatalogLastModified indicates an expected call of GetCatalogLastModified.
+func (mr *MockStorageMockRecorder) GetCatalogLastModified(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCatalogLastModified", reflect.TypeOf((*MockStorage)(nil).GetCatalogLastModified), ctx)
+}
+
+// GetCatalogWithAffordability mocks base method.
+func (m *MockStorage) GetCatalogWithAffordability(ctx context.Context, userID int32) ([]models.AffordableCatalogItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCatalogWithAffordability", ctx, userID)
+	ret0, _ := ret[0].([]models.AffordableCatalogItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCatalogWithAffordability indicates an expected call of GetCatalogWithAffordability.
+func (mr *MockStorageMockRecorder) GetCatalogWithAffordability(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCatalogWithAffordability", reflect.TypeOf((*MockStorage)(nil).GetCatalogWithAffordability), ctx, userID)
+}
+
+// GetCoinsTransactionInfo mocks base method.
+func (m *MockStorage) GetCoinsTransactionInfo(ctx context.Context, tx storage.Tx, userID int32, username, query string) ([]models.TransactionDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCoinsTransactionInfo", ctx, tx, userID, username, query)
+	ret0, _ := ret[0].([]models.TransactionDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCoinsTransactionInfo indicates an expected call of GetCoinsTransactionInfo.
+func (mr *MockStorageMockRecorder) GetCoinsTransactionInfo(ctx, tx, userID, username, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCoinsTransactionInfo", reflect.TypeOf((*MockStorage)(nil).GetCoinsTransactionInfo), ctx, tx, userID, username, query)
+}
+
+// GetDelegations mocks base method.
+func (m *MockStorage) GetDelegations(ctx context.Context, userID int32) (*models.DelegationsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDelegations", ctx, userID)
+	ret0, _ := ret[0].(*models.DelegationsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDelegations indicates an expected call of GetDelegations.
+func (mr *MockStorageMockRecorder) GetDelegations(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDelegations", reflect.TypeOf((*MockStorage)(nil).GetDelegations), ctx, userID)
+}
+
+// GetDueScheduledTransfers mocks base method.
+func (m *MockStorage) GetDueScheduledTransfers(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDueScheduledTransfers", ctx, now, limit)
+	ret0, _ := ret[0].([]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDueScheduledTransfers indicates an expected call of GetDueScheduledTransfers.
+func (mr *MockStorageMockRecorder) GetDueScheduledTransfers(ctx, now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDueScheduledTransfers", reflect.TypeOf((*MockStorage)(nil).GetDueScheduledTransfers), ctx, now, limit)
+}
+
+// GetEconomyStats mocks base method.
+func (m *MockStorage) GetEconomyStats(ctx context.Context, from, to time.Time) (*models.EconomyStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEconomyStats", ctx, from, to)
+	ret0, _ := ret[0].(*models.EconomyStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEconomyStats indicates an expected call of GetEconomyStats.
+func (mr *MockStorageMockRecorder) GetEconomyStats(ctx, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEconomyStats", reflect.TypeOf((*MockStorage)(nil).GetEconomyStats), ctx, from, to)
+}
+
+// GetFailedPurchaseStats mocks base method.
+func (m *MockStorage) GetFailedPurchaseStats(ctx context.Context, from, to time.Time) ([]models.FailedPurchaseStat, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFailedPurchaseStats", ctx, from, to)
+	ret0, _ := ret[0].([]models.FailedPurchaseStat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFailedPurchaseStats indicates an expected call of GetFailedPurchaseStats.
+func (mr *MockStorageMockRecorder) GetFailedPurchaseStats(ctx, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFailedPurchaseStats", reflect.TypeOf((*MockStorage)(nil).GetFailedPurchaseStats), ctx, from, to)
+}
+
+// GetInfo mocks base method.
+func (m *MockStorage) GetInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInfo", ctx, userID)
+	ret0, _ := ret[0].(*models.InfoResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInfo indicates an expected call of GetInfo.
+func (mr *MockStorageMockRecorder) GetInfo(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockStorage)(nil).GetInfo), ctx, userID)
+}
+
+// GetInfoWithHistoryLimit mocks base method.
+func (m *MockStorage) GetInfoWithHistoryLimit(ctx context.Context, userID int32, limit int) (*models.InfoResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInfoWithHistoryLimit", ctx, userID, limit)
+	ret0, _ := ret[0].(*models.InfoResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInfoWithHistoryLimit indicates an expected call of GetInfoWithHistoryLimit.
+func (mr *MockStorageMockRecorder) GetInfoWithHistoryLimit(ctx, userID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfoWithHistoryLimit", reflect.TypeOf((*MockStorage)(nil).GetInfoWithHistoryLimit), ctx, userID, limit)
+}
+
+// GetItemByID mocks base method.
+func (m *MockStorage) GetItemByID(ctx context.Context, itemID int) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItemByID", ctx, itemID)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItemByID indicates an expected call of GetItemByID.
+func (mr *MockStorageMockRecorder) GetItemByID(ctx, itemID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemByID", reflect.TypeOf((*MockStorage)(nil).GetItemByID), ctx, itemID)
+}
+
+// GetItemPrice mocks base method.
+func (m *MockStorage) GetItemPrice(ctx context.Context, tx storage.Tx, itemName string) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItemPrice", ctx, tx, itemName)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItemPrice indicates an expected call of GetItemPrice.
+func (mr *MockStorageMockRecorder) GetItemPrice(ctx, tx, itemName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemPrice", reflect.TypeOf((*MockStorage)(nil).GetItemPrice), ctx, tx, itemName)
+}
+
+// GetMerchCatalog mocks base method.
+func (m *MockStorage) GetMerchCatalog(ctx context.Context) ([]models.CatalogItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMerchCatalog", ctx)
+	ret0, _ := ret[0].([]models.CatalogItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMerchCatalog indicates an expected call of GetMerchCatalog.
+func (mr *MockStorageMockRecorder) GetMerchCatalog(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMerchCatalog", reflect.TypeOf((*MockStorage)(nil).GetMerchCatalog), ctx)
+}
+
+// GetMerchPurchasesInfo mocks base method.
+func (m *MockStorage) GetMerchPurchasesInfo(ctx context.Context, tx storage.Tx, userID int32) ([]models.InventoryItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMerchPurchasesInfo", ctx, tx, userID)
+	ret0, _ := ret[0].([]models.InventoryItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMerchPurchasesInfo indicates an expected call of GetMerchPurchasesInfo.
+func (mr *MockStorageMockRecorder) GetMerchPurchasesInfo(ctx, tx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMerchPurchasesInfo", reflect.TypeOf((*MockStorage)(nil).GetMerchPurchasesInfo), ctx, tx, userID)
+}
+
+// GetMutedNotificationCategories mocks base method.
+func (m *MockStorage) GetMutedNotificationCategories(ctx context.Context, userID int32) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMutedNotificationCategories", ctx, userID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMutedNotificationCategories indicates an expected call of GetMutedNotificationCategories.
+func (mr *MockStorageMockRecorder) GetMutedNotificationCategories(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMutedNotificationCategories", reflect.TypeOf((*MockStorage)(nil).GetMutedNotificationCategories), ctx, userID)
+}
+
+// GetNotifications mocks base method.
+func (m *MockStorage) GetNotifications(ctx context.Context, userID int32, filter models.NotificationsFilter) ([]models.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNotifications", ctx, userID, filter)
+	ret0, _ := ret[0].([]models.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNotifications indicates an expected call of GetNotifications.
+func (mr *MockStorageMockRecorder) GetNotifications(ctx, userID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotifications", reflect.TypeOf((*MockStorage)(nil).GetNotifications), ctx, userID, filter)
+}
+
+// GetPartialInfo mocks base method.
+func (m *MockStorage) GetPartialInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPartialInfo", ctx, userID)
+	ret0, _ := ret[0].(*models.InfoResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPartialInfo indicates an expected call of GetPartialInfo.
+func (mr *MockStorageMockRecorder) GetPartialInfo(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartialInfo", reflect.TypeOf((*MockStorage)(nil).GetPartialInfo), ctx, userID)
+}
+
+// GetPersonalTokenByHash mocks base method.
+func (m *MockStorage) GetPersonalTokenByHash(ctx context.Context, hash string, now time.Time) (*models.PersonalToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPersonalTokenByHash", ctx, hash, now)
+	ret0, _ := ret[0].(*models.PersonalToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPersonalTokenByHash indicates an expected call of GetPersonalTokenByHash.
+func (mr *MockStorageMockRecorder) GetPersonalTokenByHash(ctx, hash, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPersonalTokenByHash", reflect.TypeOf((*MockStorage)(nil).GetPersonalTokenByHash), ctx, hash, now)
+}
+
+// GetPersonalTokens mocks base method.
+func (m *MockStorage) GetPersonalTokens(ctx context.Context, userID int32) ([]models.PersonalToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPersonalTokens", ctx, userID)
+	ret0, _ := ret[0].([]models.PersonalToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPersonalTokens indicates an expected call of GetPersonalTokens.
+func (mr *MockStorageMockRecorder) GetPersonalTokens(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPersonalTokens", reflect.TypeOf((*MockStorage)(nil).GetPersonalTokens), ctx, userID)
+}
+
+// GetPromotion mocks base method.
+func (m *MockStorage) GetPromotion(ctx context.Context, promotionID int64) (*models.Promotion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPromotion", ctx, promotionID)
+	ret0, _ := ret[0].(*models.Promotion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPromotion indicates an expected call of GetPromotion.
+func (mr *MockStorageMockRecorder) GetPromotion(ctx, promotionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPromotion", reflect.TypeOf((*MockStorage)(nil).GetPromotion), ctx, promotionID)
+}
+
+// GetPromotions mocks base method.
+func (m *MockStorage) GetPromotions(ctx context.Context) ([]models.Promotion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPromotions", ctx)
+	ret0, _ := ret[0].([]models.Promotion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPromotions indicates an expected call of GetPromotions.
+func (mr *MockStorageMockRecorder) GetPromotions(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPromotions", reflect.TypeOf((*MockStorage)(nil).GetPromotions), ctx)
+}
+
+// GetReceipt mocks base method.
+func (m *MockStorage) GetReceipt(ctx context.Context, userID int32, number string) (*models.Receipt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReceipt", ctx, userID, number)
+	ret0, _ := ret[0].(*models.Receipt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReceipt indicates an expected call of GetReceipt.
+func (mr *MockStorageMockRecorder) GetReceipt(ctx, userID, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReceipt", reflect.TypeOf((*MockStorage)(nil).GetReceipt), ctx, userID, number)
+}
+
+// GetScheduledTransfers mocks base method.
+func (m *MockStorage) GetScheduledTransfers(ctx context.Context, userID int32) ([]models.ScheduledTransfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScheduledTransfers", ctx, userID)
+	ret0, _ := ret[0].([]models.ScheduledTransfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScheduledTransfers indicates an expected call of GetScheduledTransfers.
+func (mr *MockStorageMockRecorder) GetScheduledTransfers(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScheduledTransfers", reflect.TypeOf((*MockStorage)(nil).GetScheduledTransfers), ctx, userID)
+}
+
+// GetSentGiftsInfo mocks base method.
+func (m *MockStorage) GetSentGiftsInfo(ctx context.Context, tx storage.Tx, userID int32) ([]models.GiftDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSentGiftsInfo", ctx, tx, userID)
+	ret0, _ := ret[0].([]models.GiftDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSentGiftsInfo indicates an expected call of GetSentGiftsInfo.
+func (mr *MockStorageMockRecorder) GetSentGiftsInfo(ctx, tx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSentGiftsInfo", reflect.TypeOf((*MockStorage)(nil).GetSentGiftsInfo), ctx, tx, userID)
+}
+
+// GetTermsAcceptance mocks base method.
+func (m *MockStorage) GetTermsAcceptance(ctx context.Context, userID int32) (*models.TermsAcceptance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTermsAcceptance", ctx, userID)
+	ret0, _ := ret[0].(*models.TermsAcceptance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTermsAcceptance indicates an expected call of GetTermsAcceptance.
+func (mr *MockStorageMockRecorder) GetTermsAcceptance(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTermsAcceptance", reflect.TypeOf((*MockStorage)(nil).GetTermsAcceptance), ctx, userID)
+}
+
+// GetTokenVersion mocks base method.
+func (m *MockStorage) GetTokenVersion(ctx context.Context, userID int32) (int32, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenVersion", ctx, userID)
+	ret0, _ := ret[0].(int32)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTokenVersion indicates an expected call of GetTokenVersion.
+func (mr *MockStorageMockRecorder) GetTokenVersion(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenVersion", reflect.TypeOf((*MockStorage)(nil).GetTokenVersion), ctx, userID)
+}
+
+// GetTransfer mocks base method.
+func (m *MockStorage) GetTransfer(ctx context.Context, userID int32, transferID int64) (*models.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfer", ctx, userID, transferID)
+	ret0, _ := ret[0].(*models.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfer indicates an expected call of GetTransfer.
+func (mr *MockStorageMockRecorder) GetTransfer(ctx, userID, transferID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfer", reflect.TypeOf((*MockStorage)(nil).GetTransfer), ctx, userID, transferID)
+}
+
+// GetTransfers mocks base method.
+func (m *MockStorage) GetTransfers(ctx context.Context, userID int32, filter models.TransfersFilter) ([]models.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfers", ctx, userID, filter)
+	ret0, _ := ret[0].([]models.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfers indicates an expected call of GetTransfers.
+func (mr *MockStorageMockRecorder) GetTransfers(ctx, userID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfers", reflect.TypeOf((*MockStorage)(nil).GetTransfers), ctx, userID, filter)
+}
+
+// GetUserActivity mocks base method.
+func (m *MockStorage) GetUserActivity(ctx context.Context, userID int32, filter models.ActivityFilter) ([]models.APIActivity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserActivity", ctx, userID, filter)
+	ret0, _ := ret[0].([]models.APIActivity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserActivity indicates an expected call of GetUserActivity.
+func (mr *MockStorageMockRecorder) GetUserActivity(ctx, userID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserActivity", reflect.TypeOf((*MockStorage)(nil).GetUserActivity), ctx, userID, filter)
+}
+
+// GetUserID mocks base method.
+func (m *MockStorage) GetUserID(ctx context.Context, tx storage.Tx, username string) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserID", ctx, tx, username)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserID indicates an expected call of GetUserID.
+func (mr *MockStorageMockRecorder) GetUserID(ctx, tx, username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserID", reflect.TypeOf((*MockStorage)(nil).GetUserID), ctx, tx, username)
+}
+
+// GetUserInfo mocks base method.
+func (m *MockStorage) GetUserInfo(ctx context.Context, tx storage.Tx, userID int32) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserInfo", ctx, tx, userID)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserInfo indicates an expected call of GetUserInfo.
+func (mr *MockStorageMockRecorder) GetUserInfo(ctx, tx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserInfo", reflect.TypeOf((*MockStorage)(nil).GetUserInfo), ctx, tx, userID)
+}
+
+// GiftItem mocks base method.
+func (m *MockStorage) GiftItem(ctx context.Context, userID int32, itemName string, req models.GiftRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GiftItem", ctx, userID, itemName, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GiftItem indicates an expected call of GiftItem.
+func (mr *MockStorageMockRecorder) GiftItem(ctx, userID, itemName, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GiftItem", reflect.TypeOf((*MockStorage)(nil).GiftItem), ctx, userID, itemName, req)
+}
+
+// IsSessionActive mocks base method.
+func (m *MockStorage) IsSessionActive(ctx context.Context, userID int32, sessionID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsSessionActive", ctx, userID, sessionID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsSessionActive indicates an expected call of IsSessionActive.
+func (mr *MockStorageMockRecorder) IsSessionActive(ctx, userID, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsSessionActive", reflect.TypeOf((*MockStorage)(nil).IsSessionActive), ctx, userID, sessionID)
+}
+
+// IsUserActive mocks base method.
+func (m *MockStorage) IsUserActive(ctx context.Context, userID int32) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsUserActive", ctx, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsUserActive indicates an expected call of IsUserActive.
+func (mr *MockStorageMockRecorder) IsUserActive(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsUserActive", reflect.TypeOf((*MockStorage)(nil).IsUserActive), ctx, userID)
+}
+
+// IsUserAdmin mocks base method.
+func (m *MockStorage) IsUserAdmin(ctx context.Context, userID int32) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsUserAdmin", ctx, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsUserAdmin indicates an expected call of IsUserAdmin.
+func (mr *MockStorageMockRecorder) IsUserAdmin(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsUserAdmin", reflect.TypeOf((*MockStorage)(nil).IsUserAdmin), ctx, userID)
+}
+
+// MarkAllNotificationsRead mocks base method.
+func (m *MockStorage) MarkAllNotificationsRead(ctx context.Context, userID int32, now time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkAllNotificationsRead", ctx, userID, now)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkAllNotificationsRead indicates an expected call of MarkAllNotificationsRead.
+func (mr *MockStorageMockRecorder) MarkAllNotificationsRead(ctx, userID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkAllNotificationsRead", reflect.TypeOf((*MockStorage)(nil).MarkAllNotificationsRead), ctx, userID, now)
+}
+
+// MarkNotificationRead mocks base method.
+func (m *MockStorage) MarkNotificationRead(ctx context.Context, userID int32, notificationID int64, now time.Time) (*models.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkNotificationRead", ctx, userID, notificationID, now)
+	ret0, _ := ret[0].(*models.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkNotificationRead indicates an expected call of MarkNotificationRead.
+func (mr *MockStorageMockRecorder) MarkNotificationRead(ctx, userID, notificationID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkNotificationRead", reflect.TypeOf((*MockStorage)(nil).MarkNotificationRead), ctx, userID, notificationID, now)
+}
+
+// PreviewTransfer mocks base method.
+func (m *MockStorage) PreviewTransfer(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferPreview, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreviewTransfer", ctx, userID, req)
+	ret0, _ := ret[0].(*models.TransferPreview)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreviewTransfer indicates an expected call of PreviewTransfer.
+func (mr *MockStorageMockRecorder) PreviewTransfer(ctx, userID, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreviewTransfer", reflect.TypeOf((*MockStorage)(nil).PreviewTransfer), ctx, userID, req)
+}
+
+// ReconcileInventoryCounts mocks base method.
+func (m *MockStorage) ReconcileInventoryCounts(ctx context.Context, repair bool) ([]models.InventoryDrift, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileInventoryCounts", ctx, repair)
+	ret0, _ := ret[0].([]models.InventoryDrift)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileInventoryCounts indicates an expected call of ReconcileInventoryCounts.
+func (mr *MockStorageMockRecorder) ReconcileInventoryCounts(ctx, repair interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileInventoryCounts", reflect.TypeOf((*MockStorage)(nil).ReconcileInventoryCounts), ctx, repair)
+}
+
+// RecordAPIActivity mocks base method.
+func (m *MockStorage) RecordAPIActivity(ctx context.Context, activity models.APIActivity) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordAPIActivity", ctx, activity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordAPIActivity indicates an expected call of RecordAPIActivity.
+func (mr *MockStorageMockRecorder) RecordAPIActivity(ctx, activity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordAPIActivity", reflect.TypeOf((*MockStorage)(nil).RecordAPIActivity), ctx, activity)
+}
+
+// RecordFailedPurchase mocks base method.
+func (m *MockStorage) RecordFailedPurchase(ctx context.Context, purchase models.FailedPurchase) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordFailedPurchase", ctx, purchase)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordFailedPurchase indicates an expected call of RecordFailedPurchase.
+func (mr *MockStorageMockRecorder) RecordFailedPurchase(ctx, purchase interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordFailedPurchase", reflect.TypeOf((*MockStorage)(nil).RecordFailedPurchase), ctx, purchase)
+}
+
+// RedeemReceipt mocks base method.
+func (m *MockStorage) RedeemReceipt(ctx context.Context, adminID int32, number string, now time.Time) (*models.Receipt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RedeemReceipt", ctx, adminID, number, now)
+	ret0, _ := ret[0].(*models.Receipt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RedeemReceipt indicates an expected call of RedeemReceipt.
+func (mr *MockStorageMockRecorder) RedeemReceipt(ctx, adminID, number, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RedeemReceipt", reflect.TypeOf((*MockStorage)(nil).RedeemReceipt), ctx, adminID, number, now)
+}
+
+// ReleaseHold mocks base method.
+func (m *MockStorage) ReleaseHold(ctx context.Context, holdID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseHold", ctx, holdID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseHold indicates an expected call of ReleaseHold.
+func (mr *MockStorageMockRecorder) ReleaseHold(ctx, holdID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseHold", reflect.TypeOf((*MockStorage)(nil).ReleaseHold), ctx, holdID)
+}
+
+// ReserveDataExport mocks base method.
+func (m *MockStorage) ReserveDataExport(ctx context.Context, userID int32, now time.Time, interval time.Duration) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveDataExport", ctx, userID, now, interval)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReserveDataExport indicates an expected call of ReserveDataExport.
+func (mr *MockStorageMockRecorder) ReserveDataExport(ctx, userID, now, interval interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveDataExport", reflect.TypeOf((*MockStorage)(nil).ReserveDataExport), ctx, userID, now, interval)
+}
+
+// ReverseTransfer mocks base method.
+func (m *MockStorage) ReverseTransfer(ctx context.Context, adminID int32, transferID int64, partial bool, now time.Time) (*models.TransferReversal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseTransfer", ctx, adminID, transferID, partial, now)
+	ret0, _ := ret[0].(*models.TransferReversal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseTransfer indicates an expected call of ReverseTransfer.
+func (mr *MockStorageMockRecorder) ReverseTransfer(ctx, adminID, transferID, partial, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseTransfer", reflect.TypeOf((*MockStorage)(nil).ReverseTransfer), ctx, adminID, transferID, partial, now)
+}
+
+// RevokeDelegation mocks base method.
+func (m *MockStorage) RevokeDelegation(ctx context.Context, grantorID int32, delegationID int64, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeDelegation", ctx, grantorID, delegationID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeDelegation indicates an expected call of RevokeDelegation.
+func (mr *MockStorageMockRecorder) RevokeDelegation(ctx, grantorID, delegationID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeDelegation", reflect.TypeOf((*MockStorage)(nil).RevokeDelegation), ctx, grantorID, delegationID, now)
+}
+
+// RevokePersonalToken mocks base method.
+func (m *MockStorage) RevokePersonalToken(ctx context.Context, userID int32, tokenID int64, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokePersonalToken", ctx, userID, tokenID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokePersonalToken indicates an expected call of RevokePersonalToken.
+func (mr *MockStorageMockRecorder) RevokePersonalToken(ctx, userID, tokenID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokePersonalToken", reflect.TypeOf((*MockStorage)(nil).RevokePersonalToken), ctx, userID, tokenID, now)
+}
+
+// RevokeSession mocks base method.
+func (m *MockStorage) RevokeSession(ctx context.Context, userID int32, sessionID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, userID, sessionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockStorageMockRecorder) RevokeSession(ctx, userID, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockStorage)(nil).RevokeSession), ctx, userID, sessionID)
+}
+
+// SaveIdempotentResponse mocks base method.
+func (m *MockStorage) SaveIdempotentResponse(ctx context.Context, userID int32, key string, response models.IdempotentResponse) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdempotentResponse", ctx, userID, key, response)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdempotentResponse indicates an expected call of SaveIdempotentResponse.
+func (mr *MockStorageMockRecorder) SaveIdempotentResponse(ctx, userID, key, response interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdempotentResponse", reflect.TypeOf((*MockStorage)(nil).SaveIdempotentResponse), ctx, userID, key, response)
+}
+
+// SetMerchCategory mocks base method.
+func (m *MockStorage) SetMerchCategory(ctx context.Context, itemName, category string) (*models.MerchCategory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMerchCategory", ctx, itemName, category)
+	ret0, _ := ret[0].(*models.MerchCategory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetMerchCategory indicates an expected call of SetMerchCategory.
+func (mr *MockStorageMockRecorder) SetMerchCategory(ctx, itemName, category interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMerchCategory", reflect.TypeOf((*MockStorage)(nil).SetMerchCategory), ctx, itemName, category)
+}
+
+// SetMutedNotificationCategories mocks base method.
+func (m *MockStorage) SetMutedNotificationCategories(ctx context.Context, userID int32, categories []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMutedNotificationCategories", ctx, userID, categories)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMutedNotificationCategories indicates an expected call of SetMutedNotificationCategories.
+func (mr *MockStorageMockRecorder) SetMutedNotificationCategories(ctx, userID, categories interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMutedNotificationCategories", reflect.TypeOf((*MockStorage)(nil).SetMutedNotificationCategories), ctx, userID, categories)
+}
+
+// StreamCoinHistory mocks base method.
+func (m *MockStorage) StreamCoinHistory(ctx context.Context, userID int32, fn func(models.TransactionDetail) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamCoinHistory", ctx, userID, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamCoinHistory indicates an expected call of StreamCoinHistory.
+func (mr *MockStorageMockRecorder) StreamCoinHistory(ctx, userID, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamCoinHistory", reflect.TypeOf((*MockStorage)(nil).StreamCoinHistory), ctx, userID, fn)
+}
+
+// StreamUserExport mocks base method.
+func (m *MockStorage) StreamUserExport(ctx context.Context, userID int32, fn func(string, any) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamUserExport", ctx, userID, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamUserExport indicates an expected call of StreamUserExport.
+func (mr *MockStorageMockRecorder) StreamUserExport(ctx, userID, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamUserExport", reflect.TypeOf((*MockStorage)(nil).StreamUserExport), ctx, userID, fn)
+}
+
+// TransferCoins mocks base method.
+func (m *MockStorage) TransferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferCoins", ctx, userID, req)
+	ret0, _ := ret[0].(*models.TransferResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TransferCoins indicates an expected call of TransferCoins.
+func (mr *MockStorageMockRecorder) TransferCoins(ctx, userID, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferCoins", reflect.TypeOf((*MockStorage)(nil).TransferCoins), ctx, userID, req)
+}
+
+// UpdateCampaign mocks base method.
+func (m *MockStorage) UpdateCampaign(ctx context.Context, campaign models.Campaign) (*models.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCampaign", ctx, campaign)
+	ret0, _ := ret[0].(*models.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateCampaign indicates an expected call of UpdateCampaign.
+func (mr *MockStorageMockRecorder) UpdateCampaign(ctx, campaign interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCampaign", reflect.TypeOf((*MockStorage)(nil).UpdateCampaign), ctx, campaign)
+}
+
+// UpdatePromotion mocks base method.
+func (m *MockStorage) UpdatePromotion(ctx context.Context, promotion models.Promotion) (*models.Promotion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePromotion", ctx, promotion)
+	ret0, _ := ret[0].(*models.Promotion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdatePromotion indicates an expected call of UpdatePromotion.
+func (mr *MockStorageMockRecorder) UpdatePromotion(ctx, promotion interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePromotion", reflect.TypeOf((*MockStorage)(nil).UpdatePromotion), ctx, promotion)
+}
+
+// UpdateUserCoins mocks base method.
+func (m *MockStorage) UpdateUserCoins(ctx context.Context, tx storage.Tx, userID int32, coins int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserCoins", ctx, tx, userID, coins)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserCoins indicates an expected call of UpdateUserCoins.
+func (mr *MockStorageMockRecorder) UpdateUserCoins(ctx, tx, userID, coins interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserCoins", reflect.TypeOf((*MockStorage)(nil).UpdateUserCoins), ctx, tx, userID, coins)
+}
+
+// WithinTransaction mocks base method.
+func (m *MockStorage) WithinTransaction(ctx context.Context, fn func(context.Context) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithinTransaction", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithinTransaction indicates an expected call of WithinTransaction.
+func (mr *MockStorageMockRecorder) WithinTransaction(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithinTransaction", reflect.TypeOf((*MockStorage)(nil).WithinTransaction), ctx, fn)
 }
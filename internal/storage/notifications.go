@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+// Categories of notifications, each of which users can mute.
+const (
+	NotificationCoinsReceived     = "coins_received"     // Coins sent to the user, at once or as a scheduled transfer.
+	NotificationGiftReceived      = "gift_received"      // An item bought for the user as a gift.
+	NotificationScheduledTransfer = "scheduled_transfer" // A scheduled transfer of the user executed.
+	NotificationAdminAdjustment   = "admin_adjustment"   // Coins of the user moved by an administrator.
+)
+
+// NotificationCategories lists every notification category.
+var NotificationCategories = []string{
+	NotificationCoinsReceived,
+	NotificationGiftReceived,
+	NotificationScheduledTransfer,
+	NotificationAdminAdjustment,
+}
+
+const (
+	notificationColumns = `n.id, n.category, COALESCE(a.username, ''), n.amount, n.item, n.created_at, n.read_at`
+
+	insertNotificationQuery             = `INSERT INTO content.notifications (user_id, category, actor_id, amount, item) SELECT $1::integer, $2::varchar, $3::integer, $4::integer, $5::varchar WHERE NOT EXISTS (SELECT 1 FROM content.notification_mutes WHERE user_id = $1 AND category = $2);`
+	getNotificationsQuery               = `SELECT ` + notificationColumns + ` FROM content.notifications n LEFT JOIN content.users a ON n.actor_id = a.id WHERE n.user_id = $1 AND (NOT $2::boolean OR n.read_at IS NULL) AND ($3::timestamptz IS NULL OR (n.created_at, n.id) < ($3, $4)) ORDER BY n.created_at DESC, n.id DESC LIMIT $5;`
+	countUnreadNotificationsQuery       = `SELECT COUNT(*) FROM content.notifications WHERE user_id = $1 AND read_at IS NULL;`
+	markNotificationReadQuery           = `WITH marked AS (UPDATE content.notifications SET read_at = COALESCE(read_at, $3) WHERE id = $1 AND user_id = $2 RETURNING *) SELECT ` + notificationColumns + ` FROM marked n LEFT JOIN content.users a ON n.actor_id = a.id;`
+	markAllNotificationsReadQuery       = `UPDATE content.notifications SET read_at = $2 WHERE user_id = $1 AND read_at IS NULL;`
+	getMutedNotificationCategoriesQuery = `SELECT category FROM content.notification_mutes WHERE user_id = $1 ORDER BY category;`
+	deleteNotificationMutesQuery        = `DELETE FROM content.notification_mutes WHERE user_id = $1;`
+	insertNotificationMuteQuery         = `INSERT INTO content.notification_mutes (user_id, category) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+)
+
+// ErrNotificationNotFound indicates that the user has no notification with the given ID.
+var ErrNotificationNotFound = errors.New("storage: notification not found")
+
+// notification is a notification about to be written to the inbox of userID. ActorID, Amount, and Item are the
+// details of the event, zero when it has none.
+type notification struct {
+	UserID   int32
+	Category string
+	ActorID  int32
+	Amount   int
+	Item     string
+}
+
+// notify writes the notification within tx, or within the transaction stored in ctx when tx is nil, so that it is
+// committed together with the event it reports. Nothing is written when the user has muted its category.
+func (postgresql *PostgreSQL) notify(ctx context.Context, tx Tx, notification notification) error {
+	_, err := postgresql.querier(ctx, tx).ExecContext(ctx, insertNotificationQuery, notification.UserID, notification.Category,
+		nullInt32(int(notification.ActorID)), nullInt32(notification.Amount), nullString(notification.Item))
+	if err != nil {
+		postgresql.logQueryError(ctx, "notify", err, zap.String("query", "insertNotificationQuery"),
+			zap.Int32("userID", notification.UserID), zap.String("category", notification.Category))
+		return err
+	}
+
+	return nil
+}
+
+// GetNotifications returns a page of the user's notifications, newest first, using keyset pagination on
+// (created_at, id). With filter.UnreadOnly, the notifications already read are left out.
+func (postgresql *PostgreSQL) GetNotifications(ctx context.Context, userID int32, filter models.NotificationsFilter) ([]models.Notification, error) {
+	var afterCreatedAt, afterID any
+	if filter.After != nil {
+		afterCreatedAt, afterID = filter.After.CreatedAt, filter.After.ID
+	}
+
+	rows, err := postgresql.db.QueryContext(ctx, getNotificationsQuery, userID, filter.UnreadOnly, afterCreatedAt, afterID, filter.Limit)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetNotifications", err, zap.String("query", "getNotificationsQuery"), zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]models.Notification, 0, filter.Limit)
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			postgresql.logQueryError(ctx, "GetNotifications", err, zap.String("query", "getNotificationsQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		notifications = append(notifications, *notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetNotifications", err, zap.String("query", "getNotificationsQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return notifications, err
+	}
+
+	return notifications, nil
+}
+
+// CountUnreadNotifications returns the number of notifications the user has not read.
+func (postgresql *PostgreSQL) CountUnreadNotifications(ctx context.Context, userID int32) (int64, error) {
+	var count int64
+	if err := postgresql.db.QueryRowContext(ctx, countUnreadNotificationsQuery, userID).Scan(&count); err != nil {
+		postgresql.logQueryError(ctx, "CountUnreadNotifications", err, zap.String("query", "countUnreadNotificationsQuery"),
+			zap.Int32("userID", userID))
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkNotificationRead marks the user's notification as read at now and returns it. Marking a notification that is
+// already read succeeds and keeps the time it was first read. It returns ErrNotificationNotFound when the user has
+// no such notification, without revealing whether it belongs to another user.
+func (postgresql *PostgreSQL) MarkNotificationRead(ctx context.Context, userID int32, notificationID int64, now time.Time) (*models.Notification, error) {
+	notification, err := scanNotification(postgresql.db.QueryRowContext(ctx, markNotificationReadQuery, notificationID, userID, now))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "MarkNotificationRead", err, zap.String("query", "markNotificationReadQuery"),
+			zap.Int32("userID", userID), zap.Int64("notificationID", notificationID))
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user as read at now and returns how many were.
+func (postgresql *PostgreSQL) MarkAllNotificationsRead(ctx context.Context, userID int32, now time.Time) (int64, error) {
+	result, err := postgresql.db.ExecContext(ctx, markAllNotificationsReadQuery, userID, now)
+	if err != nil {
+		postgresql.logQueryError(ctx, "MarkAllNotificationsRead", err, zap.String("query", "markAllNotificationsReadQuery"),
+			zap.Int32("userID", userID))
+		return 0, err
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "MarkAllNotificationsRead", err, zap.String("query", "markAllNotificationsReadQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int32("userID", userID))
+		return 0, err
+	}
+
+	return marked, nil
+}
+
+// GetMutedNotificationCategories returns the notification categories the user has muted, sorted by name.
+func (postgresql *PostgreSQL) GetMutedNotificationCategories(ctx context.Context, userID int32) ([]string, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getMutedNotificationCategoriesQuery, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetMutedNotificationCategories", err,
+			zap.String("query", "getMutedNotificationCategoriesQuery"), zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			postgresql.logQueryError(ctx, "GetMutedNotificationCategories", err,
+				zap.String("query", "getMutedNotificationCategoriesQuery"), zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetMutedNotificationCategories", err,
+			zap.String("query", "getMutedNotificationCategoriesQuery"), zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// SetMutedNotificationCategories replaces the notification categories the user has muted with categories, in one
+// transaction. The categories are not checked here; the app only passes known ones.
+func (postgresql *PostgreSQL) SetMutedNotificationCategories(ctx context.Context, userID int32, categories []string) error {
+	return postgresql.inTransaction(ctx, "SetMutedNotificationCategories", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		if _, err := q.ExecContext(ctx, deleteNotificationMutesQuery, userID); err != nil {
+			postgresql.logQueryError(ctx, "SetMutedNotificationCategories", err,
+				zap.String("query", "deleteNotificationMutesQuery"), zap.Int32("userID", userID))
+			return err
+		}
+
+		for _, category := range categories {
+			if _, err := q.ExecContext(ctx, insertNotificationMuteQuery, userID, category); err != nil {
+				postgresql.logQueryError(ctx, "SetMutedNotificationCategories", err,
+					zap.String("query", "insertNotificationMuteQuery"), zap.Int32("userID", userID), zap.String("category", category))
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// scanNotification reads a notification selected with notificationColumns and describes it in its message.
+func scanNotification(row Row) (*models.Notification, error) {
+	notification := &models.Notification{}
+	var amount sql.NullInt32
+	var item sql.NullString
+	var readAt sql.NullTime
+	err := row.Scan(&notification.ID, &notification.Category, &notification.User, &amount, &item, &notification.CreatedAt, &readAt)
+	if err != nil {
+		return nil, err
+	}
+	notification.Amount = int(amount.Int32)
+	notification.Item = item.String
+	if readAt.Valid {
+		notification.ReadAt = &readAt.Time
+	}
+	notification.Message = notificationMessage(notification)
+
+	return notification, nil
+}
+
+// notificationMessage describes the event a notification reports. The other user of the event may have been
+// deleted since, in which case the message leaves them out.
+func notificationMessage(notification *models.Notification) string {
+	user := notification.User
+	if user == "" {
+		user = "a deleted user"
+	}
+
+	switch notification.Category {
+	case NotificationCoinsReceived:
+		return fmt.Sprintf("you received %d coins from %s", notification.Amount, user)
+	case NotificationGiftReceived:
+		return fmt.Sprintf("you received a %s as a gift from %s", notification.Item, user)
+	case NotificationScheduledTransfer:
+		return fmt.Sprintf("your scheduled transfer of %d coins to %s executed", notification.Amount, user)
+	case NotificationAdminAdjustment:
+		if notification.Amount < 0 {
+			return fmt.Sprintf("an administrator took back %d coins you received from %s", -notification.Amount, user)
+		}
+		return fmt.Sprintf("an administrator returned %d coins you sent to %s", notification.Amount, user)
+	default:
+		return notification.Category
+	}
+}
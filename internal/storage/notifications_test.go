@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"merch_store/internal/models"
+)
+
+func TestNotificationMessage(t *testing.T) {
+	testCases := []struct {
+		name         string
+		notification models.Notification
+		message      string
+	}{
+		{
+			name:         "Coins received",
+			notification: models.Notification{Category: NotificationCoinsReceived, User: "bob", Amount: 100},
+			message:      "you received 100 coins from bob",
+		},
+		{
+			name:         "Gift received",
+			notification: models.Notification{Category: NotificationGiftReceived, User: "bob", Item: "cup"},
+			message:      "you received a cup as a gift from bob",
+		},
+		{
+			name:         "Scheduled transfer",
+			notification: models.Notification{Category: NotificationScheduledTransfer, User: "alice", Amount: 50},
+			message:      "your scheduled transfer of 50 coins to alice executed",
+		},
+		{
+			name:         "Coins taken back",
+			notification: models.Notification{Category: NotificationAdminAdjustment, User: "bob", Amount: -30},
+			message:      "an administrator took back 30 coins you received from bob",
+		},
+		{
+			name:         "Coins returned",
+			notification: models.Notification{Category: NotificationAdminAdjustment, User: "alice", Amount: 30},
+			message:      "an administrator returned 30 coins you sent to alice",
+		},
+		{
+			name:         "Deleted user",
+			notification: models.Notification{Category: NotificationCoinsReceived, Amount: 5},
+			message:      "you received 5 coins from a deleted user",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.message, notificationMessage(&tc.notification))
+		})
+	}
+}
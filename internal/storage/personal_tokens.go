@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	createPersonalTokenQuery    = `INSERT INTO content.personal_tokens (user_id, name, prefix, token_hash, scopes, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;`
+	getPersonalTokensQuery      = `SELECT id, name, prefix, scopes, created_at, expires_at FROM content.personal_tokens WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC, id DESC;`
+	revokePersonalTokenQuery    = `UPDATE content.personal_tokens SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;`
+	getPersonalTokenByHashQuery = `SELECT id, user_id, name, prefix, scopes, created_at, expires_at FROM content.personal_tokens WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2);`
+)
+
+// ErrPersonalTokenNotFound indicates that the personal access token does not exist, belongs to another user,
+// has been revoked, or, when looked up by hash, has expired.
+var ErrPersonalTokenNotFound = errors.New("storage: personal access token not found")
+
+// CreatePersonalToken stores a personal access token of token.UserID under the hash of its secret
+// and returns it with its ID. The scopes are stored as a comma-separated list.
+func (postgresql *PostgreSQL) CreatePersonalToken(ctx context.Context, token models.PersonalToken, hash string) (*models.PersonalToken, error) {
+	var expiresAt sql.NullTime
+	if token.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *token.ExpiresAt, Valid: true}
+	}
+
+	err := postgresql.db.QueryRowContext(ctx, createPersonalTokenQuery, token.UserID, token.Name, token.Prefix, hash,
+		strings.Join(token.Scopes, ","), token.CreatedAt, expiresAt).Scan(&token.ID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CreatePersonalToken", err, zap.String("query", "createPersonalTokenQuery"))
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// GetPersonalTokens returns the user's personal access tokens that have not been revoked, newest first.
+// Expired tokens are listed until they are revoked, so that their owner can tell why a bot stopped working.
+func (postgresql *PostgreSQL) GetPersonalTokens(ctx context.Context, userID int32) ([]models.PersonalToken, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getPersonalTokensQuery, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetPersonalTokens", err, zap.String("query", "getPersonalTokensQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalToken{}
+	for rows.Next() {
+		token := models.PersonalToken{UserID: userID}
+		var scopes string
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &token.Prefix, &scopes, &token.CreatedAt, &expiresAt); err != nil {
+			postgresql.logQueryError(ctx, "GetPersonalTokens", err, zap.String("query", "getPersonalTokensQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		token.Scopes, token.ExpiresAt = splitScopes(scopes), nullTimePtr(expiresAt)
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetPersonalTokens", err, zap.String("query", "getPersonalTokensQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RevokePersonalToken revokes the user's personal access token at now.
+// It returns ErrPersonalTokenNotFound when the token does not exist, belongs to another user, or is already revoked.
+func (postgresql *PostgreSQL) RevokePersonalToken(ctx context.Context, userID int32, tokenID int64, now time.Time) error {
+	result, err := postgresql.db.ExecContext(ctx, revokePersonalTokenQuery, tokenID, userID, now)
+	if err != nil {
+		postgresql.logQueryError(ctx, "RevokePersonalToken", err, zap.String("query", "revokePersonalTokenQuery"),
+			zap.Int32("userID", userID), zap.Int64("tokenID", tokenID))
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPersonalTokenNotFound
+	}
+
+	return nil
+}
+
+// GetPersonalTokenByHash returns the personal access token stored under hash that is neither revoked nor expired at now.
+// It returns ErrPersonalTokenNotFound otherwise.
+func (postgresql *PostgreSQL) GetPersonalTokenByHash(ctx context.Context, hash string, now time.Time) (*models.PersonalToken, error) {
+	token := &models.PersonalToken{}
+	var scopes string
+	var expiresAt sql.NullTime
+
+	err := postgresql.db.QueryRowContext(ctx, getPersonalTokenByHashQuery, hash, now).
+		Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &scopes, &token.CreatedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonalTokenNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetPersonalTokenByHash", err, zap.String("query", "getPersonalTokenByHashQuery"))
+		return nil, err
+	}
+
+	token.Scopes, token.ExpiresAt = splitScopes(scopes), nullTimePtr(expiresAt)
+	return token, nil
+}
+
+// splitScopes parses a comma-separated list of scopes.
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// nullTimePtr returns the time of a nullable column, or nil for NULL.
+func nullTimePtr(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
+
+// nullInt64Ptr returns the value of a nullable column, or nil for NULL.
+func nullInt64Ptr(value sql.NullInt64) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int64
+}
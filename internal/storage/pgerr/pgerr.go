@@ -0,0 +1,78 @@
+// Package pgerr classifies PostgreSQL errors independently of the driver that returned them.
+// Both the pgx v4 (github.com/jackc/pgconn) and the pgx v5 (github.com/jackc/pgx/v5/pgconn)
+// flavors of PgError are recognized, including when they are wrapped with fmt.Errorf("%w").
+package pgerr
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	pgconn "github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	pgx_pgconn "github.com/jackc/pgx/v5/pgconn"
+)
+
+// Code returns the SQLSTATE code and the name of the violated constraint of a PostgreSQL error,
+// and reports whether err is one.
+func Code(err error) (code string, constraint string, ok bool) {
+	var pgxError *pgx_pgconn.PgError
+	if errors.As(err, &pgxError) {
+		return pgxError.Code, pgxError.ConstraintName, true
+	}
+
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) {
+		return pgError.Code, pgError.ConstraintName, true
+	}
+
+	return "", "", false
+}
+
+// IsUniqueViolation reports whether err is a violation of a unique constraint.
+func IsUniqueViolation(err error) bool {
+	code, _, ok := Code(err)
+	return ok && code == pgerrcode.UniqueViolation
+}
+
+// IsCheckViolation reports whether err is a violation of the named check constraint.
+// An empty constraint matches a violation of any check constraint.
+func IsCheckViolation(err error, constraint string) bool {
+	code, violated, ok := Code(err)
+	return ok && code == pgerrcode.CheckViolation && (constraint == "" || violated == constraint)
+}
+
+// IsRetryable reports whether err is a serialization failure or a deadlock,
+// after which the transaction can be safely retried from the beginning.
+func IsRetryable(err error) bool {
+	code, _, ok := Code(err)
+	return ok && (code == pgerrcode.SerializationFailure || code == pgerrcode.DeadlockDetected)
+}
+
+// IsConnectionError reports whether err means that the database could not be reached or the connection to it
+// was lost, as happens while PostgreSQL restarts, rather than that the statement itself failed.
+// It recognizes network errors, broken connections reported by the drivers, and the connection exception
+// and shutdown SQLSTATE codes. Context cancellation and deadlines are never connection errors.
+func IsConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if code, _, ok := Code(err); ok {
+		return pgerrcode.IsConnectionException(code) ||
+			code == pgerrcode.AdminShutdown || code == pgerrcode.CrashShutdown || code == pgerrcode.CannotConnectNow
+	}
+
+	var netError net.Error
+	var connectError *pgx_pgconn.ConnectError
+	return errors.As(err, &netError) ||
+		errors.As(err, &connectError) ||
+		pgx_pgconn.SafeToRetry(err) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,98 @@
+package pgerr
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	pgconn "github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	pgx_pgconn "github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassification(t *testing.T) {
+	flavors := []struct {
+		name string
+		new  func(code, constraint string) error
+	}{
+		{name: "pgx v5", new: func(code, constraint string) error {
+			return &pgx_pgconn.PgError{Code: code, ConstraintName: constraint}
+		}},
+		{name: "pgconn v1", new: func(code, constraint string) error {
+			return &pgconn.PgError{Code: code, ConstraintName: constraint}
+		}},
+		{name: "wrapped pgx v5", new: func(code, constraint string) error {
+			return fmt.Errorf("storage: %w", &pgx_pgconn.PgError{Code: code, ConstraintName: constraint})
+		}},
+		{name: "wrapped pgconn v1", new: func(code, constraint string) error {
+			return fmt.Errorf("storage: %w", &pgconn.PgError{Code: code, ConstraintName: constraint})
+		}},
+	}
+
+	for _, flavor := range flavors {
+		t.Run(flavor.name, func(t *testing.T) {
+			uniqueViolation := flavor.new(pgerrcode.UniqueViolation, "users_username_key")
+			checkViolation := flavor.new(pgerrcode.CheckViolation, "users_coins_check")
+
+			assert.True(t, IsUniqueViolation(uniqueViolation))
+			assert.False(t, IsUniqueViolation(checkViolation))
+
+			assert.True(t, IsCheckViolation(checkViolation, "users_coins_check"))
+			assert.True(t, IsCheckViolation(checkViolation, ""), "an empty constraint matches any check violation")
+			assert.False(t, IsCheckViolation(checkViolation, "chk_different_users"))
+			assert.False(t, IsCheckViolation(uniqueViolation, ""))
+
+			assert.True(t, IsRetryable(flavor.new(pgerrcode.SerializationFailure, "")))
+			assert.True(t, IsRetryable(flavor.new(pgerrcode.DeadlockDetected, "")))
+			assert.False(t, IsRetryable(checkViolation))
+		})
+	}
+
+	t.Run("Not a PostgreSQL error", func(t *testing.T) {
+		err := errors.New("connection refused")
+
+		_, _, ok := Code(err)
+		assert.False(t, ok)
+		assert.False(t, IsUniqueViolation(err))
+		assert.False(t, IsCheckViolation(err, ""))
+		assert.False(t, IsRetryable(err))
+		assert.False(t, IsUniqueViolation(nil))
+	})
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "network error", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, want: true},
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: true},
+		{name: "unexpected EOF", err: fmt.Errorf("read message: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "bad connection", err: driver.ErrBadConn, want: true},
+		{name: "pgx connect error", err: &pgx_pgconn.ConnectError{}, want: true},
+		{name: "admin shutdown", err: &pgx_pgconn.PgError{Code: pgerrcode.AdminShutdown}, want: true},
+		{name: "cannot connect now", err: &pgconn.PgError{Code: pgerrcode.CannotConnectNow}, want: true},
+		{name: "connection failure", err: fmt.Errorf("storage: %w", &pgx_pgconn.PgError{Code: pgerrcode.ConnectionFailure}), want: true},
+		{name: "check violation", err: &pgx_pgconn.PgError{Code: pgerrcode.CheckViolation}, want: false},
+		{name: "serialization failure", err: &pgx_pgconn.PgError{Code: pgerrcode.SerializationFailure}, want: false},
+		{name: "no rows", err: sql.ErrNoRows, want: false},
+		{name: "deadline exceeded", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "logic error", err: errors.New("storage: insufficient funds"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsConnectionError(tt.err))
+		})
+	}
+}
@@ -7,79 +7,322 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"go.uber.org/zap"
 	"merch_store/internal/models"
+	"merch_store/internal/pkg/crypto"
 	"merch_store/internal/pkg/logger"
 	"merch_store/internal/pkg/security"
+	"sync"
 	"time"
-
-	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 const (
-	createUserQuery        = `INSERT INTO content.users (username, password_hash, coins) VALUES ($1, $2, $3) RETURNING id;`
-	checkUserQuery         = `SELECT id, password_hash FROM content.users WHERE username = $1;`
-	buyItemQuery           = `INSERT INTO content.merch_purchases (user_id, merch_id, quantity) VALUES ($1, $2, $3);`
-	getItemPriceQuery      = `SELECT id, price FROM content.merch WHERE merch_name = $1;`
+	createUserQuery        = `INSERT INTO content.users (username, password_hash, coins, opening_coins) VALUES ($1, $2, $3, $3) RETURNING id;`
+	checkUserQuery         = `SELECT id, password_hash, token_version FROM content.users WHERE username = $1;`
+	deleteUserQuery        = `DELETE FROM content.users WHERE id = $1;`
+	buyItemQuery           = `WITH receipt AS (SELECT nextval('content.receipt_number_seq')::text AS seq) INSERT INTO content.merch_purchases (user_id, merch_id, quantity, bought_by, price, promotion_id, receipt_number) SELECT $1::int, $2::int, $3::int, $4::int, $5::int, $6::bigint, 'R-' || to_char(NOW() AT TIME ZONE 'UTC', 'YYYY') || '-' || lpad(seq, GREATEST(6, length(seq)), '0') FROM receipt RETURNING receipt_number;`
+	giftItemQuery          = `INSERT INTO content.merch_purchases (user_id, merch_id, quantity, gifted_by, price, promotion_id) VALUES ($1, $2, $3, $4, $5, $6);`
+	getItemPriceQuery      = `SELECT m.id, m.price, bp.discount, bp.id FROM content.merch m` + bestPromotionJoin + ` WHERE m.merch_name = $1;`
+	getItemByIDQuery       = `SELECT merch_name, price FROM content.merch WHERE id = $1;`
+	getMerchCatalogQuery   = `SELECT m.merch_name, m.category, m.price, bp.discount, bp.id FROM content.merch m` + bestPromotionJoin + ` ORDER BY m.id;`
+	getCatalogVersionQuery = `SELECT GREATEST(v.last_modified, (SELECT MAX(CASE WHEN p.ends_at <= NOW() THEN p.ends_at ELSE p.starts_at END) FROM content.promotions p WHERE p.starts_at <= NOW())) FROM content.catalog_version v;`
 	getUserInfoQuery       = `SELECT username, coins FROM content.users WHERE id = $1;`
 	updateUserCoinsQuery   = `UPDATE content.users SET coins = coins + $1, updated_at = NOW() WHERE id = $2;`
+	spendUserCoinsQuery    = `UPDATE content.users SET coins = coins - $1, updated_at = NOW() WHERE id = $2 RETURNING coins;`
 	getUserIDQuery         = `SELECT id FROM content.users WHERE username = $1;`
-	transferCoinsQuery     = `INSERT INTO content.coin_transfers (from_user_id, to_user_id, amount) VALUES ($1, $2, $3);`
-	getMerchPurchasesQuery = `SELECT m.merch_name, SUM(mp.quantity) AS total_quantity FROM content.merch_purchases mp JOIN content.merch m ON mp.merch_id = m.id WHERE mp.user_id = $1 GROUP BY m.merch_name;`
-	getSendCoinsQuery      = `SELECT u.username AS recipient_username, ct.amount FROM content.coin_transfers ct JOIN content.users u ON ct.to_user_id = u.id WHERE ct.from_user_id = $1 ORDER BY ct.created_at DESC;`
-	getReceivedCoinsQuery  = `SELECT u.username AS sender_username, ct.amount FROM content.coin_transfers ct JOIN content.users u ON ct.from_user_id = u.id WHERE ct.to_user_id = $1 ORDER BY ct.created_at DESC;`
+	isUserActiveQuery      = `SELECT is_active FROM content.users WHERE id = $1;`
+	isUserAdminQuery       = `SELECT is_admin FROM content.users WHERE id = $1 AND is_active;`
+	getTokenVersionQuery   = `SELECT token_version, is_active FROM content.users WHERE id = $1;`
+	bumpTokenVersionQuery  = `UPDATE content.users SET token_version = token_version + 1, updated_at = NOW() WHERE id = $1 RETURNING token_version;`
+	transferCoinsQuery     = `INSERT INTO content.coin_transfers (from_user_id, to_user_id, amount, bonus, campaign_id) VALUES ($1, $2, $3, $4, $5) RETURNING id;`
+	getMerchPurchasesQuery = `SELECT m.merch_name, m.category, ic.quantity, ic.quantity - ic.fulfilled_quantity, ic.fulfilled_quantity FROM content.inventory_counts ic JOIN content.merch m ON ic.merch_id = m.id WHERE ic.user_id = $1;`
+	getSendCoinsQuery      = `SELECT ct.id, u.username AS recipient_username, ct.amount FROM content.coin_transfers ct JOIN content.users u ON ct.to_user_id = u.id WHERE ct.from_user_id = $1 ORDER BY ct.created_at DESC, ct.id DESC LIMIT $2;`
+	getReceivedCoinsQuery  = `SELECT ct.id, u.username AS sender_username, ct.amount FROM content.coin_transfers ct JOIN content.users u ON ct.from_user_id = u.id WHERE ct.to_user_id = $1 ORDER BY ct.created_at DESC, ct.id DESC LIMIT $2;`
+	countCoinHistoryQuery  = `SELECT (SELECT COUNT(*) FROM content.coin_transfers WHERE from_user_id = $1), (SELECT COUNT(*) FROM content.coin_transfers WHERE to_user_id = $1);`
+	getCoinHistoryQuery    = `SELECT ct.id, fu.username, tu.username, ct.amount FROM content.coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE ct.from_user_id = $1 OR ct.to_user_id = $1 ORDER BY ct.created_at DESC, ct.id DESC;`
+	getTransfersQuery      = `SELECT ct.id, fu.username, tu.username, ct.amount, ct.bonus, ct.campaign_id, ct.created_at FROM content.coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE (ct.from_user_id = $1 OR ct.to_user_id = $1) AND ($2::timestamptz IS NULL OR (ct.created_at, ct.id) < ($2, $3)) ORDER BY ct.created_at DESC, ct.id DESC LIMIT $4;`
+	getSentTransfersQuery  = `SELECT ct.id, fu.username, tu.username, ct.amount, ct.bonus, ct.campaign_id, ct.created_at FROM content.coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE ct.from_user_id = $1 AND ($2::timestamptz IS NULL OR (ct.created_at, ct.id) < ($2, $3)) ORDER BY ct.created_at DESC, ct.id DESC LIMIT $4;`
+	getRecvTransfersQuery  = `SELECT ct.id, fu.username, tu.username, ct.amount, ct.bonus, ct.campaign_id, ct.created_at FROM content.coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE ct.to_user_id = $1 AND ($2::timestamptz IS NULL OR (ct.created_at, ct.id) < ($2, $3)) ORDER BY ct.created_at DESC, ct.id DESC LIMIT $4;`
+	getTransferQuery       = `SELECT ct.id, fu.username, tu.username, ct.amount, ct.bonus, ct.campaign_id, ct.created_at FROM content.all_coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE ct.id = $1 AND (ct.from_user_id = $2 OR ct.to_user_id = $2);`
+	getSentGiftsQuery      = `SELECT u.username AS recipient_username, m.merch_name, mp.price * mp.quantity FROM content.merch_purchases mp JOIN content.users u ON mp.user_id = u.id JOIN content.merch m ON mp.merch_id = m.id WHERE mp.gifted_by = $1 ORDER BY mp.created_at DESC;`
+)
+
+// Supported database drivers.
+const (
+	// DriverSQL uses the pgx driver through database/sql.
+	DriverSQL = "sql"
+	// DriverPgxPool uses a native pgxpool.Pool.
+	DriverPgxPool = "pgxpool"
+)
+
+// Directions of the transfers selected by GetTransfers.
+const (
+	TransferDirectionAll      = "all"
+	TransferDirectionSent     = "sent"
+	TransferDirectionReceived = "received"
+)
+
+// ParseIsolationLevel converts a configured isolation level name into sql.IsolationLevel.
+// Supported names are read_committed, repeatable_read, and serializable.
+func ParseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	switch name {
+	case "read_committed", "":
+		return sql.LevelReadCommitted, nil
+	case "repeatable_read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	default:
+		return sql.LevelDefault, fmt.Errorf("storage: unsupported isolation level %q", name)
+	}
+}
+
+// Predefined errors for operations on users.
+var (
+	// ErrRecipientNotFound indicates that the user a gift, a coin transfer, or a delegation is addressed to does not exist.
+	ErrRecipientNotFound = errors.New("storage: recipient not found")
+	// ErrSelfTransfer indicates that the recipient of a previewed coin transfer is its sender.
+	ErrSelfTransfer = errors.New("storage: self-transfer")
+	// ErrUserNotFound indicates that the user whose balance is updated does not exist.
+	ErrUserNotFound = errors.New("storage: user not found")
+	// ErrItemNotFound indicates that the requested item does not exist.
+	// Errors wrapping it also match sql.ErrNoRows, which callers have historically checked for.
+	ErrItemNotFound = errors.New("storage: item not found")
+	// ErrTransferNotFound indicates that the transfer does not exist or the user is neither its sender nor its recipient.
+	ErrTransferNotFound = errors.New("storage: transfer not found")
+	// ErrUnknownTransferDirection indicates that GetTransfers was called with an unsupported direction.
+	ErrUnknownTransferDirection = errors.New("storage: unknown transfer direction")
 )
 
+// TxManager runs multi-step operations atomically.
+// Storage methods taking a Tx run within the transaction of WithinTransaction when called with its context
+// and a nil Tx, and directly on the connection pool when called outside of it.
+type TxManager interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 // Storage defines the methods required for data storage operations.
 type Storage interface {
+	TxManager
+
 	// Close closes the database connection.
 	Close()
 
 	// Authentication methods.
 	CheckUser(ctx context.Context, user *models.User) (*models.User, error)
 	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
-
-	// Item-related method.
-	GetItemPrice(ctx context.Context, tx *sql.Tx, itemName string) (*models.Item, error)
+	DeleteUser(ctx context.Context, userID int32) error
+	CreateUsersBulk(ctx context.Context, users []models.User) ([]models.User, error)
+
+	// Invite-only registration methods.
+	CreateInviteCode(ctx context.Context, invite models.InviteCode, createdBy int32) error
+	CreateUserWithInvite(ctx context.Context, user *models.User, code string, now time.Time) (*models.User, error)
+
+	// Session registry methods.
+	CreateSession(ctx context.Context, session models.Session, limit int) error
+	IsSessionActive(ctx context.Context, userID int32, sessionID string) (bool, error)
+	GetActiveSessions(ctx context.Context, userID int32, now time.Time) ([]models.Session, error)
+	CountActiveSessions(ctx context.Context, now time.Time) (int, error)
+	RevokeSession(ctx context.Context, userID int32, sessionID string) error
+
+	// Personal access token methods.
+	CreatePersonalToken(ctx context.Context, token models.PersonalToken, hash string) (*models.PersonalToken, error)
+	GetPersonalTokens(ctx context.Context, userID int32) ([]models.PersonalToken, error)
+	RevokePersonalToken(ctx context.Context, userID int32, tokenID int64, now time.Time) error
+	GetPersonalTokenByHash(ctx context.Context, hash string, now time.Time) (*models.PersonalToken, error)
+
+	// Spending delegation methods.
+	CreateDelegation(ctx context.Context, grantorID int32, delegation models.Delegation) (*models.Delegation, error)
+	GetDelegations(ctx context.Context, userID int32) (*models.DelegationsResponse, error)
+	RevokeDelegation(ctx context.Context, grantorID int32, delegationID int64, now time.Time) error
+
+	// Item-related methods.
+	GetItemPrice(ctx context.Context, tx Tx, itemName string) (*models.Item, error)
+	GetItemByID(ctx context.Context, itemID int) (*models.Item, error)
+	GetMerchCatalog(ctx context.Context) ([]models.CatalogItem, error)
+	GetCatalogWithAffordability(ctx context.Context, userID int32) ([]models.AffordableCatalogItem, error)
+	GetReceipt(ctx context.Context, userID int32, number string) (*models.Receipt, error)
+	RedeemReceipt(ctx context.Context, adminID int32, number string, now time.Time) (*models.Receipt, error)
+	GetCatalogLastModified(ctx context.Context) (time.Time, error)
+	ConsumeItem(ctx context.Context, userID int32, itemName string, quantity int) (*models.InventoryItem, error)
 
 	// User information methods.
-	GetUserInfo(ctx context.Context, tx *sql.Tx, userID int32) (*models.User, error)
-	GetUserID(ctx context.Context, tx *sql.Tx, username string) (*models.User, error)
-	UpdateUserCoins(ctx context.Context, tx *sql.Tx, userID int32, coins int) error
+	GetUserInfo(ctx context.Context, tx Tx, userID int32) (*models.User, error)
+	GetUserID(ctx context.Context, tx Tx, username string) (*models.User, error)
+	IsUserActive(ctx context.Context, userID int32) (bool, error)
+	IsUserAdmin(ctx context.Context, userID int32) (bool, error)
+	GetTokenVersion(ctx context.Context, userID int32) (version int32, active bool, err error)
+	BumpTokenVersion(ctx context.Context, userID int32) (int32, error)
+	UpdateUserCoins(ctx context.Context, tx Tx, userID int32, coins int64) error
 
 	// Transactional operations.
-	BuyItem(ctx context.Context, userID int32, itemName string) error
-	TransferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) error
+	BuyItem(ctx context.Context, userID int32, itemName string) (*models.PurchaseResult, error)
+	BuyItemOnBehalf(ctx context.Context, granteeID int32, grantor string, itemName string, now time.Time) (*models.PurchaseResult, error)
+	GiftItem(ctx context.Context, userID int32, itemName string, req models.GiftRequest) error
+	TransferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error)
+	PreviewTransfer(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferPreview, error)
+	ReverseTransfer(ctx context.Context, adminID int32, transferID int64, partial bool, now time.Time) (*models.TransferReversal, error)
+
+	// Notification inbox methods.
+	GetNotifications(ctx context.Context, userID int32, filter models.NotificationsFilter) ([]models.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID int32) (int64, error)
+	MarkNotificationRead(ctx context.Context, userID int32, notificationID int64, now time.Time) (*models.Notification, error)
+	MarkAllNotificationsRead(ctx context.Context, userID int32, now time.Time) (int64, error)
+	GetMutedNotificationCategories(ctx context.Context, userID int32) ([]string, error)
+	SetMutedNotificationCategories(ctx context.Context, userID int32, categories []string) error
+
+	// Gifting campaign methods.
+	CreateCampaign(ctx context.Context, campaign models.Campaign) (*models.Campaign, error)
+	GetCampaigns(ctx context.Context) ([]models.Campaign, error)
+	GetCampaign(ctx context.Context, campaignID int64) (*models.Campaign, error)
+	UpdateCampaign(ctx context.Context, campaign models.Campaign) (*models.Campaign, error)
+	DeleteCampaign(ctx context.Context, campaignID int64) error
+
+	// Promotion methods.
+	CreatePromotion(ctx context.Context, promotion models.Promotion) (*models.Promotion, error)
+	GetPromotions(ctx context.Context) ([]models.Promotion, error)
+	GetPromotion(ctx context.Context, promotionID int64) (*models.Promotion, error)
+	UpdatePromotion(ctx context.Context, promotion models.Promotion) (*models.Promotion, error)
+	DeletePromotion(ctx context.Context, promotionID int64) error
+
+	// Merch category methods.
+	SetMerchCategory(ctx context.Context, itemName string, category string) (*models.MerchCategory, error)
+
+	// Periodic coin accrual methods.
+	AccrueMonthlyCoins(ctx context.Context, period time.Time, amount int) (int, error)
+	GetAccrualEntry(ctx context.Context, period time.Time, userID int32) (int, error)
+
+	// Failed purchase analytics methods.
+	RecordFailedPurchase(ctx context.Context, purchase models.FailedPurchase) error
+	GetFailedPurchaseStats(ctx context.Context, from time.Time, to time.Time) ([]models.FailedPurchaseStat, error)
+
+	// Economy analytics methods.
+	GetEconomyStats(ctx context.Context, from time.Time, to time.Time) (*models.EconomyStats, error)
+	CheckInvariants(ctx context.Context) (*models.InvariantReport, error)
+
+	// API activity methods.
+	RecordAPIActivity(ctx context.Context, activity models.APIActivity) error
+	GetUserActivity(ctx context.Context, userID int32, filter models.ActivityFilter) ([]models.APIActivity, error)
+
+	// Terms of service methods.
+	GetTermsAcceptance(ctx context.Context, userID int32) (*models.TermsAcceptance, error)
+	AcceptTerms(ctx context.Context, userID int32, version int, acceptedAt time.Time) (*models.TermsAcceptance, error)
+
+	// Idempotency key methods.
+	ClaimIdempotencyKey(ctx context.Context, userID int32, key string, fingerprint string, now time.Time, expiredAt time.Time) (*models.IdempotentResponse, error)
+	SaveIdempotentResponse(ctx context.Context, userID int32, key string, response models.IdempotentResponse) error
+
+	// Coin hold (escrow) methods.
+	CreateHold(ctx context.Context, userID int32, amount int, reason string) (*models.CoinHold, error)
+	ReleaseHold(ctx context.Context, holdID int64) error
+	CaptureHold(ctx context.Context, holdID int64) (*models.CoinHold, error)
+	GetActiveHoldsAmount(ctx context.Context, tx Tx, userID int32) (int, error)
+
+	// Scheduled transfer methods.
+	CreateScheduledTransfer(ctx context.Context, userID int32, req models.SendCoinRequest, executeAt time.Time) (*models.ScheduledTransfer, error)
+	GetScheduledTransfers(ctx context.Context, userID int32) ([]models.ScheduledTransfer, error)
+	CancelScheduledTransfer(ctx context.Context, userID int32, scheduledID int64, now time.Time) error
+	GetDueScheduledTransfers(ctx context.Context, now time.Time, limit int) ([]int64, error)
+	ExecuteScheduledTransfer(ctx context.Context, scheduledID int64, now time.Time) (*models.ScheduledTransfer, error)
 
 	// Methods to retrieve purchase and transaction details.
-	GetMerchPurchasesInfo(ctx context.Context, tx *sql.Tx, userID int32) ([]models.InventoryItem, error)
-	GetCoinsTransactionInfo(ctx context.Context, tx *sql.Tx, userID int32, username string, query string) ([]models.TransactionDetail, error)
+	GetMerchPurchasesInfo(ctx context.Context, tx Tx, userID int32) ([]models.InventoryItem, error)
+	ReconcileInventoryCounts(ctx context.Context, repair bool) ([]models.InventoryDrift, error)
+	GetCoinsTransactionInfo(ctx context.Context, tx Tx, userID int32, username string, query string) ([]models.TransactionDetail, error)
+	GetSentGiftsInfo(ctx context.Context, tx Tx, userID int32) ([]models.GiftDetail, error)
+	StreamCoinHistory(ctx context.Context, userID int32, fn func(models.TransactionDetail) error) error
+	GetTransfers(ctx context.Context, userID int32, filter models.TransfersFilter) ([]models.Transfer, error)
+	GetTransfer(ctx context.Context, userID int32, transferID int64) (*models.Transfer, error)
+	ArchiveTransfers(ctx context.Context, before time.Time, limit int) (int64, error)
+	CountCoinHistory(ctx context.Context, userID int32) (sent int64, received int64, err error)
 	GetInfo(ctx context.Context, userID int32) (*models.InfoResponse, error)
+	GetInfoWithHistoryLimit(ctx context.Context, userID int32, limit int) (*models.InfoResponse, error)
+	GetPartialInfo(ctx context.Context, userID int32) (*models.InfoResponse, error)
+	ReserveDataExport(ctx context.Context, userID int32, now time.Time, interval time.Duration) (time.Time, error)
+	StreamUserExport(ctx context.Context, userID int32, fn func(section string, record any) error) error
 }
 
 // PostgreSQL implements the Storage interface using a PostgreSQL database.
+// The underlying connection pool is either database/sql or a native pgxpool.Pool.
 type PostgreSQL struct {
-	db  *sql.DB        // Connection to the database.
-	log *logger.Logger // Logger for recording events and errors.
+	db               database           // Connection pool to the database.
+	log              *logger.Logger     // Logger for recording events and errors.
+	balanceIsolation sql.IsolationLevel // Isolation level of transactions that mutate balances.
+	maxCoinBalance   int64              // Largest balance a user may hold; zero disables the cap.
+	deadlineFloor    time.Duration      // Least time left before the deadline to start the next query of an operation.
+	leaderKeepAlive  time.Duration      // How often a leadership checks the connection holding it.
+	cipher           *crypto.Cipher     // Encrypts the client IPs and user agents; nil stores them in plaintext.
+}
+
+// Open creates a new PostgreSQL instance using the given driver, DriverSQL or DriverPgxPool.
+func Open(driver string, cofigDBString string, l *logger.Logger) (*PostgreSQL, error) {
+	switch driver {
+	case DriverSQL, "":
+		return NewPostgreSQL(cofigDBString, l)
+	case DriverPgxPool:
+		return NewPgxPool(cofigDBString, l)
+	default:
+		return &PostgreSQL{log: l}, fmt.Errorf("storage: unsupported database driver %q", driver)
+	}
 }
 
 // NewPostgreSQL creates a new PostgreSQL instance with the provided connection string and logger.
-// It opens the connection and pings the database to ensure connectivity.
+// It opens the connection through database/sql and pings the database to ensure connectivity.
 func NewPostgreSQL(cofigDBString string, l *logger.Logger) (*PostgreSQL, error) {
-	db, err := sql.Open("pgx", cofigDBString)
+	db, err := openSQLDatabase(cofigDBString)
 	if err != nil {
 		l.Sugar().Errorf("Failed to open a database: %s", err)
-		return &PostgreSQL{db: db, log: l}, err
+		return &PostgreSQL{log: l}, err
 	}
 
+	return newPostgreSQL(db, l)
+}
+
+// NewPgxPool creates a new PostgreSQL instance backed by a native pgxpool.Pool.
+// It opens the pool and pings the database to ensure connectivity.
+func NewPgxPool(cofigDBString string, l *logger.Logger) (*PostgreSQL, error) {
+	db, err := openPgxDatabase(cofigDBString)
+	if err != nil {
+		l.Sugar().Errorf("Failed to open a database: %s", err)
+		return &PostgreSQL{log: l}, err
+	}
+
+	return newPostgreSQL(db, l)
+}
+
+// newPostgreSQL pings the opened database and wraps it into a PostgreSQL instance.
+func newPostgreSQL(db database, l *logger.Logger) (*PostgreSQL, error) {
 	const defaultTimeout = 10 * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 	if err := db.PingContext(ctx); err != nil {
 		l.Sugar().Errorf("Database ping failed: %s", err)
-		return &PostgreSQL{db: db, log: l}, err
+		return &PostgreSQL{db: db, log: l, balanceIsolation: sql.LevelReadCommitted, maxCoinBalance: DefaultMaxCoinBalance, deadlineFloor: DefaultDeadlineFloor, leaderKeepAlive: DefaultLeaderKeepAlive}, err
 	}
 
-	return &PostgreSQL{db: db, log: l}, nil
+	return &PostgreSQL{db: db, log: l, balanceIsolation: sql.LevelReadCommitted, maxCoinBalance: DefaultMaxCoinBalance, deadlineFloor: DefaultDeadlineFloor, leaderKeepAlive: DefaultLeaderKeepAlive}, nil
+}
+
+// SetBalanceIsolation sets the isolation level of the transactions that mutate balances (BuyItem, GiftItem, TransferCoins)
+// and of the transactions started by WithinTransaction.
+// The default is sql.LevelReadCommitted: the balance updates are single atomic UPDATE statements guarded by the
+// coins >= 0 check constraint, so read committed is sufficient for them. sql.LevelSerializable additionally
+// protects multi-statement read-then-write logic; serialization failures are retried automatically.
+func (postgresql *PostgreSQL) SetBalanceIsolation(level sql.IsolationLevel) {
+	postgresql.balanceIsolation = level
+}
+
+// balanceTxOptions returns the options for transactions that mutate balances.
+func (postgresql *PostgreSQL) balanceTxOptions() *sql.TxOptions {
+	return &sql.TxOptions{Isolation: postgresql.balanceIsolation}
+}
+
+// readTxOptions returns the options for read-only transactions that aggregate user information.
+// Repeatable read makes every query of the transaction see the same snapshot, so a transfer committed
+// between two queries cannot show up in the history without being reflected in the balance.
+func (postgresql *PostgreSQL) readTxOptions() *sql.TxOptions {
+	return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
 }
 
 // Close closes the database connection if it is open.
@@ -90,64 +333,176 @@ func (postgresql *PostgreSQL) Close() {
 }
 
 // CheckUser verifies the user's credentials by retrieving the user's ID and encrypted password,
-// then checking the provided password against the stored hash.
+// then checking the provided password against the stored hash. The username is normalized first
+// (see models.NormalizeUsername).
 func (postgresql *PostgreSQL) CheckUser(ctx context.Context, user *models.User) (*models.User, error) {
 	var encryptedPassword string
+	user.Username = models.NormalizeUsername(user.Username)
 
-	err := postgresql.db.QueryRowContext(ctx, checkUserQuery, user.Username).Scan(&user.ID, &encryptedPassword)
+	err := postgresql.db.QueryRowContext(ctx, checkUserQuery, user.Username).Scan(&user.ID, &encryptedPassword, &user.TokenVersion)
 	if errors.Is(err, sql.ErrNoRows) {
 		return user, nil
 	}
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query checkUserQuery: %s", err)
+		postgresql.logQueryError(ctx, "CheckUser", err, zap.String("query", "checkUserQuery"),
+			zap.String("username", user.Username))
 		return user, err
 	}
 
 	err = security.CheckPassword(encryptedPassword, user.Password)
 	if err != nil {
-		postgresql.log.Sugar().Errorf(err.Error())
+		postgresql.logQueryError(ctx, "CheckUser", err, zap.String("stage", "checkPassword"),
+			zap.String("username", user.Username))
 		return user, err
 	}
 
 	return user, nil
 }
 
-// CreateUser registers a new user by hashing the password and inserting the user into the database.
+// CreateUser registers a new user by hashing the password and inserting the user into the database
+// under the normalized username (see models.NormalizeUsername).
 func (postgresql *PostgreSQL) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	encryptedPassword := security.HashPassword(user.Password)
+	user.Username = models.NormalizeUsername(user.Username)
 
 	err := postgresql.db.QueryRowContext(ctx, createUserQuery, user.Username, encryptedPassword, user.Coins).Scan(&user.ID)
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query createUserQuery: %s", err)
+		postgresql.logQueryError(ctx, "CreateUser", err, zap.String("query", "createUserQuery"),
+			zap.String("username", user.Username))
 		return user, err
 	}
 	return user, err
 }
 
-// GetItemPrice retrieves the ID and price of an item given its name, using a transaction.
-func (postgresql *PostgreSQL) GetItemPrice(ctx context.Context, tx *sql.Tx, itemName string) (*models.Item, error) {
+// DeleteUser removes the user together with their purchases, sessions, holds, and accrual entries.
+// It returns ErrUserNotFound when there is no such user and fails while the user takes part in any coin transfer or gift.
+func (postgresql *PostgreSQL) DeleteUser(ctx context.Context, userID int32) error {
+	result, err := postgresql.db.ExecContext(ctx, deleteUserQuery, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "DeleteUser", err, zap.String("query", "deleteUserQuery"), zap.Int32("userID", userID))
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "DeleteUser", err, zap.String("query", "deleteUserQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int32("userID", userID))
+		return err
+	}
+	if deleted == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetItemPrice retrieves the ID and price of an item given its name, using a transaction. The price is discounted
+// by the best promotion active at the start of the transaction, if any (see models.Promotion).
+// It returns ErrItemNotFound when there is no such item.
+func (postgresql *PostgreSQL) GetItemPrice(ctx context.Context, tx Tx, itemName string) (*models.Item, error) {
 	item := &models.Item{
 		Name: itemName,
 	}
 
-	err := tx.QueryRowContext(ctx, getItemPriceQuery, itemName).Scan(&item.ID, &item.Price)
+	var discount sql.NullInt32
+	var promotionID sql.NullInt64
+	err := postgresql.querier(ctx, tx).QueryRowContext(ctx, getItemPriceQuery, itemName).Scan(&item.ID, &item.OriginalPrice, &discount, &promotionID)
+	item.Price = item.OriginalPrice - int(discount.Int32)
+	item.PromotionID = nullInt64Ptr(promotionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return item, fmt.Errorf("%w: %w", ErrItemNotFound, err)
+	}
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query getItemPriceQuery: %s", err)
+		postgresql.logQueryError(ctx, "GetItemPrice", err, zap.String("query", "getItemPriceQuery"),
+			logger.ItemName(itemName))
 		return item, err
 	}
 
 	return item, nil
 }
 
+// GetItemByID retrieves the name and price of an item given its ID, for clients addressing items by their stable ID
+// rather than by name. It returns ErrItemNotFound when there is no such item.
+func (postgresql *PostgreSQL) GetItemByID(ctx context.Context, itemID int) (*models.Item, error) {
+	item := &models.Item{
+		ID: itemID,
+	}
+
+	err := postgresql.querier(ctx, nil).QueryRowContext(ctx, getItemByIDQuery, itemID).Scan(&item.Name, &item.Price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", ErrItemNotFound, err)
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetItemByID", err, zap.String("query", "getItemByIDQuery"), zap.Int("itemID", itemID))
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// GetMerchCatalog retrieves the names, categories, and prices of all items in the store, with the discounts of
+// the best promotions active now.
+func (postgresql *PostgreSQL) GetMerchCatalog(ctx context.Context) ([]models.CatalogItem, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getMerchCatalogQuery)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetMerchCatalog", err, zap.String("query", "getMerchCatalogQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	const catalogCapacity = 10
+	catalog := make([]models.CatalogItem, 0, catalogCapacity)
+	for rows.Next() {
+		item := models.CatalogItem{}
+		var category sql.NullString
+		var price int
+		var discount sql.NullInt32
+		var promotionID sql.NullInt64
+		if err := rows.Scan(&item.Name, &category, &price, &discount, &promotionID); err != nil {
+			postgresql.logQueryError(ctx, "GetMerchCatalog", err, zap.String("query", "getMerchCatalogQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+		item.Category = category.String
+		item.Price = price - int(discount.Int32)
+		if promotionID.Valid {
+			item.OriginalPrice, item.PromotionID = price, &promotionID.Int64
+		}
+		catalog = append(catalog, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetMerchCatalog", err, zap.String("query", "getMerchCatalogQuery"),
+			zap.String("stage", "rows"))
+		return catalog, err
+	}
+
+	return catalog, nil
+}
+
+// GetCatalogLastModified returns when the merch catalog last changed. Every statement inserting, updating,
+// or deleting merch or promotions bumps the time, and so does the start or the end of a promotion, so it changes
+// whenever prices or the set of items do.
+func (postgresql *PostgreSQL) GetCatalogLastModified(ctx context.Context) (time.Time, error) {
+	var lastModified time.Time
+	err := postgresql.db.QueryRowContext(ctx, getCatalogVersionQuery).Scan(&lastModified)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetCatalogLastModified", err, zap.String("query", "getCatalogVersionQuery"))
+		return time.Time{}, err
+	}
+
+	return lastModified, nil
+}
+
 // GetUserInfo retrieves the username and coin balance for a given user ID using a transaction.
-func (postgresql *PostgreSQL) GetUserInfo(ctx context.Context, tx *sql.Tx, userID int32) (*models.User, error) {
+func (postgresql *PostgreSQL) GetUserInfo(ctx context.Context, tx Tx, userID int32) (*models.User, error) {
 	user := &models.User{
 		ID: userID,
 	}
 
-	err := tx.QueryRowContext(ctx, getUserInfoQuery, user.ID).Scan(&user.Username, &user.Coins)
+	err := postgresql.querier(ctx, tx).QueryRowContext(ctx, getUserInfoQuery, user.ID).Scan(&user.Username, &user.Coins)
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query getUserInfoQuery: %s", err)
+		postgresql.logQueryError(ctx, "GetUserInfo", err, zap.String("query", "getUserInfoQuery"), zap.Int32("userID", userID))
 		return user, err
 	}
 
@@ -155,31 +510,105 @@ func (postgresql *PostgreSQL) GetUserInfo(ctx context.Context, tx *sql.Tx, userI
 }
 
 // UpdateUserCoins updates the user's coin balance by adding the specified number of coins.
-func (postgresql *PostgreSQL) UpdateUserCoins(ctx context.Context, tx *sql.Tx, userID int32, coins int) error {
-	result, err := tx.ExecContext(ctx, updateUserCoinsQuery, coins, userID)
+// It returns ErrUserNotFound when no user with the given ID exists, and ErrBalanceCapExceeded when
+// a credit would push the balance over the maximum coin balance.
+func (postgresql *PostgreSQL) UpdateUserCoins(ctx context.Context, tx Tx, userID int32, coins int64) error {
+	if err := postgresql.ensureBalanceCap(ctx, tx, userID, coins); err != nil {
+		return err
+	}
+
+	result, err := postgresql.querier(ctx, tx).ExecContext(ctx, updateUserCoinsQuery, coins, userID)
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query updateUserCoinsQuery: %s", err)
+		postgresql.logQueryError(ctx, "UpdateUserCoins", err, zap.String("query", "updateUserCoinsQuery"),
+			zap.Int32("userID", userID), zap.Int64("coins", coins))
 		return err
 	}
 	rows, err := result.RowsAffected()
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute RowsAffected in updateUserCoinsQuery: %s", err)
-		postgresql.log.Sugar().Infof("Affected rows: %d", rows)
+		postgresql.logQueryError(ctx, "UpdateUserCoins", err, zap.String("query", "updateUserCoinsQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int32("userID", userID), zap.Int64("coins", coins))
 		return err
 	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
 
 	return nil
 }
 
-// GetUserID retrieves a user's ID given their username using a transaction.
-func (postgresql *PostgreSQL) GetUserID(ctx context.Context, tx *sql.Tx, username string) (*models.User, error) {
+// IsUserActive reports whether the user with the given ID exists and has not been deactivated.
+func (postgresql *PostgreSQL) IsUserActive(ctx context.Context, userID int32) (bool, error) {
+	var active bool
+	err := postgresql.db.QueryRowContext(ctx, isUserActiveQuery, userID).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "IsUserActive", err, zap.String("query", "isUserActiveQuery"), zap.Int32("userID", userID))
+		return false, err
+	}
+
+	return active, nil
+}
+
+// IsUserAdmin reports whether the user with the given ID exists, is active, and has administrator rights.
+func (postgresql *PostgreSQL) IsUserAdmin(ctx context.Context, userID int32) (bool, error) {
+	var admin bool
+	err := postgresql.db.QueryRowContext(ctx, isUserAdminQuery, userID).Scan(&admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "IsUserAdmin", err, zap.String("query", "isUserAdminQuery"), zap.Int32("userID", userID))
+		return false, err
+	}
+
+	return admin, nil
+}
+
+// GetTokenVersion returns the token version of the user with the given ID and reports whether the user exists
+// and has not been deactivated. A missing user is reported as inactive with version zero.
+func (postgresql *PostgreSQL) GetTokenVersion(ctx context.Context, userID int32) (version int32, active bool, err error) {
+	err = postgresql.db.QueryRowContext(ctx, getTokenVersionQuery, userID).Scan(&version, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetTokenVersion", err, zap.String("query", "getTokenVersionQuery"),
+			zap.Int32("userID", userID))
+		return 0, false, err
+	}
+
+	return version, active, nil
+}
+
+// BumpTokenVersion increments the token version of the user, so that the tokens issued before become stale,
+// and returns the new version. It returns ErrUserNotFound when the user does not exist.
+func (postgresql *PostgreSQL) BumpTokenVersion(ctx context.Context, userID int32) (int32, error) {
+	var version int32
+	err := postgresql.db.QueryRowContext(ctx, bumpTokenVersionQuery, userID).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "BumpTokenVersion", err, zap.String("query", "bumpTokenVersionQuery"),
+			zap.Int32("userID", userID))
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// GetUserID retrieves a user's ID given their username, normalized first (see models.NormalizeUsername),
+// using a transaction.
+func (postgresql *PostgreSQL) GetUserID(ctx context.Context, tx Tx, username string) (*models.User, error) {
 	user := &models.User{
-		Username: username,
+		Username: models.NormalizeUsername(username),
 	}
 
-	err := tx.QueryRowContext(ctx, getUserIDQuery, user.Username).Scan(&user.ID)
+	err := postgresql.querier(ctx, tx).QueryRowContext(ctx, getUserIDQuery, user.Username).Scan(&user.ID)
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query getUserIDQuery: %s", err)
+		postgresql.logQueryError(ctx, "GetUserID", err, zap.String("query", "getUserIDQuery"), zap.String("username", username))
 		return user, err
 	}
 
@@ -187,39 +616,154 @@ func (postgresql *PostgreSQL) GetUserID(ctx context.Context, tx *sql.Tx, usernam
 }
 
 // BuyItem processes the purchase of an item by a user.
-// It uses a transaction to update the user's coin balance and record the purchase.
-func (postgresql *PostgreSQL) BuyItem(ctx context.Context, userID int32, itemName string) error {
-	tx, err := postgresql.db.BeginTx(ctx, nil)
+// It uses a transaction to update the user's coin balance and record the purchase,
+// and returns the item's price together with the buyer's remaining balance. The price is read within the same
+// transaction, so the buyer is always charged the current price of the item.
+// It returns ErrUserNotFound, without recording the purchase, when the buyer does not exist.
+func (postgresql *PostgreSQL) BuyItem(ctx context.Context, userID int32, itemName string) (*models.PurchaseResult, error) {
+	var purchase *models.PurchaseResult
+	err := postgresql.inTransaction(ctx, "BuyItem", func(ctx context.Context) error {
+		var err error
+		purchase, err = postgresql.buyItem(ctx, userID, itemName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return purchase, nil
+}
+
+// buyItem runs the steps of BuyItem within the transaction stored in ctx.
+func (postgresql *PostgreSQL) buyItem(ctx context.Context, userID int32, itemName string) (*models.PurchaseResult, error) {
+	item, err := postgresql.GetItemPrice(ctx, nil, itemName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	return postgresql.chargePurchase(ctx, userID, sql.NullInt32{}, item)
+}
+
+// chargePurchase charges the user for one unit of the item, records the purchase with its receipt number, the price
+// paid, and the promotion discounting it, and adds the item to the user's inventory, within the transaction stored
+// in ctx. A purchase made on the user's behalf notes its buyer in boughtBy.
+func (postgresql *PostgreSQL) chargePurchase(ctx context.Context, userID int32, boughtBy sql.NullInt32, item *models.Item) (*models.PurchaseResult, error) {
+	err := postgresql.ensureAvailableCoins(ctx, nil, userID, item.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	purchase := &models.PurchaseResult{Item: item.Name, Price: item.Price, Quantity: 1}
+	if item.PromotionID != nil {
+		purchase.OriginalPrice, purchase.PromotionID = item.OriginalPrice, item.PromotionID
+	}
+
+	err = postgresql.querier(ctx, nil).QueryRowContext(ctx, spendUserCoinsQuery, item.Price, userID).Scan(&purchase.RemainingCoins)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "chargePurchase", err, zap.String("query", "spendUserCoinsQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	err = postgresql.querier(ctx, nil).QueryRowContext(ctx, buyItemQuery, userID, item.ID, purchase.Quantity, boughtBy, item.Price,
+		nullPromotionID(item.PromotionID)).Scan(&purchase.ReceiptNumber)
+	if err != nil {
+		postgresql.logQueryError(ctx, "chargePurchase", err, zap.String("query", "buyItemQuery"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	if err = postgresql.addInventoryCount(ctx, nil, userID, item.ID, purchase.Quantity); err != nil {
+		return nil, err
+	}
+
+	return purchase, nil
+}
+
+// GiftItem processes the purchase of an item by a user on behalf of another user.
+// The buyer is charged, while the purchase is recorded against the recipient with the buyer noted in gifted_by.
+// Gifts are discounted by promotions like any other purchase. The recipient is notified of the gift.
+func (postgresql *PostgreSQL) GiftItem(ctx context.Context, userID int32, itemName string, req models.GiftRequest) error {
+	return postgresql.inTransaction(ctx, "GiftItem", func(ctx context.Context) error {
+		return postgresql.giftItem(ctx, userID, itemName, req)
+	})
+}
+
+// giftItem runs the steps of GiftItem within the transaction stored in ctx.
+func (postgresql *PostgreSQL) giftItem(ctx context.Context, userID int32, itemName string, req models.GiftRequest) error {
+	item, err := postgresql.GetItemPrice(ctx, nil, itemName)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	item, err := postgresql.GetItemPrice(ctx, tx, itemName)
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return err
+	}
+
+	toUser, err := postgresql.GetUserID(ctx, nil, req.ToUser)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecipientNotFound
+	}
 	if err != nil {
 		return err
 	}
 
-	err = postgresql.UpdateUserCoins(ctx, tx, userID, -item.Price)
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return err
+	}
+
+	if err = postgresql.ensureAvailableCoins(ctx, nil, userID, item.Price); err != nil {
+		return err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return err
+	}
+
+	err = postgresql.UpdateUserCoins(ctx, nil, userID, -int64(item.Price))
 	if err != nil {
 		return err
 	}
 
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return err
+	}
+
 	quantity := 1
 
-	result, err := tx.ExecContext(ctx, buyItemQuery, userID, item.ID, quantity)
+	result, err := postgresql.querier(ctx, nil).ExecContext(ctx, giftItemQuery, toUser.ID, item.ID, quantity, userID, item.Price, nullPromotionID(item.PromotionID))
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query buyItemQuery: %s", err)
+		postgresql.logQueryError(ctx, "giftItem", err, zap.String("query", "giftItemQuery"), zap.Int32("userID", userID),
+			logger.ItemName(itemName), zap.String("toUser", req.ToUser))
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute RowsAffected in buyItemQuery: %s", err)
-		postgresql.log.Sugar().Infof("Affected rows: %d", rows)
+	if _, err = result.RowsAffected(); err != nil {
+		postgresql.logQueryError(ctx, "giftItem", err, zap.String("query", "giftItemQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int32("userID", userID), logger.ItemName(itemName),
+			zap.String("toUser", req.ToUser))
 		return err
 	}
 
-	if err = tx.Commit(); err != nil {
+	if err = postgresql.addInventoryCount(ctx, nil, toUser.ID, item.ID, quantity); err != nil {
+		return err
+	}
+
+	err = postgresql.notify(ctx, nil, notification{UserID: toUser.ID, Category: NotificationGiftReceived, ActorID: userID, Item: item.Name})
+	if err != nil {
 		return err
 	}
 
@@ -227,54 +771,106 @@ func (postgresql *PostgreSQL) BuyItem(ctx context.Context, userID int32, itemNam
 }
 
 // TransferCoins processes the transfer of coins from one user to another.
-// It updates both users' coin balances and records the transfer in the database within a transaction.
-func (postgresql *PostgreSQL) TransferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) error {
-	tx, err := postgresql.db.BeginTx(ctx, nil)
-	if err != nil {
+// It updates both users' coin balances and records the transfer in the database within a transaction,
+// returning the ID of the recorded transfer and the sender's balance after it. Nothing is changed when either user
+// is missing: it returns ErrUserNotFound for the sender and ErrRecipientNotFound for the recipient. While a gifting
+// campaign is active, the recipient is also credited with its bonus, paid from the campaign budget and recorded
+// separately from the amount (see payCampaignBonus); the sender is only charged the amount. The recipient is
+// notified of the transfer.
+func (postgresql *PostgreSQL) TransferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+	var transfer *models.TransferResult
+	err := postgresql.inTransaction(ctx, "TransferCoins", func(ctx context.Context) error {
+		var err error
+		transfer, err = postgresql.transferCoins(ctx, userID, req)
 		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// transferCoins runs the steps of TransferCoins within the transaction stored in ctx.
+func (postgresql *PostgreSQL) transferCoins(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferResult, error) {
+	if err := postgresql.ensureAvailableCoins(ctx, nil, userID, int(req.Amount)); err != nil {
+		return nil, err
 	}
-	defer tx.Rollback()
 
-	err = postgresql.UpdateUserCoins(ctx, tx, userID, -req.Amount)
+	if err := postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	transfer := &models.TransferResult{}
+
+	err := postgresql.querier(ctx, nil).QueryRowContext(ctx, spendUserCoinsQuery, int64(req.Amount), userID).Scan(&transfer.RemainingCoins)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
-		return err
+		postgresql.logQueryError(ctx, "transferCoins", err, zap.String("query", "spendUserCoinsQuery"),
+			zap.Int32("userID", userID), zap.String("toUser", req.ToUser), zap.Int("amount", int(req.Amount)))
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
 	}
 
-	toUser, err := postgresql.GetUserID(ctx, tx, req.ToUser)
+	toUser, err := postgresql.GetUserID(ctx, nil, req.ToUser)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecipientNotFound
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = postgresql.UpdateUserCoins(ctx, tx, toUser.ID, req.Amount)
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	err = postgresql.UpdateUserCoins(ctx, nil, toUser.ID, int64(req.Amount))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrRecipientNotFound
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
 	}
 
-	result, err := tx.ExecContext(ctx, transferCoinsQuery, userID, toUser.ID, req.Amount)
+	bonus, campaignID, err := postgresql.payCampaignBonus(ctx, toUser.ID, int64(req.Amount))
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query transferCoinsQuery: %s", err)
-		return err
+		return nil, err
 	}
-	rows, err := result.RowsAffected()
+
+	err = postgresql.querier(ctx, nil).QueryRowContext(ctx, transferCoinsQuery, userID, toUser.ID, int(req.Amount), bonus, campaignID).Scan(&transfer.TransferID)
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute RowsAffected in transferCoinsQuery: %s", err)
-		postgresql.log.Sugar().Infof("Affected rows: %d", rows)
-		return err
+		postgresql.logQueryError(ctx, "transferCoins", err, zap.String("query", "transferCoinsQuery"),
+			zap.Int32("userID", userID), zap.String("toUser", req.ToUser), zap.Int("amount", int(req.Amount)))
+		return nil, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
+	err = postgresql.notify(ctx, nil, notification{UserID: toUser.ID, Category: NotificationCoinsReceived, ActorID: userID, Amount: int(req.Amount)})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return transfer, nil
 }
 
 // GetMerchPurchasesInfo retrieves a list of merchandise purchase records for a user.
-// It returns a slice of InventoryItem representing the purchased items and their quantities.
-func (postgresql *PostgreSQL) GetMerchPurchasesInfo(ctx context.Context, tx *sql.Tx, userID int32) ([]models.InventoryItem, error) {
-	rows, err := tx.QueryContext(ctx, getMerchPurchasesQuery, userID)
+// It returns a slice of InventoryItem representing the purchased items, their categories, and their total, pending,
+// and fulfilled quantities.
+// The quantities are read from content.inventory_counts, kept in sync with the purchase rows by every operation changing
+// them, so the cost depends on the number of distinct items rather than on the number of purchases.
+func (postgresql *PostgreSQL) GetMerchPurchasesInfo(ctx context.Context, tx Tx, userID int32) ([]models.InventoryItem, error) {
+	rows, err := postgresql.querier(ctx, tx).QueryContext(ctx, getMerchPurchasesQuery, userID)
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query getMerchPurchasesQuery: %s", err)
+		postgresql.logQueryError(ctx, "GetMerchPurchasesInfo", err, zap.String("query", "getMerchPurchasesQuery"),
+			zap.Int32("userID", userID))
 		return nil, err
 	}
 	defer rows.Close()
@@ -284,16 +880,20 @@ func (postgresql *PostgreSQL) GetMerchPurchasesInfo(ctx context.Context, tx *sql
 
 	for rows.Next() {
 		inventoryItem := models.InventoryItem{}
-		if err := rows.Scan(&inventoryItem.Type, &inventoryItem.Quantity); err != nil {
-			postgresql.log.Sugar().Errorf("Failed to scan order information in GetMerchPurchasesInfo method: %s", err)
+		var category sql.NullString
+		if err := rows.Scan(&inventoryItem.Type, &category, &inventoryItem.Quantity, &inventoryItem.PendingQuantity, &inventoryItem.FulfilledQuantity); err != nil {
+			postgresql.logQueryError(ctx, "GetMerchPurchasesInfo", err, zap.String("query", "getMerchPurchasesQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
 			return nil, err
 		}
+		inventoryItem.Category = category.String
 
 		inventory = append(inventory, inventoryItem)
 	}
 
 	if err := rows.Err(); err != nil {
-		postgresql.log.Sugar().Errorf("The last error encountered by Rows.Scan in GetMerchPurchasesInfo method: %s", err)
+		postgresql.logQueryError(ctx, "GetMerchPurchasesInfo", err, zap.String("query", "getMerchPurchasesQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
 		return inventory, err
 	}
 
@@ -303,10 +903,17 @@ func (postgresql *PostgreSQL) GetMerchPurchasesInfo(ctx context.Context, tx *sql
 // GetCoinsTransactionInfo retrieves coin transaction details for a user.
 // The 'query' parameter determines whether to fetch sent or received transactions.
 // It returns a slice of TransactionDetail containing the transaction data.
-func (postgresql *PostgreSQL) GetCoinsTransactionInfo(ctx context.Context, tx *sql.Tx, userID int32, username string, query string) ([]models.TransactionDetail, error) {
-	rows, err := tx.QueryContext(ctx, query, userID)
+func (postgresql *PostgreSQL) GetCoinsTransactionInfo(ctx context.Context, tx Tx, userID int32, username string, query string) ([]models.TransactionDetail, error) {
+	return postgresql.getCoinsTransactionInfo(ctx, tx, userID, username, query, sql.NullInt64{})
+}
+
+// getCoinsTransactionInfo retrieves like GetCoinsTransactionInfo the limit most recent transactions of the user,
+// or all of them when limit is not valid.
+func (postgresql *PostgreSQL) getCoinsTransactionInfo(ctx context.Context, tx Tx, userID int32, username string, query string, limit sql.NullInt64) ([]models.TransactionDetail, error) {
+	rows, err := postgresql.querier(ctx, tx).QueryContext(ctx, query, userID, limit)
 	if err != nil {
-		postgresql.log.Sugar().Errorf("Failed to execute a query getCoinsTransactionQuery: %s", err)
+		postgresql.logQueryError(ctx, "getCoinsTransactionInfo", err, zap.String("query", "getCoinsTransactionQuery"),
+			zap.Int32("userID", userID), zap.String("username", username))
 		return nil, err
 	}
 	defer rows.Close()
@@ -317,14 +924,18 @@ func (postgresql *PostgreSQL) GetCoinsTransactionInfo(ctx context.Context, tx *s
 		transactionDetail := models.TransactionDetail{}
 		if query == getSendCoinsQuery {
 			transactionDetail.FromUser = username
-			if err := rows.Scan(&transactionDetail.ToUser, &transactionDetail.Amount); err != nil {
-				postgresql.log.Sugar().Errorf("Failed to scan order information in GetCoinsTransactionInfo method: %s", err)
+			if err := rows.Scan(&transactionDetail.ID, &transactionDetail.ToUser, &transactionDetail.Amount); err != nil {
+				postgresql.logQueryError(ctx, "getCoinsTransactionInfo", err,
+					zap.String("query", "getCoinsTransactionQuery"), zap.String("stage", "scan"),
+					zap.Int32("userID", userID), zap.String("username", username))
 				return nil, err
 			}
 		} else {
 			transactionDetail.ToUser = username
-			if err := rows.Scan(&transactionDetail.FromUser, &transactionDetail.Amount); err != nil {
-				postgresql.log.Sugar().Errorf("Failed to scan order information in GetCoinsTransactionInfo method: %s", err)
+			if err := rows.Scan(&transactionDetail.ID, &transactionDetail.FromUser, &transactionDetail.Amount); err != nil {
+				postgresql.logQueryError(ctx, "getCoinsTransactionInfo", err,
+					zap.String("query", "getCoinsTransactionQuery"), zap.String("stage", "scan"),
+					zap.Int32("userID", userID), zap.String("username", username))
 				return nil, err
 			}
 		}
@@ -332,52 +943,345 @@ func (postgresql *PostgreSQL) GetCoinsTransactionInfo(ctx context.Context, tx *s
 	}
 
 	if err := rows.Err(); err != nil {
-		postgresql.log.Sugar().Errorf("The last error encountered by Rows.Scan in GetCoinsTransactionInfo method: %s", err)
+		postgresql.logQueryError(ctx, "getCoinsTransactionInfo", err, zap.String("query", "getCoinsTransactionQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID), zap.String("username", username))
 		return transactionDetailInfo, err
 	}
 
 	return transactionDetailInfo, err
 }
 
+// GetSentGiftsInfo retrieves the items a user has bought as gifts for other users.
+// It returns a slice of GiftDetail containing the recipient, the item, and the coins spent.
+func (postgresql *PostgreSQL) GetSentGiftsInfo(ctx context.Context, tx Tx, userID int32) ([]models.GiftDetail, error) {
+	rows, err := postgresql.querier(ctx, tx).QueryContext(ctx, getSentGiftsQuery, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetSentGiftsInfo", err, zap.String("query", "getSentGiftsQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	const giftDetailCapacity = 10
+	giftDetailInfo := make([]models.GiftDetail, 0, giftDetailCapacity)
+	for rows.Next() {
+		giftDetail := models.GiftDetail{}
+		if err := rows.Scan(&giftDetail.ToUser, &giftDetail.Item, &giftDetail.Amount); err != nil {
+			postgresql.logQueryError(ctx, "GetSentGiftsInfo", err, zap.String("query", "getSentGiftsQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		giftDetailInfo = append(giftDetailInfo, giftDetail)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetSentGiftsInfo", err, zap.String("query", "getSentGiftsQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return giftDetailInfo, err
+	}
+
+	return giftDetailInfo, err
+}
+
+// StreamCoinHistory passes every coin transfer sent or received by a user to fn, newest first.
+// Rows are scanned one at a time, so memory usage does not depend on the size of the history.
+// Iteration stops at the first error returned by fn, which is then returned to the caller.
+func (postgresql *PostgreSQL) StreamCoinHistory(ctx context.Context, userID int32, fn func(models.TransactionDetail) error) error {
+	rows, err := postgresql.db.QueryContext(ctx, getCoinHistoryQuery, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "StreamCoinHistory", err, zap.String("query", "getCoinHistoryQuery"),
+			zap.Int32("userID", userID))
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transactionDetail := models.TransactionDetail{}
+		if err := rows.Scan(&transactionDetail.ID, &transactionDetail.FromUser, &transactionDetail.ToUser, &transactionDetail.Amount); err != nil {
+			postgresql.logQueryError(ctx, "StreamCoinHistory", err, zap.String("query", "getCoinHistoryQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return err
+		}
+
+		if err := fn(transactionDetail); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "StreamCoinHistory", err, zap.String("query", "getCoinHistoryQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return err
+	}
+
+	return nil
+}
+
+// GetTransfers returns a page of the user's transfers, newest first, using keyset pagination on (created_at, id).
+// Transfers committed after the first page was read never shift the following pages. Archived transfers
+// (see ArchiveTransfers) are included only when filter.IncludeArchived is set.
+func (postgresql *PostgreSQL) GetTransfers(ctx context.Context, userID int32, filter models.TransfersFilter) ([]models.Transfer, error) {
+	var query string
+	switch filter.Direction {
+	case TransferDirectionAll, "":
+		query = getTransfersQuery
+		if filter.IncludeArchived {
+			query = getArchivedTransfersQuery
+		}
+	case TransferDirectionSent:
+		query = getSentTransfersQuery
+		if filter.IncludeArchived {
+			query = getArchivedSentTransfersQuery
+		}
+	case TransferDirectionReceived:
+		query = getRecvTransfersQuery
+		if filter.IncludeArchived {
+			query = getArchivedRecvTransfersQuery
+		}
+	default:
+		return nil, ErrUnknownTransferDirection
+	}
+
+	var afterCreatedAt, afterID any
+	if filter.After != nil {
+		afterCreatedAt, afterID = filter.After.CreatedAt, filter.After.ID
+	}
+
+	rows, err := postgresql.db.QueryContext(ctx, query, userID, afterCreatedAt, afterID, filter.Limit)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetTransfers", err, zap.String("query", "getTransfersQuery"), zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := make([]models.Transfer, 0, filter.Limit)
+	for rows.Next() {
+		transfer := models.Transfer{}
+		var campaignID sql.NullInt64
+		if err := rows.Scan(&transfer.ID, &transfer.FromUser, &transfer.ToUser, &transfer.Amount, &transfer.Bonus, &campaignID, &transfer.CreatedAt); err != nil {
+			postgresql.logQueryError(ctx, "GetTransfers", err, zap.String("query", "getTransfersQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		transfer.CampaignID = nullInt64Ptr(campaignID)
+		transfers = append(transfers, transfer)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetTransfers", err, zap.String("query", "getTransfersQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return transfers, err
+	}
+
+	return transfers, nil
+}
+
+// GetTransfer returns the transfer with the given ID when the user is its sender or recipient, archived or not.
+// It returns ErrTransferNotFound otherwise, without revealing whether the transfer exists.
+func (postgresql *PostgreSQL) GetTransfer(ctx context.Context, userID int32, transferID int64) (*models.Transfer, error) {
+	transfer := &models.Transfer{}
+	var campaignID sql.NullInt64
+	err := postgresql.db.QueryRowContext(ctx, getTransferQuery, transferID, userID).
+		Scan(&transfer.ID, &transfer.FromUser, &transfer.ToUser, &transfer.Amount, &transfer.Bonus, &campaignID, &transfer.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransferNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetTransfer", err, zap.String("query", "getTransferQuery"),
+			zap.Int32("userID", userID), zap.Int64("transferID", transferID))
+		return nil, err
+	}
+	transfer.CampaignID = nullInt64Ptr(campaignID)
+
+	return transfer, nil
+}
+
 // GetInfo aggregates complete information about a user, including coin balance, inventory, and transaction history.
-// It uses a transaction to combine data from multiple queries and returns an InfoResponse.
+// All queries run in a single read-only transaction (see readTxOptions), so the balance and the history come from
+// the same snapshot. The InfoResponse is built only once the transaction has been committed: on any error,
+// including a failed commit, GetInfo returns nil and never a partially populated response.
+// It returns ErrDeadlineTooClose instead of starting the next query when ctx is about to expire.
 func (postgresql *PostgreSQL) GetInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
-	infoResponse := &models.InfoResponse{}
+	return postgresql.getInfo(ctx, userID, sql.NullInt64{})
+}
 
-	tx, err := postgresql.db.BeginTx(ctx, nil)
+// CountCoinHistory returns the number of coin transfers the user has sent and received. Both are counted from
+// the indexes on the sender and the recipient, without reading the transfers, so the count stays cheap however
+// long the history is.
+func (postgresql *PostgreSQL) CountCoinHistory(ctx context.Context, userID int32) (sent int64, received int64, err error) {
+	err = postgresql.db.QueryRowContext(ctx, countCoinHistoryQuery, userID).Scan(&sent, &received)
 	if err != nil {
-		return infoResponse, err
+		postgresql.logQueryError(ctx, "CountCoinHistory", err, zap.String("query", "countCoinHistoryQuery"),
+			zap.Int32("userID", userID))
+		return 0, 0, err
+	}
+
+	return sent, received, nil
+}
+
+// GetInfoWithHistoryLimit aggregates the same information as GetInfo, but returns only the limit most recent sent
+// and received transfers. TotalSent and TotalReceived hold the size of the whole history, counted in the same
+// snapshot, and Truncated is set when either list is missing transfers.
+func (postgresql *PostgreSQL) GetInfoWithHistoryLimit(ctx context.Context, userID int32, limit int) (*models.InfoResponse, error) {
+	return postgresql.getInfo(ctx, userID, sql.NullInt64{Int64: int64(limit), Valid: true})
+}
+
+// getInfo implements GetInfo and, when historyLimit is valid, GetInfoWithHistoryLimit.
+func (postgresql *PostgreSQL) getInfo(ctx context.Context, userID int32, historyLimit sql.NullInt64) (*models.InfoResponse, error) {
+	tx, err := postgresql.db.BeginTx(ctx, postgresql.readTxOptions())
+	if err != nil {
+		return nil, err
 	}
 	defer tx.Rollback()
 
 	user, err := postgresql.GetUserInfo(ctx, tx, userID)
 	if err != nil {
-		return infoResponse, err
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
 	}
 
 	inventory, err := postgresql.GetMerchPurchasesInfo(ctx, tx, userID)
 	if err != nil {
-		return infoResponse, err
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
 	}
 
-	transactionDetailSent, err := postgresql.GetCoinsTransactionInfo(ctx, tx, userID, user.Username, getSendCoinsQuery)
+	var totalSent, totalReceived int64
+	if historyLimit.Valid {
+		err = tx.QueryRowContext(ctx, countCoinHistoryQuery, userID).Scan(&totalSent, &totalReceived)
+		if err != nil {
+			postgresql.logQueryError(ctx, "getInfo", err, zap.String("query", "countCoinHistoryQuery"),
+				zap.Int32("userID", userID))
+			return nil, err
+		}
+
+		if err = postgresql.checkDeadline(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	transactionDetailSent, err := postgresql.getCoinsTransactionInfo(ctx, tx, userID, user.Username, getSendCoinsQuery, historyLimit)
 	if err != nil {
-		return infoResponse, err
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	transactionDetailReceived, err := postgresql.getCoinsTransactionInfo(ctx, tx, userID, user.Username, getReceivedCoinsQuery, historyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
 	}
 
-	transactionDetailReceived, err := postgresql.GetCoinsTransactionInfo(ctx, tx, userID, user.Username, getReceivedCoinsQuery)
+	giftDetailSent, err := postgresql.GetSentGiftsInfo(ctx, tx, userID)
 	if err != nil {
-		return infoResponse, err
+		return nil, err
 	}
 
-	coinHistory := &models.CoinHistory{Received: transactionDetailReceived, Sent: transactionDetailSent}
-	infoResponse.Coins = user.Coins
-	infoResponse.Inventory = inventory
-	infoResponse.CoinHistory = coinHistory
+	if err = postgresql.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	heldCoins, err := postgresql.GetActiveHoldsAmount(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
 
 	if err = tx.Commit(); err != nil {
-		return infoResponse, err
+		postgresql.logQueryError(ctx, "GetInfo", err, zap.String("stage", "commit"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	info := &models.InfoResponse{
+		Coins:          user.Coins,
+		AvailableCoins: user.Coins - int64(heldCoins),
+		Inventory:      inventory,
+		CoinHistory:    models.CoinHistory{Received: transactionDetailReceived, Sent: transactionDetailSent, Gifts: giftDetailSent},
+	}
+	if historyLimit.Valid {
+		info.TotalSent, info.TotalReceived = totalSent, totalReceived
+		info.Truncated = totalSent > int64(len(transactionDetailSent)) || totalReceived > int64(len(transactionDetailReceived))
+	}
+
+	return info, nil
+}
+
+// Sections of the info response that GetPartialInfo reports in InfoResponse.Warnings when they fail to load.
+const (
+	InfoSectionInventory = "inventory"
+	InfoSectionSent      = "coinHistory.sent"
+	InfoSectionReceived  = "coinHistory.received"
+	InfoSectionGifts     = "coinHistory.gifts"
+)
+
+// GetPartialInfo aggregates the same information as GetInfo, but tolerates failures of the secondary sections:
+// the inventory and the sent, received, and gifted history. The balance, including the coins held, is loaded first
+// and any error loading it is returned. The secondary sections are then loaded concurrently, each by a query of its
+// own outside any transaction, so that a locked or slow table neither aborts nor delays the others beyond ctx;
+// the sections that fail are left empty and named in Warnings, in the order of the InfoSection constants.
+// Unlike GetInfo, the sections do not come from a single snapshot.
+func (postgresql *PostgreSQL) GetPartialInfo(ctx context.Context, userID int32) (*models.InfoResponse, error) {
+	user, err := postgresql.GetUserInfo(ctx, nil, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	heldCoins, err := postgresql.GetActiveHoldsAmount(ctx, nil, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &models.InfoResponse{Coins: user.Coins, AvailableCoins: user.Coins - int64(heldCoins)}
+	sections := []struct {
+		name string
+		load func() error
+	}{
+		{InfoSectionInventory, func() (err error) {
+			info.Inventory, err = postgresql.GetMerchPurchasesInfo(ctx, nil, userID)
+			return err
+		}},
+		{InfoSectionSent, func() (err error) {
+			info.CoinHistory.Sent, err = postgresql.GetCoinsTransactionInfo(ctx, nil, userID, user.Username, getSendCoinsQuery)
+			return err
+		}},
+		{InfoSectionReceived, func() (err error) {
+			info.CoinHistory.Received, err = postgresql.GetCoinsTransactionInfo(ctx, nil, userID, user.Username, getReceivedCoinsQuery)
+			return err
+		}},
+		{InfoSectionGifts, func() (err error) {
+			info.CoinHistory.Gifts, err = postgresql.GetSentGiftsInfo(ctx, nil, userID)
+			return err
+		}},
+	}
+
+	errs := make([]error, len(sections))
+	var wg sync.WaitGroup
+	for i, section := range sections {
+		wg.Add(1)
+		go func(i int, load func() error) {
+			defer wg.Done()
+			errs[i] = load()
+		}(i, section.load)
+	}
+	wg.Wait()
+
+	for i, section := range sections {
+		if errs[i] != nil {
+			postgresql.log.Sugar().Warnf("Failed to load the %s section of the info of user %d: %s", section.name, userID, errs[i])
+			info.Warnings = append(info.Warnings, section.name)
+		}
 	}
 
-	return infoResponse, nil
+	return info, nil
 }
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+)
+
+const (
+	// bestPromotionJoin joins every item m with bp, the ID and the discount in coins of its best active promotion:
+	// the one targeting the item or its category that takes the most coins off its price, the earliest created on
+	// a tie. A discount never brings the price below one coin, and items without a promotion taking at least one
+	// coin off get NULLs.
+	bestPromotionJoin = `
+	LEFT JOIN LATERAL (
+		SELECT p.id, LEAST(COALESCE(p.discount_amount, m.price * p.discount_percent / 100), m.price - 1) AS discount
+		FROM content.promotions p
+		WHERE (p.merch_id = m.id OR p.category = m.category) AND p.starts_at <= NOW() AND p.ends_at > NOW()
+		ORDER BY 2 DESC, p.id
+		LIMIT 1) bp ON bp.discount > 0`
+
+	getItemIDQuery       = `SELECT id FROM content.merch WHERE merch_name = $1;`
+	createPromotionQuery = `INSERT INTO content.promotions (merch_id, category, discount_percent, discount_amount, starts_at, ends_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at;`
+	getPromotionsQuery   = `SELECT p.id, m.merch_name, p.category, p.discount_percent, p.discount_amount, p.starts_at, p.ends_at, p.created_at FROM content.promotions p LEFT JOIN content.merch m ON p.merch_id = m.id ORDER BY p.starts_at DESC, p.id DESC;`
+	getPromotionQuery    = `SELECT p.id, m.merch_name, p.category, p.discount_percent, p.discount_amount, p.starts_at, p.ends_at, p.created_at FROM content.promotions p LEFT JOIN content.merch m ON p.merch_id = m.id WHERE p.id = $1;`
+	updatePromotionQuery = `UPDATE content.promotions SET merch_id = $2, category = $3, discount_percent = $4, discount_amount = $5, starts_at = $6, ends_at = $7 WHERE id = $1 RETURNING created_at;`
+	deletePromotionQuery = `DELETE FROM content.promotions p WHERE p.id = $1 AND NOT EXISTS (SELECT 1 FROM content.merch_purchases mp WHERE mp.promotion_id = p.id);`
+)
+
+// Predefined errors for promotions.
+var (
+	// ErrPromotionNotFound indicates that no promotion with the given ID exists.
+	ErrPromotionNotFound = errors.New("storage: promotion not found")
+	// ErrPromotionInUse indicates that the promotion cannot be deleted because purchases were discounted by it.
+	ErrPromotionInUse = errors.New("storage: promotion has discounted purchases")
+)
+
+// CreatePromotion stores a promotion and returns it with its ID and creation time. It returns ErrItemNotFound
+// when the promotion targets an item that does not exist.
+func (postgresql *PostgreSQL) CreatePromotion(ctx context.Context, promotion models.Promotion) (*models.Promotion, error) {
+	merchID, err := postgresql.promotionItemID(ctx, promotion.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	err = postgresql.db.QueryRowContext(ctx, createPromotionQuery, merchID, nullString(promotion.Category),
+		nullInt32(promotion.DiscountPercent), nullInt32(promotion.DiscountAmount), promotion.StartsAt, promotion.EndsAt).
+		Scan(&promotion.ID, &promotion.CreatedAt)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CreatePromotion", err, zap.String("query", "createPromotionQuery"))
+		return nil, err
+	}
+	promotion.CreatedAt = promotion.CreatedAt.UTC()
+
+	return &promotion, nil
+}
+
+// GetPromotions returns every promotion, the latest to start first.
+func (postgresql *PostgreSQL) GetPromotions(ctx context.Context) ([]models.Promotion, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getPromotionsQuery)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetPromotions", err, zap.String("query", "getPromotionsQuery"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			postgresql.logQueryError(ctx, "GetPromotions", err, zap.String("query", "getPromotionsQuery"),
+				zap.String("stage", "scan"))
+			return nil, err
+		}
+		promotions = append(promotions, *promotion)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetPromotions", err, zap.String("query", "getPromotionsQuery"),
+			zap.String("stage", "rows"))
+		return nil, err
+	}
+
+	return promotions, nil
+}
+
+// GetPromotion returns the promotion with the given ID, or ErrPromotionNotFound.
+func (postgresql *PostgreSQL) GetPromotion(ctx context.Context, promotionID int64) (*models.Promotion, error) {
+	promotion, err := scanPromotion(postgresql.db.QueryRowContext(ctx, getPromotionQuery, promotionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetPromotion", err, zap.String("query", "getPromotionQuery"),
+			zap.Int64("promotionID", promotionID))
+		return nil, err
+	}
+
+	return promotion, nil
+}
+
+// UpdatePromotion replaces the target, the discount, and the window of the promotion with promotion.ID.
+// Purchases already discounted by it keep the price they were made at. It returns ErrPromotionNotFound for
+// an unknown promotion and ErrItemNotFound when the promotion targets an item that does not exist.
+func (postgresql *PostgreSQL) UpdatePromotion(ctx context.Context, promotion models.Promotion) (*models.Promotion, error) {
+	merchID, err := postgresql.promotionItemID(ctx, promotion.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	err = postgresql.db.QueryRowContext(ctx, updatePromotionQuery, promotion.ID, merchID, nullString(promotion.Category),
+		nullInt32(promotion.DiscountPercent), nullInt32(promotion.DiscountAmount), promotion.StartsAt, promotion.EndsAt).
+		Scan(&promotion.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "UpdatePromotion", err, zap.String("query", "updatePromotionQuery"))
+		return nil, err
+	}
+	promotion.CreatedAt = promotion.CreatedAt.UTC()
+
+	return &promotion, nil
+}
+
+// DeletePromotion deletes the promotion with the given ID. A promotion that has discounted purchases is referenced
+// by them and cannot be deleted: it returns ErrPromotionInUse, and the promotion can be ended by moving its end
+// instead. It returns ErrPromotionNotFound for an unknown promotion.
+func (postgresql *PostgreSQL) DeletePromotion(ctx context.Context, promotionID int64) error {
+	result, err := postgresql.db.ExecContext(ctx, deletePromotionQuery, promotionID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "DeletePromotion", err, zap.String("query", "deletePromotionQuery"),
+			zap.Int64("promotionID", promotionID))
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "DeletePromotion", err, zap.String("query", "deletePromotionQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int64("promotionID", promotionID))
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	if _, err = postgresql.GetPromotion(ctx, promotionID); err != nil {
+		return err
+	}
+
+	return ErrPromotionInUse
+}
+
+// promotionItemID returns the ID of the item a promotion targets by name, invalid for a promotion targeting
+// a category, or ErrItemNotFound when there is no such item.
+func (postgresql *PostgreSQL) promotionItemID(ctx context.Context, itemName string) (sql.NullInt32, error) {
+	if itemName == "" {
+		return sql.NullInt32{}, nil
+	}
+
+	var merchID sql.NullInt32
+	err := postgresql.db.QueryRowContext(ctx, getItemIDQuery, itemName).Scan(&merchID.Int32)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.NullInt32{}, ErrItemNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "promotionItemID", err, zap.String("query", "getItemIDQuery"),
+			logger.ItemName(itemName))
+		return sql.NullInt32{}, err
+	}
+	merchID.Valid = true
+
+	return merchID, nil
+}
+
+// scanPromotion scans a row of getPromotionsQuery or getPromotionQuery.
+func scanPromotion(row Row) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	var item, category sql.NullString
+	var percent, amount sql.NullInt32
+	err := row.Scan(&promotion.ID, &item, &category, &percent, &amount, &promotion.StartsAt, &promotion.EndsAt, &promotion.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	promotion.Item, promotion.Category = item.String, category.String
+	promotion.DiscountPercent, promotion.DiscountAmount = int(percent.Int32), int(amount.Int32)
+	promotion.StartsAt, promotion.EndsAt, promotion.CreatedAt = promotion.StartsAt.UTC(), promotion.EndsAt.UTC(), promotion.CreatedAt.UTC()
+
+	return promotion, nil
+}
+
+// nullString stores an empty string as NULL.
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// nullInt32 stores zero as NULL.
+func nullInt32(value int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(value), Valid: value != 0}
+}
+
+// nullPromotionID converts the ID of the promotion discounting a purchase, if any, for recording it.
+func nullPromotionID(promotionID *int64) sql.NullInt64 {
+	if promotionID == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *promotionID, Valid: true}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	getReceiptQuery    = `SELECT mp.receipt_number, m.merch_name, mp.quantity, u.username, mp.created_at, mp.redeemed_at FROM content.merch_purchases mp JOIN content.merch m ON mp.merch_id = m.id JOIN content.users u ON mp.user_id = u.id WHERE mp.receipt_number = $1 AND mp.user_id = $2;`
+	redeemReceiptQuery = `UPDATE content.merch_purchases mp SET redeemed_by = $2, redeemed_at = $3 FROM content.merch m, content.users u WHERE mp.receipt_number = $1 AND mp.redeemed_at IS NULL AND mp.merch_id = m.id AND mp.user_id = u.id RETURNING mp.receipt_number, m.merch_name, mp.quantity, u.username, mp.created_at, mp.redeemed_at;`
+	receiptExistsQuery = `SELECT EXISTS (SELECT 1 FROM content.merch_purchases WHERE receipt_number = $1);`
+)
+
+var (
+	// ErrReceiptNotFound indicates that no purchase of the user has the receipt number.
+	ErrReceiptNotFound = errors.New("storage: receipt not found")
+	// ErrReceiptAlreadyRedeemed indicates that the item of the receipt has already been handed out.
+	ErrReceiptAlreadyRedeemed = errors.New("storage: receipt already redeemed")
+)
+
+// GetReceipt returns the receipt of the purchase with the receipt number. It returns ErrReceiptNotFound
+// when the number is unknown or belongs to a purchase of another user.
+func (postgresql *PostgreSQL) GetReceipt(ctx context.Context, userID int32, number string) (*models.Receipt, error) {
+	receipt := &models.Receipt{}
+	var redeemedAt sql.NullTime
+	err := postgresql.db.QueryRowContext(ctx, getReceiptQuery, number, userID).
+		Scan(&receipt.Number, &receipt.Item, &receipt.Quantity, &receipt.Owner, &receipt.PurchasedAt, &redeemedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReceiptNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetReceipt", err, zap.String("query", "getReceiptQuery"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	if redeemedAt.Valid {
+		receipt.RedeemedAt = &redeemedAt.Time
+	}
+	return receipt, nil
+}
+
+// RedeemReceipt marks the purchase with the receipt number as handed out by an administrator at now and returns
+// its receipt. The purchase is only updated while unredeemed, so of concurrent redemptions of the same receipt
+// exactly one succeeds and the others fail with ErrReceiptAlreadyRedeemed. An unknown number fails with ErrReceiptNotFound.
+func (postgresql *PostgreSQL) RedeemReceipt(ctx context.Context, adminID int32, number string, now time.Time) (*models.Receipt, error) {
+	receipt := &models.Receipt{}
+	var redeemedAt sql.NullTime
+	err := postgresql.db.QueryRowContext(ctx, redeemReceiptQuery, number, adminID, now.UTC()).
+		Scan(&receipt.Number, &receipt.Item, &receipt.Quantity, &receipt.Owner, &receipt.PurchasedAt, &redeemedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err = postgresql.db.QueryRowContext(ctx, receiptExistsQuery, number).Scan(&exists); err != nil {
+			postgresql.logQueryError(ctx, "RedeemReceipt", err, zap.String("query", "receiptExistsQuery"),
+				zap.Int32("adminID", adminID))
+			return nil, err
+		}
+		if exists {
+			return nil, ErrReceiptAlreadyRedeemed
+		}
+		return nil, ErrReceiptNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "RedeemReceipt", err, zap.String("query", "redeemReceiptQuery"),
+			zap.Int32("adminID", adminID))
+		return nil, err
+	}
+
+	receipt.RedeemedAt = &redeemedAt.Time
+	return receipt, nil
+}
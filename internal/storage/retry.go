@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"merch_store/internal/storage/pgerr"
+)
+
+// Retry settings for transactions aborted by PostgreSQL because of concurrent updates.
+const (
+	maxTxAttempts  = 10
+	txRetryBackoff = 10 * time.Millisecond
+)
+
+// isRetryableTxError reports whether the transaction failed with a serialization failure or a deadlock
+// and can be safely retried from the beginning.
+func isRetryableTxError(err error) bool {
+	return pgerr.IsRetryable(err)
+}
+
+// withRetry runs fn, which must execute a whole transaction, and reruns it when it fails with a retryable error.
+// Attempts are separated by a linearly growing, jittered backoff and stop early when ctx is done.
+func (postgresql *PostgreSQL) withRetry(ctx context.Context, operation string, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = fn()
+		if err == nil || !isRetryableTxError(err) {
+			return err
+		}
+
+		postgresql.log.Sugar().Infof("Retrying %s after attempt %d: %s", operation, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt)*txRetryBackoff + time.Duration(rand.Int63n(int64(txRetryBackoff)))):
+		}
+	}
+
+	return err
+}
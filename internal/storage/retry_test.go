@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/logger"
+)
+
+func TestWithRetry(t *testing.T) {
+	postgresql := &PostgreSQL{log: &logger.Logger{Logger: zap.NewNop()}}
+	serializationFailure := &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+
+	testCases := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{name: "Success on first attempt", errs: []error{nil}, expectedAttempts: 1},
+		{name: "Serialization failure resolved by retry", errs: []error{serializationFailure, fmt.Errorf("commit: %w", serializationFailure), nil}, expectedAttempts: 3},
+		{name: "Deadlock resolved by retry", errs: []error{&pgconn.PgError{Code: pgerrcode.DeadlockDetected}, nil}, expectedAttempts: 2},
+		{name: "Non-retryable error", errs: []error{&pgconn.PgError{Code: pgerrcode.CheckViolation}}, expectedAttempts: 1, expectedErr: &pgconn.PgError{Code: pgerrcode.CheckViolation}},
+		{name: "Attempts exhausted", errs: repeatError(serializationFailure, maxTxAttempts), expectedAttempts: maxTxAttempts, expectedErr: serializationFailure},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			err := postgresql.withRetry(context.Background(), "test", func() error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+
+			assert.Equal(t, tc.expectedAttempts, attempts)
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var pgError *pgconn.PgError
+			assert.True(t, errors.As(err, &pgError))
+			assert.Equal(t, tc.expectedErr.(*pgconn.PgError).Code, pgError.Code)
+		})
+	}
+}
+
+func repeatError(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+const isSuperuserQuery = `SELECT rolsuper FROM pg_roles WHERE rolname = current_user;`
+
+// IsSuperuser reports whether the database role the storage connects as is a superuser, which bypasses every
+// permission check and should never be used by the application in production.
+func (postgresql *PostgreSQL) IsSuperuser(ctx context.Context) (bool, error) {
+	var superuser bool
+	if err := postgresql.db.QueryRowContext(ctx, isSuperuserQuery).Scan(&superuser); err != nil {
+		postgresql.logQueryError(ctx, "IsSuperuser", err, zap.String("query", "isSuperuserQuery"))
+		return false, err
+	}
+	return superuser, nil
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+// Statuses of a scheduled transfer.
+const (
+	ScheduledTransferPending   = "pending"
+	ScheduledTransferCompleted = "completed"
+	ScheduledTransferFailed    = "failed"
+	ScheduledTransferCanceled  = "canceled"
+)
+
+// scheduledTransferHoldReason is the reason recorded on the holds reserving the coins of scheduled transfers.
+const scheduledTransferHoldReason = "scheduled transfer"
+
+// Reasons recorded on scheduled transfers that could not be made.
+const (
+	scheduledTransferRecipientGone = "recipient no longer exists"
+	scheduledTransferRecipientFull = "recipient cannot hold that many coins"
+)
+
+const (
+	createScheduledTransferQuery  = `INSERT INTO content.scheduled_transfers (from_user_id, to_user_id, to_username, amount, execute_at, hold_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at;`
+	getScheduledTransfersQuery    = `SELECT id, to_username, amount, execute_at, status, COALESCE(transfer_id, 0), failure_reason, created_at FROM content.scheduled_transfers WHERE from_user_id = $1 ORDER BY execute_at, id;`
+	lockPendingScheduledQuery     = `SELECT hold_id FROM content.scheduled_transfers WHERE id = $1 AND from_user_id = $2 AND status = 'pending' FOR UPDATE;`
+	getDueScheduledTransfersQuery = `SELECT id FROM content.scheduled_transfers WHERE status = 'pending' AND execute_at <= $1 ORDER BY execute_at, id LIMIT $2;`
+	lockDueScheduledTransferQuery = `SELECT from_user_id, to_user_id, to_username, amount, execute_at, hold_id, created_at FROM content.scheduled_transfers WHERE id = $1 AND status = 'pending' AND execute_at <= $2 FOR UPDATE SKIP LOCKED;`
+	resolveScheduledTransferQuery = `UPDATE content.scheduled_transfers SET status = $2, transfer_id = NULLIF($3::bigint, 0), failure_reason = $4, resolved_at = $5 WHERE id = $1;`
+)
+
+// ErrScheduledTransferNotPending indicates that the scheduled transfer does not exist, belongs to another user,
+// or has already been made, failed, or been canceled.
+var ErrScheduledTransferNotPending = errors.New("storage: scheduled transfer not found or not pending")
+
+// CreateScheduledTransfer schedules a transfer of req.Amount coins from the user to req.ToUser at executeAt.
+// The coins are reserved with a hold in the same transaction, so they cannot be spent before the transfer is made.
+// It returns ErrRecipientNotFound for an unknown recipient and ErrInsufficientFunds when the available balance is too low.
+func (postgresql *PostgreSQL) CreateScheduledTransfer(ctx context.Context, userID int32, req models.SendCoinRequest, executeAt time.Time) (*models.ScheduledTransfer, error) {
+	scheduled := &models.ScheduledTransfer{
+		FromUserID: userID,
+		ToUser:     req.ToUser,
+		Amount:     int(req.Amount),
+		ExecuteAt:  executeAt,
+		Status:     ScheduledTransferPending,
+	}
+
+	err := postgresql.inTransaction(ctx, "CreateScheduledTransfer", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		toUser, err := postgresql.GetUserID(ctx, nil, req.ToUser)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecipientNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = postgresql.ensureAvailableCoins(ctx, nil, userID, int(req.Amount)); err != nil {
+			return err
+		}
+
+		var holdID int64
+		var holdCreatedAt time.Time
+		err = q.QueryRowContext(ctx, createHoldQuery, userID, int(req.Amount), scheduledTransferHoldReason).Scan(&holdID, &holdCreatedAt)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateScheduledTransfer", err, zap.String("query", "createHoldQuery"),
+				zap.Int32("userID", userID), zap.String("toUser", req.ToUser), zap.Int("amount", int(req.Amount)))
+			return err
+		}
+
+		err = q.QueryRowContext(ctx, createScheduledTransferQuery, userID, toUser.ID, req.ToUser, int(req.Amount), executeAt, holdID).
+			Scan(&scheduled.ID, &scheduled.CreatedAt)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateScheduledTransfer", err,
+				zap.String("query", "createScheduledTransferQuery"), zap.Int32("userID", userID),
+				zap.String("toUser", req.ToUser), zap.Int("amount", int(req.Amount)))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+// GetScheduledTransfers returns the transfers scheduled by the user in every status, in order of execution time.
+func (postgresql *PostgreSQL) GetScheduledTransfers(ctx context.Context, userID int32) ([]models.ScheduledTransfer, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getScheduledTransfersQuery, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetScheduledTransfers", err, zap.String("query", "getScheduledTransfersQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	scheduledTransfers := []models.ScheduledTransfer{}
+	for rows.Next() {
+		scheduled := models.ScheduledTransfer{FromUserID: userID}
+		err := rows.Scan(&scheduled.ID, &scheduled.ToUser, &scheduled.Amount, &scheduled.ExecuteAt, &scheduled.Status,
+			&scheduled.TransferID, &scheduled.FailureReason, &scheduled.CreatedAt)
+		if err != nil {
+			postgresql.logQueryError(ctx, "GetScheduledTransfers", err,
+				zap.String("query", "getScheduledTransfersQuery"), zap.String("stage", "scan"),
+				zap.Int32("userID", userID))
+			return nil, err
+		}
+		scheduledTransfers = append(scheduledTransfers, scheduled)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetScheduledTransfers", err, zap.String("query", "getScheduledTransfersQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return scheduledTransfers, nil
+}
+
+// CancelScheduledTransfer cancels the user's pending scheduled transfer and releases the hold on its coins.
+// It returns ErrScheduledTransferNotPending when there is no such pending transfer.
+func (postgresql *PostgreSQL) CancelScheduledTransfer(ctx context.Context, userID int32, scheduledID int64, now time.Time) error {
+	return postgresql.inTransaction(ctx, "CancelScheduledTransfer", func(ctx context.Context) error {
+		var holdID int64
+		err := postgresql.querier(ctx, nil).QueryRowContext(ctx, lockPendingScheduledQuery, scheduledID, userID).Scan(&holdID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrScheduledTransferNotPending
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "CancelScheduledTransfer", err,
+				zap.String("query", "lockPendingScheduledQuery"), zap.Int32("userID", userID),
+				zap.Int64("scheduledID", scheduledID))
+			return err
+		}
+
+		return postgresql.resolveScheduledTransfer(ctx, scheduledID, holdID, ScheduledTransferCanceled, "", now)
+	})
+}
+
+// GetDueScheduledTransfers returns the IDs of up to limit pending scheduled transfers due at now, oldest first.
+func (postgresql *PostgreSQL) GetDueScheduledTransfers(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getDueScheduledTransfersQuery, now, limit)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetDueScheduledTransfers", err,
+			zap.String("query", "getDueScheduledTransfersQuery"), zap.Int("limit", limit))
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			postgresql.logQueryError(ctx, "GetDueScheduledTransfers", err,
+				zap.String("query", "getDueScheduledTransfersQuery"), zap.String("stage", "scan"),
+				zap.Int("limit", limit))
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetDueScheduledTransfers", err,
+			zap.String("query", "getDueScheduledTransfersQuery"), zap.String("stage", "rows"), zap.Int("limit", limit))
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// ExecuteScheduledTransfer makes the pending scheduled transfer due at now and returns it with its final status.
+// The coins held at scheduling are transferred and the transfer is recorded, or, when the recipient has been
+// deleted or cannot hold the coins, the hold is released and the transfer is marked as failed with a reason.
+// While a gifting campaign is active the recipient also gets its bonus, as with TransferCoins. Once the transfer is
+// made, the recipient is notified of the coins and the sender of the execution.
+// The row is locked for the whole transaction and skipped when locked by another worker, so each transfer
+// is made at most once however many workers run and however often they restart; it returns
+// ErrScheduledTransferNotPending for a transfer that is not pending, not due, or being executed elsewhere.
+func (postgresql *PostgreSQL) ExecuteScheduledTransfer(ctx context.Context, scheduledID int64, now time.Time) (*models.ScheduledTransfer, error) {
+	var scheduled *models.ScheduledTransfer
+
+	err := postgresql.inTransaction(ctx, "ExecuteScheduledTransfer", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		scheduled = &models.ScheduledTransfer{ID: scheduledID}
+		var toUserID sql.NullInt32
+		var holdID int64
+		err := q.QueryRowContext(ctx, lockDueScheduledTransferQuery, scheduledID, now).Scan(&scheduled.FromUserID, &toUserID,
+			&scheduled.ToUser, &scheduled.Amount, &scheduled.ExecuteAt, &holdID, &scheduled.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrScheduledTransferNotPending
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "ExecuteScheduledTransfer", err,
+				zap.String("query", "lockDueScheduledTransferQuery"), zap.Int64("scheduledID", scheduledID))
+			return err
+		}
+
+		fail := func(reason string) error {
+			scheduled.Status = ScheduledTransferFailed
+			scheduled.FailureReason = reason
+			return postgresql.resolveScheduledTransfer(ctx, scheduledID, holdID, ScheduledTransferFailed, reason, now)
+		}
+
+		if !toUserID.Valid {
+			return fail(scheduledTransferRecipientGone)
+		}
+		err = postgresql.ensureBalanceCap(ctx, nil, toUserID.Int32, int64(scheduled.Amount))
+		if errors.Is(err, ErrUserNotFound) {
+			return fail(scheduledTransferRecipientGone)
+		}
+		if errors.Is(err, ErrBalanceCapExceeded) {
+			return fail(scheduledTransferRecipientFull)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = postgresql.UpdateUserCoins(ctx, nil, scheduled.FromUserID, -int64(scheduled.Amount)); err != nil {
+			return err
+		}
+		if _, err = q.ExecContext(ctx, captureHoldQuery, holdID); err != nil {
+			postgresql.logQueryError(ctx, "ExecuteScheduledTransfer", err, zap.String("query", "captureHoldQuery"),
+				zap.Int64("scheduledID", scheduledID))
+			return err
+		}
+		if err = postgresql.UpdateUserCoins(ctx, nil, toUserID.Int32, int64(scheduled.Amount)); err != nil {
+			return err
+		}
+
+		bonus, campaignID, err := postgresql.payCampaignBonus(ctx, toUserID.Int32, int64(scheduled.Amount))
+		if err != nil {
+			return err
+		}
+
+		err = q.QueryRowContext(ctx, transferCoinsQuery, scheduled.FromUserID, toUserID.Int32, scheduled.Amount, bonus, campaignID).Scan(&scheduled.TransferID)
+		if err != nil {
+			postgresql.logQueryError(ctx, "ExecuteScheduledTransfer", err, zap.String("query", "transferCoinsQuery"),
+				zap.Int64("scheduledID", scheduledID))
+			return err
+		}
+
+		scheduled.Status = ScheduledTransferCompleted
+		_, err = q.ExecContext(ctx, resolveScheduledTransferQuery, scheduledID, ScheduledTransferCompleted, scheduled.TransferID, "", now)
+		if err != nil {
+			postgresql.logQueryError(ctx, "ExecuteScheduledTransfer", err,
+				zap.String("query", "resolveScheduledTransferQuery"), zap.Int64("scheduledID", scheduledID))
+			return err
+		}
+
+		err = postgresql.notify(ctx, nil, notification{UserID: toUserID.Int32, Category: NotificationCoinsReceived,
+			ActorID: scheduled.FromUserID, Amount: scheduled.Amount})
+		if err != nil {
+			return err
+		}
+		return postgresql.notify(ctx, nil, notification{UserID: scheduled.FromUserID, Category: NotificationScheduledTransfer,
+			ActorID: toUserID.Int32, Amount: scheduled.Amount})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+// resolveScheduledTransfer releases the hold of a scheduled transfer that will not be made and records its final status.
+// It must run within the transaction holding the lock on the scheduled transfer.
+func (postgresql *PostgreSQL) resolveScheduledTransfer(ctx context.Context, scheduledID, holdID int64, status, reason string, now time.Time) error {
+	q := postgresql.querier(ctx, nil)
+
+	if _, err := q.ExecContext(ctx, releaseHoldQuery, holdID); err != nil {
+		postgresql.logQueryError(ctx, "resolveScheduledTransfer", err, zap.String("query", "releaseHoldQuery"),
+			zap.Int64("holdID", holdID))
+		return err
+	}
+
+	if _, err := q.ExecContext(ctx, resolveScheduledTransferQuery, scheduledID, status, 0, reason, now); err != nil {
+		postgresql.logQueryError(ctx, "resolveScheduledTransfer", err,
+			zap.String("query", "resolveScheduledTransferQuery"), zap.Int64("holdID", holdID))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	lockUserQuery            = `SELECT id FROM content.users WHERE id = $1 FOR UPDATE;`
+	createSessionQuery       = `INSERT INTO content.sessions (jti, user_id, user_agent, issued_at, expires_at) VALUES ($1, $2, $3, $4, $5);`
+	revokeExcessSessionQuery = `UPDATE content.sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 AND id NOT IN (SELECT id FROM content.sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY issued_at DESC, id DESC LIMIT $3);`
+	isSessionActiveQuery     = `SELECT EXISTS (SELECT 1 FROM content.sessions WHERE jti = $1 AND user_id = $2 AND revoked_at IS NULL);`
+	getActiveSessionsQuery   = `SELECT jti, user_agent, issued_at, expires_at FROM content.sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY issued_at DESC, id DESC;`
+	revokeSessionQuery       = `UPDATE content.sessions SET revoked_at = NOW() WHERE jti = $1 AND user_id = $2 AND revoked_at IS NULL;`
+	countActiveSessionsQuery = `SELECT COUNT(*) FROM content.sessions WHERE revoked_at IS NULL AND expires_at > $1;`
+)
+
+// ErrSessionNotFound indicates that the session does not exist, belongs to another user, or has already been revoked.
+var ErrSessionNotFound = errors.New("storage: session not found")
+
+// CreateSession registers a newly issued token and revokes the oldest active sessions of the user
+// so that at most limit sessions stay active. The user's row is locked first, so that concurrent
+// sign-ins of the same user cannot leave more than limit sessions active. The user agent is encrypted when a
+// cipher is set (see SetCipher).
+func (postgresql *PostgreSQL) CreateSession(ctx context.Context, session models.Session, limit int) error {
+	userAgent, err := postgresql.cipher.Encrypt(session.UserAgent)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CreateSession", err, zap.String("query", "createSessionQuery"),
+			zap.String("stage", "encrypt"))
+		return err
+	}
+
+	return postgresql.inTransaction(ctx, "CreateSession", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		var userID int32
+		err := q.QueryRowContext(ctx, lockUserQuery, session.UserID).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateSession", err, zap.String("query", "lockUserQuery"), zap.Int("limit", limit))
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, createSessionQuery, session.ID, session.UserID, userAgent, session.IssuedAt, session.ExpiresAt)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateSession", err, zap.String("query", "createSessionQuery"),
+				zap.Int("limit", limit))
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, revokeExcessSessionQuery, session.UserID, session.IssuedAt, limit)
+		if err != nil {
+			postgresql.logQueryError(ctx, "CreateSession", err, zap.String("query", "revokeExcessSessionQuery"),
+				zap.Int("limit", limit))
+			return err
+		}
+
+		return nil
+	})
+}
+
+// IsSessionActive reports whether the session is registered for the user and has not been revoked.
+// Expiry is not checked: it is enforced by the token itself.
+func (postgresql *PostgreSQL) IsSessionActive(ctx context.Context, userID int32, sessionID string) (bool, error) {
+	var active bool
+	err := postgresql.db.QueryRowContext(ctx, isSessionActiveQuery, sessionID, userID).Scan(&active)
+	if err != nil {
+		postgresql.logQueryError(ctx, "IsSessionActive", err, zap.String("query", "isSessionActiveQuery"),
+			zap.Int32("userID", userID))
+		return false, err
+	}
+
+	return active, nil
+}
+
+// GetActiveSessions returns the user's sessions that are neither revoked nor expired at now, newest first, with their
+// user agents decrypted (see decrypt).
+func (postgresql *PostgreSQL) GetActiveSessions(ctx context.Context, userID int32, now time.Time) ([]models.Session, error) {
+	rows, err := postgresql.db.QueryContext(ctx, getActiveSessionsQuery, userID, now)
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetActiveSessions", err, zap.String("query", "getActiveSessionsQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session := models.Session{UserID: userID}
+		if err = rows.Scan(&session.ID, &session.UserAgent, &session.IssuedAt, &session.ExpiresAt); err != nil {
+			postgresql.logQueryError(ctx, "GetActiveSessions", err, zap.String("query", "getActiveSessionsQuery"),
+				zap.String("stage", "scan"), zap.Int32("userID", userID))
+			return nil, err
+		}
+		session.UserAgent = postgresql.decrypt(ctx, "GetActiveSessions", session.UserAgent, zap.String("sessionID", session.ID), zap.Int32("userID", userID))
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		postgresql.logQueryError(ctx, "GetActiveSessions", err, zap.String("query", "getActiveSessionsQuery"),
+			zap.String("stage", "rows"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// CountActiveSessions returns the number of sessions of all users that are neither revoked nor expired at now.
+func (postgresql *PostgreSQL) CountActiveSessions(ctx context.Context, now time.Time) (int, error) {
+	var count int
+	err := postgresql.db.QueryRowContext(ctx, countActiveSessionsQuery, now).Scan(&count)
+	if err != nil {
+		postgresql.logQueryError(ctx, "CountActiveSessions", err, zap.String("query", "countActiveSessionsQuery"))
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RevokeSession revokes an active session of the user.
+// It returns ErrSessionNotFound when the user has no such active session.
+func (postgresql *PostgreSQL) RevokeSession(ctx context.Context, userID int32, sessionID string) error {
+	result, err := postgresql.db.ExecContext(ctx, revokeSessionQuery, sessionID, userID)
+	if err != nil {
+		postgresql.logQueryError(ctx, "RevokeSession", err, zap.String("query", "revokeSessionQuery"),
+			zap.Int32("userID", userID))
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		postgresql.logQueryError(ctx, "RevokeSession", err, zap.String("query", "revokeSessionQuery"),
+			zap.String("stage", "rowsAffected"), zap.Int32("userID", userID))
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,2204 @@
+// Package storagetest provides the conformance test suite for storage.Storage. The suite exercises an
+// implementation only through the public Storage interface and expects the default merch catalog from the
+// migrations to be present. It runs against the PostgreSQL storage with both drivers from tests/integration,
+// which builds only with the integration tag; a new implementation has to be wired into it there.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/auth"
+	"merch_store/internal/storage"
+)
+
+// usernameCounter keeps generated usernames unique within a single test binary run.
+var usernameCounter atomic.Int64
+
+// uniqueUsername returns a username that does not collide with users created by earlier runs.
+func uniqueUsername(prefix string) string {
+	return fmt.Sprintf("%s_%d_%d", prefix, time.Now().UnixNano(), usernameCounter.Add(1))
+}
+
+// createUser registers a new user with the given balance and returns it.
+func createUser(t *testing.T, db storage.Storage, prefix string, coins int64) *models.User {
+	t.Helper()
+
+	user, err := db.CreateUser(context.Background(), &models.User{Username: uniqueUsername(prefix), Password: "password", Coins: coins})
+	require.NoError(t, err)
+	require.NotZero(t, user.ID)
+	return user
+}
+
+// transferCoins sends amount coins from sender to recipient and returns the ID of the transfer.
+func transferCoins(t *testing.T, db storage.Storage, sender *models.User, recipient *models.User, amount int) int64 {
+	t.Helper()
+
+	transfer, err := db.TransferCoins(context.Background(), sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: models.CoinAmount(amount)})
+	require.NoError(t, err)
+	require.NotZero(t, transfer.TransferID)
+	return transfer.TransferID
+}
+
+// RunConformanceTests runs the shared behavioral specification against the Storage returned by factory.
+// The factory is called once per subtest; the returned storage is closed when the subtest ends.
+func RunConformanceTests(t *testing.T, factory func() storage.Storage) {
+	t.Helper()
+
+	run := func(name string, fn func(t *testing.T, db storage.Storage)) {
+		t.Run(name, func(t *testing.T) {
+			db := factory()
+			defer db.Close()
+			fn(t, db)
+		})
+	}
+
+	run("UserLifecycle", testUserLifecycle)
+	run("DeleteUser", testDeleteUser)
+	run("InviteCodes", testInviteCodes)
+	run("CreateUsersBulk", testCreateUsersBulk)
+	run("GetMerchCatalog", testGetMerchCatalog)
+	run("GetItemByID", testGetItemByID)
+	run("CatalogWithAffordability", testCatalogWithAffordability)
+	run("BuyItem", testBuyItem)
+	run("TransferCoins", testTransferCoins)
+	run("GetInfo", testGetInfo)
+	run("InfoInvariants", testInfoInvariants)
+	run("StreamCoinHistory", testStreamCoinHistory)
+	run("GetTransfers", testGetTransfers)
+	run("GetTransfer", testGetTransfer)
+	run("ReverseTransfer", testReverseTransfer)
+	run("CoinHolds", testCoinHolds)
+	run("ScheduledTransfers", testScheduledTransfers)
+	run("AccrueMonthlyCoins", testAccrueMonthlyCoins)
+	run("WithinTransaction", testWithinTransaction)
+	run("DryRun", testDryRun)
+	run("ConsumeItem", testConsumeItem)
+	run("Receipts", testReceipts)
+	run("InventoryCounts", testInventoryCounts)
+	run("Sessions", testSessions)
+	run("UserExport", testUserExport)
+	run("PersonalTokens", testPersonalTokens)
+	run("Notifications", testNotifications)
+	run("Delegations", testDelegations)
+	run("EconomyStats", testEconomyStats)
+	run("UserActivity", testUserActivity)
+	run("PartialInfo", testPartialInfo)
+	run("IdempotencyKeys", testIdempotencyKeys)
+	run("PreviewTransfer", testPreviewTransfer)
+	run("TermsAcceptance", testTermsAcceptance)
+	run("CheckInvariants", testCheckInvariants)
+	run("Campaigns", testCampaigns)
+	run("InfoHistoryLimit", testInfoHistoryLimit)
+	run("TokenVersion", testTokenVersion)
+	run("Promotions", testPromotions)
+	run("MerchCategories", testMerchCategories)
+}
+
+func testUserLifecycle(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	username := uniqueUsername("lifecycle")
+
+	unknown, err := db.CheckUser(ctx, &models.User{Username: username, Password: "password"})
+	require.NoError(t, err)
+	assert.Zero(t, unknown.ID, "unknown user should have a zero ID")
+
+	created, err := db.CreateUser(ctx, &models.User{Username: username, Password: "password", Coins: 1000})
+	require.NoError(t, err)
+	require.NotZero(t, created.ID)
+
+	active, err := db.IsUserActive(ctx, created.ID)
+	require.NoError(t, err)
+	assert.True(t, active, "a new user should be active")
+
+	active, err = db.IsUserActive(ctx, -1)
+	require.NoError(t, err)
+	assert.False(t, active, "an unknown user should not be active")
+
+	existing, err := db.CheckUser(ctx, &models.User{Username: username, Password: "password"})
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, existing.ID)
+
+	_, err = db.CheckUser(ctx, &models.User{Username: username, Password: "wrong"})
+	assert.ErrorIs(t, err, bcrypt.ErrMismatchedHashAndPassword)
+
+	_, err = db.CreateUser(ctx, &models.User{Username: username, Password: "password", Coins: 1000})
+	assert.Error(t, err, "creating a duplicate username should fail")
+
+	t.Run("Whitespace variants", func(t *testing.T) {
+		spaced := uniqueUsername("spaced user")
+		variant := "  " + strings.Replace(spaced, " ", " \t  ", 1) + "\n"
+
+		created, err := db.CreateUser(ctx, &models.User{Username: variant, Password: "password", Coins: 1000})
+		require.NoError(t, err)
+		assert.Equal(t, spaced, created.Username, "a username must be stored normalized")
+
+		existing, err := db.CheckUser(ctx, &models.User{Username: " " + spaced + " ", Password: "password"})
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, existing.ID, "whitespace variants must sign in to the same user")
+
+		found, err := db.GetUserID(ctx, nil, variant)
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, found.ID)
+
+		_, err = db.CreateUser(ctx, &models.User{Username: spaced + " ", Password: "password", Coins: 1000})
+		assert.Error(t, err, "a whitespace variant of a username is a duplicate")
+	})
+}
+
+func testTokenVersion(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	username := uniqueUsername("token_version")
+	created, err := db.CreateUser(ctx, &models.User{Username: username, Password: "password", Coins: 1000})
+	require.NoError(t, err)
+
+	version, active, err := db.GetTokenVersion(ctx, created.ID)
+	require.NoError(t, err)
+	assert.True(t, active)
+	assert.Zero(t, version, "a new user starts at version 0")
+
+	bumped, err := db.BumpTokenVersion(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), bumped)
+
+	version, _, err = db.GetTokenVersion(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), version)
+
+	existing, err := db.CheckUser(ctx, &models.User{Username: username, Password: "password"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), existing.TokenVersion, "sign-in must issue tokens of the current version")
+
+	_, active, err = db.GetTokenVersion(ctx, -1)
+	require.NoError(t, err)
+	assert.False(t, active, "an unknown user should not be active")
+
+	_, err = db.BumpTokenVersion(ctx, -1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func testDeleteUser(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db, "delete", 1000)
+	_, err := db.BuyItem(ctx, user.ID, "pen")
+	require.NoError(t, err)
+
+	require.NoError(t, db.DeleteUser(ctx, user.ID))
+	active, err := db.IsUserActive(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, active, "a deleted user should not be found")
+	assert.ErrorIs(t, db.DeleteUser(ctx, user.ID), storage.ErrUserNotFound)
+
+	sender := createUser(t, db, "delete_sender", 1000)
+	recipient := createUser(t, db, "delete_recipient", 1000)
+	transferCoins(t, db, sender, recipient, 10)
+	assert.Error(t, db.DeleteUser(ctx, sender.ID), "a user with transfers should not be deleted")
+}
+
+func testInviteCodes(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	admin := createUser(t, db, "inviter", 1000)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	invite := models.InviteCode{Code: uniqueUsername("invite"), ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, db.CreateInviteCode(ctx, invite, admin.ID))
+	expired := models.InviteCode{Code: uniqueUsername("invite"), ExpiresAt: now.Add(-time.Second)}
+	require.NoError(t, db.CreateInviteCode(ctx, expired, admin.ID))
+
+	invited, err := db.CreateUserWithInvite(ctx, &models.User{Username: uniqueUsername("invited"), Password: "password", Coins: 1000}, invite.Code, now)
+	require.NoError(t, err)
+	require.NotZero(t, invited.ID)
+
+	reused := &models.User{Username: uniqueUsername("invited"), Password: "password", Coins: 1000}
+	_, err = db.CreateUserWithInvite(ctx, reused, invite.Code, now)
+	assert.ErrorIs(t, err, storage.ErrInviteCodeInvalid, "a spent code must not be reused")
+	unknown, err := db.CheckUser(ctx, reused)
+	require.NoError(t, err)
+	assert.Zero(t, unknown.ID, "the user must not be created with a spent code")
+
+	_, err = db.CreateUserWithInvite(ctx, &models.User{Username: uniqueUsername("invited"), Password: "password", Coins: 1000}, expired.Code, now)
+	assert.ErrorIs(t, err, storage.ErrInviteCodeInvalid, "an expired code must be rejected")
+
+	_, err = db.CreateUserWithInvite(ctx, &models.User{Username: uniqueUsername("invited"), Password: "password", Coins: 1000}, "missing", now)
+	assert.ErrorIs(t, err, storage.ErrInviteCodeInvalid)
+}
+
+func testCreateUsersBulk(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	existing := createUser(t, db, "bulk_existing", 700)
+
+	users := []models.User{
+		{Username: uniqueUsername("bulk"), Password: "first", Coins: 1000},
+		{Username: existing.Username, Password: "other", Coins: 5},
+		{Username: uniqueUsername("bulk"), Password: "third", Coins: 50},
+	}
+	created, err := db.CreateUsersBulk(ctx, users)
+	require.NoError(t, err)
+	require.Len(t, created, 2, "the existing username in the middle of the batch must be skipped")
+
+	for _, user := range created {
+		require.NotZero(t, user.ID)
+		assert.NotEqual(t, existing.Username, user.Username)
+
+		signedIn, err := db.CheckUser(ctx, &models.User{Username: user.Username, Password: user.Password})
+		require.NoError(t, err, "a provisioned user must sign in with the given password")
+		assert.Equal(t, user.ID, signedIn.ID)
+
+		info, err := db.GetUserInfo(ctx, nil, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.Coins, info.Coins)
+	}
+
+	_, err = db.CheckUser(ctx, &models.User{Username: existing.Username, Password: "other"})
+	assert.ErrorIs(t, err, bcrypt.ErrMismatchedHashAndPassword, "an existing user must be left unchanged")
+	info, err := db.GetUserInfo(ctx, nil, existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(700), info.Coins)
+
+	created, err = db.CreateUsersBulk(ctx, users[:1])
+	require.NoError(t, err)
+	assert.Empty(t, created, "repeating the batch must not create anyone")
+}
+
+func testGetMerchCatalog(t *testing.T, db storage.Storage) {
+	catalog, err := db.GetMerchCatalog(context.Background())
+	require.NoError(t, err)
+
+	assert.Contains(t, catalog, models.CatalogItem{Name: "t-shirt", Category: "apparel", Price: 80})
+	assert.Contains(t, catalog, models.CatalogItem{Name: "pink-hoody", Category: "apparel", Price: 500})
+
+	lastModified, err := db.GetCatalogLastModified(context.Background())
+	require.NoError(t, err)
+	assert.False(t, lastModified.IsZero())
+}
+
+func testGetItemByID(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	byName, err := db.GetItemPrice(ctx, nil, "pink-hoody")
+	require.NoError(t, err)
+
+	byID, err := db.GetItemByID(ctx, byName.ID)
+	require.NoError(t, err)
+	assert.Equal(t, byName, byID, "an item must be the same whether looked up by name or by ID")
+
+	_, err = db.GetItemByID(ctx, -1)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+}
+
+func testCatalogWithAffordability(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	t.Run("BalanceAtPrice", func(t *testing.T) {
+		user := createUser(t, db, "affordability", 80)
+
+		catalog, err := db.GetCatalogWithAffordability(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Contains(t, catalog, models.AffordableCatalogItem{Name: "t-shirt", Price: 80, Affordable: true}, "a balance equal to the price must afford the item")
+		assert.Contains(t, catalog, models.AffordableCatalogItem{Name: "pink-hoody", Price: 500, Shortfall: 420})
+	})
+
+	t.Run("HeldCoins", func(t *testing.T) {
+		user := createUser(t, db, "affordability_hold", 80)
+		_, err := db.CreateHold(ctx, user.ID, 1, "pending transfer")
+		require.NoError(t, err)
+
+		catalog, err := db.GetCatalogWithAffordability(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Contains(t, catalog, models.AffordableCatalogItem{Name: "t-shirt", Price: 80, Shortfall: 1}, "held coins must not count as available")
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		_, err := db.GetCatalogWithAffordability(ctx, -1)
+		assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	})
+}
+
+func testBuyItem(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	t.Run("Success", func(t *testing.T) {
+		user := createUser(t, db, "buyer", 1000)
+
+		purchase, err := db.BuyItem(ctx, user.ID, "t-shirt")
+		require.NoError(t, err)
+		assert.Regexp(t, receiptNumberPattern, purchase.ReceiptNumber)
+		purchase.ReceiptNumber = ""
+		assert.Equal(t, &models.PurchaseResult{Item: "t-shirt", Price: 80, Quantity: 1, RemainingCoins: 920}, purchase)
+
+		purchase, err = db.BuyItem(ctx, user.ID, "t-shirt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(840), purchase.RemainingCoins)
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(840), info.Coins)
+		assert.Equal(t, []models.InventoryItem{{Type: "t-shirt", Category: "apparel", Quantity: 2, PendingQuantity: 2}}, info.Inventory)
+	})
+
+	t.Run("UnknownItem", func(t *testing.T) {
+		user := createUser(t, db, "buyer", 1000)
+
+		_, err := db.BuyItem(ctx, user.ID, "no-such-item")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("InsufficientFunds", func(t *testing.T) {
+		user := createUser(t, db, "buyer", 10)
+
+		_, err := db.BuyItem(ctx, user.ID, "t-shirt")
+		require.ErrorIs(t, err, storage.ErrInsufficientFunds)
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), info.Coins, "failed purchase must not change the balance")
+		assert.Empty(t, info.Inventory)
+	})
+}
+
+func testTransferCoins(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	t.Run("Success", func(t *testing.T) {
+		sender := createUser(t, db, "sender", 1000)
+		recipient := createUser(t, db, "recipient", 1000)
+
+		transfer, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 150})
+		require.NoError(t, err)
+		assert.NotZero(t, transfer.TransferID)
+		assert.Equal(t, int64(850), transfer.RemainingCoins, "the sender's balance after the transfer must be returned")
+
+		senderInfo, err := db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		recipientInfo, err := db.GetInfo(ctx, recipient.ID)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(850), senderInfo.Coins)
+		assert.Equal(t, int64(1150), recipientInfo.Coins)
+	})
+
+	t.Run("SelfTransfer", func(t *testing.T) {
+		sender := createUser(t, db, "sender", 1000)
+
+		_, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: sender.Username, Amount: 100})
+		require.Error(t, err)
+
+		info, err := db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000), info.Coins)
+	})
+
+	t.Run("UnknownRecipient", func(t *testing.T) {
+		sender := createUser(t, db, "sender", 1000)
+
+		_, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: uniqueUsername("ghost"), Amount: 100})
+		require.ErrorIs(t, err, storage.ErrRecipientNotFound)
+
+		info, err := db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000), info.Coins, "failed transfer must not change the balance")
+	})
+
+	t.Run("NegativeAmount", func(t *testing.T) {
+		sender := createUser(t, db, "sender", 1000)
+		recipient := createUser(t, db, "recipient", 1000)
+
+		_, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: -100})
+		require.Error(t, err)
+
+		senderInfo, err := db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000), senderInfo.Coins)
+	})
+
+	t.Run("InsufficientFunds", func(t *testing.T) {
+		sender := createUser(t, db, "sender", 50)
+		recipient := createUser(t, db, "recipient", 1000)
+
+		_, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 100})
+		require.ErrorIs(t, err, storage.ErrInsufficientFunds)
+
+		senderInfo, err := db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(50), senderInfo.Coins)
+		recipientInfo, err := db.GetInfo(ctx, recipient.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000), recipientInfo.Coins)
+	})
+
+	t.Run("BalanceCap", func(t *testing.T) {
+		sender := createUser(t, db, "sender", 1000)
+		recipient := createUser(t, db, "recipient", storage.DefaultMaxCoinBalance-100)
+
+		transferCoins(t, db, sender, recipient, 100)
+
+		recipientInfo, err := db.GetInfo(ctx, recipient.ID)
+		require.NoError(t, err)
+		assert.Equal(t, storage.DefaultMaxCoinBalance, recipientInfo.Coins, "a transfer up to exactly the cap must succeed")
+
+		_, err = db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 1})
+		assert.ErrorIs(t, err, storage.ErrBalanceCapExceeded)
+
+		senderInfo, err := db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(900), senderInfo.Coins, "a rejected transfer must not charge the sender")
+	})
+}
+
+func testGetInfo(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	sender := createUser(t, db, "info", 1000)
+	recipient := createUser(t, db, "info", 1000)
+
+	_, err := db.BuyItem(ctx, sender.ID, "cup")
+	require.NoError(t, err)
+	sentID := transferCoins(t, db, sender, recipient, 30)
+	receivedID := transferCoins(t, db, recipient, sender, 5)
+
+	info, err := db.GetInfo(ctx, sender.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1000-20-30+5), info.Coins)
+	assert.Equal(t, []models.InventoryItem{{Type: "cup", Category: "accessories", Quantity: 1, PendingQuantity: 1}}, info.Inventory)
+	assert.Equal(t, []models.TransactionDetail{{ID: sentID, FromUser: sender.Username, ToUser: recipient.Username, Amount: 30}}, info.CoinHistory.Sent)
+	assert.Equal(t, []models.TransactionDetail{{ID: receivedID, FromUser: recipient.Username, ToUser: sender.Username, Amount: 5}}, info.CoinHistory.Received)
+
+	empty := createUser(t, db, "info", 1000)
+	emptyInfo, err := db.GetInfo(ctx, empty.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), emptyInfo.Coins)
+	assert.Empty(t, emptyInfo.Inventory)
+	assert.Empty(t, emptyInfo.CoinHistory.Sent)
+	assert.Empty(t, emptyInfo.CoinHistory.Received)
+}
+
+// testInfoInvariants checks that the information of each user adds up after a mix of operations, including
+// failed ones: the balance equals the initial coins minus purchases and sent coins plus received coins,
+// and every transfer appears in the sent list of its sender and the received list of its recipient.
+func testInfoInvariants(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	const initialCoins = 500
+
+	users := []*models.User{
+		createUser(t, db, "invariant", initialCoins),
+		createUser(t, db, "invariant", initialCoins),
+		createUser(t, db, "invariant", initialCoins),
+	}
+
+	catalog, err := db.GetMerchCatalog(ctx)
+	require.NoError(t, err)
+	prices := make(map[string]int64, len(catalog))
+	for _, item := range catalog {
+		prices[item.Name] = int64(item.Price)
+	}
+
+	for i := 0; i < 9; i++ {
+		from, to := users[i%len(users)], users[(i+1)%len(users)]
+		_, _ = db.TransferCoins(ctx, from.ID, models.SendCoinRequest{ToUser: to.Username, Amount: models.CoinAmount(40 * (i + 1))})
+		_, _ = db.BuyItem(ctx, to.ID, catalog[i%len(catalog)].Name)
+	}
+	_, _ = db.TransferCoins(ctx, users[0].ID, models.SendCoinRequest{ToUser: users[0].Username, Amount: 1})
+	_, _ = db.TransferCoins(ctx, users[0].ID, models.SendCoinRequest{ToUser: uniqueUsername("ghost"), Amount: 1})
+	_, _ = db.BuyItem(ctx, users[0].ID, "no-such-item")
+
+	sentByID := map[int64]models.TransactionDetail{}
+	receivedByID := map[int64]models.TransactionDetail{}
+	var total, spent int64
+	for _, user := range users {
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, info.Coins, int64(0), "a balance must never go negative")
+		total += info.Coins
+
+		expected := int64(initialCoins)
+		for _, item := range info.Inventory {
+			expected -= prices[item.Type] * int64(item.Quantity)
+			spent += prices[item.Type] * int64(item.Quantity)
+		}
+		for _, sent := range info.CoinHistory.Sent {
+			assert.Equal(t, user.Username, sent.FromUser)
+			expected -= int64(sent.Amount)
+			sentByID[sent.ID] = sent
+		}
+		for _, received := range info.CoinHistory.Received {
+			assert.Equal(t, user.Username, received.ToUser)
+			expected += int64(received.Amount)
+			receivedByID[received.ID] = received
+		}
+		assert.Equal(t, expected, info.Coins, "the balance of %s must match their purchases and transfers", user.Username)
+	}
+
+	assert.Equal(t, sentByID, receivedByID, "every transfer must be listed for both its sender and its recipient")
+	assert.Equal(t, int64(initialCoins*len(users))-spent, total, "transfers must neither create nor destroy coins")
+}
+
+func testStreamCoinHistory(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	first := createUser(t, db, "history", 1000)
+	second := createUser(t, db, "history", 1000)
+
+	sentID := transferCoins(t, db, first, second, 30)
+	receivedID := transferCoins(t, db, second, first, 5)
+
+	var history []models.TransactionDetail
+	err := db.StreamCoinHistory(ctx, first.ID, func(transactionDetail models.TransactionDetail) error {
+		history = append(history, transactionDetail)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.TransactionDetail{
+		{ID: receivedID, FromUser: second.Username, ToUser: first.Username, Amount: 5},
+		{ID: sentID, FromUser: first.Username, ToUser: second.Username, Amount: 30},
+	}, history)
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = db.StreamCoinHistory(ctx, first.ID, func(models.TransactionDetail) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop, "the callback error must stop the iteration")
+	assert.Equal(t, 1, calls)
+}
+
+func testGetTransfers(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	sender := createUser(t, db, "pager", 10000)
+	recipient := createUser(t, db, "pager", 10000)
+
+	const existing = 25
+	for amount := 1; amount <= existing; amount++ {
+		transferCoins(t, db, sender, recipient, amount)
+	}
+
+	// New transfers arrive while the history is being paged through; they must not shift the remaining pages.
+	var collected []models.Transfer
+	filter := models.TransfersFilter{Direction: storage.TransferDirectionSent, Limit: 10}
+	for {
+		page, err := db.GetTransfers(ctx, sender.ID, filter)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		collected = append(collected, page...)
+
+		last := page[len(page)-1]
+		filter.After = &models.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		transferCoins(t, db, sender, recipient, 1000)
+	}
+
+	require.Len(t, collected, existing)
+	for i, transfer := range collected {
+		assert.Equal(t, existing-i, transfer.Amount, "transfers must be returned newest first without gaps or duplicates")
+		assert.Equal(t, sender.Username, transfer.FromUser)
+		assert.Equal(t, recipient.Username, transfer.ToUser)
+	}
+
+	received, err := db.GetTransfers(ctx, recipient.ID, models.TransfersFilter{Direction: storage.TransferDirectionReceived, Limit: 5})
+	require.NoError(t, err)
+	assert.Len(t, received, 5)
+
+	sent, err := db.GetTransfers(ctx, recipient.ID, models.TransfersFilter{Direction: storage.TransferDirectionSent, Limit: 5})
+	require.NoError(t, err)
+	assert.Empty(t, sent)
+
+	_, err = db.GetTransfers(ctx, sender.ID, models.TransfersFilter{Direction: "sideways", Limit: 5})
+	assert.ErrorIs(t, err, storage.ErrUnknownTransferDirection)
+}
+
+func testGetTransfer(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	sender := createUser(t, db, "transfer_owner", 1000)
+	recipient := createUser(t, db, "transfer_owner", 1000)
+	outsider := createUser(t, db, "transfer_outsider", 1000)
+
+	firstID := transferCoins(t, db, sender, recipient, 10)
+	secondID := transferCoins(t, db, sender, recipient, 20)
+	assert.Greater(t, secondID, firstID, "transfer IDs must grow monotonically")
+
+	for _, user := range []*models.User{sender, recipient} {
+		transfer, err := db.GetTransfer(ctx, user.ID, secondID)
+		require.NoError(t, err)
+		assert.Equal(t, secondID, transfer.ID)
+		assert.Equal(t, sender.Username, transfer.FromUser)
+		assert.Equal(t, recipient.Username, transfer.ToUser)
+		assert.Equal(t, 20, transfer.Amount)
+		assert.False(t, transfer.CreatedAt.IsZero())
+	}
+
+	_, err := db.GetTransfer(ctx, outsider.ID, secondID)
+	assert.ErrorIs(t, err, storage.ErrTransferNotFound, "users outside the transfer must not see it")
+
+	_, err = db.GetTransfer(ctx, sender.ID, secondID+1_000_000)
+	assert.ErrorIs(t, err, storage.ErrTransferNotFound)
+}
+
+func testReverseTransfer(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	now := time.Now()
+
+	admin := createUser(t, db, "reversal_admin", 0)
+	sender := createUser(t, db, "reversal_sender", 1000)
+	recipient := createUser(t, db, "reversal_recipient", 0)
+	other := createUser(t, db, "reversal_other", 0)
+
+	balance := func(user *models.User) int64 {
+		t.Helper()
+		info, err := db.GetUserInfo(ctx, nil, user.ID)
+		require.NoError(t, err)
+		return info.Coins
+	}
+
+	t.Run("Full", func(t *testing.T) {
+		transferID := transferCoins(t, db, sender, recipient, 100)
+
+		reversal, err := db.ReverseTransfer(ctx, admin.ID, transferID, false, now)
+		require.NoError(t, err)
+		assert.Equal(t, transferID, reversal.TransferID)
+		assert.Equal(t, 100, reversal.ReversedAmount)
+		assert.False(t, reversal.Partial)
+		assert.Equal(t, sender.Username, reversal.FromUser)
+		assert.Equal(t, recipient.Username, reversal.ToUser)
+		assert.Equal(t, int64(1000), balance(sender))
+		assert.Equal(t, int64(0), balance(recipient))
+
+		compensation, err := db.GetTransfer(ctx, sender.ID, reversal.ReversalTransferID)
+		require.NoError(t, err)
+		assert.Equal(t, recipient.Username, compensation.FromUser, "the compensating transfer must go the opposite way")
+		assert.Equal(t, 100, compensation.Amount)
+
+		_, err = db.ReverseTransfer(ctx, admin.ID, transferID, false, now)
+		assert.ErrorIs(t, err, storage.ErrTransferAlreadyReversed)
+		assert.Equal(t, int64(1000), balance(sender), "a second reversal must change nothing")
+	})
+
+	t.Run("Insufficient recipient balance", func(t *testing.T) {
+		transferID := transferCoins(t, db, sender, recipient, 500)
+		transferCoins(t, db, recipient, other, 200)
+
+		_, err := db.ReverseTransfer(ctx, admin.ID, transferID, false, now)
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+		assert.Equal(t, int64(300), balance(recipient), "a failed reversal must change nothing")
+
+		reversal, err := db.ReverseTransfer(ctx, admin.ID, transferID, true, now)
+		require.NoError(t, err)
+		assert.Equal(t, 500, reversal.Amount)
+		assert.Equal(t, 300, reversal.ReversedAmount)
+		assert.True(t, reversal.Partial)
+		assert.Equal(t, int64(800), balance(sender))
+		assert.Equal(t, int64(0), balance(recipient))
+
+		_, err = db.ReverseTransfer(ctx, admin.ID, transferID, true, now)
+		assert.ErrorIs(t, err, storage.ErrTransferAlreadyReversed)
+	})
+
+	t.Run("Unknown transfer", func(t *testing.T) {
+		_, err := db.ReverseTransfer(ctx, admin.ID, 1<<62, false, now)
+		assert.ErrorIs(t, err, storage.ErrTransferNotFound)
+	})
+}
+
+func testCoinHolds(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	t.Run("HoldReducesAvailableBalance", func(t *testing.T) {
+		user := createUser(t, db, "holder", 100)
+		recipient := createUser(t, db, "recipient", 1000)
+
+		hold, err := db.CreateHold(ctx, user.ID, 90, "pending transfer")
+		require.NoError(t, err)
+		assert.NotZero(t, hold.ID)
+		assert.Equal(t, storage.HoldStatusActive, hold.Status)
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), info.Coins)
+		assert.Equal(t, int64(10), info.AvailableCoins)
+
+		_, err = db.BuyItem(ctx, user.ID, "cup")
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+		_, err = db.TransferCoins(ctx, user.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 20})
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+		_, err = db.CreateHold(ctx, user.ID, 20, "second hold")
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+
+		_, err = db.BuyItem(ctx, user.ID, "pen")
+		require.NoError(t, err)
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		user := createUser(t, db, "holder", 100)
+
+		hold, err := db.CreateHold(ctx, user.ID, 100, "withdrawal")
+		require.NoError(t, err)
+		require.NoError(t, db.ReleaseHold(ctx, hold.ID))
+		assert.ErrorIs(t, db.ReleaseHold(ctx, hold.ID), storage.ErrHoldNotActive)
+
+		_, err = db.CaptureHold(ctx, hold.ID)
+		assert.ErrorIs(t, err, storage.ErrHoldNotActive, "a released hold cannot be captured")
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), info.Coins)
+		assert.Equal(t, int64(100), info.AvailableCoins)
+	})
+
+	t.Run("Capture", func(t *testing.T) {
+		user := createUser(t, db, "holder", 100)
+
+		hold, err := db.CreateHold(ctx, user.ID, 60, "withdrawal")
+		require.NoError(t, err)
+
+		captured, err := db.CaptureHold(ctx, hold.ID)
+		require.NoError(t, err)
+		assert.Equal(t, storage.HoldStatusCaptured, captured.Status)
+		assert.Equal(t, user.ID, captured.UserID)
+		assert.Equal(t, 60, captured.Amount)
+
+		_, err = db.CaptureHold(ctx, hold.ID)
+		assert.ErrorIs(t, err, storage.ErrHoldNotActive, "a hold can be captured only once")
+		assert.ErrorIs(t, db.ReleaseHold(ctx, hold.ID), storage.ErrHoldNotActive)
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(40), info.Coins)
+		assert.Equal(t, int64(40), info.AvailableCoins)
+	})
+}
+
+func testScheduledTransfers(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	sender := createUser(t, db, "scheduler", 100)
+	recipient := createUser(t, db, "scheduled_recipient", 0)
+	executeAt := time.Now().UTC().Truncate(time.Second).Add(time.Hour)
+	due := executeAt.Add(time.Minute)
+
+	scheduled, err := db.CreateScheduledTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 60}, executeAt)
+	require.NoError(t, err)
+	require.NotZero(t, scheduled.ID)
+	assert.Equal(t, storage.ScheduledTransferPending, scheduled.Status)
+
+	held, err := db.GetActiveHoldsAmount(ctx, nil, sender.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 60, held, "the scheduled coins must be held")
+
+	_, err = db.CreateScheduledTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 50}, executeAt)
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds, "held coins must not be scheduled twice")
+	_, err = db.CreateScheduledTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: uniqueUsername("missing"), Amount: 1}, executeAt)
+	assert.ErrorIs(t, err, storage.ErrRecipientNotFound)
+
+	_, err = db.ExecuteScheduledTransfer(ctx, scheduled.ID, executeAt.Add(-time.Second))
+	assert.ErrorIs(t, err, storage.ErrScheduledTransferNotPending, "a transfer must not be made before it is due")
+
+	dueIDs, err := db.GetDueScheduledTransfers(ctx, due, 1000)
+	require.NoError(t, err)
+	assert.Contains(t, dueIDs, scheduled.ID)
+
+	executed, err := db.ExecuteScheduledTransfer(ctx, scheduled.ID, due)
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduledTransferCompleted, executed.Status)
+	require.NotZero(t, executed.TransferID)
+
+	_, err = db.ExecuteScheduledTransfer(ctx, scheduled.ID, due)
+	assert.ErrorIs(t, err, storage.ErrScheduledTransferNotPending, "a transfer must be made only once")
+
+	senderInfo, err := db.GetUserInfo(ctx, nil, sender.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), senderInfo.Coins)
+	recipientInfo, err := db.GetUserInfo(ctx, nil, recipient.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), recipientInfo.Coins)
+	held, err = db.GetActiveHoldsAmount(ctx, nil, sender.ID)
+	require.NoError(t, err)
+	assert.Zero(t, held, "the hold must be captured")
+
+	canceled, err := db.CreateScheduledTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 10}, executeAt)
+	require.NoError(t, err)
+	assert.ErrorIs(t, db.CancelScheduledTransfer(ctx, recipient.ID, canceled.ID, due), storage.ErrScheduledTransferNotPending,
+		"only the sender may cancel a transfer")
+	require.NoError(t, db.CancelScheduledTransfer(ctx, sender.ID, canceled.ID, due))
+	assert.ErrorIs(t, db.CancelScheduledTransfer(ctx, sender.ID, canceled.ID, due), storage.ErrScheduledTransferNotPending)
+	_, err = db.ExecuteScheduledTransfer(ctx, canceled.ID, due)
+	assert.ErrorIs(t, err, storage.ErrScheduledTransferNotPending, "a canceled transfer must not be made")
+
+	gone := createUser(t, db, "scheduled_gone", 0)
+	failed, err := db.CreateScheduledTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: gone.Username, Amount: 40}, executeAt)
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteUser(ctx, gone.ID))
+	executed, err = db.ExecuteScheduledTransfer(ctx, failed.ID, due)
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduledTransferFailed, executed.Status)
+	assert.NotEmpty(t, executed.FailureReason)
+
+	held, err = db.GetActiveHoldsAmount(ctx, nil, sender.ID)
+	require.NoError(t, err)
+	assert.Zero(t, held, "the coins of a failed transfer must be released")
+	senderInfo, err = db.GetUserInfo(ctx, nil, sender.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), senderInfo.Coins)
+
+	list, err := db.GetScheduledTransfers(ctx, sender.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	statuses := map[int64]string{}
+	for _, item := range list {
+		statuses[item.ID] = item.Status
+	}
+	assert.Equal(t, map[int64]string{
+		scheduled.ID: storage.ScheduledTransferCompleted,
+		canceled.ID:  storage.ScheduledTransferCanceled,
+		failed.ID:    storage.ScheduledTransferFailed,
+	}, statuses)
+
+	t.Run("Offset", func(t *testing.T) {
+		offsetAt := executeAt.In(time.FixedZone("", 3*60*60))
+		offset, err := db.CreateScheduledTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 1}, offsetAt)
+		require.NoError(t, err)
+
+		dueIDs, err := db.GetDueScheduledTransfers(ctx, executeAt.Add(-time.Second), 1000)
+		require.NoError(t, err)
+		assert.NotContains(t, dueIDs, offset.ID, "the offset must not shift the execution time")
+
+		list, err := db.GetScheduledTransfers(ctx, sender.ID)
+		require.NoError(t, err)
+		found := false
+		for _, item := range list {
+			if item.ID != offset.ID {
+				continue
+			}
+			found = true
+			assert.True(t, item.ExecuteAt.Equal(executeAt))
+			assert.Equal(t, time.UTC, item.ExecuteAt.Location(), "timestamps must be scanned in UTC")
+			assert.Equal(t, time.UTC, item.CreatedAt.Location(), "timestamps must be scanned in UTC")
+		}
+		assert.True(t, found)
+		require.NoError(t, db.CancelScheduledTransfer(ctx, sender.ID, offset.ID, due))
+	})
+}
+
+func testAccrueMonthlyCoins(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	user := createUser(t, db, "accrual", 1000)
+	// A far-future period keeps repeated runs against the same database independent.
+	seed := int(time.Now().UnixNano() % 60000)
+	period := time.Date(3000+seed/12, time.Month(seed%12+1), 1, 0, 0, 0, 0, time.UTC)
+
+	const attempts = 5
+	results := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.AccrueMonthlyCoins(ctx, period, 100)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, storage.ErrAccrualAlreadyDone)
+	}
+	assert.Equal(t, 1, succeeded, "a period must be accrued exactly once")
+
+	_, err := db.AccrueMonthlyCoins(ctx, period, 100)
+	assert.ErrorIs(t, err, storage.ErrAccrualAlreadyDone)
+
+	amount, err := db.GetAccrualEntry(ctx, period, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, amount)
+
+	info, err := db.GetInfo(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1100), info.Coins)
+}
+
+func testWithinTransaction(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	balance := func(t *testing.T, userID int32) int64 {
+		info, err := db.GetInfo(ctx, userID)
+		require.NoError(t, err)
+		return info.Coins
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		user := createUser(t, db, "tx_commit", 100)
+
+		err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := db.UpdateUserCoins(ctx, nil, user.ID, 50); err != nil {
+				return err
+			}
+			_, err := db.BuyItem(ctx, user.ID, "t-shirt")
+			return err
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(70), balance(t, user.ID))
+	})
+
+	t.Run("RollbackOnError", func(t *testing.T) {
+		user := createUser(t, db, "tx_rollback", 100)
+
+		err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := db.UpdateUserCoins(ctx, nil, user.ID, 50); err != nil {
+				return err
+			}
+			return errAbort
+		})
+
+		assert.ErrorIs(t, err, errAbort)
+		assert.Equal(t, int64(100), balance(t, user.ID), "changes of a failed transaction must be rolled back")
+	})
+
+	t.Run("NestedFailureRollsBackOuter", func(t *testing.T) {
+		sender := createUser(t, db, "tx_nested_sender", 100)
+		recipient := createUser(t, db, "tx_nested_recipient", 0)
+
+		err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+			if _, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 60}); err != nil {
+				return err
+			}
+			_, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 60})
+			return err
+		})
+
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+		assert.Equal(t, int64(100), balance(t, sender.ID), "the first transfer must be rolled back with the second")
+		assert.Equal(t, int64(0), balance(t, recipient.ID))
+	})
+}
+
+func testSessions(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db, "sessions", 1000)
+	other := createUser(t, db, "sessions", 1000)
+	issuedAt := time.Now().UTC().Truncate(time.Second)
+
+	ids := make([]string, 4)
+	for i := range ids {
+		ids[i] = uniqueUsername("jti")
+		session := models.Session{ID: ids[i], UserID: user.ID, UserAgent: "agent", IssuedAt: issuedAt.Add(time.Duration(i) * time.Second), ExpiresAt: issuedAt.Add(time.Hour)}
+		require.NoError(t, db.CreateSession(ctx, session, 3))
+	}
+
+	active, err := db.IsSessionActive(ctx, user.ID, ids[0])
+	require.NoError(t, err)
+	assert.False(t, active, "the oldest session must be revoked when the limit is exceeded")
+	for _, id := range ids[1:] {
+		active, err = db.IsSessionActive(ctx, user.ID, id)
+		require.NoError(t, err)
+		assert.True(t, active)
+	}
+
+	active, err = db.IsSessionActive(ctx, other.ID, ids[3])
+	require.NoError(t, err)
+	assert.False(t, active, "a session must not be valid for another user")
+
+	sessions, err := db.GetActiveSessions(ctx, user.ID, issuedAt)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+	assert.Equal(t, ids[3], sessions[0].ID, "sessions must be listed newest first")
+	assert.Equal(t, "agent", sessions[0].UserAgent)
+
+	activeCount, err := db.CountActiveSessions(ctx, issuedAt)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, activeCount, 3)
+
+	assert.ErrorIs(t, db.RevokeSession(ctx, other.ID, ids[3]), storage.ErrSessionNotFound)
+	require.NoError(t, db.RevokeSession(ctx, user.ID, ids[3]))
+
+	revokedCount, err := db.CountActiveSessions(ctx, issuedAt)
+	require.NoError(t, err)
+	assert.Equal(t, activeCount-1, revokedCount, "revoked sessions must not be counted")
+	assert.ErrorIs(t, db.RevokeSession(ctx, user.ID, ids[3]), storage.ErrSessionNotFound)
+
+	active, err = db.IsSessionActive(ctx, user.ID, ids[3])
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	sessions, err = db.GetActiveSessions(ctx, user.ID, issuedAt.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "expired sessions must not be listed")
+}
+
+func testUserExport(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db, "export", 1000)
+	other := createUser(t, db, "export", 1000)
+
+	_, err := db.BuyItem(ctx, user.ID, "cup")
+	require.NoError(t, err)
+	transferCoins(t, db, user, other, 30)
+	transferCoins(t, db, other, user, 20)
+
+	var sections []string
+	records := map[string][]any{}
+	err = db.StreamUserExport(ctx, user.ID, func(section string, record any) error {
+		if len(sections) == 0 || sections[len(sections)-1] != section {
+			sections = append(sections, section)
+		}
+		records[section] = append(records[section], record)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{storage.ExportSectionAccount, storage.ExportSectionPurchases, storage.ExportSectionTransfers}, sections,
+		"sections must be passed once each, in order, skipping empty ones")
+	require.Len(t, records[storage.ExportSectionAccount], 1)
+	account := records[storage.ExportSectionAccount][0].(*models.AccountExport)
+	assert.Equal(t, user.Username, account.Username)
+	assert.Equal(t, int64(1000-20-30+20), account.Coins)
+	require.Len(t, records[storage.ExportSectionPurchases], 1)
+	assert.Equal(t, "cup", records[storage.ExportSectionPurchases][0].(models.PurchaseExport).Item)
+	require.Len(t, records[storage.ExportSectionTransfers], 2, "transfers must be exported in both directions")
+	assert.Equal(t, user.Username, records[storage.ExportSectionTransfers][0].(models.Transfer).FromUser)
+	assert.Equal(t, other.Username, records[storage.ExportSectionTransfers][1].(models.Transfer).FromUser)
+
+	stop := errors.New("stop")
+	assert.ErrorIs(t, db.StreamUserExport(ctx, user.ID, func(string, any) error { return stop }), stop)
+	assert.ErrorIs(t, db.StreamUserExport(ctx, -1, func(string, any) error { return nil }), storage.ErrUserNotFound)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	allowedAt, err := db.ReserveDataExport(ctx, user.ID, now, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, allowedAt.Equal(now.Add(time.Hour)))
+
+	allowedAt, err = db.ReserveDataExport(ctx, user.ID, now.Add(59*time.Minute), time.Hour)
+	assert.ErrorIs(t, err, storage.ErrDataExportTooSoon)
+	assert.True(t, allowedAt.Equal(now.Add(time.Hour)), "a refused export must not move the next allowed time")
+
+	_, err = db.ReserveDataExport(ctx, user.ID, now.Add(time.Hour), time.Hour)
+	assert.NoError(t, err)
+	_, err = db.ReserveDataExport(ctx, other.ID, now, time.Hour)
+	assert.NoError(t, err, "the limit must apply per user")
+}
+
+func testPersonalTokens(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db, "pat", 1000)
+	other := createUser(t, db, "pat", 1000)
+	now := time.Now().UTC().Truncate(time.Second)
+	hash := auth.HashPersonalToken(uniqueUsername("pat"))
+	expiredHash := auth.HashPersonalToken(uniqueUsername("pat"))
+
+	created, err := db.CreatePersonalToken(ctx, models.PersonalToken{
+		UserID: user.ID, Name: "bot", Prefix: "pat_abcdefgh", Scopes: []string{auth.ScopeInfo, auth.ScopeSendCoin}, CreatedAt: now,
+	}, hash)
+	require.NoError(t, err)
+	assert.NotZero(t, created.ID)
+
+	expiresAt := now.Add(time.Minute)
+	_, err = db.CreatePersonalToken(ctx, models.PersonalToken{
+		UserID: user.ID, Name: "short-lived", Prefix: "pat_ijklmnop", Scopes: []string{auth.ScopeInfo}, CreatedAt: now.Add(time.Second), ExpiresAt: &expiresAt,
+	}, expiredHash)
+	require.NoError(t, err)
+
+	resolved, err := db.GetPersonalTokenByHash(ctx, hash, now)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, resolved.UserID)
+	assert.Equal(t, []string{auth.ScopeInfo, auth.ScopeSendCoin}, resolved.Scopes)
+	assert.Nil(t, resolved.ExpiresAt)
+
+	_, err = db.GetPersonalTokenByHash(ctx, expiredHash, expiresAt)
+	assert.ErrorIs(t, err, storage.ErrPersonalTokenNotFound, "an expired token must not resolve")
+
+	tokens, err := db.GetPersonalTokens(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "short-lived", tokens[0].Name, "tokens must be listed newest first")
+
+	err = db.RevokePersonalToken(ctx, other.ID, created.ID, now)
+	assert.ErrorIs(t, err, storage.ErrPersonalTokenNotFound, "a token of another user must not be revoked")
+
+	require.NoError(t, db.RevokePersonalToken(ctx, user.ID, created.ID, now))
+	_, err = db.GetPersonalTokenByHash(ctx, hash, now)
+	assert.ErrorIs(t, err, storage.ErrPersonalTokenNotFound, "a revoked token must not resolve")
+	assert.ErrorIs(t, db.RevokePersonalToken(ctx, user.ID, created.ID, now), storage.ErrPersonalTokenNotFound)
+
+	tokens, err = db.GetPersonalTokens(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+}
+
+func testDelegations(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// delegate authorizes grantee to spend allowance coins of grantor for an hour.
+	delegate := func(t *testing.T, grantor *models.User, grantee *models.User, allowance int) *models.Delegation {
+		t.Helper()
+		delegation, err := db.CreateDelegation(ctx, grantor.ID, models.Delegation{
+			Grantee: grantee.Username, Allowance: allowance, ExpiresAt: now.Add(time.Hour), CreatedAt: now,
+		})
+		require.NoError(t, err)
+		return delegation
+	}
+
+	t.Run("CreateAndList", func(t *testing.T) {
+		grantor := createUser(t, db, "grantor", 1000)
+		grantee := createUser(t, db, "grantee", 1000)
+
+		created := delegate(t, grantor, grantee, 50)
+		assert.NotZero(t, created.ID)
+		assert.Equal(t, grantor.Username, created.Grantor)
+		assert.Equal(t, 50, created.RemainingAllowance)
+
+		replaced := delegate(t, grantor, grantee, 70)
+		assert.NotEqual(t, created.ID, replaced.ID)
+
+		delegations, err := db.GetDelegations(ctx, grantor.ID)
+		require.NoError(t, err)
+		require.Len(t, delegations.Granted, 1, "a new delegation must replace the active one")
+		assert.Equal(t, grantee.Username, delegations.Granted[0].Grantee)
+		assert.Equal(t, 70, delegations.Granted[0].Allowance)
+		assert.Empty(t, delegations.Received)
+
+		delegations, err = db.GetDelegations(ctx, grantee.ID)
+		require.NoError(t, err)
+		require.Len(t, delegations.Received, 1)
+		assert.Equal(t, grantor.Username, delegations.Received[0].Grantor)
+
+		_, err = db.CreateDelegation(ctx, grantor.ID, models.Delegation{Grantee: grantor.Username, Allowance: 10, ExpiresAt: now.Add(time.Hour), CreatedAt: now})
+		assert.ErrorIs(t, err, storage.ErrSelfDelegation)
+		_, err = db.CreateDelegation(ctx, grantor.ID, models.Delegation{Grantee: uniqueUsername("nobody"), Allowance: 10, ExpiresAt: now.Add(time.Hour), CreatedAt: now})
+		assert.ErrorIs(t, err, storage.ErrRecipientNotFound)
+
+		assert.ErrorIs(t, db.RevokeDelegation(ctx, grantee.ID, replaced.ID, now), storage.ErrDelegationNotFound, "only the grantor may revoke")
+		require.NoError(t, db.RevokeDelegation(ctx, grantor.ID, replaced.ID, now))
+		assert.ErrorIs(t, db.RevokeDelegation(ctx, grantor.ID, replaced.ID, now), storage.ErrDelegationNotFound)
+	})
+
+	t.Run("BuyOnBehalf", func(t *testing.T) {
+		grantor := createUser(t, db, "grantor", 1000)
+		grantee := createUser(t, db, "grantee", 500)
+		delegate(t, grantor, grantee, 70)
+
+		purchase, err := db.BuyItemOnBehalf(ctx, grantee.ID, grantor.Username, "cup", now)
+		require.NoError(t, err)
+		assert.Regexp(t, receiptNumberPattern, purchase.ReceiptNumber)
+		assert.Equal(t, grantor.Username, purchase.OnBehalfOf)
+		assert.Equal(t, int64(500), purchase.RemainingCoins, "the buyer must not be charged")
+		assert.Equal(t, int64(980), purchase.GrantorCoins)
+		require.NotNil(t, purchase.RemainingAllowance)
+		assert.Equal(t, 50, *purchase.RemainingAllowance)
+
+		info, err := db.GetInfo(ctx, grantor.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(980), info.Coins)
+		assert.Equal(t, []models.InventoryItem{{Type: "cup", Category: "accessories", Quantity: 1, PendingQuantity: 1}}, info.Inventory, "the grantor receives the item")
+
+		_, err = db.BuyItemOnBehalf(ctx, grantee.ID, grantor.Username, "t-shirt", now)
+		assert.ErrorIs(t, err, storage.ErrDelegationAllowanceExceeded)
+
+		_, err = db.BuyItemOnBehalf(ctx, grantee.ID, grantor.Username, "cup", now.Add(2*time.Hour))
+		assert.ErrorIs(t, err, storage.ErrDelegationExpired)
+
+		_, err = db.BuyItemOnBehalf(ctx, grantor.ID, grantee.Username, "cup", now)
+		assert.ErrorIs(t, err, storage.ErrDelegationNotFound, "a delegation must not work in reverse")
+
+		info, err = db.GetInfo(ctx, grantor.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(980), info.Coins, "refused purchases must not charge the grantor")
+	})
+
+	t.Run("AllowanceExhaustionRace", func(t *testing.T) {
+		grantor := createUser(t, db, "grantor", 1000)
+		grantee := createUser(t, db, "grantee", 0)
+		delegate(t, grantor, grantee, 100)
+
+		const buyers = 10
+		var wg sync.WaitGroup
+		var bought, refused atomic.Int32
+		for range buyers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := db.BuyItemOnBehalf(ctx, grantee.ID, grantor.Username, "cup", now)
+				switch {
+				case err == nil:
+					bought.Add(1)
+				case errors.Is(err, storage.ErrDelegationAllowanceExceeded):
+					refused.Add(1)
+				default:
+					t.Errorf("unexpected error: %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(5), bought.Load(), "concurrent purchases must not spend more than the allowance")
+		assert.Equal(t, int32(buyers-5), refused.Load())
+
+		info, err := db.GetInfo(ctx, grantor.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(900), info.Coins)
+	})
+
+	t.Run("RevocationRace", func(t *testing.T) {
+		grantor := createUser(t, db, "grantor", 1000)
+		grantee := createUser(t, db, "grantee", 0)
+		delegation := delegate(t, grantor, grantee, 200)
+
+		const buyers = 8
+		var wg sync.WaitGroup
+		var bought atomic.Int32
+		for range buyers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := db.BuyItemOnBehalf(ctx, grantee.ID, grantor.Username, "cup", now)
+				switch {
+				case err == nil:
+					bought.Add(1)
+				case errors.Is(err, storage.ErrDelegationNotFound):
+				default:
+					t.Errorf("unexpected error: %s", err)
+				}
+			}()
+		}
+		require.NoError(t, db.RevokeDelegation(ctx, grantor.ID, delegation.ID, now))
+		wg.Wait()
+
+		info, err := db.GetInfo(ctx, grantor.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000-20*bought.Load()), info.Coins, "every purchase made before the revocation must be charged once")
+
+		_, err = db.BuyItemOnBehalf(ctx, grantee.ID, grantor.Username, "cup", now)
+		assert.ErrorIs(t, err, storage.ErrDelegationNotFound, "a revoked delegation must not be used")
+	})
+}
+
+func testDryRun(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	dryRunCtx := storage.WithDryRun(ctx)
+
+	t.Run("BuyItem", func(t *testing.T) {
+		user := createUser(t, db, "dry_buyer", 100)
+
+		purchase, err := db.BuyItem(dryRunCtx, user.ID, "t-shirt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(20), purchase.RemainingCoins, "a dry run reports the balance the purchase would leave")
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), info.Coins, "a dry run must not change the balance")
+		assert.Empty(t, info.Inventory)
+
+		_, dryErr := db.BuyItem(dryRunCtx, user.ID, "pink-hoody")
+		_, err = db.BuyItem(ctx, user.ID, "pink-hoody")
+		assert.ErrorIs(t, dryErr, storage.ErrInsufficientFunds)
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds, "a dry run must fail like the real call")
+	})
+
+	t.Run("TransferCoins", func(t *testing.T) {
+		sender := createUser(t, db, "dry_sender", 100)
+		recipient := createUser(t, db, "dry_recipient", 100)
+
+		_, err := db.TransferCoins(dryRunCtx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 60})
+		require.NoError(t, err)
+
+		senderInfo, err := db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), senderInfo.Coins)
+		assert.Empty(t, senderInfo.CoinHistory.Sent, "a dry run must not record the transfer")
+
+		recipientInfo, err := db.GetInfo(ctx, recipient.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), recipientInfo.Coins)
+
+		_, dryErr := db.TransferCoins(dryRunCtx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 200})
+		_, err = db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 200})
+		assert.ErrorIs(t, dryErr, storage.ErrInsufficientFunds)
+		assert.ErrorIs(t, err, storage.ErrInsufficientFunds, "a dry run must fail like the real call")
+	})
+}
+
+func testConsumeItem(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	t.Run("PartialFulfillmentAcrossPurchases", func(t *testing.T) {
+		user := createUser(t, db, "consumer", 1000)
+		for range 3 {
+			_, err := db.BuyItem(ctx, user.ID, "pen")
+			require.NoError(t, err)
+		}
+
+		item, err := db.ConsumeItem(ctx, user.ID, "pen", 2)
+		require.NoError(t, err)
+		assert.Equal(t, &models.InventoryItem{Type: "pen", Category: "stationery", Quantity: 3, PendingQuantity: 1, FulfilledQuantity: 2}, item)
+
+		item, err = db.ConsumeItem(ctx, user.ID, "pen", 1)
+		require.NoError(t, err)
+		assert.Equal(t, &models.InventoryItem{Type: "pen", Category: "stationery", Quantity: 3, PendingQuantity: 0, FulfilledQuantity: 3}, item)
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []models.InventoryItem{{Type: "pen", Category: "stationery", Quantity: 3, PendingQuantity: 0, FulfilledQuantity: 3}}, info.Inventory)
+	})
+
+	t.Run("MoreThanOwned", func(t *testing.T) {
+		user := createUser(t, db, "consumer", 1000)
+		_, err := db.BuyItem(ctx, user.ID, "cup")
+		require.NoError(t, err)
+		_, err = db.BuyItem(ctx, user.ID, "cup")
+		require.NoError(t, err)
+
+		_, err = db.ConsumeItem(ctx, user.ID, "cup", 3)
+		assert.ErrorIs(t, err, storage.ErrInsufficientItems)
+
+		info, err := db.GetInfo(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []models.InventoryItem{{Type: "cup", Category: "accessories", Quantity: 2, PendingQuantity: 2}}, info.Inventory, "a rejected consume must not fulfill anything")
+
+		_, err = db.ConsumeItem(ctx, user.ID, "socks", 1)
+		assert.ErrorIs(t, err, storage.ErrInsufficientItems, "an item never bought cannot be consumed")
+	})
+}
+
+func testNotifications(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	admin := createUser(t, db, "notifications_admin", 0)
+	sender := createUser(t, db, "notifications_sender", 1000)
+	recipient := createUser(t, db, "notifications_recipient", 0)
+	other := createUser(t, db, "notifications_other", 0)
+
+	unread := func(user *models.User) []models.Notification {
+		t.Helper()
+		notifications, err := db.GetNotifications(ctx, user.ID, models.NotificationsFilter{UnreadOnly: true, Limit: 10})
+		require.NoError(t, err)
+		return notifications
+	}
+
+	transferID := transferCoins(t, db, sender, recipient, 100)
+	require.NoError(t, db.GiftItem(ctx, sender.ID, "cup", models.GiftRequest{ToUser: recipient.Username}))
+
+	notifications := unread(recipient)
+	require.Len(t, notifications, 2)
+	assert.Equal(t, storage.NotificationGiftReceived, notifications[0].Category, "notifications must be returned newest first")
+	assert.Equal(t, "cup", notifications[0].Item)
+	assert.Equal(t, "you received a cup as a gift from "+sender.Username, notifications[0].Message)
+	assert.Equal(t, storage.NotificationCoinsReceived, notifications[1].Category)
+	assert.Equal(t, sender.Username, notifications[1].User)
+	assert.Equal(t, 100, notifications[1].Amount)
+	assert.Equal(t, fmt.Sprintf("you received 100 coins from %s", sender.Username), notifications[1].Message)
+	assert.Empty(t, unread(sender), "the sender is not notified of their own transfer")
+
+	t.Run("Mark read", func(t *testing.T) {
+		received := notifications[1]
+
+		read, err := db.MarkNotificationRead(ctx, recipient.ID, received.ID, now)
+		require.NoError(t, err)
+		require.NotNil(t, read.ReadAt)
+		assert.True(t, now.Equal(*read.ReadAt))
+		assert.Equal(t, received.Message, read.Message)
+
+		again, err := db.MarkNotificationRead(ctx, recipient.ID, received.ID, now.Add(time.Hour))
+		require.NoError(t, err, "marking a notification read again must succeed")
+		require.NotNil(t, again.ReadAt)
+		assert.True(t, now.Equal(*again.ReadAt), "the time of the first read must be kept")
+
+		_, err = db.MarkNotificationRead(ctx, other.ID, received.ID, now)
+		assert.ErrorIs(t, err, storage.ErrNotificationNotFound, "notifications of other users must not be reachable")
+		_, err = db.MarkNotificationRead(ctx, recipient.ID, 1<<62, now)
+		assert.ErrorIs(t, err, storage.ErrNotificationNotFound)
+
+		count, err := db.CountUnreadNotifications(ctx, recipient.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		all, err := db.GetNotifications(ctx, recipient.ID, models.NotificationsFilter{Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, all, 2, "read notifications are still listed without the unread filter")
+	})
+
+	t.Run("Mark all read", func(t *testing.T) {
+		marked, err := db.MarkAllNotificationsRead(ctx, recipient.ID, now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), marked)
+
+		marked, err = db.MarkAllNotificationsRead(ctx, recipient.ID, now)
+		require.NoError(t, err)
+		assert.Zero(t, marked)
+		assert.Empty(t, unread(recipient))
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		for amount := 1; amount <= 5; amount++ {
+			transferCoins(t, db, sender, other, amount)
+		}
+
+		var collected []models.Notification
+		filter := models.NotificationsFilter{Limit: 2}
+		for {
+			page, err := db.GetNotifications(ctx, other.ID, filter)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				break
+			}
+			collected = append(collected, page...)
+			last := page[len(page)-1]
+			filter.After = &models.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+
+		require.Len(t, collected, 5)
+		for i, notification := range collected {
+			assert.Equal(t, 5-i, notification.Amount, "notifications must be returned newest first without gaps or duplicates")
+		}
+	})
+
+	t.Run("Mute", func(t *testing.T) {
+		muted, err := db.GetMutedNotificationCategories(ctx, recipient.ID)
+		require.NoError(t, err)
+		assert.Empty(t, muted)
+
+		require.NoError(t, db.SetMutedNotificationCategories(ctx, recipient.ID, []string{storage.NotificationCoinsReceived}))
+		transferCoins(t, db, sender, recipient, 10)
+		require.NoError(t, db.GiftItem(ctx, sender.ID, "pen", models.GiftRequest{ToUser: recipient.Username}))
+
+		notifications := unread(recipient)
+		require.Len(t, notifications, 1, "no notification of a muted category must be written")
+		assert.Equal(t, storage.NotificationGiftReceived, notifications[0].Category)
+
+		require.NoError(t, db.SetMutedNotificationCategories(ctx, recipient.ID, nil))
+		muted, err = db.GetMutedNotificationCategories(ctx, recipient.ID)
+		require.NoError(t, err)
+		assert.Empty(t, muted)
+		transferCoins(t, db, sender, recipient, 10)
+		assert.Len(t, unread(recipient), 2)
+	})
+
+	t.Run("Admin adjustment", func(t *testing.T) {
+		_, err := db.MarkAllNotificationsRead(ctx, recipient.ID, now)
+		require.NoError(t, err)
+		_, err = db.MarkAllNotificationsRead(ctx, sender.ID, now)
+		require.NoError(t, err)
+
+		_, err = db.ReverseTransfer(ctx, admin.ID, transferID, false, now)
+		require.NoError(t, err)
+
+		taken := unread(recipient)
+		require.Len(t, taken, 1)
+		assert.Equal(t, storage.NotificationAdminAdjustment, taken[0].Category)
+		assert.Equal(t, -100, taken[0].Amount)
+		assert.Equal(t, "an administrator took back 100 coins you received from "+sender.Username, taken[0].Message)
+
+		returned := unread(sender)
+		require.Len(t, returned, 1)
+		assert.Equal(t, 100, returned[0].Amount)
+		assert.Equal(t, recipient.Username, returned[0].User)
+	})
+}
+
+func testInventoryCounts(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	user := createUser(t, db, "inventory_counts", 1000)
+	giver := createUser(t, db, "inventory_giver", 1000)
+
+	for range 3 {
+		_, err := db.BuyItem(ctx, user.ID, "pen")
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.GiftItem(ctx, giver.ID, "pen", models.GiftRequest{ToUser: user.Username}))
+	require.NoError(t, db.GiftItem(ctx, giver.ID, "cup", models.GiftRequest{ToUser: user.Username}))
+	_, err := db.ConsumeItem(ctx, user.ID, "pen", 2)
+	require.NoError(t, err)
+
+	inventory, err := db.GetMerchPurchasesInfo(ctx, nil, user.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.InventoryItem{
+		{Type: "pen", Category: "stationery", Quantity: 4, PendingQuantity: 2, FulfilledQuantity: 2},
+		{Type: "cup", Category: "accessories", Quantity: 1, PendingQuantity: 1},
+	}, inventory, "the counts must include purchases, gifts, and handed out units")
+
+	drift, err := db.ReconcileInventoryCounts(ctx, false)
+	require.NoError(t, err)
+	for _, entry := range drift {
+		assert.NotEqual(t, user.ID, entry.UserID, "the counts must match the purchases: %+v", entry)
+	}
+}
+
+// receiptNumberPattern matches the receipt numbers issued for purchases, such as R-2025-000123.
+var receiptNumberPattern = regexp.MustCompile(`^R-[0-9]{4}-[0-9]{6,}$`)
+
+func testReceipts(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	now := time.Now()
+
+	admin := createUser(t, db, "receipt_admin", 0)
+	owner := createUser(t, db, "receipt_owner", 1000)
+	other := createUser(t, db, "receipt_other", 1000)
+
+	first, err := db.BuyItem(ctx, owner.ID, "cup")
+	require.NoError(t, err)
+	second, err := db.BuyItem(ctx, owner.ID, "cup")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ReceiptNumber, second.ReceiptNumber, "every purchase must get its own receipt number")
+
+	t.Run("Owner", func(t *testing.T) {
+		receipt, err := db.GetReceipt(ctx, owner.ID, first.ReceiptNumber)
+		require.NoError(t, err)
+		assert.Equal(t, first.ReceiptNumber, receipt.Number)
+		assert.Equal(t, "cup", receipt.Item)
+		assert.Equal(t, 1, receipt.Quantity)
+		assert.Equal(t, owner.Username, receipt.Owner)
+		assert.Nil(t, receipt.RedeemedAt)
+
+		_, err = db.GetReceipt(ctx, other.ID, first.ReceiptNumber)
+		assert.ErrorIs(t, err, storage.ErrReceiptNotFound, "receipts of other users must not be visible")
+	})
+
+	t.Run("RedemptionRace", func(t *testing.T) {
+		const redeemers = 8
+		var wg sync.WaitGroup
+		var redeemed, conflicts atomic.Int32
+		for range redeemers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := db.RedeemReceipt(ctx, admin.ID, first.ReceiptNumber, now)
+				switch {
+				case err == nil:
+					redeemed.Add(1)
+				case errors.Is(err, storage.ErrReceiptAlreadyRedeemed):
+					conflicts.Add(1)
+				default:
+					t.Errorf("unexpected error: %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), redeemed.Load(), "a receipt must be redeemed exactly once")
+		assert.Equal(t, int32(redeemers-1), conflicts.Load())
+
+		receipt, err := db.GetReceipt(ctx, owner.ID, first.ReceiptNumber)
+		require.NoError(t, err)
+		assert.NotNil(t, receipt.RedeemedAt)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := db.RedeemReceipt(ctx, admin.ID, "R-1999-000000", now)
+		assert.ErrorIs(t, err, storage.ErrReceiptNotFound)
+	})
+}
+
+func testEconomyStats(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	t.Run("Arithmetic", func(t *testing.T) {
+		// Yesterday and today, so that the movements below fall into the range whatever the clock of the database.
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		from, to := today.AddDate(0, 0, -1), today.AddDate(0, 0, 1)
+		total := func(stats *models.EconomyStats) models.EconomyDay {
+			var sum models.EconomyDay
+			for _, day := range stats.Days {
+				sum.Transfers += day.Transfers
+				sum.TransferVolume += day.TransferVolume
+				sum.Purchases += day.Purchases
+				sum.PurchaseVolume += day.PurchaseVolume
+			}
+			return sum
+		}
+
+		before, err := db.GetEconomyStats(ctx, from, to)
+		require.NoError(t, err)
+
+		sender := createUser(t, db, "economy_sender", 1000)
+		recipient := createUser(t, db, "economy_recipient", 500)
+		transferCoins(t, db, sender, recipient, 100)
+		transferCoins(t, db, recipient, sender, 50)
+		_, err = db.BuyItem(ctx, sender.ID, "t-shirt")
+		require.NoError(t, err)
+		_, err = db.BuyItem(ctx, recipient.ID, "cup")
+		require.NoError(t, err)
+
+		after, err := db.GetEconomyStats(ctx, from, to)
+		require.NoError(t, err)
+
+		assert.Equal(t, before.Users+2, after.Users)
+		assert.Equal(t, before.CoinsInCirculation+1500-80-20, after.CoinsInCirculation, "purchases take coins out of circulation")
+		assert.GreaterOrEqual(t, after.Gini, 0.0)
+		assert.Less(t, after.Gini, 1.0)
+
+		require.Len(t, after.Days, 2)
+		assert.Equal(t, from.Format("2006-01-02"), after.Days[0].Date)
+		assert.Equal(t, today.Format("2006-01-02"), after.Days[1].Date)
+		sumBefore, sumAfter := total(before), total(after)
+		assert.Equal(t, sumBefore.Transfers+2, sumAfter.Transfers)
+		assert.Equal(t, sumBefore.TransferVolume+150, sumAfter.TransferVolume)
+		assert.Equal(t, sumBefore.Purchases+2, sumAfter.Purchases)
+		assert.Equal(t, sumBefore.PurchaseVolume+100, sumAfter.PurchaseVolume)
+	})
+
+	t.Run("DaysWithoutMovements", func(t *testing.T) {
+		from := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		stats, err := db.GetEconomyStats(ctx, from, from.AddDate(0, 0, 3))
+		require.NoError(t, err)
+		assert.Equal(t, []models.EconomyDay{{Date: "2000-01-01"}, {Date: "2000-01-02"}, {Date: "2000-01-03"}}, stats.Days)
+	})
+}
+
+func testUserActivity(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db, "activity", 1000)
+	other := createUser(t, db, "activity", 1000)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	record := func(userID int32, path string, createdAt time.Time) {
+		err := db.RecordAPIActivity(ctx, models.APIActivity{
+			UserID: userID, Action: "GET /api/info", Path: path, Status: 200, IP: "203.0.113.7", CreatedAt: createdAt,
+		})
+		require.NoError(t, err)
+	}
+	record(user.ID, "/api/info?1", now.Add(-3*time.Hour))
+	record(user.ID, "/api/info?2", now.Add(-2*time.Hour))
+	record(user.ID, "/api/info?3", now.Add(-time.Hour))
+	record(other.ID, "/api/info?other", now.Add(-time.Hour))
+	record(user.ID, "/api/info?old", now.AddDate(0, 0, -10))
+
+	paths := func(activity []models.APIActivity) []string {
+		var paths []string
+		for _, entry := range activity {
+			assert.Equal(t, user.ID, entry.UserID)
+			paths = append(paths, entry.Path)
+		}
+		return paths
+	}
+
+	filter := models.ActivityFilter{From: now.AddDate(0, 0, -1), To: now, Limit: 2}
+	first, err := db.GetUserActivity(ctx, user.ID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/api/info?3", "/api/info?2"}, paths(first), "newest first, only the user's own rows, within the range")
+
+	filter.After = &models.PageCursor{CreatedAt: first[1].CreatedAt, ID: first[1].ID}
+	second, err := db.GetUserActivity(ctx, user.ID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/api/info?1"}, paths(second))
+
+	filter.After = nil
+	foreign, err := db.GetUserActivity(ctx, other.ID, filter)
+	require.NoError(t, err)
+	require.Len(t, foreign, 1, "users must see only their own rows")
+	assert.Equal(t, "/api/info?other", foreign[0].Path)
+}
+
+func testPartialInfo(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	sender := createUser(t, db, "partial_info", 1000)
+	recipient := createUser(t, db, "partial_info", 1000)
+	transferCoins(t, db, sender, recipient, 100)
+	transferCoins(t, db, recipient, sender, 40)
+	_, err := db.BuyItem(ctx, sender.ID, "cup")
+	require.NoError(t, err)
+
+	info, err := db.GetInfo(ctx, sender.ID)
+	require.NoError(t, err)
+	partial, err := db.GetPartialInfo(ctx, sender.ID)
+	require.NoError(t, err)
+	assert.Empty(t, partial.Warnings)
+	assert.Equal(t, info, partial, "without failures the partial mode must return the full response")
+}
+
+func testIdempotencyKeys(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db, "idempotency", 1000)
+	other := createUser(t, db, "idempotency", 1000)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	claim := func(userID int32, key string, fingerprint string, now time.Time) *models.IdempotentResponse {
+		t.Helper()
+		var stored *models.IdempotentResponse
+		err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			stored, err = db.ClaimIdempotencyKey(ctx, userID, key, fingerprint, now, now.Add(-24*time.Hour))
+			if err != nil || stored != nil {
+				return err
+			}
+			return db.SaveIdempotentResponse(ctx, userID, key, models.IdempotentResponse{StatusCode: 200, Body: []byte(fingerprint)})
+		})
+		require.NoError(t, err)
+		return stored
+	}
+
+	assert.Nil(t, claim(user.ID, "key", "buy cup", now), "a new key must be claimed")
+	assert.Equal(t, &models.IdempotentResponse{Fingerprint: "buy cup", StatusCode: 200, Body: []byte("buy cup")},
+		claim(user.ID, "key", "buy pen", now.Add(time.Hour)), "a claimed key must return its response and fingerprint")
+	assert.Nil(t, claim(other.ID, "key", "buy pen", now), "keys of other users must not collide")
+
+	assert.Nil(t, claim(user.ID, "key", "buy pen", now.Add(24*time.Hour)), "an expired key must be claimed again")
+	assert.Equal(t, []byte("buy pen"), claim(user.ID, "key", "buy cup", now.Add(25*time.Hour)).Body)
+
+	rollback := errors.New("rollback")
+	err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+		stored, err := db.ClaimIdempotencyKey(ctx, user.ID, "rolled-back", "buy cup", now, now.Add(-24*time.Hour))
+		require.NoError(t, err)
+		require.Nil(t, stored)
+		return rollback
+	})
+	require.ErrorIs(t, err, rollback)
+	assert.Nil(t, claim(user.ID, "rolled-back", "buy cup", now), "a rolled back claim must leave the key free")
+}
+
+func testPreviewTransfer(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	sender := createUser(t, db, "preview", 1000)
+	recipient := createUser(t, db, "preview", 1100)
+
+	preview, err := db.PreviewTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 760})
+	require.NoError(t, err)
+	assert.Equal(t, &models.TransferPreview{ToUser: recipient.Username, Amount: 760, SenderBalance: 240, RecipientBalance: 1860}, preview)
+
+	_, err = db.PreviewTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 1001})
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+	_, err = db.PreviewTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username + "-missing", Amount: 10})
+	assert.ErrorIs(t, err, storage.ErrRecipientNotFound)
+	_, err = db.PreviewTransfer(ctx, sender.ID, models.SendCoinRequest{ToUser: sender.Username, Amount: 10})
+	assert.ErrorIs(t, err, storage.ErrSelfTransfer)
+	_, err = db.PreviewTransfer(ctx, -1, models.SendCoinRequest{ToUser: recipient.Username, Amount: 10})
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	user, err := db.GetUserInfo(ctx, nil, sender.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), user.Coins, "a preview must not change balances")
+}
+
+func testTermsAcceptance(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db, "terms", 1000)
+
+	acceptance, err := db.GetTermsAcceptance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.TermsAcceptance{}, acceptance, "new users have accepted nothing")
+
+	first := time.Now().UTC().Truncate(time.Microsecond)
+	acceptance, err = db.AcceptTerms(ctx, user.ID, 1, first)
+	require.NoError(t, err)
+	require.NotNil(t, acceptance.AcceptedAt)
+	assert.Equal(t, 1, acceptance.Version)
+	assert.True(t, first.Equal(*acceptance.AcceptedAt))
+
+	acceptance, err = db.AcceptTerms(ctx, user.ID, 1, first.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, first.Equal(*acceptance.AcceptedAt), "accepting the same version again must keep the first acceptance")
+
+	acceptance, err = db.AcceptTerms(ctx, user.ID, 2, first.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, acceptance.Version)
+	assert.True(t, first.Add(2*time.Hour).Equal(*acceptance.AcceptedAt))
+
+	stored, err := db.GetTermsAcceptance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, acceptance.Version, stored.Version)
+
+	_, err = db.GetTermsAcceptance(ctx, -1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = db.AcceptTerms(ctx, -1, 1, first)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+// invariantViolations returns the violations of the report concerning the rows of the table with the IDs.
+func invariantViolations(report *models.InvariantReport, table string, ids ...int64) []models.InvariantViolation {
+	var violations []models.InvariantViolation
+	for _, violation := range report.Violations {
+		for _, id := range ids {
+			if violation.Table == table && violation.RowID == id {
+				violations = append(violations, violation)
+			}
+		}
+	}
+	return violations
+}
+
+func testCheckInvariants(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	admin := createUser(t, db, "invariants_admin", 0)
+	alice := createUser(t, db, "invariants_alice", 1000)
+	bob := createUser(t, db, "invariants_bob", 500)
+
+	_, err := db.BuyItem(ctx, alice.ID, "cup")
+	require.NoError(t, err)
+	require.NoError(t, db.GiftItem(ctx, alice.ID, "pen", models.GiftRequest{ToUser: bob.Username}))
+	transferCoins(t, db, alice, bob, 300)
+	reversed := transferCoins(t, db, bob, alice, 100)
+	_, err = db.ReverseTransfer(ctx, admin.ID, reversed, false, time.Now())
+	require.NoError(t, err)
+	hold, err := db.CreateHold(ctx, bob.ID, 50, "invariants")
+	require.NoError(t, err)
+	_, err = db.CaptureHold(ctx, hold.ID)
+	require.NoError(t, err)
+	_, err = db.CreateHold(ctx, alice.ID, 40, "invariants")
+	require.NoError(t, err)
+
+	t.Run("Consistent", func(t *testing.T) {
+		report, err := db.CheckInvariants(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, invariantViolations(report, "content.users", int64(admin.ID), int64(alice.ID), int64(bob.ID)),
+			"purchases, gifts, transfers, reversals, and holds must keep the balances consistent")
+	})
+
+	t.Run("LedgerBalance", func(t *testing.T) {
+		require.NoError(t, db.UpdateUserCoins(ctx, nil, bob.ID, 7))
+
+		report, err := db.CheckInvariants(ctx)
+		require.NoError(t, err)
+		violations := invariantViolations(report, "content.users", int64(bob.ID))
+		require.Len(t, violations, 1, "a balance changed outside any operation must be reported")
+		assert.Equal(t, models.InvariantLedgerBalance, violations[0].Invariant)
+		assert.Equal(t, violations[0].Expected+7, violations[0].Actual)
+		assert.NotEqual(t, report.TotalLedger, report.TotalBalances)
+	})
+}
+
+// createCampaign creates a gifting campaign active from an hour ago until an hour from now and ends it, so that
+// it pays no bonus to later transfers, when the test completes.
+func createCampaign(t *testing.T, db storage.Storage, multiplier float64, budget int64) *models.Campaign {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	campaign, err := db.CreateCampaign(context.Background(), models.Campaign{
+		Name: uniqueUsername("campaign"), Multiplier: multiplier, Budget: budget, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		ended := *campaign
+		ended.StartsAt, ended.EndsAt = now.Add(-2*time.Hour), now.Add(-time.Hour)
+		_, err := db.UpdateCampaign(context.Background(), ended)
+		assert.NoError(t, err)
+	})
+	return campaign
+}
+
+func testCampaigns(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	sender := createUser(t, db, "campaign_sender", 1000)
+	recipient := createUser(t, db, "campaign_recipient", 0)
+	campaign := createCampaign(t, db, 2, 150)
+	assert.Equal(t, int64(150), campaign.RemainingBudget)
+
+	t.Run("Bonus", func(t *testing.T) {
+		transferID := transferCoins(t, db, sender, recipient, 100)
+
+		transfer, err := db.GetTransfer(ctx, recipient.ID, transferID)
+		require.NoError(t, err)
+		assert.Equal(t, 100, transfer.Amount)
+		assert.Equal(t, int64(100), transfer.Bonus)
+		require.NotNil(t, transfer.CampaignID)
+		assert.Equal(t, campaign.ID, *transfer.CampaignID)
+
+		info, err := db.GetInfo(ctx, recipient.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(200), info.Coins, "the recipient must get the amount and the bonus")
+		info, err = db.GetInfo(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(900), info.Coins, "the sender must only be charged the amount")
+
+		got, err := db.GetCampaign(ctx, campaign.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(50), got.RemainingBudget)
+	})
+
+	t.Run("Exhausted budget", func(t *testing.T) {
+		transferID := transferCoins(t, db, sender, recipient, 100)
+
+		transfer, err := db.GetTransfer(ctx, recipient.ID, transferID)
+		require.NoError(t, err)
+		assert.Zero(t, transfer.Bonus, "a bonus the budget cannot cover in full must not be paid")
+		assert.Nil(t, transfer.CampaignID)
+
+		transferID = transferCoins(t, db, sender, recipient, 50)
+		transfer, err = db.GetTransfer(ctx, recipient.ID, transferID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(50), transfer.Bonus, "a bonus the budget covers must still be paid")
+
+		got, err := db.GetCampaign(ctx, campaign.ID)
+		require.NoError(t, err)
+		assert.Zero(t, got.RemainingBudget)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		update := *campaign
+		update.Budget = 100
+		_, err := db.UpdateCampaign(ctx, update)
+		assert.ErrorIs(t, err, storage.ErrCampaignBudgetSpent)
+
+		update.Budget = 400
+		updated, err := db.UpdateCampaign(ctx, update)
+		require.NoError(t, err)
+		assert.Equal(t, int64(250), updated.RemainingBudget, "the bonuses already paid must be kept")
+
+		update.ID = -1
+		_, err = db.UpdateCampaign(ctx, update)
+		assert.ErrorIs(t, err, storage.ErrCampaignNotFound)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		campaigns, err := db.GetCampaigns(ctx)
+		require.NoError(t, err)
+		found := false
+		for _, c := range campaigns {
+			found = found || c.ID == campaign.ID
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.ErrorIs(t, db.DeleteCampaign(ctx, campaign.ID), storage.ErrCampaignInUse)
+		assert.ErrorIs(t, db.DeleteCampaign(ctx, -1), storage.ErrCampaignNotFound)
+
+		unused, err := db.CreateCampaign(ctx, models.Campaign{
+			Name: uniqueUsername("campaign"), Multiplier: 1.5, Budget: 10, StartsAt: time.Now().Add(time.Hour), EndsAt: time.Now().Add(2 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.NoError(t, db.DeleteCampaign(ctx, unused.ID))
+		_, err = db.GetCampaign(ctx, unused.ID)
+		assert.ErrorIs(t, err, storage.ErrCampaignNotFound)
+	})
+
+	t.Run("Invariants", func(t *testing.T) {
+		report, err := db.CheckInvariants(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, invariantViolations(report, "content.users", int64(sender.ID), int64(recipient.ID)),
+			"campaign bonuses must keep the balances consistent")
+		assert.Empty(t, invariantViolations(report, "content.gifting_campaigns", campaign.ID))
+	})
+}
+
+// createPromotion stores promotion from start to end relative to now and ends it when the test finishes, so that
+// it does not discount the purchases of later tests.
+func createPromotion(t *testing.T, db storage.Storage, promotion models.Promotion, start, end time.Duration) *models.Promotion {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	promotion.StartsAt, promotion.EndsAt = now.Add(start), now.Add(end)
+	created, err := db.CreatePromotion(context.Background(), promotion)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		ended := *created
+		ended.StartsAt, ended.EndsAt = now.Add(-2*time.Hour), now.Add(-time.Hour)
+		_, err := db.UpdatePromotion(context.Background(), ended)
+		assert.NoError(t, err)
+	})
+	return created
+}
+
+func testPromotions(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	buyer := createUser(t, db, "promotion_buyer", 1000)
+
+	createPromotion(t, db, models.Promotion{Item: "umbrella", DiscountAmount: 150}, time.Minute, time.Hour)
+	createPromotion(t, db, models.Promotion{Item: "umbrella", DiscountAmount: 150}, -time.Hour, -time.Minute)
+
+	t.Run("Outside the window", func(t *testing.T) {
+		item, err := db.GetItemPrice(ctx, nil, "umbrella")
+		require.NoError(t, err)
+		assert.Equal(t, 200, item.Price, "promotions must not apply before they start or after they end")
+		assert.Nil(t, item.PromotionID)
+	})
+
+	byCategory := createPromotion(t, db, models.Promotion{Category: "accessories", DiscountPercent: 10}, -time.Minute, time.Hour)
+	byItem := createPromotion(t, db, models.Promotion{Item: "umbrella", DiscountAmount: 30}, -time.Minute, time.Hour)
+	createPromotion(t, db, models.Promotion{Item: "umbrella", DiscountPercent: 15}, -time.Minute, time.Hour)
+
+	t.Run("Best promotion", func(t *testing.T) {
+		item, err := db.GetItemPrice(ctx, nil, "umbrella")
+		require.NoError(t, err)
+		assert.Equal(t, 170, item.Price, "the largest discount must win")
+		assert.Equal(t, 200, item.OriginalPrice)
+		require.NotNil(t, item.PromotionID)
+		assert.Equal(t, byItem.ID, *item.PromotionID, "the earliest created promotion must win a tie")
+
+		cup, err := db.GetItemPrice(ctx, nil, "cup")
+		require.NoError(t, err)
+		assert.Equal(t, 18, cup.Price, "category promotions apply to every item of the category")
+		require.NotNil(t, cup.PromotionID)
+		assert.Equal(t, byCategory.ID, *cup.PromotionID)
+
+		socks, err := db.GetItemPrice(ctx, nil, "socks")
+		require.NoError(t, err)
+		assert.Equal(t, 10, socks.Price, "promotions of other categories must not apply")
+	})
+
+	t.Run("Price floor", func(t *testing.T) {
+		createPromotion(t, db, models.Promotion{Item: "pen", DiscountAmount: 500}, -time.Minute, time.Hour)
+
+		pen, err := db.GetItemPrice(ctx, nil, "pen")
+		require.NoError(t, err)
+		assert.Equal(t, 1, pen.Price, "a discount must leave at least one coin to pay")
+	})
+
+	t.Run("Catalog", func(t *testing.T) {
+		catalog, err := db.GetMerchCatalog(ctx)
+		require.NoError(t, err)
+		affordable, err := db.GetCatalogWithAffordability(ctx, buyer.ID)
+		require.NoError(t, err)
+		for i, item := range catalog {
+			switch item.Name {
+			case "umbrella":
+				assert.Equal(t, "accessories", item.Category)
+				assert.Equal(t, 170, item.Price)
+				assert.Equal(t, 200, item.OriginalPrice)
+				assert.Equal(t, 170, affordable[i].Price)
+				assert.Equal(t, 200, affordable[i].OriginalPrice)
+			case "book":
+				assert.Equal(t, 50, item.Price)
+				assert.Zero(t, item.OriginalPrice, "items without a promotion have no original price")
+				assert.Nil(t, item.PromotionID)
+			}
+		}
+
+		lastModified, err := db.GetCatalogLastModified(ctx)
+		require.NoError(t, err)
+		assert.False(t, lastModified.Before(byItem.StartsAt), "the start of a promotion must change the catalog")
+	})
+
+	t.Run("Purchase", func(t *testing.T) {
+		purchase, err := db.BuyItem(ctx, buyer.ID, "umbrella")
+		require.NoError(t, err)
+		assert.Equal(t, 170, purchase.Price)
+		assert.Equal(t, 200, purchase.OriginalPrice)
+		require.NotNil(t, purchase.PromotionID)
+		assert.Equal(t, byItem.ID, *purchase.PromotionID)
+		assert.Equal(t, int64(830), purchase.RemainingCoins)
+
+		report, err := db.CheckInvariants(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, invariantViolations(report, "content.users", int64(buyer.ID)),
+			"purchases must be accounted at the price paid")
+	})
+
+	t.Run("Update and delete", func(t *testing.T) {
+		update := *byItem
+		update.Item = "yacht"
+		_, err := db.UpdatePromotion(ctx, update)
+		assert.ErrorIs(t, err, storage.ErrItemNotFound)
+
+		update.ID = -1
+		update.Item = "umbrella"
+		_, err = db.UpdatePromotion(ctx, update)
+		assert.ErrorIs(t, err, storage.ErrPromotionNotFound)
+
+		assert.ErrorIs(t, db.DeletePromotion(ctx, byItem.ID), storage.ErrPromotionInUse)
+		assert.ErrorIs(t, db.DeletePromotion(ctx, -1), storage.ErrPromotionNotFound)
+
+		unused := models.Promotion{Category: "stationery", DiscountPercent: 5}
+		unused.StartsAt, unused.EndsAt = time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)
+		created, err := db.CreatePromotion(ctx, unused)
+		require.NoError(t, err)
+		require.NoError(t, db.DeletePromotion(ctx, created.ID))
+		_, err = db.GetPromotion(ctx, created.ID)
+		assert.ErrorIs(t, err, storage.ErrPromotionNotFound)
+	})
+}
+
+func testMerchCategories(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	t.Cleanup(func() {
+		_, err := db.SetMerchCategory(ctx, "umbrella", "accessories")
+		require.NoError(t, err)
+	})
+
+	user := createUser(t, db, "categories", 1000)
+	_, err := db.BuyItem(ctx, user.ID, "umbrella")
+	require.NoError(t, err)
+
+	t.Run("Assign", func(t *testing.T) {
+		assignment, err := db.SetMerchCategory(ctx, "umbrella", "rainwear")
+		require.NoError(t, err)
+		assert.Equal(t, &models.MerchCategory{Item: "umbrella", Category: "rainwear"}, assignment)
+
+		catalog, err := db.GetMerchCatalog(ctx)
+		require.NoError(t, err)
+		for _, item := range catalog {
+			if item.Name == "umbrella" {
+				assert.Equal(t, "rainwear", item.Category)
+			}
+		}
+
+		inventory, err := db.GetMerchPurchasesInfo(ctx, nil, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []models.InventoryItem{{Type: "umbrella", Category: "rainwear", Quantity: 1, PendingQuantity: 1}}, inventory)
+	})
+
+	t.Run("Uncategorized", func(t *testing.T) {
+		assignment, err := db.SetMerchCategory(ctx, "umbrella", "")
+		require.NoError(t, err)
+		assert.Equal(t, &models.MerchCategory{Item: "umbrella"}, assignment)
+
+		inventory, err := db.GetMerchPurchasesInfo(ctx, nil, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []models.InventoryItem{{Type: "umbrella", Quantity: 1, PendingQuantity: 1}}, inventory)
+	})
+
+	t.Run("Unknown item", func(t *testing.T) {
+		_, err := db.SetMerchCategory(ctx, "yacht", "boats")
+		assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	})
+}
+
+func testInfoHistoryLimit(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	sender := createUser(t, db, "history_sender", 1000)
+	recipient := createUser(t, db, "history_recipient", 0)
+	var latest int64
+	for i := 0; i < 3; i++ {
+		latest = transferCoins(t, db, sender, recipient, 10)
+	}
+	transferCoins(t, db, recipient, sender, 5)
+
+	sent, received, err := db.CountCoinHistory(ctx, sender.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), sent)
+	assert.Equal(t, int64(1), received)
+
+	t.Run("Truncated", func(t *testing.T) {
+		info, err := db.GetInfoWithHistoryLimit(ctx, sender.ID, 2)
+		require.NoError(t, err)
+		require.Len(t, info.CoinHistory.Sent, 2)
+		assert.Equal(t, latest, info.CoinHistory.Sent[0].ID, "the most recent transfers must be kept")
+		assert.Len(t, info.CoinHistory.Received, 1)
+		assert.True(t, info.Truncated)
+		assert.Equal(t, int64(3), info.TotalSent)
+		assert.Equal(t, int64(1), info.TotalReceived)
+		assert.Equal(t, int64(975), info.Coins)
+	})
+
+	t.Run("Within the limit", func(t *testing.T) {
+		info, err := db.GetInfoWithHistoryLimit(ctx, sender.ID, 3)
+		require.NoError(t, err)
+		assert.Len(t, info.CoinHistory.Sent, 3)
+		assert.False(t, info.Truncated)
+		assert.Equal(t, int64(3), info.TotalSent)
+	})
+}
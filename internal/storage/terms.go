@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	getTermsAcceptanceQuery = `SELECT tos_version, tos_accepted_at FROM content.users WHERE id = $1;`
+	acceptTermsQuery        = `UPDATE content.users SET tos_accepted_at = CASE WHEN tos_version >= $2 THEN tos_accepted_at ELSE $3 END, tos_version = GREATEST(tos_version, $2) WHERE id = $1 RETURNING tos_version, tos_accepted_at;`
+)
+
+// GetTermsAcceptance returns the latest version of the terms of service accepted by the user and when it was accepted.
+// Version is zero and AcceptedAt nil for users who have not accepted any. It returns ErrUserNotFound when the user does not exist.
+func (postgresql *PostgreSQL) GetTermsAcceptance(ctx context.Context, userID int32) (*models.TermsAcceptance, error) {
+	acceptance := &models.TermsAcceptance{}
+	err := postgresql.db.QueryRowContext(ctx, getTermsAcceptanceQuery, userID).Scan(&acceptance.Version, &acceptance.AcceptedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "GetTermsAcceptance", err, zap.String("query", "getTermsAcceptanceQuery"),
+			zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return acceptance, nil
+}
+
+// AcceptTerms records that the user accepted the version of the terms of service at acceptedAt. Accepting a version
+// that is not newer than the accepted one changes nothing, so the time of the first acceptance of a version is kept.
+// It returns the resulting acceptance, or ErrUserNotFound when the user does not exist.
+func (postgresql *PostgreSQL) AcceptTerms(ctx context.Context, userID int32, version int, acceptedAt time.Time) (*models.TermsAcceptance, error) {
+	acceptance := &models.TermsAcceptance{}
+	err := postgresql.db.QueryRowContext(ctx, acceptTermsQuery, userID, version, acceptedAt).Scan(&acceptance.Version, &acceptance.AcceptedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "AcceptTerms", err, zap.String("query", "acceptTermsQuery"), zap.Int32("userID", userID))
+		return nil, err
+	}
+
+	return acceptance, nil
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SessionTimeZone is the time zone of the database sessions opened by NewPostgreSQL and NewPgxPool, whatever the
+// default of the database server. Timestamps are scanned in it as well, so that they are serialized with a Z suffix
+// rather than with the offset of the process or of the server.
+const SessionTimeZone = "UTC"
+
+// configureTimeZone sets the session time zone of the connections opened with config to SessionTimeZone.
+func configureTimeZone(config *pgx.ConnConfig) {
+	config.RuntimeParams["timezone"] = SessionTimeZone
+}
+
+// scanTimestampsInUTC makes conn return the timestamptz values it scans in UTC rather than in the local time zone
+// of the process. It is run after every new connection.
+func scanTimestampsInUTC(ctx context.Context, conn *pgx.Conn) error {
+	conn.TypeMap().RegisterType(&pgtype.Type{
+		Name:  "timestamptz",
+		OID:   pgtype.TimestamptzOID,
+		Codec: &pgtype.TimestamptzCodec{ScanLocation: time.UTC},
+	})
+	return nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const previewTransferQuery = `
+	SELECT s.coins, s.coins - COALESCE((SELECT SUM(h.amount) FROM content.coin_holds h WHERE h.user_id = s.id AND h.status = 'active'), 0),
+		r.id, r.coins
+	FROM content.users s LEFT JOIN content.users r ON r.username = $2
+	WHERE s.id = $1;`
+
+// PreviewTransfer checks the transfer as TransferCoins would and returns the balances of the sender and the recipient
+// after it, without changing anything. It fails with the errors of TransferCoins, in the same order, except that a
+// transfer to oneself fails with ErrSelfTransfer instead of a check violation. The balances are read with a single
+// statement and without locks, so a concurrent operation may still make the transfer itself fail.
+func (postgresql *PostgreSQL) PreviewTransfer(ctx context.Context, userID int32, req models.SendCoinRequest) (*models.TransferPreview, error) {
+	req.ToUser = models.NormalizeUsername(req.ToUser)
+	var senderCoins, available int64
+	var recipientID sql.NullInt32
+	var recipientCoins sql.NullInt64
+	err := postgresql.db.QueryRowContext(ctx, previewTransferQuery, userID, req.ToUser).Scan(&senderCoins, &available, &recipientID, &recipientCoins)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		postgresql.logQueryError(ctx, "PreviewTransfer", err, zap.String("query", "previewTransferQuery"),
+			zap.Int32("userID", userID), zap.String("toUser", req.ToUser), zap.Int("amount", int(req.Amount)))
+		return nil, err
+	}
+
+	amount := int64(req.Amount)
+	switch {
+	case available < amount:
+		return nil, ErrInsufficientFunds
+	case !recipientID.Valid:
+		return nil, ErrRecipientNotFound
+	case recipientID.Int32 == userID:
+		return nil, ErrSelfTransfer
+	case amount > 0 && postgresql.maxCoinBalance > 0 && exceedsBalanceCap(recipientCoins.Int64, amount, postgresql.maxCoinBalance):
+		return nil, ErrBalanceCapExceeded
+	}
+
+	return &models.TransferPreview{
+		ToUser:           req.ToUser,
+		Amount:           int(req.Amount),
+		SenderBalance:    senderCoins - amount,
+		RecipientBalance: recipientCoins.Int64 + amount,
+	}, nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+)
+
+const (
+	lockTransferQuery           = `SELECT ct.from_user_id, fu.username, ct.to_user_id, tu.username, ct.amount, ct.reversed_at IS NOT NULL FROM content.coin_transfers ct JOIN content.users fu ON ct.from_user_id = fu.id JOIN content.users tu ON ct.to_user_id = tu.id WHERE ct.id = $1 FOR UPDATE OF ct;`
+	insertReversalTransferQuery = `INSERT INTO content.coin_transfers (from_user_id, to_user_id, amount, reversal_of, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id;`
+	markTransferReversedQuery   = `UPDATE content.coin_transfers SET reversed_by = $2, reversed_at = $3 WHERE id = $1;`
+	insertTransferReversalQuery = `INSERT INTO content.transfer_reversals (transfer_id, reversal_transfer_id, admin_id, amount, reversed_amount, partial, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+)
+
+// ErrTransferAlreadyReversed indicates that the transfer has already been reversed.
+var ErrTransferAlreadyReversed = errors.New("storage: transfer already reversed")
+
+// ReverseTransfer moves the coins of a mistaken transfer back from its recipient to its sender on behalf of an
+// administrator. In one transaction it records the compensating transfer, linked to the original through reversal_of,
+// marks the original as reversed by the administrator at now, and writes an audit entry to content.transfer_reversals.
+// When the recipient's available balance no longer covers the amount, it fails with ErrInsufficientFunds, or, when
+// partial is set, moves back whatever is available. It returns ErrTransferNotFound for an unknown transfer and
+// ErrTransferAlreadyReversed for a transfer that has already been reversed. Only the amount is moved back: a campaign
+// bonus paid with the transfer stays with the recipient, and the campaign budget keeps it spent. Both users are
+// notified of the adjustment.
+func (postgresql *PostgreSQL) ReverseTransfer(ctx context.Context, adminID int32, transferID int64, partial bool, now time.Time) (*models.TransferReversal, error) {
+	reversal := &models.TransferReversal{TransferID: transferID, ReversedBy: adminID, ReversedAt: now.UTC()}
+
+	err := postgresql.inTransaction(ctx, "ReverseTransfer", func(ctx context.Context) error {
+		q := postgresql.querier(ctx, nil)
+
+		var fromUserID, toUserID int32
+		var reversed bool
+		err := q.QueryRowContext(ctx, lockTransferQuery, transferID).
+			Scan(&fromUserID, &reversal.FromUser, &toUserID, &reversal.ToUser, &reversal.Amount, &reversed)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTransferNotFound
+		}
+		if err != nil {
+			postgresql.logQueryError(ctx, "ReverseTransfer", err, zap.String("query", "lockTransferQuery"),
+				zap.Int32("adminID", adminID), zap.Int64("transferID", transferID))
+			return err
+		}
+		if reversed {
+			return ErrTransferAlreadyReversed
+		}
+
+		var available int64
+		err = q.QueryRowContext(ctx, lockAvailableCoinsQuery, toUserID).Scan(&available)
+		if err != nil {
+			postgresql.logQueryError(ctx, "ReverseTransfer", err, zap.String("query", "lockAvailableCoinsQuery"),
+				zap.Int32("adminID", adminID), zap.Int64("transferID", transferID))
+			return err
+		}
+
+		reversal.ReversedAmount = reversal.Amount
+		if available < int64(reversal.Amount) {
+			if !partial || available <= 0 {
+				return ErrInsufficientFunds
+			}
+			reversal.ReversedAmount = int(available)
+		}
+		reversal.Partial = reversal.ReversedAmount < reversal.Amount
+
+		if err = postgresql.checkDeadline(ctx); err != nil {
+			return err
+		}
+
+		if err = postgresql.UpdateUserCoins(ctx, nil, toUserID, -int64(reversal.ReversedAmount)); err != nil {
+			return err
+		}
+		if err = postgresql.UpdateUserCoins(ctx, nil, fromUserID, int64(reversal.ReversedAmount)); err != nil {
+			return err
+		}
+
+		if err = postgresql.checkDeadline(ctx); err != nil {
+			return err
+		}
+
+		err = q.QueryRowContext(ctx, insertReversalTransferQuery, toUserID, fromUserID, reversal.ReversedAmount, transferID, reversal.ReversedAt).
+			Scan(&reversal.ReversalTransferID)
+		if err != nil {
+			postgresql.logQueryError(ctx, "ReverseTransfer", err, zap.String("query", "insertReversalTransferQuery"),
+				zap.Int32("adminID", adminID), zap.Int64("transferID", transferID))
+			return err
+		}
+
+		if _, err = q.ExecContext(ctx, markTransferReversedQuery, transferID, adminID, reversal.ReversedAt); err != nil {
+			postgresql.logQueryError(ctx, "ReverseTransfer", err, zap.String("query", "markTransferReversedQuery"),
+				zap.Int32("adminID", adminID), zap.Int64("transferID", transferID))
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, insertTransferReversalQuery, transferID, reversal.ReversalTransferID, adminID,
+			reversal.Amount, reversal.ReversedAmount, reversal.Partial, reversal.ReversedAt)
+		if err != nil {
+			postgresql.logQueryError(ctx, "ReverseTransfer", err, zap.String("query", "insertTransferReversalQuery"),
+				zap.Int32("adminID", adminID), zap.Int64("transferID", transferID))
+			return err
+		}
+
+		err = postgresql.notify(ctx, nil, notification{UserID: toUserID, Category: NotificationAdminAdjustment,
+			ActorID: fromUserID, Amount: -reversal.ReversedAmount})
+		if err != nil {
+			return err
+		}
+		return postgresql.notify(ctx, nil, notification{UserID: fromUserID, Category: NotificationAdminAdjustment,
+			ActorID: toUserID, Amount: reversal.ReversedAmount})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reversal, nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Result summarizes an executed statement.
+type Result interface {
+	RowsAffected() (int64, error)
+}
+
+// Rows is the result of a query that returns multiple rows.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+// Row is the result of a query that is expected to return at most one row.
+// Scan returns sql.ErrNoRows when the query selected no rows, regardless of the driver.
+type Row interface {
+	Scan(dest ...any) error
+}
+
+// Querier executes queries against a connection pool or within a transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) Row
+}
+
+// Tx is a database transaction used by the transaction-scoped storage methods.
+// It hides the differences between the database/sql and the native pgx drivers.
+type Tx interface {
+	Querier
+	Commit() error
+	Rollback() error
+}
+
+// Conn is a single connection taken out of the pool, for session state such as advisory locks that must outlive
+// a transaction. It must not be used concurrently.
+type Conn interface {
+	Querier
+	// Release returns the connection to the pool, or closes it when discard is set, ending its session.
+	Release(discard bool)
+}
+
+// database is a connection pool able to run queries and start transactions.
+type database interface {
+	Querier
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+	Conn(ctx context.Context) (Conn, error)
+	PingContext(ctx context.Context) error
+	Close()
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+)
+
+// txContextKey is the context key under which WithinTransaction stores the current transaction.
+type txContextKey struct{}
+
+// dryRunContextKey is the context key marking operations whose transactions must not be committed.
+type dryRunContextKey struct{}
+
+// WithDryRun returns a context under which transactions started by WithinTransaction, and by the storage
+// methods built on it, run every statement and are then rolled back instead of committed. Errors are
+// returned exactly as by a real call, so a dry run tells whether the operation would succeed.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunContextKey{}, true)
+}
+
+// IsDryRun reports whether ctx was marked by WithDryRun.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunContextKey{}).(bool)
+	return dryRun
+}
+
+// WithinTransaction runs fn within a transaction that is committed when fn returns nil and rolled back otherwise.
+// The transaction is stored in the context passed to fn: storage methods called with that context and a nil Tx
+// run within it. A nested call joins the transaction of the outer one instead of starting a new transaction,
+// so an error anywhere rolls back the whole outermost transaction. Transactions aborted by a serialization
+// failure or a deadlock are retried from the beginning, which reruns fn. Under WithDryRun the transaction
+// is rolled back even when fn succeeds.
+func (postgresql *PostgreSQL) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return postgresql.inTransaction(ctx, "WithinTransaction", fn)
+}
+
+// inTransaction implements WithinTransaction, naming the operation in retry logs.
+func (postgresql *PostgreSQL) inTransaction(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	return postgresql.withRetry(ctx, operation, func() error {
+		tx, err := postgresql.db.BeginTx(ctx, postgresql.balanceTxOptions())
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err = fn(context.WithValue(ctx, txContextKey{}, tx)); err != nil {
+			return err
+		}
+		if IsDryRun(ctx) {
+			return nil
+		}
+
+		return tx.Commit()
+	})
+}
+
+// txFromContext returns the transaction started by WithinTransaction, if any.
+func txFromContext(ctx context.Context) (Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(Tx)
+	return tx, ok
+}
+
+// querier returns where a transaction-scoped method runs its queries: the explicitly passed tx,
+// otherwise the transaction stored in ctx by WithinTransaction, otherwise the connection pool.
+func (postgresql *PostgreSQL) querier(ctx context.Context, tx Tx) Querier {
+	if tx != nil {
+		return tx
+	}
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	return postgresql.db
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+)
+
+// fakeDatabase records the statements executed on the pool and within transactions.
+type fakeDatabase struct {
+	events []string
+}
+
+func (d *fakeDatabase) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	d.events = append(d.events, "pool: "+query)
+	return nil, nil
+}
+
+func (d *fakeDatabase) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (d *fakeDatabase) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return nil
+}
+
+func (d *fakeDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	d.events = append(d.events, "begin")
+	return &fakeTx{db: d}, nil
+}
+
+func (d *fakeDatabase) Conn(ctx context.Context) (Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (d *fakeDatabase) PingContext(ctx context.Context) error {
+	return nil
+}
+
+func (d *fakeDatabase) Close() {}
+
+// fakeTx records its statements and outcome in the owning fakeDatabase.
+type fakeTx struct {
+	db   *fakeDatabase
+	done bool
+}
+
+func (tx *fakeTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	tx.db.events = append(tx.db.events, "tx: "+query)
+	return nil, nil
+}
+
+func (tx *fakeTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (tx *fakeTx) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return nil
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.done = true
+	tx.db.events = append(tx.db.events, "commit")
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	tx.db.events = append(tx.db.events, "rollback")
+	return nil
+}
+
+func newFakePostgreSQL() (*PostgreSQL, *fakeDatabase) {
+	db := &fakeDatabase{}
+	return &PostgreSQL{db: db, log: &logger.Logger{Logger: zap.NewNop()}, balanceIsolation: sql.LevelReadCommitted}, db
+}
+
+func TestWithinTransaction(t *testing.T) {
+	errCallback := errors.New("callback failed")
+	exec := func(postgresql *PostgreSQL, ctx context.Context, query string) {
+		_, err := postgresql.querier(ctx, nil).ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+
+	t.Run("Commit on success", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+
+		err := postgresql.WithinTransaction(context.Background(), func(ctx context.Context) error {
+			exec(postgresql, ctx, "first")
+			exec(postgresql, ctx, "second")
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"begin", "tx: first", "tx: second", "commit"}, db.events)
+	})
+
+	t.Run("Rollback on callback error", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+
+		err := postgresql.WithinTransaction(context.Background(), func(ctx context.Context) error {
+			exec(postgresql, ctx, "first")
+			return errCallback
+		})
+
+		assert.ErrorIs(t, err, errCallback)
+		assert.Equal(t, []string{"begin", "tx: first", "rollback"}, db.events)
+	})
+
+	t.Run("Nested call joins the outer transaction", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+
+		err := postgresql.WithinTransaction(context.Background(), func(ctx context.Context) error {
+			exec(postgresql, ctx, "outer")
+			return postgresql.WithinTransaction(ctx, func(ctx context.Context) error {
+				exec(postgresql, ctx, "inner")
+				return nil
+			})
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"begin", "tx: outer", "tx: inner", "commit"}, db.events)
+	})
+
+	t.Run("Nested error rolls back the outer transaction", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+
+		err := postgresql.WithinTransaction(context.Background(), func(ctx context.Context) error {
+			exec(postgresql, ctx, "outer")
+			return postgresql.WithinTransaction(ctx, func(ctx context.Context) error {
+				exec(postgresql, ctx, "inner")
+				return errCallback
+			})
+		})
+
+		assert.ErrorIs(t, err, errCallback)
+		assert.Equal(t, []string{"begin", "tx: outer", "tx: inner", "rollback"}, db.events)
+	})
+
+	t.Run("Dry run rolls back on success", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+
+		err := postgresql.WithinTransaction(WithDryRun(context.Background()), func(ctx context.Context) error {
+			exec(postgresql, ctx, "first")
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"begin", "tx: first", "rollback"}, db.events)
+	})
+
+	t.Run("Dry run returns the callback error", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+
+		err := postgresql.WithinTransaction(WithDryRun(context.Background()), func(ctx context.Context) error {
+			exec(postgresql, ctx, "first")
+			return errCallback
+		})
+
+		assert.ErrorIs(t, err, errCallback)
+		assert.Equal(t, []string{"begin", "tx: first", "rollback"}, db.events)
+	})
+
+	t.Run("Pool outside of a transaction", func(t *testing.T) {
+		postgresql, db := newFakePostgreSQL()
+
+		exec(postgresql, context.Background(), "standalone")
+
+		assert.Equal(t, []string{"pool: standalone"}, db.events)
+	})
+}
+
+func TestWithinTransaction_BalanceOperations(t *testing.T) {
+	errCallback := errors.New("callback failed")
+	oneRow := func(string, []any) int64 { return 1 }
+	operations := []struct {
+		name  string
+		query string
+		run   func(postgresql *PostgreSQL, ctx context.Context) error
+	}{
+		{name: "GiftItem", query: giftItemQuery, run: func(postgresql *PostgreSQL, ctx context.Context) error {
+			return postgresql.GiftItem(ctx, 1, "pen", models.GiftRequest{ToUser: "user"})
+		}},
+		{name: "CreateHold", query: createHoldQuery, run: func(postgresql *PostgreSQL, ctx context.Context) error {
+			_, err := postgresql.CreateHold(ctx, 1, 1, "auction")
+			return err
+		}},
+		{name: "CaptureHold", query: captureHoldQuery, run: func(postgresql *PostgreSQL, ctx context.Context) error {
+			_, err := postgresql.CaptureHold(ctx, 1)
+			return err
+		}},
+	}
+
+	for _, operation := range operations {
+		t.Run(operation.name+" rolls back with the outer transaction", func(t *testing.T) {
+			postgresql, db := newScriptedPostgreSQL(nil, oneRow)
+
+			err := postgresql.WithinTransaction(context.Background(), func(ctx context.Context) error {
+				require.NoError(t, operation.run(postgresql, ctx))
+				return errCallback
+			})
+
+			assert.ErrorIs(t, err, errCallback)
+			assert.Contains(t, db.events, "tx: "+operation.query)
+			assert.Equal(t, "begin", db.events[0])
+			assert.NotContains(t, db.events[1:], "begin", "the operation must join the outer transaction")
+			assert.NotContains(t, db.events, "commit")
+			assert.Equal(t, "rollback", db.events[len(db.events)-1])
+		})
+
+		t.Run(operation.name+" dry run", func(t *testing.T) {
+			postgresql, db := newScriptedPostgreSQL(nil, oneRow)
+
+			require.NoError(t, operation.run(postgresql, WithDryRun(context.Background())))
+			assert.Contains(t, db.events, "tx: "+operation.query)
+			assert.NotContains(t, db.events, "commit")
+			assert.Equal(t, "rollback", db.events[len(db.events)-1])
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"merch_store/internal/pkg/metrics"
+	"merch_store/internal/storage/pgerr"
+)
+
+// ErrStorageUnavailable indicates that the database could not be reached or the connection to it was lost
+// mid-operation, for example while PostgreSQL restarts. Such failures are transient, unlike errors reported
+// by the database about the statement itself, so the operation can be retried once the database is back.
+// The driver adapters wrap connection errors with it, keeping the original error in the chain.
+var ErrStorageUnavailable = errors.New("storage: database unavailable")
+
+// classifyError wraps err with ErrStorageUnavailable and counts it in metrics.StorageUnavailable
+// when it is a connection error (see pgerr.IsConnectionError). Other errors are returned as they are.
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, ErrStorageUnavailable) || !pgerr.IsConnectionError(err) {
+		return err
+	}
+
+	metrics.StorageUnavailable.Inc()
+	return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+}
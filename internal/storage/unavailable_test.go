@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+
+	"merch_store/internal/pkg/metrics"
+)
+
+// failingRow is a pgx.Row whose Scan fails with err.
+type failingRow struct {
+	err error
+}
+
+func (row failingRow) Scan(dest ...any) error {
+	return row.err
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{name: "connection reset", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, unavailable: true},
+		{name: "connection refused", err: &pgconn.ConnectError{}, unavailable: true},
+		{name: "unexpected EOF", err: fmt.Errorf("receive message: %w", io.ErrUnexpectedEOF), unavailable: true},
+		{name: "bad connection", err: driver.ErrBadConn, unavailable: true},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: pgerrcode.AdminShutdown}, unavailable: true},
+		{name: "check violation", err: &pgconn.PgError{Code: pgerrcode.CheckViolation, ConstraintName: "users_coins_check"}},
+		{name: "no rows", err: pgx.ErrNoRows},
+		{name: "deadline exceeded", err: context.DeadlineExceeded},
+		{name: "logic error", err: ErrInsufficientFunds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := metrics.StorageUnavailable.Value()
+			err := pgxRow{row: failingRow{err: tt.err}}.Scan()
+
+			assert.Equal(t, tt.unavailable, errors.Is(err, ErrStorageUnavailable))
+			if tt.unavailable {
+				assert.ErrorIs(t, err, tt.err, "the original error must stay in the chain")
+				assert.Equal(t, before+1, metrics.StorageUnavailable.Value())
+			} else {
+				assert.Equal(t, before, metrics.StorageUnavailable.Value())
+			}
+		})
+	}
+
+	t.Run("Already classified", func(t *testing.T) {
+		err := classifyError(driver.ErrBadConn)
+		before := metrics.StorageUnavailable.Value()
+		assert.Equal(t, err, classifyError(err), "an error must be wrapped and counted once")
+		assert.Equal(t, before, metrics.StorageUnavailable.Value())
+	})
+
+	t.Run("No rows stays detectable", func(t *testing.T) {
+		assert.ErrorIs(t, pgxRow{row: failingRow{err: pgx.ErrNoRows}}.Scan(), sql.ErrNoRows)
+		assert.NoError(t, classifyError(nil))
+	})
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+)
+
+// scriptedDatabase is a fakeDatabase whose transactions answer single-row queries like slowRow, except for the
+// queries listed in noRows, and report the number of rows affected by each statement as returned by affected.
+type scriptedDatabase struct {
+	*fakeDatabase
+	noRows   map[string]bool
+	affected func(query string, args []any) int64
+}
+
+func (d *scriptedDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	d.events = append(d.events, "begin")
+	return &scriptedTx{fakeTx: fakeTx{db: d.fakeDatabase}, script: d}, nil
+}
+
+// scriptedTx records its statements and answers them as scripted by its scriptedDatabase.
+type scriptedTx struct {
+	fakeTx
+	script *scriptedDatabase
+}
+
+func (tx *scriptedTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	tx.db.events = append(tx.db.events, "tx: "+query)
+	return affectedResult(tx.script.affected(query, args)), nil
+}
+
+func (tx *scriptedTx) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	tx.db.events = append(tx.db.events, "tx: "+query)
+	if tx.script.noRows[query] {
+		return noRow{}
+	}
+	return slowRow{}
+}
+
+// affectedResult is a Result reporting a fixed number of affected rows.
+type affectedResult int64
+
+func (result affectedResult) RowsAffected() (int64, error) {
+	return int64(result), nil
+}
+
+// noRow is a Row of a query that selected no rows.
+type noRow struct{}
+
+func (noRow) Scan(dest ...any) error {
+	return sql.ErrNoRows
+}
+
+func newScriptedPostgreSQL(noRows []string, affected func(query string, args []any) int64) (*PostgreSQL, *fakeDatabase) {
+	postgresql, db := newFakePostgreSQL()
+	script := &scriptedDatabase{fakeDatabase: db, noRows: map[string]bool{}, affected: affected}
+	for _, query := range noRows {
+		script.noRows[query] = true
+	}
+	postgresql.db = script
+	return postgresql, db
+}
+
+// noCoinsUpdated reports zero rows affected for balance updates matching debit, and one row for every other statement.
+func noCoinsUpdated(debit bool) func(query string, args []any) int64 {
+	return func(query string, args []any) int64 {
+		if query == updateUserCoinsQuery && (args[0].(int64) < 0) == debit {
+			return 0
+		}
+		return 1
+	}
+}
+
+func TestUpdateUserCoins_ZeroRows(t *testing.T) {
+	t.Run("BuyItem", func(t *testing.T) {
+		postgresql, db := newScriptedPostgreSQL([]string{spendUserCoinsQuery}, noCoinsUpdated(true))
+
+		_, err := postgresql.BuyItem(context.Background(), 1, "pen")
+		require.ErrorIs(t, err, ErrUserNotFound)
+		assert.NotContains(t, db.events, "tx: "+buyItemQuery, "no purchase may be recorded for a missing buyer")
+		assert.Equal(t, "rollback", db.events[len(db.events)-1])
+	})
+
+	t.Run("GiftItem from a missing buyer", func(t *testing.T) {
+		postgresql, db := newScriptedPostgreSQL(nil, noCoinsUpdated(true))
+
+		err := postgresql.GiftItem(context.Background(), 1, "pen", models.GiftRequest{ToUser: "user"})
+		require.ErrorIs(t, err, ErrUserNotFound)
+		assert.NotContains(t, db.events, "tx: "+giftItemQuery, "no gift may be recorded for a missing buyer")
+		assert.Equal(t, "rollback", db.events[len(db.events)-1])
+	})
+
+	t.Run("TransferCoins from a missing sender", func(t *testing.T) {
+		postgresql, db := newScriptedPostgreSQL([]string{spendUserCoinsQuery}, noCoinsUpdated(true))
+
+		_, err := postgresql.TransferCoins(context.Background(), 1, models.SendCoinRequest{ToUser: "user", Amount: 1})
+		require.ErrorIs(t, err, ErrUserNotFound)
+		assert.NotContains(t, db.events, "tx: "+transferCoinsQuery)
+		assert.Equal(t, "rollback", db.events[len(db.events)-1])
+	})
+
+	t.Run("TransferCoins to a missing recipient", func(t *testing.T) {
+		postgresql, db := newScriptedPostgreSQL(nil, noCoinsUpdated(false))
+
+		_, err := postgresql.TransferCoins(context.Background(), 1, models.SendCoinRequest{ToUser: "user", Amount: 1})
+		require.ErrorIs(t, err, ErrRecipientNotFound)
+		assert.NotContains(t, db.events, "tx: "+transferCoinsQuery, "the debit of the sender must not be committed alone")
+		assert.Equal(t, "rollback", db.events[len(db.events)-1])
+	})
+
+	t.Run("TransferCoins to an unknown recipient", func(t *testing.T) {
+		postgresql, db := newScriptedPostgreSQL([]string{getUserIDQuery}, func(string, []any) int64 { return 1 })
+
+		_, err := postgresql.TransferCoins(context.Background(), 1, models.SendCoinRequest{ToUser: "ghost", Amount: 1})
+		require.ErrorIs(t, err, ErrRecipientNotFound)
+		assert.Equal(t, "rollback", db.events[len(db.events)-1])
+	})
+}
@@ -0,0 +1,114 @@
+'use strict';
+
+// The token is kept in memory only, so reloading the page logs the user out.
+let token = '';
+
+const $ = (id) => document.getElementById(id);
+
+function showStatus(message, isError) {
+  $('status').textContent = message;
+  $('status').className = isError ? 'error' : '';
+}
+
+async function api(method, path, body) {
+  const headers = {};
+  if (token) {
+    headers.Authorization = 'Bearer ' + token;
+  }
+  if (body !== undefined) {
+    headers['Content-Type'] = 'application/json';
+  }
+
+  const response = await fetch('/api' + path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const text = await response.text();
+  const data = text ? JSON.parse(text) : null;
+  if (!response.ok) {
+    const message = data && data.errors ? data.errors : response.statusText;
+    throw new Error(response.status + ': ' + message);
+  }
+  return data;
+}
+
+function setLoggedIn(loggedIn) {
+  $('login').hidden = loggedIn;
+  $('account').hidden = !loggedIn;
+}
+
+async function loadInfo() {
+  const info = await api('GET', '/info');
+  $('info').textContent = JSON.stringify(info, null, 2);
+}
+
+async function loadCatalog() {
+  const items = await api('GET', '/merch');
+  const rows = items.map((item) => {
+    const row = document.createElement('tr');
+    const name = document.createElement('td');
+    name.textContent = item.name;
+    const price = document.createElement('td');
+    price.textContent = item.price;
+    const buy = document.createElement('button');
+    buy.type = 'button';
+    buy.textContent = 'Buy';
+    buy.addEventListener('click', () => run(async () => {
+      await api('GET', '/buy/' + encodeURIComponent(item.name));
+      await loadInfo();
+      return 'Bought ' + item.name;
+    }));
+    const action = document.createElement('td');
+    action.append(buy);
+    row.append(name, price, action);
+    return row;
+  });
+  $('catalog').replaceChildren(...rows);
+}
+
+// run performs an action, reporting its result or failure in the status line.
+async function run(action) {
+  try {
+    showStatus(await action() || '', false);
+  } catch (error) {
+    showStatus(error.message, true);
+  }
+}
+
+$('login-form').addEventListener('submit', (event) => {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  run(async () => {
+    const response = await api('POST', '/auth', {
+      username: form.get('username'),
+      password: form.get('password'),
+    });
+    token = response.token;
+    setLoggedIn(true);
+    await Promise.all([loadInfo(), loadCatalog()]);
+    return 'Logged in as ' + form.get('username');
+  });
+});
+
+$('logout').addEventListener('click', () => {
+  token = '';
+  $('info').textContent = '';
+  setLoggedIn(false);
+  showStatus('Logged out', false);
+});
+
+$('refresh-info').addEventListener('click', () => run(loadInfo));
+
+$('send-form').addEventListener('submit', (event) => {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  run(async () => {
+    await api('POST', '/sendCoin', {
+      toUser: form.get('toUser'),
+      amount: Number(form.get('amount')),
+    });
+    await loadInfo();
+    return 'Sent ' + form.get('amount') + ' coins to ' + form.get('toUser');
+  });
+});
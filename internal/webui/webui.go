@@ -0,0 +1,27 @@
+//go:build !noui
+
+// Package webui embeds a minimal single-page frontend for exercising the API by hand.
+// It is meant for QA and local development: it can log in, show the info response, buy an item
+// from the catalog, and send coins. The token is kept in page memory only.
+//
+// Building with the noui tag leaves the frontend out of the binary.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler returns the handler serving the frontend files from the root path,
+// or nil when the binary was built with the noui tag.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(files))
+}
@@ -0,0 +1,12 @@
+//go:build noui
+
+// Package webui embeds a minimal single-page frontend for exercising the API by hand.
+// This binary was built with the noui tag, so the frontend is left out.
+package webui
+
+import "net/http"
+
+// Handler returns nil, as the binary was built with the noui tag.
+func Handler() http.Handler {
+	return nil
+}
@@ -0,0 +1,120 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// archiveBoundary is the archive cutoff of TestArchiveTransfers. It lies far before any transfer made by the other
+// tests sharing the database, so that only the transfers backdated by the test are old enough to be archived.
+var archiveBoundary = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestArchiveTransfers backdates the transfers of fresh users around archiveBoundary and checks that archiving moves
+// exactly the older ones, except reversed ones, that a repeated run moves nothing, that the history hides them unless
+// requested, and that the balances still agree with the ledger.
+func TestArchiveTransfers(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db := openStorage(t, driver)
+			defer db.Close()
+
+			conn, err := sql.Open("pgx", testDatabaseURI)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			ctx := context.Background()
+			suffix := time.Now().UnixNano()
+			sender, err := db.CreateUser(ctx, &models.User{Username: fmt.Sprintf("archive_sender_%d", suffix), Password: "password", Coins: 1000})
+			require.NoError(t, err)
+			recipient, err := db.CreateUser(ctx, &models.User{Username: fmt.Sprintf("archive_recipient_%d", suffix), Password: "password", Coins: 0})
+			require.NoError(t, err)
+
+			transfer := func(createdAt time.Time) int64 {
+				transfer, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 10})
+				require.NoError(t, err)
+				_, err = conn.ExecContext(ctx, `UPDATE content.coin_transfers SET created_at = $2 WHERE id = $1;`, transfer.TransferID, createdAt)
+				require.NoError(t, err)
+				return transfer.TransferID
+			}
+			older := transfer(archiveBoundary.Add(-time.Second))
+			atBoundary := transfer(archiveBoundary)
+			newer := transfer(archiveBoundary.Add(time.Second))
+			reversed := transfer(archiveBoundary.Add(-time.Hour))
+			reversal, err := db.ReverseTransfer(ctx, sender.ID, reversed, false, archiveBoundary.Add(-time.Minute))
+			require.NoError(t, err)
+			recent := transfer(time.Now())
+
+			moved, err := db.ArchiveTransfers(ctx, archiveBoundary, 1000)
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, moved, int64(1))
+			moved, err = db.ArchiveTransfers(ctx, archiveBoundary, 1000)
+			require.NoError(t, err)
+			assert.Zero(t, moved, "a repeated run must not move anything")
+
+			archived := func(id int64) bool {
+				var inHot, inArchive bool
+				require.NoError(t, conn.QueryRowContext(ctx,
+					`SELECT EXISTS (SELECT 1 FROM content.coin_transfers WHERE id = $1), EXISTS (SELECT 1 FROM content.coin_transfers_archive WHERE id = $1);`, id).
+					Scan(&inHot, &inArchive))
+				require.NotEqual(t, inHot, inArchive, "transfer %d must be in exactly one table", id)
+				return inArchive
+			}
+			assert.True(t, archived(older), "a transfer older than the cutoff must be archived")
+			assert.False(t, archived(atBoundary), "a transfer made at the cutoff must stay")
+			assert.False(t, archived(newer))
+			assert.False(t, archived(recent))
+			assert.False(t, archived(reversed), "a reversed transfer must stay")
+			assert.False(t, archived(reversal.ReversalTransferID), "a reversal must stay")
+
+			ids := func(transfers []models.Transfer) []int64 {
+				result := make([]int64, 0, len(transfers))
+				for _, transfer := range transfers {
+					result = append(result, transfer.ID)
+				}
+				return result
+			}
+			hot, err := db.GetTransfers(ctx, sender.ID, models.TransfersFilter{Direction: storage.TransferDirectionSent, Limit: 10})
+			require.NoError(t, err)
+			assert.Equal(t, []int64{recent, newer, atBoundary, reversed}, ids(hot))
+			all, err := db.GetTransfers(ctx, sender.ID, models.TransfersFilter{Direction: storage.TransferDirectionSent, Limit: 10, IncludeArchived: true})
+			require.NoError(t, err)
+			assert.Equal(t, []int64{recent, newer, atBoundary, older, reversed}, ids(all))
+			page, err := db.GetTransfers(ctx, sender.ID, models.TransfersFilter{
+				Direction: storage.TransferDirectionSent, Limit: 10, IncludeArchived: true,
+				After: &models.PageCursor{CreatedAt: archiveBoundary, ID: atBoundary},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []int64{older, reversed}, ids(page), "pages must continue from the recent transfers into the archive")
+
+			archivedTransfer, err := db.GetTransfer(ctx, recipient.ID, older)
+			require.NoError(t, err)
+			assert.Equal(t, 10, archivedTransfer.Amount)
+
+			info, err := db.GetInfo(ctx, sender.ID)
+			require.NoError(t, err)
+			for _, detail := range info.CoinHistory.Sent {
+				assert.NotEqual(t, older, detail.ID, "the history must not read the archive")
+			}
+
+			report, err := db.CheckInvariants(ctx)
+			require.NoError(t, err)
+			for _, violation := range report.Violations {
+				if violation.Table == "content.users" {
+					assert.NotContains(t, []int64{int64(sender.ID), int64(recipient.ID)}, violation.RowID,
+						"archived transfers must still count in the ledger: %+v", violation)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// TestCampaignBudgetCannotBeOverspent races transfers for the bonus of a gifting campaign whose budget covers only
+// half of them. Whatever the interleaving, exactly the bonuses the budget covers must be paid, the other transfers
+// must fall back to no bonus instead of failing, and the balances must agree with the recorded transfers.
+func TestCampaignBudgetCannotBeOverspent(t *testing.T) {
+	levels := map[string]sql.IsolationLevel{
+		"read_committed": sql.LevelReadCommitted,
+		"serializable":   sql.LevelSerializable,
+	}
+
+	for name, level := range levels {
+		t.Run(name, func(t *testing.T) {
+			db := openStorage(t, storage.DriverSQL)
+			defer db.Close()
+			db.SetBalanceIsolation(level)
+
+			const (
+				workers = 10
+				amount  = 50
+				budget  = workers / 2 * amount
+			)
+
+			ctx := context.Background()
+			suffix := fmt.Sprintf("%s_%d", name, time.Now().UnixNano())
+			now := time.Now().UTC().Truncate(time.Second)
+			campaign, err := db.CreateCampaign(ctx, models.Campaign{
+				Name: "campaign_race_" + suffix, Multiplier: 2, Budget: budget, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour),
+			})
+			require.NoError(t, err)
+			defer func() {
+				campaign.StartsAt, campaign.EndsAt = now.Add(-2*time.Hour), now.Add(-time.Hour)
+				_, err := db.UpdateCampaign(ctx, *campaign)
+				assert.NoError(t, err)
+			}()
+
+			recipient, err := db.CreateUser(ctx, &models.User{Username: "campaign_recipient_" + suffix, Password: "password", Coins: 0})
+			require.NoError(t, err)
+			senders := make([]*models.User, workers)
+			for i := range senders {
+				senders[i], err = db.CreateUser(ctx, &models.User{Username: fmt.Sprintf("campaign_sender_%s_%d", suffix, i), Password: "password", Coins: amount})
+				require.NoError(t, err)
+			}
+
+			transfers := make([]*models.TransferResult, workers)
+			errs := make([]error, workers)
+			var wg sync.WaitGroup
+			for i := range senders {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					transfers[i], errs[i] = db.TransferCoins(ctx, senders[i].ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: amount})
+				}(i)
+			}
+			wg.Wait()
+
+			var bonuses int64
+			var paid int
+			for i := range senders {
+				require.NoError(t, errs[i], "a transfer must fall back to no bonus rather than fail")
+				transfer, err := db.GetTransfer(ctx, recipient.ID, transfers[i].TransferID)
+				require.NoError(t, err)
+				if transfer.Bonus > 0 {
+					assert.Equal(t, int64(amount), transfer.Bonus)
+					paid++
+				}
+				bonuses += transfer.Bonus
+			}
+			assert.Equal(t, workers/2, paid)
+			assert.Equal(t, int64(budget), bonuses)
+
+			got, err := db.GetCampaign(ctx, campaign.ID)
+			require.NoError(t, err)
+			assert.Zero(t, got.RemainingBudget)
+
+			info, err := db.GetInfo(ctx, recipient.ID)
+			require.NoError(t, err)
+			assert.Equal(t, int64(workers*amount+budget), info.Coins)
+
+			report, err := db.CheckInvariants(ctx)
+			require.NoError(t, err)
+			for _, violation := range report.Violations {
+				assert.False(t, violation.Table == "content.gifting_campaigns" && violation.RowID == campaign.ID, "campaign %+v", violation)
+				assert.False(t, violation.Table == "content.users" && violation.RowID == int64(recipient.ID), "recipient %+v", violation)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// TestFailedPurchasesAreRecorded checks that purchases failing for lack of funds or an unknown item
+// are written to content.failed_purchases by the background recorder and show up in the statistics.
+func TestFailedPurchasesAreRecorded(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db := openStorage(t, driver)
+			defer db.Close()
+
+			l := &logger.Logger{Logger: zap.NewNop()}
+			recorder := app.NewFailedPurchaseRecorder(db, 10, l)
+			appInstance := app.NewApp(db, l)
+			appInstance.SetFailedPurchaseRecorder(recorder)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go recorder.Run(ctx)
+
+			itemName := fmt.Sprintf("missing_item_%s_%d", driver, time.Now().UnixNano())
+			user, err := db.CreateUser(ctx, &models.User{Username: "failed_buyer_" + itemName, Password: "password", Coins: 10})
+			require.NoError(t, err)
+
+			_, err = appInstance.ProcessBuy(ctx, user.ID, "pink-hoody")
+			require.ErrorIs(t, err, storage.ErrInsufficientFunds)
+			_, err = appInstance.ProcessBuy(ctx, user.ID, itemName)
+			require.ErrorIs(t, err, storage.ErrItemNotFound)
+
+			today := time.Now().UTC().Format("2006-01-02")
+			var stats *models.FailedPurchaseStatsResponse
+			require.Eventually(t, func() bool {
+				stats, err = appInstance.ProcessFailedPurchaseStats(ctx, today, today)
+				return err == nil && containsStat(stats.Stats, itemName, storage.FailedPurchaseReasonItemNotFound)
+			}, 5*time.Second, 50*time.Millisecond)
+
+			assert.Contains(t, stats.Stats, models.FailedPurchaseStat{Item: itemName, Reason: storage.FailedPurchaseReasonItemNotFound, Count: 1})
+			assert.True(t, containsStat(stats.Stats, "pink-hoody", storage.FailedPurchaseReasonInsufficientFunds))
+		})
+	}
+}
+
+// containsStat reports whether stats include a non-zero count for the item and reason.
+func containsStat(stats []models.FailedPurchaseStat, item string, reason string) bool {
+	for _, stat := range stats {
+		if stat.Item == item && stat.Reason == reason && stat.Count > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// TestHoldAndPurchaseCannotOverspend races holds against purchases of the same user.
+// The balance covers only one of them at a time, so the coins spent plus the coins held
+// must never exceed the initial balance, whatever the interleaving.
+func TestHoldAndPurchaseCannotOverspend(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db := openStorage(t, driver)
+			defer db.Close()
+
+			ctx := context.Background()
+			const rounds = 20
+			for round := 0; round < rounds; round++ {
+				user, err := db.CreateUser(ctx, &models.User{Username: fmt.Sprintf("hold_race_%s_%d_%d", driver, time.Now().UnixNano(), round), Password: "password", Coins: 300})
+				require.NoError(t, err)
+
+				var (
+					wg      sync.WaitGroup
+					holdErr error
+					hold    *models.CoinHold
+					buyErr  error
+				)
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					hold, holdErr = db.CreateHold(ctx, user.ID, 200, "race")
+				}()
+				go func() {
+					defer wg.Done()
+					_, buyErr = db.BuyItem(ctx, user.ID, "hoody")
+				}()
+				wg.Wait()
+
+				if holdErr != nil {
+					require.ErrorIs(t, holdErr, storage.ErrInsufficientFunds)
+				}
+				if buyErr != nil {
+					require.True(t, errors.Is(buyErr, storage.ErrInsufficientFunds), "unexpected purchase error: %s", buyErr)
+				}
+				assert.False(t, holdErr == nil && buyErr == nil, "both the hold and the purchase succeeded")
+				assert.False(t, holdErr != nil && buyErr != nil, "one of the operations must succeed")
+
+				info, err := db.GetInfo(ctx, user.ID)
+				require.NoError(t, err)
+				assert.GreaterOrEqual(t, info.AvailableCoins, int64(0))
+				if hold != nil {
+					assert.Equal(t, int64(300), info.Coins)
+					assert.Equal(t, int64(100), info.AvailableCoins)
+				} else {
+					assert.Equal(t, int64(0), info.Coins)
+				}
+			}
+		})
+	}
+}
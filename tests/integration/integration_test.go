@@ -1,18 +1,22 @@
+//go:build integration
+
 package integrations
 
 import (
-	"bytes"
-	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"merch_store/internal/app"
 	"merch_store/internal/models"
 	"merch_store/internal/pkg/logger"
 	"merch_store/internal/service"
+	"merch_store/internal/service/servicetest"
 	"merch_store/internal/storage"
 
 	"github.com/joho/godotenv"
@@ -33,7 +37,7 @@ func init() {
 type IntegrationTestSuite struct {
 	suite.Suite
 	server *httptest.Server
-	client *http.Client
+	client *servicetest.Client
 	db     *storage.PostgreSQL
 }
 
@@ -54,7 +58,7 @@ func (s *IntegrationTestSuite) SetupSuite() {
 	serviceInstance := service.NewService(appInstance, "localhost:"+testServerPort, l)
 
 	s.server = httptest.NewServer(serviceInstance.NewRouter())
-	s.client = s.server.Client()
+	s.client = servicetest.NewClient(s.server)
 }
 
 func (s *IntegrationTestSuite) TearDownSuite() {
@@ -63,203 +67,149 @@ func (s *IntegrationTestSuite) TearDownSuite() {
 }
 
 func (s *IntegrationTestSuite) TestBuyMerch() {
-	authReq := models.AuthRequest{
-		Username: "employee1",
-		Password: "password",
-	}
-	reqBody, err := json.Marshal(authReq)
-	s.Require().NoError(err, "Error marshaling authentication request")
-
-	resp, err := s.client.Post(s.server.URL+"/api/auth", "application/json", bytes.NewBuffer(reqBody))
-	s.Require().NoError(err, "Error sending authentication request")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for authentication")
-
-	var authResp models.AuthResponse
-	err = json.NewDecoder(resp.Body).Decode(&authResp)
-	resp.Body.Close()
-	s.Require().NoError(err, "Error decoding authentication response")
-	s.Require().NotEmpty(authResp.Token, "Token should not be empty")
+	client := s.client.Login(s.T(), "employee1", "password")
 
 	itemName := "t-shirt"
-	req, err := http.NewRequest("GET", s.server.URL+"/api/buy/"+itemName, nil)
-	s.Require().NoError(err, "Error creating merch purchase request")
-	req.Header.Set("Authorization", "Bearer "+authResp.Token)
-
-	resp, err = s.client.Do(req)
-	s.Require().NoError(err, "Error executing merch purchase request")
+	resp := client.Get(s.T(), "/api/buy/"+itemName)
 	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for merch purchase")
-	resp.Body.Close()
+	var purchase models.PurchaseResult
+	resp.Decode(s.T(), &purchase)
 
-	req, err = http.NewRequest("GET", s.server.URL+"/api/info", nil)
-	s.Require().NoError(err, "Error creating request to retrieve user info")
-	req.Header.Set("Authorization", "Bearer "+authResp.Token)
-	resp, err = s.client.Do(req)
-	s.Require().NoError(err, "Error executing request to retrieve user info")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for retrieving user info")
+	var catalog []models.CatalogItem
+	s.client.Get(s.T(), "/api/merch").Decode(s.T(), &catalog)
 
-	var infoResp models.InfoResponse
-	err = json.NewDecoder(resp.Body).Decode(&infoResp)
-	resp.Body.Close()
-	s.Require().NoError(err, "Error decoding user info")
+	s.Equal(itemName, purchase.Item)
+	s.Equal(1, purchase.Quantity)
+	s.Contains(catalog, models.CatalogItem{Name: itemName, Price: purchase.Price}, "Purchase price should match the catalog")
 
+	infoResp := s.info(client)
+	s.Equal(infoResp.Coins, purchase.RemainingCoins, "Remaining coins should match the balance")
 	s.T().Logf("User coins after purchase: %d", infoResp.Coins)
 	s.T().Logf("User inventory: %+v", infoResp.Inventory)
 }
 
+// info retrieves /api/info as the user of the client.
+func (s *IntegrationTestSuite) info(client *servicetest.Client) models.InfoResponse {
+	resp := client.Get(s.T(), "/api/info")
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for retrieving user info")
+
+	var infoResp models.InfoResponse
+	resp.Decode(s.T(), &infoResp)
+	return infoResp
+}
+
 func (s *IntegrationTestSuite) TestSendCoin() {
-	employee1 := models.AuthRequest{
-		Username: "employee2",
-		Password: "password",
-	}
-	employee2 := models.AuthRequest{
-		Username: "employee3",
-		Password: "password",
-	}
+	sender := s.client.Login(s.T(), "employee2", "password")
+	receiver := s.client.Login(s.T(), "employee3", "password")
 
-	getToken := func(authReq models.AuthRequest) string {
-		reqBody, err := json.Marshal(authReq)
-		s.Require().NoError(err, "Error marshaling authentication request")
+	resp := sender.PostJSON(s.T(), "/api/sendCoin", models.SendCoinRequest{ToUser: "employee3", Amount: 100})
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for coin transfer")
 
-		resp, err := s.client.Post(s.server.URL+"/api/auth", "application/json", bytes.NewBuffer(reqBody))
-		s.Require().NoError(err, "Error sending authentication request")
-		s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for authentication")
+	senderInfo := s.info(sender)
+	receiverInfo := s.info(receiver)
 
-		var authResp models.AuthResponse
-		err = json.NewDecoder(resp.Body).Decode(&authResp)
-		resp.Body.Close()
-		s.Require().NoError(err, "Error decoding authentication response")
-		s.Require().NotEmpty(authResp.Token, "Token should not be empty")
-		return authResp.Token
-	}
+	s.T().Logf("Sender coins: %d", senderInfo.Coins)
+	s.T().Logf("Receiver coins: %d", receiverInfo.Coins)
+	s.Require().Equal(int64(900), senderInfo.Coins, "Sender should have 900 coins")
+	s.Require().Equal(int64(1100), receiverInfo.Coins, "Receiver should have 1100 coins")
+}
 
-	tokenSender := getToken(employee1)
-	tokenReceiver := getToken(employee2)
+// TestUsernameWhitespace checks that usernames differing only in whitespace register, sign in, and receive
+// transfers as one user.
+func (s *IntegrationTestSuite) TestUsernameWhitespace() {
+	username := fmt.Sprintf("white space %d", time.Now().UnixNano())
+	variant := "  " + strings.ReplaceAll(username, " ", " \t ") + " "
 
-	sendReq := models.SendCoinRequest{
-		ToUser: employee2.Username,
-		Amount: 100,
-	}
-	reqBody, err := json.Marshal(sendReq)
-	s.Require().NoError(err, "Error marshalling coin transfer request")
+	registered := s.client.Login(s.T(), variant, "password")
+	resp := registered.Get(s.T(), "/api/buy/pen")
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for merch purchase")
 
-	req, err := http.NewRequest("POST", s.server.URL+"/api/sendCoin", bytes.NewBuffer(reqBody))
-	s.Require().NoError(err, "Error creating coin transfer request")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+tokenSender)
+	signedIn := s.client.Login(s.T(), username, "password")
+	s.Equal(s.info(registered).Coins, s.info(signedIn).Coins, "The variant should sign in to the registered user")
 
-	resp, err := s.client.Do(req)
-	s.Require().NoError(err, "Error executing coin transfer request")
+	before := s.info(signedIn).Coins
+	sender := s.client.Login(s.T(), "employee5", "password")
+	resp = sender.PostJSON(s.T(), "/api/sendCoin", models.SendCoinRequest{ToUser: username + "\t", Amount: 10})
 	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for coin transfer")
-	resp.Body.Close()
+	s.Equal(before+10, s.info(signedIn).Coins, "The registered user should receive the coins")
+}
 
-	reqSenderInfo, err := http.NewRequest("GET", s.server.URL+"/api/info", nil)
-	s.Require().NoError(err, "Error creating request for sender info")
-	reqSenderInfo.Header.Set("Authorization", "Bearer "+tokenSender)
+func (s *IntegrationTestSuite) TestInfo() {
+	client := s.client.Login(s.T(), "employee4", "password")
 
-	resp, err = s.client.Do(reqSenderInfo)
-	s.Require().NoError(err, "Error executing request for sender info")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for retrieving sender info")
+	resp := client.Get(s.T(), "/api/buy/book")
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for purchasing book")
 
-	var senderInfo models.InfoResponse
-	err = json.NewDecoder(resp.Body).Decode(&senderInfo)
-	resp.Body.Close()
-	s.Require().NoError(err, "Error decoding sender info")
+	resp = client.Get(s.T(), "/api/buy/umbrella")
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for purchasing umbrella")
 
-	reqReceiverInfo, err := http.NewRequest("GET", s.server.URL+"/api/info", nil)
-	s.Require().NoError(err, "Error creating request for receiver info")
-	reqReceiverInfo.Header.Set("Authorization", "Bearer "+tokenReceiver)
+	resp = client.PostJSON(s.T(), "/api/sendCoin", models.SendCoinRequest{ToUser: "employee1", Amount: 113})
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for coin transfer")
 
-	resp, err = s.client.Do(reqReceiverInfo)
-	s.Require().NoError(err, "Error executing request for receiver info")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for retrieving receiver info")
+	infoResp := s.info(client)
+	s.T().Logf("Employee4 coins after transactions: %d", infoResp.Coins)
+	s.T().Logf("Employee4 inventory: %+v", infoResp.Inventory)
+	s.T().Logf("Employee4 coin history: %+v", infoResp.CoinHistory)
+}
 
-	var receiverInfo models.InfoResponse
-	err = json.NewDecoder(resp.Body).Decode(&receiverInfo)
-	resp.Body.Close()
-	s.Require().NoError(err, "Error decoding receiver info")
+func (s *IntegrationTestSuite) TestGiftMerch() {
+	buyer := s.client.Login(s.T(), "employee5", "password")
+	recipient := s.client.Login(s.T(), "employee6", "password")
 
-	s.T().Logf("Sender coins: %d", senderInfo.Coins)
-	s.T().Logf("Receiver coins: %d", receiverInfo.Coins)
-	s.Require().Equal(900, senderInfo.Coins, "Sender should have 900 coins")
-	s.Require().Equal(1100, receiverInfo.Coins, "Receiver should have 1100 coins")
-}
+	resp := buyer.PostJSON(s.T(), "/api/buy/hoody/gift", models.GiftRequest{ToUser: "employee6"})
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for gift purchase")
 
-func (s *IntegrationTestSuite) TestInfo() {
-	// Authenticate user employee4
-	employee4Auth := models.AuthRequest{
-		Username: "employee4",
-		Password: "password",
-	}
-	reqBody, err := json.Marshal(employee4Auth)
-	s.Require().NoError(err, "Error marshaling authentication request for employee4")
-
-	resp, err := s.client.Post(s.server.URL+"/api/auth", "application/json", bytes.NewBuffer(reqBody))
-	s.Require().NoError(err, "Error sending authentication request for employee4")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for employee4 authentication")
-
-	var authResp models.AuthResponse
-	err = json.NewDecoder(resp.Body).Decode(&authResp)
-	resp.Body.Close()
-	s.Require().NoError(err, "Error decoding employee4 authentication response")
-	s.Require().NotEmpty(authResp.Token, "Employee4 token should not be empty")
-
-	// Purchase item 'book'
-	req, err := http.NewRequest("GET", s.server.URL+"/api/buy/book", nil)
-	s.Require().NoError(err, "Error creating purchase request for book")
-	req.Header.Set("Authorization", "Bearer "+authResp.Token)
-
-	resp, err = s.client.Do(req)
-	s.Require().NoError(err, "Error executing purchase request for book")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for purchasing book")
-	resp.Body.Close()
+	buyerInfo := s.info(buyer)
+	recipientInfo := s.info(recipient)
 
-	// Purchase item 'umbrella'
-	req, err = http.NewRequest("GET", s.server.URL+"/api/buy/umbrella", nil)
-	s.Require().NoError(err, "Error creating purchase request for umbrella")
-	req.Header.Set("Authorization", "Bearer "+authResp.Token)
+	s.Require().Equal(int64(700), buyerInfo.Coins, "Buyer should be charged for the gift")
+	s.Require().Empty(buyerInfo.Inventory, "Buyer inventory should not include the gift")
+	s.Require().Equal([]models.GiftDetail{{ToUser: "employee6", Item: "hoody", Amount: 300}}, buyerInfo.CoinHistory.Gifts)
 
-	resp, err = s.client.Do(req)
-	s.Require().NoError(err, "Error executing purchase request for umbrella")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for purchasing umbrella")
-	resp.Body.Close()
+	s.Require().Equal(int64(1000), recipientInfo.Coins, "Recipient should not be charged for the gift")
+	s.Require().Equal([]models.InventoryItem{{Type: "hoody", Quantity: 1, PendingQuantity: 1}}, recipientInfo.Inventory)
+}
 
-	// Transfer 113 coins to employee1
-	coinTransferReq := models.SendCoinRequest{
-		ToUser: "employee1",
-		Amount: 113,
-	}
-	reqBody, err = json.Marshal(coinTransferReq)
-	s.Require().NoError(err, "Error marshaling coin transfer request for employee4")
+// TestUserDataExport runs after TestInfo, whose purchases and transfer of employee4 it expects in the export.
+func (s *IntegrationTestSuite) TestUserDataExport() {
+	client := s.client.Login(s.T(), "employee4", "password")
 
-	req, err = http.NewRequest("POST", s.server.URL+"/api/sendCoin", bytes.NewBuffer(reqBody))
-	s.Require().NoError(err, "Error creating coin transfer request for employee4")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+authResp.Token)
+	resp := client.Get(s.T(), "/api/account/export")
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for data export")
 
-	resp, err = s.client.Do(req)
-	s.Require().NoError(err, "Error executing coin transfer request for employee4")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for coin transfer")
-	resp.Body.Close()
+	var export struct {
+		Account   models.AccountExport    `json:"account"`
+		Purchases []models.PurchaseExport `json:"purchases"`
+		Transfers []models.Transfer       `json:"transfers"`
+		Sessions  []models.SessionExport  `json:"sessions"`
+	}
+	resp.Decode(s.T(), &export)
 
-	// Retrieve transaction history
-	req, err = http.NewRequest("GET", s.server.URL+"/api/info", nil)
-	s.Require().NoError(err, "Error creating request for employee4 info")
-	req.Header.Set("Authorization", "Bearer "+authResp.Token)
+	s.Equal("employee4", export.Account.Username)
 
-	resp, err = s.client.Do(req)
-	s.Require().NoError(err, "Error executing request for employee4 info")
-	s.Require().Equal(http.StatusOK, resp.StatusCode, "Expected status 200 for retrieving employee4 info")
+	var items []string
+	for _, purchase := range export.Purchases {
+		items = append(items, purchase.Item)
+	}
+	s.Contains(items, "book", "Export should contain the purchase made earlier")
 
-	var infoResp models.InfoResponse
-	err = json.NewDecoder(resp.Body).Decode(&infoResp)
-	resp.Body.Close()
-	s.Require().NoError(err, "Error decoding employee4 info response")
+	transferFound := false
+	for _, transfer := range export.Transfers {
+		if transfer.FromUser == "employee4" && transfer.ToUser == "employee1" && transfer.Amount == 113 {
+			transferFound = true
+		}
+	}
+	s.True(transferFound, "Export should contain the transfer made earlier")
 
-	s.T().Logf("Employee4 coins after transactions: %d", infoResp.Coins)
-	s.T().Logf("Employee4 inventory: %+v", infoResp.Inventory)
-	s.T().Logf("Employee4 coin history: %+v", infoResp.CoinHistory)
+	resp = client.Get(s.T(), "/api/account/export")
+	s.Equal(http.StatusTooManyRequests, resp.StatusCode, "Expected status 429 for a second export within the hour")
+	s.NotEmpty(resp.Header.Get("Retry-After"))
 }
 
 func TestIntegrationTestSuite(t *testing.T) {
+	if testDatabaseURI == "" {
+		t.Skip("no test database: set TEST_DATABASE_URI or run without -short with docker available")
+	}
+
 	suite.Run(t, new(IntegrationTestSuite))
 }
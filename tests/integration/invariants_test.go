@@ -0,0 +1,108 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// TestCheckInvariantsReportsCorruption corrupts the rows of fresh users behind the storage's back, one class
+// of invariants at a time, and checks that CheckInvariants reports each of them against the corrupted row.
+// Every corruption is undone when its subtest ends, so that later checks of the shared database stay clean.
+func TestCheckInvariantsReportsCorruption(t *testing.T) {
+	db := openStorage(t, storage.DriverSQL)
+	defer db.Close()
+
+	conn, err := sql.Open("pgx", testDatabaseURI)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+	createUser := func(name string, coins int64) *models.User {
+		user, err := db.CreateUser(ctx, &models.User{Username: fmt.Sprintf("invariants_%s_%d", name, suffix), Password: "password", Coins: coins})
+		require.NoError(t, err)
+		return user
+	}
+	corrupt := func(t *testing.T, query string, undo string, args ...any) {
+		_, err := conn.ExecContext(ctx, query, args...)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := conn.ExecContext(ctx, undo, args...)
+			assert.NoError(t, err)
+		})
+	}
+	check := func(t *testing.T, invariant string, table string, rowID int64) models.InvariantViolation {
+		report, err := db.CheckInvariants(ctx)
+		require.NoError(t, err)
+		for _, violation := range report.Violations {
+			if violation.Invariant == invariant && violation.Table == table && violation.RowID == rowID {
+				return violation
+			}
+		}
+		require.Failf(t, "violation not reported", "no %s violation of %s row %d in %+v", invariant, table, rowID, report.Violations)
+		return models.InvariantViolation{}
+	}
+
+	sender := createUser("sender", 1000)
+	recipient := createUser("recipient", 0)
+	transfer, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 100})
+	require.NoError(t, err)
+	transferID := transfer.TransferID
+	_, err = db.BuyItem(ctx, sender.ID, "cup")
+	require.NoError(t, err)
+
+	t.Run("NegativeBalance", func(t *testing.T) {
+		corrupt(t, `INSERT INTO content.coin_holds (user_id, amount, reason) VALUES ($1, 150, 'invariants');`,
+			`DELETE FROM content.coin_holds WHERE user_id = $1 AND reason = 'invariants';`, recipient.ID)
+
+		violation := check(t, models.InvariantNegativeBalance, "content.users", int64(recipient.ID))
+		assert.Equal(t, int64(-50), violation.Actual)
+	})
+
+	t.Run("LedgerBalance", func(t *testing.T) {
+		corrupt(t, `UPDATE content.users SET coins = coins + 7 WHERE id = $1;`,
+			`UPDATE content.users SET coins = coins - 7 WHERE id = $1;`, sender.ID)
+
+		violation := check(t, models.InvariantLedgerBalance, "content.users", int64(sender.ID))
+		assert.Equal(t, int64(1000-100-20), violation.Expected)
+		assert.Equal(t, int64(1000-100-20+7), violation.Actual)
+	})
+
+	t.Run("TransferBalance", func(t *testing.T) {
+		corrupt(t, `UPDATE content.coin_transfers SET reversed_at = NOW() WHERE id = $1;`,
+			`UPDATE content.coin_transfers SET reversed_at = NULL WHERE id = $1;`, transferID)
+
+		check(t, models.InvariantTransferBalance, "content.coin_transfers", transferID)
+	})
+
+	t.Run("PurchaseTotal", func(t *testing.T) {
+		corrupt(t, `UPDATE content.inventory_counts SET quantity = quantity + 2 WHERE user_id = $1;`,
+			`UPDATE content.inventory_counts SET quantity = quantity - 2 WHERE user_id = $1;`, sender.ID)
+
+		violation := check(t, models.InvariantPurchaseTotal, "content.inventory_counts", int64(sender.ID))
+		assert.Equal(t, int64(1), violation.Expected)
+		assert.Equal(t, int64(3), violation.Actual)
+	})
+
+	t.Run("Username", func(t *testing.T) {
+		// Usernames stored before they were normalized may differ from existing ones in whitespace only.
+		corrupt(t, `INSERT INTO content.users (username, password_hash, coins, opening_coins) SELECT username || '  ', password_hash, 0, 0 FROM content.users WHERE id = $1;`,
+			`DELETE FROM content.users WHERE username = (SELECT username || '  ' FROM content.users WHERE id = $1);`, recipient.ID)
+
+		violation := check(t, models.InvariantUsername, "content.users", int64(recipient.ID))
+		assert.Equal(t, int64(2), violation.Actual, "both users sharing the normalized username must be reported")
+		assert.Contains(t, violation.Detail, recipient.Username)
+	})
+}
@@ -0,0 +1,76 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"merch_store/internal/models"
+	"merch_store/internal/storage"
+)
+
+// TestBalanceIsolation runs concurrent transfers and purchases touching the same rows under both isolation levels.
+// Under serializable isolation the conflicting transactions are aborted with SQLSTATE 40001 and must be
+// retried transparently, so every operation succeeds and the final balances add up in both modes.
+func TestBalanceIsolation(t *testing.T) {
+	levels := map[string]sql.IsolationLevel{
+		"read_committed": sql.LevelReadCommitted,
+		"serializable":   sql.LevelSerializable,
+	}
+
+	for name, level := range levels {
+		t.Run(name, func(t *testing.T) {
+			db := openStorage(t, storage.DriverSQL)
+			defer db.Close()
+			db.SetBalanceIsolation(level)
+
+			ctx := context.Background()
+			suffix := fmt.Sprintf("%s_%d", name, time.Now().UnixNano())
+			sender, err := db.CreateUser(ctx, &models.User{Username: "isolation_sender_" + suffix, Password: "password", Coins: 1000})
+			require.NoError(t, err)
+			recipient, err := db.CreateUser(ctx, &models.User{Username: "isolation_recipient_" + suffix, Password: "password", Coins: 1000})
+			require.NoError(t, err)
+
+			const workers = 10
+			var wg sync.WaitGroup
+			errs := make(chan error, 2*workers)
+			for i := 0; i < workers; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					_, err := db.TransferCoins(ctx, sender.ID, models.SendCoinRequest{ToUser: recipient.Username, Amount: 10})
+					errs <- err
+				}()
+				go func() {
+					defer wg.Done()
+					_, err := db.BuyItem(ctx, sender.ID, "pen")
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				assert.NoError(t, err)
+			}
+
+			senderInfo, err := db.GetInfo(ctx, sender.ID)
+			require.NoError(t, err)
+			recipientInfo, err := db.GetInfo(ctx, recipient.ID)
+			require.NoError(t, err)
+
+			assert.Equal(t, int64(1000-workers*10-workers*10), senderInfo.Coins)
+			assert.Equal(t, int64(1000+workers*10), recipientInfo.Coins)
+			assert.Len(t, senderInfo.CoinHistory.Sent, workers)
+			assert.Equal(t, []models.InventoryItem{{Type: "pen", Quantity: workers, PendingQuantity: workers}}, senderInfo.Inventory)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/pkg/worker"
+	"merch_store/internal/storage"
+)
+
+// electionInterval is the election interval and the leadership keep-alive interval of the instances under test.
+const electionInterval = 50 * time.Millisecond
+
+// terminateLeaderQuery ends the session holding the advisory lock of the leadership key $1, as a lost database
+// connection would.
+const terminateLeaderQuery = `SELECT pg_terminate_backend(pid) FROM pg_locks WHERE locktype = 'advisory' AND granted AND objsubid = 1 AND objid::bigint = hashtext($1)::bigint & 4294967295;`
+
+// jobInstance is an in-process instance of the service with a singleton job. active is 1 while the job runs on
+// the instance; the job also counts the instances running it in running, and the times it overlapped in overlaps.
+type jobInstance struct {
+	db      *storage.PostgreSQL
+	manager *worker.Manager
+	active  atomic.Int32
+}
+
+func startJobInstance(t *testing.T, driver string, key string, running *atomic.Int32, overlaps *atomic.Int32) *jobInstance {
+	t.Helper()
+
+	instance := &jobInstance{db: openStorage(t, driver)}
+	instance.db.SetLeaderKeepAlive(electionInterval)
+	instance.manager = worker.NewManager(&logger.Logger{Logger: zap.NewNop()}, 5*time.Second)
+	instance.manager.SetElector(instance.db.Elector(key), electionInterval)
+	instance.manager.RegisterSingleton("job", worker.Func(func(ctx context.Context) error {
+		instance.active.Add(1)
+		defer instance.active.Add(-1)
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer running.Add(-1)
+
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	instance.manager.Start(context.Background())
+
+	return instance
+}
+
+// stop stops the instance and closes its storage.
+func (instance *jobInstance) stop(t *testing.T) {
+	assert.NoError(t, instance.manager.Stop())
+	instance.db.Close()
+}
+
+// TestLeaderElectedJobs runs two instances sharing the database and checks that their singleton job runs on one
+// of them only, and that the other takes it over when the leader stops or loses its database connection.
+func TestLeaderElectedJobs(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			t.Run("Leader stops", func(t *testing.T) {
+				var running, overlaps atomic.Int32
+				key := fmt.Sprintf("integration/%s/%d", driver, time.Now().UnixNano())
+				first := startJobInstance(t, driver, key, &running, &overlaps)
+				require.Eventually(t, func() bool { return first.active.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+				second := startJobInstance(t, driver, key, &running, &overlaps)
+				defer second.stop(t)
+
+				time.Sleep(5 * electionInterval)
+				assert.Zero(t, second.active.Load(), "the job must not run on the follower")
+
+				first.stop(t)
+				require.Eventually(t, func() bool { return second.active.Load() == 1 }, 5*time.Second, 10*time.Millisecond,
+					"the follower must take the job over once the leader stops")
+				assert.Zero(t, overlaps.Load(), "the job must never run on both instances at once")
+			})
+
+			t.Run("Leader loses its connection", func(t *testing.T) {
+				var running, overlaps atomic.Int32
+				key := fmt.Sprintf("integration/%s/%d", driver, time.Now().UnixNano())
+				first := startJobInstance(t, driver, key, &running, &overlaps)
+				defer first.stop(t)
+				require.Eventually(t, func() bool { return first.active.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+				second := startJobInstance(t, driver, key, &running, &overlaps)
+				defer second.stop(t)
+
+				admin, err := sql.Open("pgx", testDatabaseURI)
+				require.NoError(t, err)
+				defer admin.Close()
+				_, err = admin.Exec(terminateLeaderQuery, key)
+				require.NoError(t, err)
+
+				require.Eventually(t, func() bool { return first.active.Load() == 0 && second.active.Load() == 1 }, 5*time.Second, 10*time.Millisecond,
+					"the leader must stop the job once its connection is lost, and the follower take it over")
+			})
+		})
+	}
+}
@@ -0,0 +1,28 @@
+//go:build integration
+
+package integrations
+
+import (
+	"flag"
+	"log"
+	"os"
+	"testing"
+
+	"merch_store/tests/testutil"
+)
+
+// TestMain resolves the test database before running the tests: TEST_DATABASE_URI when set,
+// otherwise a disposable container started by testutil unless the tests run with -short.
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	uri, stop, err := testutil.StartDatabase(testing.Short())
+	if err != nil {
+		log.Fatalf("Failed to start the test database: %s", err)
+	}
+	testDatabaseURI = uri
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
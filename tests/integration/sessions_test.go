@@ -0,0 +1,64 @@
+//go:build integration
+
+package integrations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/service"
+	"merch_store/internal/storage"
+)
+
+// TestSessionLimit signs in four times with a limit of three sessions and checks that the first token
+// stops working while the other three still authenticate.
+func TestSessionLimit(t *testing.T) {
+	db := openStorage(t, storage.DriverSQL)
+	defer db.Close()
+
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(db, l)
+	appInstance.SetSessionLimit(3)
+	server := httptest.NewServer(service.NewService(appInstance, "", l).NewRouter())
+	defer server.Close()
+
+	reqBody, err := json.Marshal(models.AuthRequest{Username: fmt.Sprintf("session_user_%d", time.Now().UnixNano()), Password: "password"})
+	require.NoError(t, err)
+
+	tokens := make([]string, 4)
+	for i := range tokens {
+		resp, err := server.Client().Post(server.URL+"/api/auth", "application/json", bytes.NewBuffer(reqBody))
+		require.NoError(t, err)
+		var authResp models.AuthResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&authResp))
+		resp.Body.Close()
+		tokens[i] = authResp.Token
+	}
+
+	info := func(token string) int {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/info", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, info(tokens[0]))
+	for _, token := range tokens[1:] {
+		assert.Equal(t, http.StatusOK, info(token))
+	}
+}
@@ -0,0 +1,121 @@
+//go:build integration
+
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+	"merch_store/internal/storage/storagetest"
+	"merch_store/tests/testutil"
+)
+
+// drivers lists the storage drivers that must behave identically.
+var drivers = []string{storage.DriverSQL, storage.DriverPgxPool}
+
+// openStorage connects to the test database with the given driver, skipping the test when it is not available.
+func openStorage(tb testing.TB, driver string) *storage.PostgreSQL {
+	tb.Helper()
+	return testutil.OpenStorage(tb, testDatabaseURI, driver)
+}
+
+func TestStorageConformance(t *testing.T) {
+	if testDatabaseURI == "" {
+		t.Skip("no test database: set TEST_DATABASE_URI or run without -short with docker available")
+	}
+
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			storagetest.RunConformanceTests(t, func() storage.Storage {
+				db, err := storage.Open(driver, testDatabaseURI, &logger.Logger{Logger: zap.NewNop()})
+				if err != nil {
+					panic(fmt.Sprintf("connecting to test database with driver %s: %s", driver, err))
+				}
+				return db
+			})
+		})
+	}
+}
+
+func BenchmarkBuyItem(b *testing.B) {
+	for _, driver := range drivers {
+		b.Run(driver, func(b *testing.B) {
+			db := openStorage(b, driver)
+			defer db.Close()
+
+			ctx := context.Background()
+			user, err := db.CreateUser(ctx, &models.User{Username: fmt.Sprintf("bench_buyer_%s_%d", driver, time.Now().UnixNano()), Password: "password", Coins: 2_000_000_000})
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.BuyItem(ctx, user.ID, "pen"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetMerchPurchasesInfo reads the inventory of users with a growing number of purchases of two items.
+// The inventory is read from the materialized counts, so its cost should not grow with the number of purchases.
+func BenchmarkGetMerchPurchasesInfo(b *testing.B) {
+	for _, driver := range drivers {
+		for _, purchases := range []int{100, 5000} {
+			b.Run(fmt.Sprintf("%s/%d", driver, purchases), func(b *testing.B) {
+				db := openStorage(b, driver)
+				defer db.Close()
+
+				ctx := context.Background()
+				user, err := db.CreateUser(ctx, &models.User{Username: fmt.Sprintf("bench_inventory_%s_%d", driver, time.Now().UnixNano()), Password: "password", Coins: 2_000_000_000})
+				require.NoError(b, err)
+				for i := 0; i < purchases; i++ {
+					_, err := db.BuyItem(ctx, user.ID, []string{"pen", "cup"}[i%2])
+					require.NoError(b, err)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := db.GetMerchPurchasesInfo(ctx, nil, user.ID); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkTransferCoins(b *testing.B) {
+	for _, driver := range drivers {
+		b.Run(driver, func(b *testing.B) {
+			db := openStorage(b, driver)
+			defer db.Close()
+
+			ctx := context.Background()
+			suffix := fmt.Sprintf("%s_%d", driver, time.Now().UnixNano())
+			first, err := db.CreateUser(ctx, &models.User{Username: "bench_first_" + suffix, Password: "password", Coins: 1000})
+			require.NoError(b, err)
+			second, err := db.CreateUser(ctx, &models.User{Username: "bench_second_" + suffix, Password: "password", Coins: 1000})
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				from, to := first, second
+				if i%2 == 1 {
+					from, to = second, first
+				}
+				if _, err := db.TransferCoins(ctx, from.ID, models.SendCoinRequest{ToUser: to.Username, Amount: 1}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
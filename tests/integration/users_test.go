@@ -0,0 +1,78 @@
+//go:build integration
+
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"merch_store/internal/app"
+	"merch_store/internal/models"
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/service"
+	"merch_store/internal/storage"
+)
+
+// TestDeletedUserToken checks that a token of a user deleted after sign-in is rejected
+// with 401 when user validation is enabled, instead of failing deep in the storage layer.
+func TestDeletedUserToken(t *testing.T) {
+	db := openStorage(t, storage.DriverSQL)
+	defer db.Close()
+
+	l := &logger.Logger{Logger: zap.NewNop()}
+	appInstance := app.NewApp(db, l)
+	appInstance.SetUserValidation(0)
+	server := httptest.NewServer(service.NewService(appInstance, "", l).NewRouter())
+	defer server.Close()
+
+	username := fmt.Sprintf("deleted_user_%d", time.Now().UnixNano())
+	reqBody, err := json.Marshal(models.AuthRequest{Username: username, Password: "password"})
+	require.NoError(t, err)
+	resp, err := server.Client().Post(server.URL+"/api/auth", "application/json", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	var authResp models.AuthResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&authResp))
+	resp.Body.Close()
+	require.NotEmpty(t, authResp.Token)
+
+	buy := func() (*http.Response, models.ErrorResponse) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/buy/pen", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+authResp.Token)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var errResp models.ErrorResponse
+		if resp.StatusCode != http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+		}
+		return resp, errResp
+	}
+
+	resp, _ = buy()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	conn, err := sql.Open("pgx", testDatabaseURI)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), `DELETE FROM content.users WHERE username = $1;`, username)
+	require.NoError(t, err)
+
+	resp, errResp := buy()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "account no longer active", errResp.Errors)
+	assert.Equal(t, models.ErrCodeAccountInactive, errResp.Code)
+}
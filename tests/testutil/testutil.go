@@ -0,0 +1,124 @@
+// Package testutil provides the shared setup of tests that need a PostgreSQL database.
+// When TEST_DATABASE_URI is set, that database is used as is. Otherwise, unless tests run with -short,
+// a disposable PostgreSQL container is started with testcontainers-go, the migrations are applied to it,
+// and the container is removed once the tests finish.
+package testutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"go.uber.org/zap"
+
+	"merch_store/internal/pkg/logger"
+	"merch_store/internal/storage"
+)
+
+// Settings of the disposable database container.
+const (
+	postgresImage    = "postgres:13"
+	postgresUser     = "postgres"
+	postgresPassword = "password"
+	postgresDB       = "shop"
+	startupTimeout   = 60 * time.Second
+)
+
+// StartDatabase returns the URI of the database the tests should use and a function releasing it.
+// It returns TEST_DATABASE_URI when set. Otherwise, when short is false, it starts a PostgreSQL container
+// and applies the migrations; it fails when no container runtime is available, rather than letting the
+// database tests pass without running. An empty URI means that short is set and database tests should be skipped.
+func StartDatabase(short bool) (string, func(), error) {
+	noop := func() {}
+
+	if uri := os.Getenv("TEST_DATABASE_URI"); uri != "" {
+		return uri, noop, nil
+	}
+
+	if short {
+		return "", noop, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+
+	container, err := postgres.Run(ctx, postgresImage,
+		postgres.WithUsername(postgresUser),
+		postgres.WithPassword(postgresPassword),
+		postgres.WithDatabase(postgresDB),
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).WithStartupTimeout(startupTimeout)))
+	if err != nil {
+		return "", noop, fmt.Errorf("starting postgres container (set TEST_DATABASE_URI, or use -short to skip the database tests): %w", err)
+	}
+	stop := func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			log.Printf("Failed to stop postgres container %s: %s", container.GetContainerID(), err)
+		}
+	}
+
+	uri, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		stop()
+		return "", noop, fmt.Errorf("resolving postgres container address: %w", err)
+	}
+
+	if err := migrate(ctx, uri); err != nil {
+		stop()
+		return "", noop, err
+	}
+
+	return uri, stop, nil
+}
+
+// OpenStorage connects to the database at uri with the given driver, skipping the test when uri is empty.
+func OpenStorage(tb testing.TB, uri string, driver string) *storage.PostgreSQL {
+	tb.Helper()
+
+	if uri == "" {
+		tb.Skip("no test database: set TEST_DATABASE_URI or run without -short")
+	}
+
+	db, err := storage.Open(driver, uri, &logger.Logger{Logger: zap.NewNop()})
+	require.NoError(tb, err, "Error connecting to test database")
+	return db
+}
+
+// ApplyMigrations executes the schema and seed data migrations against db.
+func ApplyMigrations(ctx context.Context, db *sql.DB) error {
+	migration, err := os.ReadFile(migrationsPath())
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, string(migration))
+	return err
+}
+
+// migrate applies the migrations to the database at uri.
+func migrate(ctx context.Context, uri string) error {
+	db, err := sql.Open("pgx", uri)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return ApplyMigrations(ctx, db)
+}
+
+// migrationsPath returns the path of the migrations file relative to this source file.
+func migrationsPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "internal", "storage", "migrations", "init.sql")
+}